@@ -0,0 +1,8 @@
+// Package benchmarks has the performance benchmarks of the data streamer through its public API: encoding and
+// decoding of the entries, append of the entries to the stream, catch-up read of the stream by a client and broadcast
+// fan-out of the entries committed to several clients. The output of `make bench` is in the benchstat format, to
+// compare it with the baseline of the repository (baseline.txt) or between branches:
+//
+//	make bench
+//	benchstat benchmarks/baseline.txt bench_output.txt
+package benchmarks
@@ -0,0 +1,211 @@
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	streamType     = datastreamer.StreamType(1)
+	entryType      = datastreamer.EntryType(1)
+	payloadSize    = 256   // Payload of the entries of the stream benchmarks
+	catchUpEntries = 10000 // Entries of the stream read by the catch-up benchmark
+	opEntries      = 10    // Entries of the atomic operations of the broadcast benchmark
+)
+
+var (
+	// Payload sizes of the encoding benchmarks
+	payloadSizes = []int{32, 256, 4096}
+
+	// Only the fatal logs, so the benchmarks output is kept in the benchstat format (go test merges stderr)
+	logConfig = log.Config{
+		Environment: "production",
+		Level:       "fatal",
+		Outputs:     []string{"stderr"},
+	}
+
+	sinkBytes []byte
+	sinkEntry codec.Entry
+)
+
+func TestMain(m *testing.M) {
+	log.Init(logConfig)
+	os.Exit(m.Run())
+}
+
+func BenchmarkEncodeEntry(b *testing.B) {
+	for _, size := range payloadSizes {
+		b.Run(fmt.Sprintf("payload=%d", size), func(b *testing.B) {
+			e := newEntry(size)
+			b.SetBytes(int64(e.Length))
+			for i := 0; i < b.N; i++ {
+				sinkBytes = codec.EncodeEntry(e)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeEntry(b *testing.B) {
+	for _, size := range payloadSizes {
+		b.Run(fmt.Sprintf("payload=%d", size), func(b *testing.B) {
+			data := codec.EncodeEntry(newEntry(size))
+			b.SetBytes(int64(len(data)))
+			var err error
+			for i := 0; i < b.N; i++ {
+				sinkEntry, err = codec.DecodeEntry(data)
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// BenchmarkAppend measures the entries added to the stream, and committed in atomic operations of several sizes
+func BenchmarkAppend(b *testing.B) {
+	for i, perCommit := range []int{1, 10, 100} {
+		s := startServer(b, uint16(6928+i))
+		data := make([]byte, payloadSize)
+		b.Run(fmt.Sprintf("entries=%d", perCommit), func(b *testing.B) {
+			b.SetBytes(codec.FixedSizeFileEntry + payloadSize)
+			for n := 0; n < b.N; n += perCommit {
+				commitOp(b, s, min(perCommit, b.N-n), data)
+			}
+		})
+	}
+}
+
+// BenchmarkCatchUp measures a client streaming the entries of the stream from the first one
+func BenchmarkCatchUp(b *testing.B) {
+	const port = 6931
+	s := startServer(b, port)
+	data := make([]byte, payloadSize)
+	for n := 0; n < catchUpEntries; n += 100 {
+		commitOp(b, s, 100, data)
+	}
+
+	b.Run(fmt.Sprintf("entries=%d", catchUpEntries), func(b *testing.B) {
+		b.SetBytes(catchUpEntries * (codec.FixedSizeFileEntry + payloadSize))
+		for i := 0; i < b.N; i++ {
+			done := make(chan struct{})
+			received := 0
+			stop := startClient(b, fmt.Sprintf("127.0.0.1:%d", port), func(*datastreamer.FileEntry) {
+				received++
+				if received == catchUpEntries {
+					close(done)
+				}
+			})
+			<-done
+			stop()
+		}
+		b.ReportMetric(float64(b.N*catchUpEntries)/b.Elapsed().Seconds(), "entries/s")
+	})
+}
+
+// BenchmarkBroadcast measures the atomic operations committed until received by all the clients connected
+func BenchmarkBroadcast(b *testing.B) {
+	for i, clients := range []int{1, 4, 16} {
+		port := 6932 + i
+		s := startServer(b, uint16(port))
+		received := make(chan struct{}, clients)
+		for c := 0; c < clients; c++ {
+			stop := startClient(b, fmt.Sprintf("127.0.0.1:%d", port), func(e *datastreamer.FileEntry) {
+				if e.Number%opEntries == opEntries-1 {
+					received <- struct{}{}
+				}
+			})
+			b.Cleanup(stop)
+		}
+		data := make([]byte, payloadSize)
+
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			b.SetBytes(int64(opEntries * clients * (codec.FixedSizeFileEntry + payloadSize)))
+			for n := 0; n < b.N; n++ {
+				commitOp(b, s, opEntries, data)
+				for c := 0; c < clients; c++ {
+					<-received
+				}
+			}
+			b.ReportMetric(float64(b.N*opEntries*clients)/b.Elapsed().Seconds(), "entries/s")
+		})
+	}
+}
+
+// newEntry returns a data entry with a payload size
+func newEntry(size int) codec.Entry {
+	return codec.Entry{
+		PacketType: codec.PtData,
+		Length:     codec.FixedSizeFileEntry + uint32(size),
+		Type:       uint32(entryType),
+		Number:     1,
+		Data:       make([]byte, size),
+	}
+}
+
+// startServer starts an ephemeral server, shut down at the end of the benchmark
+func startServer(b *testing.B, port uint16) *datastreamer.StreamServer {
+	b.Helper()
+
+	s, err := datastreamer.NewEphemeralServer(port, 1, 137, streamType, 3*time.Second, 120*time.Second,
+		5*time.Second, &logConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	err = s.Start()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = s.Shutdown(0) })
+	return s
+}
+
+// startClient starts a client streaming from the first entry, returns the function to stop it
+func startClient(b *testing.B, server string, process func(*datastreamer.FileEntry)) func() {
+	b.Helper()
+
+	c, err := datastreamer.NewClient(server, streamType)
+	if err != nil {
+		b.Fatal(err)
+	}
+	c.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		process(e)
+		return nil
+	})
+	err = c.Start()
+	if err == nil {
+		err = c.ExecCommandStart(0)
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = c.Run(ctx)
+	}
+}
+
+// commitOp commits an atomic operation of data entries
+func commitOp(b *testing.B, s *datastreamer.StreamServer, entries int, data []byte) {
+	b.Helper()
+
+	err := s.StartAtomicOp()
+	for i := 0; i < entries && err == nil; i++ {
+		_, err = s.AddStreamEntry(entryType, data)
+	}
+	if err == nil {
+		err = s.CommitAtomicOp()
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+}
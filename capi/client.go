@@ -0,0 +1,152 @@
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+// ds_entry is a data entry received from the stream, its data is freed with ds_entry_free
+typedef struct {
+	uint64_t number;
+	uint32_t type;
+	uint32_t length;
+	uint8_t *data;
+} ds_entry;
+*/
+import "C"
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// Return codes of the exported functions
+const (
+	dsOK      = 0  // dsOK for success
+	dsError   = -1 // dsError for failure, the reason is returned by ds_last_error
+	dsTimeout = 1  // dsTimeout for no entry received before the poll timeout
+)
+
+// ds_log_init sets the log level of the library (debug|info|warn|error), logging to stdout
+//
+//export ds_log_init
+func ds_log_init(level *C.char) {
+	log.Init(log.Config{
+		Environment: "production",
+		Level:       C.GoString(level),
+		Outputs:     []string{"stdout"},
+	})
+}
+
+// ds_client_new creates a client of a server (IP:port) and stream type, returns its handle (0 on error)
+//
+//export ds_client_new
+func ds_client_new(server *C.char, streamType C.uint64_t) C.int64_t {
+	handle, err := newClientHandle(C.GoString(server), datastreamer.StreamType(streamType))
+	if err != nil {
+		return 0
+	}
+	return C.int64_t(handle)
+}
+
+// ds_client_start connects the client to the server
+//
+//export ds_client_start
+func ds_client_start(handle C.int64_t) C.int {
+	return exec(handle, func(h *clientHandle) error {
+		return h.client.Start()
+	})
+}
+
+// ds_client_start_streaming starts the streaming from an entry number, the entries are queued to be polled
+//
+//export ds_client_start_streaming
+func ds_client_start_streaming(handle C.int64_t, fromEntry C.uint64_t) C.int {
+	return exec(handle, func(h *clientHandle) error {
+		return h.client.ExecCommandStart(uint64(fromEntry))
+	})
+}
+
+// ds_client_poll_entry gets the next streamed entry waiting up to the timeout in ms, returns dsTimeout (1) if none.
+// The entry data must be freed with ds_entry_free
+//
+//export ds_client_poll_entry
+func ds_client_poll_entry(handle C.int64_t, timeoutMs C.int, entry *C.ds_entry) C.int {
+	h := getClientHandle(int64(handle))
+	if h == nil || entry == nil {
+		return dsError
+	}
+
+	e, ok := h.pollEntry(time.Duration(timeoutMs) * time.Millisecond)
+	if !ok {
+		return dsTimeout
+	}
+	entry.number = C.uint64_t(e.Number)
+	entry._type = C.uint32_t(e.Type)
+	entry.length = C.uint32_t(len(e.Data))
+	entry.data = (*C.uint8_t)(C.CBytes(e.Data))
+	return dsOK
+}
+
+// ds_entry_free frees the data of an entry returned by ds_client_poll_entry
+//
+//export ds_entry_free
+func ds_entry_free(entry *C.ds_entry) {
+	if entry == nil {
+		return
+	}
+	C.free(unsafe.Pointer(entry.data))
+	entry.data = nil
+	entry.length = 0
+}
+
+// ds_client_stop stops the streaming
+//
+//export ds_client_stop
+func ds_client_stop(handle C.int64_t) C.int {
+	return exec(handle, func(h *clientHandle) error {
+		return h.client.ExecCommandStop()
+	})
+}
+
+// ds_client_free closes the client and releases its handle
+//
+//export ds_client_free
+func ds_client_free(handle C.int64_t) {
+	freeClientHandle(int64(handle))
+}
+
+// ds_last_error returns the latest error of a client (of ds_client_new for the handle 0), NULL if none. The string
+// must be freed with ds_string_free
+//
+//export ds_last_error
+func ds_last_error(handle C.int64_t) *C.char {
+	err := lastError(int64(handle))
+	if err == nil {
+		return nil
+	}
+	return C.CString(err.Error())
+}
+
+// ds_string_free frees a string returned by the library
+//
+//export ds_string_free
+func ds_string_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// exec runs a client function for a handle, recording its error
+func exec(handle C.int64_t, f func(h *clientHandle) error) C.int {
+	h := getClientHandle(int64(handle))
+	if h == nil {
+		return dsError
+	}
+	err := f(h)
+	h.setError(err)
+	if err != nil {
+		return dsError
+	}
+	return dsOK
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const entriesBuffer = 1024 // Entries received from streaming pending to be polled
+
+// errInvalidHandle is returned when the client handle doesn't exist
+var errInvalidHandle = errors.New("invalid client handle")
+
+// clientHandle type for a client created through the C ABI, with the streamed entries queued to be polled
+type clientHandle struct {
+	client  *datastreamer.StreamClient
+	entries chan datastreamer.FileEntry
+	done    chan struct{} // Closed when the handle is released, unblocking the streaming
+
+	mutexErr sync.Mutex
+	lastErr  error
+}
+
+var (
+	handles      = make(map[int64]*clientHandle)
+	nextHandle   int64
+	createErr    error // Latest error creating a client (returned for the handle 0)
+	mutexHandles sync.Mutex
+)
+
+// newClientHandle creates a client queueing the streamed entries and returns its handle
+func newClientHandle(server string, streamType datastreamer.StreamType) (int64, error) {
+	client, err := datastreamer.NewClient(server, streamType)
+	if err != nil {
+		mutexHandles.Lock()
+		createErr = err
+		mutexHandles.Unlock()
+		return 0, err
+	}
+	h := &clientHandle{
+		client:  client,
+		entries: make(chan datastreamer.FileEntry, entriesBuffer),
+		done:    make(chan struct{}),
+	}
+	client.SetProcessEntryFunc(h.queueEntry)
+
+	mutexHandles.Lock()
+	defer mutexHandles.Unlock()
+
+	nextHandle++
+	handles[nextHandle] = h
+	return nextHandle, nil
+}
+
+// getClientHandle returns the client of a handle, nil if it doesn't exist
+func getClientHandle(handle int64) *clientHandle {
+	mutexHandles.Lock()
+	defer mutexHandles.Unlock()
+
+	return handles[handle]
+}
+
+// freeClientHandle removes a client handle, closing its client
+func freeClientHandle(handle int64) {
+	mutexHandles.Lock()
+	h := handles[handle]
+	delete(handles, handle)
+	mutexHandles.Unlock()
+	if h == nil {
+		return
+	}
+
+	// Unblock the streaming waiting to queue an entry before closing the client, which waits for it
+	close(h.done)
+	if err := h.client.Close(); err != nil {
+		log.Warnf("Error closing the client of handle %d: %v", handle, err)
+	}
+}
+
+// lastError returns the latest error of a client handle, or the latest error creating a client for the handle 0
+func lastError(handle int64) error {
+	if handle == 0 {
+		mutexHandles.Lock()
+		defer mutexHandles.Unlock()
+		return createErr
+	}
+	h := getClientHandle(handle)
+	if h == nil {
+		return errInvalidHandle
+	}
+	return h.getError()
+}
+
+// queueEntry queues an entry received from streaming to be polled, blocking the streaming while the queue is full
+// (until the handle is released)
+func (h *clientHandle) queueEntry(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+	s *datastreamer.StreamServer) error {
+	entry := *e
+	entry.Data = append([]byte{}, e.Data...)
+	select {
+	case h.entries <- entry:
+		return nil
+	case <-h.done:
+		return datastreamer.ErrClientStopped
+	}
+}
+
+// pollEntry returns the next entry received from streaming, waiting for it up to the timeout
+func (h *clientHandle) pollEntry(timeout time.Duration) (datastreamer.FileEntry, bool) {
+	select {
+	case e := <-h.entries:
+		return e, true
+	default:
+	}
+	if timeout <= 0 {
+		return datastreamer.FileEntry{}, false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case e := <-h.entries:
+		return e, true
+	case <-timer.C:
+		return datastreamer.FileEntry{}, false
+	}
+}
+
+// setError records the latest error of the client
+func (h *clientHandle) setError(err error) {
+	h.mutexErr.Lock()
+	defer h.mutexErr.Unlock()
+
+	h.lastErr = err
+}
+
+// getError returns the latest error of the client
+func (h *clientHandle) getError() error {
+	h.mutexErr.Lock()
+	defer h.mutexErr.Unlock()
+
+	return h.lastErr
+}
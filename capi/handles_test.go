@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHandles(t *testing.T) {
+	handle, err := newClientHandle("127.0.0.1:6999", 1)
+	require.NoError(t, err)
+	h := getClientHandle(handle)
+	require.NotNil(t, h)
+
+	// Case: No entries -> Timeout
+	_, ok := h.pollEntry(10 * time.Millisecond)
+	assert.False(t, ok)
+
+	// Case: Entry queued -> Polled with its own copy of the data
+	data := []byte{1, 2, 3}
+	require.NoError(t, h.queueEntry(&datastreamer.FileEntry{Number: 5, Type: 2, Data: data}, nil, nil))
+	data[0] = 9
+	e, ok := h.pollEntry(0)
+	require.True(t, ok)
+	assert.Equal(t, uint64(5), e.Number)
+	assert.Equal(t, []byte{1, 2, 3}, e.Data)
+
+	// Case: Queue full, handle released -> Streaming unblocked
+	for i := 0; i < entriesBuffer; i++ {
+		require.NoError(t, h.queueEntry(&datastreamer.FileEntry{Number: uint64(i)}, nil, nil))
+	}
+	blocked := make(chan error, 1)
+	go func() { blocked <- h.queueEntry(&datastreamer.FileEntry{Number: entriesBuffer}, nil, nil) }()
+
+	// Case: Handle released -> Invalid handle
+	freeClientHandle(handle)
+	assert.Nil(t, getClientHandle(handle))
+	assert.ErrorIs(t, lastError(handle), errInvalidHandle)
+	assert.ErrorIs(t, <-blocked, datastreamer.ErrClientStopped)
+
+	// Case: Handle released twice -> Ignored
+	freeClientHandle(handle)
+}
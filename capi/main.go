@@ -0,0 +1,9 @@
+// Package main builds the C shared library (libdsclient) exporting a minimal C ABI of the datastream client, so
+// non-Go consumers can link the canonical protocol implementation:
+//
+//	CGO_ENABLED=1 go build -buildmode=c-shared -o libdsclient.so ./capi
+//
+// The build also generates the C header libdsclient.h with the exported functions.
+package main
+
+func main() {}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/spf13/viper"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	cfgFlag   = "cfg"          // Flag with the configuration file of a command
+	envPrefix = "ZKEVM_STREAM" // Prefix of the environment variables overriding the configuration
+)
+
+// cfgFileFlag is the configuration file flag of the server, client and relay commands
+var cfgFileFlag = &cli.StringFlag{
+	Name:    cfgFlag,
+	Aliases: []string{"c"},
+	Usage:   "configuration file (*.toml|*.yaml) with the command options",
+}
+
+// loadConfig loads the configuration of a command, with its options (flag names) taken in order of preference from
+// the command line flags, the environment variables (ZKEVM_STREAM_<OPTION>), the configuration file and the defaults
+func loadConfig(ctx *cli.Context) (*viper.Viper, error) {
+	cfg := viper.New()
+
+	// Defaults and command line flags
+	options := make(map[string]bool)
+	for _, f := range ctx.Command.Flags {
+		name := f.Names()[0]
+		if name == cfgFlag || name == "help" {
+			continue
+		}
+		options[name] = true
+		cfg.SetDefault(name, ctx.Value(name))
+		if ctx.IsSet(name) {
+			cfg.Set(name, ctx.Value(name))
+		}
+	}
+
+	// Environment variables
+	cfg.SetEnvPrefix(envPrefix)
+	cfg.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	cfg.AutomaticEnv()
+
+	// Configuration file (type from its extension)
+	fileName := ctx.String(cfgFlag)
+	if fileName == "" {
+		return cfg, nil
+	}
+	cfg.SetConfigFile(fileName)
+	err := cfg.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", fileName, err)
+	}
+	for _, key := range cfg.AllKeys() {
+		if !options[key] {
+			log.Warnf("Unknown option %s in config file %s", key, fileName)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestLoadConfig(t *testing.T) {
+	command := &cli.Command{
+		Name: "test",
+		Flags: []cli.Flag{
+			cfgFileFlag,
+			&cli.Uint64Flag{Name: "port", Value: 6900},
+			&cli.StringFlag{Name: "file", Value: "datastream.bin"},
+			&cli.StringFlag{Name: "log", Value: "info"},
+			&cli.BoolFlag{Name: "mux", Value: false},
+		},
+	}
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		for _, f := range command.Flags {
+			require.NoError(t, f.Apply(set))
+		}
+		require.NoError(t, set.Parse(args))
+		ctx := cli.NewContext(cli.NewApp(), set, nil)
+		ctx.Command = command
+		return ctx
+	}
+
+	// Case: No config file -> flag defaults
+	cfg, err := loadConfig(newContext())
+	require.NoError(t, err)
+	require.Equal(t, uint64(6900), cfg.GetUint64("port"))
+	require.Equal(t, "datastream.bin", cfg.GetString("file"))
+
+	// Case: Config file (TOML) -> overrides defaults
+	configFile := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configFile, []byte("Port = 7000\nFile = \"test.bin\"\nMux = true\n"), 0600))
+	cfg, err = loadConfig(newContext("--cfg", configFile))
+	require.NoError(t, err)
+	require.Equal(t, uint64(7000), cfg.GetUint64("port"))
+	require.Equal(t, "test.bin", cfg.GetString("file"))
+	require.True(t, cfg.GetBool("mux"))
+	require.Equal(t, "info", cfg.GetString("log"))
+
+	// Case: Config file (YAML) -> overrides defaults
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("port: 7001\nlog: debug\n"), 0600))
+	cfg, err = loadConfig(newContext("--cfg", configFile))
+	require.NoError(t, err)
+	require.Equal(t, uint64(7001), cfg.GetUint64("port"))
+	require.Equal(t, "debug", cfg.GetString("log"))
+
+	// Case: Environment variable -> overrides config file
+	t.Setenv("ZKEVM_STREAM_PORT", "7002")
+	cfg, err = loadConfig(newContext("--cfg", configFile))
+	require.NoError(t, err)
+	require.Equal(t, uint64(7002), cfg.GetUint64("port"))
+
+	// Case: Command line flag -> overrides environment variable and config file
+	cfg, err = loadConfig(newContext("--cfg", configFile, "--port", "7003"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(7003), cfg.GetUint64("port"))
+
+	// Case: Config file not found -> FAIL
+	_, err = loadConfig(newContext("--cfg", filepath.Join(t.TempDir(), "missing.toml")))
+	require.Error(t, err)
+}
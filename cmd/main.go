@@ -1,20 +1,34 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	zkevm "github.com/0xPolygonHermez/zkevm-data-streamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/conformance"
 	"github.com/0xPolygonHermez/zkevm-data-streamer/datastream"
 	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
 	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/protocol"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
 	"google.golang.org/protobuf/proto"
 )
@@ -33,9 +47,17 @@ const (
 	streamerSystemID = 137
 	streamerVersion  = 1
 
+	defaultLogBuffer    = 1000 // Recent log entries kept by default when served over HTTP
+	defaultStatsSamples = 360  // Samples of the statistics time series kept by default
+
+	backfillThreshold = 100000 // Entries behind the tip from which the client backfills in parallel
+
 	noneType        = "none"
 	streamServerURL = "127.0.0.1:6900"
 	logLevelInfo    = "log level (debug|info|warn|error)"
+	outputInfo      = "format of the results (text|json), in json one JSON value per line with the logs to stderr"
+
+	bundleServerTimeout = 10 * time.Second
 )
 
 var (
@@ -65,6 +87,108 @@ var (
 	dumpTotalTx     uint64 = 0
 )
 
+// Reconnection flags of the connection to the server of the client and relay commands
+var (
+	reconnectBackoffFlag = &cli.Uint64Flag{
+		Name:        "reconnectbackoff",
+		Usage:       "wait after a failed connection attempt to the server in ms, doubled on each failure in a row",
+		Value:       5000, //nolint:mnd
+		DefaultText: "5000",
+	}
+	reconnectMaxFlag = &cli.Uint64Flag{
+		Name:        "reconnectmax",
+		Usage:       "maximum wait between the connection attempts to the server in ms",
+		Value:       5000, //nolint:mnd
+		DefaultText: "5000",
+	}
+	reconnectJitterFlag = &cli.Uint64Flag{
+		Name:        "reconnectjitter",
+		Usage:       "random jitter of the wait between the connection attempts to the server in percent",
+		Value:       0,
+		DefaultText: "0",
+	}
+	reconnectRetriesFlag = &cli.Uint64Flag{
+		Name:        "reconnectretries",
+		Usage:       "retries of the failed connection attempts in a row before giving up (0=no limit)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	reconnectFailoverFlag = &cli.Uint64Flag{
+		Name:        "reconnectfailover",
+		Usage:       "failed connection attempts in a row to a server before failing over to the next one of --server",
+		Value:       1,
+		DefaultText: "1",
+	}
+	heartbeatFlag = &cli.Uint64Flag{
+		Name:        "heartbeat",
+		Usage:       "idle time of the connection to the server to send a ping in ms, also the TCP keepalive (0=disabled)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	heartbeatTimeoutFlag = &cli.Uint64Flag{
+		Name:        "heartbeattimeout",
+		Usage:       "time without receiving a packet from the server to reconnect in ms (0=3 heartbeats)",
+		Value:       0,
+		DefaultText: "0",
+	}
+)
+
+// Storage flags of the bookmarks DB of the server and relay commands
+var (
+	bookmarkDBCompressionFlag = &cli.StringFlag{
+		Name:        "bookmarkdbcompression",
+		Usage:       "compression of the bookmarks DB tables (snappy|none)",
+		Value:       "",
+		DefaultText: datastreamer.DBCompressionSnappy,
+	}
+	bookmarkDBTableSizeFlag = &cli.Uint64Flag{
+		Name:        "bookmarkdbtablesize",
+		Usage:       "size of the bookmarks DB tables written by the compactions in MiB, 10x per level (0=2 MiB)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	bookmarkDBWriteBufferFlag = &cli.Uint64Flag{
+		Name:        "bookmarkdbwritebuffer",
+		Usage:       "size of the bookmarks DB memtable before writing it to a table in MiB (0=4 MiB)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	bookmarkDBBloomBitsFlag = &cli.Uint64Flag{
+		Name:        "bookmarkdbbloombits",
+		Usage:       "bits per key of the bloom filter of the bookmarks DB tables (0=none)",
+		Value:       0,
+		DefaultText: "0",
+	}
+)
+
+// Service level objectives flags of the server and relay commands
+var (
+	sloIntervalFlag = &cli.Uint64Flag{
+		Name:        "slointerval",
+		Usage:       "evaluation window of the service level objectives in seconds (0=10s)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	sloMaxLagFlag = &cli.Uint64Flag{
+		Name:        "slomaxlag",
+		Usage:       "SLO of the maximum entries a streaming client is behind the entries committed (0=disabled)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	sloMaxCommitLatencyFlag = &cli.Uint64Flag{
+		Name:        "slomaxcommitlatency",
+		Usage:       "SLO of the maximum latency of the commits in ms (0=disabled)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	sloMinThroughputFlag = &cli.Float64Flag{
+		Name:        "slominthroughput",
+		Usage:       "SLO of the minimum entries committed per second (0=disabled)",
+		Value:       0,
+		DefaultText: "0",
+	}
+)
+
 // main runs a datastream server or client
 func main() {
 	// Set log level
@@ -76,6 +200,7 @@ func main() {
 
 	app := cli.NewApp()
 	app.Usage = "Run a datastream server/client/relay demo cli app"
+	app.DisableSliceFlagSeparator = true // The repeated flags have comma separated lists (e.g. split --stream)
 
 	app.Commands = []*cli.Command{
 		{
@@ -83,6 +208,7 @@ func main() {
 			Aliases: []string{},
 			Usage:   "Run datastream server",
 			Flags: []cli.Flag{
+				cfgFileFlag,
 				&cli.Uint64Flag{
 					Name:        "port",
 					Usage:       "exposed port for clients to connect",
@@ -101,6 +227,9 @@ func main() {
 					Value:       "info",
 					DefaultText: "info",
 				},
+				hexFlag,
+				bookmarkLenFlag,
+				payloadLenFlag,
 				&cli.Uint64Flag{
 					Name:        "sleep",
 					Usage:       "initial sleep and sleep between atomic operations in ms",
@@ -125,6 +254,162 @@ func main() {
 					Value:       120, //nolint:mnd
 					DefaultText: "120",
 				},
+				&cli.Uint64Flag{
+					Name:        "draintimeout",
+					Usage:       "on SIGTERM, time to let the clients catch-ups finish before closing them in seconds",
+					Value:       10, //nolint:mnd
+					DefaultText: "10",
+				},
+				&cli.StringFlag{
+					Name:  "readiness-file",
+					Usage: "file written once the server is ready to accept connections (removed on shutdown)",
+					Value: "",
+				},
+				&cli.BoolFlag{
+					Name:  "lazyopen",
+					Usage: "serve reads while the stream file is validated in background, writes allowed once validated",
+					Value: false,
+				},
+				&cli.StringFlag{
+					Name:  "payloadkeyfile",
+					Usage: "file with the key (hex) to encrypt the entries payload end-to-end (AES-GCM)",
+					Value: "",
+				},
+				&cli.BoolFlag{
+					Name:  "dedup",
+					Usage: "store the entries payload content-addressed, identical payloads stored only once",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "ephemeral",
+					Usage: "store the stream in a temporary directory (memory-backed if available) deleted on exit",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "headerchanges",
+					Usage: "record the header changes (commits and truncations) in a meta-stream queryable by the clients",
+					Value: false,
+				},
+				&cli.IntFlag{
+					Name:  "livequeue",
+					Usage: "size of the per-client queues of the live entries, catch-ups served from the file (0 disabled)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "maxsession",
+					Usage: "maximum duration of the client connections before asking them to reconnect in seconds (0 no limit)",
+					Value: 0,
+				},
+				&cli.StringFlag{
+					Name:  "authtokensfile",
+					Usage: "file with the tokens accepted to authenticate the clients, one per line (no authentication)",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:  "baseentry",
+					Usage: "number of the first entry of a new stream, to continue the numbering of a migrated chain",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "checkpoints",
+					Usage: "number of entries of each checkpoint Merkle root, for the entries inclusion proofs (0 disabled)",
+					Value: 0,
+				},
+				&cli.BoolFlag{
+					Name:  "groups",
+					Usage: "manage consumer groups, balancing the entries and storing the committed offsets (<file>.grp)",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "positions",
+					Usage: "store the processed positions committed by the clients by key (<file>.pos)",
+					Value: false,
+				},
+				&cli.Uint64Flag{
+					Name:  "summaryport",
+					Usage: "port to serve a summary stream derived with the --summarytypes entries only (0 disabled)",
+					Value: 0,
+				},
+				&cli.StringFlag{
+					Name:  "summarytypes",
+					Usage: "entry types of the summary stream, comma separated (e.g. 1,2,176 for batches, blocks and bookmarks)",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "latesttypes",
+					Usage: "bookmark types of the latest view, comma separated (e.g. 1,2 for the latest batch and block)",
+					Value: "",
+				},
+				&cli.IntFlag{
+					Name:  "aomaxentries",
+					Usage: "maximum entries of an atomic operation (0 no limit)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "aomaxbytes",
+					Usage: "maximum data bytes of the entries of an atomic operation (0 no limit)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "aomaxduration",
+					Usage: "maximum duration of an atomic operation in ms (0 no limit)",
+					Value: 0,
+				},
+				&cli.BoolFlag{
+					Name:  "aosplit",
+					Usage: "split the atomic operations exceeding a limit into several linked commits instead of failing",
+					Value: false,
+				},
+				&cli.Uint64Flag{
+					Name:  "writecoalescing",
+					Usage: "time window to group the writes of the entries to the stream file in ms (e.g. 0-10, 0 disabled)",
+					Value: 0,
+				},
+				&cli.BoolFlag{
+					Name:  "directio",
+					Usage: "write the stream file with direct I/O (O_DIRECT) bypassing the page cache, buffered if not supported",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "verifywrites",
+					Usage: "read back and verify every write to the stream file, slower (QA environments)",
+					Value: false,
+				},
+				bookmarkDBCompressionFlag,
+				bookmarkDBTableSizeFlag,
+				bookmarkDBWriteBufferFlag,
+				bookmarkDBBloomBitsFlag,
+				sloIntervalFlag,
+				sloMaxLagFlag,
+				sloMaxCommitLatencyFlag,
+				sloMinThroughputFlag,
+				&cli.Uint64Flag{
+					Name:        "memory",
+					Usage:       "memory in MB to size the internal buffers (channels, queues and databases caches)",
+					Value:       0,
+					DefaultText: "detected from the cgroup limits",
+				},
+				&cli.Uint64Flag{
+					Name:        "logbuffer",
+					Usage:       "number of recent log entries kept for the Stats command and the logs HTTP endpoint",
+					Value:       0,
+					DefaultText: "0, 1000 with --logshttp",
+				},
+				&cli.StringFlag{
+					Name:  "logshttp",
+					Usage: "address to serve the recent log entries and the stats over HTTP (e.g. :8080, at /logs?level=warn, /stats)",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:  "statsseries",
+					Usage: "interval in seconds of the samples of the stats time series (e.g. 10, 0 disabled)",
+					Value: 0,
+				},
+				&cli.IntFlag{
+					Name:  "statssamples",
+					Usage: "number of samples of the stats time series kept (e.g. 360 for the last hour every 10s)",
+					Value: defaultStatsSamples,
+				},
 			},
 			Action: runServer,
 		},
@@ -133,15 +418,16 @@ func main() {
 			Aliases: []string{},
 			Usage:   "Run datastream client",
 			Flags: []cli.Flag{
+				cfgFileFlag,
 				&cli.StringFlag{
 					Name:        "server",
-					Usage:       "datastream server address to connect (IP:port)",
+					Usage:       "datastream server addresses to connect, comma separated to fail over in order (IP:port)",
 					Value:       streamServerURL,
 					DefaultText: streamServerURL,
 				},
 				&cli.StringFlag{
 					Name:        "from",
-					Usage:       "entry number to start the sync/streaming from (latest|0..N)",
+					Usage:       "entry number to start the sync/streaming from (latest|latestbookmark|0..N)",
 					Value:       "latest",
 					DefaultText: "latest",
 				},
@@ -150,11 +436,31 @@ func main() {
 					Usage: "bookmark to start the sync/streaming from (0..N) (has preference over --from parameter)",
 					Value: noneType,
 				},
+				&cli.StringFlag{
+					Name:  "watchbookmark",
+					Usage: "bookmark to watch from the --from entry, notified once committed instead of streaming (0..N)",
+					Value: noneType,
+				},
+				&cli.StringFlag{
+					Name:  "group",
+					Usage: "consumer group to join from the --from entry (or its committed offset), committing the entries",
+					Value: "",
+				},
 				&cli.BoolFlag{
 					Name:  "header",
 					Usage: "query file header information",
 					Value: false,
 				},
+				&cli.BoolFlag{
+					Name:  "schemas",
+					Usage: "query the payload schemas (entry types and versions) served by the server",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "stats",
+					Usage: "query the server state (totals, clients and recent logs if enabled)",
+					Value: false,
+				},
 				&cli.StringFlag{
 					Name:  "entry",
 					Usage: "entry number to query data (0..N)",
@@ -165,6 +471,47 @@ func main() {
 					Usage: "entry bookmark to query entry data pointed by it (0..N)",
 					Value: noneType,
 				},
+				&cli.StringFlag{
+					Name:  "headerchanges",
+					Usage: "header change number to query the header changes recorded by the server from it (0..N)",
+					Value: noneType,
+				},
+				&cli.StringFlag{
+					Name:  "checkpointproof",
+					Usage: "entry number to query and verify its checkpoint inclusion proof (0..N)",
+					Value: noneType,
+				},
+				&cli.StringFlag{
+					Name:  "getposition",
+					Usage: "key to query the processed position stored by the server",
+					Value: "",
+				},
+				&cli.BoolFlag{
+					Name:  "latest",
+					Usage: "query the latest bookmark of each bookmark type of the server latest view",
+					Value: false,
+				},
+				&cli.StringFlag{
+					Name:  "entryrange",
+					Usage: "entry number to query a range of --count entries from in one round trip (0..N)",
+					Value: noneType,
+				},
+				&cli.Uint64Flag{
+					Name:  "count",
+					Usage: "number of entries to query with the --entryrange option",
+					Value: 100, //nolint:mnd
+				},
+				&cli.StringFlag{
+					Name:  "fromtime",
+					Usage: "start time (RFC3339, e.g. 2024-05-01T14:02:00Z) to stream the entries committed in a time window",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:        "totime",
+					Usage:       "end time (RFC3339) of the time window, excluded",
+					Value:       "",
+					DefaultText: "now",
+				},
 				&cli.IntFlag{
 					Name:  "bookmarktype",
 					Usage: "bookmark type used for --bookmark and --frombookmark options (0..255)",
@@ -180,12 +527,176 @@ func main() {
 					Usage: "batch number to dump data (0..N)",
 					Value: noneType,
 				},
+				&cli.BoolFlag{
+					Name:  "mux",
+					Usage: "multiplex commands and streaming over the connection",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "tls",
+					Usage: "connect to the server over TLS (e.g. behind a TLS terminating proxy)",
+					Value: false,
+				},
+				&cli.StringFlag{
+					Name:        "tlsca",
+					Usage:       "PEM file of the root CAs to verify the server certificate over TLS",
+					DefaultText: "system roots",
+				},
+				&cli.StringFlag{
+					Name:        "tlsservername",
+					Usage:       "server name to send (SNI) and verify in the server certificate over TLS",
+					DefaultText: "server address host",
+				},
+				&cli.StringFlag{
+					Name:  "proxy",
+					Usage: "proxy of the connections to the server: socks5://[user:password@]host:port or http://...",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "credentialsfile",
+					Usage: "file with the token sent to authenticate to the server",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "statsfile",
+					Usage: "file to periodically dump the client statistics (JSON) for support bundles",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:        "statsinterval",
+					Usage:       "interval to dump the client statistics file in ms",
+					Value:       10000, //nolint:mnd
+					DefaultText: "10000",
+				},
+				&cli.StringFlag{
+					Name:  "metricshttp",
+					Usage: "address to serve the client metrics in the Prometheus text format over HTTP (e.g. :9091, at /metrics)",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "payloadkeyfile",
+					Usage: "file with the key (hex) to decrypt the entries payload encrypted end-to-end by the server",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "filter",
+					Usage: "filter expression of the entries processed (e.g. \"type in (1, 2) and number >= 1000\")",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "entrytypes",
+					Usage: "comma separated entry types streamed, negotiated with the server (e.g. 2 for the L2 blocks)",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "compression",
+					Usage: "compression of the streaming requested to the server: none, snappy",
+					Value: "none",
+				},
+				&cli.StringFlag{
+					Name:  "checksum",
+					Usage: "checksum of the streamed entries requested to the server, verified by the client: none, crc32",
+					Value: "none",
+				},
+				&cli.IntFlag{
+					Name:  "backfill",
+					Usage: "connections fetching in parallel the entries of a start far behind the tip (0 disabled)",
+					Value: 0,
+				},
+				&cli.IntFlag{
+					Name:  "prefetch",
+					Usage: "number of streaming entries to prefetch while processing the current one (0 disabled)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:        "prefetchmem",
+					Usage:       "maximum data of the prefetched entries in MB",
+					Value:       64, //nolint:mnd
+					DefaultText: "64",
+				},
+				&cli.Uint64Flag{
+					Name:  "spillmax",
+					Usage: "maximum size in MB of the disk queue of the entries received while the consumer is slow (0 disabled)",
+					Value: 0,
+				},
+				&cli.StringFlag{
+					Name:        "spilldir",
+					Usage:       "directory of the disk queue of the entries received while the consumer is slow",
+					Value:       "",
+					DefaultText: "temporary directory",
+				},
+				&cli.Float64Flag{
+					Name:  "ratelimit",
+					Usage: "maximum streaming entries consumed per second, pausing the reads (0 disabled)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "ratelimitbytes",
+					Usage: "maximum bytes of the streaming entries consumed per second, pausing the reads (0 disabled)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "slowlatency",
+					Usage: "average latency of the entries processing in ms to alert a slow consumer (0 disabled)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "slowfull",
+					Usage: "time the received entries queue stays full in ms to alert a slow consumer (0 disabled)",
+					Value: 0,
+				},
+				&cli.Uint64Flag{
+					Name:  "laginterval",
+					Usage: "interval in ms to log the streaming lag behind the server (0 disabled)",
+					Value: 0,
+				},
+				&cli.StringFlag{
+					Name:  "checkpointfile",
+					Usage: "file to save the processed position, resuming the streaming from it (instead of --from)",
+				},
+				&cli.StringFlag{
+					Name:  "deadletter",
+					Usage: "file to quarantine the entries failed to process after the retries (JSON lines), skipping them",
+				},
+				&cli.Uint64Flag{
+					Name:        "retries",
+					Usage:       "retries of an entry failed to process before quarantining it to the dead-letter file",
+					Value:       3, //nolint:mnd
+					DefaultText: "3",
+				},
+				&cli.StringFlag{
+					Name:  "trustedserver",
+					Usage: "trusted server address (e.g. the master of an untrusted relay) to verify the entries checkpoint proofs",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:        "memory",
+					Usage:       "memory in MB to size the internal buffers (channels, queues and databases caches)",
+					Value:       0,
+					DefaultText: "detected from the cgroup limits",
+				},
 				&cli.StringFlag{
 					Name:        "log",
 					Usage:       logLevelInfo,
 					Value:       "info",
 					DefaultText: "info",
 				},
+				hexFlag,
+				bookmarkLenFlag,
+				payloadLenFlag,
+				reconnectBackoffFlag,
+				reconnectMaxFlag,
+				reconnectJitterFlag,
+				reconnectRetriesFlag,
+				reconnectFailoverFlag,
+				heartbeatFlag,
+				heartbeatTimeoutFlag,
+				&cli.StringFlag{
+					Name:        "output",
+					Usage:       outputInfo,
+					Value:       outputText,
+					DefaultText: outputText,
+				},
 			},
 			Action: runClient,
 		},
@@ -194,9 +705,10 @@ func main() {
 			Aliases: []string{},
 			Usage:   "Run datastream relay",
 			Flags: []cli.Flag{
+				cfgFileFlag,
 				&cli.StringFlag{
 					Name:        "server",
-					Usage:       "datastream server address to connect (IP:port)",
+					Usage:       "datastream server addresses to connect, comma separated to fail over in order (IP:port)",
 					Value:       streamServerURL,
 					DefaultText: streamServerURL,
 				},
@@ -218,6 +730,16 @@ func main() {
 					Value:       "info",
 					DefaultText: "info",
 				},
+				hexFlag,
+				bookmarkLenFlag,
+				payloadLenFlag,
+				reconnectBackoffFlag,
+				reconnectMaxFlag,
+				reconnectJitterFlag,
+				reconnectRetriesFlag,
+				reconnectFailoverFlag,
+				heartbeatFlag,
+				heartbeatTimeoutFlag,
 				&cli.Uint64Flag{
 					Name:        "writetimeout",
 					Usage:       "timeout for write operations on client connections in ms (0=no timeout)",
@@ -230,72 +752,542 @@ func main() {
 					Value:       120, //nolint:mnd
 					DefaultText: "120",
 				},
-			},
-			Action: runRelay,
-		},
-	}
-
-	err := app.Run(os.Args)
-	if err != nil {
-		log.Fatal(err)
-		os.Exit(1)
-	}
-}
-
-// runServer runs a local datastream server and tests its features
-func runServer(ctx *cli.Context) error {
-	// Set log level
-	logLevel := ctx.String("log")
-	log.Init(log.Config{
-		Environment: "development",
-		Level:       logLevel,
-		Outputs:     []string{"stdout"},
-	})
-
-	log.Info(">> App begin")
-
-	// Parameters
-	file := ctx.String("file")
-	port := ctx.Uint64("port")
-	sleep := ctx.Uint64("sleep")
-	numOpersLoop := ctx.Uint64("opers")
-	writeTimeout := ctx.Uint64("writetimeout")
-	inactivityTimeout := ctx.Uint64("inactivitytimeout")
-
-	if file == "" || port <= 0 {
-		return errors.New("bad/missing parameters")
-	}
-
-	// Create stream server
-	s, err := datastreamer.NewServer(uint16(port), streamerVersion, streamerSystemID, StSequencer, file,
-		time.Duration(writeTimeout)*time.Millisecond, time.Duration(inactivityTimeout)*time.Second,
-		5*time.Second, nil) //nolint:mnd
-	if err != nil {
-		return err
-	}
-
-	// Start stream server
-	err = s.Start()
-	if err != nil {
-		log.Error(">> App error! Start")
-		return err
-	}
-
-	// Pause for testing purpose
-	time.Sleep(time.Duration(sleep) * time.Millisecond)
-
-	end := make(chan uint8)
-
-	go func(chan uint8) {
-		var (
+				&cli.Uint64Flag{
+					Name:        "draintimeout",
+					Usage:       "on SIGTERM, time to let the clients catch-ups finish before closing them in seconds",
+					Value:       10, //nolint:mnd
+					DefaultText: "10",
+				},
+				&cli.StringFlag{
+					Name:  "readiness-file",
+					Usage: "file written once the server is ready to accept connections (removed on shutdown)",
+					Value: "",
+				},
+				&cli.BoolFlag{
+					Name:  "lazyopen",
+					Usage: "serve reads while the stream file is validated in background, writes allowed once validated",
+					Value: false,
+				},
+				&cli.Uint64Flag{
+					Name:        "releasedelay",
+					Usage:       "time to hold the entries received before forwarding them to the relay clients in seconds",
+					Value:       0,
+					DefaultText: "0",
+				},
+				&cli.BoolFlag{
+					Name:  "manualrelease",
+					Usage: "hold the entries received until released with a SIGUSR1 signal",
+					Value: false,
+				},
+				&cli.StringFlag{
+					Name:  "standbylease",
+					Usage: "lease file shared by an active/standby pair of relays, the relay serves only while holding it",
+				},
+				&cli.StringFlag{
+					Name:        "standbyid",
+					Usage:       "holder name of the relay in the lease of the active/standby pair",
+					DefaultText: "<hostname>:<port>",
+				},
+				&cli.Uint64Flag{
+					Name:        "leasettl",
+					Usage:       "duration of the lease of the active/standby pair in seconds (renewed every third of it)",
+					Value:       10, //nolint:mnd
+					DefaultText: "10",
+				},
+				&cli.BoolFlag{
+					Name:  "dedup",
+					Usage: "store the entries payload content-addressed, identical payloads stored only once",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "ephemeral",
+					Usage: "store the stream in a temporary directory (memory-backed if available) deleted on exit",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "headerchanges",
+					Usage: "record the header changes (commits and truncations) in a meta-stream queryable by the clients",
+					Value: false,
+				},
+				&cli.IntFlag{
+					Name:        "livequeue",
+					Usage:       "size of the per-client queues of the live entries, catch-ups served from the file (0 disabled)",
+					Value:       4096, //nolint:mnd
+					DefaultText: "4096",
+				},
+				&cli.StringFlag{
+					Name:  "filter",
+					Usage: "filter expression of the entries forwarded to the relay clients (e.g. \"type in (1, 2)\")",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "redact",
+					Usage: "payload redaction rules of the entries forwarded to the relay clients (e.g. \"2:zero,3:truncate=8\")",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:  "maxsession",
+					Usage: "maximum duration of the client connections before asking them to reconnect in seconds (0 no limit)",
+					Value: 0,
+				},
+				&cli.StringFlag{
+					Name:  "authtokensfile",
+					Usage: "file with the tokens accepted to authenticate the clients, one per line (no authentication)",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "credentialsfile",
+					Usage: "file with the token sent to authenticate to the server",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:  "checkpoints",
+					Usage: "number of entries of each checkpoint Merkle root, for the entries inclusion proofs (0 disabled)",
+					Value: 0,
+				},
+				&cli.BoolFlag{
+					Name:  "groups",
+					Usage: "manage consumer groups, balancing the entries and storing the committed offsets (<file>.grp)",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "positions",
+					Usage: "store the processed positions committed by the clients by key (<file>.pos)",
+					Value: false,
+				},
+				&cli.Uint64Flag{
+					Name:  "summaryport",
+					Usage: "port to serve a summary stream derived with the --summarytypes entries only (0 disabled)",
+					Value: 0,
+				},
+				&cli.StringFlag{
+					Name:  "summarytypes",
+					Usage: "entry types of the summary stream, comma separated (e.g. 1,2,176 for batches, blocks and bookmarks)",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "latesttypes",
+					Usage: "bookmark types of the latest view, comma separated (e.g. 1,2 for the latest batch and block)",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:  "writecoalescing",
+					Usage: "time window to group the writes of the entries to the stream file in ms (e.g. 0-10, 0 disabled)",
+					Value: 0,
+				},
+				&cli.BoolFlag{
+					Name:  "directio",
+					Usage: "write the stream file with direct I/O (O_DIRECT) bypassing the page cache, buffered if not supported",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "verifywrites",
+					Usage: "read back and verify every write to the stream file, slower (QA environments)",
+					Value: false,
+				},
+				bookmarkDBCompressionFlag,
+				bookmarkDBTableSizeFlag,
+				bookmarkDBWriteBufferFlag,
+				bookmarkDBBloomBitsFlag,
+				sloIntervalFlag,
+				sloMaxLagFlag,
+				sloMaxCommitLatencyFlag,
+				sloMinThroughputFlag,
+				&cli.Uint64Flag{
+					Name:        "memory",
+					Usage:       "memory in MB to size the internal buffers (channels, queues and databases caches)",
+					Value:       0,
+					DefaultText: "detected from the cgroup limits",
+				},
+				&cli.Uint64Flag{
+					Name:        "logbuffer",
+					Usage:       "number of recent log entries kept for the Stats command and the logs HTTP endpoint",
+					Value:       0,
+					DefaultText: "0, 1000 with --logshttp",
+				},
+				&cli.StringFlag{
+					Name:  "logshttp",
+					Usage: "address to serve the recent log entries and the stats over HTTP (e.g. :8080, at /logs?level=warn, /stats)",
+					Value: "",
+				},
+				&cli.Uint64Flag{
+					Name:  "statsseries",
+					Usage: "interval in seconds of the samples of the stats time series (e.g. 10, 0 disabled)",
+					Value: 0,
+				},
+				&cli.IntFlag{
+					Name:  "statssamples",
+					Usage: "number of samples of the stats time series kept (e.g. 360 for the last hour every 10s)",
+					Value: defaultStatsSamples,
+				},
+			},
+			Action: runRelay,
+		},
+		{
+			Name:    "conformance",
+			Aliases: []string{},
+			Usage:   "Run the protocol conformance tests against a datastream server",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "server",
+					Usage:       "datastream server address to test (IP:port)",
+					Value:       streamServerURL,
+					DefaultText: streamServerURL,
+				},
+				&cli.Uint64Flag{
+					Name:        "timeout",
+					Usage:       "timeout for connections and reads in ms",
+					Value:       5000, //nolint:mnd
+					DefaultText: "5000",
+				},
+				&cli.StringFlag{
+					Name:        "log",
+					Usage:       logLevelInfo,
+					Value:       "error",
+					DefaultText: "error",
+				},
+				&cli.StringFlag{
+					Name:        "output",
+					Usage:       outputInfo,
+					Value:       outputText,
+					DefaultText: outputText,
+				},
+			},
+			Action: runConformance,
+		},
+		{
+			Name:    "spec",
+			Aliases: []string{},
+			Usage:   "Print the protocol specification (frame sizes, limits, versions and enumerations)",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "format",
+					Usage:       "format of the specification: json, yaml (same fields) or markdown (reference tables)",
+					Value:       protocol.FormatJSON,
+					DefaultText: protocol.FormatJSON,
+				},
+			},
+			Action: runSpec,
+		},
+		{
+			Name:    "split",
+			Aliases: []string{},
+			Usage:   "Split a datastream file into a stream file for each group of entry types, with their bookmarks",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "file",
+					Usage:    "datastream file name (*.bin) to split, not opened by a server",
+					Required: true,
+				},
+				&cli.StringSliceFlag{
+					Name:     "stream",
+					Usage:    "output stream file and its comma separated entry types (e.g. blocks.bin=2), can be repeated",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "signkey",
+					Usage: "operator key file (ed25519 seed in hex) to sign the manifest of each output stream",
+				},
+				&cli.StringFlag{
+					Name:        "log",
+					Usage:       logLevelInfo,
+					Value:       "info",
+					DefaultText: "info",
+				},
+				&cli.StringFlag{
+					Name:        "output",
+					Usage:       outputInfo,
+					Value:       outputText,
+					DefaultText: outputText,
+				},
+			},
+			Action: runSplit,
+		},
+		{
+			Name:    "merge",
+			Aliases: []string{},
+			Usage:   "Merge datastream files into a single stream file, renumbering the entries and their bookmarks",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "file",
+					Usage:    "merged datastream file name (*.bin), new or empty",
+					Required: true,
+				},
+				&cli.StringSliceFlag{
+					Name:     "input",
+					Usage:    "input datastream file name (*.bin) not opened by a server, can be repeated",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:        "order",
+					Usage:       "order of the merge: timestamp (of the L2 blocks), input (concatenated)",
+					Value:       "timestamp",
+					DefaultText: "timestamp",
+				},
+				&cli.StringFlag{
+					Name:  "signkey",
+					Usage: "operator key file (ed25519 seed in hex) to sign the manifest of the merged stream",
+				},
+				&cli.StringFlag{
+					Name:        "log",
+					Usage:       logLevelInfo,
+					Value:       "info",
+					DefaultText: "info",
+				},
+				&cli.StringFlag{
+					Name:        "output",
+					Usage:       outputInfo,
+					Value:       outputText,
+					DefaultText: outputText,
+				},
+			},
+			Action: runMerge,
+		},
+		{
+			Name:    "bundle",
+			Aliases: []string{},
+			Usage:   "Collect datastream server and client state into a support bundle for bug reports",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "server",
+					Usage:       "datastream server address to collect its state (IP:port)",
+					Value:       streamServerURL,
+					DefaultText: streamServerURL,
+				},
+				&cli.StringSliceFlag{
+					Name:  "statsfile",
+					Usage: "client statistics file to include (can be repeated)",
+				},
+				&cli.StringFlag{
+					Name:  "output",
+					Usage: "support bundle file name (*.zip) (default: support-bundle-<time>.zip)",
+					Value: "",
+				},
+				&cli.StringFlag{
+					Name:  "signkey",
+					Usage: "operator key file (ed25519 seed in hex) to sign the manifest of the bundle files",
+				},
+			},
+			Action: runBundle,
+		},
+		{
+			Name:      "sign",
+			Aliases:   []string{},
+			Usage:     "Write a signed manifest of the files of a backup or export (e.g. a stream file and its databases)",
+			ArgsUsage: "<file or directory>...",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "key",
+					Usage:    "operator key file (ed25519 seed in hex) to sign the manifest",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "manifest",
+					Usage: "manifest file name, the files must be in its directory",
+					Value: datastreamer.ManifestFileName,
+				},
+			},
+			Action: runSign,
+		},
+		{
+			Name:      "verify",
+			Aliases:   []string{},
+			Usage:     "Verify a signed manifest and its files (or a signed support bundle) before an import or restore",
+			ArgsUsage: "<manifest or bundle file>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "keys",
+					Usage:    "file of the trusted operator public keys (hex, one per line)",
+					Required: true,
+				},
+			},
+			Action: runVerify,
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+}
+
+// runServer runs a local datastream server and tests its features
+func runServer(ctx *cli.Context) error {
+	// Load config
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set log level
+	logLevel := cfg.GetString("log")
+	log.Init(log.Config{
+		Environment: "development",
+		Level:       logLevel,
+		Outputs:     []string{"stdout"},
+	})
+
+	log.Info(">> App begin")
+
+	// Parameters
+	file := cfg.GetString("file")
+	port := cfg.GetUint64("port")
+	sleep := cfg.GetUint64("sleep")
+	numOpersLoop := cfg.GetUint64("opers")
+	writeTimeout := cfg.GetUint64("writetimeout")
+	inactivityTimeout := cfg.GetUint64("inactivitytimeout")
+	drainTimeout := time.Duration(cfg.GetUint64("draintimeout")) * time.Second
+	readinessFile := cfg.GetString("readiness-file")
+	lazyOpen := cfg.GetBool("lazyopen")
+	payloadKeyFile := cfg.GetString("payloadkeyfile")
+	dedup := cfg.GetBool("dedup")
+	ephemeral := cfg.GetBool("ephemeral")
+	headerChanges := cfg.GetBool("headerchanges")
+	baseEntry := cfg.GetUint64("baseentry")
+	checkpoints := cfg.GetUint64("checkpoints")
+	logsMux := startLogs(cfg.GetUint64("logbuffer"), cfg.GetString("logshttp"))
+	setFormatOptions(cfg)
+	setBufferMemory(cfg.GetUint64("memory"))
+
+	if file == "" || port <= 0 {
+		return errors.New("bad/missing parameters")
+	}
+
+	// Create stream server
+	var s *datastreamer.StreamServer
+	if ephemeral {
+		s, err = datastreamer.NewEphemeralServer(uint16(port), streamerVersion, streamerSystemID, StSequencer,
+			time.Duration(writeTimeout)*time.Millisecond, time.Duration(inactivityTimeout)*time.Second,
+			5*time.Second, nil) //nolint:mnd
+	} else {
+		s, err = datastreamer.NewServer(uint16(port), streamerVersion, streamerSystemID, StSequencer, file,
+			time.Duration(writeTimeout)*time.Millisecond, time.Duration(inactivityTimeout)*time.Second,
+			5*time.Second, nil) //nolint:mnd
+	}
+	if err != nil {
+		return err
+	}
+	s.SetReadinessFile(readinessFile)
+	s.SetBackgroundValidation(lazyOpen)
+	s.SetLiveQueues(cfg.GetInt("livequeue"))
+	s.SetMaxSessionDuration(time.Duration(cfg.GetUint64("maxsession")) * time.Second)
+	auth, err := loadAuthenticator(cfg.GetString("authtokensfile"))
+	if err != nil {
+		return err
+	}
+	s.SetAuthenticator(auth)
+	if baseEntry != 0 {
+		err = s.SetBaseEntry(baseEntry)
+		if err != nil {
+			return err
+		}
+	}
+	err = s.SetContentAddressing(dedup)
+	if err != nil {
+		return err
+	}
+	err = s.SetHeaderChanges(headerChanges)
+	if err != nil {
+		return err
+	}
+	err = s.SetCheckpoints(checkpoints)
+	if err != nil {
+		return err
+	}
+	err = s.SetConsumerGroups(cfg.GetBool("groups"))
+	if err != nil {
+		return err
+	}
+	err = s.SetClientPositions(cfg.GetBool("positions"))
+	if err != nil {
+		return err
+	}
+	summaryPort, summaryTypes, err := parseSummaryStream(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = s.SetSummaryStream(summaryPort, summaryTypes)
+	if err != nil {
+		return err
+	}
+	latestPrefixes, err := parseLatestView(cfg)
+	if err != nil {
+		return err
+	}
+	err = s.SetLatestView(latestPrefixes)
+	if err != nil {
+		return err
+	}
+	err = setBookmarkDBOptions(cfg, s.SetBookmarkDBOptions)
+	if err != nil {
+		return err
+	}
+	s.SetAtomicOpLimits(datastreamer.AtomicOpLimits{
+		MaxEntries:  cfg.GetInt("aomaxentries"),
+		MaxBytes:    cfg.GetUint64("aomaxbytes"),
+		MaxDuration: time.Duration(cfg.GetUint64("aomaxduration")) * time.Millisecond,
+		AutoSplit:   cfg.GetBool("aosplit"),
+	})
+	s.SetWriteCoalescing(time.Duration(cfg.GetUint64("writecoalescing")) * time.Millisecond)
+	s.SetStatsSeries(time.Duration(cfg.GetUint64("statsseries"))*time.Second, cfg.GetInt("statssamples"))
+	s.SetSLO(newSLOConfig(cfg))
+	if logsMux != nil {
+		logsMux.Handle("/stats", s.StatsHandler())
+	}
+	s.SetDirectIO(cfg.GetBool("directio"))
+	s.SetWriteVerification(cfg.GetBool("verifywrites"))
+	if payloadKeyFile != "" {
+		key, err := datastreamer.LoadPayloadKey(payloadKeyFile)
+		if err != nil {
+			return err
+		}
+		encrypt, err := datastreamer.NewEncryptMiddleware(key)
+		if err != nil {
+			return err
+		}
+		s.UseSendMiddleware(encrypt)
+	}
+
+	// Start stream server
+	err = s.Start()
+	if err != nil {
+		log.Error(">> App error! Start")
+		return err
+	}
+
+	// Pause for testing purpose
+	time.Sleep(time.Duration(sleep) * time.Millisecond)
+
+	end := make(chan uint8)
+	stop := make(chan struct{})
+
+	go func(chan uint8) {
+		var (
 			testRollback   bool
 			latestRollback uint64
 		)
 
+		// Wait for the stream file validation before writing
+		err := s.WaitValidation()
+		if err != nil {
+			log.Errorf(">> App error! WaitValidation: %v", err)
+			end <- 0
+			return
+		}
+
 		init := s.GetHeader().TotalEntries / 5 //nolint:mnd
 
 		// Atomic Operations loop
 		for n := uint64(0); n < numOpersLoop; n++ {
+			// Check shutdown requested
+			select {
+			case <-stop:
+				end <- 0
+				return
+			default:
+			}
+
 			// Start atomic operation
 			err = s.StartAtomicOp()
 			if err != nil {
@@ -383,14 +1375,228 @@ func runServer(ctx *cli.Context) error {
 		end <- 0
 	}(end)
 
-	// Wait for loop to end
-	<-end
+	// Wait for loop to end, or for a shutdown signal
+	interruptSignal := make(chan os.Signal, 1)
+	signal.Notify(interruptSignal, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-end:
+		// Delete the ephemeral stream
+		if ephemeral {
+			err = s.Shutdown(drainTimeout)
+			if err != nil {
+				log.Errorf(">> App error! Shutdown: %v", err)
+			}
+		}
+	case <-interruptSignal:
+		// Let the current atomic operation finish (if the loop didn't exit on error), then drain the clients
+		close(stop)
+		select {
+		case <-end:
+		case <-time.After(drainTimeout):
+		}
+		err = s.Shutdown(drainTimeout)
+		if err != nil {
+			log.Errorf(">> App error! Shutdown: %v", err)
+		}
+	}
 
 	log.Info(">> App end")
 
 	return nil
 }
 
+// startLogs keeps the recent log entries in the ring buffer and serves them over HTTP (if the address is set),
+// returning the HTTP handlers mux to add the statistics (nil if not served)
+func startLogs(buffer uint64, addr string) *http.ServeMux {
+	if buffer == 0 && addr != "" {
+		buffer = defaultLogBuffer
+	}
+	log.SetRingBuffer(int(buffer))
+	if addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/logs", log.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second} //nolint:mnd
+	go func() {
+		log.Infof("Serving recent logs on %s/logs", addr)
+		err := server.ListenAndServe()
+		if err != nil {
+			log.Errorf("Error serving recent logs on %s: %v", addr, err)
+		}
+	}()
+	return mux
+}
+
+// serveMetrics serves the client metrics over HTTP at /metrics
+func serveMetrics(addr string, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second} //nolint:mnd
+	go func() {
+		log.Infof("Serving client metrics on %s/metrics", addr)
+		err := server.ListenAndServe()
+		if err != nil {
+			log.Errorf("Error serving client metrics on %s: %v", addr, err)
+		}
+	}()
+}
+
+// setBookmarkDBOptions sets the storage options of the bookmarks DB of a server from the options (if any)
+func setBookmarkDBOptions(cfg *viper.Viper, set func(datastreamer.BookmarkDBOptions) error) error {
+	options := datastreamer.BookmarkDBOptions{
+		Compression:         cfg.GetString(bookmarkDBCompressionFlag.Name),
+		WriteBuffer:         cfg.GetInt(bookmarkDBWriteBufferFlag.Name) * 1024 * 1024, //nolint:mnd
+		CompactionTableSize: cfg.GetInt(bookmarkDBTableSizeFlag.Name) * 1024 * 1024,   //nolint:mnd
+		BloomFilterBits:     cfg.GetInt(bookmarkDBBloomBitsFlag.Name),
+	}
+	if options == (datastreamer.BookmarkDBOptions{}) {
+		return nil
+	}
+	return set(options)
+}
+
+// newReconnectPolicy returns the policy of the connection attempts to the server from the options
+func newReconnectPolicy(cfg *viper.Viper) datastreamer.ReconnectPolicy {
+	return datastreamer.ReconnectPolicy{
+		Backoff:    time.Duration(cfg.GetUint64(reconnectBackoffFlag.Name)) * time.Millisecond,
+		MaxBackoff: time.Duration(cfg.GetUint64(reconnectMaxFlag.Name)) * time.Millisecond,
+		Jitter:     float64(cfg.GetUint64(reconnectJitterFlag.Name)) / 100, //nolint:mnd
+		MaxRetries: cfg.GetInt(reconnectRetriesFlag.Name),
+
+		FailoverAfter: cfg.GetInt(reconnectFailoverFlag.Name),
+	}
+}
+
+// newSLOConfig returns the service level objectives from the options
+func newSLOConfig(cfg *viper.Viper) datastreamer.SLOConfig {
+	return datastreamer.SLOConfig{
+		Interval:         time.Duration(cfg.GetUint64(sloIntervalFlag.Name)) * time.Second,
+		MaxClientLag:     cfg.GetUint64(sloMaxLagFlag.Name),
+		MaxCommitLatency: time.Duration(cfg.GetUint64(sloMaxCommitLatencyFlag.Name)) * time.Millisecond,
+		MinThroughput:    cfg.GetFloat64(sloMinThroughputFlag.Name),
+	}
+}
+
+// heartbeatInterval returns the heartbeat interval and timeout of the connection to the server from the options
+func heartbeatInterval(cfg *viper.Viper) (time.Duration, time.Duration) {
+	return time.Duration(cfg.GetUint64(heartbeatFlag.Name)) * time.Millisecond,
+		time.Duration(cfg.GetUint64(heartbeatTimeoutFlag.Name)) * time.Millisecond
+}
+
+// parseSummaryStream returns the port and the entry types of the summary stream from the options (no entry types if
+// disabled)
+func parseSummaryStream(cfg *viper.Viper) (uint16, []datastreamer.EntryType, error) {
+	port := cfg.GetUint64("summaryport")
+	if port == 0 {
+		return 0, nil, nil
+	}
+	if port > math.MaxUint16 {
+		return 0, nil, errors.New("bad summaryport parameter, must be between 0 and 65535")
+	}
+
+	entryTypes, err := parseEntryTypes(cfg, "summarytypes")
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(entryTypes) == 0 {
+		return 0, nil, errors.New("missing summarytypes parameter for the summary stream")
+	}
+	return uint16(port), entryTypes, nil
+}
+
+// parseLatestView returns the bookmark prefixes of the latest view from the bookmark types option (none if
+// disabled), the prefix of the bookmarks of each type encoded
+func parseLatestView(cfg *viper.Viper) ([][]byte, error) {
+	var prefixes [][]byte
+	for _, field := range strings.Split(cfg.GetString("latesttypes"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		bookmarkType, err := strconv.ParseUint(field, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad latesttypes parameter %q: %w", field, err)
+		}
+		prefix, err := proto.Marshal(&datastream.BookMark{Type: datastream.BookmarkType(bookmarkType)})
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// startFromLatestBookmark starts the streaming from the latest bookmark of a bookmark type
+func startFromLatestBookmark(c *datastreamer.StreamClient, bookType datastream.BookmarkType) error {
+	prefix, err := proto.Marshal(&datastream.BookMark{Type: bookType})
+	if err != nil {
+		return err
+	}
+	fromEntry, err := c.StartFromLatestBookmark(prefix)
+	if err != nil {
+		return err
+	}
+	log.Infof("Streaming from the latest bookmark type %d at Entry[%s]", bookType,
+		datastreamer.FormatEntryNumber(fromEntry))
+	return nil
+}
+
+// parseEntryTypes returns the entry types of a comma separated list option
+func parseEntryTypes(cfg *viper.Viper, name string) ([]datastreamer.EntryType, error) {
+	return parseEntryTypeList(cfg.GetString(name), name)
+}
+
+// parseEntryTypeList returns the entry types of a comma separated list of a parameter
+func parseEntryTypeList(list string, name string) ([]datastreamer.EntryType, error) {
+	var entryTypes []datastreamer.EntryType
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		entryType, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s parameter %q: %w", name, field, err)
+		}
+		entryTypes = append(entryTypes, datastreamer.EntryType(entryType))
+	}
+	return entryTypes, nil
+}
+
+// loadAuthenticator returns the authenticator of the clients accepting the tokens of a file (nil if no file)
+func loadAuthenticator(fileName string) (datastreamer.Authenticator, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+	tokens, err := datastreamer.LoadAuthTokens(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return datastreamer.NewTokenAuthenticator(tokens...), nil
+}
+
+// loadCredentials returns the credentials to authenticate to the server, the first token of a file (nil if no file)
+func loadCredentials(fileName string) ([]byte, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+	tokens, err := datastreamer.LoadAuthTokens(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return tokens[0], nil
+}
+
+// setBufferMemory sets the memory in MB to size the internal buffers (detected if 0) and logs their sizes
+func setBufferMemory(memory uint64) {
+	datastreamer.SetBufferMemory(memory << 20) //nolint:mnd
+	sizes := datastreamer.GetBufferSizes()
+	log.Infof("Buffer sizes: StreamBuffer[%d] ClientEntries[%d] RelayLiveQueue[%d] DBCache[%d]",
+		sizes.StreamBuffer, sizes.ClientEntries, sizes.RelayLiveQueue, sizes.DBCache)
+}
+
 func fakeBookmark(bookType datastream.BookmarkType, value uint64) []byte {
 	bookmark := datastream.BookMark{Type: bookType}
 	b, err := proto.Marshal(&bookmark)
@@ -484,39 +1690,173 @@ func fakeDataBatchEnd(BatchNum uint64) []byte {
 
 // runClient runs a local datastream client and tests its features
 func runClient(ctx *cli.Context) error {
-	// Set log level
-	logLevel := ctx.String("log")
+	// Load config
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set log level and output format
+	logLevel := cfg.GetString("log")
+	logOutputs, err := setOutput(cfg.GetString("output"))
+	if err != nil {
+		return err
+	}
 	log.Init(log.Config{
 		Environment: "development",
 		Level:       logLevel,
-		Outputs:     []string{"stdout"},
+		Outputs:     logOutputs,
 	})
 
 	// Parameters
-	server := ctx.String("server")
+	server := cfg.GetString("server")
 	if server == "" {
 		return errors.New("bad/missing parameters")
 	}
-	from := ctx.String("from")
-	fromBookmark := ctx.String("frombookmark")
-	queryHeader := ctx.Bool("header")
-	queryEntry := ctx.String("entry")
-	queryBookmark := ctx.String("bookmark")
-	sanityCheck := ctx.Bool("sanitycheck")
-	bookmarkType := ctx.Int("bookmarktype")
+	from := cfg.GetString("from")
+	fromBookmark := cfg.GetString("frombookmark")
+	watchBookmark := cfg.GetString("watchbookmark")
+	group := cfg.GetString("group")
+	queryHeader := cfg.GetBool("header")
+	queryStats := cfg.GetBool("stats")
+	querySchemas := cfg.GetBool("schemas")
+	queryEntry := cfg.GetString("entry")
+	queryBookmark := cfg.GetString("bookmark")
+	queryHeaderChanges := cfg.GetString("headerchanges")
+	queryCheckpointProof := cfg.GetString("checkpointproof")
+	queryPosition := cfg.GetString("getposition")
+	queryLatest := cfg.GetBool("latest")
+	queryEntryRange := cfg.GetString("entryrange")
+	queryCount := cfg.GetUint64("count")
+	queryFromTime := cfg.GetString("fromtime")
+	queryToTime := cfg.GetString("totime")
+	sanityCheck := cfg.GetBool("sanitycheck")
+	bookmarkType := cfg.GetInt("bookmarktype")
 	if bookmarkType < 0 || bookmarkType > 255 {
 		return errors.New("bad bookmarktype parameter, must be between 0 and 255")
 	}
 	bookType := datastream.BookmarkType(bookmarkType)
-	paramDumpBatch := ctx.String("dumpbatch")
+	paramDumpBatch := cfg.GetString("dumpbatch")
+	multiplexed := cfg.GetBool("mux")
+	useTLS := cfg.GetBool("tls")
+	tlsCAFile := cfg.GetString("tlsca")
+	tlsServerName := cfg.GetString("tlsservername")
+	proxyURL := cfg.GetString("proxy")
+	statsFile := cfg.GetString("statsfile")
+	statsInterval := cfg.GetUint64("statsinterval")
+	metricsAddr := cfg.GetString("metricshttp")
+	payloadKeyFile := cfg.GetString("payloadkeyfile")
+	filterExpr := cfg.GetString("filter")
+	entryTypes, err := parseEntryTypes(cfg, "entrytypes")
+	if err != nil {
+		return err
+	}
+	compression, err := datastreamer.ParseCompression(cfg.GetString("compression"))
+	if err != nil {
+		return err
+	}
+	checksum, err := datastreamer.ParseChecksum(cfg.GetString("checksum"))
+	if err != nil {
+		return err
+	}
+	backfill := cfg.GetInt("backfill")
+	prefetch := cfg.GetInt("prefetch")
+	prefetchMem := cfg.GetUint64("prefetchmem")
+	spillMax := cfg.GetUint64("spillmax")
+	spillDir := cfg.GetString("spilldir")
+	rateLimit := cfg.GetFloat64("ratelimit")
+	rateLimitBytes := cfg.GetUint64("ratelimitbytes")
+	slowLatency := cfg.GetUint64("slowlatency")
+	lagInterval := cfg.GetUint64("laginterval")
+	checkpointFile := cfg.GetString("checkpointfile")
+	slowFull := cfg.GetUint64("slowfull")
+	trustedServer := cfg.GetString("trustedserver")
+	deadLetterFile := cfg.GetString("deadletter")
+	setFormatOptions(cfg)
+	setBufferMemory(cfg.GetUint64("memory"))
 
 	// Create client
 	c, err := datastreamer.NewClient(server, StSequencer)
 	if err != nil {
 		return err
 	}
+	if useTLS {
+		tlsConfig, err := datastreamer.NewTLSConfig(tlsServerName, tlsCAFile)
+		if err != nil {
+			return err
+		}
+		c.SetTLS(tlsConfig)
+	}
+	if proxyURL != "" {
+		dial, err := datastreamer.NewProxyDialer(proxyURL, nil)
+		if err != nil {
+			return err
+		}
+		c.SetDialer(dial)
+	}
+	c.SetMultiplexed(multiplexed)
+	c.SetReconnectPolicy(newReconnectPolicy(cfg))
+	c.SetHeartbeat(heartbeatInterval(cfg))
+	credentials, err := loadCredentials(cfg.GetString("credentialsfile"))
+	if err != nil {
+		return err
+	}
+	c.SetCredentials(credentials)
+	if statsFile != "" {
+		c.SetStatsFile(statsFile, time.Duration(statsInterval)*time.Millisecond)
+	}
+	if metricsAddr != "" {
+		serveMetrics(metricsAddr, c.MetricsHandler())
+	}
+	if payloadKeyFile != "" {
+		key, err := datastreamer.LoadPayloadKey(payloadKeyFile)
+		if err != nil {
+			return err
+		}
+		decrypt, err := datastreamer.NewDecryptMiddleware(key)
+		if err != nil {
+			return err
+		}
+		c.UseReceiveMiddleware(decrypt)
+	}
+	if filterExpr != "" {
+		filter, err := datastreamer.NewFilterMiddleware(filterExpr)
+		if err != nil {
+			return err
+		}
+		c.UseReceiveMiddleware(filter)
+	}
+	c.SetEntryTypes(entryTypes, true)
+	c.SetCompression(compression)
+	c.SetChecksum(checksum)
+	c.SetBackfill(backfill, backfillThreshold)
+	c.SetPrefetch(prefetch, prefetchMem*1024*1024) //nolint:mnd
+	c.SetSpillover(spillDir, spillMax*1024*1024)   //nolint:mnd
+	c.SetRateLimit(rateLimit, rateLimitBytes)
+	c.SetSlowConsumerAlert(time.Duration(slowLatency)*time.Millisecond, time.Duration(slowFull)*time.Millisecond, nil)
+	c.SetLagMonitor(time.Duration(lagInterval)*time.Millisecond, func(info datastreamer.LagInfo) {
+		log.Infof("LAG: %d entries (next entry %d, total entries %d)", info.Lag, info.NextEntry, info.TotalEntries)
+	})
+	if checkpointFile != "" {
+		c.SetCheckpointStore(datastreamer.NewFileCheckpointStore(checkpointFile), 0)
+	}
+	if deadLetterFile != "" {
+		c.SetDeadLetter(cfg.GetInt("retries"), 0, datastreamer.NewDeadLetterFile(deadLetterFile))
+	}
+	if trustedServer != "" {
+		trusted, err := datastreamer.NewClient(trustedServer, StSequencer)
+		if err != nil {
+			return err
+		}
+		err = trusted.Start()
+		if err != nil {
+			return err
+		}
+		c.SetRequireProofs(datastreamer.NewTrustedRoots(trusted))
+	}
 
 	// Set process entry callback function
+	processEntry := checkEntryBlockSanity
 	if !sanityCheck {
 		if paramDumpBatch != noneType {
 			if from == "latest" {
@@ -526,30 +1866,203 @@ func runClient(ctx *cli.Context) error {
 			if err != nil {
 				return err
 			}
-			dumpBatchNumber = uint64(nDumpBatch)
-
-			c.SetProcessEntryFunc(doDumpBatchData)
+			dumpBatchNumber = uint64(nDumpBatch)
+
+			processEntry = doDumpBatchData
+		} else {
+			processEntry = printEntryNum
+		}
+	}
+	c.SetProcessEntryFunc(processEntry)
+
+	// Start client (connect to the server)
+	err = c.Start()
+	if err != nil {
+		return err
+	}
+
+	// Query file header information
+	if queryHeader {
+		header, err := c.ExecCommandGetHeader()
+		if err != nil {
+			return queryError(err)
+		}
+		if jsonOutput {
+			return printJSON(newHeaderOutput(header))
+		}
+		log.Infof("QUERY HEADER: TotalEntries[%s] TotalLength[%d] Version[%d] SystemID[%d] BaseEntry[%s]",
+			datastreamer.FormatEntryNumber(header.TotalEntries), header.TotalLength, header.Version, header.SystemID,
+			datastreamer.FormatEntryNumber(header.BaseEntry))
+		return nil
+	}
+
+	// Query server state option
+	if queryStats {
+		stats, err := c.ExecCommandGetStats()
+		if err != nil {
+			return queryError(err)
+		}
+		if jsonOutput {
+			return printJSON(stats)
+		}
+		log.Infof("QUERY STATS: Version[%s] TotalEntries[%s] TotalLength[%d] AtomicOp[%t] Clients[%d]",
+			stats.Version, datastreamer.FormatEntryNumber(stats.TotalEntries), stats.TotalLength, stats.AtomicOp,
+			len(stats.Clients))
+		for _, client := range stats.Clients {
+			log.Infof("QUERY STATS CLIENT %s: Status[%s] LastActivity[%v] Subscriptions[%d] MuxStream[%t]",
+				client.ID, client.Status, client.LastActivity, client.Subscriptions, client.MuxStream)
+		}
+		return nil
+	}
+
+	// Query payload schemas option
+	if querySchemas {
+		schemas, err := c.ExecCommandGetSchemas()
+		if err != nil {
+			return queryError(err)
+		}
+		if jsonOutput {
+			return printJSON(schemas)
+		}
+		for _, schema := range schemas {
+			log.Infof("QUERY SCHEMA: EntryType[%d] Version[%d]", schema.Type, schema.Version)
+		}
+		return nil
+	}
+
+	// Query header changes option
+	if queryHeaderChanges != noneType {
+		fromChange, err := strconv.Atoi(queryHeaderChanges)
+		if err != nil {
+			return err
+		}
+		changes, err := c.ExecCommandGetHeaderChanges(uint64(fromChange))
+		if err != nil {
+			return queryError(err)
+		}
+		if jsonOutput {
+			return printJSON(changes)
+		}
+		for _, change := range changes {
+			log.Infof("QUERY HEADER CHANGE %d: Kind[%s] Time[%v] TotalEntries[%s->%s] TotalLength[%d->%d]",
+				change.Number, change.Kind, change.Time, datastreamer.FormatEntryNumber(change.PrevTotalEntries),
+				datastreamer.FormatEntryNumber(change.TotalEntries), change.PrevTotalLength, change.TotalLength)
+		}
+		return nil
+	}
+
+	// Query position option
+	if queryPosition != "" {
+		position, err := c.ExecCommandGetPosition(queryPosition)
+		if err != nil {
+			return queryError(err)
+		}
+		if jsonOutput {
+			return printJSON(position)
+		}
+		log.Infof("QUERY POSITION %s: Entry[%s] Time[%v]", position.Key, datastreamer.FormatEntryNumber(position.Entry),
+			position.Time)
+		return nil
+	}
+
+	// Query latest view option
+	if queryLatest {
+		states, err := c.ExecCommandGetLatestStates(nil)
+		if err != nil {
+			return queryError(err)
+		}
+		for _, state := range states {
+			bookmark := datastream.BookMark{}
+			err = proto.Unmarshal(state.Bookmark, &bookmark)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				err = printJSON(latestOutput{
+					BookmarkType: uint8(bookmark.Type),
+					Value:        bookmark.Value,
+					Bookmark:     state.Bookmark,
+					Entry:        state.Entry,
+					Hash:         state.Hash,
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			log.Infof("QUERY LATEST (%d)%d: Entry[%s] Hash[%x]", bookmark.Type, bookmark.Value,
+				datastreamer.FormatEntryNumber(state.Entry), state.Hash)
+		}
+		return nil
+	}
+
+	// Query entry range option
+	if queryEntryRange != noneType {
+		qEntry, err := strconv.Atoi(queryEntryRange)
+		if err != nil {
+			return err
+		}
+		err = queryEntries(c, uint64(qEntry), queryCount)
+		if err != nil {
+			return queryError(err)
+		}
+		return nil
+	}
+
+	// Query checkpoint proof option
+	if queryCheckpointProof != noneType {
+		qEntry, err := strconv.Atoi(queryCheckpointProof)
+		if err != nil {
+			return err
+		}
+		proof, err := c.ExecCommandGetCheckpointProof(uint64(qEntry))
+		if err != nil {
+			return queryError(err)
+		}
+		entry, err := c.ExecCommandGetEntry(uint64(qEntry))
+		if err != nil {
+			return queryError(err)
+		}
+		if jsonOutput {
+			return printJSON(newProofOutput(uint64(qEntry), proof, proof.Verify(entry)))
+		}
+		log.Infof("QUERY CHECKPOINT PROOF %d: Checkpoint[%d] Entries[%s..%s] Root[%x] Path[%d] Verified[%t]",
+			qEntry, proof.Checkpoint, datastreamer.FormatEntryNumber(proof.FromEntry),
+			datastreamer.FormatEntryNumber(proof.FromEntry+proof.Entries-1), proof.Root, len(proof.Path),
+			proof.Verify(entry))
+		return nil
+	}
+
+	// Query entries by time option
+	if queryFromTime != "" {
+		fromTime, err := time.Parse(time.RFC3339, queryFromTime)
+		if err != nil {
+			return err
+		}
+		toTime := time.Now()
+		if queryToTime != "" {
+			toTime, err = time.Parse(time.RFC3339, queryToTime)
+			if err != nil {
+				return err
+			}
+		}
+		window, err := c.ExecCommandGetEntriesByTime(fromTime, toTime)
+		if err != nil {
+			return queryError(err)
+		}
+		if jsonOutput {
+			err = printJSON(window)
+			if err != nil {
+				return err
+			}
 		} else {
-			c.SetProcessEntryFunc(printEntryNum)
+			log.Infof("QUERY ENTRIES BY TIME %v..%v: Entries[%s..%s) Commits[%d]",
+				fromTime, toTime, datastreamer.FormatEntryNumber(window.FromEntry),
+				datastreamer.FormatEntryNumber(window.ToEntry), window.Commits)
 		}
-	} else {
-		c.SetProcessEntryFunc(checkEntryBlockSanity)
-	}
-
-	// Start client (connect to the server)
-	err = c.Start()
-	if err != nil {
-		return err
-	}
-
-	// Query file header information
-	if queryHeader {
-		header, err := c.ExecCommandGetHeader()
+		err = c.StreamEntriesByTime(fromTime, toTime, printEntryNum)
 		if err != nil {
-			log.Infof("Error: %v", err)
-		} else {
-			log.Infof("QUERY HEADER: TotalEntries[%d] TotalLength[%d] Version[%d] SystemID[%d]",
-				header.TotalEntries, header.TotalLength, header.Version, header.SystemID)
+			return queryError(err)
 		}
 		return nil
 	}
@@ -562,11 +2075,14 @@ func runClient(ctx *cli.Context) error {
 		}
 		entry, err := c.ExecCommandGetEntry(uint64(qEntry))
 		if err != nil {
-			log.Infof("Error: %v", err)
-		} else {
-			log.Infof("QUERY ENTRY %d: Entry[%d] Length[%d] Type[%d] Data[%v]",
-				qEntry, entry.Number, entry.Length, entry.Type, entry.Data)
+			return queryError(err)
 		}
+		if jsonOutput {
+			return printJSON(newEntryOutput(entry))
+		}
+		log.Infof("QUERY ENTRY %d: Entry[%s] Length[%d] Type[%d] Data[%s]",
+			qEntry, datastreamer.FormatEntryNumber(entry.Number), entry.Length, entry.Type,
+			datastreamer.FormatPayload(entry.Data))
 		return nil
 	}
 
@@ -586,11 +2102,19 @@ func runClient(ctx *cli.Context) error {
 		}
 		entry, err := c.ExecCommandGetBookmark(qBook)
 		if err != nil {
-			log.Infof("Error: %v", err)
-		} else {
-			log.Infof("QUERY BOOKMARK (%d)%v: Entry[%d] Length[%d] Type[%d] Data[%v]",
-				bookType, qBook, entry.Number, entry.Length, entry.Type, entry.Data)
+			return queryError(err)
 		}
+		if jsonOutput {
+			return printJSON(bookmarkOutput{
+				BookmarkType: uint8(bookType),
+				Value:        uint64(qBookmark),
+				Bookmark:     qBook,
+				Entry:        newEntryOutput(entry),
+			})
+		}
+		log.Infof("QUERY BOOKMARK (%d)%s: Entry[%s] Length[%d] Type[%d] Data[%s]",
+			bookType, datastreamer.FormatBookmark(qBook), datastreamer.FormatEntryNumber(entry.Number), entry.Length,
+			entry.Type, datastreamer.FormatPayload(entry.Data))
 		return nil
 	}
 
@@ -600,7 +2124,46 @@ func runClient(ctx *cli.Context) error {
 		return err
 	}
 
-	if fromBookmark != noneType {
+	if watchBookmark != noneType {
+		// Watch the bookmark from entry number, without streaming the entries
+		watchBookNum, err := strconv.Atoi(watchBookmark)
+		if err != nil {
+			return err
+		}
+		fromEntry := header.TotalEntries
+		if from != "latest" {
+			fromNum, err := strconv.Atoi(from)
+			if err != nil {
+				return err
+			}
+			fromEntry = uint64(fromNum)
+		}
+		bookmark := datastream.BookMark{
+			Type:  bookType,
+			Value: uint64(watchBookNum),
+		}
+		qBook, err := proto.Marshal(&bookmark)
+		if err != nil {
+			return err
+		}
+		_, err = c.WatchBookmarks(fromEntry, qBook, func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			if jsonOutput {
+				return printJSON(bookmarkOutput{
+					BookmarkType: uint8(bookType),
+					Value:        uint64(watchBookNum),
+					Bookmark:     qBook,
+					Entry:        newEntryOutput(*e),
+				})
+			}
+			log.Infof("WATCH BOOKMARK (%d)%d: committed at Entry[%s]", bookType, watchBookNum,
+				datastreamer.FormatEntryNumber(e.Number))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else if fromBookmark != noneType {
 		// Command StartBookmark: Sync and start streaming receive from bookmark
 		fromBookNum, err := strconv.Atoi(fromBookmark)
 		if err != nil {
@@ -623,27 +2186,37 @@ func runClient(ctx *cli.Context) error {
 		var fromEntry uint64
 		if from == "latest" {
 			fromEntry = header.TotalEntries
-		} else {
+		} else if from != "latestbookmark" {
 			fromNum, err := strconv.Atoi(from)
 			if err != nil {
 				return err
 			}
 			fromEntry = uint64(fromNum)
 		}
-		err = c.ExecCommandStart(fromEntry)
+		if group != "" {
+			err = subscribeGroup(c, group, fromEntry, processEntry)
+		} else if checkpointFile != "" {
+			err = c.StartFromCheckpoint()
+		} else if from == "latestbookmark" {
+			// Latest bookmark of the bookmark type, from the genesis if none
+			err = startFromLatestBookmark(c, bookType)
+		} else {
+			err = c.ExecCommandStart(fromEntry)
+		}
 		if err != nil {
 			return err
 		}
 	}
 
-	// After the initial sync, run until Ctl+C
-	interruptSignal := make(chan os.Signal, 1)
-	signal.Notify(interruptSignal, os.Interrupt, syscall.SIGTERM)
-	<-interruptSignal
-
-	// Command stop: Stop streaming
-	err = c.ExecCommandStop()
-	if err != nil {
+	// After the initial sync, run until Ctl+C or a fatal error processing the entries
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = c.Run(runCtx)
+	if checkpointFile != "" {
+		// Save the latest processed position once the goroutines exit
+		_ = c.Close()
+	}
+	if !errors.Is(err, context.Canceled) {
 		return err
 	}
 
@@ -651,9 +2224,66 @@ func runClient(ctx *cli.Context) error {
 	return nil
 }
 
-// printEntryNum prints basic data of the entry
+// subscribeGroup joins the client to a consumer group from entry, committing each entry once processed
+func subscribeGroup(c *datastreamer.StreamClient, group string, fromEntry uint64,
+	f datastreamer.ProcessEntryFunc) error {
+	// The entries processed before the subscription is returned are committed by the next ones
+	var member atomic.Pointer[datastreamer.Subscription]
+	sub, err := c.SubscribeGroup(group, fromEntry, func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		err := f(e, c, s)
+		if err != nil {
+			return err
+		}
+		if m := member.Load(); m != nil {
+			return m.Commit(e.Number + 1)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	member.Store(sub)
+	log.Infof("Joined consumer group %s", group)
+	return nil
+}
+
+// printEntryNum prints basic data of the entry (the entry with its data in JSON format)
 func printEntryNum(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
-	log.Infof("PROCESS entry(%s): %d | %d | %d | %d", c.ID, e.Number, e.Length, e.Type, len(e.Data))
+	if jsonOutput {
+		return printJSON(newEntryOutput(*e))
+	}
+	log.Infof("PROCESS entry(%s): %s | %d | %d | %d%s", c.ID, datastreamer.FormatEntryNumber(e.Number), e.Length, e.Type,
+		len(e.Data), datastreamer.PayloadPreview(e.Data))
+	return nil
+}
+
+// queryEntries queries a range of entries with the entry range command, getting the next ranges from the entry
+// number after the last one read until all the entries are got or the end of the stream is reached
+func queryEntries(c *datastreamer.StreamClient, fromEntry uint64, count uint64) error {
+	next, end := fromEntry, fromEntry+count
+	for next < end {
+		entries, nextEntry, err := c.ExecCommandGetEntryRange(next, uint32(min(end-next, math.MaxUint32)))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if jsonOutput {
+				err = printJSON(newEntryOutput(entry))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			log.Infof("QUERY ENTRY RANGE %d: Entry[%s] Length[%d] Type[%d] Data[%s]", fromEntry,
+				datastreamer.FormatEntryNumber(entry.Number), entry.Length, entry.Type,
+				datastreamer.FormatPayload(entry.Data))
+		}
+		if nextEntry == next {
+			break
+		}
+		next = nextEntry
+	}
 	return nil
 }
 
@@ -956,133 +2586,664 @@ func checkEntryBlockSanity(
 	return nil
 }
 
-// doDumpBatchData performs a batch data dump
-func doDumpBatchData(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
-	type BatchDump struct {
-		Number     uint64 `json:"batchNumber"`
-		EntryFirst uint64 `json:"entryFirst"`
-		EntryLast  uint64 `json:"entryLast"`
-		BlockFirst uint64 `json:"l2BlockFirst"`
-		BlockLast  uint64 `json:"l2BlockLast"`
-		TotalTx    uint64 `json:"totalTx"`
-		Data       string `json:"batchData"`
+// doDumpBatchData performs a batch data dump
+func doDumpBatchData(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
+	type BatchDump struct {
+		Number     uint64 `json:"batchNumber"`
+		EntryFirst uint64 `json:"entryFirst"`
+		EntryLast  uint64 `json:"entryLast"`
+		BlockFirst uint64 `json:"l2BlockFirst"`
+		BlockLast  uint64 `json:"l2BlockLast"`
+		TotalTx    uint64 `json:"totalTx"`
+		Data       string `json:"batchData"`
+	}
+
+	if e.Type != datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_L2_BLOCK) &&
+		e.Type != datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_TRANSACTION) &&
+		e.Type != datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_L2_BLOCK_END) {
+		return nil
+	}
+
+	// L2 block start
+	if e.Type == datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_L2_BLOCK) {
+		l2Block := &datastream.L2Block{}
+		err := proto.Unmarshal(e.Data, l2Block)
+		if err != nil {
+			log.Error("error decoding l2 block. Error: ", err)
+			return err
+		}
+		batchNumber := l2Block.BatchNumber
+		switch {
+		case batchNumber < dumpBatchNumber:
+			return nil
+		case (batchNumber > dumpBatchNumber) || (e.Number+1 >= c.GetTotalEntries()):
+			log.Infof("DUMP BATCH finished! First entry[%d], last entry[%d], first block[%d], last block[%d], total tx[%d]",
+				dumpEntryFirst, dumpEntryLast, dumpBlockFirst, dumpBlockLast, dumpTotalTx)
+
+			// Dump to json file
+			fileName := fmt.Sprintf("dumpbatch%d.json", dumpBatchNumber)
+			file, err := os.Create(fileName)
+			if err != nil {
+				return errors.New("creating dump file")
+			}
+			defer file.Close()
+
+			bd := BatchDump{
+				Number:     dumpBatchNumber,
+				EntryFirst: dumpEntryFirst,
+				EntryLast:  dumpEntryLast,
+				BlockFirst: dumpBlockFirst,
+				BlockLast:  dumpBlockLast,
+				TotalTx:    dumpTotalTx,
+				Data:       dumpBatchData,
+			}
+
+			encoder := json.NewEncoder(file)
+			err = encoder.Encode(bd)
+			if err != nil {
+				return errors.New("writing dump file")
+			}
+
+			os.Exit(0)
+
+		case batchNumber == dumpBatchNumber:
+			initDumpBatch = true
+
+			blockNum := l2Block.Number
+			if dumpBlockFirst == 0 {
+				dumpBlockFirst = blockNum
+			}
+			dumpBlockLast = blockNum
+		}
+	} else if e.Type == datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_TRANSACTION) && initDumpBatch {
+		dumpTotalTx++
+	}
+
+	// Add data
+	if initDumpBatch {
+		if dumpEntryFirst == 0 {
+			dumpEntryFirst = e.Number
+		}
+		dumpEntryLast = e.Number
+
+		dumpBatchData += fmt.Sprintf("%02x%08x%08x%016x%x", 2, e.Length, e.Type, e.Number, e.Data) //nolint:mnd
+	}
+	return nil
+}
+
+// runRelay runs a local datastream relay
+func runRelay(ctx *cli.Context) error {
+	// Load config
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set log level
+	logLevel := cfg.GetString("log")
+	log.Init(log.Config{
+		Environment: "development",
+		Level:       logLevel,
+		Outputs:     []string{"stdout"},
+	})
+
+	log.Info(">> App begin")
+
+	// Parameters
+	server := cfg.GetString("server")
+	port := cfg.GetUint64("port")
+	file := cfg.GetString("file")
+	if server == "" || file == "" || port <= 0 {
+		return errors.New("bad/missing parameters")
+	}
+	writeTimeout := cfg.GetUint64("writetimeout")
+	inactivityTimeout := cfg.GetUint64("inactivitytimeout")
+	drainTimeout := time.Duration(cfg.GetUint64("draintimeout")) * time.Second
+	readinessFile := cfg.GetString("readiness-file")
+	lazyOpen := cfg.GetBool("lazyopen")
+	releaseDelay := time.Duration(cfg.GetUint64("releasedelay")) * time.Second
+	manualRelease := cfg.GetBool("manualrelease")
+	dedup := cfg.GetBool("dedup")
+	ephemeral := cfg.GetBool("ephemeral")
+	headerChanges := cfg.GetBool("headerchanges")
+	logsMux := startLogs(cfg.GetUint64("logbuffer"), cfg.GetString("logshttp"))
+	setFormatOptions(cfg)
+	setBufferMemory(cfg.GetUint64("memory"))
+
+	// Create relay server
+	var r *datastreamer.StreamRelay
+	if ephemeral {
+		r, err = datastreamer.NewEphemeralRelay(server, uint16(port), streamerVersion, streamerSystemID, StSequencer,
+			time.Duration(writeTimeout)*time.Millisecond, time.Duration(inactivityTimeout)*time.Second,
+			5*time.Second, nil) //nolint:mnd
+	} else {
+		r, err = datastreamer.NewRelay(server, uint16(port), streamerVersion, streamerSystemID, StSequencer, file,
+			time.Duration(writeTimeout)*time.Millisecond, time.Duration(inactivityTimeout)*time.Second,
+			5*time.Second, nil) //nolint:mnd
+	}
+	if err != nil {
+		return err
+	}
+	r.SetReconnectPolicy(newReconnectPolicy(cfg))
+	r.SetHeartbeat(heartbeatInterval(cfg))
+	r.SetReadinessFile(readinessFile)
+	r.SetBackgroundValidation(lazyOpen)
+	r.SetLiveQueues(cfg.GetInt("livequeue"))
+	r.SetMaxSessionDuration(time.Duration(cfg.GetUint64("maxsession")) * time.Second)
+	auth, err := loadAuthenticator(cfg.GetString("authtokensfile"))
+	if err != nil {
+		return err
+	}
+	r.SetAuthenticator(auth)
+	credentials, err := loadCredentials(cfg.GetString("credentialsfile"))
+	if err != nil {
+		return err
+	}
+	r.SetCredentials(credentials)
+	r.SetReleaseDelay(releaseDelay)
+	r.SetManualRelease(manualRelease)
+	if leaseFile := cfg.GetString("standbylease"); leaseFile != "" {
+		holder := cfg.GetString("standbyid")
+		if holder == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return err
+			}
+			holder = fmt.Sprintf("%s:%d", hostname, port)
+		}
+		r.SetStandby(datastreamer.NewFileLease(leaseFile), holder, time.Duration(cfg.GetUint64("leasettl"))*time.Second)
+	}
+	err = r.SetContentAddressing(dedup)
+	if err != nil {
+		return err
+	}
+	err = r.SetHeaderChanges(headerChanges)
+	if err != nil {
+		return err
+	}
+	err = r.SetCheckpoints(cfg.GetUint64("checkpoints"))
+	if err != nil {
+		return err
+	}
+	err = r.SetConsumerGroups(cfg.GetBool("groups"))
+	if err != nil {
+		return err
+	}
+	err = r.SetClientPositions(cfg.GetBool("positions"))
+	if err != nil {
+		return err
+	}
+	summaryPort, summaryTypes, err := parseSummaryStream(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = r.SetSummaryStream(summaryPort, summaryTypes)
+	if err != nil {
+		return err
+	}
+	latestPrefixes, err := parseLatestView(cfg)
+	if err != nil {
+		return err
+	}
+	err = r.SetLatestView(latestPrefixes)
+	if err != nil {
+		return err
+	}
+	r.SetWriteCoalescing(time.Duration(cfg.GetUint64("writecoalescing")) * time.Millisecond)
+	r.SetStatsSeries(time.Duration(cfg.GetUint64("statsseries"))*time.Second, cfg.GetInt("statssamples"))
+	r.SetSLO(newSLOConfig(cfg))
+	if logsMux != nil {
+		logsMux.Handle("/stats", r.StatsHandler())
+	}
+	r.SetDirectIO(cfg.GetBool("directio"))
+	r.SetWriteVerification(cfg.GetBool("verifywrites"))
+	err = setBookmarkDBOptions(cfg, r.SetBookmarkDBOptions)
+	if err != nil {
+		return err
+	}
+	if filterExpr := cfg.GetString("filter"); filterExpr != "" {
+		filter, err := datastreamer.NewFilterMiddleware(filterExpr)
+		if err != nil {
+			return err
+		}
+		r.UseSendMiddleware(filter)
+	}
+	if redactSpec := cfg.GetString("redact"); redactSpec != "" {
+		rules, err := datastreamer.ParseRedactRules(redactSpec)
+		if err != nil {
+			return err
+		}
+		err = r.SetRedaction(rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Start relay server
+	err = r.Start()
+	if err != nil {
+		log.Error(">> App error! Start")
+		return err
+	}
+
+	// Release the received entries on SIGUSR1
+	releaseSignal := make(chan os.Signal, 1)
+	notifyRelease(releaseSignal)
+	go func() {
+		for range releaseSignal {
+			log.Infof(">> Releasing %d entries", r.PendingRelease())
+			r.ReleaseReceived()
+		}
+	}()
+
+	// Run until Ctl+C
+	interruptSignal := make(chan os.Signal, 1)
+	signal.Notify(interruptSignal, os.Interrupt, syscall.SIGTERM)
+	<-interruptSignal
+
+	err = r.Shutdown(drainTimeout)
+	if err != nil {
+		log.Errorf(">> App error! Shutdown: %v", err)
+	}
+
+	log.Info(">> App end")
+	return nil
+}
+
+// runConformance runs the protocol conformance tests against a datastream server and reports the results
+func runConformance(ctx *cli.Context) error {
+	// Set log level and output format
+	logLevel := ctx.String("log")
+	logOutputs, err := setOutput(ctx.String("output"))
+	if err != nil {
+		return err
 	}
+	log.Init(log.Config{
+		Environment: "development",
+		Level:       logLevel,
+		Outputs:     logOutputs,
+	})
 
-	if e.Type != datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_L2_BLOCK) &&
-		e.Type != datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_TRANSACTION) &&
-		e.Type != datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_L2_BLOCK_END) {
-		return nil
+	// Parameters
+	server := ctx.String("server")
+	if server == "" {
+		return errors.New("bad/missing parameters")
 	}
+	timeout := ctx.Uint64("timeout")
 
-	// L2 block start
-	if e.Type == datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_L2_BLOCK) {
-		l2Block := &datastream.L2Block{}
-		err := proto.Unmarshal(e.Data, l2Block)
-		if err != nil {
-			log.Error("error decoding l2 block. Error: ", err)
-			return err
-		}
-		batchNumber := l2Block.BatchNumber
-		switch {
-		case batchNumber < dumpBatchNumber:
-			return nil
-		case (batchNumber > dumpBatchNumber) || (e.Number+1 >= c.GetTotalEntries()):
-			log.Infof("DUMP BATCH finished! First entry[%d], last entry[%d], first block[%d], last block[%d], total tx[%d]",
-				dumpEntryFirst, dumpEntryLast, dumpBlockFirst, dumpBlockLast, dumpTotalTx)
-
-			// Dump to json file
-			fileName := fmt.Sprintf("dumpbatch%d.json", dumpBatchNumber)
-			file, err := os.Create(fileName)
+	// Run tests
+	results := conformance.Run(conformance.Config{
+		Server:     server,
+		StreamType: StSequencer,
+		Timeout:    time.Duration(timeout) * time.Millisecond,
+	})
+	for _, r := range results {
+		if jsonOutput {
+			err = printJSON(newResultOutput(r))
 			if err != nil {
-				return errors.New("creating dump file")
-			}
-			defer file.Close()
-
-			bd := BatchDump{
-				Number:     dumpBatchNumber,
-				EntryFirst: dumpEntryFirst,
-				EntryLast:  dumpEntryLast,
-				BlockFirst: dumpBlockFirst,
-				BlockLast:  dumpBlockLast,
-				TotalTx:    dumpTotalTx,
-				Data:       dumpBatchData,
+				return err
 			}
+		} else {
+			fmt.Println(r)
+		}
+	}
 
-			encoder := json.NewEncoder(file)
-			err = encoder.Encode(bd)
-			if err != nil {
-				return errors.New("writing dump file")
-			}
+	failed := conformance.Failed(results)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d conformance tests failed", failed, len(results))
+	}
+	if jsonOutput {
+		return nil
+	}
+	fmt.Printf("All %d conformance tests passed\n", len(results))
+	return nil
+}
 
-			os.Exit(0)
+// runSpec prints the protocol specification of this build, for the code generators and the validators
+func runSpec(ctx *cli.Context) error {
+	data, err := protocol.Spec().Encode(ctx.String("format"))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
 
-		case batchNumber == dumpBatchNumber:
-			initDumpBatch = true
+// runSplit splits a datastream file into a stream file for each group of entry types
+func runSplit(ctx *cli.Context) error {
+	// Set log level and output format
+	logOutputs, err := setOutput(ctx.String("output"))
+	if err != nil {
+		return err
+	}
+	log.Init(log.Config{
+		Environment: "development",
+		Level:       ctx.String("log"),
+		Outputs:     logOutputs,
+	})
 
-			blockNum := l2Block.Number
-			if dumpBlockFirst == 0 {
-				dumpBlockFirst = blockNum
-			}
-			dumpBlockLast = blockNum
+	// Parameters
+	var outputs []datastreamer.SplitOutput
+	for _, stream := range ctx.StringSlice("stream") {
+		fileName, list, found := strings.Cut(stream, "=")
+		if !found || fileName == "" {
+			return fmt.Errorf("bad stream parameter %q, expected <file>=<entry types>", stream)
 		}
-	} else if e.Type == datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_TRANSACTION) && initDumpBatch {
-		dumpTotalTx++
+		entryTypes, err := parseEntryTypeList(list, "stream")
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, datastreamer.SplitOutput{FileName: fileName, EntryTypes: entryTypes})
 	}
 
-	// Add data
-	if initDumpBatch {
-		if dumpEntryFirst == 0 {
-			dumpEntryFirst = e.Number
+	results, err := datastreamer.SplitStream(ctx.String("file"), StSequencer, outputs)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		err = signStream(ctx.String("signkey"), r.FileName)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			err = printJSON(r)
+			if err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("%s: %d entries, %d bookmarks\n", r.FileName, r.Entries, r.Bookmarks)
 		}
-		dumpEntryLast = e.Number
-
-		dumpBatchData += fmt.Sprintf("%02x%08x%08x%016x%x", 2, e.Length, e.Type, e.Number, e.Data) //nolint:mnd
 	}
 	return nil
 }
 
-// runRelay runs a local datastream relay
-func runRelay(ctx *cli.Context) error {
-	// Set log level
-	logLevel := ctx.String("log")
+// runMerge merges datastream files into a single stream file
+func runMerge(ctx *cli.Context) error {
+	// Set log level and output format
+	logOutputs, err := setOutput(ctx.String("output"))
+	if err != nil {
+		return err
+	}
 	log.Init(log.Config{
 		Environment: "development",
-		Level:       logLevel,
-		Outputs:     []string{"stdout"},
+		Level:       ctx.String("log"),
+		Outputs:     logOutputs,
 	})
 
-	log.Info(">> App begin")
+	// Parameters
+	var key datastreamer.MergeKeyFunc
+	switch ctx.String("order") {
+	case "timestamp":
+		key = l2BlockTimestamp
+	case "input":
+	default:
+		return fmt.Errorf("bad order parameter %q, expected timestamp or input", ctx.String("order"))
+	}
+
+	r, err := datastreamer.MergeStreams(ctx.StringSlice("input"), StSequencer, ctx.String("file"), key)
+	if err != nil {
+		return err
+	}
+	err = signStream(ctx.String("signkey"), r.FileName)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(r)
+	}
+	fmt.Printf("%s: %d entries, %d bookmarks (%d duplicated)\n", r.FileName, r.Entries, r.Bookmarks, r.Duplicates)
+	return nil
+}
+
+// signStream writes the manifest of a stream file and its bookmarks DB signed with the operator key (if set)
+func signStream(keyFile string, fileName string) error {
+	if keyFile == "" {
+		return nil
+	}
+	key, err := datastreamer.LoadSigningKey(keyFile)
+	if err != nil {
+		return err
+	}
+	manifest, err := datastreamer.WriteStreamManifest(fileName, key)
+	if err != nil {
+		return err
+	}
+	log.Infof("Signed manifest of %s written to %s", fileName, manifest)
+	return nil
+}
+
+// l2BlockTimestamp returns the timestamp of an L2 block entry as its merge ordering key
+func l2BlockTimestamp(e *datastreamer.FileEntry) (uint64, bool) {
+	if e.Type != datastreamer.EntryType(datastream.EntryType_ENTRY_TYPE_L2_BLOCK) {
+		return 0, false
+	}
+	l2Block := &datastream.L2Block{}
+	err := proto.Unmarshal(e.Data, l2Block)
+	if err != nil {
+		log.Warnf("Error decoding L2 block entry %d: %v", e.Number, err)
+		return 0, false
+	}
+	return l2Block.GetTimestamp(), true
+}
 
+// runBundle collects the server state and the client statistics files into a support bundle
+func runBundle(ctx *cli.Context) error {
 	// Parameters
 	server := ctx.String("server")
-	port := ctx.Uint64("port")
-	file := ctx.String("file")
-	if server == "" || file == "" || port <= 0 {
-		return errors.New("bad/missing parameters")
+	statsFiles := ctx.StringSlice("statsfile")
+	output := ctx.String("output")
+	if output == "" {
+		output = fmt.Sprintf("support-bundle-%s.zip", time.Now().Format("20060102-150405"))
 	}
-	writeTimeout := ctx.Uint64("writetimeout")
-	inactivityTimeout := ctx.Uint64("inactivitytimeout")
 
-	// Create relay server
-	r, err := datastreamer.NewRelay(server, uint16(port), streamerVersion, streamerSystemID, StSequencer, file,
-		time.Duration(writeTimeout)*time.Millisecond, time.Duration(inactivityTimeout)*time.Second,
-		5*time.Second, nil) //nolint:mnd
+	// Get the server state (a failure is also reported in the bundle)
+	serverState, err := getServerStats(server)
+	if err != nil {
+		serverState = []byte(fmt.Sprintf("error getting stats from server %s: %v\n", server, err))
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bundle := zip.NewWriter(f)
+	var buf bytes.Buffer
+	zkevm.PrintVersion(&buf)
+	fmt.Fprintf(&buf, "Collected:    %s\nServer:       %s\n", time.Now().Format(time.RFC3339), server)
+	names := []string{"version.txt", "server.json"}
+	files := [][]byte{buf.Bytes(), serverState}
+	for i, statsFile := range statsFiles {
+		data, err := os.ReadFile(statsFile)
+		if err != nil {
+			data = []byte(fmt.Sprintf("error reading file %s: %v\n", statsFile, err))
+		}
+		names = append(names, fmt.Sprintf("clients/%d-%s", i, filepath.Base(statsFile)))
+		files = append(files, data)
+	}
+	for i, name := range names {
+		w, err := bundle.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(files[i])
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.String("signkey") != "" {
+		err = signBundle(bundle, ctx.String("signkey"), names, files)
+		if err != nil {
+			return err
+		}
+	}
+	err = bundle.Close()
 	if err != nil {
 		return err
 	}
 
-	// Start relay server
-	err = r.Start()
+	fmt.Printf("Support bundle written to %s\n", output)
+	return nil
+}
+
+// signBundle adds the manifest of the bundle files signed with the operator key to the bundle
+func signBundle(bundle *zip.Writer, keyFile string, names []string, files [][]byte) error {
+	key, err := datastreamer.LoadSigningKey(keyFile)
+	if err != nil {
+		return err
+	}
+	manifest := datastreamer.NewManifest()
+	for i, name := range names {
+		err = manifest.AddFile(name, bytes.NewReader(files[i]))
+		if err != nil {
+			return err
+		}
+	}
+	err = manifest.Sign(key)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		log.Error(">> App error! Start")
 		return err
 	}
 
-	// Run until Ctl+C
-	interruptSignal := make(chan os.Signal, 1)
-	signal.Notify(interruptSignal, os.Interrupt, syscall.SIGTERM)
-	<-interruptSignal
+	w, err := bundle.CreateHeader(&zip.FileHeader{Name: datastreamer.ManifestFileName, Method: zip.Deflate,
+		Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
 
-	log.Info(">> App end")
+// runSign writes the manifest of the files signed with the operator key
+func runSign(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("no files to sign")
+	}
+	key, err := datastreamer.LoadSigningKey(ctx.String("key"))
+	if err != nil {
+		return err
+	}
+	err = datastreamer.WriteFilesManifest(ctx.String("manifest"), ctx.Args().Slice(), key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Signed manifest written to %s\n", ctx.String("manifest"))
+	return nil
+}
+
+// runVerify verifies a signed manifest and its files, or the manifest of a signed support bundle (*.zip)
+func runVerify(ctx *cli.Context) error {
+	fileName := ctx.Args().First()
+	if fileName == "" {
+		return errors.New("no manifest or bundle to verify")
+	}
+	trusted, err := datastreamer.LoadTrustedKeys(ctx.String("keys"))
+	if err != nil {
+		return err
+	}
+
+	var manifest *datastreamer.Manifest
+	if strings.HasSuffix(fileName, ".zip") {
+		manifest, err = verifyBundle(fileName, trusted)
+	} else {
+		manifest, err = datastreamer.VerifyFilesManifest(fileName, trusted)
+	}
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", fileName, err)
+	}
+	fmt.Printf("Verified %d files signed by %s on %s\n", len(manifest.Files), manifest.PublicKey,
+		manifest.Created.Format(time.RFC3339))
 	return nil
 }
+
+// verifyBundle verifies the signed manifest of a support bundle and the bundle files, all listed in it
+func verifyBundle(fileName string, trusted []ed25519.PublicKey) (*datastreamer.Manifest, error) {
+	bundle, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer bundle.Close()
+
+	content, err := readBundleFile(bundle.File, datastreamer.ManifestFileName)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := datastreamer.ParseManifest(content)
+	if err != nil {
+		return nil, err
+	}
+	err = manifest.Verify(trusted)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.File) != len(manifest.Files)+1 {
+		return nil, datastreamer.ErrManifestFileMismatch
+	}
+	for _, file := range bundle.File {
+		if file.Name == datastreamer.ManifestFileName {
+			continue
+		}
+		content, err = readBundleFile(bundle.File, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		err = manifest.VerifyFile(file.Name, bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// readBundleFile reads the contents of a file of a bundle
+func readBundleFile(files []*zip.File, name string) ([]byte, error) {
+	for _, file := range files {
+		if file.Name != name {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, datastreamer.ErrManifestFileMismatch
+}
+
+// getServerStats gets the server statistics in JSON format
+func getServerStats(server string) ([]byte, error) {
+	type response struct {
+		stats datastreamer.ServerStats
+		err   error
+	}
+	done := make(chan response, 1)
+
+	// The client waits for the server forever, so don't wait for it more than the timeout
+	go func() {
+		c, err := datastreamer.NewClient(server, StSequencer)
+		if err == nil {
+			err = c.Start()
+		}
+		if err != nil {
+			done <- response{err: err}
+			return
+		}
+		stats, err := c.ExecCommandGetStats()
+		done <- response{stats: stats, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return json.MarshalIndent(r.stats, "", "  ")
+	case <-time.After(bundleServerTimeout):
+		return nil, errors.New("timeout connecting to the server")
+	}
+}
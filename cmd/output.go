@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/conformance"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/spf13/viper"
+	"github.com/urfave/cli/v2"
+)
+
+// Output formats of the commands results (--output)
+const (
+	outputText = "text" // outputText for the results in the log
+	outputJSON = "json" // outputJSON for the results in JSON format to the standard output, one per line
+)
+
+// jsonOutput flags the commands results printed in JSON format
+var jsonOutput bool = false
+
+// Formatting flags of the entry numbers, bookmarks and payloads in the logs of the server, client and relay commands
+var (
+	hexFlag = &cli.BoolFlag{
+		Name:  "hex",
+		Usage: "entry numbers, bookmarks and payloads in hexadecimal in the logs",
+		Value: false,
+	}
+	bookmarkLenFlag = &cli.Uint64Flag{
+		Name:        "bookmarklen",
+		Usage:       "maximum bytes of the bookmarks shown in the logs, the rest elided (0 for the full bookmarks)",
+		Value:       0,
+		DefaultText: "0",
+	}
+	payloadLenFlag = &cli.Uint64Flag{
+		Name:        "payloadlen",
+		Usage:       "maximum bytes of the payloads shown in the logs, the rest elided (0 for the full payloads)",
+		Value:       0,
+		DefaultText: "0",
+	}
+)
+
+// headerOutput type for the JSON output of the stream header
+type headerOutput struct {
+	Version      uint8  `json:"version"`
+	SystemID     uint64 `json:"systemID"`
+	TotalLength  uint64 `json:"totalLength"`
+	TotalEntries uint64 `json:"totalEntries"`
+	BaseEntry    uint64 `json:"baseEntry"`
+}
+
+// entryOutput type for the JSON output of a data entry
+type entryOutput struct {
+	Number uint64        `json:"number"`
+	Length uint32        `json:"length"`
+	Type   uint32        `json:"type"`
+	Data   hexutil.Bytes `json:"data"` // Hexadecimal with 0x prefix
+}
+
+// bookmarkOutput type for the JSON output of a bookmark and the entry pointed by it
+type bookmarkOutput struct {
+	BookmarkType uint8         `json:"bookmarkType"`
+	Value        uint64        `json:"value"`
+	Bookmark     hexutil.Bytes `json:"bookmark"` // Bookmark encoded (protobuf)
+	Entry        *entryOutput  `json:"entry"`
+}
+
+// proofOutput type for the JSON output of a checkpoint inclusion proof
+type proofOutput struct {
+	Entry      uint64          `json:"entry"`
+	Checkpoint uint64          `json:"checkpoint"`
+	FromEntry  uint64          `json:"fromEntry"`
+	Entries    uint64          `json:"entries"`
+	Root       hexutil.Bytes   `json:"root"`
+	Path       []hexutil.Bytes `json:"path"`
+	Verified   bool            `json:"verified"` // Entry checked against the root of the proof
+}
+
+// latestOutput type for the JSON output of the latest bookmark of a bookmark type
+type latestOutput struct {
+	BookmarkType uint8         `json:"bookmarkType"`
+	Value        uint64        `json:"value"`
+	Bookmark     hexutil.Bytes `json:"bookmark"` // Bookmark encoded (protobuf)
+	Entry        uint64        `json:"entry"`
+	Hash         hexutil.Bytes `json:"hash"` // Hash of the payload of the entry marked (null until committed)
+}
+
+// resultOutput type for the JSON output of a conformance test result
+type resultOutput struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	Skipped    bool   `json:"skipped"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// setOutput sets the output format of the commands results, and returns the outputs of the log: the standard error
+// for the JSON format, so the standard output only has the results
+func setOutput(format string) ([]string, error) {
+	switch format {
+	case outputText:
+		jsonOutput = false
+		return []string{"stdout"}, nil
+	case outputJSON:
+		jsonOutput = true
+		return []string{"stderr"}, nil
+	default:
+		return nil, fmt.Errorf("bad output parameter %s, must be %s or %s", format, outputText, outputJSON)
+	}
+}
+
+// setFormatOptions sets the formatting of the entry numbers, bookmarks and payloads in the logs from the options
+func setFormatOptions(cfg *viper.Viper) {
+	datastreamer.SetFormatOptions(datastreamer.FormatOptions{
+		Hex:         cfg.GetBool(hexFlag.Name),
+		BookmarkLen: cfg.GetInt(bookmarkLenFlag.Name),
+		PayloadLen:  cfg.GetInt(payloadLenFlag.Name),
+	})
+}
+
+// printJSON prints a result in JSON format to the standard output, in a single line
+func printJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
+
+// queryError returns the error of a query command to exit with it in JSON format, or logs it in text format
+func queryError(err error) error {
+	if jsonOutput {
+		return err
+	}
+	log.Infof("Error: %v", err)
+	return nil
+}
+
+// newHeaderOutput returns the JSON output of a stream header
+func newHeaderOutput(header datastreamer.HeaderEntry) headerOutput {
+	return headerOutput{
+		Version:      header.Version,
+		SystemID:     header.SystemID,
+		TotalLength:  header.TotalLength,
+		TotalEntries: header.TotalEntries,
+		BaseEntry:    header.BaseEntry,
+	}
+}
+
+// newEntryOutput returns the JSON output of a data entry
+func newEntryOutput(e datastreamer.FileEntry) *entryOutput {
+	return &entryOutput{
+		Number: e.Number,
+		Length: e.Length,
+		Type:   uint32(e.Type),
+		Data:   e.Data,
+	}
+}
+
+// newProofOutput returns the JSON output of the checkpoint inclusion proof of an entry
+func newProofOutput(entry uint64, proof datastreamer.CheckpointProof, verified bool) proofOutput {
+	path := make([]hexutil.Bytes, 0, len(proof.Path))
+	for _, p := range proof.Path {
+		path = append(path, p)
+	}
+	return proofOutput{
+		Entry:      entry,
+		Checkpoint: proof.Checkpoint,
+		FromEntry:  proof.FromEntry,
+		Entries:    proof.Entries,
+		Root:       proof.Root,
+		Path:       path,
+		Verified:   verified,
+	}
+}
+
+// newResultOutput returns the JSON output of a conformance test result
+func newResultOutput(r conformance.Result) resultOutput {
+	output := resultOutput{
+		Name:       r.Name,
+		Passed:     r.Err == nil && !r.Skipped,
+		Skipped:    r.Skipped,
+		DurationMs: r.Duration.Milliseconds(),
+	}
+	if r.Err != nil {
+		output.Error = r.Err.Error()
+	}
+	return output
+}
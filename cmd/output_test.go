@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/conformance"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput(t *testing.T) {
+	defer func() { jsonOutput = false }()
+
+	// Case: Text format -> logs to stdout
+	outputs, err := setOutput(outputText)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stdout"}, outputs)
+	require.False(t, jsonOutput)
+	require.NoError(t, queryError(errors.New("entry not found")))
+
+	// Case: JSON format -> logs to stderr, query errors returned
+	outputs, err = setOutput(outputJSON)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stderr"}, outputs)
+	require.True(t, jsonOutput)
+	require.Error(t, queryError(errors.New("entry not found")))
+
+	// Case: Unknown format
+	_, err = setOutput("yaml")
+	require.Error(t, err)
+
+	// Entry data in hexadecimal
+	entry := datastreamer.FileEntry{Number: 5, Length: 19, Type: 1, Data: []byte{1, 0xab}}
+	data, err := json.Marshal(newEntryOutput(entry))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"number":5,"length":19,"type":1,"data":"0x01ab"}`, string(data))
+
+	// Conformance results
+	data, err = json.Marshal([]resultOutput{
+		newResultOutput(conformance.Result{Name: "header", Duration: 3 * time.Millisecond}),
+		newResultOutput(conformance.Result{Name: "entry last", Skipped: true}),
+		newResultOutput(conformance.Result{Name: "bookmark", Err: errors.New("bookmark not found")}),
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"name":"header","passed":true,"skipped":false,"durationMs":3},
+		{"name":"entry last","passed":false,"skipped":true,"durationMs":0},
+		{"name":"bookmark","passed":false,"skipped":false,"error":"bookmark not found","durationMs":0}
+	]`, string(data))
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// notifyRelease relays the signals releasing the received entries to the channel, not supported in this platform
+func notifyRelease(chan<- os.Signal) {
+}
@@ -0,0 +1,97 @@
+// Package conformance runs a battery of protocol tests against a data stream server, to certify relays and
+// alternative server implementations
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const defaultTimeout = 5 * time.Second // Default timeout for connections and reads
+
+// Config type for the conformance tests configuration
+type Config struct {
+	Server     string                  // Server address to test (IP:port)
+	StreamType datastreamer.StreamType // Stream type served by the server
+	Timeout    time.Duration           // Timeout for connections and reads (0=default)
+}
+
+// Result type for the outcome of a conformance test
+type Result struct {
+	Name     string        // Test name
+	Err      error         // Failure reason (nil if passed or skipped)
+	Skipped  bool          // Flag test not applicable to the server (e.g. empty stream)
+	Duration time.Duration // Test duration
+}
+
+// test type for a conformance test case
+type test struct {
+	name string
+	run  func(t *tester) error
+}
+
+// tester type to run the test cases against the server
+type tester struct {
+	cfg Config
+}
+
+// errSkip is returned by a test case not applicable to the server
+var errSkip = errors.New("skipped")
+
+// Run runs all the conformance tests against the server and returns their results
+func Run(cfg Config) []Result {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	t := &tester{cfg: cfg}
+
+	results := make([]Result, 0, len(tests))
+	for _, tc := range tests {
+		start := time.Now()
+		err := tc.run(t)
+		r := Result{
+			Name:     tc.name,
+			Duration: time.Since(start),
+		}
+		if errors.Is(err, errSkip) {
+			r.Skipped = true
+		} else {
+			r.Err = err
+		}
+		results = append(results, r)
+
+		if r.Err != nil {
+			log.Errorf("Conformance test %s FAILED: %v", tc.name, r.Err)
+		} else {
+			log.Debugf("Conformance test %s passed (skipped: %t)", tc.name, r.Skipped)
+		}
+	}
+	return results
+}
+
+// Failed returns the number of failed tests in the results
+func Failed(results []Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// String returns the result as a report line
+func (r Result) String() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("FAIL  %s (%v): %v", r.Name, r.Duration.Round(time.Millisecond), r.Err)
+	case r.Skipped:
+		return fmt.Sprintf("SKIP  %s", r.Name)
+	default:
+		return fmt.Sprintf("PASS  %s (%v)", r.Name, r.Duration.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,61 @@
+package conformance
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPort       = 6910
+	testStreamType = datastreamer.StreamType(1)
+)
+
+func TestRun(t *testing.T) {
+	logConfig := log.Config{
+		Environment: "development",
+		Level:       "error",
+		Outputs:     []string{"stdout"},
+	}
+	s, err := datastreamer.NewServer(testPort, 1, 137, testStreamType, filepath.Join(t.TempDir(), "conformance.bin"),
+		3*time.Second, 0, 5*time.Second, &logConfig)
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+
+	// Case: Empty stream, tests needing entries skipped -> OK
+	cfg := Config{
+		Server:     fmt.Sprintf("localhost:%d", testPort),
+		StreamType: testStreamType,
+		Timeout:    2 * time.Second,
+	}
+	results := Run(cfg)
+	require.Equal(t, 0, Failed(results), "%v", results)
+	require.True(t, results[1].Skipped)
+
+	// Case: Stream with entries, all tests passed -> OK
+	require.NoError(t, s.StartAtomicOp())
+	_, err = s.AddStreamBookmark([]byte{0, 1})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = s.AddStreamEntry(1, []byte{byte(i)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.CommitAtomicOp())
+
+	results = Run(cfg)
+	require.Len(t, results, len(tests))
+	for _, r := range results {
+		require.NoError(t, r.Err, r.Name)
+		require.False(t, r.Skipped, r.Name)
+	}
+
+	// Case: Wrong stream type configured -> FAIL
+	cfg.StreamType = testStreamType + 1
+	results = Run(cfg)
+	require.NotZero(t, Failed(results))
+}
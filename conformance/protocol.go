@@ -0,0 +1,19 @@
+package conformance
+
+import (
+	"github.com/0xPolygonHermez/zkevm-data-streamer/protoclient"
+)
+
+// conn type for a raw protocol connection to the server under test
+type conn struct {
+	*protoclient.Conn
+}
+
+// dial opens a new raw connection to the server
+func (t *tester) dial() (*conn, error) {
+	c, err := protoclient.Dial(t.cfg.Server, t.cfg.StreamType, t.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c}, nil
+}
@@ -0,0 +1,435 @@
+package conformance
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/protoclient"
+)
+
+const badEntryOffset = 1000000 // Offset over the total entries for an entry number surely not existing
+
+// unknownBookmark is a bookmark surely not added to the stream
+var unknownBookmark = []byte{0xff, 0xfe, 0xfd, 0xfc, 0xfb, 0xfa, 0xf9, 0xf8,
+	0xf7, 0xf6, 0xf5, 0xf4, 0xf3, 0xf2, 0xf1, 0xf0}
+
+// tests is the battery of conformance test cases, run in order
+var tests = []test{
+	{"header", testHeader},
+	{"entry first", testEntryFirst},
+	{"entry last", testEntryLast},
+	{"entry not found", testEntryNotFound},
+	{"bookmark not found", testBookmarkNotFound},
+	{"start bad entry", testStartBadEntry},
+	{"start bookmark not found", testStartBookmarkNotFound},
+	{"start last entry and stop", testStartStop},
+	{"start already started", testStartAlreadyStarted},
+	{"stop already stopped", testStopAlreadyStopped},
+	{"query while streaming", testQueryWhileStreaming},
+	{"invalid command", testInvalidCommand},
+	{"versioned header", testVersionedHeader},
+	{"bad stream type", testBadStreamType},
+	{"malformed frame", testMalformedFrame},
+	{"reconnect", testReconnect},
+}
+
+// getHeader opens a connection and queries the header
+func (t *tester) getHeader() (codec.Header, error) {
+	c, err := t.dial()
+	if err != nil {
+		return codec.Header{}, err
+	}
+	defer c.Close()
+
+	return c.queryHeader()
+}
+
+// queryHeader queries the header over the connection
+func (c *conn) queryHeader() (codec.Header, error) {
+	err := c.SendCommand(protoclient.Header{})
+	if err != nil {
+		return codec.Header{}, err
+	}
+	err = c.ExpectResult(datastreamer.CmdErrOK)
+	if err != nil {
+		return codec.Header{}, err
+	}
+	return c.ReadHeader()
+}
+
+// queryEntry queries an entry by number over a new connection
+func (t *tester) queryEntry(number uint64) (codec.Entry, error) {
+	c, err := t.dial()
+	if err != nil {
+		return codec.Entry{}, err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Entry{Number: number})
+	if err != nil {
+		return codec.Entry{}, err
+	}
+	err = c.ExpectResult(datastreamer.CmdErrOK)
+	if err != nil {
+		return codec.Entry{}, err
+	}
+	return c.ReadEntry(datastreamer.PtDataRsp)
+}
+
+// getLastEntry returns the last entry number of the stream, or skips the test if the stream is empty
+func (t *tester) getLastEntry() (uint64, error) {
+	h, err := t.getHeader()
+	if err != nil {
+		return 0, err
+	}
+	if h.TotalEntries == 0 {
+		return 0, errSkip
+	}
+	return h.TotalEntries - 1, nil
+}
+
+// testHeader checks the header command returns a consistent header
+func testHeader(t *tester) error {
+	h, err := t.getHeader()
+	if err != nil {
+		return err
+	}
+	if datastreamer.StreamType(h.StreamType) != t.cfg.StreamType {
+		return fmt.Errorf("stream type %d, expected %d", h.StreamType, t.cfg.StreamType)
+	}
+	if h.TotalLength < datastreamer.PageHeaderSize {
+		return fmt.Errorf("total length %d lower than the header page", h.TotalLength)
+	}
+	return nil
+}
+
+// testEntryFirst checks the first entry of the stream is returned
+func testEntryFirst(t *tester) error {
+	_, err := t.getLastEntry()
+	if err != nil {
+		return err
+	}
+	return t.checkEntry(0)
+}
+
+// testEntryLast checks the last entry of the stream is returned
+func testEntryLast(t *tester) error {
+	last, err := t.getLastEntry()
+	if err != nil {
+		return err
+	}
+	return t.checkEntry(last)
+}
+
+// checkEntry checks the entry command returns the requested entry
+func (t *tester) checkEntry(number uint64) error {
+	e, err := t.queryEntry(number)
+	if err != nil {
+		return err
+	}
+	if datastreamer.EntryType(e.Type) == datastreamer.EntryTypeNotFound {
+		return fmt.Errorf("entry %d not found", number)
+	}
+	if e.Number != number {
+		return fmt.Errorf("entry %d received, expected %d", e.Number, number)
+	}
+	return nil
+}
+
+// testEntryNotFound checks the entry command of an entry after the last one returns not found
+func testEntryNotFound(t *tester) error {
+	h, err := t.getHeader()
+	if err != nil {
+		return err
+	}
+	e, err := t.queryEntry(h.TotalEntries + badEntryOffset)
+	if err != nil {
+		return err
+	}
+	if datastreamer.EntryType(e.Type) != datastreamer.EntryTypeNotFound || e.Length != datastreamer.FixedSizeFileEntry {
+		return fmt.Errorf("entry type %d length %d, expected not found", e.Type, e.Length)
+	}
+	return nil
+}
+
+// testBookmarkNotFound checks the bookmark command of an unknown bookmark returns not found
+func testBookmarkNotFound(t *tester) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Bookmark{Bookmark: unknownBookmark})
+	if err != nil {
+		return err
+	}
+	err = c.ExpectResult(datastreamer.CmdErrOK)
+	if err != nil {
+		return err
+	}
+	e, err := c.ReadEntry(datastreamer.PtDataRsp)
+	if err != nil {
+		return err
+	}
+	if datastreamer.EntryType(e.Type) != datastreamer.EntryTypeNotFound {
+		return fmt.Errorf("entry type %d, expected not found", e.Type)
+	}
+	return nil
+}
+
+// testStartBadEntry checks the start command from an entry after the last one is rejected
+func testStartBadEntry(t *tester) error {
+	h, err := t.getHeader()
+	if err != nil {
+		return err
+	}
+
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Start{FromEntry: h.TotalEntries + badEntryOffset})
+	if err != nil {
+		return err
+	}
+	return c.ExpectResult(datastreamer.CmdErrBadFromEntry)
+}
+
+// testStartBookmarkNotFound checks the start bookmark command from an unknown bookmark is rejected
+func testStartBookmarkNotFound(t *tester) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.StartBookmark{Bookmark: unknownBookmark})
+	if err != nil {
+		return err
+	}
+	return c.ExpectResult(datastreamer.CmdErrBadFromBookmark)
+}
+
+// startStreaming opens a connection streaming from an entry number and checks it's the first entry received
+func (t *tester) startStreaming(fromEntry uint64) (*conn, error) {
+	c, err := t.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.SendCommand(protoclient.Start{FromEntry: fromEntry})
+	if err == nil {
+		err = c.ExpectResult(datastreamer.CmdErrOK)
+	}
+	if err == nil {
+		var e codec.Entry
+		e, err = c.ReadEntry(datastreamer.PtData)
+		if err == nil && e.Number != fromEntry {
+			err = fmt.Errorf("entry %d streamed, expected %d", e.Number, fromEntry)
+		}
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// testStartStop checks the streaming from the last entry and its stop
+func testStartStop(t *tester) error {
+	last, err := t.getLastEntry()
+	if err != nil {
+		return err
+	}
+	c, err := t.startStreaming(last)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Stop{})
+	if err != nil {
+		return err
+	}
+	return c.ExpectResult(datastreamer.CmdErrOK)
+}
+
+// testStartAlreadyStarted checks a second start command while streaming is rejected
+func testStartAlreadyStarted(t *tester) error {
+	last, err := t.getLastEntry()
+	if err != nil {
+		return err
+	}
+	c, err := t.startStreaming(last)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Start{FromEntry: last})
+	if err != nil {
+		return err
+	}
+	return c.ExpectResult(datastreamer.CmdErrAlreadyStarted)
+}
+
+// testStopAlreadyStopped checks the stop command without streaming is rejected
+func testStopAlreadyStopped(t *tester) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Stop{})
+	if err != nil {
+		return err
+	}
+	return c.ExpectResult(datastreamer.CmdErrAlreadyStopped)
+}
+
+// testQueryWhileStreaming checks the untagged query commands are rejected while streaming
+func testQueryWhileStreaming(t *tester) error {
+	last, err := t.getLastEntry()
+	if err != nil {
+		return err
+	}
+	c, err := t.startStreaming(last)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Header{})
+	if err != nil {
+		return err
+	}
+	return c.ExpectResult(datastreamer.CmdErrAlreadyStarted)
+}
+
+// testInvalidCommand checks an unknown command is rejected and the connection keeps working
+func testInvalidCommand(t *tester) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Raw{Command: datastreamer.Command(0xff)})
+	if err != nil {
+		return err
+	}
+	err = c.ExpectResult(datastreamer.CmdErrInvalidCommand)
+	if err != nil {
+		return err
+	}
+	_, err = c.queryHeader()
+	return err
+}
+
+// testVersionedHeader checks the versioned header returns the protocol version after the header, or it's rejected as
+// an unknown command by a legacy server keeping the connection working
+func testVersionedHeader(t *tester) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SendCommand(protoclient.Header{Versioned: true})
+	if err != nil {
+		return err
+	}
+	r, err := c.ReadResult()
+	if err != nil {
+		return err
+	}
+	switch datastreamer.CommandError(r.ErrorNum) {
+	case datastreamer.CmdErrInvalidCommand:
+		_, err = c.queryHeader()
+		return err
+	case datastreamer.CmdErrOK:
+	default:
+		return fmt.Errorf("result %d[%s], expected %d or %d", r.ErrorNum, r.ErrorStr, datastreamer.CmdErrOK,
+			datastreamer.CmdErrInvalidCommand)
+	}
+	_, err = c.ReadHeader()
+	if err != nil {
+		return err
+	}
+	protocol, err := c.ReadProtocolVersion()
+	if err != nil {
+		return err
+	}
+	if protocol < datastreamer.ProtocolTagged {
+		return fmt.Errorf("protocol version %d reported, expected at least %d", protocol, datastreamer.ProtocolTagged)
+	}
+	return nil
+}
+
+// testBadStreamType checks a command with a different stream type closes the connection
+func testBadStreamType(t *tester) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.WriteRaw(protoclient.Encode(protoclient.Header{}, t.cfg.StreamType+1, 0))
+	if err != nil {
+		return err
+	}
+	return c.ExpectClosed()
+}
+
+// testMalformedFrame checks a truncated command closes the connection and the server keeps serving
+func testMalformedFrame(t *tester) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// Send half of the command field and no more data
+	err = c.WriteRaw(protoclient.Encode(protoclient.Header{}, t.cfg.StreamType, 0)[:4])
+	if err != nil {
+		return err
+	}
+	if tcp, ok := c.Conn.Conn.(*net.TCPConn); ok {
+		err = tcp.CloseWrite()
+		if err != nil {
+			return err
+		}
+	}
+	err = c.ExpectClosed()
+	if err != nil {
+		return err
+	}
+
+	_, err = t.getHeader()
+	return err
+}
+
+// testReconnect checks a client reconnecting abruptly streams again from the same entry
+func testReconnect(t *tester) error {
+	last, err := t.getLastEntry()
+	if err != nil {
+		return err
+	}
+	c, err := t.startStreaming(last)
+	if err != nil {
+		return err
+	}
+	c.Close()
+
+	c, err = t.startStreaming(last)
+	if err != nil {
+		return fmt.Errorf("after reconnection: %w", err)
+	}
+	return c.Close()
+}
@@ -0,0 +1,293 @@
+// Package codec encodes and decodes the binary packets of the data stream: the stream file entries, the TCP command
+// results and the tagged frames. It has no file or network dependencies, so it also builds for GOOS=js GOARCH=wasm
+// to decode the stream in browser tools with the canonical code.
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Packet types
+const (
+	PtPadding   = 0    // PtPadding is packet type for pad
+	PtHeader    = 1    // PtHeader is packet type just for the header page
+	PtData      = 2    // PtData is packet type for data entry
+	PtReconnect = 0xfb // PtReconnect is packet type for the server request to reconnect (not stored in file)
+	PtShutdown  = 0xfc // PtShutdown is packet type for the server shutdown notification (not stored in file)
+	PtTagged    = 0xfd // PtTagged is packet type for a frame tagged with a subscription ID (not stored in file)
+	PtDataRsp   = 0xfe // PtDataRsp is packet type for command response with data
+	PtResult    = 0xff // PtResult is packet type not stored/present in file (just for client command result)
+
+	PtPong       = 0xf9 // PtPong is packet type for the server answer to a ping (not stored in file)
+	PtCompressed = 0xfa // PtCompressed is packet type for data entry with compressed data (just streamed)
+
+	PtPrivateFirst = 0xe0 // PtPrivateFirst is the first packet type of the private range for custom frames
+	PtPrivateLast  = 0xef // PtPrivateLast is the last packet type of the private range for custom frames
+
+	EtBookmark = 0xb0 // EtBookmark is entry type for bookmarks
+)
+
+// Packet sizes
+const (
+	HeaderSize           = 38 // HeaderSize is the size in bytes of a header entry
+	HeaderSizeBase       = 46 // HeaderSizeBase is the size in bytes of a header entry with a base entry (38+8)
+	FixedSizeFileEntry   = 17 // FixedSizeFileEntry is the fixed size in bytes for a data file entry (1+4+4+8)
+	FixedSizeResultEntry = 9  // FixedSizeResultEntry is the fixed size in bytes for a result entry (1+4+4)
+	FixedSizeTaggedFrame = 9  // FixedSizeTaggedFrame is the fixed size in bytes for a tagged frame prefix (1+8)
+	FixedSizeCustomFrame = 5  // FixedSizeCustomFrame is the fixed size in bytes for a custom frame prefix (1+4)
+)
+
+var (
+	// ErrInvalidHeader is returned when the binary header is invalid
+	ErrInvalidHeader = fmt.Errorf("invalid binary header info")
+	// ErrInvalidEntry is returned when the binary entry is invalid
+	ErrInvalidEntry = fmt.Errorf("invalid binary entry")
+	// ErrDecodingEntry is returned when there is an error decoding binary data entry
+	ErrDecodingEntry = fmt.Errorf("error decoding binary data entry")
+	// ErrInvalidResult is returned when the binary result entry is invalid
+	ErrInvalidResult = fmt.Errorf("invalid binary result entry")
+	// ErrDecodingResult is returned when there is an error decoding binary result entry
+	ErrDecodingResult = fmt.Errorf("error decoding binary result entry")
+	// ErrInvalidTaggedFrame is returned when a tagged frame has an invalid inner packet type
+	ErrInvalidTaggedFrame = fmt.Errorf("invalid tagged frame")
+	// ErrIncompletePacket is returned when the buffer doesn't contain the complete packet
+	ErrIncompletePacket = fmt.Errorf("incomplete packet")
+	// ErrUnknownPacketType is returned when the packet type is unknown
+	ErrUnknownPacketType = fmt.Errorf("unknown packet type")
+)
+
+// Header type for a header entry
+type Header struct {
+	PacketType   uint8  // 1:Header
+	Length       uint32 // Total length of header entry (38, or 46 with a base entry)
+	Version      uint8  // Stream file version
+	SystemID     uint64 // System identifier (e.g. ChainID)
+	StreamType   uint64 // 1:Sequencer
+	TotalLength  uint64 // Total bytes used in the file
+	TotalEntries uint64 // Total number of data entries (packet type PtData), including the base entry offset
+	BaseEntry    uint64 // Number of the first data entry (only encoded in a header of HeaderSizeBase length)
+}
+
+// Entry type for a data file entry
+type Entry struct {
+	PacketType uint8  // 2:Data entry, 0xfe:Data response
+	Length     uint32 // Total length of the entry (17 bytes + length(data))
+	Type       uint32 // 0xb0:Bookmark, 1:Event1, 2:Event2,...
+	Number     uint64 // Entry number (sequential starting with 0)
+	Data       []byte
+}
+
+// Result type for a result entry of a TCP command
+type Result struct {
+	PacketType uint8  // 0xff:Result
+	Length     uint32 // Total length of the result entry
+	ErrorNum   uint32 // Error code (0:OK)
+	ErrorStr   []byte
+}
+
+// Packet type for a packet sent by the server to the clients
+type Packet struct {
+	Type    uint8   // Packet type of the inner packet (PtHeader, PtData, PtDataRsp, PtResult, PtShutdown, PtReconnect)
+	Tag     uint64  // Tag of the frame (0 if not tagged)
+	Header  *Header // Header entry (PtHeader)
+	Entry   *Entry  // Data entry (PtData, PtDataRsp)
+	Result  *Result // Result entry (PtResult)
+	Payload []byte  // Payload of a custom frame (private packet types, not tagged)
+}
+
+// IsPrivatePacketType checks if a packet type is in the private range for custom frames
+func IsPrivatePacketType(pt uint8) bool {
+	return pt >= PtPrivateFirst && pt <= PtPrivateLast
+}
+
+// EncodeCustomFrame encodes a custom frame of a private packet type: packet type, total length and payload
+func EncodeCustomFrame(pt uint8, payload []byte) []byte {
+	be := make([]byte, 1, FixedSizeCustomFrame+len(payload))
+	be[0] = pt
+	be = binary.BigEndian.AppendUint32(be, uint32(FixedSizeCustomFrame+len(payload)))
+	return append(be, payload...)
+}
+
+// EncodeHeader encodes from a header entry type to binary bytes slice
+func EncodeHeader(e Header) []byte {
+	be := make([]byte, 1, HeaderSizeBase)
+	be[0] = e.PacketType
+	be = binary.BigEndian.AppendUint32(be, e.Length)
+	be = append(be, e.Version)
+	be = binary.BigEndian.AppendUint64(be, e.SystemID)
+	be = binary.BigEndian.AppendUint64(be, e.StreamType)
+	be = binary.BigEndian.AppendUint64(be, e.TotalLength)
+	be = binary.BigEndian.AppendUint64(be, e.TotalEntries)
+	if e.Length == HeaderSizeBase {
+		be = binary.BigEndian.AppendUint64(be, e.BaseEntry)
+	}
+	return be
+}
+
+// DecodeHeader decodes from binary bytes slice to a header entry type
+func DecodeHeader(b []byte) (Header, error) {
+	e := Header{}
+
+	if len(b) != HeaderSize && len(b) != HeaderSizeBase {
+		return e, ErrInvalidHeader
+	}
+
+	e.PacketType = b[0]
+	e.Length = binary.BigEndian.Uint32(b[1:5])
+	e.Version = b[5]
+	e.SystemID = binary.BigEndian.Uint64(b[6:14])
+	e.StreamType = binary.BigEndian.Uint64(b[14:22])
+	e.TotalLength = binary.BigEndian.Uint64(b[22:30])
+	e.TotalEntries = binary.BigEndian.Uint64(b[30:38])
+	if len(b) == HeaderSizeBase {
+		e.BaseEntry = binary.BigEndian.Uint64(b[38:46])
+	}
+
+	if e.Length != uint32(len(b)) {
+		return e, ErrInvalidHeader
+	}
+
+	return e, nil
+}
+
+// EncodeEntry encodes from a data file entry type to binary bytes
+func EncodeEntry(e Entry) []byte {
+	be := make([]byte, 1, FixedSizeFileEntry+len(e.Data))
+	be[0] = e.PacketType
+	be = binary.BigEndian.AppendUint32(be, e.Length)
+	be = binary.BigEndian.AppendUint32(be, e.Type)
+	be = binary.BigEndian.AppendUint64(be, e.Number)
+	be = append(be, e.Data...)
+	return be
+}
+
+// DecodeEntry decodes from binary bytes slice to a data file entry type
+func DecodeEntry(b []byte) (Entry, error) {
+	d := Entry{}
+
+	if len(b) < FixedSizeFileEntry {
+		return d, ErrInvalidEntry
+	}
+
+	d.PacketType = b[0]
+	d.Length = binary.BigEndian.Uint32(b[1:5])
+	d.Type = binary.BigEndian.Uint32(b[5:9])
+	d.Number = binary.BigEndian.Uint64(b[9:17])
+	d.Data = b[17:]
+
+	if uint32(len(d.Data)) != d.Length-FixedSizeFileEntry {
+		return d, ErrDecodingEntry
+	}
+
+	return d, nil
+}
+
+// EncodeResult encodes from a result entry type to binary bytes slice
+func EncodeResult(e Result) []byte {
+	be := make([]byte, 1, FixedSizeResultEntry+len(e.ErrorStr))
+	be[0] = e.PacketType
+	be = binary.BigEndian.AppendUint32(be, e.Length)
+	be = binary.BigEndian.AppendUint32(be, e.ErrorNum)
+	be = append(be, e.ErrorStr...)
+	return be
+}
+
+// DecodeResult decodes from binary bytes slice to a result entry type
+func DecodeResult(b []byte) (Result, error) {
+	e := Result{}
+
+	if len(b) < FixedSizeResultEntry {
+		return e, ErrInvalidResult
+	}
+
+	e.PacketType = b[0]
+	e.Length = binary.BigEndian.Uint32(b[1:5])
+	e.ErrorNum = binary.BigEndian.Uint32(b[5:9])
+	e.ErrorStr = b[9:]
+
+	if uint32(len(e.ErrorStr)) != e.Length-FixedSizeResultEntry {
+		return e, ErrDecodingResult
+	}
+
+	return e, nil
+}
+
+// EncodeTaggedFrame encodes a packet in a frame tagged with a subscription/request ID
+func EncodeTaggedFrame(tag uint64, data []byte) []byte {
+	be := make([]byte, 1, FixedSizeTaggedFrame+len(data))
+	be[0] = PtTagged
+	be = binary.BigEndian.AppendUint64(be, tag)
+	be = append(be, data...)
+	return be
+}
+
+// DecodePacket decodes the first packet sent by the server in a buffer, unwrapping it if it's a tagged frame.
+// Returns the packet and its size in the buffer, or ErrIncompletePacket if the buffer doesn't contain it yet
+func DecodePacket(b []byte) (Packet, int, error) {
+	p := Packet{}
+	offset := 0
+
+	if len(b) < 1 {
+		return p, 0, ErrIncompletePacket
+	}
+	if b[0] == PtTagged {
+		if len(b) < FixedSizeTaggedFrame+1 {
+			return p, 0, ErrIncompletePacket
+		}
+		p.Tag = binary.BigEndian.Uint64(b[1:FixedSizeTaggedFrame])
+		offset = FixedSizeTaggedFrame
+		switch b[offset] {
+		case PtHeader, PtData, PtDataRsp, PtResult:
+		default:
+			return p, 0, ErrInvalidTaggedFrame
+		}
+	}
+	p.Type = b[offset]
+
+	// Size of the packet
+	var size int
+	switch {
+	case p.Type == PtShutdown || p.Type == PtReconnect:
+		size = 1
+	case p.Type == PtHeader || p.Type == PtData || p.Type == PtDataRsp || p.Type == PtResult ||
+		(IsPrivatePacketType(p.Type) && offset == 0):
+		if len(b) < offset+5 { //nolint:mnd
+			return p, 0, ErrIncompletePacket
+		}
+		size = int(binary.BigEndian.Uint32(b[offset+1 : offset+5]))
+	default:
+		return p, 0, ErrUnknownPacketType
+	}
+	if len(b) < offset+size {
+		return p, 0, ErrIncompletePacket
+	}
+	packet := b[offset : offset+size]
+
+	// Decode the packet
+	var err error
+	switch p.Type {
+	case PtHeader:
+		var header Header
+		header, err = DecodeHeader(packet)
+		p.Header = &header
+	case PtData, PtDataRsp:
+		var entry Entry
+		entry, err = DecodeEntry(packet)
+		p.Entry = &entry
+	case PtResult:
+		var result Result
+		result, err = DecodeResult(packet)
+		p.Result = &result
+	case PtShutdown, PtReconnect:
+	default:
+		if size < FixedSizeCustomFrame {
+			return p, 0, ErrIncompletePacket
+		}
+		p.Payload = packet[FixedSizeCustomFrame:]
+	}
+	if err != nil {
+		return p, 0, err
+	}
+	return p, offset + size, nil
+}
@@ -0,0 +1,99 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	// Case: Data entry -> OK
+	entry := Entry{PacketType: PtData, Length: FixedSizeFileEntry + 3, Type: EtBookmark, Number: 5, Data: []byte{1, 2, 3}}
+	decodedEntry, err := DecodeEntry(EncodeEntry(entry))
+	require.NoError(t, err)
+	assert.Equal(t, entry, decodedEntry)
+
+	// Case: Header entry -> OK
+	header := Header{PacketType: PtHeader, Length: HeaderSize, Version: 1, SystemID: 137, StreamType: 1,
+		TotalLength: 4096 + 20, TotalEntries: 1}
+	decodedHeader, err := DecodeHeader(EncodeHeader(header))
+	require.NoError(t, err)
+	assert.Equal(t, header, decodedHeader)
+
+	// Case: Header entry with base entry -> OK
+	header = Header{PacketType: PtHeader, Length: HeaderSizeBase, Version: 1, SystemID: 137, StreamType: 1,
+		TotalLength: 4096 + 20, TotalEntries: 1001, BaseEntry: 1000}
+	encodedHeader := EncodeHeader(header)
+	assert.Len(t, encodedHeader, HeaderSizeBase)
+	decodedHeader, err = DecodeHeader(encodedHeader)
+	require.NoError(t, err)
+	assert.Equal(t, header, decodedHeader)
+	p, size, err := DecodePacket(encodedHeader)
+	require.NoError(t, err)
+	assert.Equal(t, HeaderSizeBase, size)
+	assert.Equal(t, header, *p.Header)
+
+	// Case: Result entry -> OK
+	result := Result{PacketType: PtResult, Length: FixedSizeResultEntry + 2, ErrorNum: 0, ErrorStr: []byte("OK")}
+	decodedResult, err := DecodeResult(EncodeResult(result))
+	require.NoError(t, err)
+	assert.Equal(t, result, decodedResult)
+
+	// Case: Length mismatch -> FAIL
+	entry.Length++
+	_, err = DecodeEntry(EncodeEntry(entry))
+	assert.ErrorIs(t, err, ErrDecodingEntry)
+	_, err = DecodeHeader([]byte{PtHeader})
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+	header.Length = HeaderSize
+	_, err = DecodeHeader(append(EncodeHeader(header), 0, 0, 0, 0, 0, 0, 0, 0))
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestDecodePacket(t *testing.T) {
+	entry := Entry{PacketType: PtData, Length: FixedSizeFileEntry + 1, Type: 1, Number: 9, Data: []byte{7}}
+	result := Result{PacketType: PtResult, Length: FixedSizeResultEntry, ErrorNum: 4}
+	buffer := append(EncodeTaggedFrame(3, EncodeEntry(entry)), EncodeResult(result)...)
+	buffer = append(buffer, PtShutdown, PtReconnect)
+
+	// Case: Tagged data entry, result, shutdown and reconnect in a buffer -> OK
+	p, size, err := DecodePacket(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), p.Tag)
+	assert.Equal(t, uint8(PtData), p.Type)
+	assert.Equal(t, entry, *p.Entry)
+	buffer = buffer[size:]
+
+	p, size, err = DecodePacket(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(PtResult), p.Type)
+	assert.Equal(t, uint32(4), p.Result.ErrorNum)
+	buffer = buffer[size:]
+
+	p, size, err = DecodePacket(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(PtShutdown), p.Type)
+	assert.Equal(t, 1, size)
+	buffer = buffer[size:]
+
+	p, size, err = DecodePacket(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(PtReconnect), p.Type)
+	assert.Equal(t, 1, size)
+
+	// Case: Custom frame of a private packet type -> OK
+	p, size, err = DecodePacket(EncodeCustomFrame(PtPrivateFirst, []byte{8, 9}))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(PtPrivateFirst), p.Type)
+	assert.Equal(t, []byte{8, 9}, p.Payload)
+	assert.Equal(t, FixedSizeCustomFrame+2, size)
+
+	// Case: Incomplete packet -> FAIL
+	_, _, err = DecodePacket(EncodeEntry(entry)[:FixedSizeFileEntry])
+	assert.ErrorIs(t, err, ErrIncompletePacket)
+
+	// Case: Invalid tagged frame -> FAIL
+	_, _, err = DecodePacket(EncodeTaggedFrame(3, []byte{PtShutdown}))
+	assert.ErrorIs(t, err, ErrInvalidTaggedFrame)
+}
@@ -0,0 +1,118 @@
+//go:build js && wasm
+
+// Package main builds the decoding layer of the data stream for the browser:
+//
+//	GOOS=js GOARCH=wasm go build -o datastream.wasm ./datastreamer/codec/wasm
+//
+// It registers the JS functions dsDecodePacket(bytes) and dsDecodeSequencerEntry(type, bytes).
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastream"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func main() {
+	js.Global().Set("dsDecodePacket", js.FuncOf(decodePacket))
+	js.Global().Set("dsDecodeSequencerEntry", js.FuncOf(decodeSequencerEntry))
+	select {}
+}
+
+// decodePacket decodes the first packet of a Uint8Array, returns {type, tag, size, header|entry|result} or {error}
+func decodePacket(this js.Value, args []js.Value) any {
+	if len(args) != 1 {
+		return errorResult("expected (bytes)")
+	}
+	p, size, err := codec.DecodePacket(bytesFromJS(args[0]))
+	if err != nil {
+		return errorResult(err.Error())
+	}
+
+	result := map[string]any{
+		"type": int(p.Type),
+		"tag":  float64(p.Tag),
+		"size": size,
+	}
+	switch {
+	case p.Header != nil:
+		result["header"] = map[string]any{
+			"version":      int(p.Header.Version),
+			"systemID":     float64(p.Header.SystemID),
+			"streamType":   float64(p.Header.StreamType),
+			"totalLength":  float64(p.Header.TotalLength),
+			"totalEntries": float64(p.Header.TotalEntries),
+		}
+	case p.Entry != nil:
+		result["entry"] = map[string]any{
+			"type":   int(p.Entry.Type),
+			"number": float64(p.Entry.Number),
+			"data":   bytesToJS(p.Entry.Data),
+		}
+	case p.Result != nil:
+		result["result"] = map[string]any{
+			"errorNum": int(p.Result.ErrorNum),
+			"errorStr": string(p.Result.ErrorStr),
+		}
+	}
+	return result
+}
+
+// decodeSequencerEntry decodes the data of a sequencer stream entry of a type, returns its JSON string or {error}
+func decodeSequencerEntry(this js.Value, args []js.Value) any {
+	if len(args) != 2 { //nolint:mnd
+		return errorResult("expected (type, bytes)")
+	}
+
+	var msg proto.Message
+	switch entryType := args[0].Int(); entryType {
+	case int(datastream.EntryType_ENTRY_TYPE_BATCH_START):
+		msg = &datastream.BatchStart{}
+	case int(datastream.EntryType_ENTRY_TYPE_L2_BLOCK):
+		msg = &datastream.L2Block{}
+	case int(datastream.EntryType_ENTRY_TYPE_TRANSACTION):
+		msg = &datastream.Transaction{}
+	case int(datastream.EntryType_ENTRY_TYPE_BATCH_END):
+		msg = &datastream.BatchEnd{}
+	case int(datastream.EntryType_ENTRY_TYPE_UPDATE_GER):
+		msg = &datastream.UpdateGER{}
+	case int(datastream.EntryType_ENTRY_TYPE_L2_BLOCK_END):
+		msg = &datastream.L2BlockEnd{}
+	case codec.EtBookmark:
+		msg = &datastream.BookMark{}
+	default:
+		return errorResult("unknown entry type")
+	}
+
+	err := proto.Unmarshal(bytesFromJS(args[1]), msg)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	return string(data)
+}
+
+// bytesFromJS copies a JS Uint8Array to a Go byte slice
+func bytesFromJS(v js.Value) []byte {
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b
+}
+
+// bytesToJS copies a Go byte slice to a new JS Uint8Array
+func bytesToJS(b []byte) js.Value {
+	v := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(v, b)
+	return v
+}
+
+// errorResult returns an error object to JS
+func errorResult(msg string) any {
+	return map[string]any{"error": msg}
+}
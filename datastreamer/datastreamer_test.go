@@ -1,12 +1,23 @@
 package datastreamer_test
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -196,6 +207,44 @@ func deleteFiles() error {
 	return nil
 }
 
+// freePort returns a free TCP port of the local host to listen on
+func freePort(t *testing.T) uint16 {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// newTestServer creates a server of the test stream on a free port, with its file in the test temporary directory.
+// Returns the server not started and its port
+func newTestServer(t *testing.T, name string) (*datastreamer.StreamServer, uint16) {
+	port := freePort(t)
+	return openTestServer(t, port, t.TempDir()+"/"+name), port
+}
+
+// openTestServer creates a server of the test stream on the port with the stream file, e.g. to restart on the same
+// port the one created with newTestServer. The server is shut down and closed once the test ends
+func openTestServer(t *testing.T, port uint16, fileName string) *datastreamer.StreamServer {
+	server, err := datastreamer.NewServer(port, 1, 137, streamType, fileName, config.WriteTimeout, 0, 5*time.Second,
+		nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Shutdown(0)
+		_ = server.Close()
+	})
+	return server
+}
+
+// addTestEntries adds the test entry 1 count times to the server in an atomic operation
+func addTestEntries(t *testing.T, server *datastreamer.StreamServer, count int) {
+	require.NoError(t, server.StartAtomicOp())
+	for i := 0; i < count; i++ {
+		_, err := server.AddStreamEntry(entryType1, testEntries[1].Encode())
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.CommitAtomicOp())
+}
+
 func TestServer(t *testing.T) {
 	err := deleteFiles()
 	if err != nil {
@@ -531,6 +580,15 @@ func TestClient(t *testing.T) {
 	err = client.ExecCommandStartBookmark(fromBookmark)
 	require.NoError(t, err)
 
+	// Case: Query entry data with streaming started, over the command channel -> OK
+	entry, err = client.ExecCommandGetEntry(2)
+	require.NoError(t, err)
+	require.Equal(t, testEntries[2], TestEntry{}.Decode(entry.Data))
+
+	// Case: Query header info with streaming started, over the command channel -> OK
+	_, err = client.ExecCommandGetHeader()
+	require.NoError(t, err)
+
 	// Case: Query entry data with streaming started -> FAIL
 	// client.FromEntry = 2
 	// err = client.ExecCommand(datastreamer.CmdEntry)
@@ -551,3 +609,955 @@ func TestClient(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, testEntries[2], TestEntry{}.Decode(entry.Data))
 }
+
+func TestClientSubscriptions(t *testing.T) {
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+	require.NoError(t, err)
+
+	err = client.Start()
+	require.NoError(t, err)
+
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	lastEntry := header.TotalEntries - 1
+
+	// Collect entries of each subscription until the last one
+	collect := func(done chan []uint64) datastreamer.ProcessEntryFunc {
+		var received []uint64
+		return func(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
+			received = append(received, e.Number)
+			if e.Number == lastEntry {
+				done <- received
+			}
+			return nil
+		}
+	}
+
+	// Case: Subscribe from entry and from bookmark over the same connection -> OK
+	done1 := make(chan []uint64, 2)
+	sub1, err := client.Subscribe(lastEntry-2, collect(done1))
+	require.NoError(t, err)
+
+	done2 := make(chan []uint64, 2)
+	sub2, err := client.SubscribeBookmark(testBookmark.Encode(), collect(done2))
+	require.NoError(t, err)
+	require.NotEqual(t, sub1.ID, sub2.ID)
+
+	select {
+	case received := <-done1:
+		require.Equal(t, []uint64{lastEntry - 2, lastEntry - 1, lastEntry}, received)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for subscription 1 entries")
+	}
+
+	select {
+	case received := <-done2:
+		require.Len(t, received, int(header.TotalEntries))
+		require.Equal(t, uint64(0), received[0])
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for subscription 2 entries")
+	}
+
+	// Case: Query entry data while subscriptions are streaming -> OK
+	entry, err := client.ExecCommandGetEntry(2)
+	require.NoError(t, err)
+	require.Equal(t, testEntries[2], TestEntry{}.Decode(entry.Data))
+
+	// Case: Subscriptions receive the new committed entries -> OK
+	err = streamServer.StartAtomicOp()
+	require.NoError(t, err)
+	lastEntry, err = streamServer.AddStreamEntry(entryType1, testEntries[1].Encode())
+	require.NoError(t, err)
+	err = streamServer.CommitAtomicOp()
+	require.NoError(t, err)
+
+	for _, done := range []chan []uint64{done1, done2} {
+		select {
+		case received := <-done:
+			require.Equal(t, lastEntry, received[len(received)-1])
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for subscription live entries")
+		}
+	}
+
+	// Case: Unsubscribe -> OK
+	err = sub1.Unsubscribe()
+	require.NoError(t, err)
+	err = sub2.Unsubscribe()
+	require.NoError(t, err)
+
+	// Case: Unsubscribe an already stopped subscription -> FAIL
+	err = sub1.Unsubscribe()
+	require.EqualError(t, datastreamer.ErrSubscriptionNotFound, err.Error())
+
+	// Case: Subscribe over the maximum number of subscriptions (32) per connection -> FAIL
+	subs := make([]*datastreamer.Subscription, 0, 32)
+	for i := 0; i < 32; i++ {
+		sub, err := client.Subscribe(lastEntry+1, nil)
+		require.NoError(t, err)
+		subs = append(subs, sub)
+	}
+	_, err = client.Subscribe(lastEntry+1, nil)
+	require.EqualError(t, datastreamer.ErrMaxSubscriptions, err.Error())
+	for _, sub := range subs {
+		err = sub.Unsubscribe()
+		require.NoError(t, err)
+	}
+
+	// Case: Subscription callback error doesn't stall the other subscriptions and commands -> OK
+	err = streamServer.StartAtomicOp()
+	require.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		lastEntry, err = streamServer.AddStreamEntry(entryType1, testEntries[1].Encode())
+		require.NoError(t, err)
+	}
+	err = streamServer.CommitAtomicOp()
+	require.NoError(t, err)
+
+	errCallback := errors.New("callback error")
+	failing, err := client.Subscribe(0, func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		return errCallback
+	})
+	require.NoError(t, err)
+
+	done3 := make(chan []uint64, 2)
+	sub3, err := client.Subscribe(0, collect(done3))
+	require.NoError(t, err)
+
+	select {
+	case <-failing.Done():
+		require.Equal(t, errCallback, failing.Err())
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for failing subscription end")
+	}
+
+	select {
+	case received := <-done3:
+		require.Len(t, received, int(lastEntry+1))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for subscription 3 entries")
+	}
+
+	entry, err = client.ExecCommandGetEntry(2)
+	require.NoError(t, err)
+	require.Equal(t, testEntries[2], TestEntry{}.Decode(entry.Data))
+
+	err = failing.Unsubscribe()
+	require.EqualError(t, datastreamer.ErrSubscriptionNotFound, err.Error())
+	err = sub3.Unsubscribe()
+	require.NoError(t, err)
+}
+
+// testProxy forwards the connections to the server and allows to drop or freeze them
+type testProxy struct {
+	ln    net.Listener
+	conns []net.Conn
+	mutex sync.Mutex
+
+	accepted atomic.Uint64 // Connections accepted
+	frozen   atomic.Uint64 // Connections accepted before the latest freeze, discarding the data forwarded
+}
+
+func newTestProxy(t *testing.T, server string) *testProxy {
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	p := &testProxy{ln: ln}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			target, err := net.Dial("tcp", server)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			p.mutex.Lock()
+			p.conns = append(p.conns, conn, target)
+			p.mutex.Unlock()
+			id := p.accepted.Add(1)
+			go func() { p.forward(target, conn, id); target.Close() }()
+			go func() { p.forward(conn, target, id); conn.Close() }()
+		}
+	}()
+
+	t.Cleanup(func() {
+		ln.Close()
+		p.dropConnections()
+	})
+	return p
+}
+
+// forward copies the data of a connection to another until closed, discarding it once the connection is frozen
+func (p *testProxy) forward(dst net.Conn, src net.Conn, id uint64) {
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buffer)
+		if err != nil {
+			return
+		}
+		if id > p.frozen.Load() {
+			_, err = dst.Write(buffer[:n])
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// freezeConnections silently stops forwarding the open connections, like a TCP drop without reset
+func (p *testProxy) freezeConnections() {
+	p.frozen.Store(p.accepted.Load())
+}
+
+func (p *testProxy) dropConnections() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// newTestTunnelProxy starts a SOCKS5 (socks5) or HTTP CONNECT (http) proxy requiring the credentials, returns its
+// address
+func newTestTunnelProxy(t *testing.T, scheme string, user string, password string) string {
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	// tunnel returns the address requested through the proxy, answering the handshake ("" if rejected)
+	tunnel := func(conn net.Conn) string {
+		if scheme == "http" {
+			request, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil {
+				return ""
+			}
+			auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+			if request.Method != http.MethodConnect || request.Header.Get("Proxy-Authorization") != "Basic "+auth {
+				_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+				return ""
+			}
+			_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+			return request.Host
+		}
+
+		buffer := make([]byte, 512)
+		_, err := io.ReadFull(conn, buffer[:3])
+		if err != nil || !bytes.Equal(buffer[:3], []byte{5, 1, 2}) {
+			return ""
+		}
+		_, _ = conn.Write([]byte{5, 2})
+		_, err = io.ReadFull(conn, buffer[:2])
+		if err != nil {
+			return ""
+		}
+		credentials := make([]byte, int(buffer[1])+1)
+		_, err = io.ReadFull(conn, credentials)
+		if err != nil {
+			return ""
+		}
+		pass := make([]byte, credentials[len(credentials)-1])
+		_, err = io.ReadFull(conn, pass)
+		if err != nil || string(credentials[:len(credentials)-1]) != user || string(pass) != password {
+			_, _ = conn.Write([]byte{1, 1})
+			return ""
+		}
+		_, _ = conn.Write([]byte{1, 0})
+		_, err = io.ReadFull(conn, buffer[:5])
+		if err != nil || buffer[3] != 3 {
+			return ""
+		}
+		host := make([]byte, int(buffer[4])+2)
+		_, err = io.ReadFull(conn, host)
+		if err != nil {
+			return ""
+		}
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		port := binary.BigEndian.Uint16(host[len(host)-2:])
+		return net.JoinHostPort(string(host[:len(host)-2]), fmt.Sprint(port))
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				addr := tunnel(conn)
+				if addr == "" {
+					return
+				}
+				target, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+				go func() { _, _ = io.Copy(target, conn); target.Close() }()
+				_, _ = io.Copy(conn, target)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClientSubscriptionsReconnect(t *testing.T) {
+	proxy := newTestProxy(t, fmt.Sprintf("localhost:%d", config.Port))
+
+	client, err := datastreamer.NewClient(proxy.ln.Addr().String(), streamType)
+	require.NoError(t, err)
+
+	err = client.Start()
+	require.NoError(t, err)
+
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	lastEntry := header.TotalEntries - 1
+
+	received := make(chan uint64, 16)
+	sub, err := client.Subscribe(lastEntry, func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		received <- e.Number
+		return nil
+	})
+	require.NoError(t, err)
+
+	waitEntry := func(expected uint64) {
+		select {
+		case number := <-received:
+			require.Equal(t, expected, number)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for entry %d", expected)
+		}
+	}
+	waitEntry(lastEntry)
+
+	// Case: Subscription restored after reconnection from the next entry -> OK
+	proxy.dropConnections()
+
+	err = streamServer.StartAtomicOp()
+	require.NoError(t, err)
+	newEntry, err := streamServer.AddStreamEntry(entryType1, testEntries[1].Encode())
+	require.NoError(t, err)
+	err = streamServer.CommitAtomicOp()
+	require.NoError(t, err)
+
+	waitEntry(newEntry)
+	select {
+	case number := <-received:
+		t.Fatalf("unexpected entry %d received", number)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = sub.Unsubscribe()
+	require.NoError(t, err)
+}
+
+func TestClientHeartbeat(t *testing.T) {
+	proxy := newTestProxy(t, fmt.Sprintf("localhost:%d", config.Port))
+
+	received := make(chan uint64, 16)
+	client, err := datastreamer.NewClient(proxy.ln.Addr().String(), streamType)
+	require.NoError(t, err)
+	client.SetHeartbeat(100*time.Millisecond, 300*time.Millisecond)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		received <- e.Number
+		return nil
+	})
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.NoError(t, client.ExecCommandStart(header.TotalEntries))
+
+	addEntry := func() {
+		require.NoError(t, streamServer.StartAtomicOp())
+		entryNum, err := streamServer.AddStreamEntry(entryType1, testEntries[1].Encode())
+		require.NoError(t, err)
+		require.NoError(t, streamServer.CommitAtomicOp())
+		select {
+		case number := <-received:
+			require.Equal(t, entryNum, number)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for entry %d", entryNum)
+		}
+	}
+
+	// Case: Idle connection -> Pings answered, connection kept
+	time.Sleep(600 * time.Millisecond)
+	stats := client.GetStats()
+	require.Zero(t, stats.Errors[datastreamer.StatErrHeartbeat])
+	require.Zero(t, stats.ReconnectCount)
+	addEntry()
+
+	// Case: Connection silently dropped -> Heartbeat timeout, reconnected resuming the streaming
+	proxy.freezeConnections()
+	require.Eventually(t, func() bool {
+		return client.GetStats().Errors[datastreamer.StatErrHeartbeat] > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	addEntry()
+}
+
+func TestClientLifecycleHooks(t *testing.T) {
+	proxy := newTestProxy(t, fmt.Sprintf("localhost:%d", config.Port))
+
+	type lifecycleEvent struct {
+		hook  string
+		event datastreamer.ConnectionEvent
+	}
+	events := make(chan lifecycleEvent, 16)
+	client, err := datastreamer.NewClient(proxy.ln.Addr().String(), streamType)
+	require.NoError(t, err)
+	client.SetReconnectPolicy(datastreamer.ReconnectPolicy{Backoff: 50 * time.Millisecond})
+	client.SetOnConnect(func(e datastreamer.ConnectionEvent) {
+		events <- lifecycleEvent{hook: "connect", event: e}
+	})
+	client.SetOnDisconnect(func(e datastreamer.ConnectionEvent) {
+		events <- lifecycleEvent{hook: "disconnect", event: e}
+	})
+	headerErr := make(chan error, 1)
+	client.SetOnReconnectResumed(func(e datastreamer.ConnectionEvent) {
+		events <- lifecycleEvent{hook: "resumed", event: e}
+		_, err := client.ExecCommandGetHeader()
+		headerErr <- err
+	})
+	next := func(hook string) datastreamer.ConnectionEvent {
+		select {
+		case e := <-events:
+			require.Equal(t, hook, e.hook)
+			return e.event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for the %s hook", hook)
+		}
+		return datastreamer.ConnectionEvent{}
+	}
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+
+	// Case: Client started -> OnConnect of the first connection
+	e := next("connect")
+	require.False(t, e.Reconnect)
+	require.Equal(t, proxy.ln.Addr().String(), e.Server)
+
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.NoError(t, client.ExecCommandStart(header.TotalEntries))
+
+	// Case: Connection dropped -> OnDisconnect with its error, OnConnect and OnReconnectResumed of the reconnection
+	proxy.dropConnections()
+	e = next("disconnect")
+	require.Error(t, e.Err)
+	e = next("connect")
+	require.True(t, e.Reconnect)
+	e = next("resumed")
+	require.True(t, e.Streaming)
+	require.Equal(t, header.TotalEntries, e.NextEntry)
+
+	// Case: Command executed by a hook -> OK
+	select {
+	case err = <-headerErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the header command of the hook")
+	}
+}
+
+func TestClientConcurrentCommands(t *testing.T) {
+	proxy := newTestProxy(t, fmt.Sprintf("localhost:%d", config.Port))
+
+	client, err := datastreamer.NewClient(proxy.ln.Addr().String(), streamType)
+	require.NoError(t, err)
+	client.SetReconnectPolicy(datastreamer.ReconnectPolicy{Backoff: 50 * time.Millisecond})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		return nil
+	})
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+
+	// Case: Streaming and query commands from several goroutines -> Each command gets its own result (the entries
+	// OK, the starts and the stops OK or failing if started or stopped by another goroutine)
+	var wg sync.WaitGroup
+	errs := make(chan error, 6*20)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				var err error
+				switch {
+				case i < 2 && j%2 == 0:
+					err = client.ExecCommandStart(header.TotalEntries)
+					if errors.Is(err, datastreamer.ErrResultCommandError) {
+						err = nil
+					}
+				case i < 3:
+					err = client.ExecCommandStop()
+					if errors.Is(err, datastreamer.ErrResultCommandError) {
+						err = nil
+					}
+				default:
+					number := uint64(j) % header.TotalEntries
+					var entry datastreamer.FileEntry
+					entry, err = client.ExecCommandGetEntry(number)
+					if err == nil && entry.Number != number {
+						err = fmt.Errorf("entry %d received, expected %d", entry.Number, number)
+					}
+				}
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.False(t, client.GetStats().Streaming)
+
+	// Case: Connection lost waiting for a command result -> ErrConnectionLost, the next commands OK reconnected
+	proxy.freezeConnections()
+	result := make(chan error, 1)
+	go func() {
+		result <- client.ExecCommandStart(header.TotalEntries)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	proxy.dropConnections()
+	select {
+	case err = <-result:
+		require.ErrorIs(t, err, datastreamer.ErrConnectionLost)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the result of the command")
+	}
+	require.Eventually(t, func() bool {
+		return client.ExecCommandStart(header.TotalEntries) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	require.NoError(t, client.ExecCommandStop())
+}
+
+func TestClientMultiplexed(t *testing.T) {
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+	require.NoError(t, err)
+	client.SetMultiplexed(true)
+
+	err = client.Start()
+	require.NoError(t, err)
+
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	lastEntry := header.TotalEntries - 1
+
+	done := make(chan uint64, 1)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		if e.Number == lastEntry {
+			done <- e.Number
+		}
+		return nil
+	})
+
+	// Case: Start sync from existing entry -> OK
+	err = client.ExecCommandStart(lastEntry - 1)
+	require.NoError(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for streaming entries")
+	}
+
+	// Case: Query header info with streaming started -> OK
+	header, err = client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, lastEntry+1, header.TotalEntries)
+
+	// Case: Query entry data with streaming started -> OK
+	entry, err := client.ExecCommandGetEntry(2)
+	require.NoError(t, err)
+	require.Equal(t, testEntries[2], TestEntry{}.Decode(entry.Data))
+
+	// Case: Query bookmark data with streaming started -> OK
+	_, err = client.ExecCommandGetBookmark(testBookmark.Encode())
+	require.NoError(t, err)
+
+	// Case: Stop receiving streaming -> OK
+	err = client.ExecCommandStop()
+	require.NoError(t, err)
+}
+
+func TestClientPipelined(t *testing.T) {
+	for _, multiplexed := range []bool{false, true} {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+		require.NoError(t, err)
+		client.SetMultiplexed(multiplexed)
+
+		err = client.Start()
+		require.NoError(t, err)
+
+		header, err := client.ExecCommandGetHeader()
+		require.NoError(t, err)
+
+		// Case: Get entries concurrently, each one receives its own entry -> OK
+		var wg sync.WaitGroup
+		errs := make(chan error, 64)
+		for i := 0; i < 64; i++ {
+			wg.Add(1)
+			go func(number uint64) {
+				defer wg.Done()
+				entry, err := client.ExecCommandGetEntry(number)
+				if err == nil && entry.Number != number {
+					err = fmt.Errorf("entry %d received for entry %d", entry.Number, number)
+				}
+				errs <- err
+			}(uint64(i) % header.TotalEntries)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		// Case: Get non-existent entry concurrently with existing ones -> ERROR only for the non-existent
+		_, err = client.ExecCommandGetEntry(header.TotalEntries + 100)
+		require.EqualError(t, datastreamer.ErrEntryNotFound, err.Error())
+		_, err = client.ExecCommandGetEntry(0)
+		require.NoError(t, err)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+	require.NoError(t, err)
+	statsFile := t.TempDir() + "/client_stats.json"
+	client.SetStatsFile(statsFile, 50*time.Millisecond)
+
+	err = client.Start()
+	require.NoError(t, err)
+
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	lastEntry := header.TotalEntries - 1
+
+	done := make(chan struct{}, 1)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		if e.Number == lastEntry {
+			done <- struct{}{}
+		}
+		return nil
+	})
+
+	// Case: Stop command without streaming counted as command error -> OK
+	err = client.ExecCommandStop()
+	require.EqualError(t, datastreamer.ErrResultCommandError, err.Error())
+
+	err = client.ExecCommandStart(lastEntry - 1)
+	require.NoError(t, err)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for streaming entries")
+	}
+
+	// Case: Stats file dumped with the position and the error counts -> OK
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(statsFile)
+		if err != nil {
+			return false
+		}
+		stats := datastreamer.ClientStats{}
+		require.NoError(t, json.Unmarshal(data, &stats))
+		return stats.Connected && stats.Streaming && stats.LastEntry == lastEntry
+	}, 5*time.Second, 50*time.Millisecond)
+
+	stats := client.GetStats()
+	require.Equal(t, uint64(0), stats.Lag)
+	require.Equal(t, uint64(1), stats.Errors[datastreamer.StatErrCommand])
+	require.Empty(t, stats.Reconnects)
+
+	// Case: Throughput and processing counters of the entries streamed -> OK
+	require.Equal(t, uint64(2), stats.EntriesReceived)
+	require.NotZero(t, stats.BytesReceived)
+	require.Equal(t, uint64(2), stats.Processed)
+	require.GreaterOrEqual(t, stats.MaxProcessLatencyMs, stats.ProcessLatencyMs)
+	require.Equal(t, uint64(0), stats.ReconnectCount)
+
+	// Case: Entries received all delivered -> None dropped nor reprocessed
+	require.Equal(t, uint64(2), stats.Delivered)
+	require.Empty(t, stats.Dropped)
+	require.Zero(t, stats.Reprocessed)
+
+	// Case: Client metrics served in the Prometheus text format -> OK
+	recorder := httptest.NewRecorder()
+	client.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	metrics := recorder.Body.String()
+	labels := fmt.Sprintf("{id=%q,server=%q}", client.ID, stats.Server)
+	require.Contains(t, metrics, "# TYPE datastreamer_client_entries_received_total counter\n")
+	require.Contains(t, metrics, "datastreamer_client_entries_received_total"+labels+" 2\n")
+	require.Contains(t, metrics, "datastreamer_client_processed_total"+labels+" 2\n")
+	require.Contains(t, metrics, "datastreamer_client_delivered_total"+labels+" 2\n")
+	require.Contains(t, metrics, "datastreamer_client_connected"+labels+" 1\n")
+	require.Contains(t, metrics, fmt.Sprintf("datastreamer_client_last_entry%s %d\n", labels, lastEntry))
+	require.Contains(t, metrics, fmt.Sprintf("datastreamer_client_errors_total{id=%q,server=%q,kind=%q} 1\n",
+		client.ID, stats.Server, datastreamer.StatErrCommand))
+
+	// Case: Get server stats while streaming -> OK
+	serverStats, err := client.ExecCommandGetStats()
+	require.NoError(t, err)
+	require.Equal(t, header.TotalEntries, serverStats.TotalEntries)
+	require.Equal(t, streamType, serverStats.StreamType)
+	require.NotEmpty(t, serverStats.Clients)
+	require.Empty(t, serverStats.Logs)
+
+	// Case: Get server stats with the log ring buffer set -> Recent logs included
+	log.SetRingBuffer(100)
+	defer log.SetRingBuffer(0)
+	log.Warnf("Client stats test warning")
+	serverStats, err = client.ExecCommandGetStats()
+	require.NoError(t, err)
+	require.NotEmpty(t, serverStats.Logs)
+	require.Equal(t, "Client stats test warning", serverStats.Logs[0].Message)
+
+	err = client.ExecCommandStop()
+	require.NoError(t, err)
+}
+
+func TestServerRequestIDs(t *testing.T) {
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", config.Port))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	readFrame := func(requestID uint64, packetType uint8, length int) {
+		buffer := make([]byte, datastreamer.FixedSizeTaggedFrame+1+length)
+		_, err := io.ReadFull(conn, buffer)
+		require.NoError(t, err)
+		require.Equal(t, uint8(datastreamer.PtTagged), buffer[0])
+		require.Equal(t, requestID, binary.BigEndian.Uint64(buffer[1:]))
+		require.Equal(t, packetType, buffer[datastreamer.FixedSizeTaggedFrame])
+	}
+
+	// Case: Header commands pipelined, responses tagged with their request IDs -> OK
+	command := make([]byte, 0, 48)
+	for _, requestID := range []uint64{7, 8} {
+		command = binary.BigEndian.AppendUint64(command, uint64(datastreamer.CmdHeader|datastreamer.CmdFlagTagged))
+		command = binary.BigEndian.AppendUint64(command, uint64(streamType))
+		command = binary.BigEndian.AppendUint64(command, requestID)
+	}
+	_, err = conn.Write(command)
+	require.NoError(t, err)
+
+	for _, requestID := range []uint64{7, 8} {
+		readFrame(requestID, datastreamer.PtResult, 4+4+len("OK"))
+		readFrame(requestID, datastreamer.PtHeader, 4)
+		_, err = io.ReadFull(conn, make([]byte, 38-1-4))
+		require.NoError(t, err)
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	// Case: Context canceled -> client stopped, subscriptions ended with the reason
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	sub, err := client.Subscribe(0, func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- client.Run(ctx)
+	}()
+	cancel()
+	select {
+	case err = <-result:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the client to stop")
+	}
+	select {
+	case <-sub.Done():
+		require.ErrorIs(t, sub.Err(), context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the subscription to end")
+	}
+	require.Eventually(t, func() bool {
+		return !client.GetStats().Connected
+	}, time.Second, 10*time.Millisecond)
+
+	// Case: Run or start a stopped client -> FAIL
+	require.ErrorIs(t, client.Run(context.Background()), datastreamer.ErrClientStopped)
+	require.ErrorIs(t, client.Start(), datastreamer.ErrClientStopped)
+
+	// Case: Process entry function error -> returned as the stop reason
+	errProcess := errors.New("process error")
+	client, err = datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+	require.NoError(t, err)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		return errProcess
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	require.ErrorIs(t, client.Run(context.Background()), errProcess)
+}
+
+func TestClientProcessErrorPolicy(t *testing.T) {
+	errProcess := errors.New("process error")
+	startClient := func(policy datastreamer.ProcessErrorPolicy, fails int) (*datastreamer.StreamClient, uint64,
+		func() []uint64) {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+		require.NoError(t, err)
+		client.SetProcessErrorPolicy(policy, 10*time.Millisecond)
+		require.NoError(t, client.Start())
+		header, err := client.ExecCommandGetHeader()
+		require.NoError(t, err)
+		fromEntry := header.TotalEntries - 3
+
+		// The entry after the first one fails the given times
+		var mutex sync.Mutex
+		processed := []uint64{}
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if e.Number == fromEntry+1 && fails > 0 {
+				fails--
+				return errProcess
+			}
+			processed = append(processed, e.Number)
+			return nil
+		})
+		require.NoError(t, client.ExecCommandStart(fromEntry))
+		return client, fromEntry, func() []uint64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]uint64{}, processed...)
+		}
+	}
+
+	// Case: Skip policy -> failed entry skipped, error counted
+	client, fromEntry, processed := startClient(datastreamer.ProcessErrSkip, 1)
+	require.Eventually(t, func() bool {
+		return len(processed()) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []uint64{fromEntry, fromEntry + 2}, processed())
+	require.Equal(t, uint64(1), client.GetStats().Errors[datastreamer.StatErrProcess])
+	require.Eventually(t, func() bool {
+		return client.GetStats().Delivered == 2
+	}, time.Second, 10*time.Millisecond)
+	stats := client.GetStats()
+	require.Equal(t, map[string]uint64{datastreamer.StatDropSkipped: 1}, stats.Dropped)
+	require.Zero(t, stats.Reprocessed)
+
+	// Case: Restart policy -> failed entry processed again after the backoff
+	client, fromEntry, processed = startClient(datastreamer.ProcessErrRestart, 2)
+	require.Eventually(t, func() bool {
+		return len(processed()) == 3
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []uint64{fromEntry, fromEntry + 1, fromEntry + 2}, processed())
+	require.Equal(t, uint64(2), client.GetStats().Errors[datastreamer.StatErrProcess])
+	require.Eventually(t, func() bool {
+		return client.GetStats().Delivered == 3
+	}, time.Second, 10*time.Millisecond)
+	stats = client.GetStats()
+	require.Empty(t, stats.Dropped)
+	require.Equal(t, uint64(2), stats.Reprocessed)
+
+	// Case: Stop policy -> streaming stopped, OnFatal hook called and error returned by Run
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+	require.NoError(t, err)
+	fatal := make(chan error, 1)
+	client.SetOnFatal(func(err error) {
+		fatal <- err
+	})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		return errProcess
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	require.ErrorIs(t, client.Run(context.Background()), errProcess)
+	require.ErrorIs(t, <-fatal, errProcess)
+}
+
+func TestClientDeadLetter(t *testing.T) {
+	errProcess := errors.New("process error")
+	startClient := func(fails int, sink datastreamer.DeadLetterFunc) (*datastreamer.StreamClient, uint64,
+		func() []uint64) {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", config.Port), streamType)
+		require.NoError(t, err)
+		client.SetDeadLetter(2, 10*time.Millisecond, sink)
+		require.NoError(t, client.Start())
+		header, err := client.ExecCommandGetHeader()
+		require.NoError(t, err)
+		fromEntry := header.TotalEntries - 3
+
+		// The entry after the first one fails the given times
+		var mutex sync.Mutex
+		processed := []uint64{}
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if e.Number == fromEntry+1 && fails > 0 {
+				fails--
+				return errProcess
+			}
+			processed = append(processed, e.Number)
+			return nil
+		})
+		require.NoError(t, client.ExecCommandStart(fromEntry))
+		return client, fromEntry, func() []uint64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]uint64{}, processed...)
+		}
+	}
+	deadLetterFile := t.TempDir() + "/deadletter.json"
+
+	// Case: Entry processed in a retry -> Not quarantined
+	client, fromEntry, processed := startClient(2, datastreamer.NewDeadLetterFile(deadLetterFile))
+	require.Eventually(t, func() bool {
+		return len(processed()) == 3
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []uint64{fromEntry, fromEntry + 1, fromEntry + 2}, processed())
+	require.NoFileExists(t, deadLetterFile)
+
+	// Case: Entry failed after the retries -> Quarantined to the dead-letter file and skipped
+	client, fromEntry, processed = startClient(3, datastreamer.NewDeadLetterFile(deadLetterFile))
+	require.Eventually(t, func() bool {
+		return len(processed()) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []uint64{fromEntry, fromEntry + 2}, processed())
+	require.Equal(t, uint64(3), client.GetStats().Errors[datastreamer.StatErrProcess])
+	require.Equal(t, uint64(1), client.GetStats().Errors[datastreamer.StatErrDeadLetter])
+	letters, err := datastreamer.ReadDeadLetters(deadLetterFile)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	entry, err := client.ExecCommandGetEntry(fromEntry + 1)
+	require.NoError(t, err)
+	require.Equal(t, fromEntry+1, letters[0].Entry)
+	require.Equal(t, entry.Type, letters[0].Type)
+	require.Equal(t, entry.Data, letters[0].Data)
+	require.Equal(t, errProcess.Error(), letters[0].Error)
+
+	// Case: Dead-letter sink error -> Streaming stopped with the error
+	errSink := errors.New("sink error")
+	client, _, _ = startClient(3, func(*datastreamer.FileEntry, error) error {
+		return errSink
+	})
+	require.ErrorIs(t, client.Run(context.Background()), errSink)
+}
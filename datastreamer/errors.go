@@ -1,6 +1,10 @@
 package datastreamer
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
+)
 
 var (
 	// ErrInvalidCommand is returned when the command is invalid
@@ -16,7 +20,7 @@ var (
 	// ErrGettingHeaderInfo is returned when there is an error getting header info
 	ErrGettingHeaderInfo = fmt.Errorf("error getting header info")
 	// ErrInvalidBinaryHeader is returned when the binary header is invalid
-	ErrInvalidBinaryHeader = fmt.Errorf("invalid binary header info")
+	ErrInvalidBinaryHeader = codec.ErrInvalidHeader
 	// ErrInvalidFileMissingHeaderPage is returned when the file is invalid, missing header page
 	ErrInvalidFileMissingHeaderPage = fmt.Errorf("invalid file, missing header page")
 	// ErrBadFileSizeCutDataPage is returned when the file size is bad, cut data page
@@ -30,9 +34,9 @@ var (
 	// ErrInvalidHeaderBadStreamType is returned when the header is invalid, bad stream type
 	ErrInvalidHeaderBadStreamType = fmt.Errorf("invalid header, bad stream type")
 	// ErrInvalidBinaryEntry is returned when the binary entry is invalid
-	ErrInvalidBinaryEntry = fmt.Errorf("invalid binary entry")
+	ErrInvalidBinaryEntry = codec.ErrInvalidEntry
 	// ErrDecodingBinaryDataEntry is returned when there is an error decoding binary data entry
-	ErrDecodingBinaryDataEntry = fmt.Errorf("error decoding binary data entry")
+	ErrDecodingBinaryDataEntry = codec.ErrDecodingEntry
 	// ErrExpectingPacketTypeData is returned when there is an error expecting packet type data
 	ErrExpectingPacketTypeData = fmt.Errorf("expecting packet type data")
 	// ErrDecodingLengthDataEntry is returned when there is an error decoding length data entry
@@ -51,12 +55,28 @@ var (
 	ErrUpdateEntryTypeNotAllowed = fmt.Errorf("update entry to a different entry type not allowed")
 	// ErrUpdateEntryDifferentSize is returned when the update entry is a different size
 	ErrUpdateEntryDifferentSize = fmt.Errorf("update entry to a different size not allowed")
+	// ErrStreamFileValidation is returned when the deep validation of the stream file fails
+	ErrStreamFileValidation = fmt.Errorf("stream file validation failed, data entries inconsistent with the header")
+	// ErrValidationInProgress is returned when writing to the stream while the stream file validation is in progress
+	ErrValidationInProgress = fmt.Errorf("write not allowed, stream file validation in progress")
+	// ErrInvalidPayloadKey is returned when the payload encryption key is invalid
+	ErrInvalidPayloadKey = fmt.Errorf("invalid payload key, must be 16, 24 or 32 bytes hex encoded")
+	// ErrDecryptingPayload is returned when the entry data can't be decrypted with the payload key
+	ErrDecryptingPayload = fmt.Errorf("error decrypting entry payload")
+	// ErrShutdownNotAllowed is returned when the shutdown is not allowed
+	ErrShutdownNotAllowed = fmt.Errorf("shutdown not allowed, server is not started")
 	// ErrAtomicOpNotAllowed is returned when the atomic operation is not allowed
 	ErrAtomicOpNotAllowed = fmt.Errorf("atomicop not allowed, server is not started")
 	// ErrStartAtomicOpNotAllowed is returned when the start atomic operation is not allowed
 	ErrStartAtomicOpNotAllowed = fmt.Errorf("start atomicop not allowed, atomicop already started")
 	// ErrAddEntryNotAllowed is returned when the add entry is not allowed
 	ErrAddEntryNotAllowed = fmt.Errorf("add entry not allowed, atomicop is not started")
+	// ErrInvalidEntrySchema is returned when the entry type can't have a payload schema version
+	ErrInvalidEntrySchema = fmt.Errorf("invalid entry type for a payload schema version")
+	// ErrEntrySchemaNotSupported is returned when an entry type is served without any payload schema version handled
+	ErrEntrySchemaNotSupported = fmt.Errorf("entry payload schema version not supported")
+	// ErrAtomicOpLimitExceeded is returned when an entry exceeds the limits of the atomic operation
+	ErrAtomicOpLimitExceeded = fmt.Errorf("atomicop limit exceeded, commit or rollback the entries added")
 	// ErrCommitNotAllowed is returned when the commit is not allowed
 	ErrCommitNotAllowed = fmt.Errorf("commit not allowed, atomicop not in started state")
 	// ErrRollbackNotAllowed is returned when the rollback is not allowed
@@ -78,9 +98,9 @@ var (
 	// ErrStartBookmarkInvalidParamFromBookmark is returned when the start bookmark is invalid, param from bookmark
 	ErrStartBookmarkInvalidParamFromBookmark = fmt.Errorf("start bookmark invalid param from bookmark")
 	// ErrInvalidBinaryResultEntry is returned when the binary result entry is invalid
-	ErrInvalidBinaryResultEntry = fmt.Errorf("invalid binary result entry")
+	ErrInvalidBinaryResultEntry = codec.ErrInvalidResult
 	// ErrDecodingBinaryResultEntry is returned when there is an error decoding binary result entry
-	ErrDecodingBinaryResultEntry = fmt.Errorf("error decoding binary result entry")
+	ErrDecodingBinaryResultEntry = codec.ErrDecodingResult
 	// ErrTruncateNotAllowed is returned when there is an atomic operation in progress
 	ErrTruncateNotAllowed = fmt.Errorf("truncate not allowed, atomic operation in progress")
 	// ErrBookmarkCommandNotAllowed is returned when the bookmark command is not allowed
@@ -93,4 +113,155 @@ var (
 	ErrBookmarkMaxLength = fmt.Errorf("bookmark max length")
 	// ErrInvalidBookmarkRange is returned when the bookmark range is invalid
 	ErrInvalidBookmarkRange = fmt.Errorf("invalid bookmark range")
+	// ErrInvalidShard is returned when the shard of a sharded subscription is not lower than the number of shards
+	ErrInvalidShard = fmt.Errorf("invalid shard, must be lower than the number of shards")
+	// ErrMaxSubscriptions is returned when the maximum number of subscriptions per client is reached
+	ErrMaxSubscriptions = fmt.Errorf("maximum number of subscriptions reached")
+	// ErrInvalidTaggedFrame is returned when a tagged frame has an invalid inner packet type
+	ErrInvalidTaggedFrame = codec.ErrInvalidTaggedFrame
+	// ErrSubscriptionNotFound is returned when the subscription is not found in the client
+	ErrSubscriptionNotFound = fmt.Errorf("subscription not found")
+	// ErrResultTimeout is returned when the result of a command is not received in time
+	ErrResultTimeout = fmt.Errorf("timeout waiting for command result")
+	// ErrStatsCommandNotAllowed is returned when the stats command is not allowed
+	ErrStatsCommandNotAllowed = fmt.Errorf("stats command not allowed")
+	// ErrMuxCommandNotAllowed is returned when the mux command is not allowed
+	ErrMuxCommandNotAllowed = fmt.Errorf("mux command not allowed")
+	// ErrServerShutdown is returned when the server notifies its shutdown
+	ErrServerShutdown = fmt.Errorf("server shutdown")
+	// ErrInvalidFilter is returned when a filter expression of the data entries is invalid
+	ErrInvalidFilter = fmt.Errorf("invalid filter expression")
+	// ErrInvalidCACertificates is returned when the CA file of the TLS configuration has no PEM certificates
+	ErrInvalidCACertificates = fmt.Errorf("invalid CA certificates file")
+	// ErrServerUnreachable is returned when the client gives up connecting to the server, retries exhausted
+	ErrServerUnreachable = fmt.Errorf("server unreachable")
+	// ErrUnauthorized is returned when the credentials of a client are rejected by the server authentication
+	ErrUnauthorized = fmt.Errorf("unauthorized, credentials rejected")
+	// ErrNotSupportedByServer is returned when the command isn't supported by the protocol version of the server
+	ErrNotSupportedByServer = fmt.Errorf("not supported by server")
+	// ErrNoAuthTokens is returned when the authentication tokens file has no tokens
+	ErrNoAuthTokens = fmt.Errorf("no authentication tokens found")
+	// ErrInvalidConsumerGroup is returned when the consumer group is invalid, not enabled in the server, or the
+	// subscription isn't in a consumer group
+	ErrInvalidConsumerGroup = fmt.Errorf("invalid consumer group")
+	// ErrPositionNotStored is returned when the client position isn't stored by the server, or not enabled in it
+	ErrPositionNotStored = fmt.Errorf("position not stored")
+	// ErrInvalidPositionKey is returned when the key of a client position is empty or too long
+	ErrInvalidPositionKey = fmt.Errorf("invalid position key")
+	// ErrPositionCommandNotAllowed is returned when the position commands are not allowed
+	ErrPositionCommandNotAllowed = fmt.Errorf("position command not allowed")
+	// ErrEntryRangeCommandNotAllowed is returned when the entry range command is not allowed
+	ErrEntryRangeCommandNotAllowed = fmt.Errorf("entry range command not allowed")
+	// ErrDecodingEntryRange is returned when the entry range received from the server can't be decoded
+	ErrDecodingEntryRange = fmt.Errorf("error decoding entry range")
+	// ErrEntryTypesCommandNotAllowed is returned when the entry types command is not allowed
+	ErrEntryTypesCommandNotAllowed = fmt.Errorf("entry types command not allowed")
+	// ErrInvalidEntryTypes is returned when the number of entry types of the entry types command exceeds the maximum
+	ErrInvalidEntryTypes = fmt.Errorf("invalid entry types")
+	// ErrLatestStatesCommandNotAllowed is returned when the latest states command is not allowed
+	ErrLatestStatesCommandNotAllowed = fmt.Errorf("latest states command not allowed")
+	// ErrClientStopped is returned when the client is stopped and can't be started again
+	ErrClientStopped = fmt.Errorf("client stopped")
+	// ErrSessionExpired is returned when the server asks to reconnect once the session lifetime is reached
+	ErrSessionExpired = fmt.Errorf("session lifetime reached")
+	// ErrUnexpectedPacketType is returned when the packet type received is not the expected one
+	ErrUnexpectedPacketType = fmt.Errorf("unexpected packet type")
+	// ErrContentNotFound is returned when the payload of a content-addressed entry is not found in the content DB
+	ErrContentNotFound = fmt.Errorf("content of the entry not found")
+	// ErrReservedEntryType is returned when the entry type uses the flag reserved for content-addressed entries
+	ErrReservedEntryType = fmt.Errorf("entry type reserved for content-addressed entries")
+	// ErrCloseNotAllowed is returned when closing a server not shut down
+	ErrCloseNotAllowed = fmt.Errorf("close not allowed, server is started")
+	// ErrHeaderChangesNotRecorded is returned when the server doesn't record the header changes
+	ErrHeaderChangesNotRecorded = fmt.Errorf("header changes not recorded")
+	// ErrHeaderChangesCommandNotAllowed is returned when the header changes command is not allowed
+	ErrHeaderChangesCommandNotAllowed = fmt.Errorf("header changes command not allowed")
+	// ErrDecodingHeaderChange is returned when there is an error decoding a header change entry
+	ErrDecodingHeaderChange = fmt.Errorf("error decoding header change entry")
+	// ErrRequestIDMismatch is returned when the response received is tagged with a different request ID
+	ErrRequestIDMismatch = fmt.Errorf("request ID mismatch")
+	// ErrBaseEntryNotAllowed is returned when setting the base entry of a stream not empty or a server started
+	ErrBaseEntryNotAllowed = fmt.Errorf("base entry not allowed, stream not empty or server started")
+	// ErrCheckpointsNotEnabled is returned when the server doesn't compute the checkpoints
+	ErrCheckpointsNotEnabled = fmt.Errorf("checkpoints not enabled")
+	// ErrEntryNotCheckpointed is returned when the entry is not in a completed checkpoint
+	ErrEntryNotCheckpointed = fmt.Errorf("entry not in a completed checkpoint")
+	// ErrCheckpointProofCommandNotAllowed is returned when the checkpoint proof command is not allowed
+	ErrCheckpointProofCommandNotAllowed = fmt.Errorf("checkpoint proof command not allowed")
+	// ErrEntriesByTimeCommandNotAllowed is returned when the entries by time command is not allowed
+	ErrEntriesByTimeCommandNotAllowed = fmt.Errorf("entries by time command not allowed")
+	// ErrSchemasCommandNotAllowed is returned when the schemas command is not allowed
+	ErrSchemasCommandNotAllowed = fmt.Errorf("schemas command not allowed")
+	// ErrEntryProofInvalid is returned when a streaming entry is not verified against its trusted checkpoint root
+	ErrEntryProofInvalid = fmt.Errorf("entry not verified against its trusted checkpoint root")
+	// ErrDirectIONotSupported is returned when the platform doesn't support the direct I/O writes
+	ErrDirectIONotSupported = fmt.Errorf("direct I/O not supported")
+	// ErrFileLeaseNotSupported is returned when the platform doesn't support the file locks of the file lease
+	ErrFileLeaseNotSupported = fmt.Errorf("file lease not supported")
+	// ErrStreamDivergence is returned when the stream diverges from the external source of the verifier
+	ErrStreamDivergence = fmt.Errorf("stream diverges from the verifier source")
+	// ErrInvalidCustomPacketType is returned when a custom frame packet type is not in the private range
+	ErrInvalidCustomPacketType = fmt.Errorf("custom packet type not in the private range")
+	// ErrCustomFrameTooLarge is returned when a custom frame exceeds the maximum size
+	ErrCustomFrameTooLarge = fmt.Errorf("custom frame too large")
+	// ErrClientNotFound is returned when the client connection is not found in the server
+	ErrClientNotFound = fmt.Errorf("client not found")
+	// ErrInvalidListenAddress is returned when the address to rebind the server listener isn't a valid host:port
+	ErrInvalidListenAddress = fmt.Errorf("invalid listen address")
+	// ErrInvalidTransform is returned when a payload write transform has no ID or apply function, or a repeated ID
+	ErrInvalidTransform = fmt.Errorf("invalid payload transform")
+	// ErrReversingPayload is returned when the write transforms applied to an entry payload can't be reversed
+	ErrReversingPayload = fmt.Errorf("error reversing entry payload transforms")
+	// ErrCommandNotIdempotent is returned when retries are set for a command that isn't idempotent
+	ErrCommandNotIdempotent = fmt.Errorf("command not idempotent")
+	// ErrPullNotEnabled is returned when an entry is read from a client without the pull delivery set
+	ErrPullNotEnabled = fmt.Errorf("pull delivery not enabled")
+	// ErrWriteVerification is returned when the data read back from the stream file doesn't match the data written
+	ErrWriteVerification = fmt.Errorf("write verification failed")
+	// ErrInvalidManifest is returned when the contents of a manifest can't be parsed or its version isn't supported
+	ErrInvalidManifest = fmt.Errorf("invalid manifest")
+	// ErrInvalidManifestKey is returned when a key signing or verifying the manifests isn't a valid ed25519 key
+	ErrInvalidManifestKey = fmt.Errorf("invalid manifest key")
+	// ErrInvalidManifestSignature is returned when the signature of a manifest doesn't match its contents
+	ErrInvalidManifestSignature = fmt.Errorf("invalid manifest signature")
+	// ErrUntrustedManifestKey is returned when a manifest is signed with a key not trusted
+	ErrUntrustedManifestKey = fmt.Errorf("manifest signed with an untrusted key")
+	// ErrManifestFileMismatch is returned when a file isn't listed in a manifest or its contents don't match
+	ErrManifestFileMismatch = fmt.Errorf("file not matching the manifest")
+	// ErrBookmarkDBOptionsNotAllowed is returned when setting the bookmarks DB options of a server started
+	ErrBookmarkDBOptionsNotAllowed = fmt.Errorf("bookmarks DB options not allowed, server is started")
+	// ErrInvalidDBCompression is returned when the compression of the bookmarks DB is unknown
+	ErrInvalidDBCompression = fmt.Errorf("invalid DB compression")
+	// ErrCheckpointNotStored is returned when the checkpoint store has no processed position stored
+	ErrCheckpointNotStored = fmt.Errorf("checkpoint not stored")
+	// ErrCheckpointStoreNotSet is returned when resuming from a checkpoint without a checkpoint store set
+	ErrCheckpointStoreNotSet = fmt.Errorf("checkpoint store not set")
+	// ErrSplitOutputNotEmpty is returned when an output stream of a split or a merge already has entries
+	ErrSplitOutputNotEmpty = fmt.Errorf("split output stream not empty")
+	// ErrInvalidCompression is returned when the compression codec of the streaming is unknown
+	ErrInvalidCompression = fmt.Errorf("invalid compression")
+	// ErrCompressionCommandNotAllowed is returned when the compression command is not allowed
+	ErrCompressionCommandNotAllowed = fmt.Errorf("compression command not allowed")
+	// ErrDecompressingEntry is returned when the data of a compressed entry can't be decompressed
+	ErrDecompressingEntry = fmt.Errorf("error decompressing data entry")
+	// ErrMergeWithoutInputs is returned when merging streams without input streams
+	ErrMergeWithoutInputs = fmt.Errorf("merge without input streams")
+	// ErrHeartbeatTimeout is returned when no packet is received from the server within the heartbeat timeout
+	ErrHeartbeatTimeout = fmt.Errorf("heartbeat timeout")
+	// ErrInvalidRedactRule is returned when a redaction rule of the payload of the data entries is invalid
+	ErrInvalidRedactRule = fmt.Errorf("invalid redaction rule")
+	// ErrConnectionLost is returned when the connection to the server is lost waiting for a command result
+	ErrConnectionLost = fmt.Errorf("connection lost waiting for the command result")
+	// ErrInvalidProxy is returned when the URL of a proxy is invalid or its scheme not supported
+	ErrInvalidProxy = fmt.Errorf("invalid proxy URL")
+	// ErrProxyHandshake is returned when a proxy rejects or fails the connection to the server
+	ErrProxyHandshake = fmt.Errorf("proxy handshake failed")
+	// ErrInvalidChecksum is returned when the checksum algorithm of the streaming is unknown
+	ErrInvalidChecksum = fmt.Errorf("invalid checksum")
+	// ErrChecksumCommandNotAllowed is returned when the checksum command is not allowed
+	ErrChecksumCommandNotAllowed = fmt.Errorf("checksum command not allowed")
+	// ErrEntryChecksumMismatch is returned when the checksum of an entry streamed doesn't match its contents
+	ErrEntryChecksumMismatch = fmt.Errorf("entry checksum mismatch")
+	// ErrCircuitOpen is returned when the client stops after repeated rejections of the server (circuit breaker)
+	ErrCircuitOpen = fmt.Errorf("circuit breaker open")
 )
@@ -0,0 +1,92 @@
+package datastreamer
+
+import (
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// AtomicOpLimits type for the limits of the atomic operations of a server
+type AtomicOpLimits struct {
+	MaxEntries  int           // Maximum entries of an atomic operation (0 no limit)
+	MaxBytes    uint64        // Maximum data bytes of the entries of an atomic operation (0 no limit)
+	MaxDuration time.Duration // Maximum duration since the start of an atomic operation (0 no limit)
+	AutoSplit   bool          // Commit the entries added and continue in a new commit instead of failing
+}
+
+// AtomicOpSplit type for the link of a commit to the atomic operation it's part of, if split in several commits
+type AtomicOpSplit struct {
+	FromEntry uint64 `json:"fromEntry"` // First entry number of the atomic operation
+	Part      uint32 `json:"part"`      // Number of the commit within the atomic operation, from 1
+	Last      bool   `json:"last"`      // Flag the last commit of the atomic operation
+}
+
+// SetAtomicOpLimits sets the limits of entries, data bytes and duration of the atomic operations, checked when each
+// entry is added, so a pathological producer operation can't block the broadcast for seconds. An entry exceeding a
+// limit fails with ErrAtomicOpLimitExceeded (the entries added so far can still be committed), or with auto-split
+// the entries added so far are committed and broadcast, and the operation continues in a new commit. The commits of
+// a split operation are linked in the header changes meta-stream (see SetHeaderChanges), and a rollback discards only
+// the entries since the latest commit. An entry exceeding a limit alone is added (set it out of an atomic operation)
+func (s *StreamServer) SetAtomicOpLimits(limits AtomicOpLimits) {
+	s.aoLimits = limits
+}
+
+// checkAtomicOpLimits checks the limits of the atomic operation in progress before adding an entry of a data size,
+// committing the entries added so far if auto-split
+func (s *StreamServer) checkAtomicOpLimits(size int) error {
+	if len(s.atomicOp.entries) == 0 {
+		return nil
+	}
+
+	var exceeded string
+	switch {
+	case s.aoLimits.MaxEntries > 0 && len(s.atomicOp.entries) >= s.aoLimits.MaxEntries:
+		exceeded = "entries"
+	case s.aoLimits.MaxBytes > 0 && s.atomicOp.bytes+uint64(size) > s.aoLimits.MaxBytes:
+		exceeded = "bytes"
+	case s.aoLimits.MaxDuration > 0 && time.Since(s.atomicOp.startTime) > s.aoLimits.MaxDuration:
+		exceeded = "duration"
+	default:
+		return nil
+	}
+
+	if !s.aoLimits.AutoSplit {
+		log.Errorf("AtomicOp from entry %d exceeds the maximum %s", s.atomicOp.startEntry, exceeded)
+		return ErrAtomicOpLimitExceeded
+	}
+	return s.splitAtomicOp(exceeded)
+}
+
+// splitAtomicOp commits the entries of the atomic operation in progress as a part of it, and continues it
+func (s *StreamServer) splitAtomicOp(exceeded string) error {
+	if s.atomicOp.split.Part == 0 {
+		s.atomicOp.split = AtomicOpSplit{FromEntry: s.atomicOp.startEntry, Part: 1}
+	}
+	log.Infof("Splitting AtomicOp from entry %d on the maximum %s, committing part %d (entries %d-%d)",
+		s.atomicOp.split.FromEntry, exceeded, s.atomicOp.split.Part, s.atomicOp.startEntry, s.nextEntry-1)
+
+	split := s.atomicOp.split
+	err := s.commitAtomicOp(time.Now(), &split)
+	if err != nil {
+		return err
+	}
+
+	// Continue the atomic operation
+	s.atomicOp.status = aoStarted
+	s.atomicOp.startEntry = s.nextEntry
+	s.atomicOp.startTime = time.Now()
+	s.atomicOp.entries = s.atomicOp.entries[:0]
+	s.atomicOp.bytes = 0
+	s.atomicOp.split.Part++
+	return nil
+}
+
+// lastSplit returns the link of the last commit of the atomic operation in progress (nil if it's not split)
+func (s *StreamServer) lastSplit() *AtomicOpSplit {
+	if s.atomicOp.split.Part == 0 {
+		return nil
+	}
+	split := s.atomicOp.split
+	split.Last = true
+	return &split
+}
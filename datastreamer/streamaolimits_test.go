@@ -0,0 +1,73 @@
+package datastreamer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicOpLimits(t *testing.T) {
+	server, _ := newTestServer(t, "aolimits.bin")
+	require.NoError(t, server.SetHeaderChanges(true))
+	require.NoError(t, server.Start())
+
+	addEntries := func(count int) error {
+		for i := 0; i < count; i++ {
+			_, err := server.AddStreamEntry(entryType1, testEntries[1].Encode())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Case: Entry exceeding the maximum entries -> FAIL, the entries added committed
+	server.SetAtomicOpLimits(datastreamer.AtomicOpLimits{MaxEntries: 3})
+	require.NoError(t, server.StartAtomicOp())
+	require.NoError(t, addEntries(3))
+	require.ErrorIs(t, addEntries(1), datastreamer.ErrAtomicOpLimitExceeded)
+	require.NoError(t, server.CommitAtomicOp())
+	require.Equal(t, uint64(3), server.GetHeader().TotalEntries)
+
+	// Case: Auto-split on the maximum entries -> OK, linked commits
+	server.SetAtomicOpLimits(datastreamer.AtomicOpLimits{MaxEntries: 3, AutoSplit: true})
+	require.NoError(t, server.StartAtomicOp())
+	require.NoError(t, addEntries(7))
+	require.Equal(t, uint64(3+6), server.GetHeader().TotalEntries)
+	require.NoError(t, server.CommitAtomicOp())
+	require.Equal(t, uint64(3+7), server.GetHeader().TotalEntries)
+
+	changes, err := server.GetHeaderChanges(1, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	for i, change := range changes {
+		require.Equal(t, &datastreamer.AtomicOpSplit{FromEntry: 3, Part: uint32(i + 1), Last: i == 2}, change.Split)
+	}
+
+	// Case: Rollback of a split atomic operation -> Entries since the latest commit discarded
+	require.NoError(t, server.StartAtomicOp())
+	require.NoError(t, addEntries(4))
+	require.NoError(t, server.RollbackAtomicOp())
+	require.Equal(t, uint64(3+7+3), server.GetHeader().TotalEntries)
+
+	// Case: Auto-split on the maximum bytes and duration -> OK
+	size := uint64(len(testEntries[1].Encode()))
+	server.SetAtomicOpLimits(datastreamer.AtomicOpLimits{MaxBytes: 2 * size, MaxDuration: 50 * time.Millisecond,
+		AutoSplit: true})
+	require.NoError(t, server.StartAtomicOp())
+	require.NoError(t, addEntries(3))
+	require.Equal(t, uint64(13+2), server.GetHeader().TotalEntries)
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, addEntries(1))
+	require.Equal(t, uint64(13+3), server.GetHeader().TotalEntries)
+	require.NoError(t, server.CommitAtomicOp())
+
+	changes, err = server.GetHeaderChanges(0, 100)
+	require.NoError(t, err)
+	require.Nil(t, changes[0].Split)
+	require.Equal(t, &datastreamer.AtomicOpSplit{FromEntry: 13, Part: 3, Last: true}, changes[len(changes)-1].Split)
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
@@ -0,0 +1,143 @@
+package datastreamer
+
+import (
+	"crypto/subtle"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const maxCredentialsLength = 4096 // Maximum length of the credentials of the Auth command
+
+// Authenticator type of the verifier of the credentials sent by a client connection, returns an error to reject it
+type Authenticator func(clientID string, credentials []byte) error
+
+// SetAuthenticator sets the verifier of the client credentials, so the stream access is restricted: the clients must
+// send the Auth command with accepted credentials after connecting, any other command or frame before kills the
+// connection. A nil authenticator allows all the clients (call before Start)
+func (s *StreamServer) SetAuthenticator(auth Authenticator) {
+	s.authenticator = auth
+}
+
+// SetAuthenticator sets the verifier of the relay client credentials (see StreamServer.SetAuthenticator)
+func (r *StreamRelay) SetAuthenticator(auth Authenticator) {
+	r.server.SetAuthenticator(auth)
+}
+
+// NewTokenAuthenticator creates an authenticator accepting the clients sending one of the tokens as credentials
+func NewTokenAuthenticator(tokens ...[]byte) Authenticator {
+	return func(clientID string, credentials []byte) error {
+		for _, token := range tokens {
+			if subtle.ConstantTimeCompare(token, credentials) == 1 {
+				return nil
+			}
+		}
+		return ErrUnauthorized
+	}
+}
+
+// LoadAuthTokens reads the authentication tokens from a file, one per line (the empty lines and the lines starting
+// with # are skipped)
+func LoadAuthTokens(fileName string) ([][]byte, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	tokens := [][]byte{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, []byte(line))
+	}
+	if len(tokens) == 0 {
+		return nil, ErrNoAuthTokens
+	}
+	return tokens, nil
+}
+
+// isAuthenticated checks if a client connection is allowed to send commands other than Auth
+func (s *StreamServer) isAuthenticated(cli *client) bool {
+	return s.authenticator == nil || cli.authenticated
+}
+
+// handleAuthCommand processes the CmdAuth command, a client with rejected credentials is killed
+func (s *StreamServer) handleAuthCommand(cli *client) error {
+	// Read credentials length and credentials
+	length, err := readFullUint32(cli)
+	if err != nil {
+		return err
+	}
+	if length > maxCredentialsLength {
+		log.Errorf("Client %s exceeded [%d] maximum allowed length [%d] for the credentials: client killed",
+			cli.clientID, length, maxCredentialsLength)
+		s.killClient(cli.clientID)
+		return ErrUnauthorized
+	}
+	credentials, err := readFullBytes(length, cli)
+	if err != nil {
+		return err
+	}
+
+	if s.authenticator != nil {
+		err = s.authenticator(cli.clientID, credentials)
+		if err != nil {
+			log.Warnf("Authentication of client %s failed: %v: client killed", cli.clientID, err)
+			_ = s.sendResultEntry(uint32(CmdErrUnauthorized), StrCommandErrors[CmdErrUnauthorized], cli)
+			s.killClient(cli.clientID)
+			return ErrUnauthorized
+		}
+	}
+	cli.authenticated = true
+	log.Infof("Client %s authenticated", cli.clientID)
+
+	return s.sendResultEntry(uint32(CmdErrOK), StrCommandErrors[CmdErrOK], cli)
+}
+
+// SetCredentials sets the credentials sent to authenticate to the server after connecting, on the streaming
+// connection and the command channel, so it's authenticated again on each reconnection. A server rejecting them
+// closes the connection, retried as a failed connection attempt (see SetReconnectPolicy). Nil credentials disable it
+// (call before Start)
+func (c *StreamClient) SetCredentials(credentials []byte) {
+	c.credentials = credentials
+}
+
+// SetCredentials sets the credentials sent by the relay to authenticate to the master server (see
+// StreamClient.SetCredentials)
+func (r *StreamRelay) SetCredentials(credentials []byte) {
+	r.client.SetCredentials(credentials)
+}
+
+// authenticate sends the credentials (if set) on a new connection to the server and waits for the result
+func (c *StreamClient) authenticate(conn net.Conn) error {
+	if c.credentials == nil {
+		return nil
+	}
+
+	c.mutexWrite.Lock()
+	err := c.writeCommand(conn, CmdAuth, 0, 0, c.credentials)
+	c.mutexWrite.Unlock()
+	if err != nil {
+		return err
+	}
+	err = c.readPacketType(conn, PtResult, 0)
+	if err != nil {
+		return err
+	}
+	r, err := c.readResultEntry(conn)
+	if err != nil {
+		return err
+	}
+	if r.errorNum == uint32(CmdErrInvalidCommand) {
+		return errNotSupported(CmdAuth, ProtocolLegacy)
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		log.Errorf("%s Credentials rejected by server %s: %d[%s]", c.ID, c.serverAddr(), r.errorNum, r.errorStr)
+		c.stats.addError(StatErrAuth, ErrUnauthorized)
+		return ErrUnauthorized
+	}
+	return nil
+}
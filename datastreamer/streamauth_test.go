@@ -0,0 +1,79 @@
+package datastreamer_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAuth(t *testing.T) {
+	server, port := newTestServer(t, "auth.bin")
+	tokensFile := t.TempDir() + "/tokens"
+	require.NoError(t, os.WriteFile(tokensFile, []byte("# clients\nsecret-1\n\nsecret-2\n"), 0600))
+	tokens, err := datastreamer.LoadAuthTokens(tokensFile)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("secret-1"), []byte("secret-2")}, tokens)
+	server.SetAuthenticator(datastreamer.NewTokenAuthenticator(tokens...))
+	require.NoError(t, server.Start())
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamEntry(entryType1, testEntries[1].Encode())
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+	address := fmt.Sprintf("localhost:%d", port)
+
+	// Case: Command without authentication -> Unauthorized result, connection closed
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	command := binary.BigEndian.AppendUint64(nil, uint64(datastreamer.CmdHeader))
+	_, err = conn.Write(binary.BigEndian.AppendUint64(command, uint64(streamType)))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Greater(t, len(response), 9)
+	require.Equal(t, uint8(datastreamer.PtResult), response[0])
+	require.Equal(t, uint32(datastreamer.CmdErrUnauthorized), binary.BigEndian.Uint32(response[5:9]))
+
+	// Case: Wrong credentials -> Rejected on each attempt, client gives up
+	client, err := datastreamer.NewClient(address, streamType)
+	require.NoError(t, err)
+	client.SetCredentials([]byte("wrong"))
+	client.SetReconnectPolicy(datastreamer.ReconnectPolicy{Backoff: 10 * time.Millisecond, MaxRetries: 1})
+	require.ErrorIs(t, client.Start(), datastreamer.ErrServerUnreachable)
+	require.Equal(t, uint64(2), client.GetStats().Errors[datastreamer.StatErrAuth])
+
+	// Case: Valid credentials -> Streaming and commands, plain and multiplexed
+	for _, multiplexed := range []bool{false, true} {
+		client, err = datastreamer.NewClient(address, streamType)
+		require.NoError(t, err)
+		client.SetCredentials([]byte("secret-2"))
+		client.SetMultiplexed(multiplexed)
+		received := make(chan datastreamer.FileEntry, 1)
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			received <- *e
+			return nil
+		})
+		require.NoError(t, client.Start())
+		header, err := client.ExecCommandGetHeader()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), header.TotalEntries)
+		require.NoError(t, client.ExecCommandStart(0))
+		select {
+		case e := <-received:
+			require.Equal(t, testEntries[1].Encode(), e.Data)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for the entry authenticated")
+		}
+		require.Zero(t, client.GetStats().Errors[datastreamer.StatErrAuth])
+		require.NoError(t, client.Close())
+	}
+}
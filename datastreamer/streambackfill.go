@@ -0,0 +1,297 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const backfillWindow = 2 // Ranges in flight or pending the in-order delivery per connection
+
+// clientBackfill type for the parallel backfill of the streaming started far behind the tip of the stream
+type clientBackfill struct {
+	connections int
+	threshold   uint64
+
+	mutex  sync.Mutex
+	cancel context.CancelFunc // Cancels the backfill running (nil if none)
+	done   chan struct{}      // Closed once the backfill running exits
+}
+
+// backfillRange type for a range of entries fetched by a backfill connection
+type backfillRange struct {
+	from    uint64
+	to      uint64
+	entries []FileEntry
+	err     error
+	done    chan struct{} // Closed once the range is fetched or failed
+}
+
+// SetBackfill sets the client to backfill in parallel the streaming started far behind the tip: when
+// ExecCommandStart is at least threshold entries behind the total entries of the server, the historical entries are
+// fetched concurrently in ranges (EntryRange command of 10000 entries) over several connections to the server (streams
+// of the session if multiplexed) and queued in order to the process entry function, as the streaming entries. Once
+// the tip is reached, the client switches to the live streaming from the next entry (Start command). If a range
+// can't be fetched, the client streams from the next entry not queued instead. The backfill runs in background,
+// ExecCommandStop stops it. Less than 2 connections disables it (call before Start)
+func (c *StreamClient) SetBackfill(connections int, threshold uint64) {
+	if connections < 2 { //nolint:mnd
+		c.backfill = nil
+		return
+	}
+	c.backfill = &clientBackfill{
+		connections: connections,
+		threshold:   max(threshold, 1),
+	}
+}
+
+// startBackfill starts the backfill from an entry in background if it's far behind the tip of the stream (and the
+// server supports entry ranges). Returns if started, otherwise the streaming is started as usual
+func (c *StreamClient) startBackfill(ctx context.Context, fromEntry uint64) (bool, error) {
+	c.stopBackfill()
+	if c.protocol.Load() == 0 {
+		_, _, err := c.getCommandConn(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+	if c.checkProtocol(CmdEntryRange, false) != nil {
+		return false, nil
+	}
+	header, err := c.ExecCommandGetHeaderContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	if fromEntry >= header.TotalEntries || header.TotalEntries-fromEntry < c.backfill.threshold {
+		return false, nil
+	}
+
+	log.Infof("%s Backfilling from entry %d to %d over %d connections", c.ID, fromEntry, header.TotalEntries,
+		c.backfill.connections)
+	backfillCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.backfill.mutex.Lock()
+	c.backfill.cancel, c.backfill.done = cancel, done
+	c.backfill.mutex.Unlock()
+
+	c.fromStream.Store(fromEntry)
+	c.nextEntry.Store(fromEntry)
+	c.spawn(func() {
+		defer close(done)
+		defer cancel()
+		go func() {
+			select {
+			case <-c.done:
+				cancel()
+			case <-backfillCtx.Done():
+			}
+		}()
+		c.runBackfill(backfillCtx, fromEntry, header.TotalEntries)
+	})
+	return true, nil
+}
+
+// stopBackfill stops the backfill running (if any) and waits for it to exit. Returns if it was running
+func (c *StreamClient) stopBackfill() bool {
+	if c.backfill == nil {
+		return false
+	}
+	c.backfill.mutex.Lock()
+	cancel, done := c.backfill.cancel, c.backfill.done
+	c.backfill.cancel, c.backfill.done = nil, nil
+	c.backfill.mutex.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	<-done
+	return true
+}
+
+// runBackfill fetches the entries up to the tip of the stream, again up to the new tip while still far behind, and
+// then starts the live streaming from the next entry
+func (c *StreamClient) runBackfill(ctx context.Context, fromEntry uint64, tip uint64) {
+	start := time.Now()
+	nextEntry := fromEntry
+	for {
+		var err error
+		nextEntry, err = c.fetchRanges(ctx, nextEntry, tip)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warnf("%s Backfill stopped at entry %d, streaming from it: %v", c.ID, nextEntry, err)
+			break
+		}
+		header, err := c.ExecCommandGetHeaderContext(ctx)
+		if err != nil || header.TotalEntries < nextEntry+c.backfill.threshold {
+			break
+		}
+		tip = header.TotalEntries
+	}
+	log.Infof("%s Backfilled %d entries in %v, streaming from entry %d", c.ID, nextEntry-fromEntry, time.Since(start),
+		nextEntry)
+
+	// Not canceled once sent, so a stop waiting for the backfill finds the live streaming started
+	if ctx.Err() != nil {
+		return
+	}
+	_, _, err := c.execCommand(context.Background(), CmdStart, false, nextEntry, nil)
+	if err != nil && !c.isStopped() {
+		log.Errorf("%s Error starting the streaming after the backfill from entry %d: %v", c.ID, nextEntry, err)
+		select {
+		case c.fatal <- err:
+		default:
+		}
+		c.stop(err)
+	}
+}
+
+// fetchRanges fetches the entries from an entry up to the tip in ranges over the backfill connections, and queues
+// them in order. Returns the next entry not queued
+func (c *StreamClient) fetchRanges(ctx context.Context, fromEntry uint64, tip uint64) (uint64, error) {
+	ranges := make(chan *backfillRange)
+	ordered := make(chan *backfillRange, c.backfill.connections*backfillWindow)
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.backfill.connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.fetchWorker(fetchCtx, ranges)
+		}()
+	}
+	go func() {
+		defer close(ordered)
+		defer close(ranges)
+		for from := fromEntry; from < tip; from += maxEntryRangeCount {
+			r := &backfillRange{from: from, to: min(from+maxEntryRangeCount, tip), done: make(chan struct{})}
+			select {
+			case ordered <- r:
+			case <-fetchCtx.Done():
+				return
+			}
+			select {
+			case ranges <- r:
+			case <-fetchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// Queue the ranges in order, the workers exit once the ranges are fetched or the fetch is canceled
+	nextEntry := fromEntry
+	var err error
+	for r := range ordered {
+		select {
+		case <-r.done:
+		case <-fetchCtx.Done():
+		}
+		if fetchCtx.Err() != nil {
+			break
+		}
+		if r.err != nil {
+			err = r.err
+			break
+		}
+		if !c.queueBackfilled(r.entries) {
+			cancel()
+			break
+		}
+		nextEntry = r.to
+	}
+	cancel()
+	wg.Wait()
+	return nextEntry, err
+}
+
+// fetchWorker fetches the ranges over its own connection to the server, retried once on a new connection
+func (c *StreamClient) fetchWorker(ctx context.Context, ranges <-chan *backfillRange) {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for r := range ranges {
+		for retry := 0; retry < 2; retry++ {
+			if conn == nil {
+				c.mutexSession.Lock()
+				conn, r.err = c.openCommandConn(ctx)
+				c.mutexSession.Unlock()
+				if r.err != nil {
+					break
+				}
+			}
+			r.entries, r.err = c.fetchRange(ctx, conn, r.from, r.to)
+			if r.err == nil || ctx.Err() != nil {
+				break
+			}
+			log.Warnf("%s Error on backfill connection fetching entries from %d: %v", c.ID, r.from, r.err)
+			conn.Close()
+			conn = nil
+		}
+		close(r.done)
+	}
+}
+
+// fetchRange fetches the entries of a range over a connection, with as many EntryRange commands as the server limits
+// of the responses require. The connection deadline is expired once the context is done to unblock it
+func (c *StreamClient) fetchRange(ctx context.Context, conn net.Conn, from uint64, to uint64) ([]FileEntry, error) {
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	entries := make([]FileEntry, 0, to-from)
+	for from < to {
+		countParam := binary.BigEndian.AppendUint32(nil, uint32(to-from))
+		err := c.writeCommand(conn, CmdEntryRange, 0, from, countParam)
+		if err != nil {
+			return nil, err
+		}
+		r, _, entry, err := c.readCommandResponse(conn, CmdEntryRange, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if r.errorNum != uint32(CmdErrOK) {
+			return nil, ErrInvalidEntryNumber
+		}
+		ranged, nextEntry, err := decodeRangeEntries(entry.Data)
+		if err != nil {
+			return nil, err
+		}
+		if nextEntry <= from {
+			return nil, ErrDecodingEntryRange
+		}
+		entries = append(entries, ranged...)
+		from = nextEntry
+	}
+	return entries, nil
+}
+
+// queueBackfilled queues the entries backfilled to the process entry function, as received from the streaming.
+// Returns false if the client is stopped
+func (c *StreamClient) queueBackfilled(entries []FileEntry) bool {
+	for _, e := range entries {
+		c.stats.dataReceived(e.Length)
+		c.stats.backfillReceived()
+		if !c.limitRate(&e) {
+			return false
+		}
+		c.nextEntry.Store(e.Number + 1)
+		c.queueEntry(e)
+		if c.isStopped() {
+			return false
+		}
+	}
+	return true
+}
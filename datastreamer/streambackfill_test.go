@@ -0,0 +1,71 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientBackfill(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow integration test, skipped in short mode")
+	}
+	const entries = 25000
+	server, port := newTestServer(t, "backfill.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, entries)
+
+	processed := make(chan uint64, entries+100)
+	process := func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient, _ *datastreamer.StreamServer) error {
+		processed <- e.Number
+		return nil
+	}
+	requireProcessed := func(from uint64, to uint64) {
+		for number := from; number < to; number++ {
+			select {
+			case received := <-processed:
+				require.Equal(t, number, received)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for entry %d", number)
+			}
+		}
+	}
+
+	// Case: Start far behind the tip -> Ranges fetched in parallel, processed in order, then live streaming
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+		datastreamer.WithBackfill(3, 1000))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	client.SetProcessEntryFunc(process)
+	client.SetStopDrain(datastreamer.StopDiscard)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(100))
+	requireProcessed(100, entries)
+	addTestEntries(t, server, 10)
+	requireProcessed(entries, entries+10)
+	stats := client.GetStats()
+	require.Equal(t, uint64(entries-100), stats.BackfilledEntries)
+	require.Equal(t, uint64(entries-90), stats.EntriesReceived)
+
+	// Case: Stop and start near the tip -> Streaming started as usual, not backfilled
+	require.NoError(t, client.ExecCommandStop())
+	require.NoError(t, client.ExecCommandStart(entries))
+	requireProcessed(entries, entries+10)
+	require.Equal(t, uint64(entries-100), client.GetStats().BackfilledEntries)
+
+	// Case: Stop while backfilling -> Backfill stopped, the entries queued discarded, started again from the next one
+	require.NoError(t, client.ExecCommandStop())
+	require.NoError(t, client.ExecCommandStart(0))
+	ack, err := client.ExecCommandStopAck(context.Background())
+	require.NoError(t, err)
+	for len(processed) > 0 {
+		<-processed
+	}
+	require.NoError(t, client.ExecCommandStart(ack.NextEntry))
+	require.Eventually(t, func() bool { return len(processed) > 0 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, ack.NextEntry, <-processed)
+}
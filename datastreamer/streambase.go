@@ -0,0 +1,47 @@
+package datastreamer
+
+import (
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// SetBaseEntry sets the number of the first entry of an empty stream (genesis offset), so a migrated chain continues
+// the entry numbering of its legacy system without renumbering the consumers. The header carries the base entry and
+// the commands validate the entry numbers against it (call before Start)
+func (s *StreamServer) SetBaseEntry(baseEntry uint64) error {
+	if s.started || s.atomicOp.status != aoNone {
+		log.Errorf("Base entry not allowed, server started or atomic operation in progress")
+		return ErrBaseEntryNotAllowed
+	}
+	if s.streamFile.getHeaderEntry().BaseEntry == baseEntry {
+		return nil
+	}
+
+	err := s.streamFile.setBaseEntry(baseEntry)
+	if err != nil {
+		return err
+	}
+	s.nextEntry = baseEntry
+	return nil
+}
+
+// setBaseEntry sets the number of the first data entry of an empty stream file
+func (f *StreamFile) setBaseEntry(baseEntry uint64) error {
+	header := f.getHeaderEntry()
+	if header.TotalEntries != header.BaseEntry || header.TotalLength > PageHeaderSize {
+		log.Errorf("Base entry not allowed, stream file with %d entries", header.TotalEntries-header.BaseEntry)
+		return ErrBaseEntryNotAllowed
+	}
+
+	// The base entry is only encoded in the header if not zero, keeping the header of the streams starting with 0
+	f.mutexHeader.Lock()
+	f.header.BaseEntry = baseEntry
+	f.header.TotalEntries = baseEntry
+	f.header.headLength = headerSize
+	if baseEntry != 0 {
+		f.header.headLength = headerSizeBase
+	}
+	f.mutexHeader.Unlock()
+
+	log.Infof("Stream file base entry set to %d", baseEntry)
+	return f.writeHeaderEntry()
+}
@@ -0,0 +1,116 @@
+package datastreamer_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerBaseEntry(t *testing.T) {
+	port := freePort(t)
+	fileName := t.TempDir() + "/base.bin"
+	server := openTestServer(t, port, fileName)
+	require.NoError(t, server.SetBaseEntry(1000))
+	require.NoError(t, server.Start())
+
+	// Case: Entries added to a stream with base entry -> numbered from the base entry
+	require.NoError(t, server.StartAtomicOp())
+	for i := 0; i < 10; i++ {
+		entryNumber, err := server.AddStreamEntry(entryType1, testEntries[1].Encode())
+		require.NoError(t, err)
+		require.Equal(t, uint64(1000+i), entryNumber)
+	}
+	require.NoError(t, server.CommitAtomicOp())
+	header := server.GetHeader()
+	require.Equal(t, uint64(1000), header.BaseEntry)
+	require.Equal(t, uint64(1010), header.TotalEntries)
+
+	// Case: Get entry below the base entry -> ERROR
+	_, err := server.GetEntry(999)
+	require.ErrorIs(t, err, datastreamer.ErrInvalidEntryNumber)
+	entry, err := server.GetEntry(1000)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), entry.Number)
+
+	// Case: Set base entry of a started server -> ERROR
+	require.ErrorIs(t, server.SetBaseEntry(2000), datastreamer.ErrBaseEntryNotAllowed)
+
+	newClient := func() *datastreamer.StreamClient {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		require.NoError(t, client.Start())
+		return client
+	}
+
+	// Case: Get header command -> base entry returned
+	client := newClient()
+	clientHeader, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), clientHeader.BaseEntry)
+	require.Equal(t, uint64(1010), clientHeader.TotalEntries)
+
+	// Case: Header command of a legacy client -> Header without the base entry, with it once versioned
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	require.NoError(t, err)
+	defer conn.Close()
+	readHeaderLength := func(cmd datastreamer.Command, extra int) uint32 {
+		command := binary.BigEndian.AppendUint64(nil, uint64(cmd))
+		_, err := conn.Write(binary.BigEndian.AppendUint64(command, uint64(streamType)))
+		require.NoError(t, err)
+		result := make([]byte, 1+4+4+len("OK"))
+		_, err = io.ReadFull(conn, result)
+		require.NoError(t, err)
+		header := make([]byte, 5)
+		_, err = io.ReadFull(conn, header)
+		require.NoError(t, err)
+		require.Equal(t, uint8(datastreamer.PtHeader), header[0])
+		length := binary.BigEndian.Uint32(header[1:])
+		_, err = io.ReadFull(conn, make([]byte, int(length)-len(header)+extra))
+		require.NoError(t, err)
+		return length
+	}
+	require.Equal(t, uint32(38), readHeaderLength(datastreamer.CmdHeader, 0))
+	require.Equal(t, uint32(46), readHeaderLength(datastreamer.CmdHeader|datastreamer.CmdFlagVersioned, 4))
+	require.Equal(t, uint32(46), readHeaderLength(datastreamer.CmdHeader, 0))
+
+	// Case: Start streaming below the base entry -> ERROR
+	require.ErrorIs(t, newClient().ExecCommandStart(999), datastreamer.ErrResultCommandError)
+
+	// Case: Start streaming from the base entry -> entries from the base entry
+	var mutex sync.Mutex
+	received := []uint64{}
+	client = newClient()
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		mutex.Lock()
+		received = append(received, e.Number)
+		mutex.Unlock()
+		return nil
+	})
+	require.NoError(t, client.ExecCommandStart(1000))
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 10
+	}, 2*time.Second, 10*time.Millisecond)
+	mutex.Lock()
+	for i, number := range received {
+		require.Equal(t, uint64(1000+i), number)
+	}
+	mutex.Unlock()
+
+	// Case: Reopen the stream file -> base entry kept
+	require.NoError(t, server.Shutdown(time.Second))
+	require.NoError(t, server.Close())
+	server = openTestServer(t, port, fileName)
+	header = server.GetHeader()
+	require.Equal(t, uint64(1000), header.BaseEntry)
+	require.Equal(t, uint64(1010), header.TotalEntries)
+}
@@ -0,0 +1,161 @@
+package datastreamer
+
+import (
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	defaultBatchSize    = 1000                   // Default maximum entries of a batch
+	defaultBatchLatency = 100 * time.Millisecond // Default maximum wait of the first entry of a batch
+)
+
+// ProcessBatchFunc type of the callback function to process a batch of received entries, in order
+type ProcessBatchFunc func([]FileEntry, *StreamClient, *StreamServer) error
+
+// batchDelivery type for the delivery of the streaming entries in batches to the process batch function
+type batchDelivery struct {
+	process    ProcessBatchFunc
+	maxSize    int
+	maxLatency time.Duration
+
+	entries []FileEntry // Entries of the batch pending
+	timer   *time.Timer // Latency of the batch pending since its first entry (nil if none pending)
+}
+
+// SetProcessBatchFunc sets the callback function to process the streaming entries in batches instead of one by one
+// (SetProcessEntryFunc), e.g. to amortize the bulk inserts into a database. A batch is delivered once it has maxSize
+// entries (1000 if 0), or maxLatency (100ms if 0) after its first entry was received, and before a stop is
+// acknowledged (see SetStopDrain). The entries are delivered in order from the consumer goroutine, so the workers
+// and the prefetch aren't used. The process error policy applies to the whole batch: the restart and the dead-letter
+// policies process the batch again, and the dead-letter sink receives each entry of the batch. The checkpoint
+// advances once a batch is processed. The subscriptions keep their process entry functions. A nil function disables
+// it (call before Start)
+func (c *StreamClient) SetProcessBatchFunc(f ProcessBatchFunc, maxSize int, maxLatency time.Duration) {
+	if f == nil {
+		c.batch = nil
+		return
+	}
+	if maxSize <= 0 {
+		maxSize = defaultBatchSize
+	}
+	if maxLatency <= 0 {
+		maxLatency = defaultBatchLatency
+	}
+	c.batch = &batchDelivery{
+		process:    f,
+		maxSize:    maxSize,
+		maxLatency: maxLatency,
+		entries:    make([]FileEntry, 0, maxSize),
+	}
+}
+
+// addToBatch adds a streaming entry to the batch pending, delivered once full. Returns the error stopping the
+// streaming
+func (c *StreamClient) addToBatch(e *FileEntry) error {
+	b := c.batch
+	if len(b.entries) == 0 {
+		b.timer = time.NewTimer(b.maxLatency)
+	}
+	b.entries = append(b.entries, *e)
+	if len(b.entries) < b.maxSize {
+		return nil
+	}
+	return c.flushBatch()
+}
+
+// flushBatch delivers the batch pending (if any) to the process batch function. Returns the error stopping the
+// streaming
+func (c *StreamClient) flushBatch() error {
+	b := c.batch
+	if b == nil || len(b.entries) == 0 {
+		return nil
+	}
+	b.timer.Stop()
+	b.timer = nil
+	entries := b.entries
+	b.entries = make([]FileEntry, 0, b.maxSize)
+
+	first, last := entries[0].Number, entries[len(entries)-1].Number
+	c.slow.begin(first)
+	err := c.processBatchWithPolicy(entries)
+	c.slow.end()
+	if err != nil {
+		log.Errorf("%s Processing batch of entries %d to %d: %s. Exiting getStream function", c.ID, first, last,
+			err.Error())
+		return err
+	}
+	c.checkpoint.entryProcessed(last)
+	return nil
+}
+
+// batchExpired returns the channel signaled once the batch pending reaches its maximum latency (nil if none pending)
+func (c *StreamClient) batchExpired() <-chan time.Time {
+	if c.batch == nil || c.batch.timer == nil {
+		return nil
+	}
+	return c.batch.timer.C
+}
+
+// processBatchWithPolicy processes a batch with the process batch function applying the process error policy.
+// Returns the error stopping the streaming (nil to continue)
+func (c *StreamClient) processBatchWithPolicy(entries []FileEntry) error {
+	backoff := c.policy.backoff
+	for retry := 0; ; retry++ {
+		if retry > 0 {
+			for range entries {
+				c.stats.entryReprocessed()
+			}
+		}
+		start := time.Now()
+		err := c.batch.process(entries, c, c.relayServer)
+		latency := time.Since(start) / time.Duration(len(entries))
+		for range entries {
+			c.stats.entryProcessed(latency)
+		}
+		if err == nil {
+			for range entries {
+				c.stats.entryDelivered()
+			}
+			return nil
+		}
+		c.stats.addError(StatErrProcess, err)
+
+		switch c.policy.policy {
+		case ProcessErrSkip:
+			log.Warnf("%s Processing batch from entry %d: %v. Batch skipped", c.ID, entries[0].Number, err)
+			c.dropBatch(entries, StatDropSkipped)
+			return nil
+
+		case ProcessErrRestart, ProcessErrDeadLetter:
+			if c.policy.policy == ProcessErrDeadLetter && retry >= c.policy.retries {
+				for i := range entries {
+					errSink := c.quarantine(&entries[i], err)
+					if errSink != nil {
+						return errSink
+					}
+				}
+				return nil
+			}
+			log.Warnf("%s Processing batch from entry %d: %v. Processing it again in %v", c.ID, entries[0].Number,
+				err, backoff)
+			if !c.wait(backoff) {
+				c.dropBatch(entries, StatDropStop)
+				return nil
+			}
+			backoff = min(2*backoff, maxProcessBackoff) //nolint:mnd
+
+		default:
+			c.dropBatch(entries, StatDropError)
+			return err
+		}
+	}
+}
+
+// dropBatch records the entries of a batch not delivered
+func (c *StreamClient) dropBatch(entries []FileEntry, reason string) {
+	for range entries {
+		c.stats.entryDropped(reason)
+	}
+}
@@ -0,0 +1,74 @@
+package datastreamer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientProcessBatch(t *testing.T) {
+	server, port := newTestServer(t, "batch.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 25)
+
+	batches := make(chan []uint64, 10)
+	failures := 1
+	process := func(entries []datastreamer.FileEntry, _ *datastreamer.StreamClient, _ *datastreamer.StreamServer) error {
+		if len(entries) < 10 && failures > 0 {
+			failures--
+			return errors.New("bulk insert failed")
+		}
+		numbers := make([]uint64, 0, len(entries))
+		for _, e := range entries {
+			numbers = append(numbers, e.Number)
+		}
+		batches <- numbers
+		return nil
+	}
+	requireBatch := func(from uint64, to uint64) {
+		select {
+		case numbers := <-batches:
+			expected := []uint64{}
+			for number := from; number < to; number++ {
+				expected = append(expected, number)
+			}
+			require.Equal(t, expected, numbers)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for the batch from entry %d", from)
+		}
+	}
+
+	// Case: Batches full delivered right away, the last partial one once its latency elapsed
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+		datastreamer.WithProcessBatchFunc(process, 10, 50*time.Millisecond))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	client.SetProcessErrorPolicy(datastreamer.ProcessErrRestart, 10*time.Millisecond)
+	client.SetStopDrain(datastreamer.StopDrain)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	requireBatch(0, 10)
+	requireBatch(10, 20)
+
+	// Case: Batch failed with the restart policy -> Processed again as a whole
+	requireBatch(20, 25)
+	stats := client.GetStats()
+	require.Equal(t, uint64(25), stats.Delivered)
+	require.Equal(t, uint64(5), stats.Reprocessed)
+	require.Equal(t, uint64(1), stats.Errors[datastreamer.StatErrProcess])
+
+	// Case: Stop draining -> Batch pending delivered before the stop is acknowledged
+	require.NoError(t, client.ExecCommandStop())
+	require.NoError(t, client.ExecCommandStart(22))
+	ack, err := client.ExecCommandStopAck(context.Background())
+	require.NoError(t, err)
+	if ack.NextEntry > 22 {
+		requireBatch(22, ack.NextEntry)
+	}
+	require.Empty(t, batches)
+}
@@ -23,7 +23,7 @@ func NewBookmark(fn string) (*StreamBookmark, error) {
 
 	// Open (or create) the bookmarks database
 	log.Infof("Opening/creating bookmarks DB for datastream: %s", fn)
-	db, err := leveldb.OpenFile(fn, nil)
+	db, err := leveldb.OpenFile(fn, dbOptions())
 	if err != nil {
 		log.Errorf("Error opening or creating bookmarks DB %s: %v", fn, err)
 		return nil, err
@@ -86,7 +86,7 @@ func (b *StreamBookmark) PrintDump() error {
 		bookmark := iter.Key()
 		entry := iter.Value()
 		entryNum := binary.BigEndian.Uint64(entry)
-		log.Debugf("Bookmark[%v] value[%d]", bookmark, entryNum)
+		log.Debugf("Bookmark[%s] value[%s]", FormatBookmark(bookmark), FormatEntryNumber(entryNum))
 	}
 
 	// Check if error
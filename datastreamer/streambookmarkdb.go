@@ -0,0 +1,134 @@
+package datastreamer
+
+import (
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Compression algorithms of the bookmarks DB
+const (
+	DBCompressionSnappy = "snappy" // DBCompressionSnappy for the snappy compression of the table blocks (default)
+	DBCompressionNone   = "none"   // DBCompressionNone for the table blocks not compressed
+)
+
+// BookmarkDBOptions type for the storage options of the bookmarks DB (leveldb), 0 or empty for the defaults
+type BookmarkDBOptions struct {
+	Compression         string // Compression of the table blocks: snappy (default) or none
+	BlockSize           int    // Minimum uncompressed size of the table blocks (4 KiB if 0)
+	WriteBuffer         int    // Size of the memtable before it's written to a level 0 table (4 MiB if 0)
+	CompactionTableSize int    // Size of the tables written by the compactions, 10x per level (2 MiB if 0)
+	CompactionTotalSize int    // Total size of the level 1 tables before compacting them, 10x per level (10 MiB if 0)
+	CompactionL0Trigger int    // Number of level 0 tables triggering a compaction (4 if 0)
+	BloomFilterBits     int    // Bits per key of the bloom filter of the tables, for the lookups (0 none)
+}
+
+// BookmarkDBStats type for the size and compaction metrics of the bookmarks DB
+type BookmarkDBStats struct {
+	Size            int64         `json:"size"`            // Size of the tables
+	LevelSizes      []int64       `json:"levelSizes"`      // Size of the tables by level
+	LevelTables     []int         `json:"levelTables"`     // Number of tables by level
+	CompactionRead  int64         `json:"compactionRead"`  // Bytes read by the compactions
+	CompactionWrite int64         `json:"compactionWrite"` // Bytes written by the compactions
+	CompactionTime  time.Duration `json:"compactionTime"`  // Time of the compactions
+	Compactions     uint32        `json:"compactions"`     // Compactions of the memtable, the levels and by seeks
+	WriteDelays     int32         `json:"writeDelays"`     // Writes delayed by the compactions
+	WriteDelayTime  time.Duration `json:"writeDelayTime"`  // Time of the writes delayed by the compactions
+}
+
+// SetBookmarkDBOptions sets the storage options of the bookmarks DB of the stream (compression and compaction
+// tuning), reopening it with them, e.g. larger tables and write buffer for the archives with tens of GB of bookmarks
+// (fewer files and compactions), or a bloom filter for the bookmark lookups. The tables already written keep their
+// options until compacted (see CompactBookmarks) (call before Start)
+func (s *StreamServer) SetBookmarkDBOptions(options BookmarkDBOptions) error {
+	if s.started {
+		return ErrBookmarkDBOptionsNotAllowed
+	}
+	dbOpts, err := options.dbOptions()
+	if err != nil {
+		return err
+	}
+
+	err = s.bookmark.db.Close()
+	if err != nil {
+		return err
+	}
+	log.Infof("Reopening bookmarks DB %s with options %+v", s.bookmark.dbName, options)
+	db, err := leveldb.OpenFile(s.bookmark.dbName, dbOpts)
+	if err != nil {
+		log.Errorf("Error reopening bookmarks DB %s: %v", s.bookmark.dbName, err)
+		return err
+	}
+	s.bookmark.db = db
+	return nil
+}
+
+// SetBookmarkDBOptions sets the storage options of the bookmarks DB of the relay server side (call before Start)
+func (r *StreamRelay) SetBookmarkDBOptions(options BookmarkDBOptions) error {
+	return r.server.SetBookmarkDBOptions(options)
+}
+
+// CompactBookmarks compacts all the bookmarks DB, rewriting its tables with the current options (e.g. after changing
+// the compression). It blocks until done, the bookmarks DB keeps serving meanwhile
+func (s *StreamServer) CompactBookmarks() error {
+	log.Infof("Compacting bookmarks DB %s", s.bookmark.dbName)
+	start := time.Now()
+	err := s.bookmark.db.CompactRange(util.Range{})
+	if err != nil {
+		log.Errorf("Error compacting bookmarks DB %s: %v", s.bookmark.dbName, err)
+		return err
+	}
+	log.Infof("Bookmarks DB %s compacted in %v", s.bookmark.dbName, time.Since(start))
+	return nil
+}
+
+// GetBookmarkDBStats returns the size and compaction metrics of the bookmarks DB
+func (s *StreamServer) GetBookmarkDBStats() (BookmarkDBStats, error) {
+	var dbStats leveldb.DBStats
+	err := s.bookmark.db.Stats(&dbStats)
+	if err != nil {
+		return BookmarkDBStats{}, err
+	}
+
+	stats := BookmarkDBStats{
+		Size:            dbStats.LevelSizes.Sum(),
+		LevelSizes:      dbStats.LevelSizes,
+		LevelTables:     dbStats.LevelTablesCounts,
+		CompactionRead:  dbStats.LevelRead.Sum(),
+		CompactionWrite: dbStats.LevelWrite.Sum(),
+		Compactions:     dbStats.MemComp + dbStats.Level0Comp + dbStats.NonLevel0Comp + dbStats.SeekComp,
+		WriteDelays:     dbStats.WriteDelayCount,
+		WriteDelayTime:  dbStats.WriteDelayDuration,
+	}
+	for _, d := range dbStats.LevelDurations {
+		stats.CompactionTime += d
+	}
+	return stats, nil
+}
+
+// dbOptions returns the leveldb options of the bookmarks DB storage options
+func (o BookmarkDBOptions) dbOptions() (*opt.Options, error) {
+	dbOpts := dbOptions()
+	switch o.Compression {
+	case "", DBCompressionSnappy:
+		dbOpts.Compression = opt.SnappyCompression
+	case DBCompressionNone:
+		dbOpts.Compression = opt.NoCompression
+	default:
+		log.Errorf("Invalid bookmarks DB compression %s", o.Compression)
+		return nil, ErrInvalidDBCompression
+	}
+	dbOpts.BlockSize = max(o.BlockSize, 0)
+	dbOpts.WriteBuffer = max(o.WriteBuffer, 0)
+	dbOpts.CompactionTableSize = max(o.CompactionTableSize, 0)
+	dbOpts.CompactionTotalSize = max(o.CompactionTotalSize, 0)
+	dbOpts.CompactionL0Trigger = max(o.CompactionL0Trigger, 0)
+	if o.BloomFilterBits > 0 {
+		dbOpts.Filter = filter.NewBloomFilter(o.BloomFilterBits)
+	}
+	return dbOpts, nil
+}
@@ -0,0 +1,47 @@
+package datastreamer_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerBookmarkDBOptions(t *testing.T) {
+	server, _ := newTestServer(t, "bookmarkdb.bin")
+
+	// Case: Unknown compression -> Error
+	err := server.SetBookmarkDBOptions(datastreamer.BookmarkDBOptions{Compression: "zstd"})
+	require.ErrorIs(t, err, datastreamer.ErrInvalidDBCompression)
+
+	// Case: Bookmarks DB reopened with the options -> Bookmarks written to its tables
+	err = server.SetBookmarkDBOptions(datastreamer.BookmarkDBOptions{
+		Compression:     datastreamer.DBCompressionNone,
+		WriteBuffer:     64 * 1024,
+		BloomFilterBits: 10,
+	})
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	require.ErrorIs(t, server.SetBookmarkDBOptions(datastreamer.BookmarkDBOptions{}),
+		datastreamer.ErrBookmarkDBOptionsNotAllowed)
+
+	require.NoError(t, server.StartAtomicOp())
+	for i := uint64(0); i < 5000; i++ {
+		_, err = server.AddStreamBookmark(binary.BigEndian.AppendUint64([]byte{0}, i))
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.CommitAtomicOp())
+	require.NoError(t, server.CompactBookmarks())
+	entryNum, err := server.GetBookmark(binary.BigEndian.AppendUint64([]byte{0}, 1234))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), entryNum)
+
+	// Case: Size and compaction metrics -> In the server stats
+	dbStats, err := server.GetBookmarkDBStats()
+	require.NoError(t, err)
+	require.Greater(t, dbStats.Size, int64(5000*8))
+	require.NotZero(t, dbStats.Compactions)
+	require.NotZero(t, dbStats.CompactionWrite)
+	require.Equal(t, dbStats.Size, server.GetStats().BookmarkDB.Size)
+}
@@ -0,0 +1,64 @@
+package datastreamer
+
+import (
+	"fmt"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// circuitBreaker type for the circuit breaker of the client on the repeated rejections of the server
+type circuitBreaker struct {
+	maxFailures int
+	onOpen      func(error)
+	failures    int // Rejections in a row
+}
+
+// SetCircuitBreaker sets the client to stop after maxFailures rejections in a row by the server of the connection
+// restored, instead of retrying forever: the credentials rejected (Auth command) or the streaming restored on
+// reconnection rejected (Start command, e.g. the next entry pruned from the server). Once opened, the hook (if not
+// nil) is called with an error wrapping ErrCircuitOpen and the latest rejection, and the client is stopped with it
+// (returned by Run or Start, ending the subscriptions), so the orchestration can intervene. A connection restored
+// resets the count. 0 disables it (call before Start)
+func (c *StreamClient) SetCircuitBreaker(maxFailures int, onOpen func(error)) {
+	if maxFailures <= 0 {
+		c.breaker = nil
+		return
+	}
+	c.breaker = &circuitBreaker{
+		maxFailures: maxFailures,
+		onOpen:      onOpen,
+	}
+}
+
+// SetCircuitBreaker sets the relay to stop after repeated rejections of the master server (see
+// StreamClient.SetCircuitBreaker)
+func (r *StreamRelay) SetCircuitBreaker(maxFailures int, onOpen func(error)) {
+	r.client.SetCircuitBreaker(maxFailures, onOpen)
+}
+
+// fail records a rejection of the server. Returns the error stopping the client once the breaker opens (nil before)
+func (b *circuitBreaker) fail(c *StreamClient, err error) error {
+	if b == nil {
+		return nil
+	}
+	b.failures++
+	if b.failures < b.maxFailures {
+		log.Warnf("%s Server %s rejection %d of %d: %v", c.ID, c.serverAddr(), b.failures, b.maxFailures, err)
+		return nil
+	}
+
+	errOpen := fmt.Errorf("%w after %d rejections in a row: %w", ErrCircuitOpen, b.failures, err)
+	log.Errorf("%s Stopping client, server %s: %v", c.ID, c.serverAddr(), errOpen)
+	b.failures = 0
+	if b.onOpen != nil {
+		b.onOpen(errOpen)
+	}
+	return errOpen
+}
+
+// reset resets the rejections in a row, once the connection is restored
+func (b *circuitBreaker) reset() {
+	if b != nil {
+		b.failures = 0
+	}
+}
@@ -0,0 +1,74 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCircuitBreaker(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow integration test, skipped in short mode")
+	}
+	port := freePort(t)
+	address := fmt.Sprintf("localhost:%d", port)
+	newServer := func(entries int) *datastreamer.StreamServer {
+		server := openTestServer(t, port, t.TempDir()+"/breaker.bin")
+		server.SetAuthenticator(datastreamer.NewTokenAuthenticator([]byte("secret")))
+		require.NoError(t, server.Start())
+		addTestEntries(t, server, entries)
+		return server
+	}
+	server := newServer(3)
+
+	// Case: Credentials rejected on each attempt -> Breaker opens, hook called once, start fails
+	opened := make(chan error, 2)
+	client, err := datastreamer.NewClient(address, streamType, datastreamer.WithCredentials([]byte("wrong")),
+		datastreamer.WithReconnectPolicy(datastreamer.ReconnectPolicy{Backoff: 10 * time.Millisecond}),
+		datastreamer.WithCircuitBreaker(3, func(err error) { opened <- err }))
+	require.NoError(t, err)
+	err = client.Start()
+	require.ErrorIs(t, err, datastreamer.ErrCircuitOpen)
+	require.ErrorIs(t, err, datastreamer.ErrUnauthorized)
+	require.Equal(t, uint64(3), client.GetStats().Errors[datastreamer.StatErrAuth])
+	require.ErrorIs(t, <-opened, datastreamer.ErrCircuitOpen)
+	require.Empty(t, opened)
+
+	// Case: Streaming restored rejected by the server (entries lost) -> Breaker opens, client stopped
+	received := make(chan struct{}, 3)
+	client, err = datastreamer.NewClient(address, streamType, datastreamer.WithCredentials([]byte("secret")),
+		datastreamer.WithReconnectPolicy(datastreamer.ReconnectPolicy{Backoff: 10 * time.Millisecond}),
+		datastreamer.WithCircuitBreaker(1, func(err error) { opened <- err }))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	client.SetProcessEntryFunc(func(_ *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		received <- struct{}{}
+		return nil
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	for i := 0; i < 3; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for streaming entries")
+		}
+	}
+	run := make(chan error, 1)
+	go func() { run <- client.Run(context.Background()) }()
+	require.NoError(t, server.Shutdown(0))
+	newServer(1)
+	select {
+	case err = <-run:
+		require.ErrorIs(t, err, datastreamer.ErrCircuitOpen)
+		require.ErrorIs(t, err, datastreamer.ErrResultCommandError)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the circuit breaker")
+	}
+	require.ErrorIs(t, <-opened, datastreamer.ErrCircuitOpen)
+}
@@ -0,0 +1,162 @@
+package datastreamer
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	entryTypeContentRef EntryType = 1 << 31     // Flag of the entry type of the entries stored as a content reference
+	contentRefSize                = sha256.Size // Data length of a content reference (hash of the payload)
+)
+
+// StreamContent type to manage the content-addressed store of the entries payloads (hash -> payload)
+type StreamContent struct {
+	dbName string
+	db     *leveldb.DB
+}
+
+// NewContent opens or creates the content-addressed store database
+func NewContent(fn string) (*StreamContent, error) {
+	log.Infof("Opening/creating content DB for datastream: %s", fn)
+	db, err := leveldb.OpenFile(fn, dbOptions())
+	if err != nil {
+		log.Errorf("Error opening or creating content DB %s: %v", fn, err)
+		return nil, err
+	}
+	return &StreamContent{dbName: fn, db: db}, nil
+}
+
+// SetContentAddressing sets the server to store the payload of the data entries content-addressed (call before
+// adding entries). The stream file keeps a reference to the hash of the payload, so identical payloads are stored
+// only once in the content DB, and the entries are resolved to their payload when read. Bookmarks and payloads not
+// longer than a reference are stored as is. It must stay enabled to read a stream file written with it
+func (s *StreamServer) SetContentAddressing(enabled bool) error {
+	if !enabled {
+		if s.content != nil {
+			err := s.content.db.Close()
+			s.content = nil
+			return err
+		}
+		return nil
+	}
+	if s.content != nil {
+		return nil
+	}
+
+	name := s.fileName[0:strings.LastIndex(s.fileName, ".")] + ".cas"
+	content, err := NewContent(name)
+	if err != nil {
+		return err
+	}
+	s.content = content
+	return nil
+}
+
+// isContentRef checks if a file entry is stored as a reference to its payload
+func isContentRef(e *FileEntry) bool {
+	return e.Type&entryTypeContentRef != 0 && e.Type != EntryTypeNotFound && len(e.Data) == contentRefSize
+}
+
+// reference stores the payload of a data entry and returns the file entry referencing it. Bookmarks and payloads
+// not longer than a reference are returned as is
+func (c *StreamContent) reference(e FileEntry) (FileEntry, error) {
+	if e.Type == EtBookmark || len(e.Data) <= contentRefSize {
+		return e, nil
+	}
+
+	hash, err := c.put(e.Data)
+	if err != nil {
+		return e, err
+	}
+	e.Type |= entryTypeContentRef
+	e.Data = hash
+	e.Length = FixedSizeFileEntry + contentRefSize
+	return e, nil
+}
+
+// put stores a payload (if not already stored) and returns its hash
+func (c *StreamContent) put(payload []byte) ([]byte, error) {
+	sum := sha256.Sum256(payload)
+	hash := sum[:]
+
+	found, err := c.db.Has(hash, nil)
+	if err != nil {
+		log.Errorf("Error checking content [%x]: %v", hash, err)
+		return nil, err
+	}
+	if found {
+		log.Debugf("Content [%x] already stored", hash)
+		return hash, nil
+	}
+
+	err = c.db.Put(hash, payload, nil)
+	if err != nil {
+		log.Errorf("Error storing content [%x]: %v", hash, err)
+		return nil, err
+	}
+	return hash, nil
+}
+
+// resolve replaces the data of a file entry stored as a reference with its payload
+func (c *StreamContent) resolve(e *FileEntry) error {
+	if c == nil || !isContentRef(e) {
+		return nil
+	}
+
+	payload, err := c.db.Get(e.Data, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		log.Errorf("Content [%x] of entry %d not found", e.Data, e.Number)
+		return ErrContentNotFound
+	} else if err != nil {
+		log.Errorf("Error getting content [%x] of entry %d: %v", e.Data, e.Number, err)
+		return err
+	}
+	e.Type &^= entryTypeContentRef
+	e.Data = payload
+	e.Length = FixedSizeFileEntry + uint32(len(payload))
+	return nil
+}
+
+// checkEntryType checks the entry type of a new data entry doesn't use the content reference flag
+func (c *StreamContent) checkEntryType(etype EntryType) error {
+	if c != nil && etype&entryTypeContentRef != 0 && etype != EtBookmark {
+		log.Errorf("Entry type %d reserved for content-addressed entries", etype)
+		return ErrReservedEntryType
+	}
+	return nil
+}
+
+// updateReference stores the new payload of a data entry stored as a reference, and returns the entry type and the
+// data to update in the file. The entries not stored as a reference are returned as is
+func (c *StreamContent) updateReference(current FileEntry, etype EntryType, data []byte) (EntryType, []byte, error) {
+	if c == nil || !isContentRef(&current) {
+		return etype, data, nil
+	}
+
+	// Same checks as the update of an entry stored as is
+	if current.Type&^entryTypeContentRef != etype {
+		log.Infof("Updating entry to a different entry type not allowed. Current[%d] Update[%d]",
+			current.Type&^entryTypeContentRef, etype)
+		return etype, data, ErrUpdateEntryTypeNotAllowed
+	}
+	err := c.resolve(&current)
+	if err != nil {
+		return etype, data, err
+	}
+	if len(current.Data) != len(data) {
+		log.Infof("Updating entry data to a different length not allowed. Current[%d] Update[%d]",
+			len(current.Data), len(data))
+		return etype, data, ErrUpdateEntryDifferentSize
+	}
+
+	hash, err := c.put(data)
+	if err != nil {
+		return etype, data, err
+	}
+	return etype | entryTypeContentRef, hash, nil
+}
@@ -0,0 +1,120 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentAddressing(t *testing.T) {
+	server, port := newTestServer(t, "content.bin")
+	require.NoError(t, server.SetContentAddressing(true))
+	require.NoError(t, server.Start())
+
+	// Blocks of a bookmark followed by a repeated payload and a short payload
+	payload := []byte(strings.Repeat("empty block ", 10))
+	short := []byte{0x01, 0x02}
+	addBlocks := func(from int, to int) {
+		require.NoError(t, server.StartAtomicOp())
+		for i := from; i < to; i++ {
+			_, err := server.AddStreamBookmark([]byte{0, byte(i)})
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType1, payload)
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType2, short)
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+	addBlocks(0, 4)
+
+	// Case: Repeated payload stored as a reference -> Only the hash in the stream file
+	header := server.GetHeader()
+	require.Equal(t, uint64(12), header.TotalEntries)
+	require.Equal(t, uint64(datastreamer.PageHeaderSize+4*(3*datastreamer.FixedSizeFileEntry+2+32+2)),
+		header.TotalLength)
+
+	// Case: Get entries -> Resolved to their payload
+	entry, err := server.GetEntry(1)
+	require.NoError(t, err)
+	require.Equal(t, entryType1, entry.Type)
+	require.Equal(t, payload, entry.Data)
+	require.Equal(t, uint32(datastreamer.FixedSizeFileEntry+len(payload)), entry.Length)
+	entry, err = server.GetEntry(2)
+	require.NoError(t, err)
+	require.Equal(t, entryType2, entry.Type)
+	require.Equal(t, short, entry.Data)
+
+	entry, err = server.GetFirstEventAfterBookmark([]byte{0, 1})
+	require.NoError(t, err)
+	require.Equal(t, payload, entry.Data)
+
+	data, err := server.GetDataBetweenBookmarks([]byte{0, 0}, []byte{0, 2})
+	require.NoError(t, err)
+	require.Equal(t, append(append(append(append([]byte{}, payload...), short...), payload...), short...), data)
+
+	// Case: Update a referenced entry -> New payload resolved
+	updated := []byte(strings.Repeat("updated blk ", 10))
+	require.NoError(t, server.UpdateEntryData(4, entryType1, updated))
+	entry, err = server.GetEntry(4)
+	require.NoError(t, err)
+	require.Equal(t, updated, entry.Data)
+	entry, err = server.GetEntry(1)
+	require.NoError(t, err)
+	require.Equal(t, payload, entry.Data)
+
+	// Case: Update a referenced entry to a different size or type -> FAIL
+	err = server.UpdateEntryData(4, entryType1, short)
+	require.ErrorIs(t, err, datastreamer.ErrUpdateEntryDifferentSize)
+	err = server.UpdateEntryData(4, entryType2, updated)
+	require.ErrorIs(t, err, datastreamer.ErrUpdateEntryTypeNotAllowed)
+
+	// Case: Entry type with the reserved flag -> FAIL
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamEntry(datastreamer.EntryType(1<<31|1), payload)
+	require.ErrorIs(t, err, datastreamer.ErrReservedEntryType)
+	require.NoError(t, server.RollbackAtomicOp())
+
+	// Case: Catch-up and broadcast -> Entries received resolved to their payload
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	var mutex sync.Mutex
+	received := make(map[uint64][]byte)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		mutex.Lock()
+		received[e.Number] = append([]byte{}, e.Data...)
+		mutex.Unlock()
+		return nil
+	})
+	require.NoError(t, client.Start())
+
+	entry, err = client.ExecCommandGetEntry(7)
+	require.NoError(t, err)
+	require.Equal(t, payload, entry.Data)
+
+	require.NoError(t, client.ExecCommandStart(0))
+	addBlocks(4, 6)
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 18
+	}, 2*time.Second, 10*time.Millisecond)
+	for i := uint64(0); i < 18; i++ {
+		switch {
+		case i == 4:
+			require.Equal(t, updated, received[i])
+		case i%3 == 1:
+			require.Equal(t, payload, received[i])
+		case i%3 == 2:
+			require.Equal(t, short, received[i])
+		}
+	}
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
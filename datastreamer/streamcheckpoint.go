@@ -0,0 +1,452 @@
+package datastreamer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	checkpointKeyPrefix  = 'c' // Key prefix of the checkpoint roots in the checkpoints DB (followed by the index)
+	checkpointKeyConfig  = 'i' // Key of the checkpoints interval in the checkpoints DB
+	checkpointLeafPrefix = 0x00
+	checkpointNodePrefix = 0x01
+)
+
+// CheckpointProof type for the Merkle inclusion proof of an entry in the root of its checkpoint
+type CheckpointProof struct {
+	Checkpoint uint64   `json:"checkpoint"` // Index of the checkpoint
+	FromEntry  uint64   `json:"fromEntry"`  // First entry number of the checkpoint range
+	Entries    uint64   `json:"entries"`    // Number of entries of the checkpoint range
+	Root       []byte   `json:"root"`       // Merkle root of the checkpoint range
+	Entry      uint64   `json:"entry"`      // Entry number proved
+	Path       [][]byte `json:"path"`       // Sibling hashes from the leaf of the entry up to the root
+}
+
+// StreamCheckpoints type to manage the Merkle roots of the stream ranges of a fixed number of entries
+type StreamCheckpoints struct {
+	dbName   string
+	db       *leveldb.DB
+	interval uint64 // Number of entries of each checkpoint range
+
+	mutex sync.Mutex
+	count uint64 // Number of checkpoints stored
+}
+
+// SetCheckpoints sets the server to compute and store every interval entries (from the base entry) the Merkle root
+// over the range, in a checkpoints DB (<file>.ckp), so the clients can get with the CheckpointProof command the proof
+// of inclusion of an entry in its checkpoint root. The checkpoints of the committed entries are computed on the call
+// (and recomputed when the interval changes), 0 disables it (call before Start)
+func (s *StreamServer) SetCheckpoints(interval uint64) error {
+	if s.checkpoints != nil {
+		err := s.checkpoints.db.Close()
+		s.checkpoints = nil
+		if err != nil || interval == 0 {
+			return err
+		}
+	}
+	if interval == 0 {
+		return nil
+	}
+
+	name := s.fileName[0:strings.LastIndex(s.fileName, ".")] + ".ckp"
+	checkpoints, err := NewCheckpoints(name, interval)
+	if err != nil {
+		return err
+	}
+	s.checkpoints = checkpoints
+
+	return s.updateCheckpoints()
+}
+
+// SetCheckpoints sets the relay server side to compute the checkpoints of the stream (call before Start)
+func (r *StreamRelay) SetCheckpoints(interval uint64) error {
+	return r.server.SetCheckpoints(interval)
+}
+
+// NewCheckpoints opens or creates the checkpoints database, the checkpoints of a different interval are deleted
+func NewCheckpoints(fn string, interval uint64) (*StreamCheckpoints, error) {
+	log.Infof("Opening/creating checkpoints DB for datastream: %s", fn)
+	db, err := leveldb.OpenFile(fn, dbOptions())
+	if err != nil {
+		log.Errorf("Error opening or creating checkpoints DB %s: %v", fn, err)
+		return nil, err
+	}
+	c := StreamCheckpoints{dbName: fn, db: db, interval: interval}
+
+	// Check the interval of the checkpoints stored
+	config := binary.BigEndian.AppendUint64(nil, interval)
+	stored, err := db.Get([]byte{checkpointKeyConfig}, nil)
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		_ = db.Close()
+		return nil, err
+	}
+	if !bytes.Equal(stored, config) {
+		err = c.truncate(0)
+		if err == nil {
+			err = db.Put([]byte{checkpointKeyConfig}, config, nil)
+		}
+		if err != nil {
+			log.Errorf("Error resetting checkpoints DB %s: %v", fn, err)
+			_ = db.Close()
+			return nil, err
+		}
+		return &c, nil
+	}
+
+	// Number of checkpoints stored
+	iter := db.NewIterator(util.BytesPrefix([]byte{checkpointKeyPrefix}), nil)
+	if iter.Last() {
+		c.count = binary.BigEndian.Uint64(iter.Key()[1:]) + 1
+	}
+	iter.Release()
+	return &c, iter.Error()
+}
+
+// checkpointKey returns the key of a checkpoint root in the checkpoints DB
+func checkpointKey(index uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{checkpointKeyPrefix}, index)
+}
+
+// getCount returns the number of checkpoints stored
+func (c *StreamCheckpoints) getCount() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.count
+}
+
+// put stores the root of a checkpoint
+func (c *StreamCheckpoints) put(index uint64, root []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.db.Put(checkpointKey(index), root, nil)
+	if err != nil {
+		return err
+	}
+	c.count = max(c.count, index+1)
+	return nil
+}
+
+// get returns the root of a checkpoint
+func (c *StreamCheckpoints) get(index uint64) ([]byte, error) {
+	return c.db.Get(checkpointKey(index), nil)
+}
+
+// truncate deletes the checkpoints from an index onwards
+func (c *StreamCheckpoints) truncate(index uint64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	batch := new(leveldb.Batch)
+	iter := c.db.NewIterator(&util.Range{Start: checkpointKey(index), Limit: []byte{checkpointKeyPrefix + 1}}, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	err := iter.Error()
+	if err == nil {
+		err = c.db.Write(batch, nil)
+	}
+	if err != nil {
+		return err
+	}
+	c.count = min(c.count, index)
+	return nil
+}
+
+// updateCheckpoints computes the checkpoints completed by the committed entries
+func (s *StreamServer) updateCheckpoints() error {
+	if s.checkpoints == nil {
+		return nil
+	}
+
+	header := s.streamFile.getHeaderEntry()
+	completed := (header.TotalEntries - header.BaseEntry) / s.checkpoints.interval
+	for index := s.checkpoints.getCount(); index < completed; index++ {
+		err := s.computeCheckpoint(index)
+		if err != nil {
+			log.Errorf("Error computing checkpoint %d: %v", index, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// computeCheckpoint computes and stores the root of a checkpoint
+func (s *StreamServer) computeCheckpoint(index uint64) error {
+	leaves, err := s.checkpointLeaves(index)
+	if err != nil {
+		return err
+	}
+	root := merkleRoot(leaves)
+	log.Debugf("Checkpoint %d root [%x]", index, root)
+	return s.checkpoints.put(index, root)
+}
+
+// checkpointLeaves returns the leaf hashes of the entries of a checkpoint range
+func (s *StreamServer) checkpointLeaves(index uint64) ([][]byte, error) {
+	fromEntry := s.streamFile.getHeaderEntry().BaseEntry + index*s.checkpoints.interval
+
+	iterator, err := s.streamFile.iteratorFrom(fromEntry, true)
+	if err != nil {
+		return nil, err
+	}
+	defer s.streamFile.iteratorEnd(iterator)
+
+	leaves := make([][]byte, 0, s.checkpoints.interval)
+	for uint64(len(leaves)) < s.checkpoints.interval {
+		end, err := s.streamFile.iteratorNext(iterator)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return nil, ErrInvalidEntryNumber
+		}
+		err = s.content.resolve(&iterator.Entry)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, checkpointLeaf(iterator.Entry))
+	}
+	return leaves, nil
+}
+
+// truncateCheckpoints deletes the checkpoints not completed after a truncation of the stream file
+func (s *StreamServer) truncateCheckpoints() {
+	if s.checkpoints == nil {
+		return
+	}
+
+	header := s.streamFile.getHeaderEntry()
+	err := s.checkpoints.truncate((header.TotalEntries - header.BaseEntry) / s.checkpoints.interval)
+	if err != nil {
+		log.Errorf("Error truncating checkpoints from entry %d: %v", header.TotalEntries, err)
+	}
+}
+
+// updateEntryCheckpoint recomputes the checkpoint of an entry with its data updated
+func (s *StreamServer) updateEntryCheckpoint(entryNum uint64) {
+	if s.checkpoints == nil {
+		return
+	}
+
+	index := (entryNum - s.streamFile.getHeaderEntry().BaseEntry) / s.checkpoints.interval
+	if index >= s.checkpoints.getCount() {
+		return
+	}
+	err := s.computeCheckpoint(index)
+	if err != nil {
+		log.Errorf("Error recomputing checkpoint %d of entry %d: %v", index, entryNum, err)
+	}
+}
+
+// GetCheckpointProof returns the proof of inclusion of an entry in the root of its checkpoint
+func (s *StreamServer) GetCheckpointProof(entryNum uint64) (CheckpointProof, error) {
+	if s.checkpoints == nil {
+		return CheckpointProof{}, ErrCheckpointsNotEnabled
+	}
+	baseEntry := s.streamFile.getHeaderEntry().BaseEntry
+	if entryNum < baseEntry {
+		return CheckpointProof{}, ErrEntryNotCheckpointed
+	}
+	index := (entryNum - baseEntry) / s.checkpoints.interval
+	if index >= s.checkpoints.getCount() {
+		return CheckpointProof{}, ErrEntryNotCheckpointed
+	}
+
+	root, err := s.checkpoints.get(index)
+	if err != nil {
+		return CheckpointProof{}, err
+	}
+	leaves, err := s.checkpointLeaves(index)
+	if err != nil {
+		return CheckpointProof{}, err
+	}
+
+	proof := CheckpointProof{
+		Checkpoint: index,
+		FromEntry:  baseEntry + index*s.checkpoints.interval,
+		Entries:    s.checkpoints.interval,
+		Root:       root,
+		Entry:      entryNum,
+	}
+	proof.Path = merklePath(leaves, entryNum-proof.FromEntry)
+	return proof, nil
+}
+
+// Verify checks the proof of inclusion of an entry in the checkpoint root of the proof. The root must be checked
+// against a trusted one
+func (p CheckpointProof) Verify(e FileEntry) bool {
+	if e.Number != p.Entry || p.Entry < p.FromEntry || p.Entry-p.FromEntry >= p.Entries {
+		return false
+	}
+
+	hash := checkpointLeaf(e)
+	index, count := p.Entry-p.FromEntry, p.Entries
+	path := p.Path
+	for count > 1 {
+		if index%2 == 1 || index+1 < count {
+			if len(path) == 0 {
+				return false
+			}
+			if index%2 == 1 {
+				hash = merkleNode(path[0], hash)
+			} else {
+				hash = merkleNode(hash, path[0])
+			}
+			path = path[1:]
+		}
+		index, count = index/2, (count+1)/2 //nolint:mnd
+	}
+	return len(path) == 0 && bytes.Equal(hash, p.Root)
+}
+
+// checkpointLeaf returns the leaf hash of an entry: hash(0x00 | type | number | data)
+func checkpointLeaf(e FileEntry) []byte {
+	data := []byte{checkpointLeafPrefix}
+	data = binary.BigEndian.AppendUint32(data, uint32(e.Type))
+	data = binary.BigEndian.AppendUint64(data, e.Number)
+	data = append(data, e.Data...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// merkleNode returns the hash of an inner node: hash(0x01 | left | right)
+func merkleNode(left []byte, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, checkpointNodePrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// merkleLevel returns the parent level of a tree level, the odd node of a level is promoted
+func merkleLevel(level [][]byte) [][]byte {
+	parent := make([][]byte, 0, (len(level)+1)/2) //nolint:mnd
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			parent = append(parent, merkleNode(level[i], level[i+1]))
+		} else {
+			parent = append(parent, level[i])
+		}
+	}
+	return parent
+}
+
+// merkleRoot returns the Merkle root of the leaf hashes
+func merkleRoot(leaves [][]byte) []byte {
+	level := leaves
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	if len(level) == 0 {
+		return nil
+	}
+	return level[0]
+}
+
+// merklePath returns the sibling hashes from a leaf up to the root
+func merklePath(leaves [][]byte, index uint64) [][]byte {
+	path := [][]byte{}
+	level := leaves
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < uint64(len(level)) {
+			path = append(path, level[sibling])
+		}
+		level = merkleLevel(level)
+		index /= 2
+	}
+	return path
+}
+
+// handleCheckpointProofCommand processes the CmdCheckpointProof command
+func (s *StreamServer) handleCheckpointProofCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("CheckpointProof command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrCheckpointProofCommandNotAllowed
+	}
+
+	return s.processCmdCheckpointProof(cli)
+}
+
+// processCmdCheckpointProof processes the TCP CheckpointProof command from the clients
+func (s *StreamServer) processCmdCheckpointProof(client *client) error {
+	// Read entry number parameter
+	entryNum, err := readFullUint64(client)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command CheckpointProof entry %d", client.clientID, entryNum)
+
+	proof, err := s.GetCheckpointProof(entryNum)
+	if errors.Is(err, ErrCheckpointsNotEnabled) || errors.Is(err, ErrEntryNotCheckpointed) {
+		return s.sendResultEntry(uint32(CmdErrNoCheckpoint), StrCommandErrors[CmdErrNoCheckpoint], client)
+	}
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(proof)
+	}
+	if err != nil {
+		log.Errorf("Error getting checkpoint proof of entry %d for %s: %v", entryNum, client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the proof as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteTagged(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending checkpoint proof to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
+
+// ExecCommandGetCheckpointProof executes client TCP command to get the proof of inclusion of an entry in the root of
+// its checkpoint
+func (c *StreamClient) ExecCommandGetCheckpointProof(entryNum uint64) (CheckpointProof, error) {
+	return c.ExecCommandGetCheckpointProofContext(context.Background(), entryNum)
+}
+
+// ExecCommandGetCheckpointProofContext executes client TCP command to get the proof of inclusion of an entry in the
+// root of its checkpoint, canceled with the context
+func (c *StreamClient) ExecCommandGetCheckpointProofContext(ctx context.Context,
+	entryNum uint64) (CheckpointProof, error) {
+	proof := CheckpointProof{}
+	_, entry, err := c.execCommand(ctx, CmdCheckpointProof, false, entryNum, nil)
+	if err != nil {
+		return proof, err
+	}
+	err = json.Unmarshal(entry.Data, &proof)
+	return proof, err
+}
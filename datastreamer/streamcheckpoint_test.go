@@ -0,0 +1,89 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoints(t *testing.T) {
+	server, port := newTestServer(t, "checkpoints.bin")
+	require.NoError(t, server.SetCheckpoints(3))
+	require.NoError(t, server.Start())
+
+	require.NoError(t, server.StartAtomicOp())
+	for i := 0; i < 8; i++ {
+		_, err := server.AddStreamEntry(entryType1, testEntries[i%len(testEntries)].Encode())
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.CommitAtomicOp())
+
+	// Case: Proofs of the entries of the completed checkpoints -> verified
+	for entryNum := uint64(0); entryNum < 6; entryNum++ {
+		proof, err := server.GetCheckpointProof(entryNum)
+		require.NoError(t, err)
+		require.Equal(t, entryNum/3, proof.Checkpoint)
+		require.Equal(t, entryNum/3*3, proof.FromEntry)
+		require.Equal(t, uint64(3), proof.Entries)
+		entry, err := server.GetEntry(entryNum)
+		require.NoError(t, err)
+		require.True(t, proof.Verify(entry))
+
+		// Case: Proof of a tampered entry -> not verified
+		entry.Data = append([]byte{0}, entry.Data...)
+		require.False(t, proof.Verify(entry))
+	}
+
+	// Case: Proof of an entry not in a completed checkpoint -> ERROR
+	_, err := server.GetCheckpointProof(6)
+	require.ErrorIs(t, err, datastreamer.ErrEntryNotCheckpointed)
+
+	// Case: Checkpoint proof command -> proof verified with the entry
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	proof, err := client.ExecCommandGetCheckpointProof(4)
+	require.NoError(t, err)
+	entry, err := client.ExecCommandGetEntry(4)
+	require.NoError(t, err)
+	require.True(t, proof.Verify(entry))
+	_, err = client.ExecCommandGetCheckpointProof(7)
+	require.ErrorIs(t, err, datastreamer.ErrEntryNotCheckpointed)
+
+	// Case: Entry data updated -> checkpoint root recomputed
+	data := append([]byte{}, entry.Data...)
+	data[0]++
+	require.NoError(t, server.UpdateEntryData(4, entryType1, data))
+	updated, err := server.GetCheckpointProof(4)
+	require.NoError(t, err)
+	require.NotEqual(t, proof.Root, updated.Root)
+	require.False(t, updated.Verify(entry))
+	entry, err = server.GetEntry(4)
+	require.NoError(t, err)
+	require.True(t, updated.Verify(entry))
+
+	// Case: Stream truncated -> checkpoints not completed deleted
+	require.NoError(t, server.TruncateFile(5))
+	_, err = server.GetCheckpointProof(4)
+	require.ErrorIs(t, err, datastreamer.ErrEntryNotCheckpointed)
+	_, err = server.GetCheckpointProof(2)
+	require.NoError(t, err)
+
+	// Case: Checkpoints not enabled -> ERROR
+	require.NoError(t, server.SetCheckpoints(0))
+	_, err = server.GetCheckpointProof(2)
+	require.ErrorIs(t, err, datastreamer.ErrCheckpointsNotEnabled)
+
+	// Case: Interval changed -> checkpoints of the stream recomputed
+	require.NoError(t, server.SetCheckpoints(2))
+	proof, err = server.GetCheckpointProof(3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), proof.Checkpoint)
+	entry, err = server.GetEntry(3)
+	require.NoError(t, err)
+	require.True(t, proof.Verify(entry))
+	_, err = server.GetCheckpointProof(4)
+	require.ErrorIs(t, err, datastreamer.ErrEntryNotCheckpointed)
+}
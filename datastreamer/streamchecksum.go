@@ -0,0 +1,170 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// ChecksumSize is the size in bytes of the checksum appended to the data of the entries streamed (u32)
+const ChecksumSize = 4
+
+// Checksum type for the algorithm of the checksums of the entries streamed to a client
+type Checksum uint32
+
+const (
+	// ChecksumNone streams the entries without checksums (default)
+	ChecksumNone Checksum = 0
+	// ChecksumCRC32 streams the entries with the CRC-32 (Castagnoli) of their type, number and data
+	ChecksumCRC32 Checksum = 1
+)
+
+// StrChecksum is the name of the checksum algorithms
+var StrChecksum = map[Checksum]string{
+	ChecksumNone:  "none",
+	ChecksumCRC32: "crc32",
+}
+
+// checksumTable is the table of the CRC-32 (Castagnoli) of the entries streamed
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// String returns the name of the checksum algorithm
+func (c Checksum) String() string {
+	if name, ok := StrChecksum[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseChecksum returns the checksum algorithm from its name
+func ParseChecksum(name string) (Checksum, error) {
+	for checksum, str := range StrChecksum {
+		if strings.EqualFold(name, str) {
+			return checksum, nil
+		}
+	}
+	return ChecksumNone, ErrInvalidChecksum
+}
+
+// SetChecksum sets the checksum algorithm requested to the server on each connection (Checksum command), to receive
+// each streamed entry with a checksum verified before the receive middlewares and the process entry function. An
+// entry not matching its checksum (corrupted over the link) isn't delivered: ErrEntryChecksumMismatch is counted in
+// the read errors of the statistics and the client reconnects, streaming again from that entry. The servers not
+// supporting it keep sending the entries without checksums (call before Start)
+func (c *StreamClient) SetChecksum(checksum Checksum) {
+	c.checksum = checksum
+}
+
+// negotiateChecksum requests the checksum algorithm to the server on a new connection (if set and supported by the
+// server protocol version, detected on the command channel)
+func (c *StreamClient) negotiateChecksum(ctx context.Context, conn net.Conn) error {
+	c.checksummed.Store(false)
+	if c.checksum == ChecksumNone {
+		return nil
+	}
+	if c.protocol.Load() == 0 {
+		_, _, err := c.getCommandConn(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if c.checkProtocol(CmdChecksum, false) != nil {
+		log.Warnf("%s Streaming without checksums", c.ID)
+		return nil
+	}
+
+	c.mutexWrite.Lock()
+	err := c.writeCommand(conn, CmdChecksum, 0, uint64(c.checksum), nil)
+	c.mutexWrite.Unlock()
+	if err != nil {
+		return err
+	}
+	err = c.readPacketType(conn, PtResult, 0)
+	if err != nil {
+		return err
+	}
+	r, err := c.readResultEntry(conn)
+	if err != nil {
+		return err
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		log.Warnf("%s Checksum %s rejected by server %s: %d[%s], streaming without checksums", c.ID, c.checksum,
+			c.serverAddr(), r.errorNum, r.errorStr)
+		return nil
+	}
+	c.checksummed.Store(true)
+	return nil
+}
+
+// splitChecksum removes the checksum appended to a data entry streamed, returns it
+func (c *StreamClient) splitChecksum(e *FileEntry) (uint32, error) {
+	if len(e.Data) < ChecksumSize {
+		log.Errorf("%s Data entry %d without checksum", c.ID, e.Number)
+		c.stats.addError(StatErrRead, ErrEntryChecksumMismatch)
+		return 0, ErrEntryChecksumMismatch
+	}
+	split := len(e.Data) - ChecksumSize
+	checksum := binary.BigEndian.Uint32(e.Data[split:])
+	e.Data = e.Data[:split]
+	e.Length -= ChecksumSize
+	return checksum, nil
+}
+
+// verifyChecksum checks the checksum of a data entry streamed (already decompressed)
+func (c *StreamClient) verifyChecksum(e *FileEntry, checksum uint32) error {
+	if entryChecksum(e) == checksum {
+		return nil
+	}
+	log.Errorf("%s Checksum mismatch of data entry %d, streaming it again", c.ID, e.Number)
+	c.stats.addError(StatErrRead, ErrEntryChecksumMismatch)
+	return ErrEntryChecksumMismatch
+}
+
+// entryChecksum returns the CRC-32 (Castagnoli) of the type, number and data of an entry
+func entryChecksum(e *FileEntry) uint32 {
+	prefix := make([]byte, 0, 12) //nolint:mnd
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(e.Type))
+	prefix = binary.BigEndian.AppendUint64(prefix, e.Number)
+	return crc32.Update(crc32.Checksum(prefix, checksumTable), checksumTable, e.Data)
+}
+
+// appendChecksum appends the checksum of an entry to its binary entry streamed to the client (if negotiated)
+func (c *client) appendChecksum(be []byte, e *FileEntry) []byte {
+	if Checksum(c.checksum.Load()) != ChecksumCRC32 {
+		return be
+	}
+	binary.BigEndian.PutUint32(be[1:5], uint32(len(be)+ChecksumSize))
+	return binary.BigEndian.AppendUint32(be, entryChecksum(e))
+}
+
+// handleChecksumCommand processes the CmdChecksum command, the checksum algorithm of the entries streamed to the
+// client connection (the streaming and the subscriptions)
+func (s *StreamServer) handleChecksumCommand(cli *client) error {
+	// Read the checksum algorithm
+	value, err := readFullUint32(cli)
+	if err != nil {
+		return err
+	}
+	checksum := Checksum(value)
+
+	// Log
+	log.Debugf("Client %s command Checksum %s", cli.clientID, checksum)
+
+	if cli.status != csStopped || s.hasSubscriptions(cli) {
+		log.Error("Checksum command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrChecksumCommandNotAllowed
+	}
+	if _, ok := StrChecksum[checksum]; !ok {
+		log.Errorf("Client %s requested an invalid checksum %d", cli.clientID, value)
+		return s.sendResultEntry(uint32(CmdErrInvalidCommand), "invalid checksum", cli)
+	}
+	cli.checksum.Store(value)
+
+	// Send a command result entry OK
+	return s.sendResultEntry(0, "OK", cli)
+}
@@ -0,0 +1,81 @@
+package datastreamer_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientChecksum(t *testing.T) {
+	server, port := newTestServer(t, "checksum.bin")
+	require.NoError(t, server.Start())
+
+	// Large compressible entries alternated with small entries
+	large := bytes.Repeat([]byte("zkevm-data-streamer"), 200)
+	small := testEntries[1].Encode()
+	commit := func() {
+		require.NoError(t, server.StartAtomicOp())
+		for i := 0; i < 2; i++ {
+			_, err := server.AddStreamEntry(entryType1, large)
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType2, small)
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+	commit()
+
+	processed := make(chan []byte, 100)
+	process := func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient, _ *datastreamer.StreamServer) error {
+		processed <- e.Data
+		return nil
+	}
+	requireProcessed := func() {
+		for i := 0; i < 4; i++ {
+			select {
+			case data := <-processed:
+				if i%2 == 0 {
+					require.Equal(t, large, data)
+				} else {
+					require.Equal(t, small, data)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for streaming entries")
+			}
+		}
+	}
+
+	// Case: Checksums with compression requested -> Entries verified after decompressed, from file and live
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+		datastreamer.WithChecksum(datastreamer.ChecksumCRC32), datastreamer.WithCompression(datastreamer.CompressionSnappy))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	client.SetProcessEntryFunc(process)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	requireProcessed()
+	commit()
+	requireProcessed()
+	stats := client.GetStats()
+	require.Equal(t, uint64(8), stats.EntriesReceived)
+	require.Equal(t, uint64(4), stats.CompressedEntries)
+	require.Zero(t, stats.Errors[datastreamer.StatErrRead])
+
+	// Case: Subscription with checksums -> Tagged entries verified too
+	sub, err := client.Subscribe(4, process)
+	require.NoError(t, err)
+	requireProcessed()
+	require.NoError(t, sub.Unsubscribe())
+	require.Zero(t, client.GetStats().Errors[datastreamer.StatErrRead])
+
+	// Case: Parse the checksum names -> Known algorithms parsed, unknown rejected
+	checksum, err := datastreamer.ParseChecksum("CRC32")
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.ChecksumCRC32, checksum)
+	_, err = datastreamer.ParseChecksum("xxhash")
+	require.ErrorIs(t, err, datastreamer.ErrInvalidChecksum)
+}
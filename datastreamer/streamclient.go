@@ -1,20 +1,23 @@
 package datastreamer
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/hashicorp/yamux"
 )
 
 const (
-	resultsBuffer  = 32  // Buffers for the results channel
-	headersBuffer  = 32  // Buffers for the headers channel
-	entriesBuffer  = 128 // Buffers for the entries channel
-	entryRspBuffer = 32  // Buffers for data command response
+	entriesBuffer = 128 // Buffers for the entries channel (with the reference memory)
 
 	defaultTimeout = 5 * time.Second
 )
@@ -22,116 +25,363 @@ const (
 // ProcessEntryFunc type of the callback function to process the received entry
 type ProcessEntryFunc func(*FileEntry, *StreamClient, *StreamServer) error
 
+// resultWaiter type for an untagged command sent to the server connection waiting for its result
+type resultWaiter struct {
+	cmd      Command
+	deferred bool             // Flag the result is checked by the read goroutine (streaming restored on reconnection)
+	result   chan ResultEntry // Result received, closed if the connection is lost before
+}
+
 // StreamClient type to manage a data stream client
 type StreamClient struct {
-	server       string // Server address to connect IP:port
+	servers      []string // Server addresses to connect IP:port, failed over in order
 	streamType   StreamType
 	conn         net.Conn
-	ID           string // Client id
-	started      bool   // Flag client started
-	connected    bool   // Flag client connected to server
-	streaming    bool   // Flag client streaming started
-	fromStream   uint64 // Start entry number from latest start command
-	totalEntries uint64 // Total entries from latest header command
-
-	results  chan ResultEntry // Channel to read command results
-	headers  chan HeaderEntry // Channel to read header entries from the command Header
-	entries  chan FileEntry   // Channel to read data entries from the streaming
-	entryRsp chan FileEntry   // Channel to read data entries from the commands response
-
-	nextEntry    uint64           // Next entry number to receive from streaming
+	ID           string        // Client id
+	started      bool          // Flag client started
+	connected    bool          // Flag client connected to server
+	streaming    atomic.Bool   // Flag client streaming started
+	fromStream   atomic.Uint64 // Start entry number from latest start command
+	totalEntries uint64        // Total entries from latest header command
+
+	entries       chan FileEntry  // Channel to read data entries from the streaming
+	entriesBuffer int             // Size of the entries channels (streaming and subscriptions)
+	dialTimeout   time.Duration   // Timeout of each connection attempt (0 for none)
+	dialContext   DialContextFunc // Function opening the connections to the server (nil for the default dialer)
+
+	nextEntry    atomic.Uint64    // Next entry number to receive from streaming, to restore it on reconnection
 	processEntry ProcessEntryFunc // Callback function to process the entry
 	relayServer  *StreamServer    // Only used by the client on the stream relay server
+
+	subs       map[uint64]*Subscription // Tagged streaming subscriptions over the connection
+	mutexSubs  sync.RWMutex             // Mutex for access to subscriptions map
+	nextTag    uint64                   // Latest tag (subscription ID) assigned
+	mutexWrite sync.Mutex               // Mutex to write complete commands to the connection
+
+	waiters      []*resultWaiter // Untagged commands sent waiting for their results, received in order
+	mutexWaiters sync.Mutex      // Mutex for access to the result waiters
+	mutexStream  sync.Mutex      // Mutex to execute the streaming commands one by one
+	cmdTimeout   time.Duration   // Default deadline of the commands (0 for none)
+	reconnect    reconnectState
+	breaker      *circuitBreaker // Circuit breaker on the repeated rejections of the server (nil if disabled)
+	current      atomic.Int32    // Index of the current server address
+
+	cmdPolicies map[Command]CommandPolicy // Timeout and retries by command (the default ones if not set)
+
+	tlsConfig    *tls.Config    // TLS configuration of the connections (nil for plain TCP)
+	credentials  []byte         // Credentials sent to authenticate the connections (nil for no authentication)
+	protocol     atomic.Uint32  // Protocol version of the server detected on connection (0 until detected)
+	multiplexed  bool           // Flag to multiplex commands and streaming over one connection
+	session      *yamux.Session // Multiplexed session (nil if not multiplexed)
+	connCmd      net.Conn       // Command channel (multiplexed session stream or separate connection)
+	mutexSession sync.Mutex     // Mutex for access to the session and command channel
+	mutexCmd     sync.Mutex     // Mutex to execute commands one by one over the command channel
+
+	cmdRequestIDs bool                       // Flag the command channel echoes the request IDs (server support)
+	nextRequestID atomic.Uint64              // Latest request ID assigned to a command
+	pending       map[uint64]*pendingCommand // Commands in flight over the pipelined command channel
+	mutexPending  sync.Mutex                 // Mutex for access to pending commands map
+
+	stats     clientStats // Client statistics
+	stopDrain stopDrain   // Drain of the streaming entries received on stop
+
+	receiveChain  entryChain             // Middlewares applied to the data entries received from the server
+	frameHandlers map[uint8]FrameHandler // Handlers of the custom frames received by packet type
+
+	entryTypes     entryTypeSet // Entry types processed (nil for all the entry types)
+	negotiateTypes bool         // Flag the entry types are negotiated with the server
+
+	compression Compression // Compression codec requested to the server (CompressionNone if not requested)
+
+	checksum    Checksum    // Checksum algorithm requested to the server (ChecksumNone if not requested)
+	checksummed atomic.Bool // Flag the checksums of the entries streamed are negotiated on the current connection
+
+	heartbeat *clientHeartbeat // Detection of the dead connections to the server (nil if disabled)
+
+	lifecycle *clientLifecycle // Connection lifecycle hooks (nil if none set)
+
+	faults clientFaults // Network faults injected for the tests (faultinject build tag)
+
+	checkpoint *clientCheckpoint // Periodic save of the processed position of the streaming (nil if disabled)
+
+	prefetch *prefetchQueue  // Ready queue of the prefetched streaming entries (nil if prefetch disabled)
+	spill    *spillQueue     // Disk queue of the entries received while the entries channel is full (nil if disabled)
+	slow     *slowConsumer   // Slow consumer detection (nil if disabled)
+	pull     *pullDelivery   // Delivery of the streaming entries to the consumer pulling them (nil if not set)
+	workers  *workerPool     // Worker goroutines processing the streaming entries (nil if disabled)
+	backfill *clientBackfill // Parallel backfill of the streaming far behind the tip (nil if disabled)
+	batch    *batchDelivery  // Delivery of the streaming entries in batches (nil if processed one by one)
+	lag      *lagMonitor     // Periodic computation of the streaming lag (nil if disabled)
+
+	rateLimit *rateLimiter // Limits of the consumption rate of the streaming entries (nil if disabled)
+
+	trustedRoot CheckpointRootFunc // Trusted checkpoint roots to verify the streaming entries (nil if not required)
+	policy      processPolicy      // Policy on the process entry function errors
+	verifier    *streamVerifier    // Verification of the segments between bookmarks (nil if disabled)
+
+	fatal    chan error    // Fatal error stopping the streaming
+	done     chan struct{} // Closed once the client is stopped
+	stopOnce sync.Once
+	routines sync.WaitGroup // Goroutines of the client, waited on Close
 }
 
-// NewClient creates a new data stream client
-func NewClient(server string, streamType StreamType) (*StreamClient, error) {
+// NewClient creates a new data stream client, customized with the options
+func NewClient(server string, streamType StreamType, opts ...Option) (*StreamClient, error) {
 	// Create the client data stream
 	c := StreamClient{
-		server:       server,
+		servers:      parseServers(server),
 		streamType:   streamType,
 		ID:           "",
 		started:      false,
 		connected:    false,
-		streaming:    false,
-		fromStream:   0,
 		totalEntries: 0,
 
-		results:  make(chan ResultEntry, resultsBuffer),
-		headers:  make(chan HeaderEntry, headersBuffer),
-		entries:  make(chan FileEntry, entriesBuffer),
-		entryRsp: make(chan FileEntry, entryRspBuffer),
+		entriesBuffer: GetBufferSizes().ClientEntries,
 
-		nextEntry:   0,
 		relayServer: nil,
+
+		subs:    make(map[uint64]*Subscription),
+		pending: make(map[uint64]*pendingCommand),
+
+		fatal: make(chan error, 1),
+		done:  make(chan struct{}),
 	}
 
 	// Set default callback function to process entry
 	c.setProcessEntryFunc(PrintReceivedEntry, c.relayServer)
 
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.entries = make(chan FileEntry, c.entriesBuffer)
+
 	return &c, nil
 }
 
 // NewClientWithLogsConfig creates a new data stream client with logs configuration
 func NewClientWithLogsConfig(server string, streamType StreamType, logsConfig log.Config) (*StreamClient, error) {
-	log.Init(logsConfig)
-	return NewClient(server, streamType)
+	return NewClient(server, streamType, WithLogsConfig(logsConfig))
 }
 
 // Start connects to the data stream server and starts getting data from the server
 func (c *StreamClient) Start() error {
+	return c.StartContext(context.Background())
+}
+
+// StartContext connects to the data stream server and starts getting data from the server. The context cancels the
+// connection attempts, the client is not started then and the context error returned
+func (c *StreamClient) StartContext(ctx context.Context) error {
+	if c.isStopped() {
+		return ErrClientStopped
+	}
+	c.stats.start()
+
 	// Connect to server
-	c.connectServer()
+	err := c.connectServer(ctx)
+	if err != nil {
+		return err
+	}
+	if !c.connected && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Goroutine to pass the connection events to the lifecycle hooks
+	if c.lifecycle != nil {
+		c.spawn(c.runLifecycleHooks)
+	}
 
 	// Goroutine to read from the server all entry types
-	go c.readEntries()
+	c.spawn(c.readEntries)
+
+	// Goroutine to drain the entries spilled to disk
+	if c.spill != nil {
+		c.spawn(c.drainSpill)
+	}
 
 	// Goroutine to consume streaming entries
-	go func() {
+	c.spawn(func() {
 		err := c.getStreaming()
+		c.endPull(err)
 		if err != nil {
 			log.Errorf("%s Error while getting streaming: %v", c.ID, err)
+			if c.policy.onFatal != nil {
+				c.policy.onFatal(err)
+			}
+			select {
+			case c.fatal <- err:
+			default:
+			}
 		}
-	}()
+	})
 
 	// Flag stared
 	c.started = true
 
+	// Goroutine to dump the statistics file
+	if c.stats.fileName != "" {
+		c.spawn(c.dumpStats)
+	}
+
+	// Goroutine to detect a slow consumer
+	if c.slow != nil {
+		c.spawn(c.checkSlowConsumer)
+	}
+
+	// Goroutine to compute the streaming lag
+	if c.lag != nil {
+		c.spawn(c.monitorLag)
+	}
+
+	// Goroutine to save the processed position of the streaming
+	if c.checkpoint != nil {
+		c.spawn(c.saveCheckpoints)
+	}
+
 	return nil
 }
 
-// connectServer waits until the server connection is established and returns if a command result is pending
-func (c *StreamClient) connectServer() bool {
-	var err error
-
+// connectServer waits until the server connection is established (or the context is done). Returns the error giving
+// up once the connection attempts of the reconnect policy are exhausted
+func (c *StreamClient) connectServer(ctx context.Context) error {
 	// Connect to server
-	for !c.connected {
-		c.conn, err = net.Dial("tcp", c.server)
+	for !c.connected && !c.isStopped() && ctx.Err() == nil {
+		conn, err := c.dial(ctx)
 		if err != nil {
-			log.Errorf("Error connecting to server %s: %v", c.server, err)
-			time.Sleep(defaultTimeout)
+			c.stats.addError(StatErrConnect, err)
+			log.Errorf("Error connecting to server %s: %v", c.serverAddr(), err)
+			errGiveUp := c.retryConnect(ctx, err)
+			if errGiveUp != nil {
+				return errGiveUp
+			}
 			continue
-		} else {
+		} else if c.setConn(conn) {
 			// Connected
 			c.connected = true
-			c.ID = c.conn.LocalAddr().String()
-			log.Infof("%s Connected to server: %s", c.ID, c.server)
+			if c.ID == "" {
+				// Keep the id across reconnections, it's used by the command channel goroutines meanwhile
+				c.ID = c.conn.LocalAddr().String()
+			}
+			c.stats.connected()
+			log.Infof("%s Connected to server: %s", c.ID, c.serverAddr())
+
+			// Authenticate the connection
+			err = c.authenticate(c.conn)
+			if err != nil {
+				log.Errorf("%s Error authenticating to server: %v", c.ID, err)
+				c.closeConnection()
+				if errors.Is(err, ErrUnauthorized) {
+					errOpen := c.breaker.fail(c, err)
+					if errOpen != nil {
+						return errOpen
+					}
+				}
+				errGiveUp := c.retryConnect(ctx, err)
+				if errGiveUp != nil {
+					return errGiveUp
+				}
+				continue
+			}
+
+			// Switch to multiplexed session
+			if c.multiplexed {
+				err = c.openSession()
+				if err != nil {
+					log.Errorf("%s Error opening multiplexed session: %v", c.ID, err)
+					c.closeConnection()
+					errGiveUp := c.retryConnect(ctx, err)
+					if errGiveUp != nil {
+						return errGiveUp
+					}
+					continue
+				}
+			}
+
+			// Negotiate the entry types to stream
+			err = c.negotiateEntryTypes(ctx, c.conn)
+			if err != nil {
+				log.Errorf("%s Error negotiating entry types: %v", c.ID, err)
+				c.closeConnection()
+				errGiveUp := c.retryConnect(ctx, err)
+				if errGiveUp != nil {
+					return errGiveUp
+				}
+				continue
+			}
+
+			// Negotiate the compression of the streaming
+			err = c.negotiateCompression(ctx, c.conn)
+			if err != nil {
+				log.Errorf("%s Error negotiating compression: %v", c.ID, err)
+				c.closeConnection()
+				errGiveUp := c.retryConnect(ctx, err)
+				if errGiveUp != nil {
+					return errGiveUp
+				}
+				continue
+			}
+
+			// Negotiate the checksums of the entries streamed
+			err = c.negotiateChecksum(ctx, c.conn)
+			if err != nil {
+				log.Errorf("%s Error negotiating checksums: %v", c.ID, err)
+				c.closeConnection()
+				errGiveUp := c.retryConnect(ctx, err)
+				if errGiveUp != nil {
+					return errGiveUp
+				}
+				continue
+			}
+
+			// Detect the heartbeat support of the server
+			err = c.negotiateHeartbeat(ctx)
+			if err != nil {
+				log.Errorf("%s Error detecting heartbeat support: %v", c.ID, err)
+				c.closeConnection()
+				errGiveUp := c.retryConnect(ctx, err)
+				if errGiveUp != nil {
+					return errGiveUp
+				}
+				continue
+			}
+
+			reconnect := c.connectionUp()
 
 			// Restore streaming
-			if c.streaming {
-				_, _, err = c.execCommand(CmdStart, true, c.nextEntry, nil)
+			deferredResult := false
+			if c.streaming.Load() {
+				_, _, err = c.execCommand(ctx, CmdStart, true, c.nextEntry.Load(), nil)
 				if err != nil {
 					c.closeConnection()
-					time.Sleep(defaultTimeout)
+					errGiveUp := c.retryConnect(ctx, err)
+					if errGiveUp != nil {
+						return errGiveUp
+					}
 					continue
 				}
-				return true
-			} else {
-				return false
+				deferredResult = true
 			}
+
+			// Restore subscriptions
+			err = c.restoreSubscriptions()
+			if err != nil {
+				c.closeConnection()
+				errGiveUp := c.retryConnect(ctx, err)
+				if errGiveUp != nil {
+					return errGiveUp
+				}
+				continue
+			}
+			c.connectDone()
+			if !deferredResult {
+				c.breaker.reset()
+			}
+			if reconnect && !deferredResult {
+				c.connectionResumed(false)
+			}
+			return nil
 		}
 	}
-	return false
+	return nil
 }
 
 // closeConnection closes connection to the server
@@ -140,47 +390,102 @@ func (c *StreamClient) closeConnection() {
 		log.Infof("%s Close connection", c.ID)
 		c.conn.Close()
 	}
+	c.closeSession()
 	c.connected = false
+	c.failWaiters()
+	c.stats.disconnected()
+	c.connectionDown()
 }
 
 // ExecCommandStart executes client TCP command to start streaming from entry
 func (c *StreamClient) ExecCommandStart(fromEntry uint64) error {
-	_, _, err := c.execCommand(CmdStart, false, fromEntry, nil)
+	return c.ExecCommandStartContext(context.Background(), fromEntry)
+}
+
+// ExecCommandStartContext executes client TCP command to start streaming from entry, canceled with the context
+func (c *StreamClient) ExecCommandStartContext(ctx context.Context, fromEntry uint64) error {
+	if c.backfill != nil && c.started {
+		started, err := c.startBackfill(ctx, fromEntry)
+		if started || err != nil {
+			return err
+		}
+	}
+	_, _, err := c.execCommand(ctx, CmdStart, false, fromEntry, nil)
 	return err
 }
 
 // ExecCommandStartBookmark executes client TCP command to start streaming from bookmark
 func (c *StreamClient) ExecCommandStartBookmark(fromBookmark []byte) error {
-	_, _, err := c.execCommand(CmdStartBookmark, false, 0, fromBookmark)
+	return c.ExecCommandStartBookmarkContext(context.Background(), fromBookmark)
+}
+
+// ExecCommandStartBookmarkContext executes client TCP command to start streaming from bookmark, canceled with the
+// context
+func (c *StreamClient) ExecCommandStartBookmarkContext(ctx context.Context, fromBookmark []byte) error {
+	_, _, err := c.execCommand(ctx, CmdStartBookmark, false, 0, fromBookmark)
 	return err
 }
 
 // ExecCommandStop executes client TCP command to stop streaming
 func (c *StreamClient) ExecCommandStop() error {
-	_, _, err := c.execCommand(CmdStop, false, 0, nil)
+	return c.ExecCommandStopContext(context.Background())
+}
+
+// ExecCommandStopContext executes client TCP command to stop streaming, canceled with the context, draining the
+// entries received with the mode set by SetStopDrain
+func (c *StreamClient) ExecCommandStopContext(ctx context.Context) error {
+	_, err := c.ExecCommandStopAck(ctx)
 	return err
 }
 
 // ExecCommandGetHeader executes client TCP command to get the header
 func (c *StreamClient) ExecCommandGetHeader() (HeaderEntry, error) {
-	header, _, err := c.execCommand(CmdHeader, false, 0, nil)
+	return c.ExecCommandGetHeaderContext(context.Background())
+}
+
+// ExecCommandGetHeaderContext executes client TCP command to get the header, canceled with the context
+func (c *StreamClient) ExecCommandGetHeaderContext(ctx context.Context) (HeaderEntry, error) {
+	header, _, err := c.execCommand(ctx, CmdHeader, false, 0, nil)
 	return header, err
 }
 
 // ExecCommandGetEntry executes client TCP command to get an entry
 func (c *StreamClient) ExecCommandGetEntry(fromEntry uint64) (FileEntry, error) {
-	_, entry, err := c.execCommand(CmdEntry, false, fromEntry, nil)
-	return entry, err
+	return c.ExecCommandGetEntryContext(context.Background(), fromEntry)
+}
+
+// ExecCommandGetEntryContext executes client TCP command to get an entry, canceled with the context
+func (c *StreamClient) ExecCommandGetEntryContext(ctx context.Context, fromEntry uint64) (FileEntry, error) {
+	_, entry, err := c.execCommand(ctx, CmdEntry, false, fromEntry, nil)
+	if err != nil {
+		return entry, err
+	}
+	return c.applyReceiveChain(entry, ErrEntryNotFound)
 }
 
 // ExecCommandGetBookmark executes client TCP command to get a bookmark
 func (c *StreamClient) ExecCommandGetBookmark(fromBookmark []byte) (FileEntry, error) {
-	_, entry, err := c.execCommand(CmdBookmark, false, 0, fromBookmark)
-	return entry, err
+	return c.ExecCommandGetBookmarkContext(context.Background(), fromBookmark)
 }
 
-// execCommand executes a valid client TCP command with deferred command result possibility
-func (c *StreamClient) execCommand(cmd Command, deferredResult bool,
+// ExecCommandGetBookmarkContext executes client TCP command to get a bookmark, canceled with the context
+func (c *StreamClient) ExecCommandGetBookmarkContext(ctx context.Context, fromBookmark []byte) (FileEntry, error) {
+	_, entry, err := c.execCommand(ctx, CmdBookmark, false, 0, fromBookmark)
+	if err != nil {
+		return entry, err
+	}
+	return c.applyReceiveChain(entry, ErrBookmarkNotFound)
+}
+
+// SetCommandTimeout sets the default deadline of the commands, applied on top of the context of the commands (0 for
+// none, the default). A command timed out returns context.DeadlineExceeded (see SetCommandPolicy to retry it)
+func (c *StreamClient) SetCommandTimeout(timeout time.Duration) {
+	c.cmdTimeout = timeout
+}
+
+// execCommand executes a valid client TCP command with deferred command result possibility. The context (with the
+// default command deadline) cancels waiting for the command result and data response
+func (c *StreamClient) execCommand(ctx context.Context, cmd Command, deferredResult bool,
 	fromEntry uint64, fromBookmark []byte) (HeaderEntry, FileEntry, error) {
 	log.Debugf("%s Executing command %d[%s]...", c.ID, cmd, StrCommand[cmd])
 	header := HeaderEntry{}
@@ -197,16 +502,142 @@ func (c *StreamClient) execCommand(cmd Command, deferredResult bool,
 		log.Errorf("%s Invalid command %d", c.ID, cmd)
 		return header, entry, ErrInvalidCommand
 	}
+	err := c.checkProtocol(cmd, false)
+	if err != nil {
+		return header, entry, err
+	}
+
+	// Deadline of the command, of each attempt if retried
+	policy := c.commandPolicy(cmd)
+	if policy.Retries > 0 {
+		return c.execRetriedCommand(ctx, cmd, policy, fromEntry, fromBookmark)
+	}
+	if policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	// Query commands go through the command channel
+	if !cmd.isStreaming() {
+		return c.execQueryCommand(ctx, cmd, fromEntry, fromBookmark)
+	}
+
+	// Streaming commands run one by one, except the streaming restored on reconnection (its result is deferred)
+	if !deferredResult {
+		c.mutexStream.Lock()
+		defer c.mutexStream.Unlock()
+	}
+
+	// Restore the streaming from the start entry on reconnection, until the entries are received from it
+	if cmd == CmdStart {
+		c.nextEntry.Store(fromEntry)
+	}
 
 	// Send command
-	err := writeFullUint64(uint64(cmd), c.conn)
+	w, err := c.sendWaitingResult(cmd, deferredResult, fromEntry, fromBookmark)
 	if err != nil {
 		return header, entry, err
 	}
+
+	// Get the command result
+	if !deferredResult {
+		r, err := c.getResult(ctx, w)
+		if err != nil {
+			c.stats.addError(StatErrCommand, err)
+			return header, entry, err
+		}
+		if r.errorNum == uint32(CmdErrInvalidCommand) {
+			err = errNotSupported(cmd, c.protocol.Load())
+			c.stats.addError(StatErrCommand, err)
+			return header, entry, err
+		}
+		if r.errorNum != uint32(CmdErrOK) {
+			c.stats.addError(StatErrCommand, ErrResultCommandError)
+			return header, entry, ErrResultCommandError
+		}
+	}
+
+	// Update streaming flag
+	switch cmd {
+	case CmdStart:
+		c.streaming.Store(true)
+		c.fromStream.Store(fromEntry)
+	case CmdStartBookmark:
+		c.streaming.Store(true)
+	case CmdStop:
+		c.streaming.Store(false)
+	}
+	c.stats.setStreaming(c.streaming.Load())
+
+	return header, entry, nil
+}
+
+// sendCommand writes to connection a complete command with its parameters (tagged if tag is not zero)
+func (c *StreamClient) sendCommand(cmd Command, tag uint64, fromEntry uint64, fromBookmark []byte) error {
+	c.mutexWrite.Lock()
+	defer c.mutexWrite.Unlock()
+
+	return c.writeCommand(c.conn, cmd, tag, fromEntry, fromBookmark)
+}
+
+// sendWaitingResult writes to connection an untagged command, queued to wait for its result. The waiter is queued
+// with the command written, so the results received in order are passed to the commands sent in the same order
+func (c *StreamClient) sendWaitingResult(cmd Command, deferred bool, fromEntry uint64,
+	fromBookmark []byte) (*resultWaiter, error) {
+	c.mutexWrite.Lock()
+	defer c.mutexWrite.Unlock()
+
+	// Queued before writing, the result can be received before the write returns
+	w := &resultWaiter{
+		cmd:      cmd,
+		deferred: deferred,
+		result:   make(chan ResultEntry, 1),
+	}
+	c.mutexWaiters.Lock()
+	c.waiters = append(c.waiters, w)
+	c.mutexWaiters.Unlock()
+
+	err := c.writeCommand(c.conn, cmd, 0, fromEntry, fromBookmark)
+	if err != nil {
+		c.removeWaiter(w)
+		return nil, err
+	}
+	return w, nil
+}
+
+// writeCommand writes to a connection a complete command with its parameters (tagged if tag is not zero). For the
+// CmdStartShard command, fromBookmark is the encoded shard parameter, for the CmdWatchBookmarks command the bookmarks
+// prefix, for the CmdEntriesByTime command fromEntry and fromBookmark are the encoded from and to times, for the
+// CmdAuth command fromBookmark is the credentials, for the CmdStartGroup command the group name, for the
+// CmdCommitGroup command fromEntry is the next entry number committed, and for the CmdCommitPosition and
+// CmdGetPosition commands fromBookmark is the key (fromEntry the position committed), for the CmdEntryRange
+// command fromBookmark is the encoded number of entries, for the CmdEntryTypes command the encoded entry types, for
+// the CmdLatestStates command the bookmarks prefix, for the CmdCompression command fromEntry is the codec, and for
+// the CmdChecksum command fromEntry is the checksum algorithm
+func (c *StreamClient) writeCommand(conn net.Conn, cmd Command, tag uint64, fromEntry uint64,
+	fromBookmark []byte) error {
+	// Send command
+	cmdFlags := cmd
+	if tag != 0 {
+		cmdFlags |= CmdFlagTagged
+	}
+	err := writeFullUint64(uint64(cmdFlags), conn)
+	if err != nil {
+		return err
+	}
 	// Send stream type
-	err = writeFullUint64(uint64(c.streamType), c.conn)
+	err = writeFullUint64(uint64(c.streamType), conn)
 	if err != nil {
-		return header, entry, err
+		return err
+	}
+	// Send tag
+	if tag != 0 {
+		log.Debugf("%s ...tag %d", c.ID, tag)
+		err = writeFullUint64(tag, conn)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Send the command parameters
@@ -214,79 +645,180 @@ func (c *StreamClient) execCommand(cmd Command, deferredResult bool,
 	case CmdStart:
 		log.Debugf("%s ...from entry %d", c.ID, fromEntry)
 		// Send starting/from entry number
-		err = writeFullUint64(fromEntry, c.conn)
+		err = writeFullUint64(fromEntry, conn)
 		if err != nil {
-			return header, entry, err
+			return err
 		}
 	case CmdStartBookmark:
 		log.Debugf("%s ...from bookmark [%v]", c.ID, fromBookmark)
 		// Send starting/from bookmark length
-		err = writeFullUint32(uint32(len(fromBookmark)), c.conn)
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
 		if err != nil {
-			return header, entry, err
+			return err
 		}
 		// Send starting/from bookmark
-		err = writeFullBytes(fromBookmark, c.conn)
+		err = writeFullBytes(fromBookmark, conn)
 		if err != nil {
-			return header, entry, err
+			return err
 		}
-	case CmdEntry:
+	case CmdWatchBookmarks:
+		log.Debugf("%s ...from entry %d bookmarks prefix [%v]", c.ID, fromEntry, fromBookmark)
+		// Send starting/from entry number, prefix length and prefix
+		err = writeFullUint64(fromEntry, conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdStartShard:
+		log.Debugf("%s ...from entry %d shard [%v]", c.ID, fromEntry, fromBookmark)
+		// Send starting/from entry number and shard parameter
+		err = writeFullUint64(fromEntry, conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdEntriesByTime:
+		log.Debugf("%s ...from time %d to time [%v]", c.ID, fromEntry, fromBookmark)
+		// Send from time and to time parameters
+		err = writeFullUint64(fromEntry, conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdEntryRange:
+		log.Debugf("%s ...from entry %d count [%v]", c.ID, fromEntry, fromBookmark)
+		// Send from entry number and encoded number of entries parameters
+		err = writeFullUint64(fromEntry, conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdLatestStates:
+		log.Debugf("%s ...bookmarks prefix [%v]", c.ID, fromBookmark)
+		// Send bookmarks prefix length and prefix
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdCompression:
+		log.Debugf("%s ...compression %d", c.ID, fromEntry)
+		// Send compression codec
+		err = writeFullUint32(uint32(fromEntry), conn)
+		if err != nil {
+			return err
+		}
+	case CmdChecksum:
+		log.Debugf("%s ...checksum %d", c.ID, fromEntry)
+		// Send checksum algorithm
+		err = writeFullUint32(uint32(fromEntry), conn)
+		if err != nil {
+			return err
+		}
+	case CmdEntryTypes:
+		log.Debugf("%s ...entry types [%v]", c.ID, fromBookmark)
+		// Send number of entry types and entry types
+		err = writeFullUint32(uint32(len(fromBookmark)/4), conn) //nolint:mnd
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdStartGroup:
+		log.Debugf("%s ...from entry %d group [%s]", c.ID, fromEntry, fromBookmark)
+		// Send starting/from entry number, group name length and group name
+		err = writeFullUint64(fromEntry, conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdEntry, CmdHeaderChanges, CmdCheckpointProof, CmdCommitGroup:
 		log.Debugf("%s ...get entry %d", c.ID, fromEntry)
 		// Send entry to retrieve
-		err = writeFullUint64(fromEntry, c.conn)
+		err = writeFullUint64(fromEntry, conn)
 		if err != nil {
-			return header, entry, err
+			return err
+		}
+	case CmdAuth:
+		log.Debugf("%s ...credentials of %d bytes", c.ID, len(fromBookmark))
+		// Send credentials length and credentials
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
 		}
 	case CmdBookmark:
 		log.Debugf("%s ...get bookmark [%v]", c.ID, fromBookmark)
 		// Send bookmark length
-		err = writeFullUint32(uint32(len(fromBookmark)), c.conn)
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
 		if err != nil {
-			return header, entry, err
+			return err
 		}
 		// Send bookmark to retrieve
-		err = writeFullBytes(fromBookmark, c.conn)
+		err = writeFullBytes(fromBookmark, conn)
 		if err != nil {
-			return header, entry, err
+			return err
 		}
-	}
-
-	// Get the command result
-	if !deferredResult {
-		r := c.getResult(cmd)
-		if r.errorNum != uint32(CmdErrOK) {
-			return header, entry, ErrResultCommandError
+	case CmdCommitPosition:
+		log.Debugf("%s ...position %d key [%s]", c.ID, fromEntry, fromBookmark)
+		// Send next entry number, key length and key
+		err = writeFullUint64(fromEntry, conn)
+		if err != nil {
+			return err
 		}
-	}
-
-	// Get the data response and update streaming flag
-	switch cmd {
-	case CmdStart:
-		c.streaming = true
-		c.fromStream = fromEntry
-	case CmdStartBookmark:
-		c.streaming = true
-	case CmdStop:
-		c.streaming = false
-	case CmdHeader:
-		h := c.getHeader()
-		header = h
-		c.totalEntries = header.TotalEntries
-	case CmdEntry:
-		e := c.getEntry()
-		if e.Type == EntryTypeNotFound {
-			return header, entry, ErrEntryNotFound
-		}
-		entry = e
-	case CmdBookmark:
-		e := c.getEntry()
-		if e.Type == EntryTypeNotFound {
-			return header, entry, ErrBookmarkNotFound
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
+		}
+	case CmdGetPosition:
+		log.Debugf("%s ...get position key [%s]", c.ID, fromBookmark)
+		// Send key length and key
+		err = writeFullUint32(uint32(len(fromBookmark)), conn)
+		if err != nil {
+			return err
+		}
+		err = writeFullBytes(fromBookmark, conn)
+		if err != nil {
+			return err
 		}
-		entry = e
 	}
 
-	return header, entry, nil
+	return nil
 }
 
 // writeFullUint64 writes to connection a complete uint64
@@ -341,10 +873,10 @@ func writeFullBytes(buffer []byte, conn net.Conn) error {
 }
 
 // readDataEntry reads bytes from server connection and returns a data entry type
-func (c *StreamClient) readDataEntry() (FileEntry, error) {
+func (c *StreamClient) readDataEntry(conn net.Conn) (FileEntry, error) {
 	// Read the rest of fixed size fields
 	buffer := make([]byte, FixedSizeFileEntry-1)
-	err := c.readContent(buffer)
+	err := c.readContent(conn, buffer)
 	if err != nil {
 		return FileEntry{}, err
 	}
@@ -359,7 +891,7 @@ func (c *StreamClient) readDataEntry() (FileEntry, error) {
 	}
 
 	bufferAux := make([]byte, length-FixedSizeFileEntry)
-	err = c.readContent(bufferAux)
+	err = c.readContent(conn, bufferAux)
 	if err != nil {
 		return FileEntry{}, err
 	}
@@ -375,12 +907,12 @@ func (c *StreamClient) readDataEntry() (FileEntry, error) {
 }
 
 // readHeaderEntry reads bytes from server connection and returns a header entry type
-func (c *StreamClient) readHeaderEntry() (HeaderEntry, error) {
+func (c *StreamClient) readHeaderEntry(conn net.Conn) (HeaderEntry, error) {
 	h := HeaderEntry{}
 
 	// Read the rest of header bytes
 	buffer := make([]byte, headerSize-1)
-	n, err := io.ReadFull(c.conn, buffer)
+	n, err := io.ReadFull(conn, buffer)
 	if err != nil {
 		log.Errorf("Error reading the header: %v", err)
 		return h, err
@@ -392,6 +924,17 @@ func (c *StreamClient) readHeaderEntry() (HeaderEntry, error) {
 	packet := []byte{PtHeader}
 	buffer = append(packet, buffer...)
 
+	// Read the base entry of a header with it
+	if binary.BigEndian.Uint32(buffer[1:5]) == headerSizeBase {
+		base := make([]byte, headerSizeBase-headerSize)
+		_, err = io.ReadFull(conn, base)
+		if err != nil {
+			log.Errorf("Error reading the header base entry: %v", err)
+			return h, err
+		}
+		buffer = append(buffer, base...)
+	}
+
 	// Decode bytes stream to header entry struct
 	h, err = decodeBinaryToHeaderEntry(buffer)
 	if err != nil {
@@ -403,10 +946,10 @@ func (c *StreamClient) readHeaderEntry() (HeaderEntry, error) {
 }
 
 // readResultEntry reads bytes from server connection and returns a result entry type
-func (c *StreamClient) readResultEntry() (ResultEntry, error) {
+func (c *StreamClient) readResultEntry(conn net.Conn) (ResultEntry, error) {
 	// Read the rest of fixed size fields
 	buffer := make([]byte, FixedSizeResultEntry-1)
-	_, err := io.ReadFull(c.conn, buffer)
+	_, err := io.ReadFull(conn, buffer)
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			log.Warnf("%s Server close connection", c.ID)
@@ -426,7 +969,7 @@ func (c *StreamClient) readResultEntry() (ResultEntry, error) {
 	}
 
 	bufferAux := make([]byte, length-FixedSizeResultEntry)
-	err = c.readContent(bufferAux)
+	err = c.readContent(conn, bufferAux)
 	if err != nil {
 		return ResultEntry{}, err
 	}
@@ -442,9 +985,10 @@ func (c *StreamClient) readResultEntry() (ResultEntry, error) {
 }
 
 // readContent reads raw content using the connection and places it into buffer parameter
-func (c *StreamClient) readContent(buffer []byte) error {
-	_, err := io.ReadFull(c.conn, buffer)
+func (c *StreamClient) readContent(conn net.Conn, buffer []byte) error {
+	_, err := io.ReadFull(conn, buffer)
 	if err != nil {
+		c.stats.addError(StatErrRead, err)
 		if errors.Is(err, io.EOF) {
 			log.Warnf("%s Server close connection", c.ID)
 		} else {
@@ -462,67 +1006,128 @@ func (c *StreamClient) readEntries() {
 
 	for {
 		// Wait for connection
-		deferredResult := c.connectServer()
+		err := c.connectServer(context.Background())
+		if err != nil {
+			select {
+			case c.fatal <- err:
+			default:
+			}
+			c.stop(err)
+			return
+		}
+		if c.isStopped() {
+			return
+		}
 
 		// Read packet type
 		packet := make([]byte, 1)
-		err := c.readContent(packet)
+		err = c.readPacket(packet)
 		if err != nil {
 			c.closeConnection()
 			continue
 		}
+		if !c.delayRead() {
+			return
+		}
 
 		// Manage packet type
 		switch packet[0] {
 		case PtResult:
 			// Read result entry data
-			r, err := c.readResultEntry()
+			r, err := c.readResultEntry(c.conn)
 			if err != nil {
 				c.closeConnection()
 				continue
 			}
-			// Send data to results channel
-			c.results <- r
-			// Get the command deferred result
-			if deferredResult {
-				r := c.getResult(CmdStart)
+			// Discard a result not expected by an untagged command (e.g. server without tagged commands)
+			w := c.nextWaiter()
+			if w == nil {
+				log.Warnf("%s Unexpected result %d[%s] discarded", c.ID, r.errorNum, r.errorStr)
+				continue
+			}
+			// Check the deferred result of the streaming restored on reconnection
+			if w.deferred {
 				if r.errorNum != uint32(CmdErrOK) {
 					c.closeConnection()
-					time.Sleep(defaultTimeout)
+					errOpen := c.breaker.fail(c, fmt.Errorf("%w: streaming restored from entry %d: %d[%s]",
+						ErrResultCommandError, c.nextEntry.Load(), r.errorNum, r.errorStr))
+					if errOpen != nil {
+						select {
+						case c.fatal <- errOpen:
+						default:
+						}
+						c.stop(errOpen)
+						return
+					}
+					c.wait(defaultTimeout)
 					continue
 				}
+				c.breaker.reset()
+				c.connectionResumed(true)
+				continue
 			}
+			// Pass the result to the command waiting for it (buffered, discarded if the command was canceled)
+			w.result <- r
 
-		case PtDataRsp:
-			// Read result entry data
-			r, err := c.readDataEntry()
+		case PtData, PtCompressed:
+			// Read file/stream entry data
+			e, err := c.readStreamedEntry(c.conn, packet[0])
 			if err != nil {
 				c.closeConnection()
 				continue
 			}
-			c.entryRsp <- r
-
-		case PtHeader:
-			// Read header entry data
-			h, err := c.readHeaderEntry()
-			if err != nil {
-				c.closeConnection()
+			if c.dropFrame(&e) {
 				continue
 			}
-			// Send data to headers channel
-			c.headers <- h
+			c.stats.dataReceived(e.Length)
+			// Pause the reads until the consumption rate allows the entry
+			if !c.limitRate(&e) {
+				return
+			}
+			// Send data to stream entries channel, the entries queued aren't requested again on reconnection
+			c.nextEntry.Store(e.Number + 1)
+			c.queueEntry(e)
 
-		case PtData:
-			// Read file/stream entry data
-			e, err := c.readDataEntry()
+		case PtTagged:
+			// Read tagged frame and route it to its subscription
+			err := c.readTaggedFrame()
 			if err != nil {
 				c.closeConnection()
 				continue
 			}
-			// Send data to stream entries channel
-			c.entries <- e
+
+		case PtShutdown:
+			// Reconnect without waiting for the server connection to time out
+			log.Infof("%s Server shutting down", c.ID)
+			c.stats.addError(StatErrRead, ErrServerShutdown)
+			c.closeConnection()
+			if !c.failover(ErrServerShutdown) {
+				c.wait(defaultTimeout)
+			}
+			continue
+
+		case PtPong:
+			// Answer of the server to a ping of the heartbeat
+			log.Debugf("%s Pong received", c.ID)
+			continue
+
+		case PtReconnect:
+			// Reconnect right away, resuming the streaming and the subscriptions (e.g. to another relay of a pool)
+			log.Infof("%s Server asked to reconnect", c.ID)
+			c.stats.addError(StatErrRead, ErrSessionExpired)
+			c.closeConnection()
+			continue
 
 		default:
+			// Custom frame of a private packet type
+			if IsPrivatePacketType(packet[0]) {
+				err := c.readCustomFrame(packet[0])
+				if err != nil {
+					c.closeConnection()
+				}
+				continue
+			}
+
 			// Unknown type
 			log.Warnf("%s Unknown packet type %d", c.ID, packet[0])
 			continue
@@ -530,51 +1135,179 @@ func (c *StreamClient) readEntries() {
 	}
 }
 
-// getResult consumes a result entry
-func (c *StreamClient) getResult(cmd Command) ResultEntry {
-	// Get result entry
-	r := <-c.results
-	log.Debugf("%s Result %d[%s] received for command %d[%s]", c.ID, r.errorNum, r.errorStr, cmd, StrCommand[cmd])
-	return r
+// getResult waits for the result of a command sent, until the context is done, the connection lost or the client
+// stopped. The result of a command canceled is discarded once received, as the waiter stays queued until then
+func (c *StreamClient) getResult(ctx context.Context, w *resultWaiter) (ResultEntry, error) {
+	select {
+	case r, ok := <-w.result:
+		if !ok {
+			log.Warnf("%s Connection lost waiting for the result of command %d[%s]", c.ID, w.cmd, StrCommand[w.cmd])
+			return ResultEntry{}, ErrConnectionLost
+		}
+		log.Debugf("%s Result %d[%s] received for command %d[%s]", c.ID, r.errorNum, r.errorStr, w.cmd,
+			StrCommand[w.cmd])
+		return r, nil
+	case <-ctx.Done():
+		log.Warnf("%s Command %d[%s] canceled waiting for its result: %v", c.ID, w.cmd, StrCommand[w.cmd], ctx.Err())
+		return ResultEntry{}, ctx.Err()
+	case <-c.done:
+		return ResultEntry{}, ErrClientStopped
+	}
 }
 
-// getHeader consumes a header entry
-func (c *StreamClient) getHeader() HeaderEntry {
-	h := <-c.headers
-	log.Debugf("%s Header received info: TotalEntries[%d], TotalLength[%d], Version[%d], SystemID[%d]",
-		c.ID, h.TotalEntries, h.TotalLength, h.Version, h.SystemID)
-	return h
+// nextWaiter dequeues the command waiting for the next result received (nil if none)
+func (c *StreamClient) nextWaiter() *resultWaiter {
+	c.mutexWaiters.Lock()
+	defer c.mutexWaiters.Unlock()
+
+	if len(c.waiters) == 0 {
+		return nil
+	}
+	w := c.waiters[0]
+	c.waiters[0] = nil
+	c.waiters = c.waiters[1:]
+	return w
+}
+
+// removeWaiter dequeues a command not sent
+func (c *StreamClient) removeWaiter(w *resultWaiter) {
+	c.mutexWaiters.Lock()
+	defer c.mutexWaiters.Unlock()
+
+	for i := range c.waiters {
+		if c.waiters[i] == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
 }
 
-// getEntry consumes a entry from commands response
-func (c *StreamClient) getEntry() FileEntry {
-	e := <-c.entryRsp
-	log.Debugf("%s Entry received info: Number[%d]", c.ID, e.Number)
-	return e
+// failWaiters fails the commands waiting for their results on the connection closed, the results are lost
+func (c *StreamClient) failWaiters() {
+	c.mutexWaiters.Lock()
+	defer c.mutexWaiters.Unlock()
+
+	for _, w := range c.waiters {
+		close(w.result)
+	}
+	c.waiters = nil
 }
 
 // getStreaming consumes streaming data entries
 func (c *StreamClient) getStreaming() error {
+	if c.batch == nil && c.pull == nil {
+		c.startWorkers()
+		if c.prefetch != nil {
+			return c.getPrefetched()
+		}
+	}
+
 	for {
-		e := <-c.entries
-		c.nextEntry = e.Number + 1
+		var e FileEntry
+		select {
+		case e = <-c.entries:
+		case <-c.batchExpired():
+			err := c.flushBatch()
+			if err != nil {
+				return err
+			}
+			continue
+		case <-c.workers.failure():
+			return c.workers.firstError()
+		case <-c.done:
+			return nil
+		}
+
+		// Deliver the batch pending before the stop is acknowledged
+		if e.packetType == ptStopBarrier {
+			err := c.flushBatch()
+			if err != nil {
+				return err
+			}
+		}
+
+		// Skip the stop barriers and the entries discarded on stop
+		if c.passStopBarrier(&e) {
+			continue
+		}
+		c.stats.entryReceived(e.Number)
+
+		// Pass the data entry through the receive middlewares
+		passed, err := c.receiveChain.apply(&e)
+		if err != nil {
+			log.Errorf("%s Receive middleware for entry %d: %s. Exiting getStream function", c.ID, e.Number, err.Error())
+			c.stats.entryDropped(StatDropError)
+			return err
+		}
+		if !passed {
+			c.stats.entryDropped(StatDropMiddleware)
+			continue
+		}
+
+		// Verify the data entry against its trusted checkpoint root
+		err = c.verifyEntry(&e)
+		if err != nil {
+			c.stats.entryDropped(StatDropError)
+			return err
+		}
+
+		// Verify the segment completed by a bookmark against the verifier source
+		err = c.verifySegment(&e)
+		if err != nil {
+			c.stats.entryDropped(StatDropError)
+			return err
+		}
+
+		// Skip the data entry of other entry types
+		if !c.entryTypes.contains(&e) {
+			c.stats.entryDropped(StatDropEntryType)
+			continue
+		}
 
 		// Process the data entry
-		err := c.processEntry(&e, c, c.relayServer)
+		err = c.processStreamEntry(&e)
 		if err != nil {
-			log.Errorf("%s Processing entry %d: %s. Exiting getStream function", c.ID, e.Number, err.Error())
 			return err
 		}
 	}
 }
 
+// processStreamEntry processes a streaming data entry through the callback function, adds it to the batch pending,
+// hands it over to the consumer pulling the entries or dispatches it to the workers. Returns the error stopping the
+// streaming
+func (c *StreamClient) processStreamEntry(e *FileEntry) error {
+	if c.batch != nil {
+		return c.addToBatch(e)
+	}
+	if c.pull != nil {
+		c.deliverPulled(e)
+		return nil
+	}
+	if c.workers != nil {
+		return c.workers.dispatch(c, e)
+	}
+
+	c.slow.begin(e.Number)
+	err := c.processWithPolicy(e, c.processEntry, c.relayServer)
+	c.slow.end()
+	if err != nil {
+		log.Errorf("%s Processing entry %d: %s. Exiting getStream function", c.ID, e.Number, err.Error())
+		return err
+	}
+	c.checkpoint.entryProcessed(e.Number)
+	return nil
+}
+
 // GetFromStream returns streaming start entry number from the latest start command executed
 func (c *StreamClient) GetFromStream() uint64 {
-	return c.fromStream
+	return c.fromStream.Load()
 }
 
 // GetTotalEntries returns total entries number from the latest header command executed
 func (c *StreamClient) GetTotalEntries() uint64 {
+	c.mutexCmd.Lock()
+	defer c.mutexCmd.Unlock()
+
 	return c.totalEntries
 }
 
@@ -603,6 +1336,7 @@ func (c *StreamClient) IsStarted() bool {
 // PrintReceivedEntry prints received entry (default callback function)
 func PrintReceivedEntry(e *FileEntry, c *StreamClient, s *StreamServer) error {
 	// Log data entry fields
-	log.Debugf("Data entry(%s): %d | %d | %d | %d", c.ID, e.Number, e.Length, e.Type, len(e.Data))
+	log.Debugf("Data entry(%s): %s | %d | %d | %d%s", c.ID, FormatEntryNumber(e.Number), e.Length, e.Type, len(e.Data),
+		PayloadPreview(e.Data))
 	return nil
 }
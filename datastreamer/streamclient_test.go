@@ -0,0 +1,108 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientContext(t *testing.T) {
+	// Server accepting the connections without answering
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conns := []net.Conn{}
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	withTimeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	// Case: Server not listening -> Connection attempts canceled, client not started
+	client, err := datastreamer.NewClient(fmt.Sprintf("127.0.0.1:%d", freePort(t)), streamType)
+	require.NoError(t, err)
+	start := time.Now()
+	require.ErrorIs(t, client.StartContext(withTimeout()), context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.False(t, client.IsStarted())
+
+	// Case: Server not answering -> Query and streaming commands canceled
+	client, err = datastreamer.NewClient(ln.Addr().String(), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.StartContext(withTimeout()))
+	_, err = client.ExecCommandGetHeaderContext(withTimeout())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = client.ExecCommandGetEntryContext(withTimeout(), 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, client.ExecCommandStartContext(withTimeout(), 0), context.DeadlineExceeded)
+
+	// Case: Default command deadline -> Commands without context timed out
+	client.SetCommandTimeout(200 * time.Millisecond)
+	start = time.Now()
+	_, err = client.ExecCommandGetStats()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, client.ExecCommandStop(), context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestClientClose(t *testing.T) {
+	server, port := newTestServer(t, "close.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 10)
+	goroutines := runtime.NumGoroutine()
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	client.SetPrefetch(4, 0)
+	var received atomic.Int32
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		received.Add(1)
+		return nil
+	})
+
+	// Case: Client closed while streaming -> Goroutines exited, client not started
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	require.Eventually(t, func() bool { return received.Load() == 10 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, client.Close())
+	require.False(t, client.IsStarted())
+	require.ErrorIs(t, client.ExecCommandStart(0), datastreamer.ErrExecCommandNotAllowed)
+	require.Eventually(t, func() bool {
+		// The condition runs in a goroutine of its own
+		return runtime.NumGoroutine() <= goroutines+1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Case: Client closed started again -> Streaming from scratch
+	received.Store(0)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(5))
+	require.Eventually(t, func() bool { return received.Load() == 5 }, 2*time.Second, 10*time.Millisecond)
+
+	// Case: Client closed twice -> OK
+	require.NoError(t, client.Close())
+	require.NoError(t, client.Close())
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
@@ -0,0 +1,104 @@
+package datastreamer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const maxCommandBackoff = time.Second // Maximum wait before retrying a command
+
+// CommandPolicy type for the timeout and the automatic retries of a command
+type CommandPolicy struct {
+	Timeout time.Duration // Deadline of each attempt (0 for the default deadline of the commands)
+	Retries int           // Retries of an attempt timed out or failed on the connection (idempotent commands only)
+	Backoff time.Duration // Wait before the first retry, doubled on each one (all up to 1s, 0 for none)
+}
+
+// idempotentCommands are the commands retried automatically, their response doesn't depend on being executed once
+var idempotentCommands = map[Command]struct{}{
+	CmdHeader:   {},
+	CmdEntry:    {},
+	CmdBookmark: {},
+}
+
+// SetCommandPolicy sets the timeout of a command, overriding the default deadline of the commands
+// (SetCommandTimeout), and its automatic retries, so a caller doesn't hang nor fail on a server not replying or a
+// connection dropped. Only the idempotent commands (Header, Entry and Bookmark) can be retried,
+// ErrCommandNotIdempotent otherwise. The context of the command still bounds all the attempts, and an error result
+// of the server (e.g. entry not found) isn't retried (call before Start)
+func (c *StreamClient) SetCommandPolicy(cmd Command, policy CommandPolicy) error {
+	if !cmd.IsACommand() {
+		return ErrInvalidCommand
+	}
+	if _, ok := idempotentCommands[cmd]; policy.Retries > 0 && !ok {
+		log.Errorf("%s Command %d[%s] can't be retried, it's not idempotent", c.ID, cmd, StrCommand[cmd])
+		return ErrCommandNotIdempotent
+	}
+	if c.cmdPolicies == nil {
+		c.cmdPolicies = make(map[Command]CommandPolicy)
+	}
+	c.cmdPolicies[cmd] = CommandPolicy{
+		Timeout: max(policy.Timeout, 0),
+		Retries: max(policy.Retries, 0),
+		Backoff: min(max(policy.Backoff, 0), maxCommandBackoff),
+	}
+	return nil
+}
+
+// commandPolicy returns the timeout and retries of a command
+func (c *StreamClient) commandPolicy(cmd Command) CommandPolicy {
+	policy := c.cmdPolicies[cmd]
+	if policy.Timeout == 0 {
+		policy.Timeout = c.cmdTimeout
+	}
+	return policy
+}
+
+// execRetriedCommand executes a query command with a deadline of each attempt, retrying the attempts timed out or
+// failed on the connection
+func (c *StreamClient) execRetriedCommand(ctx context.Context, cmd Command, policy CommandPolicy, fromEntry uint64,
+	fromBookmark []byte) (HeaderEntry, FileEntry, error) {
+	backoff := policy.Backoff
+	for retry := 0; ; retry++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		}
+		header, entry, err := c.execQueryCommand(attemptCtx, cmd, fromEntry, fromBookmark)
+		cancel()
+		if err == nil || retry >= policy.Retries || ctx.Err() != nil || !isRetryableCommandError(err) {
+			return header, entry, err
+		}
+
+		log.Warnf("%s Command %d[%s] attempt %d of %d failed, retrying in %v: %v", c.ID, cmd, StrCommand[cmd],
+			retry+1, policy.Retries+1, backoff, err)
+
+		// The command channel not replying is replaced, failing the other commands pipelined over it
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.mutexSession.Lock()
+			c.closeCommandConn()
+			c.mutexSession.Unlock()
+		}
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return header, entry, ctx.Err()
+			}
+			backoff = min(2*backoff, maxCommandBackoff) //nolint:mnd
+		}
+	}
+}
+
+// isRetryableCommandError checks if a command error is an attempt timed out or failed on the connection, not an
+// error result of the server
+func isRetryableCommandError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
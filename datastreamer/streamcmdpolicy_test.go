@@ -0,0 +1,57 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCommandPolicy(t *testing.T) {
+	server, port := newTestServer(t, "policy.bin")
+	require.NoError(t, server.Start())
+	require.NoError(t, server.StartAtomicOp())
+	_, err := server.AddStreamBookmark([]byte{0, 1})
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+
+	proxy := newTestProxy(t, fmt.Sprintf("localhost:%d", port))
+	client, err := datastreamer.NewClient(proxy.ln.Addr().String(), streamType)
+	require.NoError(t, err)
+
+	// Case: Retries of a command not idempotent -> Rejected
+	require.ErrorIs(t, client.SetCommandPolicy(datastreamer.CmdStart, datastreamer.CommandPolicy{Retries: 1}),
+		datastreamer.ErrCommandNotIdempotent)
+	require.NoError(t, client.SetCommandPolicy(datastreamer.CmdHeader, datastreamer.CommandPolicy{
+		Timeout: 200 * time.Millisecond, Retries: 2, Backoff: 10 * time.Millisecond}))
+	require.NoError(t, client.SetCommandPolicy(datastreamer.CmdEntry, datastreamer.CommandPolicy{Retries: 2}))
+	require.NoError(t, client.SetCommandPolicy(datastreamer.CmdBookmark, datastreamer.CommandPolicy{
+		Timeout: 100 * time.Millisecond}))
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.Start())
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), header.TotalEntries)
+
+	// Case: Server not replying to an idempotent command retried -> Attempt timed out, retried on a new connection
+	proxy.freezeConnections()
+	start := time.Now()
+	header, err = client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), header.TotalEntries)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	// Case: Error result of the server -> Not retried
+	_, err = client.ExecCommandGetEntry(100)
+	require.ErrorIs(t, err, datastreamer.ErrEntryNotFound)
+
+	// Case: Server not replying to a command without retries -> Timed out
+	proxy.freezeConnections()
+	start = time.Now()
+	_, err = client.ExecCommandGetBookmark([]byte{0, 1})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,56 @@
+package datastreamer
+
+import (
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// SetWriteCoalescing sets the server to group the writes of the data entries to the stream file within a time
+// window (e.g. 0-10ms), so a burst of AddStreamEntry calls reaches the OS as a few larger writes, reducing the write
+// amplification on the SSDs with large write units (ZNS, QLC). The writes are flushed at the latest on the commit of
+// the atomic operation and at the end of each data page, and discarded on its rollback. 0 disables it (call before
+// Start)
+func (s *StreamServer) SetWriteCoalescing(window time.Duration) {
+	s.streamFile.writeWindow = max(window, 0)
+}
+
+// SetWriteCoalescing sets the relay server side to group the writes to the stream file (call before Start)
+func (r *StreamRelay) SetWriteCoalescing(window time.Duration) {
+	r.server.SetWriteCoalescing(window)
+}
+
+// writeData writes data at the current position of the stream file, coalescing it within the write window
+func (f *StreamFile) writeData(data []byte) error {
+	if f.writeWindow == 0 {
+		return f.writeFile(data)
+	}
+
+	if len(f.writeBuffer) == 0 {
+		f.writeSince = time.Now()
+	}
+	f.writeBuffer = append(f.writeBuffer, data...)
+	if time.Since(f.writeSince) >= f.writeWindow {
+		return f.flushWrites()
+	}
+	return nil
+}
+
+// flushWrites writes to the stream file the data coalesced
+func (f *StreamFile) flushWrites() error {
+	if len(f.writeBuffer) == 0 {
+		return nil
+	}
+
+	err := f.writeFile(f.writeBuffer)
+	if err != nil {
+		log.Errorf("Error flushing %d bytes coalesced: %v", len(f.writeBuffer), err)
+	}
+	f.writeBuffer = f.writeBuffer[:0]
+	return err
+}
+
+// discardWrites discards the data coalesced not written to the stream file
+func (f *StreamFile) discardWrites() {
+	f.writeBuffer = f.writeBuffer[:0]
+}
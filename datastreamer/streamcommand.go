@@ -0,0 +1,377 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// pendingCommand is a command sent over the pipelined command channel waiting for its response
+type pendingCommand struct {
+	cmd  Command
+	conn net.Conn
+	done chan commandResponse
+}
+
+// commandResponse is the result and the data response of a command
+type commandResponse struct {
+	r      ResultEntry
+	header HeaderEntry
+	entry  FileEntry
+	err    error
+}
+
+// getCommandConn returns the command channel to the server: the command stream of the multiplexed session, or a
+// separate connection if not multiplexed. The command channel is opened on first use. Returns if the channel is
+// pipelined (the server supports request IDs)
+func (c *StreamClient) getCommandConn(ctx context.Context) (net.Conn, bool, error) {
+	c.mutexSession.Lock()
+	defer c.mutexSession.Unlock()
+
+	if c.connCmd != nil {
+		return c.connCmd, c.cmdRequestIDs, nil
+	}
+
+	conn, err := c.openCommandConn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Detect the server protocol version, the legacy protocol doesn't correlate the commands with request IDs
+	protocol, err := c.detectProtocol(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	c.cmdRequestIDs = protocol >= ProtocolTagged
+	if c.cmdRequestIDs {
+		// Responses are dispatched to the pending commands by request ID
+		go c.readCommandResponses(conn)
+	} else {
+		log.Infof("%s Server doesn't support request IDs", c.ID)
+	}
+
+	c.connCmd = conn
+	return c.connCmd, c.cmdRequestIDs, nil
+}
+
+// openCommandConn opens a new command channel to the server, the context cancels the connection attempt
+func (c *StreamClient) openCommandConn(ctx context.Context) (net.Conn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.session != nil {
+		conn, err = c.session.Open()
+	} else {
+		conn, err = c.dial(ctx)
+		if err == nil {
+			err = c.authenticate(conn)
+			if err != nil {
+				conn.Close()
+			}
+		}
+	}
+	if err != nil {
+		log.Errorf("%s Error opening command channel: %v", c.ID, err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// resetCommandConn closes the command channel so the next command opens a new one
+func (c *StreamClient) resetCommandConn(conn net.Conn) {
+	c.mutexSession.Lock()
+	defer c.mutexSession.Unlock()
+
+	conn.Close()
+	if c.connCmd == conn {
+		c.connCmd = nil
+	}
+}
+
+// closeCommandConn closes the command channel (mutexSession must be locked)
+func (c *StreamClient) closeCommandConn() {
+	if c.connCmd != nil {
+		c.connCmd.Close()
+	}
+	c.connCmd = nil
+}
+
+// execQueryCommand executes a client TCP query command over the command channel, so its result and response never
+// contend with the streaming data packets. With request IDs support, several commands can be in flight at the same
+// time. The command is retried once on a new channel if the current one failed, not if the context is done
+func (c *StreamClient) execQueryCommand(ctx context.Context, cmd Command, fromEntry uint64,
+	fromBookmark []byte) (HeaderEntry, FileEntry, error) {
+	var rsp commandResponse
+	for retry := 0; retry < 2; retry++ {
+		conn, pipelined, err := c.getCommandConn(ctx)
+		if err != nil {
+			return rsp.header, rsp.entry, err
+		}
+
+		// Send command, and get the command result and the data response
+		if pipelined {
+			rsp = c.execPipelinedCommand(ctx, conn, cmd, fromEntry, fromBookmark)
+		} else {
+			rsp = c.execSerialCommand(ctx, conn, cmd, fromEntry, fromBookmark)
+		}
+		if rsp.err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			// The pipelined channel keeps serving the other commands, the response is discarded once received
+			log.Warnf("%s Command %d[%s] canceled: %v", c.ID, cmd, StrCommand[cmd], ctx.Err())
+			if !pipelined {
+				c.resetCommandConn(conn)
+			}
+			rsp.err = ctx.Err()
+			break
+		}
+		log.Warnf("%s Error on command channel for command %d[%s]: %v", c.ID, cmd, StrCommand[cmd], rsp.err)
+		c.resetCommandConn(conn)
+	}
+	header, entry, r := rsp.header, rsp.entry, rsp.r
+	if rsp.err != nil {
+		c.stats.addError(StatErrCommand, rsp.err)
+		return header, entry, rsp.err
+	}
+
+	log.Debugf("%s Result %d[%s] received for command %d[%s]", c.ID, r.errorNum, r.errorStr, cmd, StrCommand[cmd])
+	if r.errorNum == uint32(CmdErrNoHeaderChanges) {
+		c.stats.addError(StatErrCommand, ErrHeaderChangesNotRecorded)
+		return header, entry, ErrHeaderChangesNotRecorded
+	}
+	if r.errorNum == uint32(CmdErrNoCheckpoint) {
+		c.stats.addError(StatErrCommand, ErrEntryNotCheckpointed)
+		return header, entry, ErrEntryNotCheckpointed
+	}
+	if r.errorNum == uint32(CmdErrNoPosition) {
+		c.stats.addError(StatErrCommand, ErrPositionNotStored)
+		return header, entry, ErrPositionNotStored
+	}
+	if r.errorNum == uint32(CmdErrBadFromEntry) && cmd == CmdEntryRange {
+		c.stats.addError(StatErrCommand, ErrInvalidEntryNumber)
+		return header, entry, ErrInvalidEntryNumber
+	}
+	if r.errorNum == uint32(CmdErrInvalidCommand) {
+		err := errNotSupported(cmd, c.protocol.Load())
+		c.stats.addError(StatErrCommand, err)
+		return header, entry, err
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		c.stats.addError(StatErrCommand, ErrResultCommandError)
+		return header, entry, ErrResultCommandError
+	}
+
+	switch cmd {
+	case CmdHeader:
+		c.mutexCmd.Lock()
+		c.totalEntries = header.TotalEntries
+		c.mutexCmd.Unlock()
+	case CmdEntry:
+		if entry.Type == EntryTypeNotFound {
+			return header, FileEntry{}, ErrEntryNotFound
+		}
+	case CmdBookmark:
+		if entry.Type == EntryTypeNotFound {
+			return header, FileEntry{}, ErrBookmarkNotFound
+		}
+	}
+
+	return header, entry, nil
+}
+
+// execSerialCommand executes a command waiting for its response before another command can be sent. Once the
+// context is done, the channel deadline is expired to unblock it
+func (c *StreamClient) execSerialCommand(ctx context.Context, conn net.Conn, cmd Command, fromEntry uint64,
+	fromBookmark []byte) commandResponse {
+	c.mutexCmd.Lock()
+	defer c.mutexCmd.Unlock()
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	rsp := commandResponse{}
+	rsp.err = c.writeCommand(conn, cmd, 0, fromEntry, fromBookmark)
+	if rsp.err == nil {
+		rsp.r, rsp.header, rsp.entry, rsp.err = c.readCommandResponse(conn, cmd, 0)
+	}
+	if !stop() && rsp.err == nil {
+		// The deadline may be expired, the channel is reset
+		rsp.err = ctx.Err()
+	}
+	return rsp
+}
+
+// execPipelinedCommand sends a command with a new request ID and waits for its response, without blocking other
+// commands meanwhile, or until the context is done
+func (c *StreamClient) execPipelinedCommand(ctx context.Context, conn net.Conn, cmd Command, fromEntry uint64,
+	fromBookmark []byte) commandResponse {
+	requestID := c.nextRequestID.Add(1)
+	pending := &pendingCommand{
+		cmd:  cmd,
+		conn: conn,
+		done: make(chan commandResponse, 1),
+	}
+
+	// Register the command before sending it, so its response always finds it
+	c.mutexPending.Lock()
+	c.pending[requestID] = pending
+	c.mutexPending.Unlock()
+
+	c.mutexCmd.Lock()
+	err := c.writeCommand(conn, cmd, requestID, fromEntry, fromBookmark)
+	c.mutexCmd.Unlock()
+	if err != nil {
+		c.mutexPending.Lock()
+		delete(c.pending, requestID)
+		c.mutexPending.Unlock()
+		return commandResponse{err: err}
+	}
+
+	// A command canceled stays pending, its response is dispatched to the buffered channel and discarded
+	select {
+	case rsp := <-pending.done:
+		return rsp
+	case <-ctx.Done():
+		return commandResponse{err: ctx.Err()}
+	}
+}
+
+// readCommandResponses reads the responses from a pipelined command channel and dispatches them to the pending
+// commands by request ID, until the channel fails
+func (c *StreamClient) readCommandResponses(conn net.Conn) {
+	for {
+		// Read the tagged frame of the result
+		requestID, err := c.readFrameTag(conn)
+		if err == nil {
+			c.mutexPending.Lock()
+			pending := c.pending[requestID]
+			delete(c.pending, requestID)
+			c.mutexPending.Unlock()
+
+			if pending == nil || pending.conn != conn {
+				log.Errorf("%s Unexpected request ID %d on command channel", c.ID, requestID)
+				err = ErrRequestIDMismatch
+			} else {
+				rsp := commandResponse{}
+				rsp.r, rsp.header, rsp.entry, rsp.err = c.readCommandData(conn, pending.cmd, requestID, true)
+				pending.done <- rsp
+				err = rsp.err
+			}
+		}
+		if err != nil {
+			// Close the channel first, so no more commands are sent over it
+			c.resetCommandConn(conn)
+			c.failPendingCommands(conn, err)
+			return
+		}
+	}
+}
+
+// failPendingCommands ends with error the pending commands sent over a failed command channel
+func (c *StreamClient) failPendingCommands(conn net.Conn, err error) {
+	c.mutexPending.Lock()
+	defer c.mutexPending.Unlock()
+
+	for requestID, pending := range c.pending {
+		if pending.conn == conn {
+			pending.done <- commandResponse{err: err}
+			delete(c.pending, requestID)
+		}
+	}
+}
+
+// readCommandResponse reads from the command channel the result and the data response of a command, checking
+// they are tagged with its request ID (if not zero)
+func (c *StreamClient) readCommandResponse(conn net.Conn, cmd Command,
+	requestID uint64) (ResultEntry, HeaderEntry, FileEntry, error) {
+	return c.readCommandData(conn, cmd, requestID, false)
+}
+
+// readCommandData reads the result and the data response of a command, with the tagged frame of the result already
+// read or not
+func (c *StreamClient) readCommandData(conn net.Conn, cmd Command, requestID uint64,
+	framed bool) (ResultEntry, HeaderEntry, FileEntry, error) {
+	r := ResultEntry{}
+	header := HeaderEntry{}
+	entry := FileEntry{}
+
+	// Read the result
+	resultID := requestID
+	if framed {
+		resultID = 0
+	}
+	err := c.readPacketType(conn, PtResult, resultID)
+	if err != nil {
+		return r, header, entry, err
+	}
+	r, err = c.readResultEntry(conn)
+	if err != nil || r.errorNum != uint32(CmdErrOK) {
+		return r, header, entry, err
+	}
+
+	// Read the data response
+	switch cmd {
+	case CmdHeader:
+		err = c.readPacketType(conn, PtHeader, requestID)
+		if err != nil {
+			return r, header, entry, err
+		}
+		header, err = c.readHeaderEntry(conn)
+		if err == nil {
+			log.Debugf("%s Header received info: TotalEntries[%d], TotalLength[%d], Version[%d], SystemID[%d]",
+				c.ID, header.TotalEntries, header.TotalLength, header.Version, header.SystemID)
+		}
+	case CmdEntry, CmdBookmark, CmdStats, CmdHeaderChanges, CmdCheckpointProof, CmdEntriesByTime, CmdSchemas,
+		CmdGetPosition, CmdEntryRange, CmdLatestStates:
+		err = c.readPacketType(conn, PtDataRsp, requestID)
+		if err != nil {
+			return r, header, entry, err
+		}
+		entry, err = c.readDataEntry(conn)
+	}
+
+	return r, header, entry, err
+}
+
+// readPacketType reads the packet type from a connection and checks it's the expected one. If the request ID is
+// not zero, the packet must come in a frame tagged with it
+func (c *StreamClient) readPacketType(conn net.Conn, expected uint8, requestID uint64) error {
+	packet := make([]byte, 1)
+	if requestID != 0 {
+		tag, err := c.readFrameTag(conn)
+		if err != nil {
+			return err
+		}
+		if tag != requestID {
+			log.Errorf("%s Unexpected request ID %d, expected %d", c.ID, tag, requestID)
+			return ErrRequestIDMismatch
+		}
+	}
+	err := c.readContent(conn, packet)
+	if err != nil {
+		return err
+	}
+	if packet[0] != expected {
+		log.Errorf("%s Unexpected packet type %d, expected %d", c.ID, packet[0], expected)
+		return ErrUnexpectedPacketType
+	}
+	return nil
+}
+
+// readFrameTag reads a tagged frame prefix from a connection and returns its tag
+func (c *StreamClient) readFrameTag(conn net.Conn) (uint64, error) {
+	frame := make([]byte, FixedSizeTaggedFrame)
+	err := c.readContent(conn, frame)
+	if err != nil {
+		return 0, err
+	}
+	if frame[0] != PtTagged {
+		log.Errorf("%s Unexpected packet type %d, expected tagged frame", c.ID, frame[0])
+		return 0, ErrUnexpectedPacketType
+	}
+	return binary.BigEndian.Uint64(frame[1:]), nil
+}
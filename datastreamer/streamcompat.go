@@ -0,0 +1,188 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	// ProtocolLegacy is the protocol version of the servers not reporting it: the original untagged commands Start,
+	// Stop, Header, StartBookmark, Entry and Bookmark
+	ProtocolLegacy uint32 = 1
+	// ProtocolTagged is the protocol version of the tagged commands (subscriptions and request IDs), the
+	// multiplexing, the rest of the commands up to the authentication and the versioned header
+	ProtocolTagged uint32 = 2
+	// ProtocolGroups is the protocol version of the consumer groups commands StartGroup and CommitGroup
+	ProtocolGroups uint32 = 3
+	// ProtocolPositions is the protocol version of the client positions commands CommitPosition and GetPosition
+	ProtocolPositions uint32 = 4
+	// ProtocolEntryRange is the protocol version of the entry range command EntryRange
+	ProtocolEntryRange uint32 = 5
+	// ProtocolEntryTypes is the protocol version of the entry types command EntryTypes
+	ProtocolEntryTypes uint32 = 6
+	// ProtocolLatestStates is the protocol version of the latest view command LatestStates
+	ProtocolLatestStates uint32 = 7
+	// ProtocolCompression is the protocol version of the compression command Compression
+	ProtocolCompression uint32 = 8
+	// ProtocolHeartbeat is the protocol version of the heartbeat command Ping
+	ProtocolHeartbeat uint32 = 9
+	// ProtocolChecksum is the protocol version of the checksums of the streamed entries command Checksum
+	ProtocolChecksum uint32 = 10
+	// ProtocolVersion is the protocol version of this server
+	ProtocolVersion = ProtocolChecksum
+)
+
+// ProtocolVersion returns the protocol version introducing a command
+func (c Command) ProtocolVersion() uint32 {
+	switch c {
+	case CmdStart, CmdStop, CmdHeader, CmdStartBookmark, CmdEntry, CmdBookmark:
+		return ProtocolLegacy
+	case CmdStartGroup, CmdCommitGroup:
+		return ProtocolGroups
+	case CmdCommitPosition, CmdGetPosition:
+		return ProtocolPositions
+	case CmdEntryRange:
+		return ProtocolEntryRange
+	case CmdEntryTypes:
+		return ProtocolEntryTypes
+	case CmdLatestStates:
+		return ProtocolLatestStates
+	case CmdCompression:
+		return ProtocolCompression
+	case CmdPing:
+		return ProtocolHeartbeat
+	case CmdChecksum:
+		return ProtocolChecksum
+	default:
+		return ProtocolTagged
+	}
+}
+
+// errNotSupported returns the error of a command not supported by the server protocol version
+func errNotSupported(cmd Command, protocol uint32) error {
+	return fmt.Errorf("%w: command %d[%s] with server protocol version %d", ErrNotSupportedByServer, cmd,
+		StrCommand[cmd], protocol)
+}
+
+// GetServerProtocol returns the protocol version of the server detected from the versioned header on the command
+// channel (ProtocolLegacy for the older servers not reporting it, 0 until the first command). The commands not
+// supported by it return ErrNotSupportedByServer without being sent, so a new client keeps working with the older
+// servers during a rolling upgrade of a relay tree (the command channel isn't pipelined with them)
+func (c *StreamClient) GetServerProtocol() uint32 {
+	return c.protocol.Load()
+}
+
+// checkProtocol checks if a command, tagged or not, is supported by the server protocol version (if detected)
+func (c *StreamClient) checkProtocol(cmd Command, tagged bool) error {
+	protocol := c.protocol.Load()
+	if protocol == 0 {
+		return nil
+	}
+	required := cmd.ProtocolVersion()
+	if tagged {
+		required = max(required, ProtocolTagged)
+	}
+	if required > protocol {
+		log.Warnf("%s Command %d[%s] requires server protocol version %d, server %d", c.ID, cmd, StrCommand[cmd],
+			required, protocol)
+		return errNotSupported(cmd, protocol)
+	}
+	return nil
+}
+
+// detectProtocol gets the versioned header on a new command channel to detect the server protocol version. The
+// older servers answer the unknown untagged command with an error, keeping the channel usable
+func (c *StreamClient) detectProtocol(ctx context.Context, conn net.Conn) (uint32, error) {
+	// Don't wait forever for a server not answering, nor once the context is done
+	_ = conn.SetReadDeadline(time.Now().Add(defaultTimeout))
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer func() {
+		stop()
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	protocol, err := c.readProtocol(conn)
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		log.Errorf("%s Error detecting server protocol version: %v", c.ID, err)
+		return 0, err
+	}
+	if protocol == ProtocolLegacy {
+		log.Infof("%s Server doesn't report its protocol version, legacy protocol", c.ID)
+	} else {
+		log.Infof("%s Server protocol version %d", c.ID, protocol)
+	}
+	c.protocol.Store(protocol)
+	return protocol, nil
+}
+
+// readProtocol sends the versioned header command and reads the protocol version from the response
+func (c *StreamClient) readProtocol(conn net.Conn) (uint32, error) {
+	err := c.writeCommand(conn, CmdHeader|CmdFlagVersioned, 0, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	r, header, _, err := c.readCommandResponse(conn, CmdHeader, 0)
+	if err != nil {
+		return 0, err
+	}
+	switch r.errorNum {
+	case uint32(CmdErrOK):
+	case uint32(CmdErrInvalidCommand):
+		return ProtocolLegacy, nil
+	case uint32(CmdErrUnauthorized):
+		return 0, ErrUnauthorized
+	default:
+		return 0, ErrResultCommandError
+	}
+
+	// Header followed by the protocol version
+	buffer := make([]byte, 4) //nolint:mnd
+	err = c.readContent(conn, buffer)
+	if err != nil {
+		return 0, err
+	}
+	c.mutexCmd.Lock()
+	c.totalEntries = header.TotalEntries
+	c.mutexCmd.Unlock()
+	return binary.BigEndian.Uint32(buffer), nil
+}
+
+// handleVersionedHeaderCommand processes the CmdHeader command with the CmdFlagVersioned flag: the header followed
+// by the server protocol version
+func (s *StreamServer) handleVersionedHeaderCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("Header command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrHeaderCommandNotAllowed
+	}
+	log.Debugf("Client %s command Header versioned", cli.clientID)
+	cli.versioned = true
+
+	// Send a command result entry OK
+	err := s.sendResultEntry(0, "OK", cli)
+	if err != nil {
+		return err
+	}
+
+	// Send the current written/committed file header and the protocol version
+	header := s.streamFile.getHeaderEntry()
+	data := binary.BigEndian.AppendUint32(encodeHeaderEntryToBinary(header), ProtocolVersion)
+	if cli.conn != nil {
+		_, err = TimeoutWrite(cli, data, s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending versioned header entry to %s: %v", cli.clientID, err)
+		return err
+	}
+	return nil
+}
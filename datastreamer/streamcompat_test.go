@@ -0,0 +1,92 @@
+package datastreamer_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientServerProtocol(t *testing.T) {
+	server, port := newTestServer(t, "protocol.bin")
+	require.NoError(t, server.Start())
+
+	// Case: Current server -> Protocol version reported in the versioned header
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	require.Zero(t, client.GetServerProtocol())
+	_, err = client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.ProtocolVersion, client.GetServerProtocol())
+	_, err = client.ExecCommandGetStats()
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	// Legacy server answering the header and rejecting the rest of the commands (without parameters)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	var mutex sync.Mutex
+	received := []uint64{}
+	result := func(errorNum uint32, errorStr string) []byte {
+		b := append([]byte{datastreamer.PtResult}, binary.BigEndian.AppendUint32(nil,
+			uint32(datastreamer.FixedSizeResultEntry+len(errorStr)))...)
+		return append(binary.BigEndian.AppendUint32(b, errorNum), errorStr...)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				command := make([]byte, 16)
+				for {
+					if _, err := io.ReadFull(conn, command); err != nil {
+						return
+					}
+					cmd := binary.BigEndian.Uint64(command)
+					mutex.Lock()
+					received = append(received, cmd)
+					mutex.Unlock()
+					if datastreamer.Command(cmd) != datastreamer.CmdHeader {
+						_, _ = conn.Write(result(uint32(datastreamer.CmdErrInvalidCommand), "Invalid command"))
+						continue
+					}
+					header := append([]byte{datastreamer.PtHeader}, binary.BigEndian.AppendUint32(nil, 38)...)
+					header = append(header, 1)
+					header = binary.BigEndian.AppendUint64(header, 137)
+					header = binary.BigEndian.AppendUint64(header, uint64(streamType))
+					header = binary.BigEndian.AppendUint64(header, 4096)
+					header = binary.BigEndian.AppendUint64(header, 5)
+					_, _ = conn.Write(append(result(0, "OK"), header...))
+				}
+			}()
+		}
+	}()
+
+	// Case: Legacy server -> Original commands work, the rest not supported without being sent
+	client, err = datastreamer.NewClient(ln.Addr().String(), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), header.TotalEntries)
+	require.Equal(t, datastreamer.ProtocolLegacy, client.GetServerProtocol())
+	_, err = client.ExecCommandGetStats()
+	require.ErrorIs(t, err, datastreamer.ErrNotSupportedByServer)
+	_, err = client.Subscribe(0, nil)
+	require.ErrorIs(t, err, datastreamer.ErrNotSupportedByServer)
+	mutex.Lock()
+	require.Equal(t, []uint64{uint64(datastreamer.CmdHeader | datastreamer.CmdFlagVersioned),
+		uint64(datastreamer.CmdHeader)}, received)
+	mutex.Unlock()
+}
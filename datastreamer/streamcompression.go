@@ -0,0 +1,180 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/golang/snappy"
+)
+
+const minCompressedData = 128 // Minimum data size of an entry to be compressed when streamed
+
+// Compression type for the codec of the compression of the entries streamed to a client
+type Compression uint32
+
+const (
+	// CompressionNone streams the entries uncompressed (default)
+	CompressionNone Compression = 0
+	// CompressionSnappy streams the data of the entries compressed with snappy (block format)
+	CompressionSnappy Compression = 1
+)
+
+// StrCompression is the name of the compression codecs
+var StrCompression = map[Compression]string{
+	CompressionNone:   "none",
+	CompressionSnappy: "snappy",
+}
+
+// String returns the name of the compression codec
+func (c Compression) String() string {
+	if name, ok := StrCompression[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseCompression returns the compression codec from its name
+func ParseCompression(name string) (Compression, error) {
+	for compression, str := range StrCompression {
+		if strings.EqualFold(name, str) {
+			return compression, nil
+		}
+	}
+	return CompressionNone, ErrInvalidCompression
+}
+
+// SetCompression sets the compression codec requested to the server on each connection (Compression command), to
+// receive the data of the streamed entries compressed (PtCompressed packets) and decompressed by the client before
+// the receive middlewares. The entries with small data, or not reduced by the codec, are still sent uncompressed.
+// The servers not supporting it keep sending the entries uncompressed (call before Start)
+func (c *StreamClient) SetCompression(compression Compression) {
+	c.compression = compression
+}
+
+// negotiateCompression requests the compression codec to the server on a new connection (if set and supported by
+// the server protocol version, detected on the command channel)
+func (c *StreamClient) negotiateCompression(ctx context.Context, conn net.Conn) error {
+	if c.compression == CompressionNone {
+		return nil
+	}
+	if c.protocol.Load() == 0 {
+		_, _, err := c.getCommandConn(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if c.checkProtocol(CmdCompression, false) != nil {
+		log.Warnf("%s Streaming uncompressed", c.ID)
+		return nil
+	}
+
+	c.mutexWrite.Lock()
+	err := c.writeCommand(conn, CmdCompression, 0, uint64(c.compression), nil)
+	c.mutexWrite.Unlock()
+	if err != nil {
+		return err
+	}
+	err = c.readPacketType(conn, PtResult, 0)
+	if err != nil {
+		return err
+	}
+	r, err := c.readResultEntry(conn)
+	if err != nil {
+		return err
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		log.Warnf("%s Compression %s rejected by server %s: %d[%s], streaming uncompressed", c.ID, c.compression,
+			c.serverAddr(), r.errorNum, r.errorStr)
+	}
+	return nil
+}
+
+// readStreamedEntry reads a streamed data entry from server connection, decompressed if it's of packet type
+// PtCompressed, and verified with its checksum if negotiated
+func (c *StreamClient) readStreamedEntry(conn net.Conn, packetType uint8) (FileEntry, error) {
+	e, err := c.readDataEntry(conn)
+	if err != nil {
+		return e, err
+	}
+	c.corruptFrame(&e)
+	if packetType == PtCompressed {
+		c.stats.compressedReceived(e.Length)
+	}
+	checksum, checked := uint32(0), c.checksummed.Load()
+	if checked {
+		checksum, err = c.splitChecksum(&e)
+		if err != nil {
+			return FileEntry{}, err
+		}
+	}
+	if packetType == PtCompressed {
+		data, err := snappy.Decode(nil, e.Data)
+		if err != nil {
+			log.Errorf("%s Error decompressing data entry %d: %v", c.ID, e.Number, err)
+			return FileEntry{}, ErrDecompressingEntry
+		}
+		e.Data = data
+		e.Length = FixedSizeFileEntry + uint32(len(data))
+	}
+	if checked {
+		err = c.verifyChecksum(&e, checksum)
+		if err != nil {
+			return FileEntry{}, err
+		}
+	}
+	return e, nil
+}
+
+// encodeEntry encodes a data entry streamed to the client, with its data compressed with the codec negotiated if
+// it's reduced, and its checksum appended if negotiated
+func (c *client) encodeEntry(e FileEntry) []byte {
+	return c.appendChecksum(c.compressEntry(e), &e)
+}
+
+// compressEntry encodes a data entry with its data compressed with the codec negotiated if it's reduced
+func (c *client) compressEntry(e FileEntry) []byte {
+	if Compression(c.compression.Load()) != CompressionSnappy || len(e.Data) < minCompressedData {
+		return encodeFileEntryToBinary(e)
+	}
+	data := snappy.Encode(nil, e.Data)
+	if len(data) >= len(e.Data) {
+		return encodeFileEntryToBinary(e)
+	}
+	be := make([]byte, 1, FixedSizeFileEntry+len(data))
+	be[0] = PtCompressed
+	be = binary.BigEndian.AppendUint32(be, uint32(FixedSizeFileEntry+len(data)))
+	be = binary.BigEndian.AppendUint32(be, uint32(e.Type))
+	be = binary.BigEndian.AppendUint64(be, e.Number)
+	return append(be, data...)
+}
+
+// handleCompressionCommand processes the CmdCompression command, the compression codec of the entries streamed to
+// the client connection (the streaming and the subscriptions)
+func (s *StreamServer) handleCompressionCommand(cli *client) error {
+	// Read the compression codec
+	value, err := readFullUint32(cli)
+	if err != nil {
+		return err
+	}
+	compression := Compression(value)
+
+	// Log
+	log.Debugf("Client %s command Compression %s", cli.clientID, compression)
+
+	if cli.status != csStopped || s.hasSubscriptions(cli) {
+		log.Error("Compression command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrCompressionCommandNotAllowed
+	}
+	if _, ok := StrCompression[compression]; !ok {
+		log.Errorf("Client %s requested an invalid compression %d", cli.clientID, value)
+		return s.sendResultEntry(uint32(CmdErrInvalidCommand), "invalid compression", cli)
+	}
+	cli.compression.Store(value)
+
+	// Send a command result entry OK
+	return s.sendResultEntry(0, "OK", cli)
+}
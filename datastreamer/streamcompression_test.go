@@ -0,0 +1,85 @@
+package datastreamer_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCompression(t *testing.T) {
+	server, port := newTestServer(t, "compression.bin")
+	require.NoError(t, server.Start())
+
+	// Large compressible entries alternated with small entries
+	large := bytes.Repeat([]byte("zkevm-data-streamer"), 200)
+	small := testEntries[1].Encode()
+	commit := func() {
+		require.NoError(t, server.StartAtomicOp())
+		for i := 0; i < 3; i++ {
+			_, err := server.AddStreamEntry(entryType1, large)
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType2, small)
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+	commit()
+
+	newClient := func(compression datastreamer.Compression) (*datastreamer.StreamClient, chan []byte) {
+		processed := make(chan []byte, 100)
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+			datastreamer.WithCompression(compression))
+		require.NoError(t, err)
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+			_ *datastreamer.StreamServer) error {
+			processed <- e.Data
+			return nil
+		})
+		require.NoError(t, client.Start())
+		require.NoError(t, client.ExecCommandStart(0))
+		return client, processed
+	}
+	requireProcessed := func(processed chan []byte) {
+		for i := 0; i < 6; i++ {
+			select {
+			case data := <-processed:
+				if i%2 == 0 {
+					require.Equal(t, large, data)
+				} else {
+					require.Equal(t, small, data)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for streaming entries")
+			}
+		}
+	}
+
+	// Case: Snappy compression requested -> Large entries received compressed and decompressed, from file and live
+	client, processed := newClient(datastreamer.CompressionSnappy)
+	defer func() { _ = client.Close() }()
+	requireProcessed(processed)
+	commit()
+	requireProcessed(processed)
+	stats := client.GetStats()
+	require.Equal(t, uint64(12), stats.EntriesReceived)
+	require.Equal(t, uint64(6), stats.CompressedEntries)
+	require.Less(t, stats.CompressedBytes, uint64(len(large)))
+
+	// Case: No compression requested -> All the entries received uncompressed
+	plain, processedPlain := newClient(datastreamer.CompressionNone)
+	defer func() { _ = plain.Close() }()
+	requireProcessed(processedPlain)
+	requireProcessed(processedPlain)
+	require.Zero(t, plain.GetStats().CompressedEntries)
+
+	// Case: Parse the compression names -> Known codecs parsed, unknown rejected
+	compression, err := datastreamer.ParseCompression("Snappy")
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.CompressionSnappy, compression)
+	_, err = datastreamer.ParseCompression("zstd")
+	require.ErrorIs(t, err, datastreamer.ErrInvalidCompression)
+}
@@ -0,0 +1,96 @@
+package datastreamer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+const payloadVersion = 1 // Format version of the encrypted payloads
+
+// NewEncryptMiddleware creates a send middleware encrypting the data of the entries (AES-GCM), except the bookmarks,
+// so the relays and the clients without the key can distribute the stream but not read its contents. The entry
+// number and type are authenticated, so a relay can't reorder or replace the entries
+func NewEncryptMiddleware(key []byte) (EntryMiddleware, error) {
+	aead, err := newPayloadCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next EntryHandler) EntryHandler {
+		return func(e *FileEntry) error {
+			if e.Type == EtBookmark {
+				return next(e)
+			}
+
+			// Payload: version | nonce | ciphertext
+			payload := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(e.Data)+aead.Overhead())
+			payload[0] = payloadVersion
+			_, err := rand.Read(payload[1:])
+			if err != nil {
+				return err
+			}
+			e.Data = aead.Seal(payload, payload[1:], e.Data, payloadAdditionalData(e))
+			return next(e)
+		}
+	}, nil
+}
+
+// NewDecryptMiddleware creates a receive middleware decrypting the data of the entries encrypted by the server
+func NewDecryptMiddleware(key []byte) (EntryMiddleware, error) {
+	aead, err := newPayloadCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next EntryHandler) EntryHandler {
+		return func(e *FileEntry) error {
+			if e.Type == EtBookmark {
+				return next(e)
+			}
+
+			if len(e.Data) < 1+aead.NonceSize()+aead.Overhead() || e.Data[0] != payloadVersion {
+				return ErrDecryptingPayload
+			}
+			nonce := e.Data[1 : 1+aead.NonceSize()]
+			data, err := aead.Open(nil, nonce, e.Data[1+aead.NonceSize():], payloadAdditionalData(e))
+			if err != nil {
+				return ErrDecryptingPayload
+			}
+			e.Data = data
+			return next(e)
+		}
+	}, nil
+}
+
+// LoadPayloadKey reads a payload encryption key (hex encoded) from a file
+func LoadPayloadKey(fileName string) ([]byte, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(content)), "0x"))
+	if err != nil {
+		return nil, ErrInvalidPayloadKey
+	}
+	return key, nil
+}
+
+// newPayloadCipher creates the AES-GCM cipher for a payload key (16, 24 or 32 bytes)
+func newPayloadCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidPayloadKey
+	}
+	return cipher.NewGCM(block)
+}
+
+// payloadAdditionalData returns the entry fields authenticated with the encrypted data
+func payloadAdditionalData(e *FileEntry) []byte {
+	ad := binary.BigEndian.AppendUint32(nil, uint32(e.Type))
+	return binary.BigEndian.AppendUint64(ad, e.Number)
+}
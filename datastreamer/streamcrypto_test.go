@@ -0,0 +1,67 @@
+package datastreamer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadEncryption(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encrypt, err := NewEncryptMiddleware(key)
+	require.NoError(t, err)
+	decrypt, err := NewDecryptMiddleware(key)
+	require.NoError(t, err)
+	send := entryChain{encrypt}
+	receive := entryChain{decrypt}
+
+	// Case: Encrypted and decrypted -> OK
+	data := []byte("confidential entry data")
+	entry := FileEntry{packetType: PtData, Type: 1, Number: 7, Data: data}
+	_, err = send.apply(&entry)
+	require.NoError(t, err)
+	assert.NotContains(t, string(entry.Data), string(data))
+	assert.Equal(t, FixedSizeFileEntry+uint32(len(entry.Data)), entry.Length)
+	encrypted := entry
+	_, err = receive.apply(&entry)
+	require.NoError(t, err)
+	assert.Equal(t, data, entry.Data)
+
+	// Case: Bookmark -> Not encrypted
+	bookmark := FileEntry{packetType: PtData, Type: EtBookmark, Number: 8, Data: []byte{0, 1}}
+	_, err = send.apply(&bookmark)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1}, bookmark.Data)
+
+	// Case: Entry number replaced -> FAIL
+	replaced := encrypted
+	replaced.Number = 8
+	_, err = receive.apply(&replaced)
+	assert.ErrorIs(t, err, ErrDecryptingPayload)
+
+	// Case: Different key -> FAIL
+	otherDecrypt, err := NewDecryptMiddleware([]byte("fedcba9876543210fedcba9876543210"))
+	require.NoError(t, err)
+	other := encrypted
+	_, err = entryChain{otherDecrypt}.apply(&other)
+	assert.ErrorIs(t, err, ErrDecryptingPayload)
+
+	// Case: Invalid key size -> FAIL
+	_, err = NewEncryptMiddleware([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidPayloadKey)
+}
+
+func TestLoadPayloadKey(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "payload.key")
+	require.NoError(t, os.WriteFile(fileName, []byte("0x000102030405060708090a0b0c0d0e0f\n"), 0600))
+	key, err := LoadPayloadKey(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, key)
+
+	require.NoError(t, os.WriteFile(fileName, []byte("not hex"), 0600))
+	_, err = LoadPayloadKey(fileName)
+	assert.ErrorIs(t, err, ErrInvalidPayloadKey)
+}
@@ -0,0 +1,117 @@
+package datastreamer
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const maxDeadLetterLine = 4 * PageDataSize // Maximum line of a dead-letter file (entry of up to a data page in base64)
+
+// DeadLetterFunc type of the sink of the entries failed to process after the retries of the dead-letter policy
+type DeadLetterFunc func(e *FileEntry, err error) error
+
+// DeadLetter type for an entry quarantined to a dead-letter file, with the error processing it
+type DeadLetter struct {
+	Time  time.Time `json:"time"` // Time the entry was quarantined
+	Entry uint64    `json:"entry"`
+	Type  EntryType `json:"type"`
+	Data  []byte    `json:"data"`
+	Error string    `json:"error"`
+}
+
+// SetDeadLetter sets the client to retry processing a failed entry up to the retries, after a backoff doubled on
+// each retry up to 1 minute (1 second if 0), and then to pass it with the error to the dead-letter sink and skip it,
+// so the streaming keeps flowing meanwhile the failed entries are quarantined for later analysis. An error of the
+// sink stops the streaming as the ProcessErrStop policy. Sets the ProcessErrDeadLetter policy, for the streaming and
+// the subscriptions (call before Start)
+func (c *StreamClient) SetDeadLetter(retries int, backoff time.Duration, sink DeadLetterFunc) {
+	c.SetProcessErrorPolicy(ProcessErrDeadLetter, backoff)
+	c.policy.retries = max(retries, 0)
+	c.policy.deadLetter = sink
+}
+
+// NewDeadLetterFile returns a dead-letter sink appending the entries to a file, a DeadLetter per line in JSON format
+func NewDeadLetterFile(fileName string) DeadLetterFunc {
+	return func(e *FileEntry, err error) error {
+		return appendDeadLetter(fileName, newDeadLetter(e, err))
+	}
+}
+
+// ReadDeadLetters reads the entries quarantined to a dead-letter file
+func ReadDeadLetters(fileName string) ([]DeadLetter, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	letters := []DeadLetter{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxDeadLetterLine)
+	for scanner.Scan() {
+		var letter DeadLetter
+		err = json.Unmarshal(scanner.Bytes(), &letter)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, scanner.Err()
+}
+
+// newDeadLetter returns the dead-letter of an entry failed to process
+func newDeadLetter(e *FileEntry, err error) DeadLetter {
+	letter := DeadLetter{
+		Time:  time.Now(),
+		Entry: e.Number,
+		Type:  e.Type,
+		Data:  e.Data,
+	}
+	if err != nil {
+		letter.Error = err.Error()
+	}
+	return letter
+}
+
+// appendDeadLetter appends a dead-letter to a file, synced before returning
+func appendDeadLetter(fileName string, letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, fileMode)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// quarantine passes an entry failed after the retries to the dead-letter sink
+func (c *StreamClient) quarantine(e *FileEntry, err error) error {
+	log.Warnf("%s Processing entry %d: %v. Entry quarantined to the dead-letter sink after %d retries", c.ID, e.Number,
+		err, c.policy.retries)
+	c.stats.addError(StatErrDeadLetter, nil)
+	c.stats.entryDropped(StatDropDeadLetter)
+	if c.policy.deadLetter == nil {
+		return nil
+	}
+
+	errSink := c.policy.deadLetter(e, err)
+	if errSink != nil {
+		log.Errorf("%s Error writing entry %d to the dead-letter sink: %v", c.ID, e.Number, errSink)
+		return errSink
+	}
+	return nil
+}
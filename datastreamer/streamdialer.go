@@ -0,0 +1,223 @@
+package datastreamer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// SOCKS5 protocol constants (RFC 1928 and RFC 1929)
+const (
+	socksVersion      = 5
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksAuthRejected = 0xff
+	socksCmdConnect   = 1
+	socksAddrIPv4     = 1
+	socksAddrDomain   = 3
+	socksAddrIPv6     = 4
+)
+
+// DialContextFunc type of the function opening the connections to the server, e.g. (&net.Dialer{}).DialContext
+type DialContextFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+// bufferedConn type for a connection with bytes read ahead in a buffer (after a proxy response)
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads from the buffer the bytes read ahead, then from the connection
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+// SetDialer sets the function opening the connections to the server (the streaming connection and the command
+// channel), e.g. to go through a proxy (see NewProxyDialer), bind to a local address or interface, or resolve the
+// server names with a custom resolver. TLS (if set) runs over the connections opened. The TCP keepalive period of the
+// heartbeat applies only to the default dialer. A nil function restores the default dialer (call before Start)
+func (c *StreamClient) SetDialer(dial DialContextFunc) {
+	c.dialContext = dial
+}
+
+// NewProxyDialer returns a dialer opening the connections through a proxy server: a SOCKS5 proxy
+// (`socks5://[user:password@]host:port`, the server names resolved by the proxy) or an HTTP proxy with the CONNECT
+// method (`http://[user:password@]host:port`). The connections to the proxy are opened by the forward dialer (the
+// default dialer if nil)
+func NewProxyDialer(proxyURL string, forward DialContextFunc) (DialContextFunc, error) {
+	proxy, err := url.Parse(proxyURL)
+	if err != nil || proxy.Host == "" {
+		log.Errorf("Invalid proxy URL %s: %v", proxyURL, err)
+		return nil, ErrInvalidProxy
+	}
+	if proxy.Scheme != "socks5" && proxy.Scheme != "http" {
+		log.Errorf("Invalid proxy URL %s: unsupported scheme %s", proxyURL, proxy.Scheme)
+		return nil, ErrInvalidProxy
+	}
+	if forward == nil {
+		forward = (&net.Dialer{}).DialContext
+	}
+
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		conn, err := forward(ctx, network, proxy.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		// The handshake with the proxy is canceled with the context
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+		tunnel := conn
+		if proxy.Scheme == "socks5" {
+			err = socksConnect(conn, proxy.User, address)
+		} else {
+			tunnel, err = httpConnect(conn, proxy, address)
+		}
+		if !stop() && err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			conn.Close()
+			log.Errorf("Error connecting to %s through proxy %s: %v", address, proxy.Host, err)
+			return nil, err
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return tunnel, nil
+	}, nil
+}
+
+// socksConnect requests a SOCKS5 proxy to connect to an address, authenticating with the user (if set)
+func socksConnect(conn net.Conn, user *url.Userinfo, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	// Negotiate the authentication method
+	method := byte(socksAuthNone)
+	if user != nil {
+		method = socksAuthPassword
+	}
+	_, err = conn.Write([]byte{socksVersion, 1, method})
+	if err != nil {
+		return err
+	}
+	reply := make([]byte, 2) //nolint:mnd
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[0] != socksVersion || reply[1] == socksAuthRejected || reply[1] != method {
+		return ErrProxyHandshake
+	}
+	if method == socksAuthPassword {
+		password, _ := user.Password()
+		request := append([]byte{1, byte(len(user.Username()))}, user.Username()...)
+		request = append(append(request, byte(len(password))), password...)
+		_, err = conn.Write(request)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(conn, reply)
+		if err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return ErrProxyHandshake
+		}
+	}
+
+	// Request the connection to the address, the names resolved by the proxy
+	request := []byte{socksVersion, socksCmdConnect, 0}
+	ip := net.ParseIP(host)
+	switch {
+	case ip.To4() != nil:
+		request = append(append(request, socksAddrIPv4), ip.To4()...)
+	case ip != nil:
+		request = append(append(request, socksAddrIPv6), ip.To16()...)
+	default:
+		request = append(append(request, socksAddrDomain, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	_, err = conn.Write(request)
+	if err != nil {
+		return err
+	}
+
+	// Read the reply, skipping the bound address
+	header := make([]byte, 4) //nolint:mnd
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return err
+	}
+	if header[0] != socksVersion || header[1] != 0 {
+		return ErrProxyHandshake
+	}
+	var length int
+	switch header[3] {
+	case socksAddrIPv4:
+		length = net.IPv4len
+	case socksAddrIPv6:
+		length = net.IPv6len
+	case socksAddrDomain:
+		_, err = io.ReadFull(conn, header[:1])
+		if err != nil {
+			return err
+		}
+		length = int(header[0])
+	default:
+		return ErrProxyHandshake
+	}
+	_, err = io.ReadFull(conn, make([]byte, length+2)) //nolint:mnd
+	return err
+}
+
+// httpConnect requests an HTTP proxy to connect to an address with the CONNECT method, authenticating with the user
+// of the proxy URL (if set). Returns the connection tunneled
+func httpConnect(conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	err := request.Write(conn)
+	if err != nil {
+		return conn, err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return conn, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		log.Errorf("Proxy CONNECT to %s: %s", address, response.Status)
+		return conn, ErrProxyHandshake
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
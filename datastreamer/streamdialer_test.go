@@ -0,0 +1,70 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDialer(t *testing.T) {
+	server, port := newTestServer(t, "dialer.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 5)
+
+	stream := func(dial datastreamer.DialContextFunc) {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+			datastreamer.WithDialer(dial))
+		require.NoError(t, err)
+		defer func() { _ = client.Close() }()
+		processed := make(chan uint64, 5)
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+			_ *datastreamer.StreamServer) error {
+			processed <- e.Number
+			return nil
+		})
+		require.NoError(t, client.Start())
+		header, err := client.ExecCommandGetHeader()
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), header.TotalEntries)
+		require.NoError(t, client.ExecCommandStart(0))
+		for i := uint64(0); i < 5; i++ {
+			require.Equal(t, i, <-processed)
+		}
+	}
+
+	// Case: Custom dialer -> Streaming connection and command channel opened by the dialer
+	var dials atomic.Int32
+	stream(func(ctx context.Context, network string, address string) (net.Conn, error) {
+		dials.Add(1)
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	})
+	require.Equal(t, int32(2), dials.Load())
+
+	// Case: SOCKS5 and HTTP proxies with credentials -> OK through the proxies
+	for _, scheme := range []string{"socks5", "http"} {
+		proxyURL := scheme + "://user:secret@" + newTestTunnelProxy(t, scheme, "user", "secret")
+		dial, err := datastreamer.NewProxyDialer(proxyURL, nil)
+		require.NoError(t, err)
+		stream(dial)
+	}
+
+	// Case: Proxies rejecting the credentials -> Handshake error
+	for _, scheme := range []string{"socks5", "http"} {
+		proxyURL := scheme + "://user:wrong@" + newTestTunnelProxy(t, scheme, "user", "secret")
+		dial, err := datastreamer.NewProxyDialer(proxyURL, nil)
+		require.NoError(t, err)
+		_, err = dial(context.Background(), "tcp", fmt.Sprintf("localhost:%d", port))
+		require.ErrorIs(t, err, datastreamer.ErrProxyHandshake, scheme)
+	}
+
+	// Case: Invalid proxy URLs -> FAIL
+	for _, proxyURL := range []string{"localhost:1080", "ftp://localhost:21", "socks5://"} {
+		_, err := datastreamer.NewProxyDialer(proxyURL, nil)
+		require.ErrorIs(t, err, datastreamer.ErrInvalidProxy, proxyURL)
+	}
+}
@@ -0,0 +1,183 @@
+package datastreamer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const directAlignment = 4096 // Alignment of the offsets, lengths and buffers of the direct I/O writes
+
+// directWriter type to write the stream file with direct I/O (O_DIRECT), through an aligned buffer of the blocks
+// being written
+type directWriter struct {
+	file     *os.File // Stream file opened for direct I/O
+	buffer   []byte   // Aligned buffer of the blocks being written
+	blockPos int64    // File offset of the buffer (aligned)
+	length   int      // Data bytes in the buffer
+	valid    bool     // Flag the buffer holds the data of the file from its offset
+}
+
+// SetDirectIO sets the server to write the data entries to the stream file with direct I/O (O_DIRECT) through
+// aligned buffers, bypassing the page cache so it stays free for the databases of the node. The last partial block is
+// rewritten on each write, so it's better combined with the write coalescing. Falls back to the buffered writes if
+// the platform or the file system doesn't support it (call before Start)
+func (s *StreamServer) SetDirectIO(enabled bool) {
+	s.streamFile.setDirectIO(enabled)
+}
+
+// SetDirectIO sets the relay server side to write the stream file with direct I/O (call before Start)
+func (r *StreamRelay) SetDirectIO(enabled bool) {
+	r.server.SetDirectIO(enabled)
+}
+
+// IsDirectIO checks if the server writes the stream file with direct I/O
+func (s *StreamServer) IsDirectIO() bool {
+	return s.streamFile.direct != nil
+}
+
+// setDirectIO opens or closes the stream file for direct I/O writes, falling back to the buffered writes
+func (f *StreamFile) setDirectIO(enabled bool) {
+	if !enabled || f.direct != nil {
+		if !enabled {
+			_ = f.closeDirectIO()
+		}
+		return
+	}
+
+	file, err := openDirectIO(f.fileName)
+	if err != nil {
+		log.Warnf("Direct I/O not available for %s, using buffered writes: %v", f.fileName, err)
+		return
+	}
+	f.direct = &directWriter{file: file}
+	log.Infof("Stream file %s written with direct I/O", f.fileName)
+}
+
+// closeDirectIO closes the stream file opened for direct I/O writes
+func (f *StreamFile) closeDirectIO() error {
+	if f.direct == nil {
+		return nil
+	}
+	err := f.direct.file.Close()
+	f.direct = nil
+	return err
+}
+
+// writeFile writes data at the current position of the stream file, with direct I/O if enabled. On a stale file
+// handle, the file is reopened and the data written again at the same position
+func (f *StreamFile) writeFile(data []byte) error {
+	pos, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	retry := false
+	return f.retryStale("write", func() error {
+		if retry {
+			_, err := f.file.Seek(pos, io.SeekStart)
+			if err != nil {
+				return err
+			}
+		}
+		retry = true
+		err := f.writeFileAt(data, pos)
+		if err != nil {
+			return err
+		}
+		return f.verifyEntriesWrite(data, pos)
+	})
+}
+
+// writeFileAt writes data at the position of the stream file, the current one of the buffered file descriptor
+func (f *StreamFile) writeFileAt(data []byte, pos int64) error {
+	if f.direct == nil {
+		_, err := f.file.Write(data)
+		return err
+	}
+
+	err := f.direct.writeAt(data, pos, f.file)
+	if errors.Is(err, syscall.EINVAL) {
+		log.Warnf("Direct I/O write not supported for %s, using buffered writes: %v", f.fileName, err)
+		_ = f.closeDirectIO()
+		_, err = f.file.Write(data)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep the position of the buffered file descriptor
+	_, err = f.file.Seek(int64(len(data)), io.SeekCurrent)
+	return err
+}
+
+// writeAt writes data at a file position, rewriting the aligned blocks it spans. The data of the first block before
+// the position is read from the buffered file descriptor when not in the buffer
+func (d *directWriter) writeAt(data []byte, pos int64, buffered *os.File) error {
+	if !d.valid || d.blockPos+int64(d.length) != pos {
+		d.blockPos = pos &^ (directAlignment - 1)
+		d.length = int(pos - d.blockPos)
+		d.grow(d.length)
+		if d.length > 0 {
+			_, err := buffered.ReadAt(d.buffer[:d.length], d.blockPos)
+			if err != nil {
+				d.valid = false
+				return err
+			}
+		}
+		d.valid = true
+	}
+
+	d.grow(d.length + len(data))
+	copy(d.buffer[d.length:], data)
+	d.length += len(data)
+
+	// Write the blocks, the last one padded with zeros
+	size := alignUp(d.length)
+	clear(d.buffer[d.length:size])
+	_, err := d.file.WriteAt(d.buffer[:size], d.blockPos)
+	if err != nil {
+		d.valid = false
+		return err
+	}
+
+	// Keep the last partial block for the next write
+	full := d.length &^ (directAlignment - 1)
+	if full > 0 {
+		copy(d.buffer, d.buffer[full:d.length])
+		d.blockPos += int64(full)
+		d.length -= full
+	}
+	return nil
+}
+
+// grow ensures the aligned buffer holds a number of bytes rounded up to the alignment
+func (d *directWriter) grow(size int) {
+	size = alignUp(max(size, 1))
+	if len(d.buffer) >= size {
+		return
+	}
+	buffer := alignedBuffer(max(size, 2*len(d.buffer))) //nolint:mnd
+	copy(buffer, d.buffer[:d.length])
+	d.buffer = buffer
+}
+
+// alignUp rounds up a size to the direct I/O alignment
+func alignUp(size int) int {
+	return (size + directAlignment - 1) &^ (directAlignment - 1)
+}
+
+// alignedBuffer allocates a buffer with its address aligned to the direct I/O alignment
+func alignedBuffer(size int) []byte {
+	b := make([]byte, size+directAlignment)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&b[0])) & (directAlignment - 1)); rem != 0 {
+		offset = directAlignment - rem
+	}
+	return b[offset : offset+size : offset+size]
+}
@@ -0,0 +1,13 @@
+//go:build linux
+
+package datastreamer
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDirectIO opens the stream file for the direct I/O writes
+func openDirectIO(fileName string) (*os.File, error) {
+	return os.OpenFile(fileName, os.O_WRONLY|syscall.O_DIRECT, fileMode)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package datastreamer
+
+import (
+	"os"
+)
+
+// openDirectIO opens the stream file for the direct I/O writes, not supported in this platform
+func openDirectIO(string) (*os.File, error) {
+	return nil, ErrDirectIONotSupported
+}
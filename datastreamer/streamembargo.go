@@ -0,0 +1,153 @@
+package datastreamer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	embargoCheckInterval = time.Second // Maximum interval to check the entries pending to be released
+	embargoRetryInterval = time.Second // Interval to retry relaying an entry after an error
+)
+
+// embargoEntry type for an entry received from the master server pending to be released by the relay
+type embargoEntry struct {
+	entry    FileEntry
+	received time.Time
+}
+
+// relayEmbargo type to hold the entries received by the relay until they are released
+type relayEmbargo struct {
+	delay  time.Duration // Time to hold each entry since it's received
+	manual bool          // Flag to hold the entries until they are released with a release command
+
+	mutex     sync.Mutex
+	pending   []embargoEntry
+	releaseTo uint64        // Entries with lower number are released in manual mode
+	signal    chan struct{} // Signal a new entry received or a release command
+}
+
+// SetReleaseDelay sets the time the relay holds the entries received from the master server before storing and
+// forwarding them to its clients, so its feed lags the master feed (call before Start)
+func (r *StreamRelay) SetReleaseDelay(delay time.Duration) {
+	r.embargo.delay = delay
+}
+
+// SetManualRelease sets the relay to hold the entries received from the master server until they are released with
+// Release or ReleaseReceived (call before Start)
+func (r *StreamRelay) SetManualRelease(enabled bool) {
+	r.embargo.manual = enabled
+}
+
+// Release releases the entries held by the relay with number lower than toEntry (manual release mode). They are
+// forwarded to the relay clients once the release delay (if set) has also elapsed
+func (r *StreamRelay) Release(toEntry uint64) {
+	r.embargo.mutex.Lock()
+	if toEntry > r.embargo.releaseTo {
+		r.embargo.releaseTo = toEntry
+	}
+	r.embargo.mutex.Unlock()
+	r.embargo.notify()
+}
+
+// ReleaseReceived releases all the entries received by the relay up to now (manual release mode)
+func (r *StreamRelay) ReleaseReceived() {
+	r.embargo.mutex.Lock()
+	toEntry := r.embargo.releaseTo
+	if len(r.embargo.pending) > 0 {
+		toEntry = r.embargo.pending[len(r.embargo.pending)-1].entry.Number + 1
+	}
+	r.embargo.mutex.Unlock()
+	r.Release(toEntry)
+}
+
+// PendingRelease returns the number of entries held by the relay pending to be released
+func (r *StreamRelay) PendingRelease() int {
+	r.embargo.mutex.Lock()
+	defer r.embargo.mutex.Unlock()
+
+	return len(r.embargo.pending)
+}
+
+// enabled checks if the relay holds the entries before releasing them
+func (e *relayEmbargo) enabled() bool {
+	return e.delay > 0 || e.manual
+}
+
+// hold adds an entry received from the master server to the pending entries
+func (e *relayEmbargo) hold(entry *FileEntry) {
+	held := *entry
+	held.Data = append([]byte{}, entry.Data...)
+
+	e.mutex.Lock()
+	e.pending = append(e.pending, embargoEntry{entry: held, received: time.Now()})
+	e.mutex.Unlock()
+	e.notify()
+}
+
+// notify signals the release goroutine without blocking
+func (e *relayEmbargo) notify() {
+	select {
+	case e.signal <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the first pending entry if it can be released at a time, otherwise the time to wait to check again
+func (e *relayEmbargo) next(now time.Time) (FileEntry, bool, time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(e.pending) == 0 {
+		return FileEntry{}, false, embargoCheckInterval
+	}
+	first := e.pending[0]
+	if e.manual && first.entry.Number >= e.releaseTo {
+		return FileEntry{}, false, embargoCheckInterval
+	}
+	wait := first.received.Add(e.delay).Sub(now)
+	if wait > 0 {
+		return FileEntry{}, false, wait
+	}
+	return first.entry, true, 0
+}
+
+// pop removes the first pending entry once released
+func (e *relayEmbargo) pop() {
+	e.mutex.Lock()
+	e.pending[0] = embargoEntry{}
+	e.pending = e.pending[1:]
+	e.mutex.Unlock()
+}
+
+// holdEntry holds the entry received as client until it's released to the clients connected to the server
+func (r *StreamRelay) holdEntry(e *FileEntry, c *StreamClient, s *StreamServer) error {
+	r.embargo.hold(e)
+	return nil
+}
+
+// releaseEntries relays the pending entries to the clients connected to the server as they are released
+func (r *StreamRelay) releaseEntries() {
+	for {
+		entry, ok, wait := r.embargo.next(time.Now())
+		if !ok {
+			timer := time.NewTimer(wait)
+			select {
+			case <-r.embargo.signal:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		err := relayEntry(&entry, r.client, r.server)
+		if err != nil {
+			log.Errorf("Error releasing entry %d, retrying: %v", entry.Number, err)
+			time.Sleep(embargoRetryInterval)
+			continue
+		}
+		r.embargo.pop()
+	}
+}
@@ -0,0 +1,54 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayRelease(t *testing.T) {
+	master, masterPort := newTestServer(t, "master.bin")
+	require.NoError(t, master.Start())
+	addTestEntries(t, master, 3)
+
+	relayPort := freePort(t)
+	relay, err := datastreamer.NewRelay(fmt.Sprintf("127.0.0.1:%d", masterPort), relayPort, 1, 137, streamType,
+		t.TempDir()+"/relay.bin", config.WriteTimeout, 0, 5*time.Second, nil)
+	require.NoError(t, err)
+	relay.SetManualRelease(true)
+	relay.SetReleaseDelay(100 * time.Millisecond)
+	require.NoError(t, relay.Start())
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("127.0.0.1:%d", relayPort), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	relayEntries := func() uint64 {
+		header, err := client.ExecCommandGetHeader()
+		require.NoError(t, err)
+		return header.TotalEntries
+	}
+
+	// Case: Entries received but not released -> Held by the relay
+	require.Eventually(t, func() bool { return relay.PendingRelease() == 3 }, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(0), relayEntries())
+
+	// Case: Release up to entry 2 -> Forwarded after the release delay
+	relay.Release(2)
+	require.Eventually(t, func() bool { return relayEntries() == 2 }, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, relay.PendingRelease())
+
+	// Case: Release the received entries -> New entries still held
+	addTestEntries(t, master, 2)
+	require.Eventually(t, func() bool { return relay.PendingRelease() == 3 }, 2*time.Second, 10*time.Millisecond)
+	relay.ReleaseReceived()
+	require.Eventually(t, func() bool { return relayEntries() == 5 }, 2*time.Second, 10*time.Millisecond)
+	addTestEntries(t, master, 1)
+	require.Eventually(t, func() bool { return relay.PendingRelease() == 1 }, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(5), relayEntries())
+
+	require.NoError(t, relay.Shutdown(time.Second))
+	require.NoError(t, master.Shutdown(time.Second))
+}
@@ -0,0 +1,196 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	maxEntryRangeCount = 10000            // Maximum number of entries of an entry range response
+	maxEntryRangeSize  = 16 * 1024 * 1024 // Maximum size of the entries of an entry range response (at least one)
+)
+
+// GetEntryRange returns up to count consecutive entries from an entry number (fewer at the end of the stream).
+// Returns ErrInvalidEntryNumber if the entry number is before the base entry or after the total entries
+func (s *StreamServer) GetEntryRange(fromEntry uint64, count uint64) ([]FileEntry, error) {
+	header := s.streamFile.getHeaderEntry()
+	if fromEntry < header.BaseEntry || fromEntry > header.TotalEntries {
+		return nil, ErrInvalidEntryNumber
+	}
+	count = min(count, header.TotalEntries-fromEntry)
+	if count == 0 {
+		return []FileEntry{}, nil
+	}
+
+	// Initialize file stream iterator
+	iterator, err := s.streamFile.iteratorFrom(fromEntry, true)
+	if err != nil {
+		return nil, err
+	}
+	defer s.streamFile.iteratorEnd(iterator)
+
+	entries := make([]FileEntry, 0, count)
+	for uint64(len(entries)) < count {
+		end, err := s.streamFile.iteratorNext(iterator)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			break
+		}
+
+		// Resolve the payload of an entry stored content-addressed
+		entry := iterator.Entry
+		err = s.content.resolve(&entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ExecCommandGetEntryRange executes client TCP command to get up to count consecutive entries from an entry number in
+// one round trip, e.g. for the catch-up tools. The server limits the entries of a response (10000 entries, 16MB), so
+// it returns the entries and the entry number after the last one read, to get the next range from it (fromEntry at
+// the end of the stream). The entries dropped by the middlewares are left out
+func (c *StreamClient) ExecCommandGetEntryRange(fromEntry uint64, count uint32) ([]FileEntry, uint64, error) {
+	return c.ExecCommandGetEntryRangeContext(context.Background(), fromEntry, count)
+}
+
+// ExecCommandGetEntryRangeContext executes client TCP command to get up to count consecutive entries from an entry
+// number, canceled with the context
+func (c *StreamClient) ExecCommandGetEntryRangeContext(ctx context.Context, fromEntry uint64,
+	count uint32) ([]FileEntry, uint64, error) {
+	countParam := binary.BigEndian.AppendUint32(nil, count)
+	_, entry, err := c.execCommand(ctx, CmdEntryRange, false, fromEntry, countParam)
+	if err != nil {
+		return nil, fromEntry, err
+	}
+	return c.decodeEntryRange(entry.Data)
+}
+
+// decodeEntryRange decodes the data of an entry range response, the next entry number and the entries, passed
+// through the receive middlewares
+func (c *StreamClient) decodeEntryRange(data []byte) ([]FileEntry, uint64, error) {
+	ranged, nextEntry, err := decodeRangeEntries(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := []FileEntry{}
+	for _, entry := range ranged {
+		passed, err := c.receiveChain.apply(&entry)
+		if err != nil {
+			return nil, 0, err
+		}
+		if passed {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nextEntry, nil
+}
+
+// decodeRangeEntries decodes the data of an entry range response, the entries as sent and the next entry number
+func decodeRangeEntries(data []byte) ([]FileEntry, uint64, error) {
+	if len(data) < 8 { //nolint:mnd
+		return nil, 0, ErrDecodingEntryRange
+	}
+	nextEntry := binary.BigEndian.Uint64(data[0:8])
+
+	entries := []FileEntry{}
+	for offset := 8; offset < len(data); {
+		if len(data)-offset < FixedSizeFileEntry {
+			return nil, 0, ErrDecodingEntryRange
+		}
+		length := int(binary.BigEndian.Uint32(data[offset+1 : offset+5]))
+		if length < FixedSizeFileEntry || length > len(data)-offset {
+			return nil, 0, ErrDecodingEntryRange
+		}
+		entry, err := DecodeBinaryToFileEntry(data[offset : offset+length])
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += length
+		entries = append(entries, entry)
+	}
+	return entries, nextEntry, nil
+}
+
+// handleEntryRangeCommand processes the CmdEntryRange command
+func (s *StreamServer) handleEntryRangeCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("EntryRange command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrEntryRangeCommandNotAllowed
+	}
+
+	return s.processCmdEntryRange(cli)
+}
+
+// processCmdEntryRange processes the TCP EntryRange command from the clients
+func (s *StreamServer) processCmdEntryRange(client *client) error {
+	// Read from entry number and number of entries parameters
+	fromEntry, err := readFullUint64(client)
+	if err != nil {
+		return err
+	}
+	count, err := readFullUint32(client)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command EntryRange from %d count %d", client.clientID, fromEntry, count)
+
+	entries, err := s.GetEntryRange(fromEntry, min(uint64(count), maxEntryRangeCount))
+	if err != nil {
+		log.Warnf("Error getting entry range from %d for %s: %v", fromEntry, client.clientID, err)
+		return s.sendResultEntry(uint32(CmdErrBadFromEntry), StrCommandErrors[CmdErrBadFromEntry], client)
+	}
+
+	// Encode the next entry number and the entries passed through the send middlewares, up to the maximum size
+	data := binary.BigEndian.AppendUint64(nil, fromEntry)
+	nextEntry := fromEntry
+	for _, entry := range entries {
+		if nextEntry > fromEntry && len(data)+int(entry.Length) > maxEntryRangeSize {
+			break
+		}
+		nextEntry = entry.Number + 1
+		passed, err := s.sendChain.apply(&entry)
+		if err != nil {
+			log.Errorf("Error in send middleware for entry %d to %s: %v", entry.Number, client.clientID, err)
+			_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+			return err
+		}
+		if passed {
+			data = append(data, encodeFileEntryToBinary(entry)...)
+		}
+	}
+	binary.BigEndian.PutUint64(data[0:8], nextEntry)
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the range of entries as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteBulk(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending entry range to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientEntryRange(t *testing.T) {
+	server, port := newTestServer(t, "range.bin")
+	require.NoError(t, server.Start())
+
+	require.NoError(t, server.StartAtomicOp())
+	for i := 0; i < 25; i++ {
+		_, err := server.AddStreamEntry(entryType1, testEntries[i%len(testEntries)].Encode())
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.CommitAtomicOp())
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+
+	// Case: Range in the stream -> Same entries as the Entry command
+	entries, next, err := client.ExecCommandGetEntryRange(5, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), next)
+	require.Len(t, entries, 10)
+	for i, entry := range entries {
+		expected, err := client.ExecCommandGetEntry(uint64(5 + i))
+		require.NoError(t, err)
+		require.Equal(t, expected, entry)
+	}
+
+	// Case: Range past the end of the stream -> Entries up to the end, then empty
+	entries, next, err = client.ExecCommandGetEntryRange(20, 100)
+	require.NoError(t, err)
+	require.Equal(t, uint64(25), next)
+	require.Len(t, entries, 5)
+	entries, next, err = client.ExecCommandGetEntryRange(next, 100)
+	require.NoError(t, err)
+	require.Equal(t, uint64(25), next)
+	require.Empty(t, entries)
+
+	// Case: Entry number after the total entries -> FAIL
+	_, _, err = client.ExecCommandGetEntryRange(26, 1)
+	require.ErrorIs(t, err, datastreamer.ErrInvalidEntryNumber)
+}
@@ -0,0 +1,140 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const maxEntryTypes = 256 // Maximum number of entry types of the EntryTypes command
+
+// entryTypeSet type for a set of entry types, without the payload schema version
+type entryTypeSet map[EntryType]struct{}
+
+// newEntryTypeSet returns the set of the entry types (nil for all the entry types)
+func newEntryTypeSet(entryTypes []EntryType) entryTypeSet {
+	if len(entryTypes) == 0 {
+		return nil
+	}
+	set := make(entryTypeSet, len(entryTypes))
+	for _, entryType := range entryTypes {
+		set[entryType.Base()] = struct{}{}
+	}
+	return set
+}
+
+// contains checks if the entry type of an entry is in the set (a nil set has all the entry types)
+func (t entryTypeSet) contains(e *FileEntry) bool {
+	if t == nil {
+		return true
+	}
+	_, ok := t[e.Type.Base()]
+	return ok
+}
+
+// SetEntryTypes sets the entry types processed by the streaming and the subscriptions, the entries of other types
+// (any payload schema version) are skipped before the receive middlewares and the process entry function. With
+// negotiate, they are also sent to the server on each connection (EntryTypes command), so the entries of other types
+// are never sent, e.g. for the relay clients consuming only the L2 blocks. The servers not supporting it (or more
+// than 256 entry types) keep sending all the entries, skipped by the client. No entry types for all of them (call
+// before Start)
+func (c *StreamClient) SetEntryTypes(entryTypes []EntryType, negotiate bool) {
+	c.entryTypes = newEntryTypeSet(entryTypes)
+	c.negotiateTypes = negotiate && c.entryTypes != nil
+}
+
+// negotiateEntryTypes sends to the server the entry types to stream on a new connection (if negotiated and supported
+// by the server protocol version, detected on the command channel)
+func (c *StreamClient) negotiateEntryTypes(ctx context.Context, conn net.Conn) error {
+	if !c.negotiateTypes {
+		return nil
+	}
+	if len(c.entryTypes) > maxEntryTypes {
+		log.Warnf("%s More than %d entry types, filtered by the client only", c.ID, maxEntryTypes)
+		return nil
+	}
+	if c.protocol.Load() == 0 {
+		_, _, err := c.getCommandConn(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if c.checkProtocol(CmdEntryTypes, false) != nil {
+		log.Warnf("%s Entry types filtered by the client only", c.ID)
+		return nil
+	}
+
+	params := make([]byte, 0, 4*len(c.entryTypes)) //nolint:mnd
+	for entryType := range c.entryTypes {
+		params = binary.BigEndian.AppendUint32(params, uint32(entryType))
+	}
+	c.mutexWrite.Lock()
+	err := c.writeCommand(conn, CmdEntryTypes, 0, 0, params)
+	c.mutexWrite.Unlock()
+	if err != nil {
+		return err
+	}
+	err = c.readPacketType(conn, PtResult, 0)
+	if err != nil {
+		return err
+	}
+	r, err := c.readResultEntry(conn)
+	if err != nil {
+		return err
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		log.Errorf("%s Entry types rejected by server %s: %d[%s]", c.ID, c.serverAddr(), r.errorNum, r.errorStr)
+		return ErrResultCommandError
+	}
+	return nil
+}
+
+// wantsEntry checks if an entry streamed is of an entry type negotiated by the client
+func (c *client) wantsEntry(e *FileEntry) bool {
+	set := c.entryTypes.Load()
+	return set == nil || set.contains(e)
+}
+
+// handleEntryTypesCommand processes the CmdEntryTypes command, the entry types to stream to the client connection
+// (the streaming and the subscriptions)
+func (s *StreamServer) handleEntryTypesCommand(cli *client) error {
+	// Read the number of entry types and the entry types
+	count, err := readFullUint32(cli)
+	if err != nil {
+		return err
+	}
+	if count > maxEntryTypes {
+		log.Errorf("Client %s exceeded [%d] maximum allowed number [%d] of entry types: client killed",
+			cli.clientID, count, maxEntryTypes)
+		s.killClient(cli.clientID)
+		return ErrInvalidEntryTypes
+	}
+	entryTypes := make([]EntryType, 0, count)
+	for i := uint32(0); i < count; i++ {
+		entryType, err := readFullUint32(cli)
+		if err != nil {
+			return err
+		}
+		entryTypes = append(entryTypes, EntryType(entryType))
+	}
+
+	// Log
+	log.Debugf("Client %s command EntryTypes %v", cli.clientID, entryTypes)
+
+	if cli.status != csStopped || s.hasSubscriptions(cli) {
+		log.Error("EntryTypes command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrEntryTypesCommandNotAllowed
+	}
+	set := newEntryTypeSet(entryTypes)
+	if set == nil {
+		cli.entryTypes.Store(nil)
+	} else {
+		cli.entryTypes.Store(&set)
+	}
+
+	// Send a command result entry OK
+	return s.sendResultEntry(0, "OK", cli)
+}
@@ -0,0 +1,82 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientEntryTypes(t *testing.T) {
+	server, port := newTestServer(t, "types.bin")
+	require.NoError(t, server.Start())
+
+	// Entries of type 1 and 2 alternated, ending with type 1
+	commit := func() uint64 {
+		require.NoError(t, server.StartAtomicOp())
+		var last uint64
+		for i := 0; i < 5; i++ {
+			entryNumber, err := server.AddStreamEntry(entryType1, testEntries[1].Encode())
+			require.NoError(t, err)
+			last = entryNumber
+			if i < 4 {
+				_, err = server.AddStreamEntry(entryType2, testEntries[2].Encode())
+				require.NoError(t, err)
+			}
+		}
+		require.NoError(t, server.CommitAtomicOp())
+		return last
+	}
+	lastEntry := commit()
+
+	newClient := func(negotiate bool) (*datastreamer.StreamClient, chan datastreamer.EntryType) {
+		processed := make(chan datastreamer.EntryType, 100)
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+			datastreamer.WithEntryTypes([]datastreamer.EntryType{entryType2}, negotiate))
+		require.NoError(t, err)
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+			_ *datastreamer.StreamServer) error {
+			processed <- e.Type
+			return nil
+		})
+		require.NoError(t, client.Start())
+		require.NoError(t, client.ExecCommandStart(0))
+		return client, processed
+	}
+	requireProcessed := func(processed chan datastreamer.EntryType, count int) {
+		for i := 0; i < count; i++ {
+			select {
+			case entryType := <-processed:
+				require.Equal(t, entryType2, entryType)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for streaming entries")
+			}
+		}
+	}
+
+	// Case: Entry types filtered by the client -> Only the entries of type 2 processed, all of them received
+	client, processed := newClient(false)
+	defer func() { _ = client.Close() }()
+	requireProcessed(processed, 4)
+	require.Eventually(t, func() bool {
+		return client.GetStats().LastEntry == lastEntry
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Case: Entry types negotiated with the server -> Only the entries of type 2 received, from file and live
+	negotiated, processedNegotiated := newClient(true)
+	defer func() { _ = negotiated.Close() }()
+	requireProcessed(processedNegotiated, 4)
+	require.Equal(t, lastEntry-1, negotiated.GetStats().LastEntry)
+
+	lastEntry = commit()
+	requireProcessed(processed, 4)
+	requireProcessed(processedNegotiated, 4)
+	require.Eventually(t, func() bool {
+		return client.GetStats().LastEntry == lastEntry
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, lastEntry-1, negotiated.GetStats().LastEntry)
+	require.Empty(t, processed)
+	require.Empty(t, processedNegotiated)
+}
@@ -0,0 +1,174 @@
+package datastreamer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	ephemeralMemoryDir = "/dev/shm"    // Memory-backed (tmpfs) directory for the ephemeral streams, if available
+	ephemeralPrefix    = "datastream-" // Prefix of the directories of the ephemeral streams (followed by the pid)
+	ephemeralFileName  = "stream.bin"  // Stream file name in the directory of an ephemeral stream
+)
+
+// NewEphemeralServer creates a new data stream server with an ephemeral stream, stored in a new temporary directory
+// (memory-backed if available) deleted on Shutdown or Close. The directories left by processes no longer running are
+// garbage collected
+func NewEphemeralServer(port uint16, version uint8, systemID uint64, streamType StreamType,
+	writeTimeout time.Duration, inactivityTimeout time.Duration, inactivityCheckInterval time.Duration,
+	cfg *log.Config) (*StreamServer, error) {
+	base := ephemeralBaseDir()
+	collectEphemeralDirs(base)
+
+	// Create the directory of the stream
+	dir, err := os.MkdirTemp(base, fmt.Sprintf("%s%d-", ephemeralPrefix, os.Getpid()))
+	if err != nil {
+		log.Errorf("Error creating ephemeral stream directory in %s: %v", base, err)
+		return nil, err
+	}
+
+	s, err := NewServer(port, version, systemID, streamType, filepath.Join(dir, ephemeralFileName), writeTimeout,
+		inactivityTimeout, inactivityCheckInterval, cfg)
+	if err != nil {
+		if s != nil {
+			s.ephemeralDir = dir
+			_ = s.Close()
+		}
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	s.ephemeralDir = dir
+
+	log.Infof("Ephemeral stream created: %s", dir)
+	return s, nil
+}
+
+// NewEphemeralRelay creates a new data stream relay with an ephemeral stream for its server side (see
+// NewEphemeralServer)
+func NewEphemeralRelay(server string, port uint16, version uint8, systemID uint64,
+	streamType StreamType, writeTimeout time.Duration, inactivityTimeout time.Duration,
+	inactivityCheckInterval time.Duration, cfg *log.Config) (*StreamRelay, error) {
+	// Create server side
+	s, err := NewEphemeralServer(port, version, systemID, streamType, writeTimeout, inactivityTimeout,
+		inactivityCheckInterval, cfg)
+	if err != nil {
+		log.Errorf("Error creating relay server side: %v", err)
+		return nil, err
+	}
+
+	return newRelay(server, streamType, s)
+}
+
+// Close closes the stream file and the databases of a server not started or already shut down, and deletes the
+// stream if it's ephemeral
+func (s *StreamServer) Close() error {
+	if s.started {
+		log.Errorf("Close not allowed. Server is started")
+		return ErrCloseNotAllowed
+	}
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	if s.streamFile != nil {
+		if s.streamFile.file != nil {
+			errs = append(errs, s.streamFile.file.Close(), s.streamFile.closeDirectIO())
+		}
+		if s.streamFile.fileHeader != nil {
+			errs = append(errs, s.streamFile.fileHeader.Close())
+		}
+	}
+	if s.bookmark != nil {
+		errs = append(errs, s.bookmark.db.Close())
+	}
+	if s.content != nil {
+		errs = append(errs, s.content.db.Close())
+	}
+	if s.headerChanges != nil {
+		errs = append(errs, s.headerChanges.file.Close(), s.headerChanges.fileHeader.Close())
+	}
+	if s.checkpoints != nil {
+		errs = append(errs, s.checkpoints.db.Close())
+	}
+	if s.groups != nil {
+		errs = append(errs, s.groups.db.Close())
+	}
+	if s.positions != nil {
+		errs = append(errs, s.positions.db.Close())
+	}
+	if s.summary != nil {
+		errs = append(errs, s.summary.close())
+	}
+	if s.latest != nil {
+		errs = append(errs, s.latest.db.Close())
+	}
+
+	// Delete the ephemeral stream
+	if s.ephemeralDir != "" {
+		errs = append(errs, os.RemoveAll(s.ephemeralDir))
+		log.Infof("Ephemeral stream deleted: %s", s.ephemeralDir)
+	}
+
+	return errors.Join(errs...)
+}
+
+// IsEphemeral checks if the stream of the server is ephemeral
+func (s *StreamServer) IsEphemeral() bool {
+	return s.ephemeralDir != ""
+}
+
+// Close closes the relay server side (see StreamServer.Close)
+func (r *StreamRelay) Close() error {
+	return r.server.Close()
+}
+
+// ephemeralBaseDir returns the directory to create the ephemeral streams, memory-backed if available
+func ephemeralBaseDir() string {
+	info, err := os.Stat(ephemeralMemoryDir)
+	if err == nil && info.IsDir() {
+		return ephemeralMemoryDir
+	}
+	return os.TempDir()
+}
+
+// collectEphemeralDirs deletes the directories of the ephemeral streams left by processes no longer running
+func collectEphemeralDirs(base string) {
+	dirs, err := filepath.Glob(filepath.Join(base, ephemeralPrefix+"*"))
+	if err != nil {
+		return
+	}
+
+	for _, dir := range dirs {
+		name := strings.TrimPrefix(filepath.Base(dir), ephemeralPrefix)
+		pid, err := strconv.Atoi(name[:max(strings.IndexRune(name, '-'), 0)])
+		if err != nil || pid == os.Getpid() || processRunning(pid) {
+			continue
+		}
+		err = os.RemoveAll(dir)
+		if err != nil {
+			log.Warnf("Error deleting ephemeral stream %s left by process %d: %v", dir, pid, err)
+			continue
+		}
+		log.Infof("Ephemeral stream %s left by process %d deleted", dir, pid)
+	}
+}
+
+// processRunning checks if a process is running, it's assumed running if it can't be checked
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone)
+}
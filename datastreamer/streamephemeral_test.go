@@ -0,0 +1,51 @@
+package datastreamer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralServer(t *testing.T) {
+	server, err := NewEphemeralServer(freePort(t), 1, 137, StreamType(1), 3*time.Second, 0, 5*time.Second, nil)
+	require.NoError(t, err)
+	require.True(t, server.IsEphemeral())
+	require.DirExists(t, server.ephemeralDir)
+	require.FileExists(t, filepath.Join(server.ephemeralDir, ephemeralFileName))
+	require.NoError(t, server.Start())
+
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamBookmark([]byte{0x01})
+	require.NoError(t, err)
+	_, err = server.AddStreamEntry(1, []byte{0x01, 0x02})
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+
+	// Case: Close a started server -> FAIL
+	require.ErrorIs(t, server.Close(), ErrCloseNotAllowed)
+
+	// Case: Shutdown -> Stream deleted
+	require.NoError(t, server.Shutdown(time.Second))
+	require.NoDirExists(t, server.ephemeralDir)
+	require.NoError(t, server.Close())
+}
+
+func TestCollectEphemeralDirs(t *testing.T) {
+	base := t.TempDir()
+	dead := filepath.Join(base, fmt.Sprintf("%s%d-1", ephemeralPrefix, 99999999))
+	own := filepath.Join(base, fmt.Sprintf("%s%d-1", ephemeralPrefix, os.Getpid()))
+	other := filepath.Join(base, ephemeralPrefix+"other")
+	for _, dir := range []string{dead, own, other} {
+		require.NoError(t, os.Mkdir(dir, 0700))
+	}
+
+	// Case: Directories of processes not running -> Deleted
+	collectEphemeralDirs(base)
+	require.NoDirExists(t, dead)
+	require.DirExists(t, own)
+	require.DirExists(t, other)
+}
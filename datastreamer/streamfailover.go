@@ -0,0 +1,50 @@
+package datastreamer
+
+import (
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// parseServers returns the server addresses of a comma separated list, failed over in order
+func parseServers(server string) []string {
+	servers := []string{}
+	for _, address := range strings.Split(server, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			servers = append(servers, address)
+		}
+	}
+	if len(servers) == 0 {
+		return []string{server}
+	}
+	return servers
+}
+
+// serverAddr returns the address of the current server
+func (c *StreamClient) serverAddr() string {
+	return c.servers[c.current.Load()]
+}
+
+// GetServer returns the address of the current server, the one connected or to connect next (it changes on a
+// failover to the next server of the list)
+func (c *StreamClient) GetServer() string {
+	return c.serverAddr()
+}
+
+// failover switches to the next server address of the list (if more than one), to detect its protocol version again
+// and resume the streaming and the subscriptions there. Returns if the new server wasn't tried since the latest
+// connection established, to connect to it right away
+func (c *StreamClient) failover(reason error) bool {
+	if len(c.servers) <= 1 {
+		return false
+	}
+	r := &c.reconnect
+	from := c.serverAddr()
+	c.current.Store(int32((int(c.current.Load()) + 1) % len(c.servers)))
+	c.protocol.Store(0)
+	r.serverFailures = 0
+	r.tried++
+	log.Warnf("%s Failing over from server %s to %s: %v", c.ID, from, c.serverAddr(), reason)
+	return r.tried < len(c.servers)
+}
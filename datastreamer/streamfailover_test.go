@@ -0,0 +1,59 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientFailover(t *testing.T) {
+	portDown, portA, portB := freePort(t), freePort(t), freePort(t)
+	newServer := func(port uint16, name string, entries int) *datastreamer.StreamServer {
+		server := openTestServer(t, port, t.TempDir()+"/"+name)
+		require.NoError(t, server.Start())
+		addTestEntries(t, server, entries)
+		return server
+	}
+	serverB := newServer(portB, "failover_b.bin", 5)
+
+	processed := make(chan uint64, 100)
+	client, err := datastreamer.NewClient(fmt.Sprintf("127.0.0.1:%d, 127.0.0.1:%d,127.0.0.1:%d", portDown, portB,
+		portA), streamType)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	client.SetReconnectPolicy(datastreamer.ReconnectPolicy{Backoff: 20 * time.Millisecond})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		processed <- e.Number
+		return nil
+	})
+	requireProcessed := func(from uint64, to uint64) {
+		for entryNum := from; entryNum <= to; entryNum++ {
+			select {
+			case number := <-processed:
+				require.Equal(t, entryNum, number)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for streaming entries")
+			}
+		}
+	}
+
+	// Case: First server unreachable -> Failed over to the next one
+	require.Equal(t, fmt.Sprintf("127.0.0.1:%d", portDown), client.GetServer())
+	require.NoError(t, client.Start())
+	require.Equal(t, fmt.Sprintf("127.0.0.1:%d", portB), client.GetServer())
+	require.NoError(t, client.ExecCommandStart(0))
+	requireProcessed(0, 4)
+
+	// Case: Server shut down -> Failed over to the next one, streaming resumed from the next entry
+	newServer(portA, "failover_a.bin", 10)
+	require.NoError(t, serverB.Shutdown(0))
+	requireProcessed(5, 9)
+	require.Equal(t, fmt.Sprintf("127.0.0.1:%d", portA), client.GetServer())
+	require.Equal(t, fmt.Sprintf("127.0.0.1:%d", portA), client.GetStats().Server)
+	require.Equal(t, uint64(1), client.GetStats().ReconnectCount)
+	require.Empty(t, processed)
+}
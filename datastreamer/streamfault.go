@@ -0,0 +1,85 @@
+//go:build faultinject
+
+package datastreamer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// clientFaults type for the network faults injected into the client (faultinject build tag), for the tests of the
+// reconnection and consistency handling of the embedders
+type clientFaults struct {
+	drop    atomic.Int64 // Number of data frames to drop
+	corrupt atomic.Int64 // Number of data frames to corrupt
+	delay   atomic.Int64 // Delay of each read of a frame in nanoseconds
+}
+
+// ForceDisconnect closes the current streaming connection to the server as a network partition would, the client
+// reconnects then as configured by its reconnection policy, resuming the streaming and the subscriptions
+func (c *StreamClient) ForceDisconnect() {
+	c.mutexWrite.Lock()
+	defer c.mutexWrite.Unlock()
+
+	if c.conn != nil {
+		log.Infof("%s Forced disconnection", c.ID)
+		_ = c.conn.Close()
+	}
+}
+
+// DropNextNFrames drops the next n data frames received from the server (streaming and subscriptions) as lost by the
+// network, before processing them (0 stops dropping)
+func (c *StreamClient) DropNextNFrames(n int) {
+	c.faults.drop.Store(int64(n))
+}
+
+// CorruptNextNFrames flips the first byte of the data of the next n data frames received from the server (streaming
+// and subscriptions) as corrupted by the network, before verifying their checksums (0 stops corrupting)
+func (c *StreamClient) CorruptNextNFrames(n int) {
+	c.faults.corrupt.Store(int64(n))
+}
+
+// DelayReads delays each frame received on the streaming connection, as a slow network would (0 disables it)
+func (c *StreamClient) DelayReads(d time.Duration) {
+	c.faults.delay.Store(int64(d))
+}
+
+// dropFrame checks if a data frame received is dropped by the injected faults
+func (c *StreamClient) dropFrame(e *FileEntry) bool {
+	for {
+		drop := c.faults.drop.Load()
+		if drop <= 0 {
+			return false
+		}
+		if c.faults.drop.CompareAndSwap(drop, drop-1) {
+			log.Debugf("%s Entry %d dropped by the injected faults", c.ID, e.Number)
+			return true
+		}
+	}
+}
+
+// corruptFrame corrupts a data frame received if set by the injected faults
+func (c *StreamClient) corruptFrame(e *FileEntry) {
+	for {
+		corrupt := c.faults.corrupt.Load()
+		if corrupt <= 0 || len(e.Data) == 0 {
+			return
+		}
+		if c.faults.corrupt.CompareAndSwap(corrupt, corrupt-1) {
+			log.Debugf("%s Entry %d corrupted by the injected faults", c.ID, e.Number)
+			e.Data[0] ^= 0xff
+			return
+		}
+	}
+}
+
+// delayRead waits the delay injected of a frame received, returns false if the client is stopped meanwhile
+func (c *StreamClient) delayRead() bool {
+	delay := c.faults.delay.Load()
+	if delay <= 0 {
+		return true
+	}
+	return c.wait(time.Duration(delay))
+}
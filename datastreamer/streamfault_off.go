@@ -0,0 +1,19 @@
+//go:build !faultinject
+
+package datastreamer
+
+// clientFaults type for the network faults injected into the client, none without the faultinject build tag
+type clientFaults struct{}
+
+// dropFrame checks if a data frame received is dropped by the injected faults
+func (c *StreamClient) dropFrame(_ *FileEntry) bool {
+	return false
+}
+
+// corruptFrame corrupts a data frame received if set by the injected faults
+func (c *StreamClient) corruptFrame(_ *FileEntry) {}
+
+// delayRead waits the delay injected of a frame received, returns false if the client is stopped meanwhile
+func (c *StreamClient) delayRead() bool {
+	return true
+}
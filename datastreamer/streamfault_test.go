@@ -0,0 +1,73 @@
+//go:build faultinject
+
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientFaults(t *testing.T) {
+	server, port := newTestServer(t, "faults.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 5)
+
+	processed := make(chan uint64, 100)
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	client.SetChecksum(datastreamer.ChecksumCRC32)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		processed <- e.Number
+		return nil
+	})
+	requireProcessed := func(expected ...uint64) {
+		for _, entryNum := range expected {
+			select {
+			case number := <-processed:
+				require.Equal(t, entryNum, number)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for streaming entries")
+			}
+		}
+	}
+
+	// Case: Next frames dropped -> Entries lost, the following ones processed
+	client.DropNextNFrames(2)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	requireProcessed(2, 3, 4)
+	require.Equal(t, uint64(3), client.GetStats().EntriesReceived)
+
+	// Case: Forced disconnection -> Reconnected, streaming resumed after the latest entry received
+	client.ForceDisconnect()
+	require.Eventually(t, func() bool {
+		stats := client.GetStats()
+		return stats.Connected && stats.ReconnectCount == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	addTestEntries(t, server, 1)
+	requireProcessed(5)
+
+	// Case: Reads delayed -> Entries processed after the delay
+	client.DelayReads(200 * time.Millisecond)
+	start := time.Now()
+	addTestEntries(t, server, 1)
+	requireProcessed(6)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	client.DelayReads(0)
+
+	// Case: Next frame corrupted -> Checksum mismatch, reconnected streaming again the entry
+	readErrors := client.GetStats().Errors[datastreamer.StatErrRead]
+	client.CorruptNextNFrames(1)
+	addTestEntries(t, server, 2)
+	requireProcessed(7, 8)
+	stats := client.GetStats()
+	require.Equal(t, uint64(2), stats.ReconnectCount)
+	require.Equal(t, readErrors+1, stats.Errors[datastreamer.StatErrRead])
+	require.Contains(t, stats.LastError, datastreamer.ErrEntryChecksumMismatch.Error())
+}
@@ -7,7 +7,9 @@ import (
 	"math"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
 	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
 )
 
@@ -19,32 +21,45 @@ const (
 	fileMode       = 0666        // Open file mode
 	magicNumSize   = 16          // Magic numbers size
 	headerSize     = 38          // Header data size
+	headerSizeBase = 46          // Header data size with a base entry
 	PageHeaderSize = 4096        // PageHeaderSize is the size of header page (4 KB)
 	PageDataSize   = 1024 * 1024 // PageDataSize is the size of one data page (1 MB)
 	initPages      = 100         // Initial number of data pages
 	nextPages      = 10          // Number of data pages to add when file is full
 
-	PtPadding = 0    // PtPadding is packet type for pad
-	PtHeader  = 1    // PtHeader is packet type just for the header page
-	PtData    = 2    // PtData is packet type for data entry
-	PtDataRsp = 0xfe // PtDataRsp is packet type for command response with data
-	PtResult  = 0xff // PtResult is packet type not stored/present in file (just for client command result)
+	PtPadding   = codec.PtPadding   // PtPadding is packet type for pad
+	PtHeader    = codec.PtHeader    // PtHeader is packet type just for the header page
+	PtData      = codec.PtData      // PtData is packet type for data entry
+	PtReconnect = codec.PtReconnect // PtReconnect is packet type for the server request to reconnect (not stored in file)
+	PtShutdown  = codec.PtShutdown  // PtShutdown is packet type for the server shutdown notification (not stored in file)
+	PtTagged    = codec.PtTagged    // PtTagged is packet type for a frame tagged with a subscription (not stored in file)
+	PtDataRsp   = codec.PtDataRsp   // PtDataRsp is packet type for command response with data
+	PtResult    = codec.PtResult    // PtResult is packet type not stored/present in file (just for client command result)
 
-	EtBookmark = 0xb0 // EtBookmark is entry type for bookmarks
+	PtPong       = codec.PtPong       // PtPong is packet type for the server answer to a ping (not stored in file)
+	PtCompressed = codec.PtCompressed // PtCompressed is packet type for data entry with compressed data (just streamed)
 
-	FixedSizeFileEntry   = 17 // FixedSizeFileEntry is the fixed size in bytes for a data file entry (1+4+4+8)
-	FixedSizeResultEntry = 9  // FixedSizeResultEntry is the fixed size in bytes for a result entry (1+4+4)
+	PtPrivateFirst = codec.PtPrivateFirst // PtPrivateFirst is the first packet type of the private range (custom frames)
+	PtPrivateLast  = codec.PtPrivateLast  // PtPrivateLast is the last packet type of the private range (custom frames)
+
+	EtBookmark = codec.EtBookmark // EtBookmark is entry type for bookmarks
+
+	FixedSizeFileEntry   = codec.FixedSizeFileEntry   // FixedSizeFileEntry is the fixed size of a data entry (1+4+4+8)
+	FixedSizeResultEntry = codec.FixedSizeResultEntry // FixedSizeResultEntry is the fixed size of a result entry (1+4+4)
+	FixedSizeTaggedFrame = codec.FixedSizeTaggedFrame // FixedSizeTaggedFrame is the fixed size of a tagged prefix (1+8)
+	FixedSizeCustomFrame = codec.FixedSizeCustomFrame // FixedSizeCustomFrame is the fixed size of a custom prefix (1+4)
 )
 
 // HeaderEntry type for a header entry
 type HeaderEntry struct {
 	packetType   uint8      // 1:Header
-	headLength   uint32     // Total length of header entry (38)
+	headLength   uint32     // Total length of header entry (38, or 46 with a base entry)
 	Version      uint8      // Stream file version
 	SystemID     uint64     // System identifier (e.g. ChainID)
 	streamType   StreamType // 1:Sequencer
 	TotalLength  uint64     // Total bytes used in the file
-	TotalEntries uint64     // Total number of data entries (packet type PtData)
+	TotalEntries uint64     // Total number of data entries (packet type PtData), including the base entry offset
+	BaseEntry    uint64     // Number of the first data entry (genesis offset of a stream continuing a legacy numbering)
 }
 
 // FileEntry type for a data file entry
@@ -52,7 +67,7 @@ type FileEntry struct {
 	packetType uint8     // 2:Data entry, 0:Padding
 	Length     uint32    // Total length of the entry (17 bytes + length(data))
 	Type       EntryType // 0xb0:Bookmark, 1:Event1, 2:Event2,...
-	Number     uint64    // Entry number (sequential starting with 0)
+	Number     uint64    // Entry number (sequential starting with 0, or the base entry)
 	Data       []byte
 }
 
@@ -73,6 +88,15 @@ type StreamFile struct {
 	header      HeaderEntry // Current header in memory (atomic operation in progress)
 	writtenHead HeaderEntry // Current header written in the file
 	mutexHeader sync.Mutex  // Mutex for update header data
+
+	writeWindow time.Duration // Time window to coalesce the writes of data entries (0 not coalesced)
+	writeBuffer []byte        // Data entries coalesced pending to write
+	writeSince  time.Time     // Time of the first write coalesced in the buffer
+
+	direct *directWriter // Direct I/O writer of the data entries (nil if buffered writes)
+
+	verifyWrites bool // Flag to read back and verify every write to the file
+	retryEIO     bool // Flag to reopen the file also on the I/O errors (EIO), not only on the stale file handles
 }
 
 type iteratorFile struct {
@@ -181,6 +205,12 @@ func (f *StreamFile) openCreateFile() error {
 		return err
 	}
 
+	// Check the data entries and locate the last one
+	err = f.checkDataEntries()
+	if err != nil {
+		return err
+	}
+
 	// Set initial file position to write
 	_, err = f.file.Seek(int64(f.header.TotalLength), io.SeekStart)
 	if err != nil {
@@ -273,23 +303,32 @@ func (f *StreamFile) createPage(size uint32) error {
 	page := make([]byte, size)
 
 	// Position at the end of the file
-	_, err := f.file.Seek(0, io.SeekEnd)
+	end, err := f.file.Seek(0, io.SeekEnd)
 	if err != nil {
 		log.Errorf("Error seeking the end of the file: %v", err)
 		return err
 	}
 
-	// Write the page
-	_, err = f.file.Write(page)
-	if err != nil {
-		log.Errorf("Error writing a new page: %v", err)
-		return err
-	}
+	err = f.retryStale("create page", func() error {
+		// Write the page at the end, again after a partial write
+		_, err := f.file.Seek(end, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = f.file.Write(page)
+		if err != nil {
+			log.Errorf("Error writing a new page: %v", err)
+			return err
+		}
 
-	// Flush
-	err = f.file.Sync()
+		// Flush
+		err = f.file.Sync()
+		if err != nil {
+			log.Errorf("Error flushing new page to disk: %v", err)
+		}
+		return err
+	})
 	if err != nil {
-		log.Errorf("Error flushing new page to disk: %v", err)
 		return err
 	}
 
@@ -315,24 +354,33 @@ func (f *StreamFile) extendFile() error {
 
 // readHeaderEntry reads header from file to restore the header struct
 func (f *StreamFile) readHeaderEntry() error {
-	// Position at the beginning of the file
-	_, err := f.fileHeader.Seek(magicNumSize, io.SeekStart)
-	if err != nil {
-		log.Errorf("Error seeking the start of the file: %v", err)
-		return err
-	}
+	// Read header stream bytes (the header page is bigger than the header with a base entry)
+	binaryHeader := make([]byte, headerSizeBase)
+	var n int
+	err := f.retryStale("read header", func() error {
+		// Position at the beginning of the file
+		_, err := f.fileHeader.Seek(magicNumSize, io.SeekStart)
+		if err != nil {
+			log.Errorf("Error seeking the start of the file: %v", err)
+			return err
+		}
 
-	// Read header stream bytes
-	binaryHeader := make([]byte, headerSize)
-	n, err := f.fileHeader.Read(binaryHeader)
+		n, err = f.fileHeader.Read(binaryHeader)
+		if err != nil {
+			log.Errorf("Error reading the header: %v", err)
+		}
+		return err
+	})
 	if err != nil {
-		log.Errorf("Error reading the header: %v", err)
 		return err
 	}
-	if n != headerSize {
+	if n != headerSizeBase {
 		log.Error("Error getting header info")
 		return ErrGettingHeaderInfo
 	}
+	if binary.BigEndian.Uint32(binaryHeader[1:5]) == headerSize {
+		binaryHeader = binaryHeader[:headerSize]
+	}
 
 	// Convert to header struct
 	f.mutexHeader.Lock()
@@ -349,6 +397,9 @@ func (f *StreamFile) readHeaderEntry() error {
 
 // rollbackHeader cancels current file written entries not committed
 func (f *StreamFile) rollbackHeader() error {
+	// Discard the entries not written yet
+	f.discardWrites()
+
 	// Restore header
 	err := f.readHeaderEntry()
 	if err != nil {
@@ -367,6 +418,8 @@ func (f *StreamFile) rollbackHeader() error {
 
 // getHeaderEntry returns current committed header
 func (f *StreamFile) getHeaderEntry() HeaderEntry {
+	f.mutexHeader.Lock()
+	defer f.mutexHeader.Unlock()
 	return f.writtenHead
 }
 
@@ -379,7 +432,10 @@ func PrintHeaderEntry(e HeaderEntry, title string) {
 	log.Infof("SystemID: [%d]", e.SystemID)
 	log.Infof("streamType: [%d]", e.streamType)
 	log.Infof("totalLength: [%d]", e.TotalLength)
-	log.Infof("totalEntries: [%d]", e.TotalEntries)
+	log.Infof("totalEntries: [%s]", FormatEntryNumber(e.TotalEntries))
+	if e.BaseEntry != 0 {
+		log.Infof("baseEntry: [%s]", FormatEntryNumber(e.BaseEntry))
+	}
 
 	numPage := (e.TotalLength - PageHeaderSize) / PageDataSize
 	offPage := (e.TotalLength - PageHeaderSize) % PageDataSize
@@ -388,19 +444,34 @@ func PrintHeaderEntry(e HeaderEntry, title string) {
 
 // writeHeaderEntry writes the memory header struct into the file header
 func (f *StreamFile) writeHeaderEntry() error {
-	// Position at the beginning of the file
-	_, err := f.fileHeader.Seek(magicNumSize, io.SeekStart)
+	// Write the data entries coalesced before committing them
+	err := f.flushWrites()
 	if err != nil {
-		log.Errorf("Error seeking the start of the file: %v", err)
 		return err
 	}
 
 	// Write after convert header struct to binary stream
 	binaryHeader := encodeHeaderEntryToBinary(f.header)
 	log.Debugf("writing header entry: %v", binaryHeader)
-	_, err = f.fileHeader.Write(binaryHeader)
+	err = f.retryStale("write header", func() error {
+		// Position at the beginning of the file
+		_, err := f.fileHeader.Seek(magicNumSize, io.SeekStart)
+		if err != nil {
+			log.Errorf("Error seeking the start of the file: %v", err)
+			return err
+		}
+
+		_, err = f.fileHeader.Write(binaryHeader)
+		if err != nil {
+			log.Errorf("Error writing the header %v: %v", binaryHeader, err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = f.verifyHeaderWrite(binaryHeader)
 	if err != nil {
-		log.Errorf("Error writing the header %v: %v", binaryHeader, err)
 		return err
 	}
 
@@ -413,46 +484,47 @@ func (f *StreamFile) writeHeaderEntry() error {
 
 // encodeHeaderEntryToBinary encodes from a header entry type to binary bytes slice
 func encodeHeaderEntryToBinary(e HeaderEntry) []byte {
-	be := make([]byte, 1)
-	be[0] = e.packetType
-	be = binary.BigEndian.AppendUint32(be, e.headLength)
-	be = append(be, e.Version) //nolint:makezero
-	be = binary.BigEndian.AppendUint64(be, e.SystemID)
-	be = binary.BigEndian.AppendUint64(be, uint64(e.streamType))
-	be = binary.BigEndian.AppendUint64(be, e.TotalLength)
-	be = binary.BigEndian.AppendUint64(be, e.TotalEntries)
-	return be
+	return codec.EncodeHeader(codec.Header{
+		PacketType:   e.packetType,
+		Length:       e.headLength,
+		Version:      e.Version,
+		SystemID:     e.SystemID,
+		StreamType:   uint64(e.streamType),
+		TotalLength:  e.TotalLength,
+		TotalEntries: e.TotalEntries,
+		BaseEntry:    e.BaseEntry,
+	})
 }
 
 // decodeBinaryToHeaderEntry decodes from binary bytes slice to a header entry type
 func decodeBinaryToHeaderEntry(b []byte) (HeaderEntry, error) {
-	e := HeaderEntry{}
-
-	if len(b) != headerSize {
+	h, err := codec.DecodeHeader(b)
+	if err != nil {
 		log.Error("Invalid binary header entry")
-		return e, ErrInvalidBinaryHeader
-	}
-
-	e.packetType = b[0]
-	e.headLength = binary.BigEndian.Uint32(b[1:5])
-	e.Version = b[5]
-	e.SystemID = binary.BigEndian.Uint64(b[6:14])
-	e.streamType = StreamType(binary.BigEndian.Uint64(b[14:22]))
-	e.TotalLength = binary.BigEndian.Uint64(b[22:30])
-	e.TotalEntries = binary.BigEndian.Uint64(b[30:38])
-
-	return e, nil
+		return HeaderEntry{}, err
+	}
+
+	return HeaderEntry{
+		packetType:   h.PacketType,
+		headLength:   h.Length,
+		Version:      h.Version,
+		SystemID:     h.SystemID,
+		streamType:   StreamType(h.StreamType),
+		TotalLength:  h.TotalLength,
+		TotalEntries: h.TotalEntries,
+		BaseEntry:    h.BaseEntry,
+	}, nil
 }
 
 // encodeFileEntryToBinary encodes from a data file entry type to binary bytes
 func encodeFileEntryToBinary(e FileEntry) []byte {
-	be := make([]byte, 1)
-	be[0] = e.packetType
-	be = binary.BigEndian.AppendUint32(be, e.Length)
-	be = binary.BigEndian.AppendUint32(be, uint32(e.Type))
-	be = binary.BigEndian.AppendUint64(be, e.Number)
-	be = append(be, e.Data...) //nolint:makezero
-	return be
+	return codec.EncodeEntry(codec.Entry{
+		PacketType: e.packetType,
+		Length:     e.Length,
+		Type:       uint32(e.Type),
+		Number:     e.Number,
+		Data:       e.Data,
+	})
 }
 
 // checkFileConsistency performs some file consistency checks
@@ -514,7 +586,7 @@ func (f *StreamFile) checkHeaderConsistency() error {
 		log.Error("Invalid header: bad packet type")
 		return ErrInvalidHeaderBadPacketType
 
-	case f.header.headLength != headerSize:
+	case f.header.headLength != headerSize && f.header.headLength != headerSizeBase:
 		log.Error("Invalid header: bad header length")
 		return ErrInvalidHeaderBadHeaderLength
 
@@ -568,7 +640,7 @@ func (f *StreamFile) AddFileEntry(e FileEntry) error {
 	}
 
 	// Write the data entry
-	_, err = f.file.Write(be)
+	err = f.writeData(be)
 	if err != nil {
 		log.Errorf("Error writing the entry: %v", err)
 		return err
@@ -594,8 +666,11 @@ func (f *StreamFile) fillPagePadEntries() error {
 	}
 
 	if pageRemaining > 0 {
-		// Write pad entry
-		_, err := f.file.Write([]byte{0})
+		// Write pad entry, and the data entries coalesced in the page
+		err := f.writeData([]byte{0})
+		if err == nil {
+			err = f.flushWrites()
+		}
 		if err != nil {
 			log.Errorf("Error writing pad entry: %v", err)
 			return err
@@ -630,31 +705,25 @@ func printStreamFile(f *StreamFile) {
 
 // DecodeBinaryToFileEntry decodes from binary bytes slice to file entry type
 func DecodeBinaryToFileEntry(b []byte) (FileEntry, error) {
-	d := FileEntry{}
-
-	if len(b) < FixedSizeFileEntry {
-		log.Error("Invalid binary data entry")
-		return d, ErrInvalidBinaryEntry
+	e, err := codec.DecodeEntry(b)
+	d := FileEntry{
+		packetType: e.PacketType,
+		Length:     e.Length,
+		Type:       EntryType(e.Type),
+		Number:     e.Number,
+		Data:       e.Data,
 	}
-
-	d.packetType = b[0]
-	d.Length = binary.BigEndian.Uint32(b[1:5])
-	d.Type = EntryType(binary.BigEndian.Uint32(b[5:9]))
-	d.Number = binary.BigEndian.Uint64(b[9:17])
-	d.Data = b[17:]
-
-	if uint32(len(d.Data)) != d.Length-FixedSizeFileEntry {
-		log.Error("Error decoding binary data entry")
-		return d, ErrDecodingBinaryDataEntry
+	if err != nil {
+		log.Errorf("Error decoding binary data entry: %v", err)
 	}
-
-	return d, nil
+	return d, err
 }
 
 // iteratorFrom initializes iterator to locate a data entry number in the stream file
 func (f *StreamFile) iteratorFrom(entryNum uint64, readOnly bool) (*iteratorFile, error) {
 	// Check starting entry number
-	if entryNum >= f.writtenHead.TotalEntries {
+	header := f.getHeaderEntry()
+	if entryNum < header.BaseEntry || entryNum >= header.TotalEntries {
 		log.Error("Invalid starting entry number for iterator")
 		return nil, ErrInvalidEntryNumber
 	}
@@ -692,7 +761,8 @@ func (f *StreamFile) iteratorFrom(entryNum uint64, readOnly bool) (*iteratorFile
 // iteratorNext gets the next data entry in the file for the iterator, returns the end of entries condition
 func (f *StreamFile) iteratorNext(iterator *iteratorFile) (bool, error) {
 	// Check end of entries condition
-	if iterator.Entry.Number >= f.writtenHead.TotalEntries {
+	totalEntries := f.getHeaderEntry().TotalEntries
+	if iterator.Entry.Number >= totalEntries {
 		return true, nil
 	}
 
@@ -776,12 +846,18 @@ func (f *StreamFile) iteratorNext(iterator *iteratorFile) (bool, error) {
 	}
 
 	// Convert to data entry struct
-	iterator.Entry, err = DecodeBinaryToFileEntry(buffer)
+	entry, err := DecodeBinaryToFileEntry(buffer)
 	if err != nil {
 		log.Errorf("Error decoding entry for iterator: %v", err)
 		return true, err
 	}
 
+	// Check end of committed entries, the entries of an atomic operation in progress may be written after them
+	if entry.Number >= totalEntries {
+		return true, nil
+	}
+	iterator.Entry = entry
+
 	return false, nil
 }
 
@@ -1027,6 +1103,15 @@ func (f *StreamFile) updateEntryData(entryNum uint64, etype EntryType, data []by
 		log.Errorf("Error writing updated entry data: %v", err)
 		return err
 	}
+	if f.verifyWrites {
+		pos, err := iterator.file.Seek(0, io.SeekCurrent)
+		if err == nil {
+			err = f.verifyWrite(iterator.file, data, pos-int64(len(data)))
+		}
+		if err != nil {
+			return err
+		}
+	}
 
 	// Flush data to disk
 	err = iterator.file.Sync()
@@ -1,8 +1,13 @@
 package datastreamer
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -54,3 +59,370 @@ func TestWriteAndReadHeader(t *testing.T) {
 	assert.Equal(t, uint64(10), sf.header.TotalEntries)
 	assert.Equal(t, uint64(4096), sf.header.TotalLength)
 }
+
+func TestCheckDataEntries(t *testing.T) {
+	filename := "test_streamfile_scan.bin"
+	defer cleanupTestFile(filename)
+
+	// Entries of 300 KB, 3 per data page
+	const numEntries = 10
+	sf := setupTestFile(t, filename)
+	data := make([]byte, 300*1024)
+	for i := uint64(0); i < numEntries; i++ {
+		err := sf.AddFileEntry(FileEntry{
+			packetType: PtData,
+			Length:     FixedSizeFileEntry + uint32(len(data)),
+			Type:       1,
+			Number:     i,
+			Data:       data,
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sf.writeHeaderEntry())
+	header := sf.getHeaderEntry()
+
+	// Case: Header consistent with the last data page -> Header unchanged
+	sf = setupTestFile(t, filename)
+	assert.Equal(t, header, sf.getHeaderEntry())
+	assert.NoError(t, sf.validateDataEntries())
+
+	// Case: Middle data page corrupted -> Not detected on open, deep validation fails
+	page := make([]byte, PageDataSize)
+	_, err := sf.file.ReadAt(page, PageHeaderSize+PageDataSize)
+	assert.NoError(t, err)
+	_, err = sf.file.WriteAt([]byte{0xff}, PageHeaderSize+PageDataSize)
+	assert.NoError(t, err)
+	sf = setupTestFile(t, filename)
+	assert.Equal(t, header, sf.getHeaderEntry())
+	assert.ErrorIs(t, sf.validateDataEntries(), ErrStreamFileValidation)
+	_, err = sf.file.WriteAt(page, PageHeaderSize+PageDataSize)
+	assert.NoError(t, err)
+
+	// Case: Header with entries not in the file -> Header recovered
+	sf.header.TotalEntries = numEntries + 2
+	sf.header.TotalLength += 2 * PageDataSize
+	assert.NoError(t, sf.writeHeaderEntry())
+	sf = setupTestFile(t, filename)
+	assert.Equal(t, header, sf.getHeaderEntry())
+
+	// Case: Last data page lost (zeroed) -> Header recovered to the last entry before it
+	_, err = sf.file.WriteAt(make([]byte, PageDataSize), PageHeaderSize+3*PageDataSize)
+	assert.NoError(t, err)
+	sf = setupTestFile(t, filename)
+	assert.Equal(t, uint64(9), sf.getHeaderEntry().TotalEntries)
+	assert.Equal(t, uint64(PageHeaderSize+2*PageDataSize+3*(FixedSizeFileEntry+len(data))),
+		sf.getHeaderEntry().TotalLength)
+
+	// Case: Corrupted entry in the last data page -> Header recovered to the last entry before it
+	_, err = sf.file.WriteAt([]byte{0xff}, PageHeaderSize+2*PageDataSize+FixedSizeFileEntry+int64(len(data)))
+	assert.NoError(t, err)
+	sf = setupTestFile(t, filename)
+	assert.Equal(t, uint64(7), sf.getHeaderEntry().TotalEntries)
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	filename := "test_streamfile_coalescing.bin"
+	defer cleanupTestFile(filename)
+
+	sf := setupTestFile(t, filename)
+	sf.writeWindow = time.Hour
+
+	readData := func() []byte {
+		data := make([]byte, FixedSizeFileEntry)
+		file, err := os.Open(filename)
+		assert.NoError(t, err)
+		defer file.Close()
+		_, err = file.ReadAt(data, PageHeaderSize)
+		assert.NoError(t, err)
+		return data
+	}
+	addEntry := func(number uint64) {
+		err := sf.AddFileEntry(FileEntry{
+			packetType: PtData,
+			Length:     FixedSizeFileEntry + 1,
+			Type:       1,
+			Number:     number,
+			Data:       []byte{byte(number)},
+		})
+		assert.NoError(t, err)
+	}
+
+	// Entries coalesced and discarded on rollback, nothing written
+	addEntry(0)
+	addEntry(1)
+	assert.Equal(t, make([]byte, FixedSizeFileEntry), readData())
+	assert.NoError(t, sf.rollbackHeader())
+	assert.Empty(t, sf.writeBuffer)
+
+	// Entries coalesced written on commit
+	addEntry(0)
+	addEntry(1)
+	assert.Equal(t, make([]byte, FixedSizeFileEntry), readData())
+	assert.NoError(t, sf.writeHeaderEntry())
+	assert.Empty(t, sf.writeBuffer)
+	assert.Equal(t, encodeFileEntryToBinary(FileEntry{
+		packetType: PtData,
+		Length:     FixedSizeFileEntry + 1,
+		Type:       1,
+		Number:     0,
+	})[:FixedSizeFileEntry], readData())
+
+	iterator, err := sf.iteratorFrom(1, true)
+	assert.NoError(t, err)
+	defer sf.iteratorEnd(iterator)
+	end, err := sf.iteratorNext(iterator)
+	assert.NoError(t, err)
+	assert.False(t, end)
+	assert.Equal(t, uint64(1), iterator.Entry.Number)
+	assert.Equal(t, []byte{1}, iterator.Entry.Data)
+}
+
+func TestDirectIO(t *testing.T) {
+	filename := "test_streamfile_direct.bin"
+	defer cleanupTestFile(filename)
+
+	sf := setupTestFile(t, filename)
+	sf.setDirectIO(true)
+	defer func() { assert.NoError(t, sf.closeDirectIO()) }()
+
+	// Entries of sizes not aligned, spanning blocks and data pages
+	const entries = 1500
+	for i := uint64(0); i < entries; i++ {
+		err := sf.AddFileEntry(FileEntry{
+			packetType: PtData,
+			Length:     FixedSizeFileEntry + uint32(i%7*300),
+			Type:       1,
+			Number:     i,
+			Data:       bytes.Repeat([]byte{byte(i)}, int(i%7*300)),
+		})
+		assert.NoError(t, err)
+		if i%100 == 99 {
+			assert.NoError(t, sf.writeHeaderEntry())
+		}
+	}
+
+	// Uncommitted entries rolled back and overwritten
+	assert.NoError(t, sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 3, Type: 2,
+		Number: entries, Data: []byte{1, 2, 3}}))
+	assert.NoError(t, sf.rollbackHeader())
+	assert.NoError(t, sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 1, Type: 1,
+		Number: entries, Data: []byte{9}}))
+	assert.NoError(t, sf.writeHeaderEntry())
+
+	iterator, err := sf.iteratorFrom(0, true)
+	assert.NoError(t, err)
+	defer sf.iteratorEnd(iterator)
+	for i := uint64(0); i <= entries; i++ {
+		end, err := sf.iteratorNext(iterator)
+		assert.NoError(t, err)
+		assert.False(t, end)
+		assert.Equal(t, i, iterator.Entry.Number)
+		if i < entries {
+			assert.Equal(t, bytes.Repeat([]byte{byte(i)}, int(i%7*300)), iterator.Entry.Data)
+		} else {
+			assert.Equal(t, []byte{9}, iterator.Entry.Data)
+		}
+	}
+	assert.NoError(t, sf.checkFileConsistency())
+}
+
+func TestIteratorUncommitted(t *testing.T) {
+	filename := "test_streamfile_uncommitted.bin"
+	defer cleanupTestFile(filename)
+
+	sf := setupTestFile(t, filename)
+	for i := uint64(0); i < 2; i++ {
+		err := sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 1, Type: 1, Number: i,
+			Data: []byte{byte(i)}})
+		assert.NoError(t, err)
+		if i == 0 {
+			assert.NoError(t, sf.writeHeaderEntry())
+		}
+	}
+
+	// Entry of the atomic operation in progress written to the file -> Not read by the iterator
+	iterator, err := sf.iteratorFrom(0, true)
+	assert.NoError(t, err)
+	defer sf.iteratorEnd(iterator)
+	end, err := sf.iteratorNext(iterator)
+	assert.NoError(t, err)
+	assert.False(t, end)
+	assert.Equal(t, uint64(0), iterator.Entry.Number)
+	end, err = sf.iteratorNext(iterator)
+	assert.NoError(t, err)
+	assert.True(t, end)
+	assert.Equal(t, uint64(0), iterator.Entry.Number)
+}
+
+func TestStaleFileRecovery(t *testing.T) {
+	filename := "test_streamfile_stale.bin"
+	defer cleanupTestFile(filename)
+
+	sf := setupTestFile(t, filename)
+	addEntry := func(number uint64) {
+		err := sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 1, Type: 1, Number: number,
+			Data: []byte{byte(number)}})
+		assert.NoError(t, err)
+	}
+	addEntry(0)
+	assert.NoError(t, sf.writeHeaderEntry())
+
+	// Stale file handle -> File reopened and operation run again at the write position
+	file, fileHeader := sf.file, sf.fileHeader
+	calls := 0
+	err := sf.retryStale("test", func() error {
+		calls++
+		if calls == 1 {
+			return &os.PathError{Op: "write", Path: filename, Err: syscall.ESTALE}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.NotSame(t, file, sf.file)
+	assert.NotSame(t, fileHeader, sf.fileHeader)
+	pos, err := sf.file.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(sf.header.TotalLength), pos)
+
+	addEntry(1)
+	assert.NoError(t, sf.writeHeaderEntry())
+	iterator, err := sf.iteratorFrom(0, true)
+	assert.NoError(t, err)
+	defer sf.iteratorEnd(iterator)
+	for i := uint64(0); i < 2; i++ {
+		end, err := sf.iteratorNext(iterator)
+		assert.NoError(t, err)
+		assert.False(t, end)
+		assert.Equal(t, []byte{byte(i)}, iterator.Entry.Data)
+	}
+
+	// I/O error -> Retried only if enabled
+	ioError := func() error {
+		calls++
+		if calls == 1 {
+			return &os.PathError{Op: "read", Path: filename, Err: syscall.EIO}
+		}
+		return nil
+	}
+	calls = 0
+	assert.ErrorIs(t, sf.retryStale("test", ioError), syscall.EIO)
+	assert.Equal(t, 1, calls)
+	sf.retryEIO = true
+	calls = 0
+	assert.NoError(t, sf.retryStale("test", ioError))
+	assert.Equal(t, 2, calls)
+
+	// Other errors -> Not retried
+	calls = 0
+	failed := errors.New("failed")
+	err = sf.retryStale("test", func() error {
+		calls++
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, 1, calls)
+}
+
+func TestWriteVerification(t *testing.T) {
+	for _, window := range []time.Duration{0, time.Hour} {
+		filename := "test_streamfile_verify.bin"
+		sf := setupTestFile(t, filename)
+		sf.verifyWrites = true
+		sf.writeWindow = window
+
+		// Entries spanning data pages, written and committed -> Verified
+		for i := uint64(0); i < 300; i++ {
+			err := sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 10000, Type: 1,
+				Number: i, Data: bytes.Repeat([]byte{byte(i)}, 10000)})
+			assert.NoError(t, err)
+			if i%50 == 49 {
+				assert.NoError(t, sf.writeHeaderEntry())
+			}
+		}
+		assert.NoError(t, sf.updateEntryData(7, 1, bytes.Repeat([]byte{9}, 10000)))
+
+		// Entry with a length not matching its data -> Not decoded as written
+		err := sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 5, Type: 1, Number: 300,
+			Data: []byte{1}})
+		if err == nil {
+			err = sf.writeHeaderEntry()
+		}
+		assert.ErrorIs(t, err, ErrWriteVerification)
+		cleanupTestFile(filename)
+	}
+
+	// Data read back not matching -> Write verification failed
+	filename := "test_streamfile_verify.bin"
+	defer cleanupTestFile(filename)
+	sf := setupTestFile(t, filename)
+	assert.NoError(t, sf.verifyWrite(sf.fileHeader, magicNumbers, 0))
+	assert.ErrorIs(t, sf.verifyWrite(sf.fileHeader, []byte("polygonDATSTREAX"), 0), ErrWriteVerification)
+}
+
+func BenchmarkAddFileEntry(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		window time.Duration
+		direct bool
+	}{
+		{"buffered", 0, false},
+		{"coalesced", time.Millisecond, false},
+		{"direct", 0, true},
+		{"direct-coalesced", time.Millisecond, true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			filename := "bench_streamfile_" + bench.name + ".bin"
+			defer cleanupTestFile(filename)
+			sf, err := NewStreamFile(filename, 1, 12345, 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sf.writeWindow = bench.window
+			sf.setDirectIO(bench.direct)
+			defer func() { _ = sf.closeDirectIO() }()
+
+			data := make([]byte, 256) //nolint:mnd
+			b.SetBytes(int64(FixedSizeFileEntry + len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + uint32(len(data)),
+					Type: 1, Number: uint64(i), Data: data})
+				if err == nil && i%100 == 99 {
+					err = sf.writeHeaderEntry()
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLastBookmarkBeforeBaseEntry(t *testing.T) {
+	filename := "test_streamfile_base.bin"
+	defer cleanupTestFile(filename)
+
+	sf := setupTestFile(t, filename)
+	assert.NoError(t, sf.setBaseEntry(1000))
+
+	// Case: Start from the base entry -> No bookmark before it, without error
+	bookmark, found, err := sf.lastBookmarkBefore(1000)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Nil(t, bookmark)
+
+	// Case: Bookmark at the base entry -> Found after it
+	assert.NoError(t, sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 2, Type: EtBookmark,
+		Number: 1000, Data: []byte{0, 1}}))
+	assert.NoError(t, sf.AddFileEntry(FileEntry{packetType: PtData, Length: FixedSizeFileEntry + 1, Type: 1,
+		Number: 1001, Data: []byte{2}}))
+	assert.NoError(t, sf.writeHeaderEntry())
+	bookmark, found, err = sf.lastBookmarkBefore(1001)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte{0, 1}, bookmark)
+	_, found, err = sf.lastBookmarkBefore(1000)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
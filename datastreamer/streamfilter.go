@@ -0,0 +1,368 @@
+package datastreamer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// EntryFilter type of the function matching the data entries of a filter expression
+type EntryFilter func(e *FileEntry) bool
+
+// filterParser type to parse a filter expression into an entry filter (recursive descent)
+type filterParser struct {
+	expr   string
+	tokens []filterToken
+	pos    int
+}
+
+// filterToken type for a token of a filter expression
+type filterToken struct {
+	text   string
+	offset int // Offset of the token in the expression
+}
+
+// ParseFilter parses a filter expression of the data entries. The conditions are on the entry fields `type`,
+// `number`, `size` (data bytes) and `version` (payload schema version) with the operators ==, !=, <, <=, >, >= and
+// `in` (list of values and inclusive ranges, e.g. `type in (1, 2)`, `number in (0..99, 200..299)` or
+// `number in 100..200`), and on the `data` with the operators `prefix` and `contains` (hex bytes 0x... or a quoted
+// string, e.g. `data prefix 0x0b01`). The conditions are combined with `and`, `or`, `not` and parentheses. The numbers
+// are decimal or hex (0x...)
+func ParseFilter(expr string) (EntryFilter, error) {
+	p := filterParser{expr: expr}
+	err := p.tokenize()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, p.fail(0, "empty expression")
+	}
+
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.fail(p.tokens[p.pos].offset, "unexpected "+p.tokens[p.pos].text)
+	}
+	return filter, nil
+}
+
+// NewFilterMiddleware creates a middleware dropping the data entries not matching a filter expression (see
+// ParseFilter). As a send middleware of a relay it sets the forwarding rules to the relay clients, and as a receive
+// middleware of a client it slices the stream processed
+func NewFilterMiddleware(expr string) (EntryMiddleware, error) {
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next EntryHandler) EntryHandler {
+		return func(e *FileEntry) error {
+			if !filter(e) {
+				return nil
+			}
+			return next(e)
+		}
+	}, nil
+}
+
+// fail logs the error of the filter expression at an offset and returns ErrInvalidFilter
+func (p *filterParser) fail(offset int, reason string) error {
+	log.Errorf("Invalid filter %q at offset %d: %s", p.expr, offset, reason)
+	return ErrInvalidFilter
+}
+
+// tokenize splits the filter expression into tokens: words, numbers, quoted strings and operators
+func (p *filterParser) tokenize() error {
+	expr := p.expr
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"':
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end < 0 {
+				return p.fail(i, "unterminated string")
+			}
+			p.tokens = append(p.tokens, filterToken{text: expr[i : i+end+2], offset: i})
+			i += end + 2 //nolint:mnd
+
+		case isFilterWordChar(c):
+			start := i
+			for i < len(expr) && isFilterWordChar(expr[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, filterToken{text: strings.ToLower(expr[start:i]), offset: start})
+
+		case strings.HasPrefix(expr[i:], ".."), strings.HasPrefix(expr[i:], "=="),
+			strings.HasPrefix(expr[i:], "!="), strings.HasPrefix(expr[i:], "<="), strings.HasPrefix(expr[i:], ">="):
+			p.tokens = append(p.tokens, filterToken{text: expr[i : i+2], offset: i})
+			i += 2 //nolint:mnd
+
+		case strings.IndexByte("(),<>", c) >= 0:
+			p.tokens = append(p.tokens, filterToken{text: expr[i : i+1], offset: i})
+			i++
+
+		default:
+			return p.fail(i, "unexpected character "+strconv.QuoteRune(rune(c)))
+		}
+	}
+	return nil
+}
+
+// isFilterWordChar checks if a character is part of a word or a number of a filter expression
+func isFilterWordChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+// peek returns the text of the current token (empty at the end of the expression)
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+// next consumes the current token
+func (p *filterParser) next() (filterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, p.fail(len(p.expr), "unexpected end of expression")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+// expect consumes the current token, that must be the expected one
+func (p *filterParser) expect(text string) error {
+	token, err := p.next()
+	if err != nil {
+		return err
+	}
+	if token.text != text {
+		return p.fail(token.offset, "expected "+text+" instead of "+token.text)
+	}
+	return nil
+}
+
+// parseOr parses the conditions combined with or
+func (p *filterParser) parseOr() (EntryFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *FileEntry) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+// parseAnd parses the conditions combined with and
+func (p *filterParser) parseAnd() (EntryFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *FileEntry) bool { return l(e) && right(e) }
+	}
+	return left, nil
+}
+
+// parseUnary parses a negated condition, a parenthesized expression or a condition
+func (p *filterParser) parseUnary() (EntryFilter, error) {
+	switch p.peek() {
+	case "not":
+		p.pos++
+		filter, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *FileEntry) bool { return !filter(e) }, nil
+
+	case "(":
+		p.pos++
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return filter, p.expect(")")
+	}
+	return p.parseCondition()
+}
+
+// parseCondition parses a condition on an entry field
+func (p *filterParser) parseCondition() (EntryFilter, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	var value func(e *FileEntry) uint64
+	switch field.text {
+	case "type":
+		value = func(e *FileEntry) uint64 { return uint64(e.Type) }
+	case "number":
+		value = func(e *FileEntry) uint64 { return e.Number }
+	case "size":
+		value = func(e *FileEntry) uint64 { return uint64(len(e.Data)) }
+	case "version":
+		value = func(e *FileEntry) uint64 { return uint64(e.Type.Version()) }
+	case "data":
+		return p.parseDataCondition()
+	default:
+		return nil, p.fail(field.offset, "unknown field "+field.text)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if op.text == "in" {
+		return p.parseInCondition(value)
+	}
+
+	operand, err := p.parseNumber()
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "==":
+		return func(e *FileEntry) bool { return value(e) == operand }, nil
+	case "!=":
+		return func(e *FileEntry) bool { return value(e) != operand }, nil
+	case "<":
+		return func(e *FileEntry) bool { return value(e) < operand }, nil
+	case "<=":
+		return func(e *FileEntry) bool { return value(e) <= operand }, nil
+	case ">":
+		return func(e *FileEntry) bool { return value(e) > operand }, nil
+	case ">=":
+		return func(e *FileEntry) bool { return value(e) >= operand }, nil
+	}
+	return nil, p.fail(op.offset, "unknown operator "+op.text)
+}
+
+// parseInCondition parses the list of values and inclusive ranges of an in condition, or a single range
+func (p *filterParser) parseInCondition(value func(e *FileEntry) uint64) (EntryFilter, error) {
+	type valueRange struct{ from, to uint64 }
+	var ranges []valueRange
+
+	parseRange := func() error {
+		from, err := p.parseNumber()
+		if err != nil {
+			return err
+		}
+		to := from
+		if p.peek() == ".." {
+			p.pos++
+			to, err = p.parseNumber()
+			if err != nil {
+				return err
+			}
+		}
+		ranges = append(ranges, valueRange{from: from, to: to})
+		return nil
+	}
+
+	if p.peek() != "(" {
+		err := parseRange()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.pos++
+		for {
+			err := parseRange()
+			if err != nil {
+				return nil, err
+			}
+			if p.peek() != "," {
+				break
+			}
+			p.pos++
+		}
+		err := p.expect(")")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(e *FileEntry) bool {
+		v := value(e)
+		for _, r := range ranges {
+			if v >= r.from && v <= r.to {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseDataCondition parses a condition on the entry data
+func (p *filterParser) parseDataCondition() (EntryFilter, error) {
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	operand, err := p.parseBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.text {
+	case "prefix":
+		return func(e *FileEntry) bool { return bytes.HasPrefix(e.Data, operand) }, nil
+	case "contains":
+		return func(e *FileEntry) bool { return bytes.Contains(e.Data, operand) }, nil
+	}
+	return nil, p.fail(op.offset, "unknown data operator "+op.text)
+}
+
+// parseNumber parses a decimal or hex (0x...) number
+func (p *filterParser) parseNumber() (uint64, error) {
+	token, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseUint(token.text, 0, 64)
+	if err != nil {
+		return 0, p.fail(token.offset, "invalid number "+token.text)
+	}
+	return number, nil
+}
+
+// parseBytes parses hex bytes (0x...) or a quoted string
+func (p *filterParser) parseBytes() ([]byte, error) {
+	token, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(token.text, "\"") {
+		return []byte(token.text[1 : len(token.text)-1]), nil
+	}
+	if strings.HasPrefix(token.text, "0x") {
+		data, err := hex.DecodeString(token.text[2:])
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, p.fail(token.offset, "invalid bytes "+token.text+", expected hex (0x...) or a quoted string")
+}
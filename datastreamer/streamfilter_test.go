@@ -0,0 +1,78 @@
+package datastreamer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	entries := []FileEntry{
+		{Type: 1, Number: 10, Data: []byte{0x0b, 0x01, 0x02}},
+		{Type: 2, Number: 150, Data: []byte("block 150")},
+		{Type: EtBookmark, Number: 151, Data: []byte{0x00, 0x97}},
+		{Type: 3, Number: 300, Data: []byte{}},
+		{Type: VersionedEntryType(2, 3), Number: 400, Data: []byte{0x01}},
+	}
+	matching := func(expr string) []uint64 {
+		filter, err := ParseFilter(expr)
+		require.NoError(t, err, expr)
+		numbers := []uint64{}
+		for i := range entries {
+			if filter(&entries[i]) {
+				numbers = append(numbers, entries[i].Number)
+			}
+		}
+		return numbers
+	}
+
+	// Case: Conditions on the entry fields -> OK
+	assert.Equal(t, []uint64{10, 150}, matching("type in (1, 2)"))
+	assert.Equal(t, []uint64{151}, matching("type == 0xb0"))
+	assert.Equal(t, []uint64{10, 150, 300, 400}, matching("TYPE != 0xB0"))
+	assert.Equal(t, []uint64{150, 151}, matching("number in 100..200"))
+	assert.Equal(t, []uint64{10, 300}, matching("number in (0..99, 300)"))
+	assert.Equal(t, []uint64{151, 300, 400}, matching("number > 150"))
+	assert.Equal(t, []uint64{10, 150}, matching("number <= 150 and size >= 3"))
+	assert.Equal(t, []uint64{300}, matching("size == 0"))
+	assert.Equal(t, []uint64{10}, matching("data prefix 0x0b01"))
+	assert.Equal(t, []uint64{150}, matching(`data contains "150"`))
+
+	// Case: Conditions combined -> OK
+	assert.Equal(t, []uint64{10, 151}, matching("type == 1 or type == 0xb0"))
+	assert.Equal(t, []uint64{150, 300, 400}, matching("not (type == 1 or type == 0xb0)"))
+	assert.Equal(t, []uint64{10, 300}, matching("type == 1 or type == 3 and number >= 300"))
+	assert.Equal(t, []uint64{300}, matching("(type == 1 or type == 3) and not number < 300"))
+	assert.Equal(t, []uint64{400}, matching("version == 3"))
+
+	// Case: Invalid expressions -> FAIL
+	for _, expr := range []string{"", "type", "type ==", "type = 1", "color == 1", "type in (1, 2", "type in ()",
+		"number in 1..", "data prefix 0x0", "data prefix abc", `data prefix "abc`, "data starts 0x01",
+		"type == 1 and", "type == 1 2", "number == -1", "(type == 1", "type == 1)"} {
+		_, err := ParseFilter(expr)
+		assert.ErrorIs(t, err, ErrInvalidFilter, expr)
+	}
+}
+
+func TestFilterMiddleware(t *testing.T) {
+	filter, err := NewFilterMiddleware("type in (1, 2)")
+	require.NoError(t, err)
+	chain := entryChain{filter}
+
+	// Case: Entry matching -> Passed
+	entry := FileEntry{packetType: PtData, Type: 2, Number: 7, Data: []byte{1}}
+	passed, err := chain.apply(&entry)
+	require.NoError(t, err)
+	assert.True(t, passed)
+
+	// Case: Entry not matching -> Dropped
+	entry.Type = EtBookmark
+	passed, err = chain.apply(&entry)
+	require.NoError(t, err)
+	assert.False(t, passed)
+
+	// Case: Invalid expression -> FAIL
+	_, err = NewFilterMiddleware("type in")
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
@@ -0,0 +1,90 @@
+package datastreamer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	formatOptions FormatOptions // Formatting options set by SetFormatOptions
+	mutexFormat   sync.RWMutex  // Mutex for access to the formatting options
+)
+
+// FormatOptions type for the formatting of the entry numbers, bookmarks and payloads in the debug printers and the
+// tooling logs. The default options format them in decimal and in full
+type FormatOptions struct {
+	Hex         bool // Entry numbers, bookmarks and payloads in hexadecimal instead of decimal
+	BookmarkLen int  // Maximum bytes of the bookmarks shown, the rest elided (0 for the full bookmarks)
+	PayloadLen  int  // Maximum bytes of the payloads shown, the rest elided (0 for the full payloads)
+}
+
+// SetFormatOptions sets the formatting options of the debug printers and the tooling logs
+func SetFormatOptions(opts FormatOptions) {
+	mutexFormat.Lock()
+	defer mutexFormat.Unlock()
+
+	formatOptions = opts
+}
+
+// GetFormatOptions returns the formatting options of the debug printers and the tooling logs
+func GetFormatOptions() FormatOptions {
+	mutexFormat.RLock()
+	defer mutexFormat.RUnlock()
+
+	return formatOptions
+}
+
+// FormatEntryNumber formats an entry number with the formatting options
+func FormatEntryNumber(entryNum uint64) string {
+	if GetFormatOptions().Hex {
+		return fmt.Sprintf("0x%x", entryNum)
+	}
+	return fmt.Sprintf("%d", entryNum)
+}
+
+// FormatBookmark formats a bookmark with the formatting options, shortened to the maximum bookmark bytes
+func FormatBookmark(bookmark []byte) string {
+	opts := GetFormatOptions()
+	return formatBytes(bookmark, opts.Hex, opts.BookmarkLen)
+}
+
+// FormatPayload formats an entry payload with the formatting options, shortened to the maximum payload bytes
+func FormatPayload(data []byte) string {
+	opts := GetFormatOptions()
+	return formatBytes(data, opts.Hex, opts.PayloadLen)
+}
+
+// PayloadPreview returns the preview of an entry payload prefixed by a space, only if the maximum payload bytes is
+// set (for the printers showing only the length of the payloads by default)
+func PayloadPreview(data []byte) string {
+	opts := GetFormatOptions()
+	if opts.PayloadLen <= 0 {
+		return ""
+	}
+	return " " + formatBytes(data, opts.Hex, opts.PayloadLen)
+}
+
+// formatBytes formats bytes in hexadecimal (0x0102) or decimal ([1 2]), shortened to maxLen bytes (if not 0) with
+// the total length
+func formatBytes(data []byte, hexFormat bool, maxLen int) string {
+	shown := data
+	if maxLen > 0 && len(data) > maxLen {
+		shown = data[:maxLen]
+	}
+
+	var s string
+	if hexFormat {
+		s = "0x" + hex.EncodeToString(shown)
+	} else {
+		s = fmt.Sprintf("%v", shown)
+	}
+	if len(shown) == len(data) {
+		return s
+	}
+	if hexFormat {
+		return fmt.Sprintf("%s... (%d bytes)", s, len(data))
+	}
+	return fmt.Sprintf("%s ...] (%d bytes)", strings.TrimSuffix(s, "]"), len(data))
+}
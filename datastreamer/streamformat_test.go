@@ -0,0 +1,31 @@
+package datastreamer_test
+
+import (
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatOptions(t *testing.T) {
+	defer datastreamer.SetFormatOptions(datastreamer.FormatOptions{})
+	data := []byte{0x01, 0x02, 0xab, 0xcd}
+
+	// Case: Default options -> Decimal and in full
+	require.Equal(t, "1000", datastreamer.FormatEntryNumber(1000))
+	require.Equal(t, "[1 2 171 205]", datastreamer.FormatPayload(data))
+	require.Equal(t, "[1 2 171 205]", datastreamer.FormatBookmark(data))
+	require.Equal(t, "", datastreamer.PayloadPreview(data))
+
+	// Case: Hexadecimal, shortened -> Elided with the total length
+	datastreamer.SetFormatOptions(datastreamer.FormatOptions{Hex: true, BookmarkLen: 1, PayloadLen: 2})
+	require.Equal(t, "0x3e8", datastreamer.FormatEntryNumber(1000))
+	require.Equal(t, "0x0102... (4 bytes)", datastreamer.FormatPayload(data))
+	require.Equal(t, "0x01... (4 bytes)", datastreamer.FormatBookmark(data))
+	require.Equal(t, " 0x0102... (4 bytes)", datastreamer.PayloadPreview(data))
+	require.Equal(t, "0x01", datastreamer.FormatPayload(data[:1]))
+
+	// Case: Decimal, shortened
+	datastreamer.SetFormatOptions(datastreamer.FormatOptions{PayloadLen: 3})
+	require.Equal(t, "[1 2 171 ...] (4 bytes)", datastreamer.FormatPayload(data))
+}
@@ -0,0 +1,166 @@
+package datastreamer
+
+import (
+	"encoding/binary"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	maxCustomFrameSize   = 1 << 20 // Maximum payload size of a custom frame (1 MB)
+	customFrameTypeShift = 56      // Bit shift of the packet type in the command word of a custom frame to the server
+)
+
+// CustomFrame type for a frame of a custom packet type (private range PtPrivateFirst..PtPrivateLast)
+type CustomFrame struct {
+	Type     uint8  // Packet type of the frame
+	Payload  []byte // Payload of the frame
+	ClientID string // Client connection the frame was received from (only on the server)
+}
+
+// FrameHandler type of the handler of the custom frames received of a packet type, called from the connection read
+// loop (it must not block). An error is logged
+type FrameHandler func(frame CustomFrame) error
+
+// IsPrivatePacketType checks if a packet type is in the private range for custom frames
+func IsPrivatePacketType(pt uint8) bool {
+	return codec.IsPrivatePacketType(pt)
+}
+
+// SetFrameHandler registers the handler of the custom frames of a private packet type received from the clients,
+// e.g. for experimental extensions developed out-of-tree. The frames without handler are discarded, a nil handler
+// unregisters it (call before Start)
+func (s *StreamServer) SetFrameHandler(pt uint8, handler FrameHandler) error {
+	if !IsPrivatePacketType(pt) {
+		return ErrInvalidCustomPacketType
+	}
+	s.frameHandlers = setFrameHandler(s.frameHandlers, pt, handler)
+	return nil
+}
+
+// SendFrame sends a custom frame of a private packet type to a client connection
+func (s *StreamServer) SendFrame(clientID string, pt uint8, payload []byte) error {
+	if !IsPrivatePacketType(pt) {
+		return ErrInvalidCustomPacketType
+	}
+	if len(payload) > maxCustomFrameSize {
+		return ErrCustomFrameTooLarge
+	}
+	cli := s.getSafeClient(clientID)
+	if cli == nil {
+		return ErrClientNotFound
+	}
+	if cli.conn == nil {
+		return ErrNilConnection
+	}
+	_, err := TimeoutWrite(cli, codec.EncodeCustomFrame(pt, payload), s.writeTimeout)
+	return err
+}
+
+// readCustomFrame reads the payload of a custom frame from a client connection (its command word already read) and
+// passes it to its handler. Returns an error if the connection can't continue
+func (s *StreamServer) readCustomFrame(cli *client, pt uint8, length uint32) error {
+	if length > maxCustomFrameSize {
+		log.Errorf("Custom frame type %d of %d bytes too large: client %s killed", pt, length, cli.clientID)
+		return ErrCustomFrameTooLarge
+	}
+	payload := []byte{}
+	if length > 0 {
+		var err error
+		payload, err = readFullBytes(length, cli)
+		if err != nil {
+			return err
+		}
+	}
+	dispatchFrame(s.frameHandlers, CustomFrame{Type: pt, Payload: payload, ClientID: cli.clientID})
+	return nil
+}
+
+// SetFrameHandler registers the handler of the custom frames of a private packet type received from the server, e.g.
+// for experimental extensions developed out-of-tree. The frames without handler are discarded, a nil handler
+// unregisters it (call before Start)
+func (c *StreamClient) SetFrameHandler(pt uint8, handler FrameHandler) error {
+	if !IsPrivatePacketType(pt) {
+		return ErrInvalidCustomPacketType
+	}
+	c.frameHandlers = setFrameHandler(c.frameHandlers, pt, handler)
+	return nil
+}
+
+// SendFrame sends a custom frame of a private packet type to the server over the streaming connection. It's sent as
+// a command word with the packet type in its most significant byte and the payload length, followed by the payload
+func (c *StreamClient) SendFrame(pt uint8, payload []byte) error {
+	if !IsPrivatePacketType(pt) {
+		return ErrInvalidCustomPacketType
+	}
+	if len(payload) > maxCustomFrameSize {
+		return ErrCustomFrameTooLarge
+	}
+	if !c.started {
+		return ErrExecCommandNotAllowed
+	}
+
+	c.mutexWrite.Lock()
+	defer c.mutexWrite.Unlock()
+
+	if c.conn == nil {
+		return ErrNilConnection
+	}
+	frame := binary.BigEndian.AppendUint64(nil, uint64(pt)<<customFrameTypeShift|uint64(len(payload)))
+	_, err := c.conn.Write(append(frame, payload...))
+	if err != nil {
+		log.Errorf("%s Error sending custom frame type %d: %v", c.ID, pt, err)
+	}
+	return err
+}
+
+// readCustomFrame reads a custom frame from the server connection (its packet type already read) and passes it to
+// its handler. Returns an error if the connection can't continue
+func (c *StreamClient) readCustomFrame(pt uint8) error {
+	buffer := make([]byte, FixedSizeCustomFrame-1)
+	err := c.readContent(c.conn, buffer)
+	if err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(buffer)
+	if length < FixedSizeCustomFrame || length-FixedSizeCustomFrame > maxCustomFrameSize {
+		log.Errorf("%s Custom frame type %d invalid length %d", c.ID, pt, length)
+		return ErrCustomFrameTooLarge
+	}
+	payload := make([]byte, length-FixedSizeCustomFrame)
+	if len(payload) > 0 {
+		err = c.readContent(c.conn, payload)
+		if err != nil {
+			return err
+		}
+	}
+	dispatchFrame(c.frameHandlers, CustomFrame{Type: pt, Payload: payload})
+	return nil
+}
+
+// setFrameHandler sets or removes the handler of a packet type in a handlers map, returns the map
+func setFrameHandler(handlers map[uint8]FrameHandler, pt uint8, handler FrameHandler) map[uint8]FrameHandler {
+	if handler == nil {
+		delete(handlers, pt)
+		return handlers
+	}
+	if handlers == nil {
+		handlers = make(map[uint8]FrameHandler)
+	}
+	handlers[pt] = handler
+	return handlers
+}
+
+// dispatchFrame passes a custom frame to the handler of its packet type, discarding it if there is no handler
+func dispatchFrame(handlers map[uint8]FrameHandler, frame CustomFrame) {
+	handler := handlers[frame.Type]
+	if handler == nil {
+		log.Warnf("Custom frame type %d without handler discarded", frame.Type)
+		return
+	}
+	err := handler(frame)
+	if err != nil {
+		log.Errorf("Error handling custom frame type %d: %v", frame.Type, err)
+	}
+}
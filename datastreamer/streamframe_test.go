@@ -0,0 +1,62 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomFrames(t *testing.T) {
+	const ptEcho = datastreamer.PtPrivateFirst + 1
+	port := freePort(t)
+	server, err := datastreamer.NewEphemeralServer(port, 1, 137, streamType, 3*time.Second, 120*time.Second,
+		5*time.Second, nil)
+	require.NoError(t, err)
+
+	// Server echoing the frames with the payload reversed
+	require.ErrorIs(t, server.SetFrameHandler(datastreamer.PtData, nil), datastreamer.ErrInvalidCustomPacketType)
+	require.NoError(t, server.SetFrameHandler(ptEcho, func(frame datastreamer.CustomFrame) error {
+		reversed := make([]byte, len(frame.Payload))
+		for i, b := range frame.Payload {
+			reversed[len(reversed)-1-i] = b
+		}
+		return server.SendFrame(frame.ClientID, frame.Type, reversed)
+	}))
+	require.NoError(t, server.Start())
+	defer func() { _ = server.Shutdown(0) }()
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamEntry(1, []byte{0x01})
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	frames := make(chan datastreamer.CustomFrame, 3)
+	require.NoError(t, client.SetFrameHandler(ptEcho, func(frame datastreamer.CustomFrame) error {
+		frames <- frame
+		return nil
+	}))
+	entries := make(chan uint64, 1)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		entries <- e.Number
+		return nil
+	})
+	require.ErrorIs(t, client.SendFrame(ptEcho, nil), datastreamer.ErrExecCommandNotAllowed)
+	require.NoError(t, client.Start())
+
+	// Case: Frames with handler -> Echoed, the commands and the streaming not affected
+	require.NoError(t, client.SendFrame(ptEcho, []byte{1, 2, 3}))
+	require.NoError(t, client.SendFrame(datastreamer.PtPrivateLast, []byte{4}))
+	require.NoError(t, client.SendFrame(ptEcho, nil))
+	require.Equal(t, datastreamer.CustomFrame{Type: ptEcho, Payload: []byte{3, 2, 1}}, <-frames)
+	require.Equal(t, datastreamer.CustomFrame{Type: ptEcho, Payload: []byte{}}, <-frames)
+	require.NoError(t, client.ExecCommandStart(0))
+	require.Equal(t, uint64(0), <-entries)
+
+	// Case: Packet type out of the private range -> FAIL
+	require.ErrorIs(t, client.SendFrame(datastreamer.PtData, []byte{1}), datastreamer.ErrInvalidCustomPacketType)
+}
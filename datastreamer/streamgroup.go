@@ -0,0 +1,418 @@
+package datastreamer
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const maxGroupNameLength = 64 // Maximum number of bytes for a consumer group name
+
+// GroupInfo type for the state of a consumer group of the server
+type GroupInfo struct {
+	Name    string `json:"name"`
+	Offset  uint64 `json:"offset"`  // Committed offset of the group, the next entry to process
+	Members int    `json:"members"` // Subscriptions joined to the group
+}
+
+// consumerGroups type to manage the consumer groups of the server and their committed offsets
+type consumerGroups struct {
+	dbName string
+	db     *leveldb.DB
+
+	mutex  sync.Mutex
+	groups map[string]*consumerGroup // Groups with members, by name
+}
+
+// consumerGroup type for a consumer group with members
+type consumerGroup struct {
+	name     string
+	offset   uint64         // Committed offset of the group
+	stored   bool           // Flag committed offset stored in the groups DB
+	floor    uint64         // Commit of the members left with entries not committed, the offset is held at it
+	floorSet bool           // Flag floor set
+	members  []*groupMember // Members in join order
+
+	segEntry uint64       // Next entry number after the bookmark of the latest segment assigned (0 none)
+	segOwner *groupMember // Member the latest segment is assigned to
+}
+
+// groupMember type to route to a subscription only the entries of the segments assigned to it by its group
+type groupMember struct {
+	groups    *consumerGroups
+	group     *consumerGroup // Group of the member (nil once left)
+	owned     bool           // Flag the segment of the latest bookmark streamed is assigned to the member
+	commit    uint64         // Next entry number to process committed by the member
+	delivered uint64         // Next entry number after the latest entry routed to the member
+	evaluated uint64         // Next entry number after the latest entry streamed to the member, routed or not
+}
+
+// SetConsumerGroups sets the server to manage consumer groups, in a groups DB (<file>.grp) storing their committed
+// offsets: the subscriptions sharing a group name (see StreamClient.SubscribeGroup) split the entries of the stream
+// by segments, the bookmarks and the entries that follow them up to the next bookmark, balanced by the hash of the
+// bookmark over the members of the group. A member joining starts from the committed offset of the group (if any),
+// the lowest entry committed by its members, so the horizontally scaled consumers of a stream coordinate their
+// position through the server itself. The delivery is at-least-once: a member joining processes again its segments
+// from the committed offset, and the offset is held at the commit of a member leaving with entries not committed
+// until the group ends, so they are processed again when it restarts (call before Start)
+func (s *StreamServer) SetConsumerGroups(enabled bool) error {
+	if s.groups != nil {
+		err := s.groups.db.Close()
+		s.groups = nil
+		if err != nil || !enabled {
+			return err
+		}
+	}
+	if !enabled {
+		return nil
+	}
+
+	name := s.fileName[0:strings.LastIndex(s.fileName, ".")] + ".grp"
+	groups, err := newConsumerGroups(name)
+	if err != nil {
+		return err
+	}
+	s.groups = groups
+	return nil
+}
+
+// SetConsumerGroups sets the relay server side to manage consumer groups (call before Start)
+func (r *StreamRelay) SetConsumerGroups(enabled bool) error {
+	return r.server.SetConsumerGroups(enabled)
+}
+
+// newConsumerGroups opens or creates the consumer groups database
+func newConsumerGroups(fn string) (*consumerGroups, error) {
+	log.Infof("Opening/creating consumer groups DB for datastream: %s", fn)
+	db, err := leveldb.OpenFile(fn, dbOptions())
+	if err != nil {
+		log.Errorf("Error opening/creating consumer groups DB %s: %v", fn, err)
+		return nil, err
+	}
+	return &consumerGroups{
+		dbName: fn,
+		db:     db,
+		groups: make(map[string]*consumerGroup),
+	}, nil
+}
+
+// SubscribeGroup starts a new streaming subscription joining a consumer group of the server (see
+// StreamServer.SetConsumerGroups): only the entries of the segments assigned to the member are received, from the
+// committed offset of the group, or from entry if the group has none. The entries processed are committed with
+// Subscription.Commit
+func (c *StreamClient) SubscribeGroup(group string, fromEntry uint64, f ProcessEntryFunc) (*Subscription, error) {
+	if len(group) == 0 || len(group) > maxGroupNameLength {
+		log.Errorf("Invalid consumer group name length %d (maximum %d)", len(group), maxGroupNameLength)
+		return nil, ErrInvalidConsumerGroup
+	}
+	return c.subscribe(CmdStartGroup, fromEntry, []byte(group), f)
+}
+
+// Commit commits to the consumer group of the subscription the processed entries before the next entry number, it
+// can be called from the callback function (it doesn't wait for the result, an error of the server is logged)
+func (s *Subscription) Commit(nextEntry uint64) error {
+	if s.group == nil {
+		return ErrInvalidConsumerGroup
+	}
+	c := s.client
+	s.pendingCommits.Add(1)
+	err := c.sendCommand(CmdCommitGroup, s.ID, nextEntry, nil)
+	if err != nil {
+		s.pendingCommits.Add(-1)
+		log.Errorf("%s Error committing entry %d of subscription %d: %v", c.ID, nextEntry, s.ID, err)
+	}
+	return err
+}
+
+// putCommitResult consumes the result of a pending commit, if any. Returns if it's consumed
+func (s *Subscription) putCommitResult(r ResultEntry) bool {
+	for {
+		pending := s.pendingCommits.Load()
+		if pending <= 0 {
+			return false
+		}
+		if s.pendingCommits.CompareAndSwap(pending, pending-1) {
+			break
+		}
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		log.Errorf("%s Result %d[%s] received for commit of subscription %d", s.client.ID, r.errorNum, r.errorStr,
+			s.ID)
+	}
+	return true
+}
+
+// pass checks if an entry streamed belongs to a segment assigned to the member, a bookmark starts a segment
+func (m *groupMember) pass(e *FileEntry) bool {
+	m.groups.mutex.Lock()
+	defer m.groups.mutex.Unlock()
+
+	if m.group == nil {
+		return false
+	}
+	if e.Type == EtBookmark {
+		m.owned = m.group.owner(e) == m
+	}
+	m.evaluated = e.Number + 1
+	if m.owned {
+		m.delivered = e.Number + 1
+	}
+	return m.owned
+}
+
+// owner returns the member assigned to the segment of a bookmark. The latest segment is assigned once, so the
+// members streaming it live agree on its owner while the group changes
+func (g *consumerGroup) owner(e *FileEntry) *groupMember {
+	if e.Number+1 == g.segEntry && g.segOwner.group == g {
+		return g.segOwner
+	}
+	owner := g.members[bookmarkHash(e.Data)%uint32(len(g.members))]
+	if e.Number+1 >= g.segEntry {
+		g.segEntry, g.segOwner = e.Number+1, owner
+	}
+	return owner
+}
+
+// committed returns the next entry number to process of the member: the entries streamed once the ones routed to it
+// are committed
+func (m *groupMember) committed() uint64 {
+	if m.commit >= m.delivered {
+		return m.evaluated
+	}
+	return m.commit
+}
+
+// join adds a member to a consumer group, loading its committed offset. Returns the member and its start entry
+// number: the committed offset of the group, or fromEntry if it has none
+func (g *consumerGroups) join(name string, fromEntry uint64) (*groupMember, uint64, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	grp := g.groups[name]
+	if grp == nil {
+		grp = &consumerGroup{name: name}
+		value, err := g.db.Get([]byte(name), nil)
+		if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+			log.Errorf("Error loading consumer group %s offset: %v", name, err)
+			return nil, 0, err
+		}
+		if err == nil && len(value) == 8 { //nolint:mnd
+			grp.offset, grp.stored = binary.BigEndian.Uint64(value), true
+		}
+		g.groups[name] = grp
+	}
+
+	start := fromEntry
+	if grp.stored {
+		start = grp.offset
+	}
+	member := &groupMember{
+		groups:    g,
+		group:     grp,
+		commit:    start,
+		delivered: start,
+		evaluated: start,
+	}
+	grp.members = append(grp.members, member)
+	log.Infof("Consumer group %s joined from entry %d: %d members", name, start, len(grp.members))
+
+	return member, start, nil
+}
+
+// startSegment sets the segment of the start entry of a member from the bookmark before it, the first member
+// assumed up to the next bookmark if not found
+func (g *consumerGroups) startSegment(m *groupMember, bookmark []byte, found bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	hash := uint32(0)
+	if found {
+		hash = bookmarkHash(bookmark)
+	}
+	m.owned = m.group.members[hash%uint32(len(m.group.members))] == m
+}
+
+// leave removes a member from its consumer group, the group ends once it has no members
+func (g *consumerGroups) leave(m *groupMember) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	grp := m.group
+	if grp == nil {
+		return
+	}
+	m.group = nil
+	for i, member := range grp.members {
+		if member == m {
+			grp.members = append(grp.members[:i], grp.members[i+1:]...)
+			break
+		}
+	}
+
+	if len(grp.members) == 0 {
+		delete(g.groups, grp.name)
+		log.Infof("Consumer group %s ended at offset %d", grp.name, grp.offset)
+		return
+	}
+	if m.commit < m.delivered && (!grp.floorSet || m.commit < grp.floor) {
+		grp.floor, grp.floorSet = m.commit, true
+	}
+	log.Infof("Consumer group %s left: %d members", grp.name, len(grp.members))
+}
+
+// commit records the next entry number to process committed by a member, and stores the committed offset of its
+// group once it advances
+func (g *consumerGroups) commit(m *groupMember, nextEntry uint64) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	grp := m.group
+	if grp == nil {
+		return nil
+	}
+	m.commit = max(m.commit, nextEntry)
+
+	offset := m.committed()
+	for _, member := range grp.members {
+		offset = min(offset, member.committed())
+	}
+	if grp.floorSet {
+		offset = min(offset, grp.floor)
+	}
+	if grp.stored && offset <= grp.offset {
+		return nil
+	}
+
+	err := g.db.Put([]byte(grp.name), binary.BigEndian.AppendUint64(nil, offset), nil)
+	if err != nil {
+		log.Errorf("Error storing consumer group %s offset %d: %v", grp.name, offset, err)
+		return err
+	}
+	grp.offset, grp.stored = offset, true
+	return nil
+}
+
+// info returns the state of the consumer groups with members
+func (g *consumerGroups) info() []GroupInfo {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	groups := make([]GroupInfo, 0, len(g.groups))
+	for _, grp := range g.groups {
+		groups = append(groups, GroupInfo{Name: grp.name, Offset: grp.offset, Members: len(grp.members)})
+	}
+	return groups
+}
+
+// leaveGroup removes the member of a subscription route from its consumer group, if it's a member
+func (s *StreamServer) leaveGroup(route entryRoute) {
+	member, ok := route.(*groupMember)
+	if ok {
+		member.groups.leave(member)
+	}
+}
+
+// handleSubStartGroupCommand processes the tagged CmdStartGroup command creating a new subscription joined to a
+// consumer group
+func (s *StreamServer) handleSubStartGroupCommand(cli *client, tag uint64) error {
+	// Read from entry number and group name parameters
+	fromEntry, err := readFullUint64(cli)
+	if err != nil {
+		return err
+	}
+	length, err := readFullUint32(cli)
+	if err != nil {
+		return err
+	}
+	if length > maxGroupNameLength {
+		log.Errorf("Client %s exceeded [%d] maximum allowed length [%d] for a consumer group: client killed",
+			cli.clientID, length, maxGroupNameLength)
+		s.killClient(cli.clientID)
+		return ErrInvalidConsumerGroup
+	}
+	var name []byte
+	if length > 0 {
+		name, err = readFullBytes(length, cli)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Log
+	log.Debugf("Client %s command StartGroup from %d group [%s] for subscription %d",
+		cli.clientID, fromEntry, name, tag)
+
+	if s.groups == nil || length == 0 {
+		log.Errorf("StartGroup command invalid consumer group [%s] for client %s", name, cli.clientID)
+		_ = s.sendResultEntry(uint32(CmdErrBadGroup), StrCommandErrors[CmdErrBadGroup], cli)
+		return ErrInvalidConsumerGroup
+	}
+
+	member, start, err := s.groups.join(string(name), fromEntry)
+	if err != nil {
+		_ = s.sendResultEntry(uint32(CmdErrBadGroup), StrCommandErrors[CmdErrBadGroup], cli)
+		return err
+	}
+
+	// Segment of the entries from the start entry up to the next bookmark
+	bookmark, found, err := s.streamFile.lastBookmarkBefore(start)
+	if err != nil {
+		log.Warnf("Error searching the bookmark before entry %d: %v", start, err)
+	}
+	if !found && start > s.streamFile.getHeaderEntry().BaseEntry {
+		log.Warnf("No bookmark found before entry %d, first member assumed up to the next bookmark", start)
+	}
+	s.groups.startSegment(member, bookmark, found)
+
+	cli.cmdRoute = member
+	defer func() { cli.cmdRoute = nil }()
+
+	sub, err := s.addSubscription(cli, tag)
+	if err != nil {
+		s.groups.leave(member)
+		return err
+	}
+
+	nextEntry, err := s.startStreamingFromEntry(cli, start)
+	s.endSubscriptionSync(cli, sub, nextEntry, err)
+
+	return err
+}
+
+// handleSubCommitGroupCommand processes the tagged CmdCommitGroup command committing the processed entries of a
+// subscription to its consumer group
+func (s *StreamServer) handleSubCommitGroupCommand(cli *client, tag uint64) error {
+	// Read next entry number parameter
+	nextEntry, err := readFullUint64(cli)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command CommitGroup %d for subscription %d", cli.clientID, nextEntry, tag)
+
+	cli.mutexSubs.RLock()
+	var member *groupMember
+	if sub := cli.subs[tag]; sub != nil {
+		member, _ = sub.route.(*groupMember)
+	}
+	cli.mutexSubs.RUnlock()
+
+	if member == nil {
+		log.Errorf("CommitGroup command for subscription %d not in a consumer group of client %s", tag,
+			cli.clientID)
+		_ = s.sendResultEntry(uint32(CmdErrBadGroup), StrCommandErrors[CmdErrBadGroup], cli)
+		return ErrInvalidConsumerGroup
+	}
+
+	err = member.groups.commit(member, nextEntry)
+	if err != nil {
+		_ = s.sendResultEntry(uint32(CmdErrBadGroup), StrCommandErrors[CmdErrBadGroup], cli)
+		return err
+	}
+	return s.sendResultEntry(uint32(CmdErrOK), StrCommandErrors[CmdErrOK], cli)
+}
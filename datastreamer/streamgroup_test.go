@@ -0,0 +1,113 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerGroup(t *testing.T) {
+	const segments = 8
+	server, port := newTestServer(t, "group.bin")
+	require.NoError(t, server.SetConsumerGroups(true))
+	require.NoError(t, server.Start())
+
+	// Segments of a bookmark followed by 2 entries, hash of the bookmark of each entry
+	var hashes []uint32
+	addSegments := func(from int, to int) {
+		require.NoError(t, server.StartAtomicOp())
+		for i := from; i < to; i++ {
+			bookmark := []byte{byte(i)}
+			_, err := server.AddStreamBookmark(bookmark)
+			require.NoError(t, err)
+			for j := 0; j < 2; j++ {
+				_, err = server.AddStreamEntry(entryType1, testEntries[1].Encode())
+				require.NoError(t, err)
+			}
+			h := fnv.New32a()
+			_, _ = h.Write(bookmark)
+			hashes = append(hashes, h.Sum32(), h.Sum32(), h.Sum32())
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+
+	var mutex sync.Mutex
+	received := make(map[int][]uint64)
+	collect := func(key int) datastreamer.ProcessEntryFunc {
+		return func(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			received[key] = append(received[key], e.Number)
+			mutex.Unlock()
+			return nil
+		}
+	}
+	expected := func(member uint32, members uint32, fromEntry uint64) []uint64 {
+		var entries []uint64
+		for i := fromEntry; i < uint64(len(hashes)); i++ {
+			if hashes[i]%members == member {
+				entries = append(entries, i)
+			}
+		}
+		return entries
+	}
+	check := func(key int, member uint32, members uint32, fromEntry uint64) {
+		require.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return reflect.DeepEqual(expected(member, members, fromEntry), received[key])
+		}, 2*time.Second, 10*time.Millisecond, "member %d of %d from entry %d", member, members, fromEntry)
+	}
+
+	var err error
+	clients := make([]*datastreamer.StreamClient, 3)
+	for i := range clients {
+		clients[i], err = datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		require.NoError(t, clients[i].Start())
+		defer func(c *datastreamer.StreamClient) { _ = c.Close() }(clients[i])
+	}
+
+	// Case: Two members -> Segments balanced between them, each entry received once
+	subs := make([]*datastreamer.Subscription, 2)
+	for i := range subs {
+		subs[i], err = clients[i].SubscribeGroup("indexers", 0, collect(i))
+		require.NoError(t, err)
+	}
+	addSegments(0, segments)
+	check(0, 0, 2, 0)
+	check(1, 1, 2, 0)
+	require.NotEmpty(t, received[0])
+	require.NotEmpty(t, received[1])
+
+	// Case: Members commit the entries processed -> Group committed offset advanced
+	total := uint64(len(hashes))
+	require.NoError(t, subs[0].Commit(total))
+	require.NoError(t, subs[1].Commit(total))
+	require.Eventually(t, func() bool {
+		stats := server.GetStats()
+		return len(stats.Groups) == 1 && stats.Groups[0].Offset == total && stats.Groups[0].Members == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Case: Group ended and joined again -> New member starts from the committed offset
+	for _, sub := range subs {
+		require.NoError(t, sub.Unsubscribe())
+	}
+	require.Empty(t, server.GetStats().Groups)
+	addSegments(segments, segments+4)
+	_, err = clients[2].SubscribeGroup("indexers", 0, collect(2))
+	require.NoError(t, err)
+	check(2, 0, 1, total)
+
+	// Case: Invalid group, or commit of a subscription not in a group -> FAIL
+	_, err = clients[0].SubscribeGroup("", 0, nil)
+	require.ErrorIs(t, err, datastreamer.ErrInvalidConsumerGroup)
+	sub, err := clients[0].Subscribe(0, nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, sub.Commit(1), datastreamer.ErrInvalidConsumerGroup)
+}
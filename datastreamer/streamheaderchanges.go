@@ -0,0 +1,248 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	HeaderChangeCommit   EntryType = 1 // HeaderChangeCommit for the header committed by an atomic operation
+	HeaderChangeTruncate EntryType = 2 // HeaderChangeTruncate for the header updated by a truncation of the file
+)
+
+const (
+	headerChangesStreamType    StreamType = 0x6d657461 // Stream type of the header changes meta-stream ("meta")
+	headerChangeDataSize                  = 8 + 8 + 8 + 8 + 8
+	headerChangeSplitSize                 = 8 + 4 + 1 // Link of the commit of a split atomic operation
+	maxHeaderChangesPerCommand            = 1000      // Maximum number of header changes returned by a command
+)
+
+var (
+	// StrHeaderChange for the header change kinds description
+	StrHeaderChange = map[EntryType]string{
+		HeaderChangeCommit:   "commit",
+		HeaderChangeTruncate: "truncate",
+	}
+)
+
+// HeaderChange type for an update of the committed header recorded in the header changes meta-stream
+type HeaderChange struct {
+	Number           uint64         `json:"number"` // Entry number of the change in the meta-stream
+	Kind             string         `json:"kind"`   // commit|truncate
+	Time             time.Time      `json:"time"`
+	TotalEntries     uint64         `json:"totalEntries"`
+	TotalLength      uint64         `json:"totalLength"`
+	PrevTotalEntries uint64         `json:"prevTotalEntries"`
+	PrevTotalLength  uint64         `json:"prevTotalLength"`
+	Split            *AtomicOpSplit `json:"split,omitempty"` // Link of the commit of a split atomic operation
+}
+
+// SetHeaderChanges sets the server to record every update of the committed header (commits and truncations) as
+// entries of a meta-stream persisted in its own stream file (<file>.meta.bin), queryable by the clients with the
+// HeaderChanges command (call before Start)
+func (s *StreamServer) SetHeaderChanges(enabled bool) error {
+	if !enabled {
+		if s.headerChanges != nil {
+			err := s.headerChanges.file.Close()
+			_ = s.headerChanges.fileHeader.Close()
+			s.headerChanges = nil
+			return err
+		}
+		return nil
+	}
+	if s.headerChanges != nil {
+		return nil
+	}
+
+	name := s.fileName[0:strings.LastIndex(s.fileName, ".")] + ".meta.bin"
+	headerChanges, err := NewStreamFile(name, s.version, s.systemID, headerChangesStreamType)
+	if err != nil {
+		return err
+	}
+	s.headerChanges = headerChanges
+	return nil
+}
+
+// recordHeaderChange appends an update of the committed header to the header changes meta-stream (if enabled), with
+// the link of the commit to its atomic operation if split. The stream is already updated, so an error is just logged
+func (s *StreamServer) recordHeaderChange(kind EntryType, prev HeaderEntry, split *AtomicOpSplit) {
+	if s.headerChanges == nil {
+		return
+	}
+
+	header := s.streamFile.getHeaderEntry()
+	data := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+	data = binary.BigEndian.AppendUint64(data, header.TotalEntries)
+	data = binary.BigEndian.AppendUint64(data, header.TotalLength)
+	data = binary.BigEndian.AppendUint64(data, prev.TotalEntries)
+	data = binary.BigEndian.AppendUint64(data, prev.TotalLength)
+	if split != nil {
+		data = binary.BigEndian.AppendUint64(data, split.FromEntry)
+		data = binary.BigEndian.AppendUint32(data, split.Part)
+		if split.Last {
+			data = append(data, 1)
+		} else {
+			data = append(data, 0)
+		}
+	}
+
+	e := FileEntry{
+		packetType: PtData,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Type:       kind,
+		Number:     s.headerChanges.getHeaderEntry().TotalEntries,
+		Data:       data,
+	}
+	err := s.headerChanges.AddFileEntry(e)
+	if err == nil {
+		err = s.headerChanges.writeHeaderEntry()
+	}
+	if err != nil {
+		log.Errorf("Error recording header change %s of entries %d->%d: %v", StrHeaderChange[kind],
+			prev.TotalEntries, header.TotalEntries, err)
+		_ = s.headerChanges.rollbackHeader()
+	}
+}
+
+// GetHeaderChanges returns the header changes recorded from a change number, up to a maximum number of changes
+func (s *StreamServer) GetHeaderChanges(fromChange uint64, maxChanges int) ([]HeaderChange, error) {
+	changes := []HeaderChange{}
+	if s.headerChanges == nil {
+		return changes, ErrHeaderChangesNotRecorded
+	}
+	if fromChange >= s.headerChanges.getHeaderEntry().TotalEntries {
+		return changes, nil
+	}
+
+	// Initialize file stream iterator from the change
+	iterator, err := s.headerChanges.iteratorFrom(fromChange, true)
+	if err != nil {
+		return changes, err
+	}
+	defer s.headerChanges.iteratorEnd(iterator)
+
+	for len(changes) < maxChanges {
+		end, err := s.headerChanges.iteratorNext(iterator)
+		if err != nil {
+			return changes, err
+		}
+		if end {
+			break
+		}
+		change, err := decodeHeaderChange(iterator.Entry)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// decodeHeaderChange decodes a header change from an entry of the header changes meta-stream
+func decodeHeaderChange(e FileEntry) (HeaderChange, error) {
+	if len(e.Data) != headerChangeDataSize && len(e.Data) != headerChangeDataSize+headerChangeSplitSize {
+		return HeaderChange{}, ErrDecodingHeaderChange
+	}
+	change := HeaderChange{
+		Number:           e.Number,
+		Kind:             StrHeaderChange[e.Type],
+		Time:             time.Unix(0, int64(binary.BigEndian.Uint64(e.Data[0:8]))),
+		TotalEntries:     binary.BigEndian.Uint64(e.Data[8:16]),
+		TotalLength:      binary.BigEndian.Uint64(e.Data[16:24]),
+		PrevTotalEntries: binary.BigEndian.Uint64(e.Data[24:32]),
+		PrevTotalLength:  binary.BigEndian.Uint64(e.Data[32:40]),
+	}
+	if len(e.Data) > headerChangeDataSize {
+		change.Split = &AtomicOpSplit{
+			FromEntry: binary.BigEndian.Uint64(e.Data[40:48]),
+			Part:      binary.BigEndian.Uint32(e.Data[48:52]),
+			Last:      e.Data[52] == 1,
+		}
+	}
+	return change, nil
+}
+
+// handleHeaderChangesCommand processes the CmdHeaderChanges command
+func (s *StreamServer) handleHeaderChangesCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("HeaderChanges command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrHeaderChangesCommandNotAllowed
+	}
+
+	return s.processCmdHeaderChanges(cli)
+}
+
+// processCmdHeaderChanges processes the TCP HeaderChanges command from the clients
+func (s *StreamServer) processCmdHeaderChanges(client *client) error {
+	// Read from change number parameter
+	fromChange, err := readFullUint64(client)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command HeaderChanges from %d", client.clientID, fromChange)
+
+	changes, err := s.GetHeaderChanges(fromChange, maxHeaderChangesPerCommand)
+	if errors.Is(err, ErrHeaderChangesNotRecorded) {
+		return s.sendResultEntry(uint32(CmdErrNoHeaderChanges), StrCommandErrors[CmdErrNoHeaderChanges], client)
+	}
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(changes)
+	}
+	if err != nil {
+		log.Errorf("Error getting header changes for %s: %v", client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the header changes as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteTagged(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending header changes to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
+
+// ExecCommandGetHeaderChanges executes client TCP command to get the header changes recorded by the server from a
+// change number (up to 1000 changes per command)
+func (c *StreamClient) ExecCommandGetHeaderChanges(fromChange uint64) ([]HeaderChange, error) {
+	return c.ExecCommandGetHeaderChangesContext(context.Background(), fromChange)
+}
+
+// ExecCommandGetHeaderChangesContext executes client TCP command to get the header changes recorded by the server
+// from a change number (up to 1000 changes per command), canceled with the context
+func (c *StreamClient) ExecCommandGetHeaderChangesContext(ctx context.Context,
+	fromChange uint64) ([]HeaderChange, error) {
+	changes := []HeaderChange{}
+	_, entry, err := c.execCommand(ctx, CmdHeaderChanges, false, fromChange, nil)
+	if err != nil {
+		return changes, err
+	}
+	err = json.Unmarshal(entry.Data, &changes)
+	return changes, err
+}
@@ -0,0 +1,79 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderChanges(t *testing.T) {
+	port := freePort(t)
+	fileName := t.TempDir() + "/changes.bin"
+	server := openTestServer(t, port, fileName)
+	require.NoError(t, server.SetHeaderChanges(true))
+	require.NoError(t, server.Start())
+
+	addTestEntries(t, server, 3)
+	addTestEntries(t, server, 2)
+	require.NoError(t, server.TruncateFile(4))
+
+	// Case: Commits and truncation recorded -> OK
+	check := func(changes []datastreamer.HeaderChange) {
+		require.Len(t, changes, 3)
+		require.Equal(t, "commit", changes[0].Kind)
+		require.Equal(t, uint64(0), changes[0].PrevTotalEntries)
+		require.Equal(t, uint64(3), changes[0].TotalEntries)
+		require.Equal(t, "commit", changes[1].Kind)
+		require.Equal(t, uint64(3), changes[1].PrevTotalEntries)
+		require.Equal(t, uint64(5), changes[1].TotalEntries)
+		require.Equal(t, changes[0].TotalLength, changes[1].PrevTotalLength)
+		require.Equal(t, "truncate", changes[2].Kind)
+		require.Equal(t, uint64(5), changes[2].PrevTotalEntries)
+		require.Equal(t, uint64(4), changes[2].TotalEntries)
+		for i, change := range changes {
+			require.Equal(t, uint64(i), change.Number)
+			require.False(t, change.Time.IsZero())
+		}
+	}
+	changes, err := server.GetHeaderChanges(0, 10)
+	require.NoError(t, err)
+	check(changes)
+
+	// Case: Query header changes from a client -> OK
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	changes, err = client.ExecCommandGetHeaderChanges(0)
+	require.NoError(t, err)
+	check(changes)
+
+	changes, err = client.ExecCommandGetHeaderChanges(2)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, "truncate", changes[0].Kind)
+
+	changes, err = client.ExecCommandGetHeaderChanges(3)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	// Case: Query header changes from a server not recording them -> FAIL
+	otherServer, otherPort := newTestServer(t, "other.bin")
+	require.NoError(t, otherServer.Start())
+	other, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", otherPort), streamType)
+	require.NoError(t, err)
+	require.NoError(t, other.Start())
+	_, err = other.ExecCommandGetHeaderChanges(0)
+	require.ErrorIs(t, err, datastreamer.ErrHeaderChangesNotRecorded)
+
+	// Case: Header changes persisted -> OK
+	require.NoError(t, server.Shutdown(time.Second))
+	require.NoError(t, server.Close())
+	server = openTestServer(t, port, fileName)
+	require.NoError(t, server.SetHeaderChanges(true))
+	changes, err = server.GetHeaderChanges(0, 10)
+	require.NoError(t, err)
+	check(changes)
+}
@@ -0,0 +1,123 @@
+package datastreamer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const defaultHeartbeatTimeouts = 3 // Default heartbeat timeout in intervals without receiving a packet
+
+// clientHeartbeat type for the detection of the dead connections to the server
+type clientHeartbeat struct {
+	interval time.Duration // Idle time of the connection to send a ping (and TCP keepalive period)
+	timeout  time.Duration // Time without receiving a packet to close the connection
+}
+
+// SetHeartbeat sets the client to detect the dead connections to the server, e.g. silent TCP drops, instead of
+// waiting minutes for a read to fail: once the connection is idle for the interval, a Ping command is sent (answered
+// with a Pong packet), and the connection is closed to reconnect if no packet is received within the timeout (3
+// intervals if 0). The interval is also the TCP keepalive period of the connection, the only detection with the
+// servers not supporting the Ping command. 0 disables it (call before Start)
+func (c *StreamClient) SetHeartbeat(interval time.Duration, timeout time.Duration) {
+	if interval <= 0 {
+		c.heartbeat = nil
+		return
+	}
+	if timeout <= 0 {
+		timeout = defaultHeartbeatTimeouts * interval
+	}
+	c.heartbeat = &clientHeartbeat{
+		interval: interval,
+		timeout:  max(timeout, interval),
+	}
+}
+
+// SetHeartbeat sets the relay client of the master server to detect the dead connections (call before Start)
+func (r *StreamRelay) SetHeartbeat(interval time.Duration, timeout time.Duration) {
+	r.client.SetHeartbeat(interval, timeout)
+}
+
+// keepAlive returns the TCP keepalive period of the connections to the server (0 for the default)
+func (c *StreamClient) keepAlive() time.Duration {
+	if c.heartbeat == nil {
+		return 0
+	}
+	return c.heartbeat.interval
+}
+
+// negotiateHeartbeat detects the server protocol version on a new connection (if not detected yet), to send the
+// Ping commands only to the servers supporting them
+func (c *StreamClient) negotiateHeartbeat(ctx context.Context) error {
+	if c.heartbeat == nil || c.protocol.Load() != 0 {
+		return nil
+	}
+	_, _, err := c.getCommandConn(ctx)
+	if err != nil {
+		return err
+	}
+	if c.protocol.Load() < ProtocolHeartbeat {
+		log.Warnf("%s Ping not supported by server %s, dead connections detected by TCP keepalive only", c.ID,
+			c.serverAddr())
+	}
+	return nil
+}
+
+// readPacket reads the packet type of the next packet from server connection. With heartbeat, a Ping command is
+// sent once the connection is idle for the interval, and ErrHeartbeatTimeout is returned if no packet is received
+// within the timeout
+func (c *StreamClient) readPacket(packet []byte) error {
+	if c.heartbeat == nil || c.protocol.Load() < ProtocolHeartbeat {
+		return c.readContent(c.conn, packet)
+	}
+
+	deadline := time.Now().Add(c.heartbeat.timeout)
+	for {
+		idle := time.Now().Add(c.heartbeat.interval)
+		if idle.After(deadline) {
+			idle = deadline
+		}
+		_ = c.conn.SetReadDeadline(idle)
+		_, err := io.ReadFull(c.conn, packet)
+		if err == nil {
+			// The rest of the packet is read with the timeout
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.heartbeat.timeout))
+			return nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			c.stats.addError(StatErrRead, err)
+			log.Errorf("%s Error reading from server: %v", c.ID, err)
+			return err
+		}
+		if !time.Now().Before(deadline) {
+			log.Warnf("%s No packet received from server %s in %v, reconnecting", c.ID, c.serverAddr(),
+				c.heartbeat.timeout)
+			c.stats.addError(StatErrHeartbeat, ErrHeartbeatTimeout)
+			return ErrHeartbeatTimeout
+		}
+
+		// Ping the server on an idle connection
+		log.Debugf("%s Ping server %s", c.ID, c.serverAddr())
+		c.mutexWrite.Lock()
+		err = c.writeCommand(c.conn, CmdPing, 0, 0, nil)
+		c.mutexWrite.Unlock()
+		if err != nil {
+			log.Errorf("%s Error sending ping to server %s: %v", c.ID, c.serverAddr(), err)
+			return err
+		}
+	}
+}
+
+// handlePingCommand processes the CmdPing command, answered with a Pong packet
+func (s *StreamServer) handlePingCommand(cli *client) error {
+	// Log
+	log.Debugf("Client %s command Ping", cli.clientID)
+
+	_, err := TimeoutWrite(cli, []byte{PtPong}, s.writeTimeout)
+	return err
+}
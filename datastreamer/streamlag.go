@@ -0,0 +1,76 @@
+package datastreamer
+
+import (
+	"context"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// LagInfo type for the lag of the streaming behind the server
+type LagInfo struct {
+	Time         time.Time // Time of the header command
+	TotalEntries uint64    // Total entries of the server from the header command
+	NextEntry    uint64    // Next entry number to receive from streaming
+	Lag          uint64    // Entries pending to receive (total entries - next entry)
+}
+
+// LagFunc type of the hook function called with the lag computed periodically
+type LagFunc func(LagInfo)
+
+// lagMonitor type to compute periodically the lag of the streaming
+type lagMonitor struct {
+	interval time.Duration
+	onLag    LagFunc
+}
+
+// SetLagMonitor sets the client to compute the lag of the streaming every interval, with a header command, and call
+// the hook function with it, while connected to the server. No interval or hook function disables it (call before
+// Start)
+func (c *StreamClient) SetLagMonitor(interval time.Duration, onLag LagFunc) {
+	if interval <= 0 || onLag == nil {
+		c.lag = nil
+		return
+	}
+	c.lag = &lagMonitor{
+		interval: interval,
+		onLag:    onLag,
+	}
+}
+
+// GetLag computes the lag of the streaming behind the server, with a header command
+func (c *StreamClient) GetLag() (LagInfo, error) {
+	return c.GetLagContext(context.Background())
+}
+
+// GetLagContext computes the lag of the streaming behind the server, with a header command canceled with the context
+func (c *StreamClient) GetLagContext(ctx context.Context) (LagInfo, error) {
+	header, err := c.ExecCommandGetHeaderContext(ctx)
+	if err != nil {
+		return LagInfo{}, err
+	}
+	info := LagInfo{
+		Time:         time.Now(),
+		TotalEntries: header.TotalEntries,
+		NextEntry:    c.nextEntry.Load(),
+	}
+	if info.TotalEntries > info.NextEntry {
+		info.Lag = info.TotalEntries - info.NextEntry
+	}
+	return info, nil
+}
+
+// monitorLag computes periodically the lag of the streaming, calling the hook function
+func (c *StreamClient) monitorLag() {
+	for c.wait(c.lag.interval) {
+		if !c.stats.connectedNow() {
+			continue
+		}
+		info, err := c.GetLag()
+		if err != nil {
+			log.Debugf("%s Error computing the streaming lag: %v", c.ID, err)
+			continue
+		}
+		c.lag.onLag(info)
+	}
+}
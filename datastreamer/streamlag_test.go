@@ -0,0 +1,44 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientLag(t *testing.T) {
+	server, port := newTestServer(t, "lag.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 10)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	lags := make(chan datastreamer.LagInfo, 100)
+	client.SetLagMonitor(20*time.Millisecond, func(info datastreamer.LagInfo) {
+		lags <- info
+	})
+	require.NoError(t, client.Start())
+
+	// Case: Lag computed before streaming -> All the entries pending
+	info, err := client.GetLag()
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.LagInfo{Time: info.Time, TotalEntries: 10, NextEntry: 0, Lag: 10}, info)
+
+	// Case: Streaming from an entry -> Lag computed periodically up to the latest entry
+	require.NoError(t, client.ExecCommandStart(4))
+	require.Eventually(t, func() bool {
+		info := <-lags
+		return info.NextEntry == 10 && info.Lag == 0
+	}, 5*time.Second, time.Millisecond)
+
+	// Case: Entries added -> Lag computed with the new total entries
+	addTestEntries(t, server, 5)
+	require.Eventually(t, func() bool {
+		info := <-lags
+		return info.TotalEntries == 15 && info.Lag == 0
+	}, 5*time.Second, time.Millisecond)
+}
@@ -0,0 +1,78 @@
+package datastreamer
+
+import (
+	"sync"
+	"time"
+)
+
+// writeLanes type for the two delivery lanes of the frames written to a client connection: the control lane (command
+// results and responses, headers, bookmark notifications, heartbeat and lifecycle frames) and the bulk lane (data
+// entries streamed and entry ranges). A frame of the control lane waiting is written before the frames of the bulk
+// lane waiting, so it reaches the client promptly even when a catch-up saturates the link. The frames of a lane
+// written by the same goroutine keep their order
+type writeLanes struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	writing bool // Flag a frame is being written to the connection
+	control int  // Frames of the control lane waiting
+	bulk    int  // Frames of the bulk lane waiting
+}
+
+// lock waits for the turn of a frame of a lane to write to the connection
+func (l *writeLanes) lock(bulk bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.cond == nil {
+		l.cond = sync.NewCond(&l.mutex)
+	}
+	if bulk {
+		l.bulk++
+		for l.writing || l.control > 0 {
+			l.cond.Wait()
+		}
+		l.bulk--
+	} else {
+		l.control++
+		for l.writing {
+			l.cond.Wait()
+		}
+		l.control--
+	}
+	l.writing = true
+}
+
+// unlock ends the write of a frame, passing the turn to the control lane first
+func (l *writeLanes) unlock() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.writing = false
+	l.cond.Broadcast()
+}
+
+// waiting returns the frames of the control and bulk lanes waiting
+func (l *writeLanes) waiting() (int, int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.control, l.bulk
+}
+
+// timeoutWriteBulk writes a data frame of the bulk lane, prefixed with the tagged frame header (if tag is not zero)
+func timeoutWriteBulk(client *client, tag uint64, data []byte, timeout time.Duration) (int, error) {
+	if tag != 0 {
+		data = encodeTaggedFrame(tag, data)
+	}
+	return timeoutWriteLane(client, data, timeout, true)
+}
+
+// timeoutWriteRoute writes a data frame routed to a subscription (tagged if tag is not zero), in the control lane
+// for the bookmark notifications of a bookmarks watch and in the bulk lane otherwise
+func timeoutWriteRoute(client *client, tag uint64, route entryRoute, data []byte, timeout time.Duration) (int,
+	error) {
+	if _, ok := route.(*bookmarkWatch); ok {
+		return timeoutWriteTagged(client, tag, data, timeout)
+	}
+	return timeoutWriteBulk(client, tag, data, timeout)
+}
@@ -0,0 +1,372 @@
+package datastreamer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// LatestState type for the latest bookmark committed with a bookmark prefix
+type LatestState struct {
+	Prefix   []byte `json:"prefix"`   // Bookmark prefix
+	Bookmark []byte `json:"bookmark"` // Latest bookmark committed with the prefix
+	Entry    uint64 `json:"entry"`    // Entry number of the bookmark
+	Hash     []byte `json:"hash"`     // SHA-256 hash of the payload of the entry marked (nil until committed)
+}
+
+// latestView type to maintain the latest state of each bookmark prefix
+type latestView struct {
+	db       *leveldb.DB
+	prefixes [][]byte
+	states   map[string]LatestState // Latest state by bookmark prefix
+	mutex    sync.RWMutex
+}
+
+// SetLatestView sets the server to maintain a view of the latest bookmark committed with each prefix (e.g. the
+// bookmark type of the batches and the L2 blocks), its entry number and the hash of the payload of the entry marked
+// (the entry following the bookmark), updated on commit and persisted in a latest view DB (<file>.latest). It's
+// returned by GetLatestStates and the LatestStates command, so the dashboards show the latest block or batch without
+// streaming at all. No prefixes disables it (call before Start)
+func (s *StreamServer) SetLatestView(prefixes [][]byte) error {
+	if s.latest != nil {
+		err := s.latest.db.Close()
+		s.latest = nil
+		if err != nil || len(prefixes) == 0 {
+			return err
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	for _, prefix := range prefixes {
+		if len(prefix) > maxBookmarkLength {
+			log.Errorf("Bookmarks prefix length %d exceeds the maximum length %d", len(prefix), maxBookmarkLength)
+			return ErrBookmarkMaxLength
+		}
+	}
+
+	fn := s.fileName[0:strings.LastIndex(s.fileName, ".")] + ".latest"
+	log.Infof("Opening/creating latest view DB for datastream: %s", fn)
+	db, err := leveldb.OpenFile(fn, dbOptions())
+	if err != nil {
+		log.Errorf("Error opening/creating latest view DB %s: %v", fn, err)
+		return err
+	}
+	v := latestView{
+		db:       db,
+		prefixes: prefixes,
+		states:   make(map[string]LatestState, len(prefixes)),
+	}
+	err = s.loadLatest(&v)
+	if err != nil {
+		log.Errorf("Error loading latest view DB %s: %v", fn, err)
+		_ = db.Close()
+		return err
+	}
+	s.latest = &v
+	return nil
+}
+
+// SetLatestView sets the relay server side to maintain the latest view of the bookmark prefixes (call before Start)
+func (r *StreamRelay) SetLatestView(prefixes [][]byte) error {
+	return r.server.SetLatestView(prefixes)
+}
+
+// GetLatestStates returns the latest states of the bookmark prefixes starting with a prefix (empty for all of them),
+// ordered by prefix. Empty if the latest view isn't enabled or no bookmark is committed with the prefixes
+func (s *StreamServer) GetLatestStates(prefix []byte) []LatestState {
+	states := []LatestState{}
+	if s.latest == nil {
+		return states
+	}
+
+	s.latest.mutex.RLock()
+	defer s.latest.mutex.RUnlock()
+
+	for _, state := range s.latest.states {
+		if bytes.HasPrefix(state.Prefix, prefix) {
+			states = append(states, state)
+		}
+	}
+	slices.SortFunc(states, func(a, b LatestState) int {
+		return bytes.Compare(a.Prefix, b.Prefix)
+	})
+	return states
+}
+
+// encodeLatestState encodes a latest state to store it in the latest view DB
+func encodeLatestState(state LatestState) []byte {
+	value := binary.BigEndian.AppendUint64(nil, state.Entry)
+	value = append(value, uint8(len(state.Hash)))
+	value = append(value, state.Hash...)
+	return append(value, state.Bookmark...)
+}
+
+// decodeLatestState decodes a latest state stored in the latest view DB
+func decodeLatestState(prefix []byte, value []byte) (LatestState, bool) {
+	if len(value) < 9 || len(value) < 9+int(value[8]) { //nolint:mnd
+		return LatestState{}, false
+	}
+	hashEnd := 9 + int(value[8]) //nolint:mnd
+	state := LatestState{
+		Prefix:   prefix,
+		Entry:    binary.BigEndian.Uint64(value[0:8]),
+		Bookmark: value[hashEnd:],
+	}
+	if hashEnd > 9 { //nolint:mnd
+		state.Hash = value[9:hashEnd]
+	}
+	return state, true
+}
+
+// loadLatest loads the latest states stored of the prefixes, checked against the stream file. The states not stored
+// (e.g. a new prefix) or not matching the stream (e.g. truncated before a crash) are looked up from the bookmarks
+func (s *StreamServer) loadLatest(v *latestView) error {
+	total := s.streamFile.getHeaderEntry().TotalEntries
+	batch := new(leveldb.Batch)
+	for _, prefix := range v.prefixes {
+		value, err := v.db.Get(prefix, nil)
+		if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+			return err
+		}
+		state, ok := decodeLatestState(prefix, value)
+		if ok && s.isBookmarkAt(state.Bookmark, state.Entry, total) {
+			state.Hash, err = s.markedHash(state.Entry, total)
+		} else {
+			state, ok, err = s.lookupLatest(prefix, total)
+		}
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			v.states[string(prefix)] = state
+			batch.Put(prefix, encodeLatestState(state))
+		} else {
+			batch.Delete(prefix)
+		}
+	}
+	return v.db.Write(batch, nil)
+}
+
+// isBookmarkAt checks if an entry number, before the total entries, is the bookmark entry
+func (s *StreamServer) isBookmarkAt(bookmark []byte, entryNum uint64, total uint64) bool {
+	if entryNum >= total {
+		return false
+	}
+	entry, err := s.getFileEntry(entryNum)
+	return err == nil && entry.Type == EtBookmark && bytes.Equal(entry.Data, bookmark)
+}
+
+// markedHash returns the hash of the payload of the entry marked by a bookmark, the data entry following it (nil if
+// not committed yet)
+func (s *StreamServer) markedHash(entryNum uint64, total uint64) ([]byte, error) {
+	if entryNum+1 >= total {
+		return nil, nil
+	}
+	entry, err := s.GetEntry(entryNum + 1)
+	if err != nil || entry.Type == EtBookmark {
+		return nil, err
+	}
+	hash := sha256.Sum256(entry.Data)
+	return hash[:], nil
+}
+
+// lookupLatest looks up from the bookmarks the latest bookmark with a prefix before the total entries. The bookmarks
+// DB isn't truncated, so the latest one is checked against the stream file, and looked up again before it if it
+// was truncated and its entry number reused
+func (s *StreamServer) lookupLatest(prefix []byte, total uint64) (LatestState, bool, error) {
+	for limit := total; ; {
+		state := LatestState{Prefix: prefix}
+		found := false
+		iter := s.bookmark.db.NewIterator(util.BytesPrefix(prefix), nil)
+		for iter.Next() {
+			if len(iter.Value()) != 8 { //nolint:mnd
+				continue
+			}
+			entryNum := binary.BigEndian.Uint64(iter.Value())
+			if entryNum < limit && (!found || entryNum > state.Entry) {
+				state.Bookmark = append([]byte{}, iter.Key()...)
+				state.Entry = entryNum
+				found = true
+			}
+		}
+		iter.Release()
+		err := iter.Error()
+		if err != nil || !found {
+			return LatestState{}, false, err
+		}
+
+		if s.isBookmarkAt(state.Bookmark, state.Entry, total) {
+			state.Hash, err = s.markedHash(state.Entry, total)
+			return state, err == nil, err
+		}
+		limit = state.Entry
+	}
+}
+
+// updateLatest updates the latest view (if enabled) with the bookmarks and the entries marked of the committed
+// atomic operation. The stream is already updated, so an error is just logged (the DB is checked on the next load)
+func (s *StreamServer) updateLatest(entries []FileEntry) {
+	if s.latest == nil {
+		return
+	}
+
+	s.latest.mutex.Lock()
+	defer s.latest.mutex.Unlock()
+
+	updated := make(map[string]struct{})
+	for _, entry := range entries {
+		if entry.Type == EtBookmark {
+			for _, prefix := range s.latest.prefixes {
+				if bytes.HasPrefix(entry.Data, prefix) {
+					s.latest.states[string(prefix)] = LatestState{Prefix: prefix, Bookmark: entry.Data, Entry: entry.Number}
+					updated[string(prefix)] = struct{}{}
+				}
+			}
+			continue
+		}
+
+		// Entry marked by the latest bookmarks
+		for key, state := range s.latest.states {
+			if state.Entry+1 == entry.Number && state.Hash == nil {
+				hash := sha256.Sum256(entry.Data)
+				state.Hash = hash[:]
+				s.latest.states[key] = state
+				updated[key] = struct{}{}
+			}
+		}
+	}
+	if len(updated) == 0 {
+		return
+	}
+
+	batch := new(leveldb.Batch)
+	for key := range updated {
+		batch.Put([]byte(key), encodeLatestState(s.latest.states[key]))
+	}
+	err := s.latest.db.Write(batch, nil)
+	if err != nil {
+		log.Errorf("Error updating the latest view: %v", err)
+	}
+}
+
+// truncateLatest looks up again the latest states (if enabled) of the bookmarks or the entries marked truncated. The
+// stream is already truncated, so an error is just logged (the DB is checked on the next load)
+func (s *StreamServer) truncateLatest(entryNum uint64) {
+	if s.latest == nil {
+		return
+	}
+
+	s.latest.mutex.Lock()
+	defer s.latest.mutex.Unlock()
+
+	batch := new(leveldb.Batch)
+	for _, prefix := range s.latest.prefixes {
+		state, ok := s.latest.states[string(prefix)]
+		if !ok || state.Entry+1 < entryNum {
+			continue
+		}
+		state, ok, err := s.lookupLatest(prefix, entryNum)
+		if err != nil {
+			log.Errorf("Error looking up the latest state of prefix [%v]: %v", prefix, err)
+			continue
+		}
+		if ok {
+			s.latest.states[string(prefix)] = state
+			batch.Put(prefix, encodeLatestState(state))
+		} else {
+			delete(s.latest.states, string(prefix))
+			batch.Delete(prefix)
+		}
+	}
+	err := s.latest.db.Write(batch, nil)
+	if err != nil {
+		log.Errorf("Error truncating the latest view from entry %d: %v", entryNum, err)
+	}
+}
+
+// ExecCommandGetLatestStates executes client TCP command to get the latest states of the bookmark prefixes of the
+// server latest view starting with a prefix (empty for all of them)
+func (c *StreamClient) ExecCommandGetLatestStates(prefix []byte) ([]LatestState, error) {
+	return c.ExecCommandGetLatestStatesContext(context.Background(), prefix)
+}
+
+// ExecCommandGetLatestStatesContext executes client TCP command to get the latest states of the bookmark prefixes,
+// canceled with the context
+func (c *StreamClient) ExecCommandGetLatestStatesContext(ctx context.Context, prefix []byte) ([]LatestState, error) {
+	states := []LatestState{}
+	if len(prefix) > maxBookmarkLength {
+		log.Errorf("Bookmarks prefix length %d exceeds the maximum length %d", len(prefix), maxBookmarkLength)
+		return states, ErrBookmarkMaxLength
+	}
+	_, entry, err := c.execCommand(ctx, CmdLatestStates, false, 0, prefix)
+	if err != nil {
+		return states, err
+	}
+	err = json.Unmarshal(entry.Data, &states)
+	return states, err
+}
+
+// handleLatestStatesCommand processes the CmdLatestStates command
+func (s *StreamServer) handleLatestStatesCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("LatestStates command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrLatestStatesCommandNotAllowed
+	}
+
+	return s.processCmdLatestStates(cli)
+}
+
+// processCmdLatestStates processes the TCP LatestStates command from the clients
+func (s *StreamServer) processCmdLatestStates(client *client) error {
+	// Read bookmarks prefix parameter
+	prefix, err := readBookmarkParam(client)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command LatestStates prefix [%v]", client.clientID, prefix)
+
+	data, err := json.Marshal(s.GetLatestStates(prefix))
+	if err != nil {
+		log.Errorf("Error encoding latest states for %s: %v", client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the latest states as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteTagged(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending latest states to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package datastreamer_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestView(t *testing.T) {
+	port := freePort(t)
+	fileName := t.TempDir() + "/latest.bin"
+	blockPrefix, batchPrefix := []byte{2}, []byte{1}
+	newServer := func() *datastreamer.StreamServer {
+		server := openTestServer(t, port, fileName)
+		require.NoError(t, server.SetLatestView([][]byte{blockPrefix, batchPrefix}))
+		return server
+	}
+	commit := func(server *datastreamer.StreamServer, bookmark []byte, data ...[]byte) uint64 {
+		require.NoError(t, server.StartAtomicOp())
+		var entryNum uint64
+		var err error
+		if bookmark != nil {
+			entryNum, err = server.AddStreamBookmark(bookmark)
+			require.NoError(t, err)
+		}
+		for _, d := range data {
+			_, err = server.AddStreamEntry(entryType1, d)
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+		return entryNum
+	}
+	hash := func(data []byte) []byte {
+		h := sha256.Sum256(data)
+		return h[:]
+	}
+	block1, block2, block3 := []byte{2, 0, 1}, []byte{2, 0, 2}, []byte{2, 0, 3}
+
+	server := newServer()
+	require.NoError(t, server.Start())
+	require.Empty(t, server.GetLatestStates(nil))
+
+	// Case: Bookmarks committed with the entries marked -> Latest bookmark and hash of each prefix
+	batchEntry := commit(server, []byte{1, 0, 1}, []byte("batch"))
+	commit(server, block1, []byte("block1"))
+	block2Entry := commit(server, block2, []byte("block2"), []byte("tx"))
+	require.Equal(t, []datastreamer.LatestState{
+		{Prefix: batchPrefix, Bookmark: []byte{1, 0, 1}, Entry: batchEntry, Hash: hash([]byte("batch"))},
+		{Prefix: blockPrefix, Bookmark: block2, Entry: block2Entry, Hash: hash([]byte("block2"))},
+	}, server.GetLatestStates(nil))
+
+	// Case: Entry marked committed after the bookmark -> Hash once committed
+	block3Entry := commit(server, block3)
+	require.Nil(t, server.GetLatestStates(blockPrefix)[0].Hash)
+	commit(server, nil, []byte("block3"))
+	expected := datastreamer.LatestState{Prefix: blockPrefix, Bookmark: block3, Entry: block3Entry,
+		Hash: hash([]byte("block3"))}
+	require.Equal(t, []datastreamer.LatestState{expected}, server.GetLatestStates(blockPrefix))
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+	states, err := client.ExecCommandGetLatestStates(blockPrefix)
+	require.NoError(t, err)
+	require.Equal(t, []datastreamer.LatestState{expected}, states)
+
+	// Case: Latest bookmark truncated -> Previous bookmark of the prefix
+	require.NoError(t, server.TruncateFile(block3Entry))
+	expected = datastreamer.LatestState{Prefix: blockPrefix, Bookmark: block2, Entry: block2Entry,
+		Hash: hash([]byte("block2"))}
+	require.Equal(t, []datastreamer.LatestState{expected}, server.GetLatestStates(blockPrefix))
+	require.NoError(t, server.Shutdown(0))
+	require.NoError(t, server.Close())
+
+	// Case: Server restarted -> Latest view kept
+	server = newServer()
+	require.Len(t, server.GetLatestStates(nil), 2)
+	require.Equal(t, []datastreamer.LatestState{expected}, server.GetLatestStates(blockPrefix))
+}
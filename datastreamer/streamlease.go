@@ -0,0 +1,116 @@
+package datastreamer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// Lease interface for the lease coordinating an active/standby pair of relays, only the relay holding it serves the
+// clients. FileLease implements it with a file shared by the relays, other backends (e.g. an etcd lease) can be
+// plugged implementing it
+type Lease interface {
+	// Acquire acquires the lease for the holder, or renews it if already held, for the ttl duration. Returns false if
+	// the lease is held by another holder and not expired
+	Acquire(holder string, ttl time.Duration) (bool, error)
+	// Release releases the lease if held by the holder, so another holder can acquire it without waiting for its expiry
+	Release(holder string) error
+}
+
+// FileLease type for a lease stored in a file shared by the relays of the pair (same host or shared filesystem). The
+// expiry times are compared with the clock of each relay
+type FileLease struct {
+	fileName string
+}
+
+// leaseState type for the content of the lease file
+type leaseState struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewFileLease creates a lease stored in a file, its updates are serialized with a lock on the file <fileName>.lock
+func NewFileLease(fileName string) *FileLease {
+	return &FileLease{fileName: fileName}
+}
+
+// Acquire acquires the lease for the holder if it's free, expired or already held by it
+func (l *FileLease) Acquire(holder string, ttl time.Duration) (bool, error) {
+	unlock, err := l.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	state, err := l.read()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if state.Holder != "" && state.Holder != holder && now.Before(state.Expires) {
+		return false, nil
+	}
+
+	err = writeJSONFile(l.fileName, leaseState{Holder: holder, Expires: now.Add(ttl)})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release removes the lease file if the lease is held by the holder
+func (l *FileLease) Release(holder string) error {
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := l.read()
+	if err != nil || state.Holder != holder {
+		return err
+	}
+	err = os.Remove(l.fileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Holder returns the holder of the lease, empty if free or expired
+func (l *FileLease) Holder() (string, error) {
+	state, err := l.read()
+	if err != nil || time.Now().After(state.Expires) {
+		return "", err
+	}
+	return state.Holder, nil
+}
+
+// read reads the lease file, an empty state if it doesn't exist
+func (l *FileLease) read() (leaseState, error) {
+	var state leaseState
+	data, err := os.ReadFile(l.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// lock takes the exclusive lock of the lease file, released by the returned function (or if the process dies)
+func (l *FileLease) lock() (func(), error) {
+	file, err := os.OpenFile(l.fileName+".lock", os.O_RDWR|os.O_CREATE, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	err = lockFile(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() { file.Close() }, nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package datastreamer
+
+import (
+	"os"
+)
+
+// lockFile takes an exclusive lock of the file, not supported in this platform
+func lockFile(*os.File) error {
+	return ErrFileLeaseNotSupported
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package datastreamer
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock of the file, waiting for it if taken
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
@@ -0,0 +1,137 @@
+package datastreamer
+
+const lifecycleEventsSize = 16 // Capacity of the channel of the connection events pending to pass to the hooks
+
+// ConnectionEvent type for a change of the connection to the server passed to the connection lifecycle hooks
+type ConnectionEvent struct {
+	Server        string // Address of the server
+	Reconnect     bool   // Flag it's a reconnection, not the first connection since Start
+	Err           error  // Latest error of the connection closed, nil if none, e.g. stopped (OnDisconnect)
+	Streaming     bool   // Flag the streaming was resumed (OnReconnectResumed)
+	NextEntry     uint64 // Entry number the streaming was resumed from (OnReconnectResumed)
+	Subscriptions int    // Subscriptions resumed (OnReconnectResumed)
+}
+
+// ConnectionHook type of the hook function called on a change of the connection to the server
+type ConnectionHook func(event ConnectionEvent)
+
+// clientLifecycle type for the connection lifecycle hooks of a client
+type clientLifecycle struct {
+	onConnect    ConnectionHook
+	onDisconnect ConnectionHook
+	onResumed    ConnectionHook
+
+	events      chan lifecycleEvent // Events pending to pass to the hooks, in order
+	connections int                 // Connections established since Start
+	up          bool                // Flag the current connection was passed to OnConnect, pending OnDisconnect
+}
+
+// lifecycleEvent type for a connection event pending to pass to its hook
+type lifecycleEvent struct {
+	hook  ConnectionHook
+	event ConnectionEvent
+}
+
+// SetOnConnect sets the hook function called on each connection established to the server, once authenticated and
+// negotiated (the streaming and the subscriptions are resumed meanwhile). The hooks are called in order from a
+// goroutine of the client, so they can execute commands (e.g. refresh the header), and not once the client is
+// stopped (call before Start)
+func (c *StreamClient) SetOnConnect(hook ConnectionHook) {
+	c.getLifecycle().onConnect = hook
+}
+
+// SetOnDisconnect sets the hook function called when a connection established to the server is closed, with the
+// latest error of the connection (call before Start)
+func (c *StreamClient) SetOnDisconnect(hook ConnectionHook) {
+	c.getLifecycle().onDisconnect = hook
+}
+
+// SetOnReconnectResumed sets the hook function called once a reconnection resumed the streaming, from the next entry
+// to receive (its start command accepted by the server), and the subscriptions (call before Start)
+func (c *StreamClient) SetOnReconnectResumed(hook ConnectionHook) {
+	c.getLifecycle().onResumed = hook
+}
+
+// getLifecycle returns the connection lifecycle hooks, created on the first one set
+func (c *StreamClient) getLifecycle() *clientLifecycle {
+	if c.lifecycle == nil {
+		c.lifecycle = &clientLifecycle{
+			events: make(chan lifecycleEvent, lifecycleEventsSize),
+		}
+	}
+	return c.lifecycle
+}
+
+// connectionUp passes a connection established to the OnConnect hook. Returns if it's a reconnection
+func (c *StreamClient) connectionUp() bool {
+	if c.lifecycle == nil {
+		return false
+	}
+	l := c.lifecycle
+	l.up = true
+	l.connections++
+	reconnect := l.connections > 1
+	c.emitLifecycle(l.onConnect, ConnectionEvent{
+		Server:    c.serverAddr(),
+		Reconnect: reconnect,
+	})
+	return reconnect
+}
+
+// connectionDown passes a connection established closed to the OnDisconnect hook
+func (c *StreamClient) connectionDown() {
+	if c.lifecycle == nil || !c.lifecycle.up {
+		return
+	}
+	c.lifecycle.up = false
+	c.emitLifecycle(c.lifecycle.onDisconnect, ConnectionEvent{
+		Server:    c.serverAddr(),
+		Reconnect: c.lifecycle.connections > 1,
+		Err:       c.stats.connectionError(),
+	})
+}
+
+// connectionResumed passes a reconnection with the streaming and the subscriptions resumed to the
+// OnReconnectResumed hook
+func (c *StreamClient) connectionResumed(streaming bool) {
+	if c.lifecycle == nil {
+		return
+	}
+	c.mutexSubs.RLock()
+	subs := len(c.subs)
+	c.mutexSubs.RUnlock()
+
+	event := ConnectionEvent{
+		Server:        c.serverAddr(),
+		Reconnect:     true,
+		Streaming:     streaming,
+		Subscriptions: subs,
+	}
+	if streaming {
+		event.NextEntry = c.nextEntry.Load()
+	}
+	c.emitLifecycle(c.lifecycle.onResumed, event)
+}
+
+// emitLifecycle queues a connection event to pass to its hook (if set)
+func (c *StreamClient) emitLifecycle(hook ConnectionHook, event ConnectionEvent) {
+	if hook == nil {
+		return
+	}
+	select {
+	case c.lifecycle.events <- lifecycleEvent{hook: hook, event: event}:
+	case <-c.done:
+	}
+}
+
+// runLifecycleHooks passes the connection events to their hooks in order, until the client is stopped
+func (c *StreamClient) runLifecycleHooks() {
+	for {
+		select {
+		case e := <-c.lifecycle.events:
+			e.hook(e.event)
+		case <-c.done:
+			return
+		}
+	}
+}
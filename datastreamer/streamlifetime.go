@@ -0,0 +1,64 @@
+package datastreamer
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const sessionJitterDivisor = 10 // Maximum random jitter added to the session lifetimes (1/10 of the duration)
+
+// SetMaxSessionDuration sets the maximum duration of the client connections (plus a random jitter of up to 10% so the
+// clients connected together don't reconnect together). Then the client is asked to reconnect with a reconnect
+// packet and its connection closed, the clients resume the streaming and subscriptions transparently, so the
+// connections are rebalanced across a pool of relays behind a load balancer. 0 disables it (call before Start)
+func (s *StreamServer) SetMaxSessionDuration(duration time.Duration) {
+	s.maxSessionDuration = max(duration, 0)
+}
+
+// SetMaxSessionDuration sets the maximum duration of the relay client connections (see
+// StreamServer.SetMaxSessionDuration)
+func (r *StreamRelay) SetMaxSessionDuration(duration time.Duration) {
+	r.server.SetMaxSessionDuration(duration)
+}
+
+// startLifetime starts the timer of the session lifetime of a new client connection (if enabled)
+func (s *StreamServer) startLifetime(cli *client) {
+	if s.maxSessionDuration <= 0 {
+		return
+	}
+
+	jitter := rand.Int63n(int64(s.maxSessionDuration/sessionJitterDivisor) + 1) //nolint:gosec
+	lifetime := s.maxSessionDuration + time.Duration(jitter)
+	cli.mutexInfo.Lock()
+	cli.lifetime = time.AfterFunc(lifetime, func() { s.expireSession(cli) })
+	cli.mutexInfo.Unlock()
+}
+
+// stopLifetime stops the timer of the session lifetime of the client
+func (c *client) stopLifetime() {
+	c.mutexInfo.Lock()
+	defer c.mutexInfo.Unlock()
+
+	if c.lifetime != nil {
+		c.lifetime.Stop()
+		c.lifetime = nil
+	}
+}
+
+// expireSession asks the client to reconnect once its session lifetime is reached, and closes its connection
+func (s *StreamServer) expireSession(cli *client) {
+	if s.isShuttingDown() || s.getSafeClient(cli.clientID) != cli {
+		return
+	}
+
+	log.Infof("Session lifetime reached for %s, asking it to reconnect", cli.clientID)
+	if cli.conn != nil {
+		_, err := TimeoutWrite(cli, []byte{PtReconnect}, s.writeTimeout)
+		if err != nil {
+			log.Debugf("Error sending reconnect to %s: %v", cli.clientID, err)
+		}
+	}
+	s.killClient(cli.clientID)
+}
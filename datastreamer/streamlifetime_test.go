@@ -0,0 +1,56 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMaxSession(t *testing.T) {
+	server, port := newTestServer(t, "session.bin")
+	server.SetMaxSessionDuration(300 * time.Millisecond)
+	server.SetLiveQueues(16) // As the relays of a pool
+	require.NoError(t, server.Start())
+
+	addTestEntries(t, server, 10)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	var mutex sync.Mutex
+	received := []uint64{}
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		mutex.Lock()
+		received = append(received, e.Number)
+		mutex.Unlock()
+		return nil
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+
+	// Case: Session lifetime reached -> client asked to reconnect, streaming resumed
+	require.Eventually(t, func() bool {
+		reconnects := client.GetStats().Reconnects
+		return len(reconnects) > 0 && reconnects[0].Reason == "read: "+datastreamer.ErrSessionExpired.Error()
+	}, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond) // Streaming restored
+	require.Equal(t, uint64(10), server.GetHeader().TotalEntries)
+	addTestEntries(t, server, 10)
+
+	// Case: Entries added after the reconnection -> all entries in order once
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 20
+	}, 2*time.Second, 10*time.Millisecond)
+	mutex.Lock()
+	for i, number := range received {
+		require.Equal(t, uint64(i), number)
+	}
+	mutex.Unlock()
+	require.True(t, client.GetStats().Connected)
+}
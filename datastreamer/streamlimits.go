@@ -0,0 +1,35 @@
+package datastreamer
+
+// Limits type for the limits of the protocol enforced by the server
+type Limits struct {
+	MaxConnections       int `json:"maxConnections"`       // Maximum number of connected clients
+	MaxSubscriptions     int `json:"maxSubscriptions"`     // Maximum tagged subscriptions per client connection
+	MaxBookmarkLength    int `json:"maxBookmarkLength"`    // Maximum bytes of a bookmark
+	MaxCredentialsLength int `json:"maxCredentialsLength"` // Maximum bytes of the credentials of the Auth command
+	MaxGroupNameLength   int `json:"maxGroupNameLength"`   // Maximum bytes of a consumer group name
+	MaxPositionKeyLength int `json:"maxPositionKeyLength"` // Maximum bytes of the key of a client position
+	MaxEntryTypes        int `json:"maxEntryTypes"`        // Maximum entry types of the EntryTypes command
+	MaxEntryRangeCount   int `json:"maxEntryRangeCount"`   // Maximum entries of an EntryRange response
+	MaxEntryRangeSize    int `json:"maxEntryRangeSize"`    // Maximum bytes of the entries of an EntryRange response
+	MaxHeaderChanges     int `json:"maxHeaderChanges"`     // Maximum header changes of a HeaderChanges response
+	MaxCustomFrameSize   int `json:"maxCustomFrameSize"`   // Maximum payload bytes of a custom frame
+	MinCompressedData    int `json:"minCompressedData"`    // Minimum data bytes of an entry streamed compressed
+}
+
+// GetLimits returns the limits of the protocol enforced by this server implementation
+func GetLimits() Limits {
+	return Limits{
+		MaxConnections:       maxConnections,
+		MaxSubscriptions:     maxSubscriptions,
+		MaxBookmarkLength:    maxBookmarkLength,
+		MaxCredentialsLength: maxCredentialsLength,
+		MaxGroupNameLength:   maxGroupNameLength,
+		MaxPositionKeyLength: maxPositionKeyLength,
+		MaxEntryTypes:        maxEntryTypes,
+		MaxEntryRangeCount:   maxEntryRangeCount,
+		MaxEntryRangeSize:    maxEntryRangeSize,
+		MaxHeaderChanges:     maxHeaderChangesPerCommand,
+		MaxCustomFrameSize:   maxCustomFrameSize,
+		MinCompressedData:    minCompressedData,
+	}
+}
@@ -0,0 +1,223 @@
+package datastreamer
+
+import (
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const defaultRelayLiveQueue = 4096 // Default size of the live queues of the relay clients (with the reference memory)
+
+// liveQueue type for the queue of the live entries of a streaming client, sent by its own goroutine. A client whose
+// queue overflows, or catching up, is served from the stream file until it reaches the live entries again
+type liveQueue struct {
+	entries chan FileEntry // Live entries pending to send
+
+	mutex   sync.Mutex
+	lagging bool   // Flag the client is served from the stream file
+	from    uint64 // First entry number to queue once live (the previous ones are sent from the file)
+
+	next   uint64        // Next entry number to send (only used by the sending goroutine)
+	wake   chan struct{} // Signal the queue overflowed
+	done   chan struct{} // Closed once the streaming is stopped
+	exited chan struct{} // Closed once the sending goroutine has exited
+	once   sync.Once
+}
+
+// SetLiveQueues sets the server to send the live entries to each streaming client from its own queue of the given
+// size (entries), instead of writing them to every client from the broadcast. The catch-ups are served from the
+// stream file by the client goroutine, and a client falling behind its queue is served again from the file, so the
+// slow and stale clients don't delay the live entries to the rest. Applies to the streaming started with untagged
+// commands, 0 disables it. Enabled by default in the relay, sized from the memory (call before Start)
+func (s *StreamServer) SetLiveQueues(size int) {
+	s.liveQueueSize = max(size, 0)
+}
+
+// SetLiveQueues sets the size of the live queues of the relay clients (see StreamServer.SetLiveQueues)
+func (r *StreamRelay) SetLiveQueues(size int) {
+	r.server.SetLiveQueues(size)
+}
+
+// liveEnabled checks if the streaming of the command in process is sent from a live queue
+func (s *StreamServer) liveEnabled(cli *client) bool {
+	return s.liveQueueSize > 0 && cli.cmdTag == 0
+}
+
+// startLive starts sending the streaming to the client from an entry number, catching up from the stream file
+func (s *StreamServer) startLive(cli *client, fromEntry uint64) {
+	q := &liveQueue{
+		entries: make(chan FileEntry, s.liveQueueSize),
+		lagging: true,
+		next:    fromEntry,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+
+	cli.mutexInfo.Lock()
+	cli.live = q
+	cli.mutexInfo.Unlock()
+
+	s.spawn(subsysLive, func() { s.sendLive(cli, q) })
+}
+
+// stopLive stops sending the streaming to the client, waiting for the sending goroutine
+func (s *StreamServer) stopLive(cli *client) {
+	cli.mutexInfo.Lock()
+	q := cli.live
+	cli.live = nil
+	cli.mutexInfo.Unlock()
+
+	if q != nil {
+		q.stop()
+		<-q.exited
+	}
+}
+
+// getLive returns the live queue of the client (nil if not streaming from a live queue)
+func (c *client) getLive() *liveQueue {
+	c.mutexInfo.Lock()
+	defer c.mutexInfo.Unlock()
+
+	return c.live
+}
+
+// stop signals the sending goroutine to exit
+func (q *liveQueue) stop() {
+	q.once.Do(func() { close(q.done) })
+}
+
+// push queues the live entries of a broadcast, flags the client as lagging if the queue is full
+func (q *liveQueue) push(entries []FileEntry) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.lagging {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Number < q.from {
+			continue
+		}
+		select {
+		case q.entries <- entry:
+		default:
+			q.lagging = true
+			select {
+			case q.wake <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// isLagging checks if the client is served from the stream file
+func (q *liveQueue) isLagging() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.lagging
+}
+
+// isPending checks if there are entries pending to send to the client
+func (q *liveQueue) isPending() bool {
+	return q.isLagging() || len(q.entries) > 0
+}
+
+// sendLive sends the streaming to the client, from the stream file while lagging and from the live queue after
+func (s *StreamServer) sendLive(cli *client, q *liveQueue) {
+	defer close(q.exited)
+
+	for {
+		// Catch-up from the stream file
+		if q.isLagging() {
+			err := s.catchUpLive(cli, q)
+			if err != nil {
+				log.Errorf("Error catching up %s from entry %d: %v", cli.clientID, q.next, err)
+				s.killClient(cli.clientID)
+				return
+			}
+		}
+
+		select {
+		case <-q.done:
+			return
+
+		case entry := <-q.entries:
+			err := s.sendLiveEntry(cli, q, entry)
+			if err != nil {
+				s.killClient(cli.clientID)
+				return
+			}
+
+		case <-q.wake:
+		}
+	}
+}
+
+// sendLiveEntry sends a live entry to the client (skipped if not of the entry types negotiated)
+func (s *StreamServer) sendLiveEntry(cli *client, q *liveQueue, entry FileEntry) error {
+	if !cli.wantsEntry(&entry) {
+		q.next = entry.Number + 1
+		cli.sentEntry.Store(q.next)
+		return nil
+	}
+	log.Debugf("sending data entry %d (type %d) to %s", entry.Number, entry.Type, cli.clientID)
+
+	var err error
+	if cli.conn != nil {
+		_, err = timeoutWriteBulk(cli, 0, cli.encodeEntry(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Warnf("error sending entry to %s, error: %v", cli.clientID, err)
+		return err
+	}
+	q.next = entry.Number + 1
+	cli.sentEntry.Store(q.next)
+	return nil
+}
+
+// catchUpLive sends to the lagging client the entries queued and then the stream file, until it reaches the live
+// entries pending to broadcast
+func (s *StreamServer) catchUpLive(cli *client, q *liveQueue) error {
+	// Send the entries queued before the overflow
+	for len(q.entries) > 0 {
+		err := s.sendLiveEntry(cli, q, <-q.entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-q.done:
+			return nil
+		default:
+		}
+
+		// Send the committed entries from the stream file
+		var err error
+		if q.next < s.streamFile.getHeaderEntry().TotalEntries {
+			q.next, err = s.streamingFromFile(cli, q.next, 0, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Switch to the live queue once the broadcasts done (or the whole file) are sent, the next ones are queued
+		s.mutexBroadcast.Lock()
+		if q.next >= s.broadcastNext || q.next >= s.streamFile.getHeaderEntry().TotalEntries {
+			q.mutex.Lock()
+			q.lagging = false
+			q.from = q.next
+			q.mutex.Unlock()
+			s.mutexBroadcast.Unlock()
+			log.Debugf("Client %s live from entry %d", cli.clientID, q.next)
+			return nil
+		}
+		s.mutexBroadcast.Unlock()
+	}
+}
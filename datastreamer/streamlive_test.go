@@ -0,0 +1,69 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerLiveQueues(t *testing.T) {
+	server, port := newTestServer(t, "live.bin")
+	server.SetLiveQueues(2)
+	require.NoError(t, server.Start())
+
+	addTestEntries(t, server, 30)
+
+	startClient := func(fromEntry uint64) (*datastreamer.StreamClient, func() []uint64) {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		var mutex sync.Mutex
+		received := []uint64{}
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			received = append(received, e.Number)
+			mutex.Unlock()
+			return nil
+		})
+		require.NoError(t, client.Start())
+		require.NoError(t, client.ExecCommandStart(fromEntry))
+		return client, func() []uint64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]uint64{}, received...)
+		}
+	}
+
+	// Case: Clients live and catching up while broadcasting, queues overflowed -> all entries in order once
+	clientA, receivedA := startClient(0)
+	require.Eventually(t, func() bool {
+		return len(receivedA()) == 30
+	}, 2*time.Second, 10*time.Millisecond)
+	var receivedB func() []uint64
+	for i := 0; i < 20; i++ {
+		addTestEntries(t, server, 10)
+		if i == 10 {
+			_, receivedB = startClient(5)
+		}
+	}
+	require.Eventually(t, func() bool {
+		return len(receivedA()) == 230 && len(receivedB()) == 230-5
+	}, 2*time.Second, 10*time.Millisecond)
+	for i, number := range receivedA() {
+		require.Equal(t, uint64(i), number)
+	}
+	for i, number := range receivedB() {
+		require.Equal(t, uint64(i+5), number)
+	}
+
+	// Case: Stop streaming, no more entries sent -> OK
+	require.NoError(t, clientA.ExecCommandStop())
+	addTestEntries(t, server, 1)
+	require.Never(t, func() bool {
+		return len(receivedA()) > 230
+	}, 100*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,279 @@
+package datastreamer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// ManifestFileName is the name of the manifest of the files in a support bundle
+const ManifestFileName = "manifest.json"
+
+const manifestVersion = 1 // Format version of the manifests
+
+// ManifestFile type for a file listed in a manifest
+type ManifestFile struct {
+	Name   string `json:"name"`   // Name relative to the manifest (the location of the file in a bundle)
+	Size   int64  `json:"size"`   // Size in bytes
+	SHA256 string `json:"sha256"` // SHA-256 hash of the contents (hex)
+}
+
+// Manifest type for the list of files of a backup, export or bundle, signed with the operator key (ed25519), so the
+// receiver verifies their integrity and origin before importing or restoring them
+type Manifest struct {
+	Version   int            `json:"version"`
+	Created   time.Time      `json:"created"`
+	Files     []ManifestFile `json:"files"`
+	PublicKey string         `json:"publicKey,omitempty"` // Public key of the operator signing (hex)
+	Signature string         `json:"signature,omitempty"` // Signature of the manifest without it (hex)
+}
+
+// NewManifest creates an unsigned manifest without files
+func NewManifest() *Manifest {
+	return &Manifest{Version: manifestVersion, Created: time.Now().UTC().Truncate(time.Second)}
+}
+
+// AddFile adds a file to the manifest from its contents, replacing the one with the same name
+func (m *Manifest) AddFile(name string, r io.Reader) error {
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return err
+	}
+	file := ManifestFile{Name: filepath.ToSlash(name), Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	i := slices.IndexFunc(m.Files, func(f ManifestFile) bool { return f.Name == file.Name })
+	if i >= 0 {
+		m.Files[i] = file
+	} else {
+		m.Files = append(m.Files, file)
+	}
+	m.Signature = ""
+	return nil
+}
+
+// Sign signs the manifest with the operator private key, recording its public key
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return ErrInvalidManifestKey
+	}
+	m.PublicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	m.Signature = ""
+	message, err := m.signedMessage()
+	if err != nil {
+		return err
+	}
+	m.Signature = hex.EncodeToString(ed25519.Sign(key, message))
+	return nil
+}
+
+// Verify verifies the signature of the manifest with its public key, which must be one of the trusted keys
+func (m *Manifest) Verify(trusted []ed25519.PublicKey) error {
+	publicKey, err := hex.DecodeString(m.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return ErrInvalidManifestSignature
+	}
+	trustedKey := func(k ed25519.PublicKey) bool { return k.Equal(ed25519.PublicKey(publicKey)) }
+	if !slices.ContainsFunc(trusted, trustedKey) {
+		return ErrUntrustedManifestKey
+	}
+	signature, err := hex.DecodeString(m.Signature)
+	if err != nil {
+		return ErrInvalidManifestSignature
+	}
+	message, err := m.signedMessage()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, message, signature) {
+		return ErrInvalidManifestSignature
+	}
+	return nil
+}
+
+// VerifyFile verifies the contents of a file listed in the manifest
+func (m *Manifest) VerifyFile(name string, r io.Reader) error {
+	i := slices.IndexFunc(m.Files, func(f ManifestFile) bool { return f.Name == filepath.ToSlash(name) })
+	if i < 0 {
+		log.Errorf("File %s not listed in the manifest", name)
+		return ErrManifestFileMismatch
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return err
+	}
+	if size != m.Files[i].Size || hex.EncodeToString(hash.Sum(nil)) != m.Files[i].SHA256 {
+		log.Errorf("File %s not matching the manifest (size %d, expected %d)", name, size, m.Files[i].Size)
+		return ErrManifestFileMismatch
+	}
+	return nil
+}
+
+// signedMessage returns the contents of the manifest covered by the signature (all but the signature)
+func (m *Manifest) signedMessage() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	return json.Marshal(unsigned)
+}
+
+// WriteFilesManifest writes the manifest of the files signed with the operator key, e.g. of a stream file with its
+// databases directory copied for a backup. The directories are listed with all their files, and the files are listed
+// by their path relative to the directory of the manifest (they must be in it), so the manifest is copied with them
+func WriteFilesManifest(fileName string, paths []string, key ed25519.PrivateKey) error {
+	m := NewManifest()
+	dir := filepath.Dir(fileName)
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			name, err := filepath.Rel(dir, file)
+			if err != nil || !filepath.IsLocal(name) {
+				return ErrManifestFileMismatch
+			}
+			return addManifestFile(m, name, file)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err := m.Sign(key)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(content, '\n'), 0644) //nolint:gosec
+}
+
+// WriteStreamManifest writes the manifest of a stream file and its bookmarks DB (<file>.db) signed with the operator
+// key next to them (<file>.manifest.json), e.g. of the outputs of SplitStream and MergeStreams distributed to the
+// partners. Returns the file name of the manifest
+func WriteStreamManifest(fileName string, key ed25519.PrivateKey) (string, error) {
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	paths := []string{fileName}
+	if _, err := os.Stat(base + ".db"); err == nil {
+		paths = append(paths, base+".db")
+	}
+	manifest := base + ".manifest.json"
+	return manifest, WriteFilesManifest(manifest, paths, key)
+}
+
+// VerifyFilesManifest verifies the signature of a manifest with the trusted keys, and the files listed in the
+// directory of the manifest, before importing or restoring them. Returns the manifest verified
+func VerifyFilesManifest(fileName string, trusted []ed25519.PublicKey) (*Manifest, error) {
+	m, err := ReadManifest(fileName)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Verify(trusted)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range m.Files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Name)) {
+			return nil, ErrManifestFileMismatch
+		}
+		f, err := os.Open(filepath.Join(filepath.Dir(fileName), filepath.FromSlash(file.Name)))
+		if err != nil {
+			return nil, err
+		}
+		err = m.VerifyFile(file.Name, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ReadManifest reads a manifest from a file, without verifying it
+func ReadManifest(fileName string) (*Manifest, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(content)
+}
+
+// ParseManifest parses the contents of a manifest, without verifying it
+func ParseManifest(content []byte) (*Manifest, error) {
+	m := &Manifest{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(m)
+	if err != nil || m.Version != manifestVersion {
+		return nil, ErrInvalidManifest
+	}
+	return m, nil
+}
+
+// addManifestFile adds a file to a manifest from the file system
+func addManifestFile(m *Manifest, name string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.AddFile(name, f)
+}
+
+// LoadSigningKey reads the operator key signing the manifests from a file: the ed25519 seed (32 bytes) or private
+// key (64 bytes) hex encoded
+func LoadSigningKey(fileName string) (ed25519.PrivateKey, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(content)), "0x"))
+	if err != nil {
+		return nil, ErrInvalidManifestKey
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, ErrInvalidManifestKey
+	}
+}
+
+// LoadTrustedKeys reads the public keys of the operators trusted to sign the manifests from a file, hex encoded one
+// per line (the empty lines and the ones starting with # are skipped)
+func LoadTrustedKeys(fileName string) ([]ed25519.PublicKey, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	keys := []ed25519.PublicKey{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := hex.DecodeString(strings.TrimPrefix(line, "0x"))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, ErrInvalidManifestKey
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, ErrInvalidManifestKey
+	}
+	return keys, nil
+}
@@ -0,0 +1,97 @@
+package datastreamer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestSigning(t *testing.T) {
+	dir := t.TempDir()
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	keyFile := filepath.Join(dir, "operator.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(hex.EncodeToString(seed)+"\n"), 0600))
+	key, err := LoadSigningKey(keyFile)
+	require.NoError(t, err)
+	publicKey := key.Public().(ed25519.PublicKey)
+	trustedFile := filepath.Join(dir, "trusted.keys")
+	require.NoError(t, os.WriteFile(trustedFile, []byte("# partner operators\n\n0x"+hex.EncodeToString(publicKey)+
+		"\n"), 0600))
+	trusted, err := LoadTrustedKeys(trustedFile)
+	require.NoError(t, err)
+	require.Len(t, trusted, 1)
+
+	// Case: Invalid keys -> FAIL
+	require.NoError(t, os.WriteFile(keyFile, []byte("0102"), 0600))
+	_, err = LoadSigningKey(keyFile)
+	require.ErrorIs(t, err, ErrInvalidManifestKey)
+	_, err = LoadTrustedKeys(keyFile)
+	require.ErrorIs(t, err, ErrInvalidManifestKey)
+
+	// Stream file with its databases directory
+	backup := filepath.Join(dir, "backup")
+	require.NoError(t, os.MkdirAll(filepath.Join(backup, "stream.db"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(backup, "stream.bin"), []byte("stream file"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(backup, "stream.db", "000001.log"), []byte("bookmarks"), 0600))
+	manifestFile := filepath.Join(backup, ManifestFileName)
+
+	// Case: Files signed and verified -> OK, the directories listed with their files
+	require.NoError(t, WriteFilesManifest(manifestFile, []string{filepath.Join(backup, "stream.bin"),
+		filepath.Join(backup, "stream.db")}, key))
+	m, err := VerifyFilesManifest(manifestFile, trusted)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+	assert.Equal(t, "stream.bin", m.Files[0].Name)
+	assert.Equal(t, "stream.db/000001.log", m.Files[1].Name)
+	assert.Equal(t, hex.EncodeToString(publicKey), m.PublicKey)
+
+	// Case: Stream file signed -> Manifest next to it, with its bookmarks DB
+	streamManifest, err := WriteStreamManifest(filepath.Join(backup, "stream.bin"), key)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(backup, "stream.manifest.json"), streamManifest)
+	m, err = VerifyFilesManifest(streamManifest, trusted)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+	assert.Equal(t, "stream.db/000001.log", m.Files[1].Name)
+
+	// Case: File out of the manifest directory -> FAIL
+	err = WriteFilesManifest(manifestFile, []string{keyFile}, key)
+	require.ErrorIs(t, err, ErrManifestFileMismatch)
+
+	// Case: File modified -> FAIL
+	require.NoError(t, os.WriteFile(filepath.Join(backup, "stream.bin"), []byte("stream fil3"), 0600))
+	_, err = VerifyFilesManifest(manifestFile, trusted)
+	require.ErrorIs(t, err, ErrManifestFileMismatch)
+
+	// Case: Manifest modified -> Signature not valid
+	m.Files[0].Size++
+	require.ErrorIs(t, m.Verify(trusted), ErrInvalidManifestSignature)
+	m.Files[0].Size--
+	require.NoError(t, m.Verify(trusted))
+
+	// Case: Signed with a key not trusted -> FAIL
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{8}, ed25519.SeedSize))
+	require.NoError(t, m.Sign(other))
+	require.ErrorIs(t, m.Verify(trusted), ErrUntrustedManifestKey)
+
+	// Case: Manifest in a bundle -> Entries verified from their contents
+	bundle := NewManifest()
+	require.NoError(t, bundle.AddFile("server.json", bytes.NewReader([]byte("{}"))))
+	require.NoError(t, bundle.Sign(key))
+	require.NoError(t, bundle.Verify(trusted))
+	require.NoError(t, bundle.VerifyFile("server.json", bytes.NewReader([]byte("{}"))))
+	require.ErrorIs(t, bundle.VerifyFile("server.json", bytes.NewReader([]byte("[]"))), ErrManifestFileMismatch)
+	require.ErrorIs(t, bundle.VerifyFile("other.json", bytes.NewReader([]byte("{}"))), ErrManifestFileMismatch)
+
+	// Case: Unknown version or fields -> FAIL
+	_, err = ParseManifest([]byte(`{"version":2}`))
+	require.ErrorIs(t, err, ErrInvalidManifest)
+	_, err = ParseManifest([]byte(`{"version":1,"unknown":true}`))
+	require.ErrorIs(t, err, ErrInvalidManifest)
+}
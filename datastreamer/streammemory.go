@@ -0,0 +1,167 @@
+package datastreamer
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+const (
+	referenceMemory = 4 << 30 // Memory the default buffer sizes are tuned for (4 GB)
+	maxBufferScale  = 8       // Maximum scale of the buffer sizes, up or down, from the default ones
+)
+
+var (
+	// defaultBufferSizes for the buffer sizes with the reference memory
+	defaultBufferSizes = BufferSizes{
+		StreamBuffer:   streamBuffer,
+		ClientEntries:  entriesBuffer,
+		RelayLiveQueue: defaultRelayLiveQueue,
+		DBCache:        opt.DefaultBlockCacheCapacity,
+	}
+
+	bufferOverrides BufferSizes // Buffer sizes set by SetBufferSizes (0 fields tuned from the memory)
+	memoryOverride  uint64      // Memory set by SetBufferMemory (0 detected)
+	mutexBuffers    sync.Mutex  // Mutex for access to the buffer sizes settings
+
+	detectOnce     sync.Once
+	detectedMemory uint64 // Memory available detected (0 unknown)
+)
+
+// BufferSizes type for the sizes of the internal buffers, tuned from the memory available
+type BufferSizes struct {
+	StreamBuffer   int `json:"streamBuffer"`   // Committed atomic operations pending to broadcast (server)
+	ClientEntries  int `json:"clientEntries"`  // Entries received pending to process (client and subscriptions)
+	RelayLiveQueue int `json:"relayLiveQueue"` // Live queue of each relay client (entries)
+	DBCache        int `json:"dbCache"`        // Block cache of each database: bookmarks, content, checkpoints (bytes)
+}
+
+// SetBufferMemory sets the memory (bytes) to tune the internal buffer sizes of the servers, relays and clients
+// created after the call, 0 detects it from the cgroup limits, the Go memory limit and the physical memory
+func SetBufferMemory(memory uint64) {
+	mutexBuffers.Lock()
+	defer mutexBuffers.Unlock()
+
+	memoryOverride = memory
+}
+
+// SetBufferSizes overrides the internal buffer sizes of the servers, relays and clients created after the call, the
+// sizes not set (0) are tuned from the memory
+func SetBufferSizes(sizes BufferSizes) {
+	mutexBuffers.Lock()
+	defer mutexBuffers.Unlock()
+
+	bufferOverrides = sizes
+}
+
+// GetBufferSizes returns the internal buffer sizes: the defaults scaled with the memory available (relative to
+// 4 GB, from 1/8 to 8 times), with the overrides set
+func GetBufferSizes() BufferSizes {
+	mutexBuffers.Lock()
+	memory, overrides := memoryOverride, bufferOverrides
+	mutexBuffers.Unlock()
+
+	if memory == 0 {
+		detectOnce.Do(func() {
+			detectedMemory = detectMemory()
+			if detectedMemory > 0 {
+				log.Infof("Memory available to size the buffers: %d MB", detectedMemory>>20) //nolint:mnd
+			}
+		})
+		memory = detectedMemory
+	}
+
+	sizes := defaultBufferSizes
+	if memory > 0 {
+		sizes = BufferSizes{
+			StreamBuffer:   scaleBuffer(defaultBufferSizes.StreamBuffer, memory),
+			ClientEntries:  scaleBuffer(defaultBufferSizes.ClientEntries, memory),
+			RelayLiveQueue: scaleBuffer(defaultBufferSizes.RelayLiveQueue, memory),
+			DBCache:        scaleBuffer(defaultBufferSizes.DBCache, memory),
+		}
+	}
+
+	if overrides.StreamBuffer > 0 {
+		sizes.StreamBuffer = overrides.StreamBuffer
+	}
+	if overrides.ClientEntries > 0 {
+		sizes.ClientEntries = overrides.ClientEntries
+	}
+	if overrides.RelayLiveQueue > 0 {
+		sizes.RelayLiveQueue = overrides.RelayLiveQueue
+	}
+	if overrides.DBCache > 0 {
+		sizes.DBCache = overrides.DBCache
+	}
+	return sizes
+}
+
+// scaleBuffer scales a default buffer size with the memory available
+func scaleBuffer(size int, memory uint64) int {
+	scaled := uint64(size) * min(memory, referenceMemory*maxBufferScale) / referenceMemory
+	return max(int(scaled), size/maxBufferScale, 1)
+}
+
+// dbOptions returns the options of the databases, with the block cache sized from the memory
+func dbOptions() *opt.Options {
+	return &opt.Options{BlockCacheCapacity: GetBufferSizes().DBCache}
+}
+
+// detectMemory returns the memory available to the process: the lowest of the cgroup limit (v2 or v1), the Go
+// memory limit and the physical memory (0 unknown)
+func detectMemory() uint64 {
+	var memory uint64 = math.MaxUint64
+
+	for _, fileName := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err == nil && limit > 0 {
+			memory = min(memory, limit)
+		}
+	}
+
+	if limit := debug.SetMemoryLimit(-1); limit > 0 && limit < math.MaxInt64 {
+		memory = min(memory, uint64(limit))
+	}
+
+	if total := physicalMemory(); total > 0 {
+		memory = min(memory, total)
+	}
+
+	if memory == math.MaxUint64 {
+		return 0
+	}
+	return memory
+}
+
+// physicalMemory returns the physical memory from /proc/meminfo (0 unknown)
+func physicalMemory() uint64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			total, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return total << 10 //nolint:mnd
+		}
+	}
+	return 0
+}
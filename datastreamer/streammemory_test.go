@@ -0,0 +1,59 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferSizes(t *testing.T) {
+	defer datastreamer.SetBufferMemory(0)
+	defer datastreamer.SetBufferSizes(datastreamer.BufferSizes{})
+
+	// Case: Memory detected -> buffer sizes tuned
+	sizes := datastreamer.GetBufferSizes()
+	require.Positive(t, sizes.StreamBuffer)
+	require.Positive(t, sizes.ClientEntries)
+	require.Positive(t, sizes.RelayLiveQueue)
+	require.Positive(t, sizes.DBCache)
+
+	// Case: Reference memory (4 GB) -> default sizes
+	datastreamer.SetBufferMemory(4 << 30)
+	require.Equal(t, datastreamer.BufferSizes{
+		StreamBuffer:   256,
+		ClientEntries:  128,
+		RelayLiveQueue: 4096,
+		DBCache:        8 << 20,
+	}, datastreamer.GetBufferSizes())
+
+	// Case: Small sidecar (512 MB) -> sizes scaled down
+	datastreamer.SetBufferMemory(512 << 20)
+	require.Equal(t, datastreamer.BufferSizes{
+		StreamBuffer:   32,
+		ClientEntries:  16,
+		RelayLiveQueue: 512,
+		DBCache:        1 << 20,
+	}, datastreamer.GetBufferSizes())
+
+	// Case: Tiny and huge memory -> sizes scaled up to 8 times
+	datastreamer.SetBufferMemory(1 << 20)
+	require.Equal(t, 16, datastreamer.GetBufferSizes().ClientEntries)
+	datastreamer.SetBufferMemory(1 << 40)
+	require.Equal(t, 1024, datastreamer.GetBufferSizes().ClientEntries)
+
+	// Case: Overrides -> overridden sizes, the rest tuned
+	datastreamer.SetBufferSizes(datastreamer.BufferSizes{ClientEntries: 10, DBCache: 1 << 10})
+	require.Equal(t, datastreamer.BufferSizes{
+		StreamBuffer:   2048,
+		ClientEntries:  10,
+		RelayLiveQueue: 32768,
+		DBCache:        1 << 10,
+	}, datastreamer.GetBufferSizes())
+
+	// Case: Client created -> entries channel sized
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", freePort(t)), streamType)
+	require.NoError(t, err)
+	require.Equal(t, 10, client.GetStats().QueueCapacity)
+}
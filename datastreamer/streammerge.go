@@ -0,0 +1,212 @@
+package datastreamer
+
+import (
+	"errors"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// MergeKeyFunc returns the ordering key of a data entry of a merge (e.g. the timestamp of an L2 block), and if the
+// entry has one (e.g. false for the transactions of an L2 block, ordered with their block)
+type MergeKeyFunc func(e *FileEntry) (uint64, bool)
+
+// MergeResult type for the entries written to the output stream of a merge
+type MergeResult struct {
+	FileName   string   `json:"fileName"`   // Stream file of the output
+	Entries    uint64   `json:"entries"`    // Data entries written (bookmarks not included)
+	Bookmarks  uint64   `json:"bookmarks"`  // Bookmarks written
+	Duplicates uint64   `json:"duplicates"` // Bookmarks already written by an input, marking the latest entry
+	Inputs     []uint64 `json:"inputs"`     // Entries written of each input (bookmarks included)
+}
+
+// mergeInput type for an input stream of a merge, read by groups of entries ordered together
+type mergeInput struct {
+	file     *StreamFile
+	content  *StreamContent
+	iterator *iteratorFile
+	key      MergeKeyFunc
+
+	group    []FileEntry // Next group of entries to write, empty at the end of the input
+	groupKey uint64      // Ordering key of the next group, inherited from the previous group if it has none
+	keyed    bool        // Flag the next group has an entry with a key
+	next     *FileEntry  // Entry read starting the group after the next one
+}
+
+// MergeStreams merges stream files (not opened by a server) into a single output stream file, new or empty, to
+// consolidate the histories of several devnets or rollups. The entries are renumbered from 0 and the bookmarks
+// rewritten to their new entry numbers. With a key function, the inputs are merged by groups of entries in order of
+// their keys, or in order of the inputs for the same key: a group starts at a bookmark (with the bookmarks following
+// it) or at an entry with a key if the group already has one, and the entries without a key are kept with their
+// group, so the bookmarks and the entries of an L2 block stay together ordering by the timestamp of the block.
+// Without key function, the inputs are concatenated in order. The order of the entries of each input is kept. The
+// payloads of an input stored content-addressed (<file>.cas) are resolved. The output keeps the version and the
+// system ID of the first input
+func MergeStreams(fileNames []string, streamType StreamType, output string, key MergeKeyFunc) (MergeResult, error) {
+	if len(fileNames) == 0 {
+		return MergeResult{}, ErrMergeWithoutInputs
+	}
+
+	// Open the input streams
+	inputs := make([]*mergeInput, 0, len(fileNames))
+	defer func() {
+		for _, in := range inputs {
+			in.close()
+		}
+	}()
+	for _, fileName := range fileNames {
+		in, err := newMergeInput(fileName, streamType, key)
+		if err != nil {
+			return MergeResult{}, err
+		}
+		inputs = append(inputs, in)
+	}
+
+	// Open the output stream
+	w, err := newSplitWriter(SplitOutput{FileName: output}, inputs[0].file.getHeaderEntry(), streamType)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	defer func() { _ = w.close() }()
+	w.all = true
+	result := MergeResult{
+		FileName: output,
+		Inputs:   make([]uint64, len(inputs)),
+	}
+
+	// Write the group of the lowest key until the end of all the inputs
+	for {
+		var first *mergeInput
+		index := 0
+		for i, in := range inputs {
+			if len(in.group) > 0 && (first == nil || in.groupKey < first.groupKey) {
+				first, index = in, i
+			}
+		}
+		if first == nil {
+			break
+		}
+		for _, e := range first.group {
+			if e.Type == EtBookmark {
+				_, err = w.bookmark.GetBookmark(e.Data)
+				if err == nil {
+					result.Duplicates++
+				} else if !errors.Is(err, leveldb.ErrNotFound) {
+					return MergeResult{}, err
+				}
+			}
+			err = w.write(e)
+			if err != nil {
+				log.Errorf("Error writing entry %d of merge input %s: %v", e.Number, fileNames[index], err)
+				return MergeResult{}, err
+			}
+		}
+		result.Inputs[index] += uint64(len(first.group))
+		err = first.readGroup()
+		if err != nil {
+			return MergeResult{}, err
+		}
+	}
+
+	// Commit the output
+	err = w.file.writeHeaderEntry()
+	if err != nil {
+		return MergeResult{}, err
+	}
+	result.Entries, result.Bookmarks = w.result.Entries, w.result.Bookmarks
+	log.Infof("Merge stream %s: %d entries, %d bookmarks (%d duplicated)", output, result.Entries, result.Bookmarks,
+		result.Duplicates)
+	return result, nil
+}
+
+// newMergeInput opens an input stream of a merge and reads its first group of entries
+func newMergeInput(fileName string, streamType StreamType, key MergeKeyFunc) (*mergeInput, error) {
+	file, content, err := openSourceStream(fileName, streamType)
+	if err != nil {
+		return nil, err
+	}
+	in := &mergeInput{
+		file:    file,
+		content: content,
+		key:     key,
+	}
+	header := file.getHeaderEntry()
+	if header.TotalEntries > header.BaseEntry {
+		in.iterator, err = file.iteratorFrom(header.BaseEntry, true)
+		if err != nil {
+			in.close()
+			return nil, err
+		}
+	}
+	err = in.readGroup()
+	if err != nil {
+		in.close()
+		return nil, err
+	}
+	return in, nil
+}
+
+// readGroup reads the next group of entries of the input to write, an entry per group without key function
+func (in *mergeInput) readGroup() error {
+	in.group = in.group[:0]
+	in.keyed = false
+	if in.next != nil {
+		key, ok := in.entryKey(in.next)
+		in.add(*in.next, key, ok)
+		in.next = nil
+	}
+	for in.iterator != nil {
+		end, err := in.file.iteratorNext(in.iterator)
+		if err != nil {
+			return err
+		}
+		if end {
+			in.file.iteratorEnd(in.iterator)
+			in.iterator = nil
+			break
+		}
+		e := in.iterator.Entry
+		err = in.content.resolve(&e)
+		if err != nil {
+			return err
+		}
+
+		// Start the next group at a bookmark or at an entry with a key
+		key, ok := in.entryKey(&e)
+		if len(in.group) > 0 {
+			last := in.group[len(in.group)-1]
+			if in.key == nil || (e.Type == EtBookmark && last.Type != EtBookmark) || (in.keyed && ok) {
+				in.next = &e
+				return nil
+			}
+		}
+		in.add(e, key, ok)
+	}
+	return nil
+}
+
+// add adds an entry to the next group, setting the key of the group if it's the first entry with a key
+func (in *mergeInput) add(e FileEntry, key uint64, ok bool) {
+	in.group = append(in.group, e)
+	if ok && !in.keyed {
+		in.groupKey = key
+		in.keyed = true
+	}
+}
+
+// entryKey returns the ordering key of a data entry (none for the bookmarks)
+func (in *mergeInput) entryKey(e *FileEntry) (uint64, bool) {
+	if in.key == nil || e.Type == EtBookmark {
+		return 0, false
+	}
+	return in.key(e)
+}
+
+// close closes the input stream file
+func (in *mergeInput) close() {
+	if in.iterator != nil {
+		in.file.iteratorEnd(in.iterator)
+		in.iterator = nil
+	}
+	closeSourceStream(in.file, in.content)
+}
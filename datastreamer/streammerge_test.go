@@ -0,0 +1,95 @@
+package datastreamer_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeStreams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow integration test, skipped in short mode")
+	}
+	port := freePort(t)
+	dir := t.TempDir()
+	// Input streams of L2 blocks (bookmark, block with its timestamp and a transaction) and a shared bookmark
+	newInput := func(fileName string, timestamps ...uint64) {
+		server := openTestServer(t, port, fileName)
+		require.NoError(t, server.Start())
+		require.NoError(t, server.StartAtomicOp())
+		_, err := server.AddStreamBookmark([]byte{0})
+		require.NoError(t, err)
+		for _, timestamp := range timestamps {
+			_, err = server.AddStreamBookmark(binary.BigEndian.AppendUint64([]byte{1}, timestamp))
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType1, binary.BigEndian.AppendUint64(nil, timestamp))
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType2, []byte{byte(timestamp)})
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+		require.NoError(t, server.Shutdown(0))
+		require.NoError(t, server.Close())
+	}
+	newInput(dir+"/rollup1.bin", 10, 30)
+	newInput(dir+"/rollup2.bin", 20, 40)
+	inputs := []string{dir + "/rollup1.bin", dir + "/rollup2.bin"}
+	timestamp := func(e *datastreamer.FileEntry) (uint64, bool) {
+		if e.Type != entryType1 {
+			return 0, false
+		}
+		return binary.BigEndian.Uint64(e.Data), true
+	}
+	requireMerged := func(fileName string, timestamps ...uint64) {
+		merged := openTestServer(t, port, fileName)
+		defer func() { _ = merged.Close() }()
+		for _, ts := range timestamps {
+			entry, err := merged.GetFirstEventAfterBookmark(binary.BigEndian.AppendUint64([]byte{1}, ts))
+			require.NoError(t, err)
+			require.Equal(t, binary.BigEndian.AppendUint64(nil, ts), entry.Data)
+			entry, err = merged.GetEntry(entry.Number + 1)
+			require.NoError(t, err)
+			require.Equal(t, []byte{byte(ts)}, entry.Data)
+		}
+	}
+
+	// Case: Merge by timestamp -> Blocks interleaved in timestamp order with their bookmarks and transactions
+	result, err := datastreamer.MergeStreams(inputs, streamType, dir+"/merged.bin", timestamp)
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.MergeResult{
+		FileName:   dir + "/merged.bin",
+		Entries:    8,
+		Bookmarks:  6,
+		Duplicates: 1,
+		Inputs:     []uint64{7, 7},
+	}, result)
+	requireMerged(dir+"/merged.bin", 10, 20, 30, 40)
+	merged := openTestServer(t, port, dir+"/merged.bin")
+	for entryNum, ts := range map[uint64]uint64{2: 10, 6: 20, 9: 30, 12: 40} {
+		entry, err := merged.GetEntry(entryNum)
+		require.NoError(t, err)
+		require.Equal(t, binary.BigEndian.AppendUint64(nil, ts), entry.Data)
+	}
+	require.NoError(t, merged.Close())
+
+	// Case: Merge without key function -> Inputs concatenated in order
+	result, err = datastreamer.MergeStreams(inputs, streamType, dir+"/concat.bin", nil)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{7, 7}, result.Inputs)
+	requireMerged(dir+"/concat.bin", 10, 30, 20, 40)
+	concat := openTestServer(t, port, dir+"/concat.bin")
+	entry, err := concat.GetEntry(7)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, entry.Data)
+	require.NoError(t, concat.Close())
+
+	// Case: Output not empty -> ERROR
+	_, err = datastreamer.MergeStreams(inputs, streamType, dir+"/merged.bin", nil)
+	require.ErrorIs(t, err, datastreamer.ErrSplitOutputNotEmpty)
+
+	// Case: No inputs -> ERROR
+	_, err = datastreamer.MergeStreams(nil, streamType, dir+"/empty.bin", nil)
+	require.ErrorIs(t, err, datastreamer.ErrMergeWithoutInputs)
+}
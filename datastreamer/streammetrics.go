@@ -0,0 +1,211 @@
+package datastreamer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Prefixes of the names of the metrics
+const (
+	metricsPrefix       = "datastreamer_client_"
+	serverMetricsPrefix = "datastreamer_server_"
+)
+
+// statsMetric type for a metric of the statistics in the Prometheus text format
+type statsMetric[T any] struct {
+	name   string
+	kind   string // counter|gauge
+	help   string
+	label  string // Name of the label of the values by label (kind if empty)
+	value  func(stats *T) float64
+	labels func(stats *T) map[string]float64 // Values by label (nil for a single value)
+}
+
+// clientMetrics are the metrics of the client statistics
+var clientMetrics = []statsMetric[ClientStats]{
+	{name: "connected", kind: "gauge", help: "Connected to the server (1) or not (0)",
+		value: func(s *ClientStats) float64 { return boolMetric(s.Connected) }},
+	{name: "streaming", kind: "gauge", help: "Streaming started (1) or not (0)",
+		value: func(s *ClientStats) float64 { return boolMetric(s.Streaming) }},
+	{name: "subscriptions", kind: "gauge", help: "Tagged subscriptions over the connection",
+		value: func(s *ClientStats) float64 { return float64(s.Subscriptions) }},
+	{name: "entries_received_total", kind: "counter", help: "Data entries received (streaming and subscriptions)",
+		value: func(s *ClientStats) float64 { return float64(s.EntriesReceived) }},
+	{name: "bytes_received_total", kind: "counter", help: "Bytes of the data entries received",
+		value: func(s *ClientStats) float64 { return float64(s.BytesReceived) }},
+	{name: "entries_per_second", kind: "gauge", help: "Throughput of the entries received (latest 10s)",
+		value: func(s *ClientStats) float64 { return s.EntriesPerSec }},
+	{name: "processed_total", kind: "counter", help: "Entries processed by the process entry functions",
+		value: func(s *ClientStats) float64 { return float64(s.Processed) }},
+	{name: "delivered_total", kind: "counter", help: "Entries processed without error by the process entry functions",
+		value: func(s *ClientStats) float64 { return float64(s.Delivered) }},
+	{name: "reprocessed_total", kind: "counter", help: "Process retries of the entries failed",
+		value: func(s *ClientStats) float64 { return float64(s.Reprocessed) }},
+	{name: "process_latency_seconds", kind: "gauge", help: "Average latency of the process entry functions",
+		value: func(s *ClientStats) float64 { return s.ProcessLatencyMs / 1000 }}, //nolint:mnd
+	{name: "process_latency_max_seconds", kind: "gauge", help: "Maximum latency of the process entry functions",
+		value: func(s *ClientStats) float64 { return s.MaxProcessLatencyMs / 1000 }}, //nolint:mnd
+	{name: "throttled_seconds_total", kind: "counter", help: "Time the reads were paused by the rate limit",
+		value: func(s *ClientStats) float64 { return s.ThrottledMs / 1000 }}, //nolint:mnd
+	{name: "last_entry", kind: "gauge", help: "Latest entry number received from streaming",
+		value: func(s *ClientStats) float64 { return float64(s.LastEntry) }},
+	{name: "last_entry_age_seconds", kind: "gauge", help: "Time since the latest entry received from streaming",
+		value: func(s *ClientStats) float64 { return lastEntryAge(s) }},
+	{name: "lag_entries", kind: "gauge", help: "Entries pending to receive up to the total entries",
+		value: func(s *ClientStats) float64 { return float64(s.Lag) }},
+	{name: "queued_entries", kind: "gauge", help: "Entries received pending in the entries channel",
+		value: func(s *ClientStats) float64 { return float64(s.Queued) }},
+	{name: "reconnects_total", kind: "counter", help: "Reconnections to the server since start",
+		value: func(s *ClientStats) float64 { return float64(s.ReconnectCount) }},
+	{name: "errors_total", kind: "counter", help: "Errors by kind",
+		labels: func(s *ClientStats) map[string]float64 {
+			values := make(map[string]float64, len(s.Errors))
+			for kind, count := range s.Errors {
+				values[kind] = float64(count)
+			}
+			return values
+		}},
+	{name: "dropped_total", kind: "counter", help: "Entries received not delivered by reason",
+		labels: func(s *ClientStats) map[string]float64 {
+			values := make(map[string]float64, len(s.Dropped))
+			for reason, count := range s.Dropped {
+				values[reason] = float64(count)
+			}
+			return values
+		}},
+}
+
+// serverMetrics are the metrics of the server statistics
+var serverMetrics = []statsMetric[ServerStats]{
+	{name: "clients", kind: "gauge", help: "Clients connected",
+		value: func(s *ServerStats) float64 { return float64(len(s.Clients)) }},
+	{name: "total_entries", kind: "gauge", help: "Entries of the stream",
+		value: func(s *ServerStats) float64 { return float64(s.TotalEntries) }},
+	{name: "accept_errors_total", kind: "counter", help: "Errors accepting the client connections",
+		value: func(s *ServerStats) float64 { return float64(s.AcceptErrors) }},
+	{name: "open_fds", kind: "gauge", help: "Open file descriptors of the process (-1 unknown)",
+		value: func(s *ServerStats) float64 { return float64(s.Resources.OpenFDs) }},
+	{name: "max_fds", kind: "gauge", help: "Limit of open file descriptors of the process (0 unknown)",
+		value: func(s *ServerStats) float64 { return float64(s.Resources.MaxFDs) }},
+	{name: "goroutines", kind: "gauge", help: "Goroutines of the process",
+		value: func(s *ServerStats) float64 { return float64(s.Resources.Goroutines) }},
+	{name: "subsystem_goroutines", kind: "gauge", help: "Goroutines of the server running by subsystem",
+		label: "subsystem", labels: func(s *ServerStats) map[string]float64 {
+			values := make(map[string]float64, len(s.Resources.Subsystems))
+			for subsystem, count := range s.Resources.Subsystems {
+				values[subsystem] = float64(count)
+			}
+			return values
+		}},
+	{name: "channel_length", kind: "gauge", help: "Elements pending in the server channels",
+		label: "channel", labels: func(s *ServerStats) map[string]float64 {
+			values := make(map[string]float64, len(s.Resources.Channels))
+			for name, usage := range s.Resources.Channels {
+				values[name] = float64(usage.Length)
+			}
+			return values
+		}},
+	{name: "channel_capacity", kind: "gauge", help: "Capacity of the server channels",
+		label: "channel", labels: func(s *ServerStats) map[string]float64 {
+			values := make(map[string]float64, len(s.Resources.Channels))
+			for name, usage := range s.Resources.Channels {
+				values[name] = float64(usage.Capacity)
+			}
+			return values
+		}},
+}
+
+// MetricsHandler returns an HTTP handler serving the client statistics as metrics in the Prometheus text format
+// (e.g. on /metrics), labeled with the client ID and the server, so the downstream services alert on the stalled
+// streams (e.g. on last_entry_age_seconds or entries_per_second) without a dependency on a metrics library
+func (c *StreamClient) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		stats := c.GetStats()
+		labels := "id=" + strconv.Quote(stats.ID) + ",server=" + strconv.Quote(stats.Server)
+		_ = writeMetrics(w, metricsPrefix, labels, clientMetrics, &stats)
+	})
+}
+
+// MetricsHandler returns an HTTP handler serving the server statistics as metrics in the Prometheus text format,
+// labeled with the stream type, with the resources usage of the process (open files, goroutines and channels) to
+// alert before the limits are reached
+func (s *StreamServer) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		stats := s.GetStats()
+		labels := "stream_type=" + strconv.Quote(strconv.FormatUint(uint64(stats.StreamType), 10))
+		_ = writeMetrics(w, serverMetricsPrefix, labels, serverMetrics, &stats)
+	})
+}
+
+// MetricsHandler returns an HTTP handler serving the relay server statistics as metrics (see
+// StreamServer.MetricsHandler)
+func (r *StreamRelay) MetricsHandler() http.Handler {
+	return r.server.MetricsHandler()
+}
+
+// writeMetrics writes the statistics as metrics in the Prometheus text format, with the common labels
+func writeMetrics[T any](w io.Writer, prefix string, labels string, metrics []statsMetric[T], stats *T) error {
+	for _, m := range metrics {
+		_, err := fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", prefix, m.name, m.help, prefix, m.name, m.kind)
+		if err != nil {
+			return err
+		}
+		if m.labels == nil {
+			_, err = fmt.Fprintf(w, "%s%s{%s} %s\n", prefix, m.name, labels, formatMetric(m.value(stats)))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		label := m.label
+		if label == "" {
+			label = "kind"
+		}
+		values := m.labels(stats)
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			_, err = fmt.Fprintf(w, "%s%s{%s,%s=%s} %s\n", prefix, m.name, labels, label, strconv.Quote(key),
+				formatMetric(values[key]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatMetric formats the value of a metric
+func formatMetric(value float64) string {
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', -1, 64), ".0")
+}
+
+// boolMetric returns the value of a flag metric
+func boolMetric(flag bool) float64 {
+	if flag {
+		return 1
+	}
+	return 0
+}
+
+// lastEntryAge returns the seconds since the latest entry received (since start if none)
+func lastEntryAge(stats *ClientStats) float64 {
+	since := stats.LastEntryTime
+	if since.IsZero() {
+		since = stats.StartTime
+	}
+	if since.IsZero() {
+		return 0
+	}
+	return stats.Time.Sub(since).Seconds()
+}
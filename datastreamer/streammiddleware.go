@@ -0,0 +1,104 @@
+package datastreamer
+
+import (
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// EntryHandler type of the function handling a data entry on the send path of the server or on the receive path
+// of the client
+type EntryHandler func(e *FileEntry) error
+
+// EntryMiddleware type of the function wrapping the next entry handler of a chain. The middleware can transform the
+// entry (replacing its data, never modifying it in place), observe it, or drop it by not calling the next handler
+type EntryMiddleware func(next EntryHandler) EntryHandler
+
+// entryChain type for a chain of entry middlewares, applied in the order they were added
+type entryChain []EntryMiddleware
+
+// UseSendMiddleware adds middlewares to the chain applied to the data entries sent to the clients (streaming and
+// query commands) (call before Start)
+func (s *StreamServer) UseSendMiddleware(middlewares ...EntryMiddleware) {
+	s.sendChain = append(s.sendChain, middlewares...)
+}
+
+// UseReceiveMiddleware adds middlewares to the chain applied to the data entries received from the server
+// (streaming, subscriptions and query commands) before processing them (call before Start)
+func (c *StreamClient) UseReceiveMiddleware(middlewares ...EntryMiddleware) {
+	c.receiveChain = append(c.receiveChain, middlewares...)
+}
+
+// apply passes an entry through the middleware chain, returns if the entry reached the end of the chain (not dropped)
+func (mws entryChain) apply(e *FileEntry) (bool, error) {
+	if len(mws) == 0 || e.Type == EntryTypeNotFound {
+		return true, nil
+	}
+
+	passed := false
+	handler := EntryHandler(func(*FileEntry) error {
+		passed = true
+		return nil
+	})
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+
+	err := handler(e)
+	if err != nil {
+		return false, err
+	}
+	e.Length = FixedSizeFileEntry + uint32(len(e.Data))
+	return passed, nil
+}
+
+// applyAll passes the entries through the middleware chain, returns the entries not dropped up to the first error
+func (mws entryChain) applyAll(entries []FileEntry) ([]FileEntry, error) {
+	if len(mws) == 0 {
+		return entries, nil
+	}
+
+	result := make([]FileEntry, 0, len(entries))
+	for _, entry := range entries {
+		passed, err := mws.apply(&entry)
+		if err != nil {
+			return result, err
+		}
+		if passed {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// applySendChain passes an entry of a query command response through the send middlewares, a dropped entry (or
+// failed) is sent as not found
+func (s *StreamServer) applySendChain(entry FileEntry, client *client) FileEntry {
+	passed, err := s.sendChain.apply(&entry)
+	if err != nil {
+		log.Errorf("Error in send middleware for entry %d to %s: %v", entry.Number, client.clientID, err)
+	}
+	if err != nil || !passed {
+		return FileEntry{Length: FixedSizeFileEntry, Type: EntryTypeNotFound}
+	}
+	return entry
+}
+
+// hasSubscriptions checks if the client has tagged subscriptions
+func (s *StreamServer) hasSubscriptions(cli *client) bool {
+	cli.mutexSubs.RLock()
+	defer cli.mutexSubs.RUnlock()
+
+	return len(cli.subs) > 0
+}
+
+// applyReceiveChain passes an entry of a query command response through the receive middlewares, a dropped entry
+// returns the not found error
+func (c *StreamClient) applyReceiveChain(entry FileEntry, errNotFound error) (FileEntry, error) {
+	passed, err := c.receiveChain.apply(&entry)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if !passed {
+		return FileEntry{}, errNotFound
+	}
+	return entry, nil
+}
@@ -0,0 +1,91 @@
+package datastreamer_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	server, port := newTestServer(t, "middleware.bin")
+
+	// Send path: drop the entries of type 2, append a trailer to the data
+	trailer := []byte{0xca, 0xfe}
+	server.UseSendMiddleware(
+		func(next datastreamer.EntryHandler) datastreamer.EntryHandler {
+			return func(e *datastreamer.FileEntry) error {
+				if e.Type == entryType2 {
+					return nil
+				}
+				return next(e)
+			}
+		},
+		func(next datastreamer.EntryHandler) datastreamer.EntryHandler {
+			return func(e *datastreamer.FileEntry) error {
+				e.Data = append(append([]byte{}, e.Data...), trailer...)
+				return next(e)
+			}
+		})
+	require.NoError(t, server.Start())
+
+	addEntries := func() {
+		require.NoError(t, server.StartAtomicOp())
+		for i := 0; i < 3; i++ {
+			_, err := server.AddStreamEntry(entryType1, testEntries[1].Encode())
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType2, testEntries[2].Encode())
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+	addEntries()
+
+	// Receive path: count the entries, check and remove the trailer
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	var mutex sync.Mutex
+	received := []uint64{}
+	client.UseReceiveMiddleware(func(next datastreamer.EntryHandler) datastreamer.EntryHandler {
+		return func(e *datastreamer.FileEntry) error {
+			if !strings.HasSuffix(string(e.Data), string(trailer)) {
+				return errors.New("missing trailer")
+			}
+			e.Data = e.Data[:len(e.Data)-len(trailer)]
+			return next(e)
+		}
+	})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		require.Equal(t, testEntries[1].Encode(), e.Data)
+		mutex.Lock()
+		received = append(received, e.Number)
+		mutex.Unlock()
+		return nil
+	})
+	require.NoError(t, client.Start())
+
+	// Case: Query entry passed through the middlewares -> OK
+	entry, err := client.ExecCommandGetEntry(0)
+	require.NoError(t, err)
+	require.Equal(t, testEntries[1].Encode(), entry.Data)
+
+	// Case: Query entry dropped by the send middleware -> FAIL
+	_, err = client.ExecCommandGetEntry(1)
+	require.EqualError(t, datastreamer.ErrEntryNotFound, err.Error())
+
+	// Case: Catch-up and broadcast passed through the middlewares -> OK
+	require.NoError(t, client.ExecCommandStart(0))
+	addEntries()
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 6
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, []uint64{0, 2, 4, 6, 8, 10}, received)
+}
@@ -0,0 +1,141 @@
+package datastreamer
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/hashicorp/yamux"
+)
+
+// newMuxConfig returns the configuration for the multiplexed sessions
+func newMuxConfig() *yamux.Config {
+	cfg := yamux.DefaultConfig()
+	cfg.LogOutput = io.Discard
+	return cfg
+}
+
+// isStreaming checks if a command changes the streaming status of the connection
+func (c Command) isStreaming() bool {
+	return c == CmdStart || c == CmdStartBookmark || c == CmdStop
+}
+
+// processCmdMux processes the TCP Mux command from the clients
+func (s *StreamServer) processCmdMux(client *client) error {
+	// Log
+	log.Debugf("Client %s command Mux", client.clientID)
+
+	// Send a command result entry OK
+	err := s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// From now on the connection carries the multiplexed session
+	client.session, err = yamux.Server(client.conn, newMuxConfig())
+	if err != nil {
+		log.Errorf("Error creating multiplexed session for %s: %v", client.clientID, err)
+		return err
+	}
+
+	return nil
+}
+
+// serveSession accepts the streams of a multiplexed session and manages each one as a new client
+func (s *StreamServer) serveSession(parent *client) {
+	defer parent.session.Close()
+
+	// The multiplexed connection is no longer a client itself (its streams are asked to reconnect on their lifetime)
+	parent.stopLifetime()
+	s.mutexClients.Lock()
+	delete(s.clients, parent.clientID)
+	s.mutexClients.Unlock()
+
+	for {
+		stream, err := parent.session.AcceptStream()
+		if err != nil {
+			log.Debugf("Multiplexed session %s closed: %v", parent.clientID, err)
+			return
+		}
+		if s.isShuttingDown() {
+			stream.Close()
+			return
+		}
+
+		// Check max connections allowed
+		if s.getSafeClientsLen() >= maxConnections {
+			log.Warnf("Unable to accept client stream, maximum number of connections reached (%d)", maxConnections)
+			stream.Close()
+			continue
+		}
+
+		// Goroutine to manage the stream as a client (command requests and entries stream)
+		clientID := fmt.Sprintf("%s#%d", parent.clientID, stream.StreamID())
+		log.Debugf("New stream: %s", clientID)
+		go func() {
+			defer stream.Close()
+			s.handleClient(stream, clientID, true)
+		}()
+	}
+}
+
+// SetMultiplexed sets if the client multiplexes commands and streaming over one connection (call before Start)
+func (c *StreamClient) SetMultiplexed(multiplexed bool) {
+	c.multiplexed = multiplexed
+}
+
+// openSession switches the server connection to a multiplexed session and streams over its data stream
+func (c *StreamClient) openSession() error {
+	// Send the mux command and wait for the result
+	err := c.sendCommand(CmdMux, 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	err = c.readPacketType(c.conn, PtResult, 0)
+	if err != nil {
+		return err
+	}
+	r, err := c.readResultEntry(c.conn)
+	if err != nil {
+		return err
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		// Keep the connection not multiplexed
+		log.Warnf("%s Server doesn't support multiplexing: %d[%s]", c.ID, r.errorNum, r.errorStr)
+		return nil
+	}
+
+	// Open the data stream of the session
+	session, err := yamux.Client(c.conn, newMuxConfig())
+	if err != nil {
+		return err
+	}
+	stream, err := session.Open()
+	if err != nil {
+		session.Close()
+		return err
+	}
+
+	c.mutexSession.Lock()
+	c.closeCommandConn()
+	c.session = session
+	c.mutexSession.Unlock()
+	if !c.setConn(stream) {
+		return ErrClientStopped
+	}
+
+	log.Infof("%s Multiplexed session opened", c.ID)
+	return nil
+}
+
+// closeSession closes the multiplexed session (if any) with all its streams, and the command channel
+func (c *StreamClient) closeSession() {
+	c.mutexSession.Lock()
+	defer c.mutexSession.Unlock()
+
+	c.closeCommandConn()
+	if c.session != nil {
+		c.session.Close()
+	}
+	c.session = nil
+}
@@ -0,0 +1,138 @@
+package datastreamer
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// Option type of a functional option of the client, applied by NewClient over the defaults
+type Option func(c *StreamClient)
+
+// WithDialTimeout sets the timeout of each connection attempt to the server (0 for the context only, the default)
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *StreamClient) {
+		c.dialTimeout = max(timeout, 0)
+	}
+}
+
+// WithDialer sets the function opening the connections to the server, e.g. through a proxy (see SetDialer)
+func WithDialer(dial DialContextFunc) Option {
+	return func(c *StreamClient) {
+		c.SetDialer(dial)
+	}
+}
+
+// WithEntriesBuffer sets the size of the channels of the entries received pending to process, of the streaming and
+// each subscription (GetBufferSizes().ClientEntries if not positive, the default)
+func WithEntriesBuffer(size int) Option {
+	return func(c *StreamClient) {
+		if size > 0 {
+			c.entriesBuffer = size
+		}
+	}
+}
+
+// WithResultsBuffer sets the size of the channel of the streaming command results.
+//
+// Deprecated: the results are passed to each command waiting for it, the size is ignored
+func WithResultsBuffer(_ int) Option {
+	return func(*StreamClient) {}
+}
+
+// WithProcessEntryFunc sets the callback function to process the streaming entries (see SetProcessEntryFunc)
+func WithProcessEntryFunc(f ProcessEntryFunc) Option {
+	return func(c *StreamClient) {
+		c.SetProcessEntryFunc(f)
+	}
+}
+
+// WithOnFatal sets the function called with the error stopping the streaming (see SetOnFatal)
+func WithOnFatal(hook func(err error)) Option {
+	return func(c *StreamClient) {
+		c.SetOnFatal(hook)
+	}
+}
+
+// WithTLS sets the client to connect to the server over TLS with the configuration (see SetTLS)
+func WithTLS(config *tls.Config) Option {
+	return func(c *StreamClient) {
+		c.SetTLS(config)
+	}
+}
+
+// WithCredentials sets the credentials sent to authenticate to the server (see SetCredentials)
+func WithCredentials(credentials []byte) Option {
+	return func(c *StreamClient) {
+		c.SetCredentials(credentials)
+	}
+}
+
+// WithReconnectPolicy sets the policy of the connection attempts to the server, its backoff and retries (see
+// SetReconnectPolicy)
+func WithReconnectPolicy(policy ReconnectPolicy) Option {
+	return func(c *StreamClient) {
+		c.SetReconnectPolicy(policy)
+	}
+}
+
+// WithProcessBatchFunc sets the callback function to process the streaming entries in batches (see
+// SetProcessBatchFunc)
+func WithProcessBatchFunc(f ProcessBatchFunc, maxSize int, maxLatency time.Duration) Option {
+	return func(c *StreamClient) {
+		c.SetProcessBatchFunc(f, maxSize, maxLatency)
+	}
+}
+
+// WithPullDelivery sets the client to deliver the streaming entries to the consumer pulling them (see
+// SetPullDelivery)
+func WithPullDelivery(buffer int) Option {
+	return func(c *StreamClient) {
+		c.SetPullDelivery(true, buffer)
+	}
+}
+
+// WithBackfill sets the client to backfill in parallel the streaming started far behind the tip (see SetBackfill)
+func WithBackfill(connections int, threshold uint64) Option {
+	return func(c *StreamClient) {
+		c.SetBackfill(connections, threshold)
+	}
+}
+
+// WithCircuitBreaker sets the client to stop after repeated rejections of the server, calling the hook (see
+// SetCircuitBreaker)
+func WithCircuitBreaker(maxFailures int, onOpen func(error)) Option {
+	return func(c *StreamClient) {
+		c.SetCircuitBreaker(maxFailures, onOpen)
+	}
+}
+
+// WithEntryTypes sets the entry types processed by the client, negotiated with the server or not (see SetEntryTypes)
+func WithEntryTypes(entryTypes []EntryType, negotiate bool) Option {
+	return func(c *StreamClient) {
+		c.SetEntryTypes(entryTypes, negotiate)
+	}
+}
+
+// WithCompression sets the compression codec of the streaming requested to the server (see SetCompression)
+func WithCompression(compression Compression) Option {
+	return func(c *StreamClient) {
+		c.SetCompression(compression)
+	}
+}
+
+// WithChecksum sets the checksum algorithm of the entries streamed requested to the server (see SetChecksum)
+func WithChecksum(checksum Checksum) Option {
+	return func(c *StreamClient) {
+		c.SetChecksum(checksum)
+	}
+}
+
+// WithLogsConfig initializes the logs with the configuration. The logger is shared by the package, so it applies to
+// the servers and the rest of the clients too
+func WithLogsConfig(logsConfig log.Config) Option {
+	return func(_ *StreamClient) {
+		log.Init(logsConfig)
+	}
+}
@@ -0,0 +1,46 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOptions(t *testing.T) {
+	server, port := newTestServer(t, "options.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 3)
+
+	// Case: Callback function and buffers set by the options -> Entries processed by it
+	var processed atomic.Int32
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+		datastreamer.WithEntriesBuffer(1),
+		datastreamer.WithResultsBuffer(1),
+		datastreamer.WithDialTimeout(time.Second),
+		datastreamer.WithProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			processed.Add(1)
+			return nil
+		}))
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.ExecCommandStart(0))
+	require.Eventually(t, func() bool { return processed.Load() == 3 }, 2*time.Second, 10*time.Millisecond)
+
+	// Case: Reconnection policy set by the options -> Gives up on an unreachable server
+	var gaveUp atomic.Bool
+	unreachable, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", freePort(t)), streamType,
+		datastreamer.WithReconnectPolicy(datastreamer.ReconnectPolicy{
+			Backoff:    10 * time.Millisecond,
+			MaxRetries: 1,
+			OnGiveUp:   func(error) { gaveUp.Store(true) },
+		}))
+	require.NoError(t, err)
+	require.ErrorIs(t, unreachable.Start(), datastreamer.ErrServerUnreachable)
+	require.True(t, gaveUp.Load())
+}
@@ -0,0 +1,102 @@
+package datastreamer
+
+import (
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	defaultProcessBackoff = time.Second // Default backoff to process again an entry failed (restart policy)
+	maxProcessBackoff     = time.Minute // Maximum backoff to process again an entry failed (restart policy)
+)
+
+// ProcessErrorPolicy type of the behavior of the client when the process entry function returns an error
+type ProcessErrorPolicy int
+
+const (
+	ProcessErrStop       ProcessErrorPolicy = iota // ProcessErrStop stops the streaming, the error is returned by Run
+	ProcessErrRestart                              // ProcessErrRestart restarts from the failed entry after a backoff
+	ProcessErrSkip                                 // ProcessErrSkip skips the failed entry
+	ProcessErrDeadLetter                           // ProcessErrDeadLetter retries the failed entry, then quarantines it
+)
+
+// processPolicy type for the process entry function errors policy of a client
+type processPolicy struct {
+	policy  ProcessErrorPolicy
+	backoff time.Duration   // Initial backoff of the restart policy, doubled on each consecutive error
+	onFatal func(err error) // Hook called when the streaming stops on a fatal error (nil if not set)
+
+	retries    int            // Retries of a failed entry before passing it to the dead-letter sink
+	deadLetter DeadLetterFunc // Sink of the entries failed after the retries (dead-letter policy)
+}
+
+// SetProcessErrorPolicy sets the behavior of the client when the process entry function returns an error, for the
+// streaming and the subscriptions: stop the streaming (default, the error is returned by Run and passed to the
+// OnFatal hook, or ends the subscription), restart processing the failed entry (the one after the last good entry)
+// after a backoff doubled on each consecutive error up to 1 minute (1 second if 0), or skip the failed entry (see
+// SetDeadLetter for the dead-letter policy). The errors are counted in the statistics (call before Start)
+func (c *StreamClient) SetProcessErrorPolicy(policy ProcessErrorPolicy, backoff time.Duration) {
+	c.policy.policy = policy
+	c.policy.backoff = backoff
+	if backoff <= 0 {
+		c.policy.backoff = defaultProcessBackoff
+	}
+}
+
+// SetOnFatal sets the hook function called when the streaming stops on a fatal error (receive middleware, proof
+// verification or process entry function error with the stop policy), also without Run. Not called for the
+// subscriptions, ended with the error (call before Start)
+func (c *StreamClient) SetOnFatal(hook func(err error)) {
+	c.policy.onFatal = hook
+}
+
+// processWithPolicy processes an entry with a process entry function applying the process error policy. Returns the
+// error stopping the streaming (nil to continue)
+func (c *StreamClient) processWithPolicy(e *FileEntry, process ProcessEntryFunc, s *StreamServer) error {
+	backoff := c.policy.backoff
+	for retry := 0; ; retry++ {
+		if retry > 0 {
+			c.stats.entryReprocessed()
+		}
+		start := time.Now()
+		err := process(e, c, s)
+		c.stats.entryProcessed(time.Since(start))
+		if err == nil {
+			c.stats.entryDelivered()
+			return nil
+		}
+		c.stats.addError(StatErrProcess, err)
+
+		switch c.policy.policy {
+		case ProcessErrSkip:
+			log.Warnf("%s Processing entry %d: %v. Entry skipped", c.ID, e.Number, err)
+			c.stats.entryDropped(StatDropSkipped)
+			return nil
+
+		case ProcessErrRestart:
+			log.Warnf("%s Processing entry %d: %v. Restarting from the entry in %v", c.ID, e.Number, err, backoff)
+			if !c.wait(backoff) {
+				c.stats.entryDropped(StatDropStop)
+				return nil
+			}
+			backoff = min(2*backoff, maxProcessBackoff) //nolint:mnd
+
+		case ProcessErrDeadLetter:
+			if retry >= c.policy.retries {
+				return c.quarantine(e, err)
+			}
+			log.Warnf("%s Processing entry %d: %v. Retry %d of %d in %v", c.ID, e.Number, err, retry+1,
+				c.policy.retries, backoff)
+			if !c.wait(backoff) {
+				c.stats.entryDropped(StatDropStop)
+				return nil
+			}
+			backoff = min(2*backoff, maxProcessBackoff) //nolint:mnd
+
+		default:
+			c.stats.entryDropped(StatDropError)
+			return err
+		}
+	}
+}
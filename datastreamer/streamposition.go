@@ -0,0 +1,272 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	maxPositionKeyLength = 64 // Maximum number of bytes for the key of a client position
+	positionValueLength  = 16 // Length of a client position in the positions DB: entry number and time
+)
+
+// ClientPosition type for the processed position of a client stored on the server
+type ClientPosition struct {
+	Key   string    `json:"key"`   // Key of the client (e.g. the consumer name)
+	Entry uint64    `json:"entry"` // Next entry number to process
+	Time  time.Time `json:"time"`  // Time the position was committed
+}
+
+// StreamPositions type to manage the processed positions of the clients by key
+type StreamPositions struct {
+	dbName string
+	db     *leveldb.DB
+}
+
+// SetClientPositions sets the server to store the processed positions committed by the clients by key (the
+// CommitPosition command), in a positions DB (<file>.pos), so the stateless consumers get it back after a restart
+// (the GetPosition command) without their own checkpoint storage (call before Start)
+func (s *StreamServer) SetClientPositions(enabled bool) error {
+	if s.positions != nil {
+		err := s.positions.db.Close()
+		s.positions = nil
+		if err != nil || !enabled {
+			return err
+		}
+	}
+	if !enabled {
+		return nil
+	}
+
+	name := s.fileName[0:strings.LastIndex(s.fileName, ".")] + ".pos"
+	positions, err := NewPositions(name)
+	if err != nil {
+		return err
+	}
+	s.positions = positions
+	return nil
+}
+
+// SetClientPositions sets the relay server side to store the positions of the clients (call before Start)
+func (r *StreamRelay) SetClientPositions(enabled bool) error {
+	return r.server.SetClientPositions(enabled)
+}
+
+// NewPositions opens or creates the positions database
+func NewPositions(fn string) (*StreamPositions, error) {
+	log.Infof("Opening/creating positions DB for datastream: %s", fn)
+	db, err := leveldb.OpenFile(fn, dbOptions())
+	if err != nil {
+		log.Errorf("Error opening/creating positions DB %s: %v", fn, err)
+		return nil, err
+	}
+	return &StreamPositions{
+		dbName: fn,
+		db:     db,
+	}, nil
+}
+
+// CommitPosition stores the position of a client key
+func (p *StreamPositions) CommitPosition(position ClientPosition) error {
+	value := binary.BigEndian.AppendUint64(nil, position.Entry)
+	value = binary.BigEndian.AppendUint64(value, uint64(position.Time.UnixNano()))
+	return p.db.Put([]byte(position.Key), value, nil)
+}
+
+// GetPosition returns the position stored of a client key
+func (p *StreamPositions) GetPosition(key string) (ClientPosition, error) {
+	value, err := p.db.Get([]byte(key), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return ClientPosition{}, ErrPositionNotStored
+	}
+	if err != nil {
+		return ClientPosition{}, err
+	}
+	if len(value) != positionValueLength {
+		log.Errorf("Invalid position of key %s in the positions DB", key)
+		return ClientPosition{}, ErrPositionNotStored
+	}
+	return ClientPosition{
+		Key:   key,
+		Entry: binary.BigEndian.Uint64(value[0:8]),
+		Time:  time.Unix(0, int64(binary.BigEndian.Uint64(value[8:16]))),
+	}, nil
+}
+
+// ExecCommandCommitPosition executes client TCP command to store on the server the processed position of a key, the
+// next entry number to process
+func (c *StreamClient) ExecCommandCommitPosition(key string, nextEntry uint64) error {
+	return c.ExecCommandCommitPositionContext(context.Background(), key, nextEntry)
+}
+
+// ExecCommandCommitPositionContext executes client TCP command to store on the server the processed position of a
+// key, canceled with the context
+func (c *StreamClient) ExecCommandCommitPositionContext(ctx context.Context, key string, nextEntry uint64) error {
+	err := checkPositionKey(key)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.execCommand(ctx, CmdCommitPosition, false, nextEntry, []byte(key))
+	return err
+}
+
+// ExecCommandGetPosition executes client TCP command to get the processed position of a key stored on the server.
+// Returns ErrPositionNotStored if the key has no position
+func (c *StreamClient) ExecCommandGetPosition(key string) (ClientPosition, error) {
+	return c.ExecCommandGetPositionContext(context.Background(), key)
+}
+
+// ExecCommandGetPositionContext executes client TCP command to get the processed position of a key stored on the
+// server, canceled with the context
+func (c *StreamClient) ExecCommandGetPositionContext(ctx context.Context, key string) (ClientPosition, error) {
+	position := ClientPosition{}
+	err := checkPositionKey(key)
+	if err != nil {
+		return position, err
+	}
+	_, entry, err := c.execCommand(ctx, CmdGetPosition, false, 0, []byte(key))
+	if err != nil {
+		return position, err
+	}
+	err = json.Unmarshal(entry.Data, &position)
+	return position, err
+}
+
+// checkPositionKey checks the length of the key of a client position
+func checkPositionKey(key string) error {
+	if len(key) == 0 || len(key) > maxPositionKeyLength {
+		log.Errorf("Invalid position key length %d (maximum %d)", len(key), maxPositionKeyLength)
+		return ErrInvalidPositionKey
+	}
+	return nil
+}
+
+// readPositionKeyParam reads the key parameter of the position commands, a client exceeding its maximum length is
+// killed
+func (s *StreamServer) readPositionKeyParam(cli *client) (string, error) {
+	length, err := readFullUint32(cli)
+	if err != nil {
+		return "", err
+	}
+	if length > maxPositionKeyLength {
+		log.Errorf("Client %s exceeded [%d] maximum allowed length [%d] for a position key: client killed",
+			cli.clientID, length, maxPositionKeyLength)
+		s.killClient(cli.clientID)
+		return "", ErrInvalidPositionKey
+	}
+	if length == 0 {
+		return "", nil
+	}
+	key, err := readFullBytes(length, cli)
+	return string(key), err
+}
+
+// handleCommitPositionCommand processes the CmdCommitPosition command
+func (s *StreamServer) handleCommitPositionCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("CommitPosition command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrPositionCommandNotAllowed
+	}
+
+	return s.processCmdCommitPosition(cli)
+}
+
+// processCmdCommitPosition processes the TCP CommitPosition command from the clients
+func (s *StreamServer) processCmdCommitPosition(client *client) error {
+	// Read next entry number and key parameters
+	nextEntry, err := readFullUint64(client)
+	if err != nil {
+		return err
+	}
+	key, err := s.readPositionKeyParam(client)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command CommitPosition %d key [%s]", client.clientID, nextEntry, key)
+
+	if s.positions == nil || key == "" {
+		return s.sendResultEntry(uint32(CmdErrNoPosition), StrCommandErrors[CmdErrNoPosition], client)
+	}
+	err = s.positions.CommitPosition(ClientPosition{Key: key, Entry: nextEntry, Time: time.Now()})
+	if err != nil {
+		log.Errorf("Error storing position %d of key %s for %s: %v", nextEntry, key, client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	return s.sendResultEntry(0, "OK", client)
+}
+
+// handleGetPositionCommand processes the CmdGetPosition command
+func (s *StreamServer) handleGetPositionCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("GetPosition command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrPositionCommandNotAllowed
+	}
+
+	return s.processCmdGetPosition(cli)
+}
+
+// processCmdGetPosition processes the TCP GetPosition command from the clients
+func (s *StreamServer) processCmdGetPosition(client *client) error {
+	// Read key parameter
+	key, err := s.readPositionKeyParam(client)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command GetPosition key [%s]", client.clientID, key)
+
+	if s.positions == nil || key == "" {
+		return s.sendResultEntry(uint32(CmdErrNoPosition), StrCommandErrors[CmdErrNoPosition], client)
+	}
+	position, err := s.positions.GetPosition(key)
+	if errors.Is(err, ErrPositionNotStored) {
+		return s.sendResultEntry(uint32(CmdErrNoPosition), StrCommandErrors[CmdErrNoPosition], client)
+	}
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(position)
+	}
+	if err != nil {
+		log.Errorf("Error getting position of key %s for %s: %v", key, client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the position as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteTagged(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending position to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
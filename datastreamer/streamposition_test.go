@@ -0,0 +1,52 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPositions(t *testing.T) {
+	server, port := newTestServer(t, "positions.bin")
+	require.NoError(t, server.SetClientPositions(true))
+	require.NoError(t, server.Start())
+
+	newClient := func() *datastreamer.StreamClient {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		require.NoError(t, client.Start())
+		return client
+	}
+
+	// Case: Key without position -> FAIL
+	client := newClient()
+	_, err := client.ExecCommandGetPosition("indexer")
+	require.ErrorIs(t, err, datastreamer.ErrPositionNotStored)
+
+	// Case: Position committed -> Got back by a new client after a restart
+	before := time.Now()
+	require.NoError(t, client.ExecCommandCommitPosition("indexer", 10))
+	require.NoError(t, client.ExecCommandCommitPosition("indexer", 25))
+	require.NoError(t, client.ExecCommandCommitPosition("other", 3))
+	require.NoError(t, client.Close())
+
+	client = newClient()
+	defer func() { _ = client.Close() }()
+	position, err := client.ExecCommandGetPosition("indexer")
+	require.NoError(t, err)
+	require.Equal(t, "indexer", position.Key)
+	require.Equal(t, uint64(25), position.Entry)
+	require.False(t, position.Time.Before(before.Truncate(time.Second)))
+	position, err = client.ExecCommandGetPosition("other")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), position.Entry)
+
+	// Case: Invalid key -> FAIL
+	_, err = client.ExecCommandGetPosition("")
+	require.ErrorIs(t, err, datastreamer.ErrInvalidPositionKey)
+	require.ErrorIs(t, client.ExecCommandCommitPosition(strings.Repeat("k", 65), 1), datastreamer.ErrInvalidPositionKey)
+}
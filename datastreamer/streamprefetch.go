@@ -0,0 +1,179 @@
+package datastreamer
+
+import (
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// prefetchItem type for an entry of the prefetch ready queue, already passed through the receive middlewares
+type prefetchItem struct {
+	entry FileEntry
+	err   error // Receive middleware error, the streaming stops when it's reached
+	stop  bool  // Flag the client is stopped, the streaming stops when it's reached
+}
+
+// prefetchQueue type for the bounded queue of the entries ready to process
+type prefetchQueue struct {
+	mutex      sync.Mutex
+	cond       *sync.Cond
+	items      []prefetchItem
+	bytes      uint64 // Data bytes of the entries in the queue
+	maxEntries int    // Maximum number of entries in the queue
+	maxBytes   uint64 // Maximum data bytes of the entries in the queue (0 no limit)
+	closed     bool   // Flag the client is stopped, the items are no longer queued
+}
+
+// SetPrefetch sets the client to prefetch the streaming entries while the callback function processes the current
+// one: the next entries (up to maxEntries, and up to maxBytes of data if not 0) are read and passed through the
+// receive middlewares in advance into a ready queue. An entry of more than maxBytes is queued alone. A maxEntries of 0
+// disables it (call before Start)
+func (c *StreamClient) SetPrefetch(maxEntries int, maxBytes uint64) {
+	if maxEntries <= 0 {
+		c.prefetch = nil
+		return
+	}
+	c.prefetch = newPrefetchQueue(maxEntries, maxBytes)
+}
+
+// newPrefetchQueue creates a new prefetch ready queue
+func newPrefetchQueue(maxEntries int, maxBytes uint64) *prefetchQueue {
+	q := prefetchQueue{
+		items:      make([]prefetchItem, 0, maxEntries),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	return &q
+}
+
+// push adds an item to the queue, waiting while the queue is full
+func (q *prefetchQueue) push(item prefetchItem) {
+	size := uint64(len(item.entry.Data))
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && (len(q.items) >= q.maxEntries || (q.maxBytes > 0 && len(q.items) > 0 && q.bytes+size > q.maxBytes)) {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, item)
+	q.bytes += size
+	q.cond.Broadcast()
+}
+
+// pop removes the oldest item from the queue, waiting while the queue is empty. Returns a stop item once the queue
+// is closed and empty
+func (q *prefetchQueue) pop() prefetchItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && len(q.items) == 0 {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return prefetchItem{stop: true}
+	}
+	item := q.items[0]
+	q.items[0] = prefetchItem{}
+	q.items = q.items[1:]
+	q.bytes -= uint64(len(item.entry.Data))
+	q.cond.Broadcast()
+	return item
+}
+
+// len returns the number of items in the queue
+func (q *prefetchQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.items)
+}
+
+// close closes the queue, waking up the goroutines waiting
+func (q *prefetchQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// prefetchEntries consumes the streaming data entries, passing them through the receive middlewares and the proof
+// verification into the prefetch ready queue
+func (c *StreamClient) prefetchEntries() {
+	for {
+		var e FileEntry
+		select {
+		case e = <-c.entries:
+		case <-c.done:
+			c.prefetch.push(prefetchItem{stop: true})
+			return
+		}
+		if e.packetType == ptStopBarrier {
+			c.prefetch.push(prefetchItem{entry: e})
+			continue
+		}
+		c.stats.entryReceived(e.Number)
+
+		// Pass the data entry through the receive middlewares
+		passed, err := c.receiveChain.apply(&e)
+		if err == nil && passed {
+			err = c.verifyEntry(&e)
+		}
+		if err != nil {
+			c.prefetch.push(prefetchItem{entry: e, err: err})
+			return
+		}
+		if passed {
+			c.prefetch.push(prefetchItem{entry: e})
+		} else {
+			c.stats.entryDropped(StatDropMiddleware)
+		}
+	}
+}
+
+// getPrefetched processes the entries of the prefetch ready queue
+func (c *StreamClient) getPrefetched() error {
+	c.spawn(c.prefetchEntries)
+
+	for {
+		item := c.prefetch.pop()
+		if item.stop {
+			return nil
+		}
+		if item.err != nil {
+			log.Errorf("%s Receive middleware for entry %d: %s. Exiting getStream function", c.ID, item.entry.Number,
+				item.err.Error())
+			c.stats.entryDropped(StatDropError)
+			return item.err
+		}
+
+		// Skip the stop barriers and the entries discarded on stop
+		if c.passStopBarrier(&item.entry) {
+			continue
+		}
+
+		// Verify the segment completed by a bookmark against the verifier source
+		err := c.verifySegment(&item.entry)
+		if err != nil {
+			c.stats.entryDropped(StatDropError)
+			return err
+		}
+
+		// Skip the data entry of other entry types
+		if !c.entryTypes.contains(&item.entry) {
+			c.stats.entryDropped(StatDropEntryType)
+			continue
+		}
+
+		// Process the data entry
+		err = c.processStreamEntry(&item.entry)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPrefetch(t *testing.T) {
+	server, port := newTestServer(t, "prefetch.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 20)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	client.SetPrefetch(4, 0)
+	var decoded atomic.Int32
+	client.UseReceiveMiddleware(func(next datastreamer.EntryHandler) datastreamer.EntryHandler {
+		return func(e *datastreamer.FileEntry) error {
+			decoded.Add(1)
+			return next(e)
+		}
+	})
+	var mutex sync.Mutex
+	received := []uint64{}
+	release := make(chan struct{})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		<-release
+		mutex.Lock()
+		received = append(received, e.Number)
+		mutex.Unlock()
+		return nil
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+
+	// Case: Processing the first entry, the next ones decoded up to the ready queue size -> OK
+	require.Eventually(t, func() bool {
+		return client.GetStats().Prefetched == 4
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Never(t, func() bool {
+		return decoded.Load() > 1+4+1
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	// Case: Processing released, entries processed in order -> OK
+	close(release)
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 20
+	}, 2*time.Second, 10*time.Millisecond)
+	for i, number := range received {
+		require.Equal(t, uint64(i), number)
+	}
+	require.Equal(t, int32(20), decoded.Load())
+}
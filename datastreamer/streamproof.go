@@ -0,0 +1,88 @@
+package datastreamer
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const proofRetryInterval = 100 * time.Millisecond // Interval to retry the proof of an entry not checkpointed yet
+
+// CheckpointRootFunc type of the function returning the trusted root of the checkpoint including an entry number
+type CheckpointRootFunc func(entryNum uint64) ([]byte, error)
+
+// VerifyEntryInclusion checks the proof of inclusion of an entry in a trusted checkpoint root
+func VerifyEntryInclusion(entry FileEntry, proof CheckpointProof, root []byte) bool {
+	return bytes.Equal(proof.Root, root) && proof.Verify(entry)
+}
+
+// SetRequireProofs sets the client to verify every streaming entry (streaming and subscriptions) against the
+// trusted root of its checkpoint, e.g. to consume from untrusted relays. The proof is fetched from the server with
+// the CheckpointProof command and the root from the trustedRoot function. The entry is verified after the receive
+// middlewares and processed once its checkpoint is completed, an entry not verified stops the streaming with
+// ErrEntryProofInvalid. A nil function disables it (call before Start)
+func (c *StreamClient) SetRequireProofs(trustedRoot CheckpointRootFunc) {
+	c.trustedRoot = trustedRoot
+}
+
+// NewTrustedRoots returns a function getting the checkpoint roots from a trusted server (e.g. the master server of
+// the relays) through a started client connected to it, caching them
+func NewTrustedRoots(trusted *StreamClient) CheckpointRootFunc {
+	var mutex sync.Mutex
+	roots := map[uint64][]byte{}
+	var baseEntry, interval uint64 // Checkpoints layout, learned from the first proof
+
+	return func(entryNum uint64) ([]byte, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if interval > 0 && entryNum >= baseEntry {
+			root, ok := roots[(entryNum-baseEntry)/interval]
+			if ok {
+				return root, nil
+			}
+		}
+
+		proof, err := trusted.ExecCommandGetCheckpointProof(entryNum)
+		if err != nil {
+			return nil, err
+		}
+		baseEntry, interval = proof.FromEntry-proof.Checkpoint*proof.Entries, proof.Entries
+		roots[proof.Checkpoint] = proof.Root
+		return proof.Root, nil
+	}
+}
+
+// verifyEntry verifies a streaming entry against the trusted root of its checkpoint (if required), waiting for its
+// checkpoint to be completed
+func (c *StreamClient) verifyEntry(e *FileEntry) error {
+	if c.trustedRoot == nil {
+		return nil
+	}
+
+	for {
+		proof, err := c.ExecCommandGetCheckpointProof(e.Number)
+		var root []byte
+		if err == nil {
+			root, err = c.trustedRoot(e.Number)
+		}
+		if errors.Is(err, ErrEntryNotCheckpointed) {
+			time.Sleep(proofRetryInterval)
+			continue
+		}
+		if err != nil {
+			log.Errorf("%s Error getting the proof of entry %d: %v", c.ID, e.Number, err)
+			return err
+		}
+
+		if !VerifyEntryInclusion(*e, proof, root) {
+			log.Errorf("%s Entry %d not verified in the trusted root [%x] of checkpoint %d", c.ID, e.Number, root,
+				proof.Checkpoint)
+			return ErrEntryProofInvalid
+		}
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRequireProofs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow integration test, skipped in short mode")
+	}
+	newServer := func(name string, tampered bool) (*datastreamer.StreamServer, uint16) {
+		server, port := newTestServer(t, name)
+		require.NoError(t, server.SetCheckpoints(2))
+		require.NoError(t, server.Start())
+		require.NoError(t, server.StartAtomicOp())
+		for i := 0; i < 6; i++ {
+			data := testEntries[1].Encode()
+			if tampered && i == 3 {
+				data[0]++
+			}
+			_, err := server.AddStreamEntry(entryType1, data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+		return server, port
+	}
+	trusted, trustedPort := newServer("trusted.bin", false)
+	honest, honestPort := newServer("honest.bin", false)
+	_, tamperedPort := newServer("tampered.bin", true)
+
+	trustedClient, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", trustedPort), streamType)
+	require.NoError(t, err)
+	require.NoError(t, trustedClient.Start())
+	trustedRoots := datastreamer.NewTrustedRoots(trustedClient)
+
+	startClient := func(port uint16) func() []uint64 {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		client.SetRequireProofs(trustedRoots)
+		var mutex sync.Mutex
+		received := []uint64{}
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			received = append(received, e.Number)
+			mutex.Unlock()
+			return nil
+		})
+		require.NoError(t, client.Start())
+		require.NoError(t, client.ExecCommandStart(0))
+		return func() []uint64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]uint64{}, received...)
+		}
+	}
+
+	// Case: Verify with the trusted roots -> OK
+	entry, err := honest.GetEntry(1)
+	require.NoError(t, err)
+	proof, err := honest.GetCheckpointProof(1)
+	require.NoError(t, err)
+	root, err := trustedRoots(1)
+	require.NoError(t, err)
+	require.True(t, datastreamer.VerifyEntryInclusion(entry, proof, root))
+	require.False(t, datastreamer.VerifyEntryInclusion(entry, proof, make([]byte, len(root))))
+
+	// Case: Streaming from an honest server -> entries processed once checkpointed
+	receivedHonest := startClient(honestPort)
+	require.Eventually(t, func() bool {
+		return len(receivedHonest()) == 6
+	}, 2*time.Second, 10*time.Millisecond)
+	for _, server := range []*datastreamer.StreamServer{trusted, honest} {
+		addTestEntries(t, server, 1)
+	}
+	require.Never(t, func() bool {
+		return len(receivedHonest()) > 6
+	}, 300*time.Millisecond, 10*time.Millisecond)
+	for _, server := range []*datastreamer.StreamServer{trusted, honest} {
+		addTestEntries(t, server, 1)
+	}
+	require.Eventually(t, func() bool {
+		return len(receivedHonest()) == 8
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Case: Streaming from a tampered server -> streaming stopped at the first checkpoint not verified
+	receivedTampered := startClient(tamperedPort)
+	require.Eventually(t, func() bool {
+		return len(receivedTampered()) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Never(t, func() bool {
+		return len(receivedTampered()) > 2
+	}, 300*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,94 @@
+package datastreamer
+
+import (
+	"context"
+	"time"
+)
+
+// pullDelivery type for the delivery of the streaming entries to the consumer pulling them
+type pullDelivery struct {
+	buffer  int
+	entries chan FileEntry // Entries delivered pending to read, closed once the consumption of the streaming ends
+	err     error          // Error ending the consumption of the streaming (set before closing entries)
+}
+
+// SetPullDelivery sets the client to deliver the streaming entries to the consumer pulling them, with ReadEntry or
+// ranging over Entries, instead of the process entry function (SetProcessEntryFunc), so the consumer runs its own
+// concurrency model. Up to buffer entries are delivered ahead of the reads (0 to hand them over one by one), and the
+// streaming waits for the consumer meanwhile (backpressure, detected as a slow consumer if set). The checkpoint
+// advances once an entry is handed over. The entries are delivered in order, so the workers and the prefetch aren't
+// used, and the subscriptions keep their process entry functions. The channel is closed once the client stops (call
+// before Start)
+func (c *StreamClient) SetPullDelivery(enabled bool, buffer int) {
+	if !enabled {
+		c.pull = nil
+		return
+	}
+	c.pull = &pullDelivery{
+		buffer:  max(buffer, 0),
+		entries: make(chan FileEntry, max(buffer, 0)),
+	}
+}
+
+// Entries returns the channel of the streaming entries delivered to the consumer pulling them, closed once the
+// client stops (a new one once started again). Returns a closed channel if the pull delivery isn't set
+func (c *StreamClient) Entries() <-chan FileEntry {
+	if c.pull == nil {
+		closed := make(chan FileEntry)
+		close(closed)
+		return closed
+	}
+	return c.pull.entries
+}
+
+// ReadEntry reads the next streaming entry delivered (see SetPullDelivery), waiting for it
+func (c *StreamClient) ReadEntry() (FileEntry, error) {
+	return c.ReadEntryContext(context.Background())
+}
+
+// ReadEntryContext reads the next streaming entry delivered (see SetPullDelivery), waiting for it until the context
+// is done. Returns the error stopping the client (ErrClientStopped if closed) once the entries delivered are read
+func (c *StreamClient) ReadEntryContext(ctx context.Context) (FileEntry, error) {
+	if c.pull == nil {
+		return FileEntry{}, ErrPullNotEnabled
+	}
+	select {
+	case e, ok := <-c.pull.entries:
+		if !ok {
+			if c.pull.err != nil {
+				return FileEntry{}, c.pull.err
+			}
+			return FileEntry{}, ErrClientStopped
+		}
+		return e, nil
+	case <-ctx.Done():
+		return FileEntry{}, ctx.Err()
+	}
+}
+
+// deliverPulled hands over a streaming entry to the consumer pulling them, waiting for it until the client is stopped
+func (c *StreamClient) deliverPulled(e *FileEntry) {
+	c.slow.begin(e.Number)
+	defer c.slow.end()
+
+	start := time.Now()
+	select {
+	case c.pull.entries <- *e:
+	case <-c.done:
+		c.stats.entryDropped(StatDropStop)
+		return
+	}
+	c.stats.entryProcessed(time.Since(start))
+	c.stats.entryDelivered()
+	c.checkpoint.entryProcessed(e.Number)
+}
+
+// endPull closes the channel of the entries delivered to the consumer pulling them, once the consumption of the
+// streaming ends with the error stopping it (if any)
+func (c *StreamClient) endPull(err error) {
+	if c.pull == nil {
+		return
+	}
+	c.pull.err = err
+	close(c.pull.entries)
+}
@@ -0,0 +1,70 @@
+package datastreamer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPullDelivery(t *testing.T) {
+	server, port := newTestServer(t, "pull.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 5)
+
+	// Case: Read without the pull delivery set -> Rejected, entries channel closed
+	plain, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	_, err = plain.ReadEntry()
+	require.ErrorIs(t, err, datastreamer.ErrPullNotEnabled)
+	_, ok := <-plain.Entries()
+	require.False(t, ok)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType,
+		datastreamer.WithPullDelivery(2))
+	require.NoError(t, err)
+	client.SetProcessEntryFunc(func(*datastreamer.FileEntry, *datastreamer.StreamClient,
+		*datastreamer.StreamServer) error {
+		return errors.New("process entry function called")
+	})
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+
+	// Case: Entries pulled by the consumer -> In order, with ReadEntry and ranging over Entries
+	entry, err := client.ReadEntry()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), entry.Number)
+	next := uint64(1)
+	for e := range client.Entries() {
+		require.Equal(t, next, e.Number)
+		require.Equal(t, testEntries[1].Encode(), e.Data)
+		next++
+		if next == 5 {
+			break
+		}
+	}
+	require.Eventually(t, func() bool { return client.GetStats().Delivered == 5 }, 5*time.Second,
+		10*time.Millisecond)
+
+	// Case: No entry pending -> Read canceled with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.ReadEntryContext(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Case: Client closed -> Entries channel closed, started again with a new one
+	entries := client.Entries()
+	require.NoError(t, client.Close())
+	_, ok = <-entries
+	require.False(t, ok)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(4))
+	entry, err = client.ReadEntry()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), entry.Number)
+}
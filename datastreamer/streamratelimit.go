@@ -0,0 +1,70 @@
+package datastreamer
+
+import (
+	"time"
+)
+
+// rateLimiter type for the limits of the consumption rate of the streaming entries, by entries and by bytes
+type rateLimiter struct {
+	entries tokenBucket // Entries per second
+	bytes   tokenBucket // Bytes of the data entries per second
+}
+
+// tokenBucket type for a token bucket refilled at a rate, holding up to a second of tokens (burst)
+type tokenBucket struct {
+	rate   float64   // Tokens per second (0 no limit)
+	tokens float64   // Tokens available, negative while a reservation is pending
+	last   time.Time // Latest refill
+}
+
+// SetRateLimit sets the client to limit the consumption rate of the streaming entries to entriesPerSec entries and
+// bytesPerSec bytes of data per second (0 disables each limit), e.g. so a client catching up doesn't overwhelm its
+// downstream database. The limit applies backpressure: the reads from the server are paused until the rate allows
+// the next entry, instead of buffering the entries, so the flow control of the connection throttles the server (the
+// results of the commands over the streaming connection are delayed meanwhile too). Bursts of up to a second of the
+// rates are allowed, an entry larger than a second of bytes waits proportionally. The time paused is returned in the
+// `throttledMs` field of the client statistics (call before Start)
+func (c *StreamClient) SetRateLimit(entriesPerSec float64, bytesPerSec uint64) {
+	if entriesPerSec <= 0 && bytesPerSec == 0 {
+		c.rateLimit = nil
+		return
+	}
+	c.rateLimit = &rateLimiter{
+		entries: tokenBucket{rate: max(entriesPerSec, 0)},
+		bytes:   tokenBucket{rate: float64(bytesPerSec)},
+	}
+}
+
+// limitRate waits until the consumption rate allows a streaming entry received, pausing the reads. Returns false if
+// the client is stopped meanwhile
+func (c *StreamClient) limitRate(e *FileEntry) bool {
+	if c.rateLimit == nil {
+		return true
+	}
+	now := time.Now()
+	delay := max(c.rateLimit.entries.reserve(1, now), c.rateLimit.bytes.reserve(float64(len(e.Data)), now))
+	if delay <= 0 {
+		return true
+	}
+	c.stats.throttledFor(delay)
+	return c.wait(delay)
+}
+
+// reserve takes tokens from the bucket, returns the wait until they are refilled (0 if available)
+func (b *tokenBucket) reserve(tokens float64, now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	if b.last.IsZero() {
+		b.tokens = b.rate
+	} else {
+		b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	b.tokens -= tokens
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
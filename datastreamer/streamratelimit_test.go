@@ -0,0 +1,55 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRateLimit(t *testing.T) {
+	server, port := newTestServer(t, "ratelimit.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 30)
+	entrySize := uint64(len(testEntries[1].Encode()))
+
+	stream := func(entriesPerSec float64, bytesPerSec uint64) (time.Duration, datastreamer.ClientStats) {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		defer func() { _ = client.Close() }()
+		client.SetRateLimit(entriesPerSec, bytesPerSec)
+		processed := make(chan uint64, 30)
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+			_ *datastreamer.StreamServer) error {
+			processed <- e.Number
+			return nil
+		})
+		require.NoError(t, client.Start())
+		start := time.Now()
+		require.NoError(t, client.ExecCommandStart(0))
+		for i := uint64(0); i < 30; i++ {
+			require.Equal(t, i, <-processed)
+		}
+		return time.Since(start), client.GetStats()
+	}
+
+	// Case: No rate limit -> Entries consumed at once
+	elapsed, stats := stream(0, 0)
+	require.Less(t, elapsed, 250*time.Millisecond)
+	require.Zero(t, stats.ThrottledMs)
+
+	// Case: 20 entries per second -> Burst of 20 entries, the next 10 paused for half a second
+	elapsed, stats = stream(20, 0)
+	require.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	require.Greater(t, stats.ThrottledMs, 0.0)
+
+	// Case: 40 entries per second in bytes -> Burst of 20 entries, no pause
+	elapsed, _ = stream(0, 40*entrySize)
+	require.Less(t, elapsed, 250*time.Millisecond)
+
+	// Case: 20 entries per second in bytes -> Burst of 20 entries, the next 10 paused for half a second
+	elapsed, _ = stream(100, 20*entrySize)
+	require.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+}
@@ -0,0 +1,101 @@
+package datastreamer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// Service manager (systemd) notification states
+const (
+	sdNotifyReady    = "READY=1"
+	sdNotifyStopping = "STOPPING=1"
+)
+
+// readiness type for the content of the readiness file
+type readiness struct {
+	Pid          int        `json:"pid"`
+	Port         uint16     `json:"port"`
+	StreamType   StreamType `json:"streamType"`
+	TotalEntries uint64     `json:"totalEntries"`
+	Time         time.Time  `json:"time"`
+}
+
+// SetReadinessFile sets the file written once the server has opened the stream file and is accepting connections,
+// and removed on shutdown (call before Start)
+func (s *StreamServer) SetReadinessFile(fileName string) {
+	s.readinessFile = fileName
+}
+
+// notifyReady writes the readiness file (unless the port is held closed, standby relay) and notifies the service
+// manager the server is ready
+func (s *StreamServer) notifyReady() {
+	if !s.holdListen {
+		s.writeReadinessFile()
+	}
+
+	err := sdNotify(sdNotifyReady)
+	if err != nil {
+		log.Errorf("Error notifying readiness to the service manager: %v", err)
+	}
+}
+
+// notifyStopping removes the readiness file and notifies the service manager the server is stopping
+func (s *StreamServer) notifyStopping() {
+	s.removeReadinessFile()
+
+	err := sdNotify(sdNotifyStopping)
+	if err != nil {
+		log.Errorf("Error notifying stopping to the service manager: %v", err)
+	}
+}
+
+// writeReadinessFile writes the readiness file (if set)
+func (s *StreamServer) writeReadinessFile() {
+	if s.readinessFile == "" {
+		return
+	}
+
+	err := writeJSONFile(s.readinessFile, readiness{
+		Pid:          os.Getpid(),
+		Port:         s.port,
+		StreamType:   s.streamType,
+		TotalEntries: s.streamFile.getHeaderEntry().TotalEntries,
+		Time:         time.Now(),
+	})
+	if err != nil {
+		log.Errorf("Error writing readiness file %s: %v", s.readinessFile, err)
+	}
+}
+
+// removeReadinessFile removes the readiness file (if set)
+func (s *StreamServer) removeReadinessFile() {
+	if s.readinessFile == "" {
+		return
+	}
+
+	err := os.Remove(s.readinessFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Errorf("Error removing readiness file %s: %v", s.readinessFile, err)
+	}
+}
+
+// sdNotify sends a state notification to the service manager socket (NOTIFY_SOCKET), if any
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
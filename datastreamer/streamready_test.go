@@ -0,0 +1,56 @@
+package datastreamer_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerReadiness(t *testing.T) {
+	tempDir := t.TempDir()
+	readinessFile := tempDir + "/ready.json"
+
+	// Fake service manager socket
+	socket, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: tempDir + "/notify.sock", Net: "unixgram"})
+	require.NoError(t, err)
+	defer socket.Close()
+	t.Setenv("NOTIFY_SOCKET", tempDir+"/notify.sock")
+	readNotify := func() string {
+		buffer := make([]byte, 64)
+		require.NoError(t, socket.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := socket.Read(buffer)
+		require.NoError(t, err)
+		return string(buffer[:n])
+	}
+
+	port := freePort(t)
+	server := openTestServer(t, port, tempDir+"/readiness.bin")
+	server.SetReadinessFile(readinessFile)
+
+	// Case: Server not started -> Not ready
+	require.NoFileExists(t, readinessFile)
+
+	// Case: Server started -> Ready notified and readiness file written
+	err = server.Start()
+	require.NoError(t, err)
+	require.Equal(t, "READY=1", readNotify())
+	data, err := os.ReadFile(readinessFile)
+	require.NoError(t, err)
+	var ready map[string]any
+	require.NoError(t, json.Unmarshal(data, &ready))
+	require.Equal(t, float64(port), ready["port"])
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	require.NoError(t, err)
+	conn.Close()
+
+	// Case: Server shutdown -> Stopping notified and readiness file removed
+	err = server.Shutdown(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "STOPPING=1", readNotify())
+	require.NoFileExists(t, readinessFile)
+}
@@ -0,0 +1,52 @@
+package datastreamer
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// Rebind moves the listener of the server to a new address (host:port, an empty host for all the interfaces, e.g.
+// ":7901" or "10.0.0.2:7900") without restarting the process. The new listener is opened first, so on error the
+// current one keeps accepting the connections, then the current one is closed. The clients connected keep their
+// connections (their new command connections dial the address they're configured with). Before Start, or while a
+// standby relay is held closed, it just sets the address opened later
+func (s *StreamServer) Rebind(address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrInvalidListenAddress
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return ErrInvalidListenAddress
+	}
+
+	s.mutexListen.Lock()
+	old := s.ln
+	if old == nil {
+		s.host, s.port = host, uint16(port)
+		s.mutexListen.Unlock()
+		return nil
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		s.mutexListen.Unlock()
+		log.Errorf("Error rebinding datastream server to %s, listening on port %d: %v", address, s.port, err)
+		return err
+	}
+	s.ln = ln
+	s.host, s.port = host, uint16(ln.Addr().(*net.TCPAddr).Port) //nolint:gosec,forcetypeassert
+	s.mutexListen.Unlock()
+
+	log.Infof("Listening on %s, rebound from %s", ln.Addr(), old.Addr())
+	s.spawn(subsysAccept, func() { s.waitConnections(ln) })
+	_ = old.Close()
+	s.writeReadinessFile()
+	return nil
+}
+
+// Rebind moves the listener of the relay to a new address without restarting (see StreamServer.Rebind)
+func (r *StreamRelay) Rebind(address string) error {
+	return r.server.Rebind(address)
+}
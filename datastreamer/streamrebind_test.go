@@ -0,0 +1,67 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRebind(t *testing.T) {
+	server, port := newTestServer(t, "rebind.bin")
+	newPort := freePort(t)
+	require.NoError(t, server.Start())
+	addEntry := func() uint64 {
+		require.NoError(t, server.StartAtomicOp())
+		entryNum, err := server.AddStreamEntry(entryType1, testEntries[1].Encode())
+		require.NoError(t, err)
+		require.NoError(t, server.CommitAtomicOp())
+		return entryNum
+	}
+	addEntry()
+
+	received := make(chan uint64, 16)
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		received <- e.Number
+		return nil
+	})
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(1))
+
+	// Case: Invalid address or port in use -> Rejected, the current listener keeps accepting
+	require.ErrorIs(t, server.Rebind("localhost"), datastreamer.ErrInvalidListenAddress)
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", newPort))
+	require.NoError(t, err)
+	require.Error(t, server.Rebind(fmt.Sprintf(":%d", newPort)))
+	require.NoError(t, ln.Close())
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// Case: Rebind to a new port -> New connections there, the old port closed, the clients streaming kept
+	require.NoError(t, server.Rebind(fmt.Sprintf("127.0.0.1:%d", newPort)))
+	_, err = net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	require.Error(t, err)
+	entryNum := addEntry()
+	select {
+	case number := <-received:
+		require.Equal(t, entryNum, number)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for entry %d", entryNum)
+	}
+	rebound, err := datastreamer.NewClient(fmt.Sprintf("127.0.0.1:%d", newPort), streamType)
+	require.NoError(t, err)
+	defer func() { _ = rebound.Close() }()
+	require.NoError(t, rebound.Start())
+	header, err := rebound.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), header.TotalEntries)
+	require.Zero(t, server.GetStats().AcceptErrors)
+}
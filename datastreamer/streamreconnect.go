@@ -0,0 +1,114 @@
+package datastreamer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const maxBackoffShift = 30 // Maximum doublings of the reconnection backoff, to not overflow it
+
+// ReconnectPolicy type for the policy of the client connection attempts to the server, on start and on reconnection
+type ReconnectPolicy struct {
+	Backoff    time.Duration // Wait after the first failed attempt in a row (5s if 0)
+	MaxBackoff time.Duration // Maximum wait, doubled on each failed attempt in a row up to it (Backoff if lower)
+	Jitter     float64       // Random jitter of the wait, as a fraction of it (0 none, up to 1)
+	MaxRetries int           // Retries of the failed attempts in a row before giving up (0 no limit)
+	OnGiveUp   func(error)   // Hook called with the error once the client gives up (nil none)
+
+	FailoverAfter int // Failed attempts in a row to a server before failing over to the next one of the list (1 if 0)
+}
+
+// reconnectState type for the state of the connection attempts of the client
+type reconnectState struct {
+	policy   ReconnectPolicy
+	failures int   // Failed attempts in a row
+	lastErr  error // Error of the latest failed attempt
+
+	serverFailures int // Failed attempts in a row to the current server
+	tried          int // Servers failed over since the latest connection established
+}
+
+// SetReconnectPolicy sets the policy of the connection attempts to the server: the wait between the failed attempts
+// in a row, doubled up to the maximum with a random jitter (so the clients of a server restarted don't reconnect
+// together), and the retries before giving up on a permanently unreachable server. Once given up, the hook is called
+// with an error wrapping ErrServerUnreachable, returned by Start (the client isn't started) or stopping the client
+// started (returned by Run). With a list of servers (comma separated address of NewClient), the client fails over to
+// the next one after the failed attempts in a row to the current one, right away while there are servers not tried
+// since the latest connection. The default policy retries every 5 seconds forever (call before Start)
+func (c *StreamClient) SetReconnectPolicy(policy ReconnectPolicy) {
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultTimeout
+	}
+	policy.MaxBackoff = max(policy.MaxBackoff, policy.Backoff)
+	policy.Jitter = min(max(policy.Jitter, 0), 1)
+	policy.MaxRetries = max(policy.MaxRetries, 0)
+	policy.FailoverAfter = max(policy.FailoverAfter, 1)
+	c.reconnect.policy = policy
+}
+
+// SetReconnectPolicy sets the policy of the relay connection attempts to the master server (see
+// StreamClient.SetReconnectPolicy)
+func (r *StreamRelay) SetReconnectPolicy(policy ReconnectPolicy) {
+	r.client.SetReconnectPolicy(policy)
+}
+
+// backoff returns the wait after a number of failed attempts in a row
+func (p *ReconnectPolicy) backoff(failures int) time.Duration {
+	wait := p.Backoff
+	if wait <= 0 {
+		wait = defaultTimeout
+	}
+	for i := 1; i < min(failures, maxBackoffShift) && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 {
+		wait = min(wait, p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		jitter := (rand.Float64()*2 - 1) * p.Jitter * float64(wait) //nolint:gosec
+		wait += time.Duration(jitter)
+	}
+	return wait
+}
+
+// retryConnect records a failed connection attempt and waits before the next one. Returns the error giving up once
+// the attempts are exhausted
+func (c *StreamClient) retryConnect(ctx context.Context, err error) error {
+	r := &c.reconnect
+	r.failures++
+	r.serverFailures++
+	r.lastErr = err
+	if r.policy.MaxRetries > 0 && r.failures > r.policy.MaxRetries {
+		errGiveUp := fmt.Errorf("%w after %d attempts: %v", ErrServerUnreachable, r.failures, r.lastErr)
+		log.Errorf("Giving up connecting to server %s: %v", c.serverAddr(), errGiveUp)
+		r.failures = 0
+		r.serverFailures = 0
+		r.tried = 0
+		if r.policy.OnGiveUp != nil {
+			r.policy.OnGiveUp(errGiveUp)
+		}
+		return errGiveUp
+	}
+
+	// Fail over to the next server, right away if not tried since the latest connection
+	if r.serverFailures >= max(r.policy.FailoverAfter, 1) && c.failover(err) {
+		return nil
+	}
+
+	wait := r.policy.backoff(r.failures)
+	log.Debugf("Retrying connection to server %s in %v (attempt %d)", c.serverAddr(), wait, r.failures+1)
+	c.waitContext(ctx, wait)
+	return nil
+}
+
+// connectDone records a connection established, resetting the failed attempts
+func (c *StreamClient) connectDone() {
+	c.reconnect.failures = 0
+	c.reconnect.lastErr = nil
+	c.reconnect.serverFailures = 0
+	c.reconnect.tried = 0
+}
@@ -0,0 +1,64 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientReconnectPolicy(t *testing.T) {
+	port := freePort(t)
+	var mutex sync.Mutex
+	givenUp := []error{}
+	policy := datastreamer.ReconnectPolicy{
+		Backoff:    20 * time.Millisecond,
+		MaxBackoff: 80 * time.Millisecond,
+		Jitter:     0.5,
+		MaxRetries: 3,
+		OnGiveUp: func(err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			givenUp = append(givenUp, err)
+		},
+	}
+
+	// Case: Server not listening -> Start gives up after the retries, hook called
+	client, err := datastreamer.NewClient(fmt.Sprintf("127.0.0.1:%d", port), streamType)
+	require.NoError(t, err)
+	client.SetReconnectPolicy(policy)
+	start := time.Now()
+	require.ErrorIs(t, client.Start(), datastreamer.ErrServerUnreachable)
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.False(t, client.IsStarted())
+	require.Equal(t, uint64(4), client.GetStats().Errors[datastreamer.StatErrConnect])
+	mutex.Lock()
+	require.Len(t, givenUp, 1)
+	mutex.Unlock()
+
+	// Case: Server lost while running -> Client stopped after the retries, Run returns the error
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	require.NoError(t, err)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	require.NoError(t, client.Start())
+	conn := <-accepted
+	require.NoError(t, ln.Close())
+	require.NoError(t, conn.Close())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.ErrorIs(t, client.Run(ctx), datastreamer.ErrServerUnreachable)
+	mutex.Lock()
+	require.Len(t, givenUp, 2)
+	mutex.Unlock()
+}
@@ -0,0 +1,137 @@
+package datastreamer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// RedactAction type of the transformation of the payload of the data entries redacted
+type RedactAction uint8
+
+const (
+	// RedactZero zeroes the payload bytes after the bytes kept, keeping the payload size
+	RedactZero RedactAction = iota
+	// RedactTruncate truncates the payload to the bytes kept
+	RedactTruncate
+)
+
+// RedactRule type for a redaction rule of the payload of the data entries of a type (all its versions)
+type RedactRule struct {
+	EntryType EntryType    // Base entry type redacted
+	Action    RedactAction // Transformation of the payload
+	Keep      int          // Payload bytes kept as is from the start (e.g. a public prefix)
+}
+
+// ParseRedactRules parses a list of redaction rules separated by commas, each of them `type:zero`, `type:zero=N`
+// (zeroing the payload after its first N bytes) or `type:truncate=N` (truncating the payload to its first N bytes),
+// e.g. `2:zero,3:truncate=32`. The entry types are decimal or hex (0x...), the bookmarks can't be redacted
+func ParseRedactRules(spec string) ([]RedactRule, error) {
+	rules := []RedactRule{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		etype, action, found := strings.Cut(item, ":")
+		if !found {
+			return nil, failRedactRule(item, "missing action")
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(etype), 0, 32)
+		if err != nil {
+			return nil, failRedactRule(item, "invalid entry type")
+		}
+		rule := RedactRule{EntryType: EntryType(value)}
+
+		action, keep, hasKeep := strings.Cut(strings.TrimSpace(action), "=")
+		switch action {
+		case "zero":
+			rule.Action = RedactZero
+		case "truncate":
+			rule.Action = RedactTruncate
+			if !hasKeep {
+				return nil, failRedactRule(item, "missing bytes kept of truncate")
+			}
+		default:
+			return nil, failRedactRule(item, "unknown action "+action)
+		}
+		if hasKeep {
+			rule.Keep, err = strconv.Atoi(strings.TrimSpace(keep))
+			if err != nil || rule.Keep < 0 {
+				return nil, failRedactRule(item, "invalid bytes kept")
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, failRedactRule(spec, "no rules")
+	}
+	return rules, nil
+}
+
+// NewRedactMiddleware creates a send middleware of a relay transforming the payload of the data entries of the
+// types of the rules, so the sensitive fields are withheld from its public clients. The entries are still sent, with
+// their numbers, and the bookmarks are never redacted, so the clients keep streaming and resuming from them
+func NewRedactMiddleware(rules []RedactRule) (EntryMiddleware, error) {
+	byType, err := redactRulesByType(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next EntryHandler) EntryHandler {
+		return func(e *FileEntry) error {
+			rule, found := byType[e.Type.Base()]
+			if !found || len(e.Data) <= rule.Keep {
+				return next(e)
+			}
+			e.Data = redactData(e.Data, rule)
+			return next(e)
+		}
+	}, nil
+}
+
+// redactRulesByType validates the redaction rules and returns them by base entry type
+func redactRulesByType(rules []RedactRule) (map[EntryType]RedactRule, error) {
+	byType := make(map[EntryType]RedactRule, len(rules))
+	for _, rule := range rules {
+		switch {
+		case rule.EntryType.Base() == EtBookmark:
+			return nil, failRedactRule(strconv.FormatUint(uint64(rule.EntryType), 10), "bookmarks can't be redacted")
+		case rule.Action != RedactZero && rule.Action != RedactTruncate:
+			return nil, failRedactRule(strconv.FormatUint(uint64(rule.EntryType), 10), "unknown action")
+		case rule.Keep < 0:
+			return nil, failRedactRule(strconv.FormatUint(uint64(rule.EntryType), 10), "invalid bytes kept")
+		}
+		byType[rule.EntryType.Base()] = rule
+	}
+	return byType, nil
+}
+
+// SetRedaction sets the redaction rules of the payload of the data entries forwarded to the relay clients (call
+// before Start)
+func (r *StreamRelay) SetRedaction(rules []RedactRule) error {
+	redact, err := NewRedactMiddleware(rules)
+	if err != nil {
+		return err
+	}
+	r.UseSendMiddleware(redact)
+	return nil
+}
+
+// redactData returns a copy of the payload of a data entry redacted by a rule (the payload may be shared, e.g. with
+// the live queues, so it's never modified in place)
+func redactData(data []byte, rule RedactRule) []byte {
+	if rule.Action == RedactTruncate {
+		return append([]byte(nil), data[:rule.Keep]...)
+	}
+	redacted := make([]byte, len(data))
+	copy(redacted, data[:rule.Keep])
+	return redacted
+}
+
+// failRedactRule logs the error of a redaction rule and returns ErrInvalidRedactRule
+func failRedactRule(rule string, reason string) error {
+	log.Errorf("Invalid redaction rule %q: %s", rule, reason)
+	return ErrInvalidRedactRule
+}
@@ -0,0 +1,66 @@
+package datastreamer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRedactRules(t *testing.T) {
+	// Case: Valid rules -> OK
+	rules, err := ParseRedactRules("2:zero, 0x3:zero=4,5:truncate=32")
+	require.NoError(t, err)
+	assert.Equal(t, []RedactRule{
+		{EntryType: 2, Action: RedactZero},
+		{EntryType: 3, Action: RedactZero, Keep: 4},
+		{EntryType: 5, Action: RedactTruncate, Keep: 32},
+	}, rules)
+
+	// Case: Invalid rules -> FAIL
+	for _, spec := range []string{"", ",", "2", "x:zero", "2:hide", "2:truncate", "2:zero=x", "2:truncate=-1",
+		"0xb0:zero"} {
+		rules, err = ParseRedactRules(spec)
+		if err == nil {
+			_, err = NewRedactMiddleware(rules)
+		}
+		assert.ErrorIs(t, err, ErrInvalidRedactRule, spec)
+	}
+}
+
+func TestRedactMiddleware(t *testing.T) {
+	redact, err := NewRedactMiddleware([]RedactRule{
+		{EntryType: 2, Action: RedactZero, Keep: 1},
+		{EntryType: 3, Action: RedactTruncate, Keep: 2},
+	})
+	require.NoError(t, err)
+	chain := entryChain{redact}
+	data := []byte{1, 2, 3, 4}
+
+	// Case: Entry type zeroed (any version) -> Same size and number, payload zeroed after the bytes kept
+	entry := FileEntry{packetType: PtData, Type: VersionedEntryType(2, 1), Number: 7, Data: data}
+	passed, err := chain.apply(&entry)
+	require.NoError(t, err)
+	assert.True(t, passed)
+	assert.Equal(t, uint64(7), entry.Number)
+	assert.Equal(t, []byte{1, 0, 0, 0}, entry.Data)
+	assert.Equal(t, uint32(FixedSizeFileEntry+4), entry.Length)
+
+	// Case: Entry type truncated -> Payload truncated to the bytes kept, original payload not modified
+	entry = FileEntry{packetType: PtData, Type: 3, Number: 8, Data: data}
+	passed, err = chain.apply(&entry)
+	require.NoError(t, err)
+	assert.True(t, passed)
+	assert.Equal(t, []byte{1, 2}, entry.Data)
+	assert.Equal(t, uint32(FixedSizeFileEntry+2), entry.Length)
+	assert.Equal(t, []byte{1, 2, 3, 4}, data)
+
+	// Case: Other entry types and bookmarks -> Not redacted
+	for _, etype := range []EntryType{1, EtBookmark} {
+		entry = FileEntry{packetType: PtData, Type: etype, Number: 9, Data: data}
+		passed, err = chain.apply(&entry)
+		require.NoError(t, err)
+		assert.True(t, passed)
+		assert.Equal(t, data, entry.Data)
+	}
+}
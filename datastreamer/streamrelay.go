@@ -8,29 +8,40 @@ import (
 
 // StreamRelay type to manage a data stream relay
 type StreamRelay struct {
-	client *StreamClient
-	server *StreamServer
+	client  *StreamClient
+	server  *StreamServer
+	embargo relayEmbargo
+	standby relayStandby
 }
 
 // NewRelay creates a new data stream relay
 func NewRelay(server string, port uint16, version uint8, systemID uint64,
 	streamType StreamType, fileName string, writeTimeout time.Duration,
 	inactivityTimeout time.Duration, inactivityCheckInterval time.Duration, cfg *log.Config) (*StreamRelay, error) {
+	// Create server side
+	s, err := NewServer(port, version, systemID, streamType, fileName, writeTimeout,
+		inactivityTimeout, inactivityCheckInterval, cfg)
+	if err != nil {
+		log.Errorf("Error creating relay server side: %v", err)
+		return nil, err
+	}
+
+	return newRelay(server, streamType, s)
+}
+
+// newRelay creates a new data stream relay from its server side
+func newRelay(server string, streamType StreamType, s *StreamServer) (*StreamRelay, error) {
 	var r StreamRelay
 	var err error
+	r.embargo.signal = make(chan struct{}, 1)
+	r.server = s
+	r.server.SetLiveQueues(GetBufferSizes().RelayLiveQueue)
 
 	// Create client side
 	r.client, err = NewClient(server, streamType)
 	if err != nil {
 		log.Errorf("Error creating relay client side: %v", err)
-		return nil, err
-	}
-
-	// Create server side
-	r.server, err = NewServer(port, version, systemID, streamType, fileName, writeTimeout,
-		inactivityTimeout, inactivityCheckInterval, cfg)
-	if err != nil {
-		log.Errorf("Error creating relay server side: %v", err)
+		_ = s.Close()
 		return nil, err
 	}
 
@@ -57,6 +68,13 @@ func (r *StreamRelay) Start() error {
 	}
 	r.server.initEntry = header.TotalEntries
 
+	// Continue the entry numbering of the master server in an empty relay stream
+	err = r.server.SetBaseEntry(header.BaseEntry)
+	if err != nil {
+		log.Errorf("Error setting base entry %d of the master server: %v", header.BaseEntry, err)
+		return err
+	}
+
 	// Start server side before exec command `CmdStart`
 	err = r.server.Start()
 	if err != nil {
@@ -64,6 +82,20 @@ func (r *StreamRelay) Start() error {
 		return err
 	}
 
+	// Wait for the stream file validation (if enabled) before writing the entries from the master server
+	err = r.server.WaitValidation()
+	if err != nil {
+		log.Errorf("Error validating relay stream file: %v", err)
+		return err
+	}
+
+	// Hold the entries received from the master server until they are released
+	if r.embargo.enabled() {
+		log.Infof("Relay release delay %v, manual release %t", r.embargo.delay, r.embargo.manual)
+		r.client.setProcessEntryFunc(r.holdEntry, r.server)
+		go r.releaseEntries()
+	}
+
 	// Sync with master server from latest received entry
 	fromEntry := r.server.GetHeader().TotalEntries
 	log.Infof("TotalEntries: RELAY %d of MASTER %d", fromEntry, r.server.initEntry)
@@ -73,9 +105,19 @@ func (r *StreamRelay) Start() error {
 		return err
 	}
 
+	// Open access to relay clients once the lease is acquired (if part of an active/standby pair)
+	r.startStandby()
+
 	return nil
 }
 
+// Shutdown stops the relay server side draining its clients up to the timeout (see StreamServer.Shutdown). The lease
+// of an active/standby pair is released first, so the standby relay is promoted meanwhile the clients are drained
+func (r *StreamRelay) Shutdown(drainTimeout time.Duration) error {
+	r.stopStandby()
+	return r.server.Shutdown(drainTimeout)
+}
+
 // relayEntry relays the entry received as client to the clients connected to the server
 func relayEntry(e *FileEntry, c *StreamClient, s *StreamServer) error {
 	// Start atomic operation
@@ -113,3 +155,34 @@ func relayEntry(e *FileEntry, c *StreamClient, s *StreamServer) error {
 
 	return nil
 }
+
+// SetReadinessFile sets the file written once the relay server side is ready to accept connections (call before Start)
+func (r *StreamRelay) SetReadinessFile(fileName string) {
+	r.server.SetReadinessFile(fileName)
+}
+
+// SetBackgroundValidation sets the lazy open mode for the relay server side (call before Start)
+func (r *StreamRelay) SetBackgroundValidation(enabled bool) {
+	r.server.SetBackgroundValidation(enabled)
+}
+
+// SetContentAddressing sets the relay server side to store the entries payload content-addressed (call before Start)
+func (r *StreamRelay) SetContentAddressing(enabled bool) error {
+	return r.server.SetContentAddressing(enabled)
+}
+
+// SetHeaderChanges sets the relay server side to record the header changes in a meta-stream (call before Start)
+func (r *StreamRelay) SetHeaderChanges(enabled bool) error {
+	return r.server.SetHeaderChanges(enabled)
+}
+
+// UseSendMiddleware adds middlewares to the chain applied to the data entries sent to the relay clients
+func (r *StreamRelay) UseSendMiddleware(middlewares ...EntryMiddleware) {
+	r.server.UseSendMiddleware(middlewares...)
+}
+
+// UseReceiveMiddleware adds middlewares to the chain applied to the data entries received from the master server
+// before storing them in the relay
+func (r *StreamRelay) UseReceiveMiddleware(middlewares ...EntryMiddleware) {
+	r.client.UseReceiveMiddleware(middlewares...)
+}
@@ -0,0 +1,155 @@
+package datastreamer
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	resourceCheckInterval = 10 * time.Second // Interval of the checks of the resources usage
+	resourceWarnRatio     = 0.9              // Usage of a limit warned as near it
+)
+
+// Subsystems of the server goroutines
+const (
+	subsysAccept      = "accept"      // Listeners accepting the connections
+	subsysConnections = "connections" // Client connections
+	subsysLive        = "live"        // Live queues of the streaming clients
+	subsysBroadcast   = "broadcast"   // Broadcast of the committed atomic operations
+	subsysValidation  = "validation"  // Background validation of the stream file
+	subsysMonitor     = "monitor"     // Inactivity checks, statistics series, SLOs and resources checks
+)
+
+// Channels of the server reported
+const (
+	chanStream     = "stream"     // Committed atomic operations pending to broadcast
+	chanLiveQueues = "liveQueues" // Live entries pending to send (fullest live queue)
+)
+
+// ResourceStats type for the resources usage of the server process, so the operators see the limits approaching
+// (e.g. too many open files with large client counts) before the accept errors
+type ResourceStats struct {
+	OpenFDs    int                     `json:"openFDs"`            // Open file descriptors of the process (-1 unknown)
+	MaxFDs     int                     `json:"maxFDs"`             // Limit of open file descriptors (0 unknown)
+	Goroutines int                     `json:"goroutines"`         // Goroutines of the process
+	Subsystems map[string]int          `json:"subsystems"`         // Goroutines of the server running by subsystem
+	Channels   map[string]ChannelUsage `json:"channels"`           // Occupancy of the server channels
+	Warnings   []string                `json:"warnings,omitempty"` // Usages near their limits
+}
+
+// ChannelUsage type for the occupancy of a channel
+type ChannelUsage struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+// serverGoroutines type for the count of the server goroutines running by subsystem
+type serverGoroutines struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+// spawn starts a goroutine of a server subsystem, counted while it's running
+func (s *StreamServer) spawn(subsystem string, f func()) {
+	s.goroutines.add(subsystem, 1)
+	go func() {
+		defer s.goroutines.add(subsystem, -1)
+		f()
+	}()
+}
+
+// add adds to the goroutines running of a subsystem
+func (g *serverGoroutines) add(subsystem string, delta int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.counts == nil {
+		g.counts = make(map[string]int)
+	}
+	g.counts[subsystem] += delta
+}
+
+// snapshot returns the goroutines running by subsystem
+func (g *serverGoroutines) snapshot() map[string]int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	counts := make(map[string]int, len(g.counts))
+	for subsystem, count := range g.counts {
+		counts[subsystem] = count
+	}
+	return counts
+}
+
+// GetResourceStats returns the resources usage of the server process: open file descriptors with their limit,
+// goroutines (by server subsystem) and occupancy of the server channels, also returned by the Stats command
+func (s *StreamServer) GetResourceStats() ResourceStats {
+	openFDs, maxFDs := countOpenFiles()
+	stats := ResourceStats{
+		OpenFDs:    openFDs,
+		MaxFDs:     maxFDs,
+		Goroutines: runtime.NumGoroutine(),
+		Subsystems: s.goroutines.snapshot(),
+		Channels: map[string]ChannelUsage{
+			chanStream: {Length: len(s.stream), Capacity: cap(s.stream)},
+		},
+	}
+
+	if s.liveQueueSize > 0 {
+		fullest := ChannelUsage{Capacity: s.liveQueueSize}
+		s.mutexClients.RLock()
+		for _, cli := range s.clients {
+			if q := cli.getLive(); q != nil {
+				fullest.Length = max(fullest.Length, len(q.entries))
+			}
+		}
+		s.mutexClients.RUnlock()
+		stats.Channels[chanLiveQueues] = fullest
+	}
+
+	stats.Warnings = stats.nearLimits()
+	return stats
+}
+
+// GetResourceStats returns the resources usage of the relay process (see StreamServer.GetResourceStats)
+func (r *StreamRelay) GetResourceStats() ResourceStats {
+	return r.server.GetResourceStats()
+}
+
+// nearLimits returns the usages near their limits (sorted)
+func (r *ResourceStats) nearLimits() []string {
+	var warnings []string
+	if r.MaxFDs > 0 && r.OpenFDs >= int(float64(r.MaxFDs)*resourceWarnRatio) {
+		warnings = append(warnings, fmt.Sprintf("open files %d of %d", r.OpenFDs, r.MaxFDs))
+	}
+	for name, usage := range r.Channels {
+		if usage.Capacity > 0 && usage.Length >= int(float64(usage.Capacity)*resourceWarnRatio) {
+			warnings = append(warnings, fmt.Sprintf("channel %s %d of %d", name, usage.Length, usage.Capacity))
+		}
+	}
+	slices.Sort(warnings)
+	return warnings
+}
+
+// checkResources periodically warns of the resources usage near the limits, once until back below them
+func (s *StreamServer) checkResources() {
+	ticker := time.NewTicker(resourceCheckInterval)
+	defer ticker.Stop()
+
+	var warned bool
+	for range ticker.C {
+		stats := s.GetResourceStats()
+		switch {
+		case len(stats.Warnings) > 0 && !warned:
+			log.Warnf("Resources usage near the limits: %v", stats.Warnings)
+		case len(stats.Warnings) == 0 && warned:
+			log.Infof("Resources usage back below the limits: %d open files of %d", stats.OpenFDs, stats.MaxFDs)
+		}
+		warned = len(stats.Warnings) > 0
+	}
+}
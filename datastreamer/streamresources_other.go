@@ -0,0 +1,8 @@
+//go:build !unix
+
+package datastreamer
+
+// countOpenFiles returns the open file descriptors of the process and their limit, unknown on this platform
+func countOpenFiles() (int, int) {
+	return -1, 0
+}
@@ -0,0 +1,60 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerResources(t *testing.T) {
+	server, port := newTestServer(t, "resources.bin")
+	server.SetLiveQueues(16)
+	require.NoError(t, server.Start())
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+
+	// Case: Client streaming -> Goroutines of the server by subsystem, channels and open files reported
+	require.Eventually(t, func() bool {
+		resources := server.GetResourceStats()
+		return resources.Subsystems["connections"] >= 1 && resources.Subsystems["live"] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	resources := server.GetResourceStats()
+	require.Equal(t, 1, resources.Subsystems["accept"])
+	require.Equal(t, 1, resources.Subsystems["broadcast"])
+	require.Equal(t, 2, resources.Subsystems["monitor"])
+	require.GreaterOrEqual(t, resources.Goroutines, 6)
+	require.NotZero(t, resources.OpenFDs)
+	require.Less(t, resources.OpenFDs, resources.MaxFDs)
+	require.Equal(t, datastreamer.ChannelUsage{Length: 0, Capacity: 16}, resources.Channels["liveQueues"])
+	require.NotZero(t, resources.Channels["stream"].Capacity)
+	require.Empty(t, resources.Warnings)
+
+	// Case: Stats command -> Resources usage included
+	serverStats, err := client.ExecCommandGetStats()
+	require.NoError(t, err)
+	require.Equal(t, 1, serverStats.Resources.Subsystems["accept"])
+	require.Equal(t, resources.MaxFDs, serverStats.Resources.MaxFDs)
+
+	// Case: Server metrics served in the Prometheus text format -> Resources usage by subsystem and channel
+	recorder := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	metrics := recorder.Body.String()
+	labels := fmt.Sprintf("stream_type=\"%d\"", streamType)
+	require.Contains(t, metrics, "# TYPE datastreamer_server_open_fds gauge\n")
+	require.Contains(t, metrics, fmt.Sprintf("datastreamer_server_max_fds{%s} %d\n", labels, resources.MaxFDs))
+	require.Contains(t, metrics, fmt.Sprintf("datastreamer_server_subsystem_goroutines{%s,subsystem=\"accept\"} 1\n",
+		labels))
+	require.Contains(t, metrics, fmt.Sprintf("datastreamer_server_channel_capacity{%s,channel=\"liveQueues\"} 16\n",
+		labels))
+	require.Contains(t, metrics, fmt.Sprintf("datastreamer_server_accept_errors_total{%s} 0\n", labels))
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package datastreamer
+
+import (
+	"math"
+	"os"
+	"syscall"
+)
+
+// countOpenFiles returns the open file descriptors of the process (-1 unknown) and their limit (0 unknown)
+func countOpenFiles() (int, int) {
+	openFDs := -1
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		entries, err := os.ReadDir(dir)
+		if err == nil {
+			openFDs = len(entries) - 1 // Without the descriptor reading the directory
+			break
+		}
+	}
+
+	var limit syscall.Rlimit
+	err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit)
+	if err != nil || limit.Cur > math.MaxInt32 {
+		return openFDs, 0
+	}
+	return openFDs, int(limit.Cur)
+}
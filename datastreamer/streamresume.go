@@ -0,0 +1,171 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const defaultCheckpointInterval = 5 * time.Second // Default interval to save the processed position of the client
+
+// CheckpointStore interface of the storage of the processed position of a client, the next entry number to process,
+// to resume the streaming from it after a restart of the process
+type CheckpointStore interface {
+	// LoadCheckpoint returns the next entry number stored, ErrCheckpointNotStored if none is stored yet
+	LoadCheckpoint() (uint64, error)
+	// SaveCheckpoint stores the next entry number to process
+	SaveCheckpoint(nextEntry uint64) error
+}
+
+// FileCheckpointStore type for a checkpoint store in a local JSON file, replaced atomically on each save
+type FileCheckpointStore struct {
+	fileName string
+}
+
+// fileCheckpoint type for the content of the checkpoint file
+type fileCheckpoint struct {
+	NextEntry uint64    `json:"nextEntry"` // Next entry number to process
+	Time      time.Time `json:"time"`      // Time the checkpoint was saved
+}
+
+// NewFileCheckpointStore creates a checkpoint store in a local file, created on the first save
+func NewFileCheckpointStore(fileName string) *FileCheckpointStore {
+	return &FileCheckpointStore{fileName: fileName}
+}
+
+// LoadCheckpoint returns the next entry number stored in the checkpoint file
+func (f *FileCheckpointStore) LoadCheckpoint() (uint64, error) {
+	data, err := os.ReadFile(f.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrCheckpointNotStored
+	}
+	if err != nil {
+		return 0, err
+	}
+	checkpoint := fileCheckpoint{}
+	err = json.Unmarshal(data, &checkpoint)
+	if err != nil {
+		return 0, err
+	}
+	return checkpoint.NextEntry, nil
+}
+
+// SaveCheckpoint stores the next entry number in the checkpoint file
+func (f *FileCheckpointStore) SaveCheckpoint(nextEntry uint64) error {
+	return writeJSONFile(f.fileName, fileCheckpoint{NextEntry: nextEntry, Time: time.Now()})
+}
+
+// clientCheckpoint type to save periodically the processed position of the streaming
+type clientCheckpoint struct {
+	store    CheckpointStore
+	interval time.Duration
+
+	next  atomic.Uint64 // Next entry number to process, after the latest entry processed (0 if none)
+	mutex sync.Mutex    // Serializes the saves
+	saved uint64        // Next entry number saved in the store
+}
+
+// SetCheckpointStore sets the client to save every interval (5 seconds if 0) in a checkpoint store the processed
+// position of the streaming, the next entry number after the latest entry processed by the process entry function,
+// and once more when the client is closed (once its goroutines exit). StartFromCheckpoint resumes the streaming from
+// it after a restart of the process, so the entries processed since the latest save are received again (at least
+// once). A nil store disables it (call before Start)
+func (c *StreamClient) SetCheckpointStore(store CheckpointStore, interval time.Duration) {
+	if store == nil {
+		c.checkpoint = nil
+		return
+	}
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	c.checkpoint = &clientCheckpoint{
+		store:    store,
+		interval: interval,
+	}
+}
+
+// StartFromCheckpoint starts the streaming from the next entry number stored in the checkpoint store, from the
+// entry 0 if none is stored yet (e.g. on the first run)
+func (c *StreamClient) StartFromCheckpoint() error {
+	return c.StartFromCheckpointContext(context.Background())
+}
+
+// StartFromCheckpointContext starts the streaming from the next entry number stored in the checkpoint store,
+// canceled with the context
+func (c *StreamClient) StartFromCheckpointContext(ctx context.Context) error {
+	if c.checkpoint == nil {
+		return ErrCheckpointStoreNotSet
+	}
+	fromEntry, err := c.checkpoint.store.LoadCheckpoint()
+	if errors.Is(err, ErrCheckpointNotStored) {
+		fromEntry, err = 0, nil
+	}
+	if err != nil {
+		log.Errorf("%s Error loading the checkpoint: %v", c.ID, err)
+		return err
+	}
+
+	log.Infof("%s Resuming the streaming from the checkpoint entry %d", c.ID, fromEntry)
+	c.checkpoint.mutex.Lock()
+	c.checkpoint.saved = fromEntry
+	c.checkpoint.mutex.Unlock()
+	c.checkpoint.next.Store(fromEntry)
+	return c.ExecCommandStartContext(ctx, fromEntry)
+}
+
+// FlushCheckpoint saves now the processed position of the streaming in the checkpoint store, if it changed since
+// the latest save
+func (c *StreamClient) FlushCheckpoint() error {
+	if c.checkpoint == nil {
+		return ErrCheckpointStoreNotSet
+	}
+	return c.checkpoint.save()
+}
+
+// entryProcessed records an entry processed by the process entry function
+func (p *clientCheckpoint) entryProcessed(entryNum uint64) {
+	if p != nil {
+		p.next.Store(entryNum + 1)
+	}
+}
+
+// save stores the processed position if it changed since the latest save
+func (p *clientCheckpoint) save() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	next := p.next.Load()
+	if next == 0 || next == p.saved {
+		return nil
+	}
+	err := p.store.SaveCheckpoint(next)
+	if err != nil {
+		return err
+	}
+	p.saved = next
+	return nil
+}
+
+// saveCheckpoints saves periodically the processed position of the streaming
+func (c *StreamClient) saveCheckpoints() {
+	for c.wait(c.checkpoint.interval) {
+		c.saveCheckpoint()
+	}
+}
+
+// saveCheckpoint saves the processed position of the streaming, logging the error
+func (c *StreamClient) saveCheckpoint() {
+	if c.checkpoint == nil {
+		return
+	}
+	err := c.checkpoint.save()
+	if err != nil {
+		log.Errorf("%s Error saving the checkpoint: %v", c.ID, err)
+	}
+}
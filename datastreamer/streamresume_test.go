@@ -0,0 +1,66 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCheckpointStore(t *testing.T) {
+	server, port := newTestServer(t, "resume.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 10)
+
+	store := datastreamer.NewFileCheckpointStore(t.TempDir() + "/client.ckp")
+	_, err := store.LoadCheckpoint()
+	require.ErrorIs(t, err, datastreamer.ErrCheckpointNotStored)
+
+	newClient := func() (*datastreamer.StreamClient, chan uint64) {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		processed := make(chan uint64, 100)
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+			_ *datastreamer.StreamServer) error {
+			processed <- e.Number
+			return nil
+		})
+		return client, processed
+	}
+
+	// Case: No checkpoint store -> Error
+	client, _ := newClient()
+	require.NoError(t, client.Start())
+	require.ErrorIs(t, client.StartFromCheckpoint(), datastreamer.ErrCheckpointStoreNotSet)
+	require.NoError(t, client.Close())
+
+	// Case: No checkpoint stored -> Streaming from the entry 0, processed position saved periodically
+	client, processed := newClient()
+	client.SetCheckpointStore(store, 10*time.Millisecond)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.StartFromCheckpoint())
+	for i := uint64(0); i < 10; i++ {
+		require.Equal(t, i, <-processed)
+	}
+	require.Eventually(t, func() bool {
+		next, err := store.LoadCheckpoint()
+		return err == nil && next == 10
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, client.Close())
+
+	// Case: Client restarted -> Streaming resumed from the checkpoint, saved on close
+	addTestEntries(t, server, 5)
+	client, processed = newClient()
+	client.SetCheckpointStore(store, time.Hour)
+	require.NoError(t, client.Start())
+	require.NoError(t, client.StartFromCheckpoint())
+	for i := uint64(10); i < 15; i++ {
+		require.Equal(t, i, <-processed)
+	}
+	require.NoError(t, client.Close())
+	next, err := store.LoadCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), next)
+}
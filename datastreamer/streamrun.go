@@ -0,0 +1,163 @@
+package datastreamer
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// Run starts the client (if not started) and blocks until the context is done or the streaming stops on a fatal
+// error (receive middleware, proof verification or process entry function error), returning the reason. Then the
+// client is stopped: its connections are closed, its goroutines exit and its subscriptions end with the same reason.
+// It fits the errgroup based service managers, e.g. g.Go(func() error { return client.Run(ctx) }). A stopped client
+// can't be started again until it's closed
+func (c *StreamClient) Run(ctx context.Context) error {
+	if c.isStopped() {
+		return ErrClientStopped
+	}
+	if !c.started {
+		err := c.StartContext(ctx)
+		if err != nil {
+			c.stop(err)
+			return err
+		}
+	}
+
+	var reason error
+	select {
+	case <-ctx.Done():
+		reason = ctx.Err()
+		log.Infof("%s Client stopped: %v", c.ID, reason)
+	case reason = <-c.fatal:
+		log.Errorf("%s Client stopped on fatal error: %v", c.ID, reason)
+	}
+	c.stop(reason)
+	return reason
+}
+
+// stop stops the client: closes its connections, signals its goroutines to exit and ends its subscriptions
+func (c *StreamClient) stop(reason error) {
+	c.stopOnce.Do(func() { close(c.done) })
+
+	// Close the streaming connection, a connection established meanwhile is closed once set
+	c.mutexWrite.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mutexWrite.Unlock()
+	c.closeSession()
+	if c.prefetch != nil {
+		c.prefetch.close()
+	}
+
+	c.mutexSubs.RLock()
+	subs := make([]*Subscription, 0, len(c.subs))
+	for _, sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.mutexSubs.RUnlock()
+	for _, sub := range subs {
+		c.removeSubscription(sub.ID)
+		sub.end(reason)
+	}
+}
+
+// Close stops the client gracefully: closes its connections, waits for its goroutines to exit, ends its
+// subscriptions and discards the entries and results not consumed. Then the client is flagged not started, so it can
+// be started again from scratch (the streaming isn't resumed, the process entry function and the settings are kept).
+// It implements io.Closer (it can't be called concurrently with the other methods of the client)
+func (c *StreamClient) Close() error {
+	c.stop(ErrClientStopped)
+	c.routines.Wait()
+	c.saveCheckpoint()
+
+	// Discard the entries and results pending
+	for len(c.entries) > 0 {
+		<-c.entries
+	}
+	c.resetStopBarrier()
+
+	// Reset the state to start again
+	c.started = false
+	c.connected = false
+	c.streaming.Store(false)
+	c.failWaiters()
+	c.reconnect.failures, c.reconnect.lastErr = 0, nil
+	c.breaker.reset()
+	if c.prefetch != nil {
+		c.SetPrefetch(c.prefetch.maxEntries, c.prefetch.maxBytes)
+	}
+	if c.workers != nil {
+		c.SetWorkers(c.workers.workers, c.workers.onCompleted)
+	}
+	if c.batch != nil {
+		c.SetProcessBatchFunc(c.batch.process, c.batch.maxSize, c.batch.maxLatency)
+	}
+	if c.pull != nil {
+		c.SetPullDelivery(true, c.pull.buffer)
+	}
+	if c.spill != nil {
+		c.SetSpillover(c.spill.dir, c.spill.maxBytes)
+	}
+	if c.verifier != nil {
+		c.SetVerifier(c.verifier.verifier, c.verifier.stop, c.verifier.onDivergence)
+	}
+	c.fatal = make(chan error, 1)
+	c.done = make(chan struct{})
+	c.stopOnce = sync.Once{}
+
+	log.Infof("%s Client closed", c.ID)
+	return nil
+}
+
+// spawn runs a function in a goroutine of the client, waited on Close
+func (c *StreamClient) spawn(f func()) {
+	c.routines.Add(1)
+	go func() {
+		defer c.routines.Done()
+		f()
+	}()
+}
+
+// isStopped checks if the client is stopped
+func (c *StreamClient) isStopped() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// setConn sets the streaming connection to the server, closing it if the client is stopped
+func (c *StreamClient) setConn(conn net.Conn) bool {
+	c.mutexWrite.Lock()
+	defer c.mutexWrite.Unlock()
+
+	if c.isStopped() {
+		conn.Close()
+		return false
+	}
+	c.conn = conn
+	return true
+}
+
+// wait waits for a duration, returns false if the client is stopped meanwhile
+func (c *StreamClient) wait(d time.Duration) bool {
+	return c.waitContext(context.Background(), d)
+}
+
+// waitContext waits for a duration, returns false if the client is stopped or the context done meanwhile
+func (c *StreamClient) waitContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-c.done:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
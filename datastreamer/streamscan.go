@@ -0,0 +1,188 @@
+package datastreamer
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// pageScan type for the result of scanning the data entries of a data page
+type pageScan struct {
+	firstEntry uint64 // Number of the first entry in the page
+	entries    uint64 // Number of consecutive valid entries from the start of the page
+	length     uint64 // Offset in the page of the end of the last valid entry
+	err        error  // Error found after the valid entries, if any
+}
+
+// checkDataEntries checks the data entries are consistent with the header. The fast path just scans the last data
+// page, and only if it's not consistent all the data pages are scanned in parallel to locate the last valid entry
+// and recover the header from it
+func (f *StreamFile) checkDataEntries() error {
+	// Empty stream
+	if f.header.TotalLength <= PageHeaderSize && f.header.TotalEntries == f.header.BaseEntry {
+		return nil
+	}
+
+	// Fast path: the last data page ends with the last entry of the header
+	lastPage, limit := dataPagePosition(f.header.TotalLength)
+	if f.header.TotalLength > PageHeaderSize && f.header.TotalLength <= f.maxLength {
+		scan := f.scanPage(lastPage, limit, make([]byte, f.pageSize))
+		if scan.err == nil && scan.entries > 0 && scan.firstEntry+scan.entries == f.header.TotalEntries &&
+			(scan.length == limit || limit == uint64(f.pageSize)) {
+			return nil
+		}
+		log.Warnf("Header inconsistent with the last data page %d (%v), scanning all the data pages", lastPage, scan.err)
+	} else {
+		log.Warnf("Header inconsistent with the file length, scanning all the data pages")
+	}
+
+	// Slow path: scan all the data pages up to the header total length
+	pages := lastPage + 1
+	filePages := (f.maxLength - PageHeaderSize) / uint64(f.pageSize)
+	if pages > filePages {
+		pages = filePages
+	}
+	start := time.Now()
+	scans := f.scanPages(pages, f.header.TotalLength)
+	log.Infof("Scanned %d data pages in %v", pages, time.Since(start))
+
+	entries, length := f.lastValidEntry(scans, f.header.BaseEntry)
+	if entries == f.header.TotalEntries && length == f.header.TotalLength {
+		return nil
+	}
+
+	// Recover the header
+	log.Warnf("Recovering header from totalEntries[%d] totalLength[%d] to totalEntries[%d] totalLength[%d]",
+		f.header.TotalEntries, f.header.TotalLength, entries, length)
+	f.mutexHeader.Lock()
+	f.header.TotalEntries = entries
+	f.header.TotalLength = length
+	f.mutexHeader.Unlock()
+	return f.writeHeaderEntry()
+}
+
+// validateDataEntries performs the deep validation of the stream file, checking all the data entries up to the
+// committed header by scanning in parallel all the data pages
+func (f *StreamFile) validateDataEntries() error {
+	header := f.getHeaderEntry()
+	start := time.Now()
+
+	entries, length := header.BaseEntry, uint64(PageHeaderSize)
+	if header.TotalLength > PageHeaderSize {
+		lastPage, _ := dataPagePosition(header.TotalLength)
+		entries, length = f.lastValidEntry(f.scanPages(lastPage+1, header.TotalLength), header.BaseEntry)
+	}
+	if entries != header.TotalEntries || length != header.TotalLength {
+		log.Errorf("Stream file validation failed: valid totalEntries[%d] totalLength[%d], "+
+			"header totalEntries[%d] totalLength[%d]", entries, length, header.TotalEntries, header.TotalLength)
+		return ErrStreamFileValidation
+	}
+
+	log.Infof("Stream file validated: %d entries in %v", entries, time.Since(start))
+	return nil
+}
+
+// lastValidEntry returns the total entries and the total length up to the last valid entry from the start of the
+// stream (base entry), from the scans of the data pages
+func (f *StreamFile) lastValidEntry(scans []pageScan, baseEntry uint64) (uint64, uint64) {
+	entries := baseEntry
+	length := uint64(PageHeaderSize)
+	for page, scan := range scans {
+		if scan.entries == 0 || scan.firstEntry != entries {
+			break
+		}
+		entries += scan.entries
+		length = PageHeaderSize + uint64(page)*uint64(f.pageSize) + scan.length
+		if scan.err != nil {
+			log.Warnf("Invalid data entry in data page %d: %v", page, scan.err)
+			break
+		}
+	}
+	return entries, length
+}
+
+// dataPagePosition returns the data page and the offset in that page of a file position after the header page
+func dataPagePosition(pos uint64) (uint64, uint64) {
+	if pos <= PageHeaderSize {
+		return 0, 0
+	}
+	page := (pos - PageHeaderSize - 1) / PageDataSize
+	return page, pos - PageHeaderSize - page*PageDataSize
+}
+
+// scanPages scans in parallel the data entries of the data pages up to a total length
+func (f *StreamFile) scanPages(pages uint64, totalLength uint64) []pageScan {
+	scans := make([]pageScan, pages)
+	next := make(chan uint64)
+
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buffer := make([]byte, f.pageSize)
+			for page := range next {
+				limit := totalLength - PageHeaderSize - page*uint64(f.pageSize)
+				if limit > uint64(f.pageSize) {
+					limit = uint64(f.pageSize)
+				}
+				scans[page] = f.scanPage(page, limit, buffer)
+			}
+		}()
+	}
+
+	for page := uint64(0); page < pages; page++ {
+		next <- page
+	}
+	close(next)
+	wg.Wait()
+
+	return scans
+}
+
+// scanPage scans the data entries of a data page up to a length in the page, using the buffer to read it
+func (f *StreamFile) scanPage(page uint64, limit uint64, buffer []byte) pageScan {
+	scan := pageScan{}
+
+	// Read the data page
+	data := buffer[:limit]
+	_, err := f.file.ReadAt(data, int64(PageHeaderSize+page*uint64(f.pageSize)))
+	if err != nil {
+		scan.err = err
+		return scan
+	}
+
+	// Decode the data entries until the pad
+	offset := uint64(0)
+	for offset < limit && data[offset] != PtPadding {
+		if data[offset] != PtData {
+			scan.err = ErrExpectingPacketTypeData
+			return scan
+		}
+		if offset+FixedSizeFileEntry > limit {
+			scan.err = ErrDecodingLengthDataEntry
+			return scan
+		}
+		length := uint64(binary.BigEndian.Uint32(data[offset+1 : offset+5]))
+		if length < FixedSizeFileEntry || offset+length > limit {
+			scan.err = ErrDecodingLengthDataEntry
+			return scan
+		}
+		number := binary.BigEndian.Uint64(data[offset+9 : offset+17])
+		if scan.entries == 0 {
+			scan.firstEntry = number
+		} else if number != scan.firstEntry+scan.entries {
+			scan.err = ErrEntryNumberMismatch
+			return scan
+		}
+
+		scan.entries++
+		offset += length
+		scan.length = offset
+	}
+	return scan
+}
@@ -0,0 +1,267 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	entryVersionShift = 23 // Bit offset of the payload schema version in the entry type, below the content flag
+
+	// MaxEntryBaseType is the maximum entry type of the entries with a payload schema version
+	MaxEntryBaseType EntryType = 1<<entryVersionShift - 1
+)
+
+// EntrySchema type for a payload schema of the data entries: entry type and payload schema version
+type EntrySchema struct {
+	Type    EntryType `json:"type"`    // Entry type, without the version
+	Version uint8     `json:"version"` // Payload schema version (0 for the entries not versioned)
+}
+
+// EntryDispatcher type to dispatch the streaming entries to their process functions by entry type and payload schema
+// version
+type EntryDispatcher struct {
+	mutex    sync.RWMutex
+	handlers map[EntrySchema]ProcessEntryFunc
+	selected map[EntryType]uint8 // Version negotiated of each entry type, the entries of other versions are skipped
+	fallback ProcessEntryFunc    // Process function of the entries without handler (nil to skip them)
+}
+
+// VersionedEntryType returns the entry type of the data entries of a payload schema version: the version is kept in
+// the bits 23-30 of the entry type (distinct from the entry type itself, up to MaxEntryBaseType), so the entries of
+// the version 0 keep their entry type
+func VersionedEntryType(etype EntryType, version uint8) EntryType {
+	return etype&MaxEntryBaseType | EntryType(version)<<entryVersionShift
+}
+
+// Base returns the entry type without the payload schema version
+func (t EntryType) Base() EntryType {
+	if t == EtBookmark {
+		return t
+	}
+	return t & MaxEntryBaseType
+}
+
+// Version returns the payload schema version of the entry type (0 if not versioned)
+func (t EntryType) Version() uint8 {
+	if t == EtBookmark {
+		return 0
+	}
+	return uint8(t >> entryVersionShift)
+}
+
+// AddStreamEntryVersion adds a new data entry with a payload schema version to the atomic operation in progress, so
+// the payload format upgrades can be rolled out gradually, e.g. adding the entries of both versions meanwhile the
+// clients negotiate the version they process (see EntryDispatcher). Returns the entry number
+func (s *StreamServer) AddStreamEntryVersion(etype EntryType, version uint8, data []byte) (uint64, error) {
+	if etype > MaxEntryBaseType || etype == EtBookmark {
+		log.Errorf("Entry type %d not allowed with a payload schema version", etype)
+		return 0, ErrInvalidEntrySchema
+	}
+	return s.AddStreamEntry(VersionedEntryType(etype, version), data)
+}
+
+// AddEntrySchema declares a payload schema served by the server, e.g. at start for the entries of the stream file. The
+// schemas of the entries committed are added automatically
+func (s *StreamServer) AddEntrySchema(etype EntryType, version uint8) {
+	s.mutexSchemas.Lock()
+	defer s.mutexSchemas.Unlock()
+
+	if s.schemas == nil {
+		s.schemas = make(map[EntrySchema]struct{})
+	}
+	s.schemas[EntrySchema{Type: etype.Base(), Version: version}] = struct{}{}
+}
+
+// GetEntrySchemas returns the payload schemas served by the server, ordered by entry type and version
+func (s *StreamServer) GetEntrySchemas() []EntrySchema {
+	s.mutexSchemas.RLock()
+	schemas := make([]EntrySchema, 0, len(s.schemas))
+	for schema := range s.schemas {
+		schemas = append(schemas, schema)
+	}
+	s.mutexSchemas.RUnlock()
+
+	sort.Slice(schemas, func(i, j int) bool {
+		if schemas[i].Type != schemas[j].Type {
+			return schemas[i].Type < schemas[j].Type
+		}
+		return schemas[i].Version < schemas[j].Version
+	})
+	return schemas
+}
+
+// recordSchemas adds the payload schemas of the data entries committed
+func (s *StreamServer) recordSchemas(entries []FileEntry) {
+	s.mutexSchemas.Lock()
+	defer s.mutexSchemas.Unlock()
+
+	if s.schemas == nil {
+		s.schemas = make(map[EntrySchema]struct{})
+	}
+	for i := range entries {
+		if entries[i].Type != EtBookmark {
+			s.schemas[EntrySchema{Type: entries[i].Type.Base(), Version: entries[i].Type.Version()}] = struct{}{}
+		}
+	}
+}
+
+// handleSchemasCommand processes the CmdSchemas command
+func (s *StreamServer) handleSchemasCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("Schemas command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrSchemasCommandNotAllowed
+	}
+
+	return s.processCmdSchemas(cli)
+}
+
+// processCmdSchemas processes the TCP Schemas command from the clients
+func (s *StreamServer) processCmdSchemas(client *client) error {
+	// Log
+	log.Debugf("Client %s command Schemas", client.clientID)
+
+	data, err := json.Marshal(s.GetEntrySchemas())
+	if err != nil {
+		log.Errorf("Error encoding schemas for %s: %v", client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the schemas as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteTagged(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending schemas to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
+
+// ExecCommandGetSchemas executes client TCP command to get the payload schemas served by the server
+func (c *StreamClient) ExecCommandGetSchemas() ([]EntrySchema, error) {
+	return c.ExecCommandGetSchemasContext(context.Background())
+}
+
+// ExecCommandGetSchemasContext executes client TCP command to get the payload schemas served by the server, canceled
+// with the context
+func (c *StreamClient) ExecCommandGetSchemasContext(ctx context.Context) ([]EntrySchema, error) {
+	schemas := []EntrySchema{}
+	_, entry, err := c.execCommand(ctx, CmdSchemas, false, 0, nil)
+	if err != nil {
+		return schemas, err
+	}
+	err = json.Unmarshal(entry.Data, &schemas)
+	return schemas, err
+}
+
+// NegotiateSchemas gets the payload schemas served by the server and negotiates the versions processed by the
+// dispatcher (see EntryDispatcher.Negotiate)
+func (c *StreamClient) NegotiateSchemas(d *EntryDispatcher) error {
+	schemas, err := c.ExecCommandGetSchemas()
+	if err != nil {
+		return err
+	}
+	return d.Negotiate(schemas)
+}
+
+// NewEntryDispatcher creates a new dispatcher of the streaming entries by entry type and payload schema version, set
+// its Process method as the process entry function of the client
+func NewEntryDispatcher() *EntryDispatcher {
+	return &EntryDispatcher{
+		handlers: make(map[EntrySchema]ProcessEntryFunc),
+		selected: make(map[EntryType]uint8),
+	}
+}
+
+// Handle sets the process function of the entries of an entry type and payload schema version
+func (d *EntryDispatcher) Handle(etype EntryType, version uint8, f ProcessEntryFunc) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.handlers[EntrySchema{Type: etype.Base(), Version: version}] = f
+}
+
+// HandleDefault sets the process function of the entries without handler (nil to skip them)
+func (d *EntryDispatcher) HandleDefault(f ProcessEntryFunc) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.fallback = f
+}
+
+// Negotiate selects for each entry type handled the highest version served (schemas of the server) with a handler,
+// the entries of the other versions of the type are skipped, e.g. the old version meanwhile the server adds both.
+// Returns ErrEntrySchemaNotSupported if an entry type handled is served without any version handled
+func (d *EntryDispatcher) Negotiate(schemas []EntrySchema) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	handled := make(map[EntryType]bool)
+	for schema := range d.handlers {
+		handled[schema.Type] = true
+	}
+
+	d.selected = make(map[EntryType]uint8)
+	served := make(map[EntryType]struct{})
+	for _, schema := range schemas {
+		schema.Type = schema.Type.Base()
+		served[schema.Type] = struct{}{}
+		if _, ok := d.handlers[schema]; !ok {
+			continue
+		}
+		if version, ok := d.selected[schema.Type]; !ok || schema.Version > version {
+			d.selected[schema.Type] = schema.Version
+		}
+	}
+
+	var err error
+	for etype := range served {
+		version, ok := d.selected[etype]
+		switch {
+		case ok:
+			log.Infof("Entry type %d payload schema version %d negotiated", etype, version)
+		case handled[etype]:
+			log.Errorf("Entry type %d served without any payload schema version handled", etype)
+			err = ErrEntrySchemaNotSupported
+		}
+	}
+	return err
+}
+
+// Process dispatches a streaming entry to the process function of its entry type and payload schema version
+func (d *EntryDispatcher) Process(e *FileEntry, c *StreamClient, s *StreamServer) error {
+	schema := EntrySchema{Type: e.Type.Base(), Version: e.Type.Version()}
+
+	d.mutex.RLock()
+	version, negotiated := d.selected[schema.Type]
+	f, ok := d.handlers[schema]
+	if !ok {
+		f = d.fallback
+	}
+	d.mutex.RUnlock()
+
+	if (negotiated && schema.Version != version) || f == nil {
+		return nil
+	}
+	return f(e, c, s)
+}
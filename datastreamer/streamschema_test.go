@@ -0,0 +1,84 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntrySchemas(t *testing.T) {
+	server, port := newTestServer(t, "schemas.bin")
+	require.NoError(t, server.Start())
+	server.AddEntrySchema(entryType2, 0)
+
+	// Case: Entries of both versions of the payload schema -> OK
+	require.NoError(t, server.StartAtomicOp())
+	for i := 0; i < 3; i++ {
+		_, err := server.AddStreamBookmark([]byte{0, byte(i)})
+		require.NoError(t, err)
+		_, err = server.AddStreamEntryVersion(entryType1, 2, testEntries[1].Encode())
+		require.NoError(t, err)
+		_, err = server.AddStreamEntryVersion(entryType1, 3, testEntries[1].Encode())
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.CommitAtomicOp())
+	entry, err := server.GetEntry(2)
+	require.NoError(t, err)
+	require.Equal(t, entryType1, entry.Type.Base())
+	require.Equal(t, uint8(3), entry.Type.Version())
+
+	// Case: Version on a bookmark or a too large entry type -> FAIL
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamEntryVersion(datastreamer.EtBookmark, 1, []byte{0})
+	require.ErrorIs(t, err, datastreamer.ErrInvalidEntrySchema)
+	_, err = server.AddStreamEntryVersion(datastreamer.MaxEntryBaseType+1, 1, []byte{0})
+	require.ErrorIs(t, err, datastreamer.ErrInvalidEntrySchema)
+	require.NoError(t, server.RollbackAtomicOp())
+
+	// Case: Schemas served negotiated with the versions handled -> Highest version dispatched
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	schemas, err := client.ExecCommandGetSchemas()
+	require.NoError(t, err)
+	require.Equal(t, []datastreamer.EntrySchema{{Type: entryType1, Version: 2}, {Type: entryType1, Version: 3},
+		{Type: entryType2, Version: 0}}, schemas)
+
+	var mutex sync.Mutex
+	processed := map[string][]uint64{}
+	handler := func(name string) datastreamer.ProcessEntryFunc {
+		return func(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			processed[name] = append(processed[name], e.Number)
+			return nil
+		}
+	}
+	dispatcher := datastreamer.NewEntryDispatcher()
+	dispatcher.Handle(entryType1, 1, handler("v1"))
+	dispatcher.Handle(entryType1, 2, handler("v2"))
+	dispatcher.Handle(entryType1, 3, handler("v3"))
+	dispatcher.HandleDefault(handler("default"))
+	require.NoError(t, client.NegotiateSchemas(dispatcher))
+	client.SetProcessEntryFunc(dispatcher.Process)
+	require.NoError(t, client.ExecCommandStart(0))
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(processed["v3"]) == 3
+	}, 2*time.Second, 10*time.Millisecond)
+	mutex.Lock()
+	require.Equal(t, map[string][]uint64{"v3": {2, 5, 8}, "default": {0, 3, 6}}, processed)
+	mutex.Unlock()
+
+	// Case: Entry type handled served without any version handled -> FAIL
+	dispatcher = datastreamer.NewEntryDispatcher()
+	dispatcher.Handle(entryType1, 1, handler("v1"))
+	require.ErrorIs(t, dispatcher.Negotiate(schemas), datastreamer.ErrEntrySchemaNotSupported)
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
@@ -0,0 +1,181 @@
+package datastreamer
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatsSample type for a sample of the server statistics time series, aggregated over the sample interval
+type StatsSample struct {
+	Time                  time.Time `json:"time"`                  // End of the sample interval
+	Entries               uint64    `json:"entries"`               // Entries committed
+	Bytes                 uint64    `json:"bytes"`                 // Bytes of the entries committed
+	Commits               uint64    `json:"commits"`               // Atomic operations committed
+	EntriesPerSec         float64   `json:"entriesPerSec"`         // Throughput of the entries committed
+	CommitLatencyMs       float64   `json:"commitLatencyMs"`       // Average latency of the commits
+	MaxCommitLatencyMs    float64   `json:"maxCommitLatencyMs"`    // Maximum latency of the commits
+	Broadcasts            uint64    `json:"broadcasts"`            // Atomic operations broadcast to the clients
+	BroadcastLatencyMs    float64   `json:"broadcastLatencyMs"`    // Average latency of the broadcasts
+	MaxBroadcastLatencyMs float64   `json:"maxBroadcastLatencyMs"` // Maximum latency of the broadcasts
+	Clients               int       `json:"clients"`               // Clients connected at the end of the interval
+}
+
+// statsSeries type to collect the server statistics time series in a ring buffer
+type statsSeries struct {
+	interval time.Duration
+
+	mutex   sync.Mutex
+	samples []StatsSample // Ring buffer of the samples
+	next    int           // Position of the next sample in the ring buffer
+	full    bool          // Flag the ring buffer is full
+
+	// Accumulated values of the current sample
+	entries      uint64
+	bytes        uint64
+	commits      uint64
+	commitTime   time.Duration
+	commitMax    time.Duration
+	broadcasts   uint64
+	broadcastSum time.Duration
+	broadcastMax time.Duration
+}
+
+// SetStatsSeries sets the server to keep a time series of the throughput and latency statistics in a ring buffer of
+// samples taken every interval (e.g. 10s and 360 samples for the last hour), returned by the Stats command and the
+// stats HTTP handler to see the trends without an external metrics stack. 0 samples disables it (call before Start)
+func (s *StreamServer) SetStatsSeries(interval time.Duration, samples int) {
+	if interval <= 0 || samples <= 0 {
+		s.series = nil
+		return
+	}
+	s.series = &statsSeries{
+		interval: interval,
+		samples:  make([]StatsSample, samples),
+	}
+}
+
+// SetStatsSeries sets the relay server side to keep a time series of the statistics (call before Start)
+func (r *StreamRelay) SetStatsSeries(interval time.Duration, samples int) {
+	r.server.SetStatsSeries(interval, samples)
+}
+
+// StatsHandler returns an HTTP handler serving the relay server statistics in JSON format (see the server one)
+func (r *StreamRelay) StatsHandler() http.Handler {
+	return r.server.StatsHandler()
+}
+
+// StatsHandler returns an HTTP handler serving the server statistics in JSON format. The optional query parameter
+// "samples" limits the time series to the latest samples (e.g. ?samples=60)
+func (s *StreamServer) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := s.GetStats()
+		if samples := r.URL.Query().Get("samples"); samples != "" {
+			n, err := strconv.Atoi(samples)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid samples "+samples, http.StatusBadRequest)
+				return
+			}
+			if n < len(stats.Series) {
+				stats.Series = stats.Series[len(stats.Series)-n:]
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(stats)
+	})
+}
+
+// sampleStats takes periodically the samples of the statistics time series
+func (s *StreamServer) sampleStats() {
+	ticker := time.NewTicker(s.series.interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mutexClients.RLock()
+		clients := len(s.clients)
+		s.mutexClients.RUnlock()
+
+		s.series.sample(now, clients)
+	}
+}
+
+// commit records an atomic operation committed
+func (s *statsSeries) commit(entries uint64, bytes uint64, latency time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries += entries
+	s.bytes += bytes
+	s.commits++
+	s.commitTime += latency
+	s.commitMax = max(s.commitMax, latency)
+}
+
+// broadcast records an atomic operation broadcast to the clients
+func (s *statsSeries) broadcast(latency time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.broadcasts++
+	s.broadcastSum += latency
+	s.broadcastMax = max(s.broadcastMax, latency)
+}
+
+// sample adds the sample of the values accumulated to the ring buffer, and starts a new one
+func (s *statsSeries) sample(now time.Time, clients int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sample := StatsSample{
+		Time:                  now,
+		Entries:               s.entries,
+		Bytes:                 s.bytes,
+		Commits:               s.commits,
+		EntriesPerSec:         float64(s.entries) / s.interval.Seconds(),
+		MaxCommitLatencyMs:    toMs(s.commitMax),
+		Broadcasts:            s.broadcasts,
+		MaxBroadcastLatencyMs: toMs(s.broadcastMax),
+		Clients:               clients,
+	}
+	if s.commits > 0 {
+		sample.CommitLatencyMs = toMs(s.commitTime / time.Duration(s.commits))
+	}
+	if s.broadcasts > 0 {
+		sample.BroadcastLatencyMs = toMs(s.broadcastSum / time.Duration(s.broadcasts))
+	}
+
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % len(s.samples)
+	s.full = s.full || s.next == 0
+
+	s.entries, s.bytes, s.commits, s.commitTime, s.commitMax = 0, 0, 0, 0, 0
+	s.broadcasts, s.broadcastSum, s.broadcastMax = 0, 0, 0
+}
+
+// series returns the samples of the ring buffer in time order (nil if not enabled)
+func (s *statsSeries) series() []StatsSample {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.full {
+		return append([]StatsSample{}, s.samples[:s.next]...)
+	}
+	return append(append([]StatsSample{}, s.samples[s.next:]...), s.samples[:s.next]...)
+}
+
+// toMs converts a duration to milliseconds
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,64 @@
+package datastreamer_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsSeries(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	server, port := newTestServer(t, "series.bin")
+	server.SetStatsSeries(interval, 10)
+	require.NoError(t, server.Start())
+
+	addTestEntries(t, server, 3)
+	time.Sleep(4 * interval)
+
+	// Case: Samples of the commit in the time series -> OK
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	stats, err := client.ExecCommandGetStats()
+	require.NoError(t, err)
+	require.NotEmpty(t, stats.Series)
+	var entries, commits, broadcasts uint64
+	for _, sample := range stats.Series {
+		entries += sample.Entries
+		commits += sample.Commits
+		broadcasts += sample.Broadcasts
+	}
+	require.Equal(t, uint64(3), entries)
+	require.Equal(t, uint64(1), commits)
+	require.Equal(t, uint64(1), broadcasts)
+
+	// Case: Ring buffer full -> Latest samples in time order
+	time.Sleep(12 * interval)
+	series := server.GetStats().Series
+	require.Len(t, series, 10)
+	for i := 1; i < len(series); i++ {
+		require.True(t, series[i].Time.After(series[i-1].Time))
+	}
+	require.Positive(t, series[len(series)-1].Clients)
+
+	// Case: Latest samples over HTTP -> OK
+	recorder := httptest.NewRecorder()
+	server.StatsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats?samples=2", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	stats = datastreamer.ServerStats{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &stats))
+	require.Len(t, stats.Series, 2)
+
+	// Case: Invalid samples parameter -> FAIL
+	recorder = httptest.NewRecorder()
+	server.StatsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats?samples=x", nil))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
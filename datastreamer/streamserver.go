@@ -11,9 +11,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
 	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/hashicorp/yamux"
 )
 
 // Command type for the TCP client commands
@@ -39,26 +42,62 @@ const EntryTypeNotFound = math.MaxUint32
 
 const (
 	maxConnections    = 100 // Maximum number of connected clients
-	streamBuffer      = 256 // Buffers for the stream channel
+	streamBuffer      = 256 // Buffers for the stream channel (with the reference memory)
 	maxBookmarkLength = 16  // Maximum number of bytes for a bookmark
+	maxSubscriptions  = 32  // Maximum number of tagged subscriptions per client connection
+
+	acceptBackoffMin = 5 * time.Millisecond // Wait after the first error accepting a client connection
+	acceptBackoffMax = time.Second          // Maximum wait after the errors in a row accepting the client connections
 )
 
+// CmdFlagTagged is the command flag bit to send a tag (subscription ID) after the stream type
+const CmdFlagTagged Command = 1 << 63
+
+// CmdFlagVersioned is the command flag bit of the Header command to get the server protocol version after the header
+const CmdFlagVersioned Command = 1 << 62
+
 const (
-	CmdStart         Command = iota + 1 // CmdStart for the start from entry TCP client command
-	CmdStop                             // CmdStop for the stop TCP client command
-	CmdHeader                           // CmdHeader for the header TCP client command
-	CmdStartBookmark                    // CmdStartBookmark for the start from bookmark TCP client command
-	CmdEntry                            // CmdEntry for the get entry TCP client command
-	CmdBookmark                         // CmdBookmark for the get bookmark TCP client command
+	CmdStart           Command = iota + 1 // CmdStart for the start from entry TCP client command
+	CmdStop                               // CmdStop for the stop TCP client command
+	CmdHeader                             // CmdHeader for the header TCP client command
+	CmdStartBookmark                      // CmdStartBookmark for the start from bookmark TCP client command
+	CmdEntry                              // CmdEntry for the get entry TCP client command
+	CmdBookmark                           // CmdBookmark for the get bookmark TCP client command
+	CmdMux                                // CmdMux for the switch to multiplexed connection TCP client command
+	CmdStats                              // CmdStats for the get server statistics TCP client command
+	CmdStartShard                         // CmdStartShard for the start from entry of a shard tagged client command
+	CmdHeaderChanges                      // CmdHeaderChanges for the get header changes TCP client command
+	CmdCheckpointProof                    // CmdCheckpointProof for the get entry checkpoint proof TCP client command
+	CmdEntriesByTime                      // CmdEntriesByTime for the get entries range of a time window TCP client command
+	CmdWatchBookmarks                     // CmdWatchBookmarks for the watch of bookmarks by prefix tagged client command
+	CmdSchemas                            // CmdSchemas for the get payload schemas served TCP client command
+	CmdAuth                               // CmdAuth for the authentication with credentials TCP client command
+	CmdStartGroup                         // CmdStartGroup for the start joining a consumer group tagged client command
+	CmdCommitGroup                        // CmdCommitGroup for the commit to a consumer group tagged client command
+	CmdCommitPosition                     // CmdCommitPosition for the store of the client position TCP client command
+	CmdGetPosition                        // CmdGetPosition for the get client position stored TCP client command
+	CmdEntryRange                         // CmdEntryRange for the get range of entries TCP client command
+	CmdEntryTypes                         // CmdEntryTypes for the set of entry types to stream TCP client command
+	CmdLatestStates                       // CmdLatestStates for the get latest bookmarks by prefix TCP client command
+	CmdCompression                        // CmdCompression for the compression of the streaming TCP client command
+	CmdPing                               // CmdPing for the heartbeat of the connection TCP client command
+	CmdChecksum                           // CmdChecksum for the checksums of the entries streamed TCP client command
 )
 
 const (
-	CmdErrOK              CommandError = iota // CmdErrOK for no error
-	CmdErrAlreadyStarted                      // CmdErrAlreadyStarted for client already started error
-	CmdErrAlreadyStopped                      // CmdErrAlreadyStopped for client already stopped error
-	CmdErrBadFromEntry                        // CmdErrBadFromEntry for invalid starting entry number
-	CmdErrBadFromBookmark                     // CmdErrBadFromBookmark for invalid starting bookmark
-	CmdErrInvalidCommand  CommandError = 9    // CmdErrInvalidCommand for invalid/unknown command error
+	CmdErrOK               CommandError = iota // CmdErrOK for no error
+	CmdErrAlreadyStarted                       // CmdErrAlreadyStarted for client already started error
+	CmdErrAlreadyStopped                       // CmdErrAlreadyStopped for client already stopped error
+	CmdErrBadFromEntry                         // CmdErrBadFromEntry for invalid starting entry number
+	CmdErrBadFromBookmark                      // CmdErrBadFromBookmark for invalid starting bookmark
+	CmdErrMaxSubscriptions                     // CmdErrMaxSubscriptions for maximum number of subscriptions reached
+	CmdErrBadShard                             // CmdErrBadShard for invalid shard parameter
+	CmdErrNoHeaderChanges                      // CmdErrNoHeaderChanges for header changes not recorded by the server
+	CmdErrNoCheckpoint                         // CmdErrNoCheckpoint for entry not in a checkpoint of the server
+	CmdErrInvalidCommand   CommandError = 9    // CmdErrInvalidCommand for invalid/unknown command error
+	CmdErrUnauthorized     CommandError = 10   // CmdErrUnauthorized for client not authenticated or bad credentials
+	CmdErrBadGroup         CommandError = 11   // CmdErrBadGroup for invalid consumer group or groups not enabled
+	CmdErrNoPosition       CommandError = 12   // CmdErrNoPosition for client position not stored by the server
 )
 
 const (
@@ -88,28 +127,55 @@ var (
 
 	// StrCommand for TCP commands description
 	StrCommand = map[Command]string{
-		CmdStart:         "Start",
-		CmdStop:          "Stop",
-		CmdHeader:        "Header",
-		CmdStartBookmark: "StartBookmark",
-		CmdEntry:         "Entry",
-		CmdBookmark:      "Bookmark",
+		CmdStart:           "Start",
+		CmdStop:            "Stop",
+		CmdHeader:          "Header",
+		CmdStartBookmark:   "StartBookmark",
+		CmdEntry:           "Entry",
+		CmdBookmark:        "Bookmark",
+		CmdMux:             "Mux",
+		CmdStats:           "Stats",
+		CmdStartShard:      "StartShard",
+		CmdHeaderChanges:   "HeaderChanges",
+		CmdCheckpointProof: "CheckpointProof",
+		CmdEntriesByTime:   "EntriesByTime",
+		CmdWatchBookmarks:  "WatchBookmarks",
+		CmdSchemas:         "Schemas",
+		CmdAuth:            "Auth",
+		CmdStartGroup:      "StartGroup",
+		CmdCommitGroup:     "CommitGroup",
+		CmdCommitPosition:  "CommitPosition",
+		CmdGetPosition:     "GetPosition",
+		CmdEntryRange:      "EntryRange",
+		CmdEntryTypes:      "EntryTypes",
+		CmdLatestStates:    "LatestStates",
+		CmdCompression:     "Compression",
+		CmdPing:            "Ping",
+		CmdChecksum:        "Checksum",
 	}
 
 	// StrCommandErrors for TCP command errors description
 	StrCommandErrors = map[CommandError]string{
-		CmdErrOK:              "OK",
-		CmdErrAlreadyStarted:  "Already started",
-		CmdErrAlreadyStopped:  "Already stopped",
-		CmdErrBadFromEntry:    "Bad from entry",
-		CmdErrBadFromBookmark: "Bad from bookmark",
-		CmdErrInvalidCommand:  "Invalid command",
+		CmdErrOK:               "OK",
+		CmdErrAlreadyStarted:   "Already started",
+		CmdErrAlreadyStopped:   "Already stopped",
+		CmdErrBadFromEntry:     "Bad from entry",
+		CmdErrBadFromBookmark:  "Bad from bookmark",
+		CmdErrMaxSubscriptions: "Maximum subscriptions reached",
+		CmdErrBadShard:         "Bad shard",
+		CmdErrNoHeaderChanges:  "Header changes not recorded",
+		CmdErrNoCheckpoint:     "Entry not checkpointed",
+		CmdErrInvalidCommand:   "Invalid command",
+		CmdErrUnauthorized:     "Unauthorized",
+		CmdErrBadGroup:         "Bad consumer group",
+		CmdErrNoPosition:       "Position not stored",
 	}
 )
 
 // StreamServer type to manage a data stream server
 type StreamServer struct {
 	port              uint16        // Server stream port
+	host              string        // Interface of the server stream port (empty for all the interfaces)
 	fileName          string        // Stream file name
 	writeTimeout      time.Duration // Timeout for write operations on client connection
 	inactivityTimeout time.Duration // Inactivity timeout to kill a client connection
@@ -122,16 +188,61 @@ type StreamServer struct {
 	systemID     uint64
 	streamType   StreamType
 	ln           net.Listener
+	holdListen   bool          // Flag the port not opened on start, until the standby relay is promoted
+	mutexListen  sync.Mutex    // Mutex for access to the listener
+	acceptErrors atomic.Uint64 // Errors accepting the client connections, retried with a backoff
+	goroutines   serverGoroutines
 	clients      map[string]*client
 	mutexClients sync.RWMutex // Mutex for write access to clients map
 
 	nextEntry uint64 // Next sequential entry number
 	initEntry uint64 // Only used by the relay (initial next entry in the master server)
 
-	atomicOp   streamAO      // Current in progress (if any) atomic operation
-	stream     chan streamAO // Channel to stream committed atomic operations
+	atomicOp   streamAO       // Current in progress (if any) atomic operation
+	aoLimits   AtomicOpLimits // Limits of the atomic operations
+	stream     chan streamAO  // Channel to stream committed atomic operations
 	streamFile *StreamFile
 	bookmark   *StreamBookmark
+	content    *StreamContent // Content-addressed store of the entries payloads (nil if not enabled)
+
+	headerChanges *StreamFile        // Meta-stream of the header changes (nil if not enabled)
+	checkpoints   *StreamCheckpoints // Merkle roots of the checkpoints of the stream (nil if not enabled)
+	groups        *consumerGroups    // Consumer groups and their committed offsets (nil if not enabled)
+	positions     *StreamPositions   // Positions committed by the clients (nil if not enabled)
+	summary       *summaryStream     // Summary stream derived with the entries of the selected types (nil if not enabled)
+	latest        *latestView        // Latest state of each bookmark prefix (nil if not enabled)
+
+	schemas      map[EntrySchema]struct{} // Payload schemas of the entries served
+	mutexSchemas sync.RWMutex             // Mutex for access to the payload schemas
+
+	ephemeralDir string // Directory of the ephemeral stream, deleted on close (empty if not ephemeral)
+	closed       bool   // Flag stream file and databases closed
+
+	shuttingDown      bool       // Flag shutdown in progress (no new connections accepted)
+	pendingBroadcasts int        // Committed atomic operations pending to broadcast
+	mutexShutdown     sync.Mutex // Mutex for access to shutdown state
+
+	readinessFile string // File written once the server is ready to accept connections
+
+	maxSessionDuration time.Duration // Maximum duration of the client connections before asking to reconnect (0 no limit)
+
+	backgroundValidation bool          // Flag deep validation of the stream file in background on start
+	validationDone       chan struct{} // Closed once the background validation is completed
+	validationErr        error         // Result of the background validation
+
+	sendChain     entryChain             // Middlewares applied to the data entries sent to the clients
+	frameHandlers map[uint8]FrameHandler // Handlers of the custom frames received by packet type
+	authenticator Authenticator          // Verifier of the client credentials (nil for no authentication)
+
+	writeTransforms []PayloadTransform // Transforms applied to the payload of the data entries added (if set)
+
+	series *statsSeries // Time series of the throughput and latency statistics (nil if not enabled)
+
+	slo *sloMonitor // Evaluation of the service level objectives (nil if not set)
+
+	liveQueueSize  int        // Size of the live queues of the streaming clients (0 written by the broadcast)
+	broadcastNext  uint64     // Next entry number to broadcast
+	mutexBroadcast sync.Mutex // Mutex to switch the clients to their live queues between broadcasts
 }
 
 // streamAO type to manage atomic operations
@@ -139,6 +250,9 @@ type streamAO struct {
 	status     AOStatus
 	startEntry uint64
 	entries    []FileEntry
+	startTime  time.Time     // Start time of the atomic operation (or its latest split commit)
+	bytes      uint64        // Data bytes of the entries
+	split      AtomicOpSplit // Link of the next commit if the atomic operation is split (part 0 if not split)
 }
 
 // client type for the server to manage clients
@@ -148,10 +262,66 @@ type client struct {
 	fromEntry    uint64
 	clientID     string
 	lastActivity time.Time
+
+	cmdTag     uint64                   // Tag of the command in process (0 for untagged commands)
+	cmdRoute   entryRoute               // Route of the entries of the command in process (nil for all the entries)
+	subs       map[uint64]*subscription // Tagged streaming subscriptions of the client
+	mutexSubs  sync.RWMutex             // Mutex for access to subscriptions map
+	writeLanes writeLanes               // Delivery lanes to write complete frames to the connection
+
+	session       *yamux.Session // Multiplexed session of the connection (after a Mux command)
+	muxStream     bool           // Flag client is a stream of a multiplexed session
+	authenticated bool           // Flag client authenticated (the streams of a session by its connection)
+	versioned     bool           // Flag client got the versioned header, decoding the headers with a base entry
+
+	live     *liveQueue  // Queue of the live entries of the streaming (nil if written by the broadcast)
+	lifetime *time.Timer // Timer of the session lifetime (nil if not limited)
+
+	entryTypes atomic.Pointer[entryTypeSet] // Entry types negotiated to stream (nil for all the entry types)
+
+	compression atomic.Uint32 // Compression codec negotiated of the entries streamed
+	checksum    atomic.Uint32 // Checksum algorithm negotiated of the entries streamed
+
+	sentEntry atomic.Uint64 // Next entry number to send to the streaming (untagged), for its lag
+
+	mutexInfo sync.Mutex // Mutex to update the status and activity read by other goroutines
+}
+
+// subscription type for the server to manage a tagged streaming subscription of a client
+type subscription struct {
+	tag       uint64
+	status    ClientStatus
+	nextEntry uint64     // Next entry number to send to the subscription
+	route     entryRoute // Route of the entries of the subscription: shard or bookmarks watch (nil for all the entries)
 }
 
 func (c *client) updateActivity() {
+	c.mutexInfo.Lock()
 	c.lastActivity = time.Now()
+	c.mutexInfo.Unlock()
+}
+
+// getActivity returns the time of the latest activity of the client
+func (c *client) getActivity() time.Time {
+	c.mutexInfo.Lock()
+	defer c.mutexInfo.Unlock()
+
+	return c.lastActivity
+}
+
+// getStatus returns the streaming status of the client
+func (c *client) getStatus() ClientStatus {
+	c.mutexInfo.Lock()
+	defer c.mutexInfo.Unlock()
+
+	return c.status
+}
+
+// setStatus sets the streaming status of the client
+func (c *client) setStatus(status ClientStatus) {
+	c.mutexInfo.Lock()
+	c.status = status
+	c.mutexInfo.Unlock()
 }
 
 // ResultEntry type for a result entry
@@ -188,7 +358,7 @@ func NewServer(port uint16, version uint8, systemID uint64, streamType StreamTyp
 			startEntry: 0,
 			entries:    []FileEntry{},
 		},
-		stream: make(chan streamAO, streamBuffer),
+		stream: make(chan streamAO, GetBufferSizes().StreamBuffer),
 	}
 
 	// Add file extension if not present
@@ -224,30 +394,88 @@ func NewServer(port uint16, version uint8, systemID uint64, streamType StreamTyp
 
 // Start opens access to TCP clients and starts broadcasting
 func (s *StreamServer) Start() error {
-	// Start the server data stream
-	var err error
-	s.ln, err = net.Listen("tcp", ":"+strconv.Itoa(int(s.port)))
+	// Start the summary stream derived from this one (if enabled)
+	err := s.startSummary()
 	if err != nil {
-		log.Errorf("Error creating datastream server %d: %v", s.port, err)
 		return err
 	}
 
+	// Start the server data stream (held closed for a standby relay)
+	if !s.holdListen {
+		err = s.listen()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Goroutine to validate the stream file, the writes are not allowed until it's completed
+	if s.backgroundValidation {
+		s.validationDone = make(chan struct{})
+		s.spawn(subsysValidation, s.validateFile)
+	}
+
 	// Goroutine to broadcast committed atomic operations
-	go s.broadcastAtomicOp()
+	s.broadcastNext = s.streamFile.getHeaderEntry().TotalEntries
+	s.spawn(subsysBroadcast, s.broadcastAtomicOp)
 
 	// Goroutine to check inactivity timeout in client connections
-	go s.checkClientInactivity()
+	s.spawn(subsysMonitor, s.checkClientInactivity)
 
-	// Goroutine to wait for clients connections
-	log.Infof("Listening on port: %d", s.port)
-	go s.waitConnections()
+	// Goroutine to warn of the resources usage near the limits
+	s.spawn(subsysMonitor, s.checkResources)
+
+	// Goroutine to sample the statistics time series
+	if s.series != nil {
+		s.spawn(subsysMonitor, s.sampleStats)
+	}
+
+	// Goroutine to evaluate the service level objectives
+	if s.slo.enabled() {
+		s.spawn(subsysMonitor, s.monitorSLO)
+	}
 
 	// Flag stared
 	s.started = true
 
+	// Signal the server is ready
+	s.notifyReady()
+
+	return nil
+}
+
+// listen opens the server port and starts the goroutine to wait for clients connections
+func (s *StreamServer) listen() error {
+	s.mutexListen.Lock()
+	defer s.mutexListen.Unlock()
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.host, strconv.Itoa(int(s.port))))
+	if err != nil {
+		log.Errorf("Error creating datastream server %d: %v", s.port, err)
+		return err
+	}
+	s.ln = ln
+
+	log.Infof("Listening on port: %d", s.port)
+	s.spawn(subsysAccept, func() { s.waitConnections(ln) })
 	return nil
 }
 
+// closeListener closes the server port (if opened), stopping accepting new connections
+func (s *StreamServer) closeListener() {
+	s.mutexListen.Lock()
+	ln := s.ln
+	s.ln = nil
+	s.mutexListen.Unlock()
+	if ln == nil {
+		return
+	}
+
+	err := ln.Close()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Warnf("Error closing listener: %v", err)
+	}
+}
+
 // checkClientInactivity kills all the clients that reach write inactivity timeout
 func (s *StreamServer) checkClientInactivity() {
 	for {
@@ -256,7 +484,7 @@ func (s *StreamServer) checkClientInactivity() {
 		var clientsToKill = map[string]struct{}{}
 		s.mutexClients.Lock()
 		for _, client := range s.clients {
-			if client.lastActivity.Add(s.inactivityTimeout).Before(time.Now()) {
+			if client.getActivity().Add(s.inactivityTimeout).Before(time.Now()) {
 				clientsToKill[client.clientID] = struct{}{}
 			}
 		}
@@ -270,18 +498,28 @@ func (s *StreamServer) checkClientInactivity() {
 }
 
 // waitConnections waits for a new client connection and creates a goroutine to manages it
-func (s *StreamServer) waitConnections() {
-	defer s.ln.Close()
+func (s *StreamServer) waitConnections(ln net.Listener) {
+	defer ln.Close()
 
 	const timeout = 2 * time.Second
 
+	var backoff time.Duration
 	for {
-		conn, err := s.ln.Accept()
+		conn, err := ln.Accept()
 		if err != nil {
-			log.Errorf("Error accepting new connection: %v", err)
-			time.Sleep(timeout)
+			if s.isShuttingDown() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Transient errors (e.g. EMFILE, too many open files) are retried with a backoff doubled up to 1s
+			backoff = min(max(2*backoff, acceptBackoffMin), acceptBackoffMax) //nolint:mnd
+			s.acceptErrors.Add(1)
+			openFDs, maxFDs := countOpenFiles()
+			log.Errorf("Error accepting new connection (open files %d of %d), retrying in %v: %v", openFDs, maxFDs,
+				backoff, err)
+			time.Sleep(backoff)
 			continue
 		}
+		backoff = 0
 
 		// Check max connections allowed
 		if s.getSafeClientsLen() >= maxConnections {
@@ -292,7 +530,7 @@ func (s *StreamServer) waitConnections() {
 		}
 
 		// Goroutine to manage client (command requests and entries stream)
-		go s.handleConnection(conn)
+		s.spawn(subsysConnections, func() { s.handleConnection(conn) })
 	}
 }
 
@@ -303,6 +541,11 @@ func (s *StreamServer) handleConnection(conn net.Conn) {
 	clientID := conn.RemoteAddr().String()
 	log.Debugf("New connection: %s", clientID)
 
+	s.handleClient(conn, clientID, false)
+}
+
+// handleClient reads from a client connection (or multiplexed stream) and processes the received commands
+func (s *StreamServer) handleClient(conn net.Conn, clientID string, muxStream bool) {
 	s.mutexClients.Lock()
 	client := &client{
 		conn:         conn,
@@ -310,17 +553,41 @@ func (s *StreamServer) handleConnection(conn net.Conn) {
 		fromEntry:    0,
 		clientID:     clientID,
 		lastActivity: time.Now(),
+		subs:         make(map[uint64]*subscription),
+		muxStream:    muxStream,
+		// The streams of a session are opened once the connection is authenticated
+		authenticated: muxStream,
 	}
 	s.clients[clientID] = client
 	s.mutexClients.Unlock()
+	s.startLifetime(client)
 
 	for {
 		// Read command
-		command, err := readFullUint64(client)
+		cmdUint64, err := readFullUint64(client)
 		if err != nil {
 			s.killClient(clientID)
 			return
 		}
+		// Custom frame of a private packet type instead of a command
+		if pt := uint8(cmdUint64 >> customFrameTypeShift); IsPrivatePacketType(pt) {
+			if !s.isAuthenticated(client) {
+				log.Errorf("Custom frame type %d from unauthenticated client %s: client killed", pt, clientID)
+				s.killClient(clientID)
+				return
+			}
+			err = s.readCustomFrame(client, pt, uint32(cmdUint64))
+			if err != nil {
+				s.killClient(clientID)
+				return
+			}
+			continue
+		}
+
+		command := Command(cmdUint64) &^ (CmdFlagTagged | CmdFlagVersioned)
+		tagged := Command(cmdUint64)&CmdFlagTagged != 0
+		versioned := Command(cmdUint64)&CmdFlagVersioned != 0
+
 		// Read stream type
 		stUint64, err := readFullUint64(client)
 		if err != nil {
@@ -329,6 +596,16 @@ func (s *StreamServer) handleConnection(conn net.Conn) {
 		}
 		st := StreamType(stUint64)
 
+		// Read the tag (subscription ID) of a tagged command
+		var tag uint64
+		if tagged {
+			tag, err = readFullUint64(client)
+			if err != nil {
+				s.killClient(clientID)
+				return
+			}
+		}
+
 		// Check stream type
 		if st != s.streamType {
 			log.Errorf("Mismatch stream type: client %s killed", clientID)
@@ -336,6 +613,23 @@ func (s *StreamServer) handleConnection(conn net.Conn) {
 			return
 		}
 
+		// Check tagged command (its parameters are unknown, the client can't continue)
+		if tagged && (tag == 0 || !command.IsTaggable()) {
+			log.Errorf("Invalid tagged command %d tag %d: client %s killed", command, tag, clientID)
+			s.killClient(clientID)
+			return
+		}
+		if !tagged && command.IsTaggedOnly() {
+			log.Errorf("Invalid untagged command %d: client %s killed", command, clientID)
+			s.killClient(clientID)
+			return
+		}
+		if versioned && (tagged || command != CmdHeader) {
+			log.Errorf("Invalid versioned command %d: client %s killed", command, clientID)
+			s.killClient(clientID)
+			return
+		}
+
 		// Check if the client is nil
 		safeClient := s.getSafeClient(clientID)
 		if safeClient == nil {
@@ -344,11 +638,34 @@ func (s *StreamServer) handleConnection(conn net.Conn) {
 			return
 		}
 
+		// Check the client is authenticated, only the Auth command is allowed before
+		if command != CmdAuth && !s.isAuthenticated(safeClient) {
+			log.Errorf("Command %d[%s] from unauthenticated client %s: client killed", command, StrCommand[command],
+				clientID)
+			_ = s.sendResultEntry(uint32(CmdErrUnauthorized), StrCommandErrors[CmdErrUnauthorized], safeClient)
+			s.killClient(clientID)
+			return
+		}
+
 		// Manage the requested command
-		log.Debugf("Command %d[%s] received from %s", command, StrCommand[Command(command)], clientID)
-		err = s.processCommand(Command(command), safeClient)
+		if tagged {
+			log.Debugf("Command %d[%s] tag %d received from %s", command, StrCommand[command], tag, clientID)
+			err = s.processTaggedCommand(command, tag, safeClient)
+		} else if versioned {
+			log.Debugf("Command %d[%s] versioned received from %s", command, StrCommand[command], clientID)
+			err = s.handleVersionedHeaderCommand(safeClient)
+		} else {
+			log.Debugf("Command %d[%s] received from %s", command, StrCommand[command], clientID)
+			err = s.processCommand(command, safeClient)
+		}
 		if err != nil {
-			log.Errorf("Error processing command %d[%s] from %s: %v", command, StrCommand[Command(command)], clientID, err)
+			log.Errorf("Error processing command %d[%s] from %s: %v", command, StrCommand[command], clientID, err)
+		}
+
+		// Connection switched to a multiplexed session
+		if safeClient.session != nil {
+			s.serveSession(safeClient)
+			return
 		}
 	}
 }
@@ -364,6 +681,11 @@ func (s *StreamServer) StartAtomicOp() error {
 		log.Errorf("AtomicOp not allowed. Server is not started")
 		return ErrAtomicOpNotAllowed
 	}
+	// Check status of the stream file validation
+	err := s.checkWritable()
+	if err != nil {
+		return err
+	}
 	// Check status of the atomic operation
 	if s.atomicOp.status == aoStarted {
 		log.Errorf("AtomicOp already started and in progress after entry %d", s.atomicOp.startEntry)
@@ -372,6 +694,7 @@ func (s *StreamServer) StartAtomicOp() error {
 
 	s.atomicOp.status = aoStarted
 	s.atomicOp.startEntry = s.nextEntry
+	s.atomicOp.startTime = time.Now()
 	return nil
 }
 
@@ -380,6 +703,12 @@ func (s *StreamServer) AddStreamEntry(etype EntryType, data []byte) (uint64, err
 	start := time.Now().UnixNano()
 	defer log.Debugf("AddStreamEntry process time: %vns", time.Now().UnixNano()-start)
 
+	// Apply the write transforms to the payload (if set)
+	data, err := s.transformPayload(etype, data)
+	if err != nil {
+		return 0, err
+	}
+
 	// Add to the stream file
 	entryNum, err := s.addStream("Data", etype, data)
 
@@ -414,6 +743,18 @@ func (s *StreamServer) addStream(desc string, etype EntryType, data []byte) (uin
 		return 0, ErrAddEntryNotAllowed
 	}
 
+	// Check entry type
+	err := s.content.checkEntryType(etype)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check the limits of the atomic operation, committing the entries added so far if auto-split
+	err = s.checkAtomicOpLimits(len(data))
+	if err != nil {
+		return 0, err
+	}
+
 	// Generate data entry
 	e := FileEntry{
 		packetType: PtData,
@@ -426,14 +767,24 @@ func (s *StreamServer) addStream(desc string, etype EntryType, data []byte) (uin
 	// Log data entry fields
 	log.Debugf("%s entry: %d | %d | %d | %d | %d", desc, e.Number, e.packetType, e.Length, e.Type, len(data))
 
+	// Store the payload content-addressed (if enabled)
+	fe := e
+	if s.content != nil {
+		fe, err = s.content.reference(e)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	// Update header (in memory) and write data entry into the file
-	err := s.streamFile.AddFileEntry(e)
+	err = s.streamFile.AddFileEntry(fe)
 	if err != nil {
 		return 0, nil
 	}
 
 	// Save the entry in the atomic operation in progress
 	s.atomicOp.entries = append(s.atomicOp.entries, e)
+	s.atomicOp.bytes += uint64(len(data))
 
 	// Increase sequential entry number
 	s.nextEntry++
@@ -451,13 +802,35 @@ func (s *StreamServer) CommitAtomicOp() error {
 		return ErrCommitNotAllowed
 	}
 
+	err := s.commitAtomicOp(start, s.lastSplit())
+	if err != nil {
+		return err
+	}
+
+	// No atomic operation in progress
+	s.clearAtomicOp()
+
+	log.Debugf("committed datastream atomic operation, startEntry: %d, time: %v", s.atomicOp.startEntry, time.Since(start))
+
+	return nil
+}
+
+// commitAtomicOp commits the entries of the atomic operation in progress and streams them to the clients, with the
+// link to the atomic operation if it's split
+func (s *StreamServer) commitAtomicOp(start time.Time, split *AtomicOpSplit) error {
 	s.atomicOp.status = aoCommitting
 
 	// Update header into the file (commit the new entries)
+	prev := s.streamFile.getHeaderEntry()
 	err := s.streamFile.writeHeaderEntry()
 	if err != nil {
 		return err
 	}
+	s.recordHeaderChange(HeaderChangeCommit, prev, split)
+	s.recordSchemas(s.atomicOp.entries)
+	_ = s.updateCheckpoints()
+	s.updateSummary(s.atomicOp.entries)
+	s.updateLatest(s.atomicOp.entries)
 
 	// Do broadcast of the committed atomic operation to the stream clients
 	atomic := streamAO{
@@ -467,12 +840,12 @@ func (s *StreamServer) CommitAtomicOp() error {
 	atomic.entries = make([]FileEntry, len(s.atomicOp.entries))
 	copy(atomic.entries, s.atomicOp.entries)
 
+	s.addPendingBroadcast(1)
 	s.stream <- atomic
 
-	// No atomic operation in progress
-	s.clearAtomicOp()
-
-	log.Debugf("committed datastream atomic operation, startEntry: %d, time: %v", s.atomicOp.startEntry, time.Since(start))
+	header := s.streamFile.getHeaderEntry()
+	s.series.commit(header.TotalEntries-prev.TotalEntries, header.TotalLength-prev.TotalLength, time.Since(start))
+	s.slo.commit(header.TotalEntries-prev.TotalEntries, time.Since(start))
 
 	return nil
 }
@@ -519,14 +892,25 @@ func (s *StreamServer) TruncateFile(entryNum uint64) error {
 		return ErrTruncateNotAllowed
 	}
 
+	// Check status of the stream file validation
+	err := s.checkWritable()
+	if err != nil {
+		return err
+	}
+
 	// Log previous header
 	PrintHeaderEntry(s.streamFile.header, "(before truncate)")
+	prev := s.streamFile.getHeaderEntry()
 
 	// Truncate entries in the file
-	err := s.streamFile.truncateFile(entryNum)
+	err = s.streamFile.truncateFile(entryNum)
 	if err != nil {
 		return err
 	}
+	s.recordHeaderChange(HeaderChangeTruncate, prev, nil)
+	s.truncateCheckpoints()
+	s.truncateSummary(entryNum)
+	s.truncateLatest(entryNum)
 
 	// Update entry number sequence
 	s.nextEntry = s.streamFile.header.TotalEntries
@@ -552,11 +936,36 @@ func (s *StreamServer) UpdateEntryData(entryNum uint64, etype EntryType, data []
 		return ErrUpdateNotAllowed
 	}
 
+	// Check status of the stream file validation
+	err := s.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	// Apply the write transforms to the new payload (if set)
+	data, err = s.transformPayload(etype, data)
+	if err != nil {
+		return err
+	}
+
+	// Store the new payload of an entry stored content-addressed
+	if s.content != nil {
+		current, err := s.getFileEntry(entryNum)
+		if err != nil {
+			return err
+		}
+		etype, data, err = s.content.updateReference(current, etype, data)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Update entry data in the stream file
-	err := s.streamFile.updateEntryData(entryNum, etype, data)
+	err = s.streamFile.updateEntryData(entryNum, etype, data)
 	if err != nil {
 		return err
 	}
+	s.updateEntryCheckpoint(entryNum)
 
 	return nil
 }
@@ -570,6 +979,22 @@ func (s *StreamServer) GetHeader() HeaderEntry {
 
 // GetEntry searches in the stream file and returns the data for the requested entry
 func (s *StreamServer) GetEntry(entryNum uint64) (FileEntry, error) {
+	entry, err := s.getFileEntry(entryNum)
+	if err != nil {
+		return FileEntry{}, err
+	}
+
+	// Resolve the payload of an entry stored content-addressed
+	err = s.content.resolve(&entry)
+	if err != nil {
+		return FileEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// getFileEntry returns the entry as stored in the stream file
+func (s *StreamServer) getFileEntry(entryNum uint64) (FileEntry, error) {
 	// Initialize file stream iterator
 	iterator, err := s.streamFile.iteratorFrom(entryNum, true)
 	if err != nil {
@@ -624,6 +1049,11 @@ func (s *StreamServer) GetFirstEventAfterBookmark(bookmark []byte) (FileEntry, e
 	// Close iterator
 	s.streamFile.iteratorEnd(iterator)
 
+	// Resolve the payload of an entry stored content-addressed
+	if err == nil {
+		err = s.content.resolve(&iterator.Entry)
+	}
+
 	return iterator.Entry, err
 }
 
@@ -666,6 +1096,11 @@ func (s *StreamServer) GetDataBetweenBookmarks(bookmarkFrom, bookmarkTo []byte)
 		}
 
 		if iterator.Entry.Type != EtBookmark {
+			err = s.content.resolve(&iterator.Entry)
+			if err != nil {
+				s.streamFile.iteratorEnd(iterator)
+				return nil, err
+			}
 			response = append(response, iterator.Entry.Data...)
 		}
 	}
@@ -681,40 +1116,92 @@ func (s *StreamServer) clearAtomicOp() {
 	// No atomic operation in progress and empty entries slice
 	s.atomicOp.entries = s.atomicOp.entries[:0]
 	s.atomicOp.status = aoNone
+	s.atomicOp.bytes = 0
+	s.atomicOp.split = AtomicOpSplit{}
 }
 
 // broadcastAtomicOp broadcasts committed atomic operations to the clients
 func (s *StreamServer) broadcastAtomicOp() {
-	defer s.streamFile.file.Close()
+	defer func() { s.streamFile.file.Close() }() // The stream file may be reopened meanwhile
+	defer s.streamFile.closeDirectIO()
 	defer s.bookmark.db.Close()
+	defer func() {
+		if s.content != nil {
+			s.content.db.Close()
+		}
+		if s.checkpoints != nil {
+			s.checkpoints.db.Close()
+		}
+		if s.groups != nil {
+			s.groups.db.Close()
+		}
+		if s.positions != nil {
+			s.positions.db.Close()
+		}
+		if s.summary != nil {
+			s.summary.db.Close()
+		}
+		if s.latest != nil {
+			s.latest.db.Close()
+		}
+	}()
 
 	var err error
 	for {
 		// Wait for new atomic operation to broadcast
 		broadcastOp := <-s.stream
 		start := time.Now()
+		s.mutexBroadcast.Lock()
+
+		// Pass the entries through the send middlewares once for all the clients
+		entries, errChain := s.sendChain.applyAll(broadcastOp.entries)
+		if errChain != nil {
+			log.Errorf("Error in send middleware, closing the streaming clients: %v", errChain)
+		}
+
 		var killedClientMap = map[string]struct{}{}
 		var clientMap = map[string]struct{}{}
 		s.mutexClients.RLock()
+		numClients := len(s.clients)
 		// For each connected and started client
-		log.Debug("sending datastream entries, count: %d, clients: %d", len(broadcastOp.entries), len(s.clients))
+		log.Debug("sending datastream entries, count: %d, clients: %d", len(broadcastOp.entries), numClients)
 		for id, cli := range s.clients {
-			log.Debugf("client %s status %d (%s)", id, cli.status, StrClientStatus[cli.status])
+			status := cli.getStatus()
+			log.Debugf("client %s status %d (%s)", id, status, StrClientStatus[status])
 			clientMap[id] = struct{}{}
-			if cli.status != csSynced {
+
+			// Send entries to the tagged subscriptions
+			err = s.broadcastSubscriptions(cli, entries)
+			if err == nil && errChain != nil && (status == csSynced || s.hasSubscriptions(cli)) {
+				err = errChain
+			}
+			if err != nil {
+				// Kill client connection
+				log.Warnf("error sending entry to %s, error: %v", id, err)
+				killedClientMap[id] = struct{}{}
+				continue
+			}
+
+			// Queue entries to the client sending goroutine
+			if q := cli.getLive(); q != nil {
+				q.push(entries)
+				continue
+			}
+
+			if status != csSynced {
 				continue
 			}
 
 			// Send entries
-			for _, entry := range broadcastOp.entries {
-				if entry.Number >= cli.fromEntry {
+			for _, entry := range entries {
+				if entry.Number >= cli.fromEntry && cli.wantsEntry(&entry) {
 					log.Debugf("sending data entry %d (type %d) to %s", entry.Number, entry.Type, id)
 
-					binaryEntry := encodeFileEntryToBinary(entry)
+					binaryEntry := cli.encodeEntry(entry)
 
 					// Send the file data entry
 					if cli.conn != nil {
-						_, err = TimeoutWrite(cli, binaryEntry, s.writeTimeout)
+						_, err = timeoutWriteBulk(cli, 0, binaryEntry, s.writeTimeout)
 					} else {
 						err = ErrNilConnection
 					}
@@ -726,8 +1213,15 @@ func (s *StreamServer) broadcastAtomicOp() {
 					}
 				}
 			}
+			if err == nil && len(broadcastOp.entries) > 0 {
+				cli.sentEntry.Store(broadcastOp.entries[len(broadcastOp.entries)-1].Number + 1)
+			}
 		}
 		s.mutexClients.RUnlock()
+		if len(broadcastOp.entries) > 0 {
+			s.broadcastNext = broadcastOp.entries[len(broadcastOp.entries)-1].Number + 1
+		}
+		s.mutexBroadcast.Unlock()
 
 		for k := range killedClientMap {
 			s.killClient(k)
@@ -743,7 +1237,9 @@ func (s *StreamServer) broadcastAtomicOp() {
 		}
 
 		log.Debugf("sent datastream entries, count: %d, clients: %d, time: %v, clients-ip: {%s}",
-			len(broadcastOp.entries), len(s.clients), time.Since(start), sClients)
+			len(broadcastOp.entries), numClients, time.Since(start), sClients)
+		s.series.broadcast(time.Since(start))
+		s.addPendingBroadcast(-1)
 	}
 }
 
@@ -754,10 +1250,19 @@ func (s *StreamServer) killClient(clientID string) {
 
 	client := s.clients[clientID]
 	if client != nil && client.status != csKilled {
-		client.status = csKilled
+		client.setStatus(csKilled)
+		client.stopLifetime()
+		if q := client.getLive(); q != nil {
+			q.stop()
+		}
 		if client.conn != nil {
 			client.conn.Close()
 		}
+		client.mutexSubs.RLock()
+		for _, sub := range client.subs {
+			s.leaveGroup(sub.route)
+		}
+		client.mutexSubs.RUnlock()
 		delete(s.clients, clientID)
 	}
 }
@@ -788,6 +1293,51 @@ func (s *StreamServer) processCommand(command Command, client *client) error {
 	case CmdBookmark:
 		err = s.handleBookmarkCommand(cli)
 
+	case CmdMux:
+		err = s.handleMuxCommand(cli)
+
+	case CmdStats:
+		err = s.handleStatsCommand(cli)
+
+	case CmdHeaderChanges:
+		err = s.handleHeaderChangesCommand(cli)
+
+	case CmdCheckpointProof:
+		err = s.handleCheckpointProofCommand(cli)
+
+	case CmdEntriesByTime:
+		err = s.handleEntriesByTimeCommand(cli)
+
+	case CmdSchemas:
+		err = s.handleSchemasCommand(cli)
+
+	case CmdAuth:
+		err = s.handleAuthCommand(cli)
+
+	case CmdCommitPosition:
+		err = s.handleCommitPositionCommand(cli)
+
+	case CmdGetPosition:
+		err = s.handleGetPositionCommand(cli)
+
+	case CmdEntryRange:
+		err = s.handleEntryRangeCommand(cli)
+
+	case CmdEntryTypes:
+		err = s.handleEntryTypesCommand(cli)
+
+	case CmdLatestStates:
+		err = s.handleLatestStatesCommand(cli)
+
+	case CmdCompression:
+		err = s.handleCompressionCommand(cli)
+
+	case CmdPing:
+		err = s.handlePingCommand(cli)
+
+	case CmdChecksum:
+		err = s.handleChecksumCommand(cli)
+
 	default:
 		log.Error("Invalid command!")
 		err = ErrInvalidCommand
@@ -800,15 +1350,20 @@ func (s *StreamServer) processCommand(command Command, client *client) error {
 // handleStartCommand processes the CmdStart command
 func (s *StreamServer) handleStartCommand(cli *client) error {
 	if cli.status != csStopped {
+		// Read the parameter of the command rejected, so the next command (and its result) keeps in sync
+		_, err := readFullUint64(cli)
+		if err != nil {
+			return err
+		}
 		log.Error("Stream to client already started!")
 		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
 		return ErrClientAlreadyStarted
 	}
 
-	cli.status = csSyncing
+	cli.setStatus(csSyncing)
 	err := s.processCmdStart(cli)
 	if err == nil {
-		cli.status = csSynced
+		cli.setStatus(csSynced)
 	}
 
 	return err
@@ -817,15 +1372,20 @@ func (s *StreamServer) handleStartCommand(cli *client) error {
 // handleStartBookmarkCommand processes the CmdStartBookmark command
 func (s *StreamServer) handleStartBookmarkCommand(cli *client) error {
 	if cli.status != csStopped {
+		// Read the parameter of the command rejected, so the next command (and its result) keeps in sync
+		_, err := readBookmarkParam(cli)
+		if err != nil {
+			return err
+		}
 		log.Error("Stream to client already started!")
 		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
 		return ErrClientAlreadyStarted
 	}
 
-	cli.status = csSyncing
+	cli.setStatus(csSyncing)
 	err := s.processCmdStartBookmark(cli)
 	if err == nil {
-		cli.status = csSynced
+		cli.setStatus(csSynced)
 	}
 
 	return err
@@ -839,7 +1399,8 @@ func (s *StreamServer) handleStopCommand(cli *client) error {
 		return ErrClientAlreadyStopped
 	}
 
-	cli.status = csStopped
+	s.stopLive(cli)
+	cli.setStatus(csStopped)
 	return s.processCmdStop(cli)
 }
 
@@ -857,6 +1418,11 @@ func (s *StreamServer) handleHeaderCommand(cli *client) error {
 // handleEntryCommand processes the CmdEntry command
 func (s *StreamServer) handleEntryCommand(cli *client) error {
 	if cli.status != csStopped {
+		// Read the parameter of the command rejected, so the next command (and its result) keeps in sync
+		_, err := readFullUint64(cli)
+		if err != nil {
+			return err
+		}
 		log.Error("Entry command not allowed, stream started!")
 		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
 		return ErrEntryCommandNotAllowed
@@ -868,6 +1434,11 @@ func (s *StreamServer) handleEntryCommand(cli *client) error {
 // handleBookmarkCommand processes the CmdBookmark command
 func (s *StreamServer) handleBookmarkCommand(cli *client) error {
 	if cli.status != csStopped {
+		// Read the parameter of the command rejected, so the next command (and its result) keeps in sync
+		_, err := readBookmarkParam(cli)
+		if err != nil {
+			return err
+		}
 		log.Error("Bookmark command not allowed, stream started!")
 		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
 		return ErrBookmarkCommandNotAllowed
@@ -876,6 +1447,256 @@ func (s *StreamServer) handleBookmarkCommand(cli *client) error {
 	return s.processCmdBookmark(cli)
 }
 
+// handleStatsCommand processes the CmdStats command
+func (s *StreamServer) handleStatsCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("Stats command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrStatsCommandNotAllowed
+	}
+
+	return s.processCmdStats(cli)
+}
+
+// handleMuxCommand processes the CmdMux command
+func (s *StreamServer) handleMuxCommand(cli *client) error {
+	// Multiplexed sessions can't be nested
+	if cli.session != nil || cli.muxStream {
+		log.Error("Mux command not allowed, connection already multiplexed!")
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], cli)
+		return ErrMuxCommandNotAllowed
+	}
+
+	cli.mutexSubs.RLock()
+	numSubs := len(cli.subs)
+	cli.mutexSubs.RUnlock()
+
+	if cli.status != csStopped || numSubs > 0 {
+		log.Error("Mux command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrMuxCommandNotAllowed
+	}
+
+	return s.processCmdMux(cli)
+}
+
+// processTaggedCommand manages the received tagged TCP commands from the clients: subscriptions, and queries
+// correlated by request ID
+func (s *StreamServer) processTaggedCommand(command Command, tag uint64, client *client) error {
+	// Responses of the command are tagged with the subscription/request ID
+	client.cmdTag = tag
+	defer func() { client.cmdTag = 0 }()
+
+	var err error
+
+	switch command {
+	case CmdStart:
+		err = s.handleSubStartCommand(client, tag)
+
+	case CmdStartBookmark:
+		err = s.handleSubStartBookmarkCommand(client, tag)
+
+	case CmdStartShard:
+		err = s.handleSubStartShardCommand(client, tag)
+
+	case CmdWatchBookmarks:
+		err = s.handleSubWatchBookmarksCommand(client, tag)
+
+	case CmdStartGroup:
+		err = s.handleSubStartGroupCommand(client, tag)
+
+	case CmdCommitGroup:
+		err = s.handleSubCommitGroupCommand(client, tag)
+
+	case CmdStop:
+		err = s.handleSubStopCommand(client, tag)
+
+	// Tagged query responses can't be confused with the streamed entries, so they are allowed while streaming
+	case CmdHeader:
+		err = s.processCmdHeader(client)
+
+	case CmdEntry:
+		err = s.processCmdEntry(client)
+
+	case CmdBookmark:
+		err = s.processCmdBookmark(client)
+
+	case CmdStats:
+		err = s.processCmdStats(client)
+
+	case CmdHeaderChanges:
+		err = s.processCmdHeaderChanges(client)
+
+	case CmdCheckpointProof:
+		err = s.processCmdCheckpointProof(client)
+
+	case CmdEntriesByTime:
+		err = s.processCmdEntriesByTime(client)
+
+	case CmdSchemas:
+		err = s.processCmdSchemas(client)
+
+	case CmdCommitPosition:
+		err = s.processCmdCommitPosition(client)
+
+	case CmdGetPosition:
+		err = s.processCmdGetPosition(client)
+
+	case CmdEntryRange:
+		err = s.processCmdEntryRange(client)
+
+	case CmdLatestStates:
+		err = s.processCmdLatestStates(client)
+
+	default:
+		log.Error("Invalid tagged command!")
+		err = ErrInvalidCommand
+	}
+
+	return err
+}
+
+// handleSubStartCommand processes the tagged CmdStart command creating a new subscription
+func (s *StreamServer) handleSubStartCommand(cli *client, tag uint64) error {
+	// Read from entry number parameter
+	fromEntry, err := readFullUint64(cli)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command Start from %d for subscription %d", cli.clientID, fromEntry, tag)
+
+	sub, err := s.addSubscription(cli, tag)
+	if err != nil {
+		return err
+	}
+
+	nextEntry, err := s.startStreamingFromEntry(cli, fromEntry)
+	s.endSubscriptionSync(cli, sub, nextEntry, err)
+
+	return err
+}
+
+// handleSubStartBookmarkCommand processes the tagged CmdStartBookmark command creating a new subscription
+func (s *StreamServer) handleSubStartBookmarkCommand(cli *client, tag uint64) error {
+	// Read bookmark parameter
+	bookmark, err := readBookmarkParam(cli)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command StartBookmark [%v] for subscription %d", cli.clientID, bookmark, tag)
+
+	sub, err := s.addSubscription(cli, tag)
+	if err != nil {
+		return err
+	}
+
+	nextEntry, err := s.startStreamingFromBookmark(cli, bookmark)
+	s.endSubscriptionSync(cli, sub, nextEntry, err)
+
+	return err
+}
+
+// handleSubStopCommand processes the tagged CmdStop command removing the subscription
+func (s *StreamServer) handleSubStopCommand(cli *client, tag uint64) error {
+	cli.mutexSubs.Lock()
+	sub := cli.subs[tag]
+	if sub == nil || sub.status != csSynced {
+		cli.mutexSubs.Unlock()
+		log.Errorf("Stream to client subscription %d already stopped!", tag)
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStopped), StrCommandErrors[CmdErrAlreadyStopped], cli)
+		return ErrClientAlreadyStopped
+	}
+	delete(cli.subs, tag)
+	cli.mutexSubs.Unlock()
+	s.leaveGroup(sub.route)
+
+	return s.processCmdStop(cli)
+}
+
+// addSubscription adds a new subscription in syncing status to the client
+func (s *StreamServer) addSubscription(cli *client, tag uint64) (*subscription, error) {
+	cli.mutexSubs.Lock()
+	defer cli.mutexSubs.Unlock()
+
+	if cli.subs[tag] != nil {
+		log.Errorf("Stream to client subscription %d already started!", tag)
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return nil, ErrClientAlreadyStarted
+	}
+
+	if len(cli.subs) >= maxSubscriptions {
+		log.Errorf("Client %s reached the maximum number of subscriptions (%d)", cli.clientID, maxSubscriptions)
+		_ = s.sendResultEntry(uint32(CmdErrMaxSubscriptions), StrCommandErrors[CmdErrMaxSubscriptions], cli)
+		return nil, ErrMaxSubscriptions
+	}
+
+	sub := &subscription{
+		tag:    tag,
+		status: csSyncing,
+		route:  cli.cmdRoute,
+	}
+	cli.subs[tag] = sub
+
+	return sub, nil
+}
+
+// endSubscriptionSync sets the subscription as synced from the next entry, or removes it if the sync failed
+func (s *StreamServer) endSubscriptionSync(cli *client, sub *subscription, nextEntry uint64, err error) {
+	// Broadcast to the client subscriptions is blocked until the subscription is synced
+	cli.mutexSubs.Lock()
+	defer cli.mutexSubs.Unlock()
+
+	// Send the entries committed during the sync, skipped by the broadcast while syncing
+	if err == nil && nextEntry < s.streamFile.getHeaderEntry().TotalEntries {
+		nextEntry, err = s.streamingFromEntry(cli, nextEntry)
+	}
+
+	if err != nil {
+		delete(cli.subs, sub.tag)
+		s.leaveGroup(sub.route)
+		return
+	}
+	sub.nextEntry = nextEntry
+	sub.status = csSynced
+}
+
+// broadcastSubscriptions sends the committed entries to the synced tagged subscriptions of a client
+func (s *StreamServer) broadcastSubscriptions(cli *client, entries []FileEntry) error {
+	if cli.conn == nil {
+		return nil
+	}
+
+	cli.mutexSubs.RLock()
+	defer cli.mutexSubs.RUnlock()
+
+	for tag, sub := range cli.subs {
+		if sub.status != csSynced {
+			continue
+		}
+
+		for _, entry := range entries {
+			skip := (sub.route != nil && !sub.route.pass(&entry)) || !cli.wantsEntry(&entry)
+			if entry.Number >= sub.nextEntry && skip {
+				sub.nextEntry = entry.Number + 1
+			} else if entry.Number >= sub.nextEntry {
+				log.Debugf("sending data entry %d (type %d) to %s subscription %d", entry.Number, entry.Type, cli.clientID, tag)
+
+				_, err := timeoutWriteRoute(cli, tag, sub.route, cli.encodeEntry(entry), s.writeTimeout)
+				if err != nil {
+					return err
+				}
+				sub.nextEntry = entry.Number + 1
+			}
+		}
+	}
+
+	return nil
+}
+
 // processCmdStart processes the TCP Start command from the clients
 func (s *StreamServer) processCmdStart(client *client) error {
 	// Read from entry number parameter
@@ -888,45 +1709,46 @@ func (s *StreamServer) processCmdStart(client *client) error {
 	// Log
 	log.Debugf("Client %s command Start from %d", client.clientID, fromEntry)
 
+	nextEntry, err := s.startStreamingFromEntry(client, fromEntry)
+	return s.endStreamingSync(client, nextEntry, err)
+}
+
+// startStreamingFromEntry checks the start entry number, sends the command result and the stream data.
+// Returns the next entry number to send after the stream data
+func (s *StreamServer) startStreamingFromEntry(client *client, fromEntry uint64) (uint64, error) {
+	var err error
+
 	// Check received param
-	if fromEntry > s.nextEntry && fromEntry > s.initEntry {
+	if (fromEntry > s.nextEntry && fromEntry > s.initEntry) || fromEntry < s.streamFile.getHeaderEntry().BaseEntry {
 		log.Errorf("Start command invalid from entry %d for client %s", fromEntry, client.clientID)
 		err = ErrStartCommandInvalidParamFromEntry
 		_ = s.sendResultEntry(uint32(CmdErrBadFromEntry), StrCommandErrors[CmdErrBadFromEntry], client)
-		return err
+		return fromEntry, err
 	}
 
 	// Send a command result entry OK
 	err = s.sendResultEntry(0, "OK", client)
 	if err != nil {
-		return err
+		return fromEntry, err
 	}
 
 	// Stream entries data from the requested entry number
+	if s.liveEnabled(client) {
+		s.startLive(client, fromEntry)
+		return fromEntry, nil
+	}
+	nextEntry := fromEntry
 	if fromEntry < s.nextEntry {
-		err = s.streamingFromEntry(client, fromEntry)
+		nextEntry, err = s.streamingFromEntry(client, fromEntry)
 	}
 
-	return err
+	return nextEntry, err
 }
 
 // processCmdStartBookmark processes the TCP Start Bookmark command from the clients
 func (s *StreamServer) processCmdStartBookmark(client *client) error {
-	// Read bookmark length parameter
-	length, err := readFullUint32(client)
-	if err != nil {
-		return err
-	}
-
-	// Check maximum length allowed
-	if length > maxBookmarkLength {
-		log.Errorf("Client %s exceeded [%d] maximum allowed length [%d] for a bookmark.",
-			client.clientID, length, maxBookmarkLength)
-		return ErrBookmarkMaxLength
-	}
-
 	// Read bookmark parameter
-	bookmark, err := readFullBytes(length, client)
+	bookmark, err := readBookmarkParam(client)
 	if err != nil {
 		return err
 	}
@@ -934,28 +1756,62 @@ func (s *StreamServer) processCmdStartBookmark(client *client) error {
 	// Log
 	log.Debugf("Client %s command StartBookmark [%v]", client.clientID, bookmark)
 
+	nextEntry, err := s.startStreamingFromBookmark(client, bookmark)
+	return s.endStreamingSync(client, nextEntry, err)
+}
+
+// startStreamingFromBookmark resolves the start bookmark, sends the command result and the stream data.
+// Returns the next entry number to send after the stream data
+func (s *StreamServer) startStreamingFromBookmark(client *client, bookmark []byte) (uint64, error) {
 	// Get bookmark
 	entryNum, err := s.bookmark.GetBookmark(bookmark)
 	if err != nil {
 		log.Errorf("StartBookmark command invalid from bookmark %v for client %s: %v", bookmark, client.clientID, err)
 		err = ErrStartBookmarkInvalidParamFromBookmark
 		_ = s.sendResultEntry(uint32(CmdErrBadFromBookmark), StrCommandErrors[CmdErrBadFromBookmark], client)
-		return err
+		return 0, err
 	}
 
 	// Send a command result entry OK
 	err = s.sendResultEntry(0, "OK", client)
 	if err != nil {
-		return err
+		return entryNum, err
 	}
 
 	// Stream entries data from the entry number marked by the bookmark
 	log.Debugf("Client %s Bookmark [%v] is the entry number [%d]", client.clientID, bookmark, entryNum)
+	if s.liveEnabled(client) {
+		s.startLive(client, entryNum)
+		return entryNum, nil
+	}
+	nextEntry := entryNum
 	if entryNum < s.nextEntry {
-		err = s.streamingFromEntry(client, entryNum)
+		nextEntry, err = s.streamingFromEntry(client, entryNum)
 	}
 
-	return err
+	return nextEntry, err
+}
+
+// endStreamingSync sets the streaming of the client as synced from the next entry, sending first the entries committed
+// during the sync. The broadcast is blocked meanwhile, and it skips the entries already sent from the file
+func (s *StreamServer) endStreamingSync(cli *client, nextEntry uint64, err error) error {
+	if err != nil || cli.getLive() != nil {
+		return err
+	}
+
+	s.mutexBroadcast.Lock()
+	defer s.mutexBroadcast.Unlock()
+
+	// Send the entries committed during the sync, skipped by the broadcast while syncing
+	if nextEntry < s.streamFile.getHeaderEntry().TotalEntries {
+		nextEntry, err = s.streamingFromEntry(cli, nextEntry)
+		if err != nil {
+			return err
+		}
+	}
+	cli.fromEntry = nextEntry
+	cli.setStatus(csSynced)
+	return nil
 }
 
 // processCmdStop processes the TCP Stop command from the clients
@@ -979,13 +1835,17 @@ func (s *StreamServer) processCmdHeader(client *client) error {
 		return err
 	}
 
-	// Get current written/committed file header
+	// Get current written/committed file header. The legacy clients only decode the header without base entry, so
+	// it's sent to the clients negotiating the protocol (versioned header) or sending the command tagged
 	header := s.streamFile.getHeaderEntry()
+	if !client.versioned && client.cmdTag == 0 {
+		header.headLength = headerSize
+	}
 	binaryHeader := encodeHeaderEntryToBinary(header)
 
 	// Send header entry to the client
 	if client.conn != nil {
-		_, err = TimeoutWrite(client, binaryHeader, s.writeTimeout)
+		_, err = timeoutWriteTagged(client, client.cmdTag, binaryHeader, s.writeTimeout)
 	} else {
 		err = ErrNilConnection
 	}
@@ -1021,12 +1881,13 @@ func (s *StreamServer) processCmdEntry(client *client) error {
 		entry.Length = FixedSizeFileEntry
 		entry.Type = EntryTypeNotFound
 	}
+	entry = s.applySendChain(entry, client)
 	entry.packetType = PtDataRsp
 	binaryEntry := encodeFileEntryToBinary(entry)
 
 	// Send entry to the client
 	if client.conn != nil {
-		_, err = TimeoutWrite(client, binaryEntry, s.writeTimeout)
+		_, err = timeoutWriteTagged(client, client.cmdTag, binaryEntry, s.writeTimeout)
 	} else {
 		err = ErrNilConnection
 	}
@@ -1040,21 +1901,8 @@ func (s *StreamServer) processCmdEntry(client *client) error {
 
 // processCmdBookmark processes the TCP Bookmark command from the clients
 func (s *StreamServer) processCmdBookmark(client *client) error {
-	// Read bookmark length parameter
-	length, err := readFullUint32(client)
-	if err != nil {
-		return err
-	}
-
-	// Check maximum length allowed
-	if length > maxBookmarkLength {
-		log.Errorf("Client %s exceeded [%d] maximum allowed length [%d] for a bookmark.",
-			client.clientID, length, maxBookmarkLength)
-		return ErrBookmarkMaxLength
-	}
-
 	// Read bookmark parameter
-	bookmark, err := readFullBytes(length, client)
+	bookmark, err := readBookmarkParam(client)
 	if err != nil {
 		return err
 	}
@@ -1076,12 +1924,13 @@ func (s *StreamServer) processCmdBookmark(client *client) error {
 		entry.Length = FixedSizeFileEntry
 		entry.Type = EntryTypeNotFound
 	}
+	entry = s.applySendChain(entry, client)
 	entry.packetType = PtDataRsp
 	binaryEntry := encodeFileEntryToBinary(entry)
 
 	// Send entry to the client
 	if client.conn != nil {
-		_, err = TimeoutWrite(client, binaryEntry, s.writeTimeout)
+		_, err = timeoutWriteTagged(client, client.cmdTag, binaryEntry, s.writeTimeout)
 	} else {
 		err = ErrNilConnection
 	}
@@ -1093,22 +1942,34 @@ func (s *StreamServer) processCmdBookmark(client *client) error {
 	return nil
 }
 
-// streamingFromEntry sends to the client the stream data starting from the requested entry number
-func (s *StreamServer) streamingFromEntry(client *client, fromEntry uint64) error {
+// streamingFromEntry sends to the client the stream data starting from the requested entry number.
+// Returns the next entry number to send after the last one sent
+func (s *StreamServer) streamingFromEntry(client *client, fromEntry uint64) (uint64, error) {
+	return s.streamingFromFile(client, fromEntry, client.cmdTag, client.cmdRoute)
+}
+
+// streamingFromFile sends to the client the stream data starting from the requested entry number, tagged and
+// routed (if not zero/nil). Returns the next entry number to send after the last one sent
+func (s *StreamServer) streamingFromFile(client *client, fromEntry uint64, tag uint64, route entryRoute) (uint64,
+	error) {
 	// Log
 	log.Debugf("SYNCING %s from entry %d...", client.clientID, fromEntry)
 
 	// Start file stream iterator
 	iterator, err := s.streamFile.iteratorFrom(fromEntry, true)
 	if err != nil {
-		return err
+		return fromEntry, err
 	}
 
 	// Loop data entries from file stream iterator
+	nextEntry := fromEntry
 	for {
+		if tag == 0 {
+			client.sentEntry.Store(nextEntry)
+		}
 		end, err := s.streamFile.iteratorNext(iterator)
 		if err != nil {
-			return err
+			return nextEntry, err
 		}
 
 		// Check if end of iterator
@@ -1116,25 +1977,47 @@ func (s *StreamServer) streamingFromEntry(client *client, fromEntry uint64) erro
 			break
 		}
 
+		// Resolve the payload of an entry stored content-addressed
+		entry := iterator.Entry
+		err = s.content.resolve(&entry)
+		if err != nil {
+			return nextEntry, err
+		}
+
+		// Pass the entry through the send middlewares
+		passed, err := s.sendChain.apply(&entry)
+		if err != nil {
+			log.Errorf("Error in send middleware for entry %d to %s: %v", entry.Number, client.clientID, err)
+			return nextEntry, err
+		}
+		if !passed || (route != nil && !route.pass(&entry)) || !client.wantsEntry(&entry) {
+			nextEntry = entry.Number + 1
+			continue
+		}
+
 		// Send the file data entry
-		binaryEntry := encodeFileEntryToBinary(iterator.Entry)
+		binaryEntry := client.encodeEntry(entry)
 		log.Debugf("Sending data entry %d (type %d) to %s", iterator.Entry.Number, iterator.Entry.Type, client.clientID)
 		if client.conn != nil {
-			_, err = TimeoutWrite(client, binaryEntry, s.writeTimeout)
+			_, err = timeoutWriteRoute(client, tag, route, binaryEntry, s.writeTimeout)
 		} else {
 			err = ErrNilConnection
 		}
 		if err != nil {
 			log.Errorf("Error sending entry %d to %s: %v", iterator.Entry.Number, client.clientID, err)
-			return err
+			return nextEntry, err
 		}
+		nextEntry = iterator.Entry.Number + 1
 	}
 	log.Debugf("Synced %s until %d!", client.clientID, iterator.Entry.Number)
+	if tag == 0 {
+		client.sentEntry.Store(nextEntry)
+	}
 
 	// Close iterator
 	s.streamFile.iteratorEnd(iterator)
 
-	return nil
+	return nextEntry, nil
 }
 
 // sendResultEntry sends the response to a TCP command for the clients
@@ -1156,7 +2039,7 @@ func (s *StreamServer) sendResultEntry(errorNum uint32, errorStr string, client
 	// Send the result entry to the client
 	var err error
 	if client.conn != nil {
-		_, err = TimeoutWrite(client, binaryEntry, s.writeTimeout)
+		_, err = timeoutWriteTagged(client, client.cmdTag, binaryEntry, s.writeTimeout)
 	} else {
 		err = ErrNilConnection
 	}
@@ -1238,36 +2121,48 @@ func readFullBytes(length uint32, client *client) ([]byte, error) {
 	return buffer, nil
 }
 
+// readBookmarkParam reads from a connection a bookmark parameter (length and bookmark bytes)
+func readBookmarkParam(client *client) ([]byte, error) {
+	// Read bookmark length parameter
+	length, err := readFullUint32(client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check maximum length allowed
+	if length > maxBookmarkLength {
+		log.Errorf("Client %s exceeded [%d] maximum allowed length [%d] for a bookmark.",
+			client.clientID, length, maxBookmarkLength)
+		return nil, ErrBookmarkMaxLength
+	}
+
+	// Read bookmark parameter
+	return readFullBytes(length, client)
+}
+
 // encodeResultEntryToBinary encodes from a result entry type to binary bytes slice
 func encodeResultEntryToBinary(e ResultEntry) []byte {
-	be := make([]byte, 1)
-	be[0] = e.packetType
-	be = binary.BigEndian.AppendUint32(be, e.length)
-	be = binary.BigEndian.AppendUint32(be, e.errorNum)
-	be = append(be, e.errorStr...) //nolint:makezero
-	return be
+	return codec.EncodeResult(codec.Result{
+		PacketType: e.packetType,
+		Length:     e.length,
+		ErrorNum:   e.errorNum,
+		ErrorStr:   e.errorStr,
+	})
 }
 
 // DecodeBinaryToResultEntry decodes from binary bytes slice to a result entry type
 func DecodeBinaryToResultEntry(b []byte) (ResultEntry, error) {
-	e := ResultEntry{}
-
-	if len(b) < FixedSizeResultEntry {
-		log.Error("Invalid binary result entry")
-		return e, ErrInvalidBinaryEntry
+	r, err := codec.DecodeResult(b)
+	e := ResultEntry{
+		packetType: r.PacketType,
+		length:     r.Length,
+		errorNum:   r.ErrorNum,
+		errorStr:   r.ErrorStr,
 	}
-
-	e.packetType = b[0]
-	e.length = binary.BigEndian.Uint32(b[1:5])
-	e.errorNum = binary.BigEndian.Uint32(b[5:9])
-	e.errorStr = b[9:]
-
-	if uint32(len(e.errorStr)) != e.length-FixedSizeResultEntry {
-		log.Error("Error decoding binary result entry")
-		return e, ErrDecodingBinaryResultEntry
+	if err != nil {
+		log.Errorf("Error decoding binary result entry: %v", err)
 	}
-
-	return e, nil
+	return e, err
 }
 
 // PrintResultEntry prints result entry type
@@ -1281,11 +2176,43 @@ func PrintResultEntry(e ResultEntry) {
 
 // IsACommand checks if a command is a valid command
 func (c Command) IsACommand() bool {
-	return c >= CmdStart && c <= CmdBookmark
+	return c >= CmdStart && c <= CmdChecksum
+}
+
+// IsTaggable checks if a command can be sent tagged with a subscription/request ID
+func (c Command) IsTaggable() bool {
+	return c.IsACommand() && c != CmdMux && c != CmdAuth && c != CmdEntryTypes && c != CmdCompression &&
+		c != CmdPing && c != CmdChecksum
 }
 
-// TimeoutWrite sets a deadline time before write
+// IsTaggedOnly checks if a command can only be sent tagged (subscription commands without untagged version)
+func (c Command) IsTaggedOnly() bool {
+	return c == CmdStartShard || c == CmdWatchBookmarks || c == CmdStartGroup || c == CmdCommitGroup
+}
+
+// timeoutWriteTagged writes the data prefixed with the tagged frame header (if tag is not zero)
+func timeoutWriteTagged(client *client, tag uint64, data []byte, timeout time.Duration) (int, error) {
+	if tag == 0 {
+		return TimeoutWrite(client, data, timeout)
+	}
+	return TimeoutWrite(client, encodeTaggedFrame(tag, data), timeout)
+}
+
+// encodeTaggedFrame encodes a frame tagged with a subscription/request ID to binary bytes
+func encodeTaggedFrame(tag uint64, data []byte) []byte {
+	return codec.EncodeTaggedFrame(tag, data)
+}
+
+// TimeoutWrite sets a deadline time before write, in the control lane
 func TimeoutWrite(client *client, data []byte, timeout time.Duration) (int, error) {
+	return timeoutWriteLane(client, data, timeout, false)
+}
+
+// timeoutWriteLane sets a deadline time before write, in the control or the bulk lane
+func timeoutWriteLane(client *client, data []byte, timeout time.Duration, bulk bool) (int, error) {
+	client.writeLanes.lock(bulk)
+	defer client.writeLanes.unlock()
+
 	err := client.conn.SetWriteDeadline(time.Now().Add(timeout))
 	if err != nil {
 		log.Warnf("Error setting write deadline: %v", err)
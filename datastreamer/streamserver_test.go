@@ -1,14 +1,41 @@
 package datastreamer
 
 import (
+	"encoding/binary"
+	"io"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// freePort returns a free TCP port of the local host to listen on
+func freePort(t *testing.T) uint16 {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
 func TestProcessCommand(t *testing.T) {
-	server := new(StreamServer)
-	cli := &client{status: csSyncing}
+	server := &StreamServer{writeTimeout: time.Second}
+	conn, peer := net.Pipe()
+	defer func() { _ = peer.Close() }()
+	cli := &client{conn: conn, status: csSyncing}
+
+	// Parameters of the commands rejected (Start, StartBookmark, Entry and Bookmark), read to keep in sync
+	written := make(chan struct{})
+	go func() {
+		params := binary.BigEndian.AppendUint64(nil, 1)
+		params = append(binary.BigEndian.AppendUint32(params, 1), 0xb0)
+		params = binary.BigEndian.AppendUint64(params, 1)
+		params = append(binary.BigEndian.AppendUint32(params, 1), 0xb0)
+		_, _ = peer.Write(params)
+		close(written)
+	}()
+	go func() { _, _ = io.Copy(io.Discard, peer) }()
 
 	// Test CmdStart
 	err := server.processCommand(CmdStart, cli)
@@ -34,7 +61,79 @@ func TestProcessCommand(t *testing.T) {
 	err = server.processCommand(CmdBookmark, cli)
 	assert.EqualError(t, ErrBookmarkCommandNotAllowed, err.Error())
 
+	// Test CmdStats
+	err = server.processCommand(CmdStats, cli)
+	assert.EqualError(t, ErrStatsCommandNotAllowed, err.Error())
+
+	// Test CmdMux
+	err = server.processCommand(CmdMux, cli)
+	assert.EqualError(t, ErrMuxCommandNotAllowed, err.Error())
+
+	// Test CmdMux on a stream of a multiplexed session
+	muxCli := &client{status: csStopped, muxStream: true}
+	err = server.processCommand(CmdMux, muxCli)
+	assert.EqualError(t, ErrMuxCommandNotAllowed, err.Error())
+
 	// Test invalid command
 	err = server.processCommand(Command(100), cli)
 	assert.EqualError(t, ErrInvalidCommand, err.Error())
+
+	// Test parameters of the commands rejected read
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("parameters of the commands rejected not read")
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	server := &StreamServer{started: true, validationDone: make(chan struct{})}
+
+	// Case: Validation in progress -> FAIL
+	err := server.StartAtomicOp()
+	assert.ErrorIs(t, err, ErrValidationInProgress)
+
+	// Case: Validation failed -> FAIL
+	server.validationErr = ErrStreamFileValidation
+	close(server.validationDone)
+	err = server.StartAtomicOp()
+	assert.ErrorIs(t, err, ErrStreamFileValidation)
+	assert.ErrorIs(t, server.WaitValidation(), ErrStreamFileValidation)
+
+	// Case: Validation completed -> OK
+	server.validationErr = nil
+	err = server.StartAtomicOp()
+	assert.NoError(t, err)
+}
+
+func TestWriteLanes(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer func() { _ = peer.Close() }()
+	cli := &client{conn: conn}
+	waiting := func(control int, bulk int) func() bool {
+		return func() bool {
+			waitingControl, waitingBulk := cli.writeLanes.waiting()
+			return waitingControl == control && waitingBulk == bulk
+		}
+	}
+
+	// Case: Control frame queued after a bulk frame, both waiting for a bulk write -> Control frame written first
+	go func() { _, _ = timeoutWriteBulk(cli, 0, []byte{1}, time.Second) }()
+	assert.Eventually(t, func() bool {
+		cli.writeLanes.mutex.Lock()
+		defer cli.writeLanes.mutex.Unlock()
+		return cli.writeLanes.writing
+	}, time.Second, time.Millisecond)
+	go func() { _, _ = timeoutWriteBulk(cli, 0, []byte{2}, time.Second) }()
+	assert.Eventually(t, waiting(0, 1), time.Second, time.Millisecond)
+	go func() { _, _ = TimeoutWrite(cli, []byte{3}, time.Second) }()
+	assert.Eventually(t, waiting(1, 1), time.Second, time.Millisecond)
+
+	frame := make([]byte, 1)
+	for _, expected := range []byte{1, 3, 2} {
+		_, err := io.ReadFull(peer, frame)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, frame[0])
+	}
+	assert.Eventually(t, waiting(0, 0), time.Second, time.Millisecond)
 }
@@ -0,0 +1,182 @@
+package datastreamer
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const maxShardSearchPages = 64 // Maximum data pages to search backwards the bookmark of the start entry of a shard
+
+// entryRoute type to route to a subscription only some entries of the stream
+type entryRoute interface {
+	pass(e *FileEntry) bool // Checks if an entry streamed is routed to the subscription
+}
+
+// shardFilter type to route to a subscription only the entries of its shard of the stream
+type shardFilter struct {
+	shard   uint32 // Shard of the subscription
+	shards  uint32 // Total number of shards
+	current uint32 // Shard of the latest bookmark streamed
+}
+
+// ShardOf returns the shard of the entries following a bookmark, the FNV-1a hash of the bookmark modulo shards
+func ShardOf(bookmark []byte, shards uint32) uint32 {
+	return bookmarkHash(bookmark) % shards
+}
+
+// bookmarkHash returns the FNV-1a hash of a bookmark
+func bookmarkHash(bookmark []byte) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write(bookmark)
+	return h.Sum32()
+}
+
+// SubscribeShard starts a new streaming subscription from entry over the client connection, receiving only the
+// entries of a shard of the stream: the bookmarks with ShardOf(bookmark, shards) == shard and the entries that
+// follow them up to the next bookmark
+func (c *StreamClient) SubscribeShard(fromEntry uint64, shard uint32, shards uint32,
+	f ProcessEntryFunc) (*Subscription, error) {
+	if shards == 0 || shard >= shards {
+		log.Errorf("Invalid shard %d of %d", shard, shards)
+		return nil, ErrInvalidShard
+	}
+	return c.subscribe(CmdStartShard, fromEntry, encodeShardParam(shard, shards), f)
+}
+
+// encodeShardParam encodes the shard parameter of the CmdStartShard command to binary bytes
+func encodeShardParam(shard uint32, shards uint32) []byte {
+	param := binary.BigEndian.AppendUint32(nil, shard)
+	return binary.BigEndian.AppendUint32(param, shards)
+}
+
+// pass checks if an entry streamed belongs to the shard, a bookmark starts the entries of its shard
+func (f *shardFilter) pass(e *FileEntry) bool {
+	if e.Type == EtBookmark {
+		f.current = ShardOf(e.Data, f.shards)
+	}
+	return f.current == f.shard
+}
+
+// handleSubStartShardCommand processes the tagged CmdStartShard command creating a new sharded subscription
+func (s *StreamServer) handleSubStartShardCommand(cli *client, tag uint64) error {
+	// Read from entry number and shard parameters
+	fromEntry, err := readFullUint64(cli)
+	if err != nil {
+		return err
+	}
+	shard, err := readFullUint32(cli)
+	if err != nil {
+		return err
+	}
+	shards, err := readFullUint32(cli)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command StartShard from %d shard %d of %d for subscription %d",
+		cli.clientID, fromEntry, shard, shards, tag)
+
+	if shards == 0 || shard >= shards {
+		log.Errorf("StartShard command invalid shard %d of %d for client %s", shard, shards, cli.clientID)
+		_ = s.sendResultEntry(uint32(CmdErrBadShard), StrCommandErrors[CmdErrBadShard], cli)
+		return ErrInvalidShard
+	}
+
+	// Shard of the entries from the start entry up to the next bookmark
+	filter := &shardFilter{shard: shard, shards: shards}
+	bookmark, found, err := s.streamFile.lastBookmarkBefore(fromEntry)
+	if err != nil {
+		log.Warnf("Error searching the bookmark before entry %d: %v", fromEntry, err)
+	}
+	if found {
+		filter.current = ShardOf(bookmark, shards)
+	} else if fromEntry > s.streamFile.getHeaderEntry().BaseEntry {
+		log.Warnf("No bookmark found before entry %d, shard 0 assumed up to the next bookmark", fromEntry)
+	}
+
+	cli.cmdRoute = filter
+	defer func() { cli.cmdRoute = nil }()
+
+	sub, err := s.addSubscription(cli, tag)
+	if err != nil {
+		return err
+	}
+
+	nextEntry, err := s.startStreamingFromEntry(cli, fromEntry)
+	s.endSubscriptionSync(cli, sub, nextEntry, err)
+
+	return err
+}
+
+// lastBookmarkBefore returns the data of the last bookmark with entry number lower than entryNum, searching it
+// backwards from the data page of the previous entry
+func (f *StreamFile) lastBookmarkBefore(entryNum uint64) ([]byte, bool, error) {
+	header := f.getHeaderEntry()
+	if entryNum > header.TotalEntries {
+		entryNum = header.TotalEntries
+	}
+	if entryNum <= header.BaseEntry {
+		return nil, false, nil
+	}
+
+	// Locate the end of the previous entry
+	iterator, err := f.iteratorFrom(entryNum-1, true)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.iteratorEnd(iterator)
+
+	pos, err := iterator.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false, err
+	}
+	end, err := f.iteratorNext(iterator)
+	if err != nil || end {
+		return nil, false, err
+	}
+	page, limit := dataPagePosition(uint64(pos) + uint64(iterator.Entry.Length))
+
+	// Scan the data pages backwards
+	buffer := make([]byte, f.pageSize)
+	for i := 0; i < maxShardSearchPages; i++ {
+		bookmark, found, err := f.pageLastBookmark(page, limit, buffer)
+		if err != nil || found {
+			return bookmark, found, err
+		}
+		if page == 0 {
+			break
+		}
+		page--
+		limit = uint64(f.pageSize)
+	}
+	return nil, false, nil
+}
+
+// pageLastBookmark returns the data of the last bookmark of a data page up to a length in the page
+func (f *StreamFile) pageLastBookmark(page uint64, limit uint64, buffer []byte) ([]byte, bool, error) {
+	data := buffer[:limit]
+	_, err := f.file.ReadAt(data, int64(PageHeaderSize+page*uint64(f.pageSize)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	var bookmark []byte
+	found := false
+	offset := uint64(0)
+	for offset+FixedSizeFileEntry <= limit && data[offset] == PtData {
+		length := uint64(binary.BigEndian.Uint32(data[offset+1 : offset+5]))
+		if length < FixedSizeFileEntry || offset+length > limit {
+			return nil, false, ErrDecodingLengthDataEntry
+		}
+		if EntryType(binary.BigEndian.Uint32(data[offset+5:offset+9])) == EtBookmark {
+			bookmark = append([]byte{}, data[offset+FixedSizeFileEntry:offset+length]...)
+			found = true
+		}
+		offset += length
+	}
+	return bookmark, found, nil
+}
@@ -0,0 +1,100 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardSubscriptions(t *testing.T) {
+	const (
+		shards   = 3
+		segments = 8
+	)
+	server, port := newTestServer(t, "shard.bin")
+	require.NoError(t, server.Start())
+
+	// Segments of a bookmark followed by 2 entries, expected shard of each entry
+	var owners []uint32
+	addSegments := func(from int, to int) {
+		require.NoError(t, server.StartAtomicOp())
+		for i := from; i < to; i++ {
+			bookmark := []byte{byte(i)}
+			_, err := server.AddStreamBookmark(bookmark)
+			require.NoError(t, err)
+			for j := 0; j < 2; j++ {
+				_, err = server.AddStreamEntry(entryType1, testEntries[1].Encode())
+				require.NoError(t, err)
+			}
+			owner := datastreamer.ShardOf(bookmark, shards)
+			owners = append(owners, owner, owner, owner)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+	addSegments(0, segments)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+
+	var mutex sync.Mutex
+	received := make(map[uint32][]uint64)
+	collect := func(key uint32) datastreamer.ProcessEntryFunc {
+		return func(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			received[key] = append(received[key], e.Number)
+			mutex.Unlock()
+			return nil
+		}
+	}
+	expected := func(shard uint32, fromEntry uint64) []uint64 {
+		var entries []uint64
+		for i := fromEntry; i < uint64(len(owners)); i++ {
+			if owners[i] == shard {
+				entries = append(entries, i)
+			}
+		}
+		return entries
+	}
+	check := func(key uint32, shard uint32, fromEntry uint64) {
+		require.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return reflect.DeepEqual(expected(shard, fromEntry), received[key])
+		}, 2*time.Second, 10*time.Millisecond, "shard %d from entry %d", shard, fromEntry)
+	}
+
+	// Case: Shards from the start of the stream -> Each segment received only by its shard
+	for shard := uint32(0); shard < shards; shard++ {
+		_, err = client.SubscribeShard(0, shard, shards, collect(shard))
+		require.NoError(t, err)
+	}
+
+	// Case: Shard from the middle of a segment -> Rest of the segment received by its shard
+	midShard := owners[4]
+	_, err = client.SubscribeShard(4, midShard, shards, collect(shards))
+	require.NoError(t, err)
+
+	for shard := uint32(0); shard < shards; shard++ {
+		check(shard, shard, 0)
+	}
+	check(shards, midShard, 4)
+
+	// Case: New segments broadcast -> Routed to their shards
+	addSegments(segments, 2*segments)
+	for shard := uint32(0); shard < shards; shard++ {
+		check(shard, shard, 0)
+	}
+	check(shards, midShard, 4)
+
+	// Case: Invalid shard -> FAIL
+	_, err = client.SubscribeShard(0, shards, shards, nil)
+	require.ErrorIs(t, err, datastreamer.ErrInvalidShard)
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
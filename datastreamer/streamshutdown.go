@@ -0,0 +1,118 @@
+package datastreamer
+
+import (
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const drainCheckInterval = 100 * time.Millisecond // Interval to check if the clients are drained on shutdown
+
+// Shutdown stops accepting new connections and lets the pending broadcasts and the clients catch-ups finish up to the
+// drain timeout. Then notifies the shutdown to the clients and closes their connections (and deletes the stream if
+// it's ephemeral)
+func (s *StreamServer) Shutdown(drainTimeout time.Duration) error {
+	if !s.started {
+		log.Errorf("Shutdown not allowed. Server is not started")
+		return ErrShutdownNotAllowed
+	}
+
+	// Stop accepting new connections
+	log.Infof("Shutting down, draining clients up to %v", drainTimeout)
+	s.notifyStopping()
+	s.mutexShutdown.Lock()
+	s.shuttingDown = true
+	s.mutexShutdown.Unlock()
+	s.closeListener()
+
+	// Wait for the pending broadcasts and catch-ups
+	deadline := time.Now().Add(drainTimeout)
+	for !s.isDrained() && time.Now().Before(deadline) {
+		time.Sleep(drainCheckInterval)
+	}
+	if !s.isDrained() {
+		log.Warnf("Drain timeout reached, shutting down with clients still syncing")
+	}
+
+	// Notify the shutdown to the clients and close their connections
+	s.mutexClients.RLock()
+	clients := make([]*client, 0, len(s.clients))
+	for _, cli := range s.clients {
+		clients = append(clients, cli)
+	}
+	s.mutexClients.RUnlock()
+
+	for _, cli := range clients {
+		if cli.conn != nil {
+			_, err := TimeoutWrite(cli, []byte{PtShutdown}, s.writeTimeout)
+			if err != nil {
+				log.Debugf("Error sending shutdown to %s: %v", cli.clientID, err)
+			}
+		}
+		s.killClient(cli.clientID)
+	}
+
+	s.started = false
+	log.Infof("Shutdown completed, %d clients notified", len(clients))
+
+	// Shutdown the summary stream derived from this one
+	if s.summary != nil && s.summary.server.started {
+		err := s.summary.server.Shutdown(drainTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Delete the ephemeral stream
+	if s.ephemeralDir != "" {
+		return s.Close()
+	}
+	return nil
+}
+
+// isShuttingDown checks if the server shutdown is in progress
+func (s *StreamServer) isShuttingDown() bool {
+	s.mutexShutdown.Lock()
+	defer s.mutexShutdown.Unlock()
+
+	return s.shuttingDown
+}
+
+// addPendingBroadcast updates the number of committed atomic operations pending to broadcast
+func (s *StreamServer) addPendingBroadcast(delta int) {
+	s.mutexShutdown.Lock()
+	s.pendingBroadcasts += delta
+	s.mutexShutdown.Unlock()
+}
+
+// isDrained checks if there are no atomic operations pending to broadcast and no clients catching up
+func (s *StreamServer) isDrained() bool {
+	s.mutexShutdown.Lock()
+	pending := s.pendingBroadcasts
+	s.mutexShutdown.Unlock()
+	if pending > 0 {
+		return false
+	}
+
+	s.mutexClients.RLock()
+	defer s.mutexClients.RUnlock()
+
+	for _, cli := range s.clients {
+		if cli.getStatus() == csSyncing {
+			return false
+		}
+		if q := cli.getLive(); q != nil && q.isPending() {
+			return false
+		}
+
+		cli.mutexSubs.RLock()
+		for _, sub := range cli.subs {
+			if sub.status == csSyncing {
+				cli.mutexSubs.RUnlock()
+				return false
+			}
+		}
+		cli.mutexSubs.RUnlock()
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerShutdown(t *testing.T) {
+	server, port := newTestServer(t, "shutdown.bin")
+
+	// Case: Shutdown not started server -> FAIL
+	err := server.Shutdown(time.Second)
+	require.EqualError(t, datastreamer.ErrShutdownNotAllowed, err.Error())
+
+	err = server.Start()
+	require.NoError(t, err)
+	addTestEntries(t, server, 10)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	err = client.Start()
+	require.NoError(t, err)
+
+	received := make(chan uint64, 10)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		received <- e.Number
+		return nil
+	})
+	err = client.ExecCommandStart(0)
+	require.NoError(t, err)
+
+	// Case: Shutdown, client catch-up finished and shutdown notified -> OK
+	err = server.Shutdown(2 * time.Second)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(received) == 10
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return client.GetStats().LastError == "read: "+datastreamer.ErrServerShutdown.Error()
+	}, time.Second, 10*time.Millisecond)
+
+	// Case: Connect after shutdown -> FAIL
+	_, err = net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	require.Error(t, err)
+}
@@ -0,0 +1,204 @@
+package datastreamer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const defaultSLOInterval = 10 * time.Second // Default evaluation window of the service level objectives
+
+// Service level objectives of the violations
+const (
+	SLOClientLag     = "client lag"     // SLOClientLag for a streaming client behind the entries committed
+	SLOCommitLatency = "commit latency" // SLOCommitLatency for the maximum latency of the commits exceeded
+	SLOThroughput    = "throughput"     // SLOThroughput for the entries committed per second below the minimum
+)
+
+// SLOConfig type for the service level objectives evaluated by the server, the zero values disable each objective
+type SLOConfig struct {
+	Interval         time.Duration // Evaluation window of the objectives (10s if 0)
+	MaxClientLag     uint64        // Maximum entries a streaming client is behind the entries committed
+	MaxCommitLatency time.Duration // Maximum latency of the commits of the atomic operations
+	MinThroughput    float64       // Minimum entries committed per second
+}
+
+// SLOViolation type for a change of the state of a service level objective passed to the alert callbacks
+type SLOViolation struct {
+	Time      time.Time `json:"time"`             // End of the evaluation window
+	Objective string    `json:"objective"`        // client lag|commit latency|throughput
+	Client    string    `json:"client,omitempty"` // ID of the client lagging (client lag)
+	Value     float64   `json:"value"`            // Value evaluated: entries, milliseconds or entries per second
+	Limit     float64   `json:"limit"`            // Limit of the objective, in the same units
+	Resolved  bool      `json:"resolved"`         // Flag the objective is met again after its violation
+}
+
+// SLOAlertFunc type of the alert callback function called on a violation of a service level objective (and on its
+// resolution)
+type SLOAlertFunc func(SLOViolation)
+
+// sloMonitor type to evaluate the service level objectives of the server
+type sloMonitor struct {
+	config SLOConfig
+	alerts []SLOAlertFunc
+
+	mutex     sync.Mutex
+	entries   uint64        // Entries committed in the current window
+	commitMax time.Duration // Maximum latency of the commits in the current window
+
+	violated map[sloKey]bool // Objectives violated (by client for the client lag)
+}
+
+// sloKey type for the key of an objective violated
+type sloKey struct {
+	objective string
+	client    string
+}
+
+// SetSLO sets the service level objectives evaluated continuously by the server every interval: the maximum lag of
+// the streaming clients behind the entries committed, the maximum latency of the commits and the minimum throughput
+// of the entries committed. A violation is logged as a structured warning and passed to the alert callbacks, once
+// when the objective is violated and once when it's met again (call before Start)
+func (s *StreamServer) SetSLO(config SLOConfig) {
+	if config.Interval <= 0 {
+		config.Interval = defaultSLOInterval
+	}
+	s.getSLO().config = config
+}
+
+// OnSLOViolation registers an alert callback function called on the violations of the service level objectives and
+// on their resolution, in order from the goroutine of the evaluation (call before Start)
+func (s *StreamServer) OnSLOViolation(alert SLOAlertFunc) {
+	m := s.getSLO()
+	m.alerts = append(m.alerts, alert)
+}
+
+// SetSLO sets the service level objectives evaluated by the relay server side (call before Start)
+func (r *StreamRelay) SetSLO(config SLOConfig) {
+	r.server.SetSLO(config)
+}
+
+// OnSLOViolation registers an alert callback function of the service level objectives of the relay server side
+// (call before Start)
+func (r *StreamRelay) OnSLOViolation(alert SLOAlertFunc) {
+	r.server.OnSLOViolation(alert)
+}
+
+// getSLO returns the service level objectives monitor, created on the first setting
+func (s *StreamServer) getSLO() *sloMonitor {
+	if s.slo == nil {
+		s.slo = &sloMonitor{
+			config:   SLOConfig{Interval: defaultSLOInterval},
+			violated: make(map[sloKey]bool),
+		}
+	}
+	return s.slo
+}
+
+// enabled checks if any service level objective is set
+func (m *sloMonitor) enabled() bool {
+	return m != nil && (m.config.MaxClientLag > 0 || m.config.MaxCommitLatency > 0 || m.config.MinThroughput > 0)
+}
+
+// commit records an atomic operation committed
+func (m *sloMonitor) commit(entries uint64, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.entries += entries
+	m.commitMax = max(m.commitMax, latency)
+}
+
+// monitorSLO evaluates the service level objectives every interval
+func (s *StreamServer) monitorSLO() {
+	ticker := time.NewTicker(s.slo.config.Interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.evaluateSLO(now)
+	}
+}
+
+// evaluateSLO evaluates the service level objectives over the window ended, and starts a new one
+func (s *StreamServer) evaluateSLO(now time.Time) {
+	m := s.slo
+	m.mutex.Lock()
+	entries, commitMax := m.entries, m.commitMax
+	m.entries, m.commitMax = 0, 0
+	m.mutex.Unlock()
+
+	if m.config.MaxCommitLatency > 0 {
+		m.check(now, SLOCommitLatency, "", toMs(commitMax), toMs(m.config.MaxCommitLatency),
+			commitMax > m.config.MaxCommitLatency)
+	}
+	if m.config.MinThroughput > 0 {
+		throughput := float64(entries) / m.config.Interval.Seconds()
+		m.check(now, SLOThroughput, "", throughput, m.config.MinThroughput, throughput < m.config.MinThroughput)
+	}
+	if m.config.MaxClientLag > 0 {
+		s.evaluateClientLag(now)
+	}
+}
+
+// evaluateClientLag evaluates the lag of each streaming client behind the entries committed
+func (s *StreamServer) evaluateClientLag(now time.Time) {
+	m := s.slo
+	total := s.streamFile.getHeaderEntry().TotalEntries
+	lags := make(map[string]uint64)
+	s.mutexClients.RLock()
+	for id, cli := range s.clients {
+		status := cli.getStatus()
+		if status != csSyncing && status != csSynced {
+			continue
+		}
+		if sent := cli.sentEntry.Load(); total > sent {
+			lags[id] = total - sent
+		} else {
+			lags[id] = 0
+		}
+	}
+	s.mutexClients.RUnlock()
+
+	for id, lag := range lags {
+		m.check(now, SLOClientLag, id, float64(lag), float64(m.config.MaxClientLag), lag > m.config.MaxClientLag)
+	}
+
+	// The clients disconnected or stopped meanwhile don't lag anymore
+	for key := range m.violated {
+		if _, found := lags[key.client]; key.objective == SLOClientLag && !found {
+			m.check(now, SLOClientLag, key.client, 0, float64(m.config.MaxClientLag), false)
+		}
+	}
+}
+
+// check updates the state of an objective, alerting on its violation and on its resolution
+func (m *sloMonitor) check(now time.Time, objective string, client string, value float64, limit float64,
+	violated bool) {
+	key := sloKey{objective: objective, client: client}
+	if violated == m.violated[key] {
+		return
+	}
+	if violated {
+		m.violated[key] = true
+		log.Warnw("SLO violation", "objective", objective, "client", client, "value", value, "limit", limit)
+	} else {
+		delete(m.violated, key)
+		log.Infow("SLO resolved", "objective", objective, "client", client, "value", value, "limit", limit)
+	}
+
+	violation := SLOViolation{
+		Time:      now,
+		Objective: objective,
+		Client:    client,
+		Value:     value,
+		Limit:     limit,
+		Resolved:  !violated,
+	}
+	for _, alert := range m.alerts {
+		alert(violation)
+	}
+}
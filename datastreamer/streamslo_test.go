@@ -0,0 +1,73 @@
+package datastreamer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSLOMonitor(t *testing.T) {
+	lagging := &client{clientID: "lagging", status: csSynced}
+	stopped := &client{clientID: "stopped", status: csStopped}
+	s := &StreamServer{
+		streamFile: &StreamFile{},
+		clients:    map[string]*client{"lagging": lagging, "stopped": stopped},
+	}
+	s.streamFile.writtenHead.TotalEntries = 100
+
+	violations := []SLOViolation{}
+	s.OnSLOViolation(func(v SLOViolation) {
+		violations = append(violations, v)
+	})
+	s.SetSLO(SLOConfig{
+		Interval:         time.Second,
+		MaxClientLag:     10,
+		MaxCommitLatency: 50 * time.Millisecond,
+		MinThroughput:    5,
+	})
+	require.True(t, s.slo.enabled())
+	now := time.Now()
+
+	// Case: Slow commits, low throughput and a streaming client lagging -> Violations of the 3 objectives
+	lagging.sentEntry.Store(80)
+	stopped.sentEntry.Store(0)
+	s.slo.commit(2, 80*time.Millisecond)
+	s.slo.commit(1, 10*time.Millisecond)
+	s.evaluateSLO(now)
+	require.Len(t, violations, 3)
+	assert.Equal(t, SLOViolation{Time: now, Objective: SLOCommitLatency, Value: 80, Limit: 50}, violations[0])
+	assert.Equal(t, SLOViolation{Time: now, Objective: SLOThroughput, Value: 3, Limit: 5}, violations[1])
+	assert.Equal(t, SLOViolation{Time: now, Objective: SLOClientLag, Client: "lagging", Value: 20, Limit: 10},
+		violations[2])
+
+	// Case: Objectives still violated -> No new alerts
+	s.slo.commit(1, 60*time.Millisecond)
+	s.evaluateSLO(now)
+	require.Len(t, violations, 3)
+
+	// Case: Objectives met again -> Resolved alerts
+	violations = violations[:0]
+	lagging.sentEntry.Store(95)
+	s.slo.commit(10, 5*time.Millisecond)
+	s.evaluateSLO(now)
+	require.Len(t, violations, 3)
+	for _, v := range violations {
+		assert.True(t, v.Resolved, v.Objective)
+	}
+
+	// Case: Client lagging disconnected -> Its violation resolved
+	violations = violations[:0]
+	s.SetSLO(SLOConfig{MaxClientLag: 10})
+	lagging.sentEntry.Store(0)
+	s.evaluateSLO(now)
+	require.Len(t, violations, 1)
+	assert.False(t, violations[0].Resolved)
+	delete(s.clients, "lagging")
+	s.evaluateSLO(now)
+	require.Len(t, violations, 2)
+	assert.Equal(t, SLOViolation{Time: now, Objective: SLOClientLag, Client: "lagging", Limit: 10, Resolved: true},
+		violations[1])
+	assert.Equal(t, defaultSLOInterval, s.slo.config.Interval)
+}
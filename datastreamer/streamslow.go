@@ -0,0 +1,187 @@
+package datastreamer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const slowConsumerCheckInterval = time.Second // Maximum interval to check the slow consumer conditions
+
+// Slow consumer alert reasons
+const (
+	SlowReasonLatency   = "latency"    // SlowReasonLatency for the process entry function average latency exceeded
+	SlowReasonQueueFull = "queue full" // SlowReasonQueueFull for the entries channel full for too long
+)
+
+// SlowConsumerInfo type for the diagnostics of a slow consumer alert
+type SlowConsumerInfo struct {
+	Reason        string        // latency|queue full
+	Entry         uint64        // Entry number in process (or latest processed)
+	AvgLatency    time.Duration // Average latency of the process entry function since the previous check
+	QueueDepth    int           // Entries received pending in the entries channel
+	QueueCapacity int           // Capacity of the entries channel
+	Prefetched    int           // Entries prefetched ready to process (if prefetch enabled)
+	FullFor       time.Duration // Time the entries channel has been full
+}
+
+// SlowConsumerFunc type of the hook function called on a slow consumer alert
+type SlowConsumerFunc func(SlowConsumerInfo)
+
+// slowConsumer type to detect a slow processing of the streaming entries
+type slowConsumer struct {
+	maxLatency  time.Duration
+	maxFullTime time.Duration
+	alert       SlowConsumerFunc
+
+	mutex        sync.Mutex
+	processing   bool          // Flag an entry is in process
+	processStart time.Time     // Start time of the processing of the entry in process
+	entry        uint64        // Entry number in process (or latest processed)
+	total        time.Duration // Processing time of the entries since the previous check
+	count        uint64        // Entries processed since the previous check
+	fullSince    time.Time     // Time the entries channel was found full (zero if not full)
+
+	latencyAlerted bool // Flag latency alert raised, until the average latency is under the threshold again
+	fullAlerted    bool // Flag queue full alert raised, until the channel is not full again
+}
+
+// SetSlowConsumerAlert sets the client to detect a slow processing of the streaming entries: an alert is logged and
+// the hook function called (if not nil) when the average latency of the process entry function exceeds maxLatency,
+// or when the entries channel stays full for maxFullTime (0 disables each condition). An alert is raised once until
+// its condition clears. The conditions are checked every second, or every quarter of the lowest threshold if shorter
+// (call before Start)
+func (c *StreamClient) SetSlowConsumerAlert(maxLatency time.Duration, maxFullTime time.Duration,
+	alert SlowConsumerFunc) {
+	if maxLatency <= 0 && maxFullTime <= 0 {
+		c.slow = nil
+		return
+	}
+	c.slow = &slowConsumer{
+		maxLatency:  maxLatency,
+		maxFullTime: maxFullTime,
+		alert:       alert,
+	}
+}
+
+// begin records the start of the processing of an entry
+func (s *slowConsumer) begin(entryNum uint64) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.processing = true
+	s.processStart = time.Now()
+	s.entry = entryNum
+}
+
+// end records the end of the processing of the entry in process
+func (s *slowConsumer) end() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.processing = false
+	s.total += time.Since(s.processStart)
+	s.count++
+}
+
+// processed records the processing time of an entry processed by a worker, concurrently with the other workers
+func (s *slowConsumer) processed(entryNum uint64, latency time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entry = entryNum
+	s.total += latency
+	s.count++
+}
+
+// checkInterval returns the interval to check the slow consumer conditions
+func (s *slowConsumer) checkInterval() time.Duration {
+	interval := slowConsumerCheckInterval
+	for _, threshold := range []time.Duration{s.maxLatency, s.maxFullTime} {
+		if threshold > 0 && threshold/4 < interval {
+			interval = threshold / 4 //nolint:mnd
+		}
+	}
+	return interval
+}
+
+// check checks the slow consumer conditions, returns the alerts to raise
+func (s *slowConsumer) check(queueDepth int, queueCapacity int) []SlowConsumerInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	info := SlowConsumerInfo{
+		Entry:         s.entry,
+		QueueDepth:    queueDepth,
+		QueueCapacity: queueCapacity,
+	}
+
+	// Average latency, including the entry in process
+	total, count := s.total, s.count
+	if s.processing {
+		total += now.Sub(s.processStart)
+		count++
+	}
+	if count > 0 {
+		info.AvgLatency = total / time.Duration(count)
+	}
+	s.total, s.count = 0, 0
+
+	// Time the entries channel has been full
+	if queueDepth >= queueCapacity {
+		if s.fullSince.IsZero() {
+			s.fullSince = now
+		}
+		info.FullFor = now.Sub(s.fullSince)
+	} else {
+		s.fullSince = time.Time{}
+	}
+
+	alerts := []SlowConsumerInfo{}
+	if s.maxLatency > 0 {
+		slow := info.AvgLatency > s.maxLatency
+		if slow && !s.latencyAlerted {
+			info.Reason = SlowReasonLatency
+			alerts = append(alerts, info)
+		}
+		s.latencyAlerted = slow
+	}
+	if s.maxFullTime > 0 {
+		full := !s.fullSince.IsZero() && info.FullFor >= s.maxFullTime
+		if full && !s.fullAlerted {
+			info.Reason = SlowReasonQueueFull
+			alerts = append(alerts, info)
+		}
+		s.fullAlerted = full
+	}
+	return alerts
+}
+
+// checkSlowConsumer checks periodically the slow consumer conditions, raising the alerts
+func (c *StreamClient) checkSlowConsumer() {
+	for c.wait(c.slow.checkInterval()) {
+
+		for _, info := range c.slow.check(len(c.entries), cap(c.entries)) {
+			if c.prefetch != nil {
+				info.Prefetched = c.prefetch.len()
+			}
+			log.Warnf("%s Slow consumer (%s): entry %d, average latency %v, queue %d/%d, prefetched %d, full for %v",
+				c.ID, info.Reason, info.Entry, info.AvgLatency, info.QueueDepth, info.QueueCapacity, info.Prefetched,
+				info.FullFor)
+			if c.slow.alert != nil {
+				c.slow.alert(info)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSlowConsumer(t *testing.T) {
+	server, port := newTestServer(t, "slow.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 200)
+
+	// Entries channel smaller than the entries, whatever the memory available
+	datastreamer.SetBufferSizes(datastreamer.BufferSizes{ClientEntries: 128})
+	defer datastreamer.SetBufferSizes(datastreamer.BufferSizes{})
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	alerts := make(chan datastreamer.SlowConsumerInfo, 10)
+	client.SetSlowConsumerAlert(20*time.Millisecond, 200*time.Millisecond, func(info datastreamer.SlowConsumerInfo) {
+		alerts <- info
+	})
+	release := make(chan struct{})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		<-release
+		return nil
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+
+	// Case: Processing of the first entry blocked -> latency alert
+	info := <-alerts
+	require.Equal(t, datastreamer.SlowReasonLatency, info.Reason)
+	require.Equal(t, uint64(0), info.Entry)
+	require.Greater(t, info.AvgLatency, 20*time.Millisecond)
+
+	// Case: Entries channel full for the threshold -> queue full alert
+	info = <-alerts
+	require.Equal(t, datastreamer.SlowReasonQueueFull, info.Reason)
+	require.Equal(t, info.QueueCapacity, info.QueueDepth)
+	require.GreaterOrEqual(t, info.FullFor, 200*time.Millisecond)
+
+	// Case: Alerts raised once until the conditions clear -> OK
+	require.Never(t, func() bool {
+		return len(alerts) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+	close(release)
+}
@@ -0,0 +1,232 @@
+package datastreamer
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// spillQueue type for the bounded on-disk queue of the streaming entries received while the entries channel is full
+type spillQueue struct {
+	dir      string
+	maxBytes uint64 // Maximum size of the queue file
+
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	file     *os.File // Queue file (nil until the first entry is spilled)
+	writeOff uint64   // Offset to write the next entry spilled
+	readOff  uint64   // Offset to read the next entry to drain
+	pending  int      // Entries spilled not yet delivered to the entries channel
+	closed   bool
+}
+
+// SetSpillover sets the client to spill the streaming entries received to a bounded queue file in a directory (the
+// temporary one if empty) while the entries channel is full, instead of blocking the connection and triggering the
+// slow client handling of the server. The entries are drained back to the channel in order as the consumer catches
+// up, and the file space is reclaimed once the queue is empty. The queue file is limited to maxBytes (an entry of
+// more is spilled alone), the connection blocks meanwhile it's full. A maxBytes of 0 disables it (call before Start)
+func (c *StreamClient) SetSpillover(dir string, maxBytes uint64) {
+	if maxBytes == 0 {
+		c.spill = nil
+		return
+	}
+	c.spill = &spillQueue{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+	c.spill.cond = sync.NewCond(&c.spill.mutex)
+}
+
+// queueEntry sends a streaming data entry to the entries channel, spilling it to the disk queue (if set) while the
+// channel is full or there are entries spilled pending
+func (c *StreamClient) queueEntry(e FileEntry) {
+	if c.spill != nil {
+		if !c.spill.isSpilling() {
+			select {
+			case c.entries <- e:
+				return
+			default:
+				log.Infof("%s Entries channel full, spilling the entries from %d to disk", c.ID, e.Number)
+			}
+		}
+
+		err := c.spill.push(e)
+		if err == nil || errors.Is(err, ErrClientStopped) {
+			return
+		}
+		log.Errorf("%s Error spilling entry %d to disk, waiting for the consumer: %v", c.ID, e.Number, err)
+		if !c.spill.waitDrained() {
+			return
+		}
+	}
+
+	select {
+	case c.entries <- e:
+	case <-c.done:
+	}
+}
+
+// drainSpill delivers the entries spilled to the disk queue to the entries channel, in order
+func (c *StreamClient) drainSpill() {
+	done := c.done
+	c.spawn(func() {
+		<-done
+		c.spill.close()
+	})
+
+	for {
+		e, err := c.spill.pop()
+		if errors.Is(err, ErrClientStopped) {
+			return
+		}
+		if err != nil {
+			log.Errorf("%s Error reading the entries spilled to disk: %v", c.ID, err)
+			c.stats.addError(StatErrRead, err)
+			if c.policy.onFatal != nil {
+				c.policy.onFatal(err)
+			}
+			select {
+			case c.fatal <- err:
+			default:
+			}
+			return
+		}
+
+		select {
+		case c.entries <- e:
+		case <-c.done:
+			return
+		}
+		if c.spill.delivered() {
+			log.Infof("%s Entries spilled to disk drained up to %d", c.ID, e.Number)
+		}
+	}
+}
+
+// isSpilling returns if there are entries spilled pending to deliver
+func (q *spillQueue) isSpilling() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.pending > 0
+}
+
+// len returns the number of entries spilled pending to deliver
+func (q *spillQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.pending
+}
+
+// push writes an entry at the end of the queue file, waiting while the queue is full
+func (q *spillQueue) push(e FileEntry) error {
+	data := encodeFileEntryToBinary(e)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && q.pending > 0 && q.writeOff+uint64(len(data)) > q.maxBytes {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return ErrClientStopped
+	}
+
+	if q.file == nil {
+		file, err := os.CreateTemp(q.dir, "dsclient-spill-*.bin")
+		if err != nil {
+			return err
+		}
+		q.file = file
+	}
+	_, err := q.file.WriteAt(data, int64(q.writeOff))
+	if err != nil {
+		return err
+	}
+	q.writeOff += uint64(len(data))
+	q.pending++
+	q.cond.Broadcast()
+	return nil
+}
+
+// pop reads the oldest entry of the queue file, waiting while there are no entries to read
+func (q *spillQueue) pop() (FileEntry, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && q.readOff >= q.writeOff {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return FileEntry{}, ErrClientStopped
+	}
+
+	header := make([]byte, FixedSizeFileEntry)
+	_, err := q.file.ReadAt(header, int64(q.readOff))
+	if err != nil {
+		return FileEntry{}, err
+	}
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length < FixedSizeFileEntry || q.readOff+uint64(length) > q.writeOff {
+		return FileEntry{}, ErrReadingDataEntry
+	}
+	data := make([]byte, length)
+	_, err = q.file.ReadAt(data, int64(q.readOff))
+	if err != nil {
+		return FileEntry{}, err
+	}
+	e, err := DecodeBinaryToFileEntry(data)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	q.readOff += uint64(length)
+	return e, nil
+}
+
+// delivered records an entry popped is delivered to the entries channel, reclaiming the file space once the queue is
+// empty. Returns if the queue is empty
+func (q *spillQueue) delivered() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.pending--
+	if q.pending > 0 || q.closed {
+		return false
+	}
+
+	q.readOff, q.writeOff = 0, 0
+	err := q.file.Truncate(0)
+	if err != nil {
+		log.Warnf("Error truncating the spill file %s: %v", q.file.Name(), err)
+	}
+	q.cond.Broadcast()
+	return true
+}
+
+// waitDrained waits until the entries spilled are delivered, returns false if the client is stopped meanwhile
+func (q *spillQueue) waitDrained() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for !q.closed && q.pending > 0 {
+		q.cond.Wait()
+	}
+	return !q.closed
+}
+
+// close closes and removes the queue file, waking up the goroutines waiting
+func (q *spillQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	if q.file != nil {
+		q.file.Close()
+		os.Remove(q.file.Name())
+	}
+	q.cond.Broadcast()
+}
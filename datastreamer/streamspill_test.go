@@ -0,0 +1,72 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSpillover(t *testing.T) {
+	const entries = 500
+	server, port := newTestServer(t, "spill.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, entries)
+
+	// Entries channel smaller than the entries, whatever the memory available
+	datastreamer.SetBufferSizes(datastreamer.BufferSizes{ClientEntries: 16})
+	defer datastreamer.SetBufferSizes(datastreamer.BufferSizes{})
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	spillDir := t.TempDir()
+	client.SetSpillover(spillDir, 1<<20)
+	var mutex sync.Mutex
+	received := []uint64{}
+	release := make(chan struct{})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		<-release
+		mutex.Lock()
+		received = append(received, e.Number)
+		mutex.Unlock()
+		return nil
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+
+	// Case: Consumer blocked, the entries after the channel full spilled to disk -> OK
+	require.Eventually(t, func() bool {
+		return client.GetStats().Spilled == entries-16-1
+	}, 2*time.Second, 10*time.Millisecond)
+	files, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// Case: Consumer released, entries drained and processed in order -> OK
+	close(release)
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == entries
+	}, 2*time.Second, 10*time.Millisecond)
+	for i, number := range received {
+		require.Equal(t, uint64(i), number)
+	}
+	require.Zero(t, client.GetStats().Spilled)
+
+	// Case: Client stopped -> Spill file removed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, client.Run(ctx), context.Canceled)
+	require.Eventually(t, func() bool {
+		files, err := os.ReadDir(spillDir)
+		return err == nil && len(files) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
@@ -0,0 +1,199 @@
+package datastreamer
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const splitCommitEntries = 10000 // Entries written to an output stream of a split between header commits
+
+// SplitOutput type for an output stream of the split of a stream by entry type
+type SplitOutput struct {
+	FileName   string      // Stream file of the output, new or empty (with its bookmarks DB <file>.db)
+	EntryTypes []EntryType // Entry types of the source stream written to the output
+}
+
+// SplitResult type for the entries written to an output stream of a split
+type SplitResult struct {
+	FileName  string `json:"fileName"`  // Stream file of the output
+	Entries   uint64 `json:"entries"`   // Data entries written (bookmarks not included)
+	Bookmarks uint64 `json:"bookmarks"` // Bookmarks generated
+}
+
+// splitWriter type to write an output stream of a split or a merge
+type splitWriter struct {
+	output   SplitOutput
+	file     *StreamFile
+	bookmark *StreamBookmark
+	result   SplitResult
+	all      bool // Flag all the entry types are written (merge)
+}
+
+// SplitStream splits a stream file (not opened by a server) into an output stream file for each group of entry
+// types, to migrate from a monolithic stream to a stream by entry type. The data entries are written in order to the
+// outputs of their entry type (skipped if none), renumbered from 0, and every bookmark of the source is generated in
+// every output at its position, so the bookmarks start the streaming of every output at the same point of the
+// source. The payloads of a source stored content-addressed (<file>.cas) are resolved. The outputs keep the version
+// and the system ID of the source
+func SplitStream(fileName string, streamType StreamType, outputs []SplitOutput) ([]SplitResult, error) {
+	source, content, err := openSourceStream(fileName, streamType)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSourceStream(source, content)
+
+	// Open the output streams
+	header := source.getHeaderEntry()
+	writers := make([]*splitWriter, 0, len(outputs))
+	defer func() {
+		for _, w := range writers {
+			_ = w.close()
+		}
+	}()
+	for _, output := range outputs {
+		w, err := newSplitWriter(output, header, streamType)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+
+	// Write the entries of the source to the outputs
+	if header.TotalEntries > header.BaseEntry {
+		iterator, err := source.iteratorFrom(header.BaseEntry, true)
+		if err != nil {
+			return nil, err
+		}
+		defer source.iteratorEnd(iterator)
+		for {
+			end, err := source.iteratorNext(iterator)
+			if err != nil {
+				return nil, err
+			}
+			if end {
+				break
+			}
+			err = content.resolve(&iterator.Entry)
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range writers {
+				err = w.write(iterator.Entry)
+				if err != nil {
+					log.Errorf("Error writing entry %d to split stream %s: %v", iterator.Entry.Number,
+						w.output.FileName, err)
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Commit the outputs
+	results := make([]SplitResult, 0, len(writers))
+	for _, w := range writers {
+		err = w.file.writeHeaderEntry()
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Split stream %s: %d entries, %d bookmarks", w.result.FileName, w.result.Entries, w.result.Bookmarks)
+		results = append(results, w.result)
+	}
+	return results, nil
+}
+
+// openSourceStream opens a source stream file of a split or a merge (not opened by a server), and its content DB
+// (<file>.cas) if the payloads are stored content-addressed (nil if not)
+func openSourceStream(fileName string, streamType StreamType) (*StreamFile, *StreamContent, error) {
+	_, err := os.Stat(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	source, err := NewStreamFile(fileName, 0, 0, streamType)
+	if err != nil {
+		return nil, nil, err
+	}
+	contentName := fileName[0:strings.LastIndex(fileName, ".")] + ".cas"
+	if _, err := os.Stat(contentName); err != nil {
+		return source, nil, nil
+	}
+	content, err := NewContent(contentName)
+	if err != nil {
+		_ = source.close()
+		return nil, nil, err
+	}
+	return source, content, nil
+}
+
+// closeSourceStream closes a source stream file of a split or a merge, and its content DB
+func closeSourceStream(source *StreamFile, content *StreamContent) {
+	_ = source.close()
+	if content != nil {
+		_ = content.db.Close()
+	}
+}
+
+// newSplitWriter opens or creates an output stream of a split or a merge, it must be empty
+func newSplitWriter(output SplitOutput, header HeaderEntry, streamType StreamType) (*splitWriter, error) {
+	file, err := NewStreamFile(output.FileName, header.Version, header.SystemID, streamType)
+	if err != nil {
+		return nil, err
+	}
+	if file.getHeaderEntry().TotalEntries > 0 {
+		log.Errorf("Split stream %s is not empty", output.FileName)
+		_ = file.close()
+		return nil, ErrSplitOutputNotEmpty
+	}
+	bookmark, err := NewBookmark(output.FileName[0:strings.LastIndex(output.FileName, ".")] + ".db")
+	if err != nil {
+		_ = file.close()
+		return nil, err
+	}
+	return &splitWriter{
+		output:   output,
+		file:     file,
+		bookmark: bookmark,
+		result:   SplitResult{FileName: output.FileName},
+	}, nil
+}
+
+// write writes an entry of the source to the output stream if it's a bookmark or of its entry types
+func (w *splitWriter) write(e FileEntry) error {
+	if !w.all && e.Type != EtBookmark && !slices.Contains(w.output.EntryTypes, e.Type) {
+		return nil
+	}
+
+	e.Number = w.result.Entries + w.result.Bookmarks
+	err := w.file.AddFileEntry(e)
+	if err != nil {
+		return err
+	}
+	if e.Type == EtBookmark {
+		err = w.bookmark.AddBookmark(e.Data, e.Number)
+		if err != nil {
+			return err
+		}
+		w.result.Bookmarks++
+	} else {
+		w.result.Entries++
+	}
+
+	// Commit the entries written periodically
+	if (w.result.Entries+w.result.Bookmarks)%splitCommitEntries == 0 {
+		return w.file.writeHeaderEntry()
+	}
+	return nil
+}
+
+// close closes the output stream file and its bookmarks DB
+func (w *splitWriter) close() error {
+	return errors.Join(w.file.close(), w.bookmark.db.Close())
+}
+
+// close closes the stream file
+func (f *StreamFile) close() error {
+	return errors.Join(f.file.Close(), f.fileHeader.Close(), f.closeDirectIO())
+}
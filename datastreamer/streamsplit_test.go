@@ -0,0 +1,64 @@
+package datastreamer_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStream(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow integration test, skipped in short mode")
+	}
+	port := freePort(t)
+	dir := t.TempDir()
+	server := openTestServer(t, port, dir+"/monolith.bin")
+	require.NoError(t, server.SetContentAddressing(true))
+	require.NoError(t, server.Start())
+	payload := func(i byte) []byte { return bytes.Repeat([]byte{i}, 64) }
+	require.NoError(t, server.StartAtomicOp())
+	for i := byte(0); i < 2; i++ {
+		_, err := server.AddStreamBookmark([]byte{1, i})
+		require.NoError(t, err)
+		_, err = server.AddStreamEntry(entryType1, payload(i))
+		require.NoError(t, err)
+		_, err = server.AddStreamEntry(entryType2, payload(i+10))
+		require.NoError(t, err)
+	}
+	_, err := server.AddStreamEntry(datastreamer.EntryType(3), payload(20))
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+	require.NoError(t, server.Shutdown(0))
+	require.NoError(t, server.Close())
+
+	// Case: Split by entry type -> Entries renumbered and bookmarks generated in every output
+	outputs := []datastreamer.SplitOutput{
+		{FileName: dir + "/type1.bin", EntryTypes: []datastreamer.EntryType{entryType1}},
+		{FileName: dir + "/type2.bin", EntryTypes: []datastreamer.EntryType{entryType2}},
+	}
+	results, err := datastreamer.SplitStream(dir+"/monolith.bin", streamType, outputs)
+	require.NoError(t, err)
+	require.Equal(t, []datastreamer.SplitResult{
+		{FileName: dir + "/type1.bin", Entries: 2, Bookmarks: 2},
+		{FileName: dir + "/type2.bin", Entries: 2, Bookmarks: 2},
+	}, results)
+
+	for i, entryType := range []datastreamer.EntryType{entryType1, entryType2} {
+		split := openTestServer(t, port, outputs[i].FileName)
+		require.Equal(t, uint64(4), split.GetHeader().TotalEntries)
+		entry, err := split.GetEntry(3)
+		require.NoError(t, err)
+		require.Equal(t, entryType, entry.Type)
+		require.Equal(t, payload(byte(10*i+1)), entry.Data)
+		entry, err = split.GetFirstEventAfterBookmark([]byte{1, 1})
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), entry.Number)
+		require.NoError(t, split.Close())
+	}
+
+	// Case: Output not empty -> ERROR
+	_, err = datastreamer.SplitStream(dir+"/monolith.bin", streamType, outputs[:1])
+	require.ErrorIs(t, err, datastreamer.ErrSplitOutputNotEmpty)
+}
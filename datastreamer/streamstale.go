@@ -0,0 +1,92 @@
+package datastreamer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	staleRetries    = 5                      // Maximum attempts to reopen the stream file on a stale file handle
+	staleRetryDelay = 500 * time.Millisecond // Initial delay to reopen the stream file, doubled on each attempt
+)
+
+// SetStaleIORetry sets the server to also reopen the stream file and repeat the operation on an I/O error (EIO), as on
+// a stale file handle (ESTALE), for the network storages (NFS) reporting their failovers with EIO. Disabled by
+// default, an EIO of a local disk is a media error that must fail the operation (call before Start)
+func (s *StreamServer) SetStaleIORetry(enabled bool) {
+	s.streamFile.retryEIO = enabled
+}
+
+// SetStaleIORetry sets the relay server side to reopen the stream file also on an I/O error (call before Start)
+func (r *StreamRelay) SetStaleIORetry(enabled bool) {
+	r.server.SetStaleIORetry(enabled)
+}
+
+// isStaleHandle checks if an error of the stream file is a stale file handle (ESTALE), or an I/O error (EIO) if
+// enabled, e.g. from a network storage (NFS) failover, recoverable by reopening the file
+func (f *StreamFile) isStaleHandle(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || (f.retryEIO && errors.Is(err, syscall.EIO))
+}
+
+// retryStale runs an operation on the stream file, reopening the file and running it again on a stale file handle.
+// The operation must set its own file positions
+func (f *StreamFile) retryStale(name string, op func() error) error {
+	delay := staleRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !f.isStaleHandle(err) || attempt > staleRetries {
+			return err
+		}
+
+		log.Warnf("Stale stream file %s on %s: %v. Reopening it in %v (attempt %d/%d)", f.fileName, name, err, delay,
+			attempt, staleRetries)
+		time.Sleep(delay)
+		delay *= 2
+		err = f.reopen()
+		if err != nil {
+			log.Errorf("Error reopening stream file %s: %v", f.fileName, err)
+		}
+	}
+}
+
+// reopen reopens the file descriptors of the stream file, keeping the position to write
+func (f *StreamFile) reopen() error {
+	pos, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		pos = int64(f.header.TotalLength) - int64(len(f.writeBuffer))
+	}
+
+	file, err := os.OpenFile(f.fileName, os.O_RDWR, fileMode)
+	if err != nil {
+		return err
+	}
+	fileHeader, err := os.OpenFile(f.fileName, os.O_RDWR, fileMode)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	_, err = file.Seek(pos, io.SeekStart)
+	if err != nil {
+		file.Close()
+		fileHeader.Close()
+		return err
+	}
+	_ = f.file.Close()
+	_ = f.fileHeader.Close()
+	f.file, f.fileHeader = file, fileHeader
+
+	// Reopen the direct I/O writer, the blocks it buffers are read again from the file
+	if f.direct != nil {
+		_ = f.closeDirectIO()
+		f.setDirectIO(true)
+	}
+
+	log.Infof("Stream file %s reopened", f.fileName)
+	return nil
+}
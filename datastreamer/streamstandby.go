@@ -0,0 +1,166 @@
+package datastreamer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	leaseRenewDivisor = 3                      // The lease is renewed (or tried to acquire) every third of its ttl
+	minLeaseTTL       = 300 * time.Millisecond // Minimum ttl of the lease
+)
+
+// relayStandby type for the active/standby state of a relay of a pair coordinated by a lease
+type relayStandby struct {
+	lease  Lease         // Lease of the pair (nil if the relay is not part of a pair)
+	holder string        // Holder name of the relay in the lease
+	ttl    time.Duration // Duration of the lease once acquired or renewed
+
+	mutex   sync.Mutex
+	active  bool          // Flag the relay holds the lease and serves the clients
+	renewed time.Time     // Latest time the lease was acquired or renewed
+	done    chan struct{} // Closed to stop renewing the lease on shutdown
+	stopped chan struct{} // Closed once the lease is no longer renewed
+}
+
+// SetStandby sets the relay as a member of an active/standby pair coordinated by the lease, with its holder name
+// (unique in the pair) and the ttl of the lease. The relay follows the master server as usual, but keeps its port
+// closed until it acquires the lease (promoted to active). The lease is renewed every third of the ttl, the relay is
+// demoted to standby if it's lost (its clients asked to reconnect, e.g. to the promoted relay behind a load balancer)
+// and released on shutdown. The ttl is at least 300ms (call before Start)
+func (r *StreamRelay) SetStandby(lease Lease, holder string, ttl time.Duration) {
+	r.standby.lease = lease
+	r.standby.holder = holder
+	r.standby.ttl = max(ttl, minLeaseTTL)
+	r.server.holdListen = lease != nil
+}
+
+// IsActive checks if the relay serves its clients: not part of a pair, or holding the lease of the pair
+func (r *StreamRelay) IsActive() bool {
+	if r.standby.lease == nil {
+		return true
+	}
+
+	r.standby.mutex.Lock()
+	defer r.standby.mutex.Unlock()
+
+	return r.standby.active
+}
+
+// startStandby checks the lease once and starts the goroutine renewing it (if the relay is part of a pair)
+func (r *StreamRelay) startStandby() {
+	if r.standby.lease == nil {
+		return
+	}
+
+	log.Infof("Relay %s of an active/standby pair, lease ttl %v", r.standby.holder, r.standby.ttl)
+	r.standby.done = make(chan struct{})
+	r.standby.stopped = make(chan struct{})
+	r.checkLease()
+	go func() {
+		ticker := time.NewTicker(r.standby.ttl / leaseRenewDivisor)
+		defer ticker.Stop()
+		defer close(r.standby.stopped)
+
+		for {
+			select {
+			case <-r.standby.done:
+				return
+			case <-ticker.C:
+				r.checkLease()
+			}
+		}
+	}()
+}
+
+// stopStandby stops renewing the lease and releases it, so the standby relay is promoted without waiting for its expiry
+func (r *StreamRelay) stopStandby() {
+	if r.standby.done == nil {
+		return
+	}
+
+	close(r.standby.done)
+	<-r.standby.stopped
+	r.standby.mutex.Lock()
+	r.standby.active = false
+	r.standby.mutex.Unlock()
+
+	err := r.standby.lease.Release(r.standby.holder)
+	if err != nil {
+		log.Errorf("Error releasing relay lease: %v", err)
+	}
+}
+
+// checkLease acquires or renews the lease, promoting the relay once acquired and demoting it once lost. On errors
+// renewing it, the active relay keeps serving until the lease would expire
+func (r *StreamRelay) checkLease() {
+	now := time.Now()
+	held, err := r.standby.lease.Acquire(r.standby.holder, r.standby.ttl)
+	if err != nil {
+		log.Warnf("Error acquiring relay lease: %v", err)
+	}
+
+	r.standby.mutex.Lock()
+	active := r.standby.active
+	renewed := r.standby.renewed
+	if held {
+		r.standby.renewed = now
+	}
+	r.standby.mutex.Unlock()
+
+	switch {
+	case held && !active:
+		r.promote()
+	case !held && active && (err == nil || time.Since(renewed) > r.standby.ttl-r.standby.ttl/leaseRenewDivisor):
+		r.demote()
+	}
+}
+
+// promote opens the relay port to the clients, releasing the lease if it can't be opened
+func (r *StreamRelay) promote() {
+	err := r.server.listen()
+	if err != nil {
+		log.Errorf("Error opening the port of the promoted relay: %v", err)
+		err = r.standby.lease.Release(r.standby.holder)
+		if err != nil {
+			log.Errorf("Error releasing relay lease: %v", err)
+		}
+		return
+	}
+
+	r.standby.mutex.Lock()
+	r.standby.active = true
+	r.standby.mutex.Unlock()
+	r.server.writeReadinessFile()
+	log.Infof("Relay %s promoted to active, TotalEntries %d", r.standby.holder, r.server.GetHeader().TotalEntries)
+}
+
+// demote closes the relay port and asks the clients connected to reconnect
+func (r *StreamRelay) demote() {
+	r.standby.mutex.Lock()
+	r.standby.active = false
+	r.standby.mutex.Unlock()
+
+	log.Warnf("Relay %s lost the lease, demoted to standby", r.standby.holder)
+	r.server.removeReadinessFile()
+	r.server.closeListener()
+
+	r.server.mutexClients.RLock()
+	clients := make([]*client, 0, len(r.server.clients))
+	for _, cli := range r.server.clients {
+		clients = append(clients, cli)
+	}
+	r.server.mutexClients.RUnlock()
+
+	for _, cli := range clients {
+		if cli.conn != nil {
+			_, err := TimeoutWrite(cli, []byte{PtReconnect}, r.server.writeTimeout)
+			if err != nil {
+				log.Debugf("Error sending reconnect to %s: %v", cli.clientID, err)
+			}
+		}
+		r.server.killClient(cli.clientID)
+	}
+}
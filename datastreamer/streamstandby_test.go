@@ -0,0 +1,103 @@
+package datastreamer
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLease(t *testing.T) {
+	lease := NewFileLease(filepath.Join(t.TempDir(), "lease.json"))
+	const ttl = 200 * time.Millisecond
+
+	// Case: Free lease -> Acquired, renewed by its holder
+	held, err := lease.Acquire("a", ttl)
+	require.NoError(t, err)
+	require.True(t, held)
+	held, err = lease.Acquire("a", ttl)
+	require.NoError(t, err)
+	require.True(t, held)
+	holder, err := lease.Holder()
+	require.NoError(t, err)
+	require.Equal(t, "a", holder)
+
+	// Case: Lease held by another holder -> Not acquired, not released
+	held, err = lease.Acquire("b", ttl)
+	require.NoError(t, err)
+	require.False(t, held)
+	require.NoError(t, lease.Release("b"))
+	holder, err = lease.Holder()
+	require.NoError(t, err)
+	require.Equal(t, "a", holder)
+
+	// Case: Lease expired -> Acquired by another holder
+	time.Sleep(ttl)
+	held, err = lease.Acquire("b", ttl)
+	require.NoError(t, err)
+	require.True(t, held)
+
+	// Case: Lease released -> Acquired by another holder
+	require.NoError(t, lease.Release("b"))
+	held, err = lease.Acquire("a", ttl)
+	require.NoError(t, err)
+	require.True(t, held)
+}
+
+func TestRelayStandby(t *testing.T) {
+	const ttl = 600 * time.Millisecond
+	port := freePort(t)
+	server, err := NewEphemeralServer(port, 1, 137, StreamType(1), 3*time.Second, 120*time.Second, 5*time.Second, nil)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer func() { _ = server.Shutdown(0) }()
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamEntry(1, []byte{0x01, 0x02})
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+
+	leaseFile := filepath.Join(t.TempDir(), "lease.json")
+	newRelay := func(relayPort uint16, holder string) *StreamRelay {
+		relay, err := NewEphemeralRelay(fmt.Sprintf("127.0.0.1:%d", port), relayPort, 1, 137, StreamType(1), 3*time.Second,
+			120*time.Second, 5*time.Second, nil)
+		require.NoError(t, err)
+		relay.SetStandby(NewFileLease(leaseFile), holder, ttl)
+		require.NoError(t, relay.Start())
+		return relay
+	}
+	serving := func(relayPort uint16) bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", relayPort))
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	// Case: First relay of the pair -> Active, second one standby with its port closed
+	portA, portB := freePort(t), freePort(t)
+	relayA := newRelay(portA, "a")
+	relayB := newRelay(portB, "b")
+	defer func() { _ = relayB.Shutdown(0) }()
+	require.True(t, relayA.IsActive())
+	require.True(t, serving(portA))
+	require.False(t, relayB.IsActive())
+	require.False(t, serving(portB))
+
+	// Case: Standby relay -> Follows the master server
+	require.Eventually(t, func() bool { return relayB.server.GetHeader().TotalEntries == 1 }, 5*time.Second,
+		10*time.Millisecond)
+
+	// Case: Active relay shut down -> Lease released, standby promoted
+	require.NoError(t, relayA.Shutdown(0))
+	require.Eventually(t, relayB.IsActive, 2*ttl, 10*time.Millisecond)
+	require.True(t, serving(portB))
+
+	// Case: Lease taken by another holder -> Demoted, port closed
+	require.NoError(t, writeJSONFile(leaseFile, leaseState{Holder: "c", Expires: time.Now().Add(time.Hour)}))
+	require.Eventually(t, func() bool { return !relayB.IsActive() }, 2*ttl, 10*time.Millisecond)
+	require.False(t, serving(portB))
+}
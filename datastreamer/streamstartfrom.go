@@ -0,0 +1,67 @@
+package datastreamer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// StartFromLatestBookmark starts the streaming from the latest bookmark committed with a bookmark prefix (e.g. the
+// bookmark type of the L2 blocks), resolved to its entry number with the LatestStates command, or from the genesis
+// (the first data entry) if the server has no bookmark with the prefix or its latest view doesn't include it.
+// Returns the entry number the streaming started from
+func (c *StreamClient) StartFromLatestBookmark(prefix []byte) (uint64, error) {
+	return c.StartFromLatestBookmarkContext(context.Background(), prefix)
+}
+
+// StartFromLatestBookmarkContext starts the streaming from the latest bookmark committed with a bookmark prefix, or
+// from the genesis if not found, canceled with the context
+func (c *StreamClient) StartFromLatestBookmarkContext(ctx context.Context, prefix []byte) (uint64, error) {
+	states, err := c.ExecCommandGetLatestStatesContext(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	for _, state := range states {
+		if bytes.Equal(state.Prefix, prefix) {
+			log.Infof("%s Starting the streaming from the latest bookmark [%s] at entry %d", c.ID,
+				FormatBookmark(state.Bookmark), state.Entry)
+			return state.Entry, c.ExecCommandStartContext(ctx, state.Entry)
+		}
+	}
+
+	log.Infof("%s No latest bookmark with prefix [%s], starting the streaming from the genesis", c.ID,
+		FormatBookmark(prefix))
+	return c.startFromGenesis(ctx)
+}
+
+// StartFromBookmarkOrGenesis starts the streaming from a bookmark, or from the genesis (the first data entry) if the
+// server doesn't have the bookmark. Returns if the bookmark was found
+func (c *StreamClient) StartFromBookmarkOrGenesis(bookmark []byte) (bool, error) {
+	return c.StartFromBookmarkOrGenesisContext(context.Background(), bookmark)
+}
+
+// StartFromBookmarkOrGenesisContext starts the streaming from a bookmark, or from the genesis if not found, canceled
+// with the context
+func (c *StreamClient) StartFromBookmarkOrGenesisContext(ctx context.Context, bookmark []byte) (bool, error) {
+	_, err := c.ExecCommandGetBookmarkContext(ctx, bookmark)
+	if errors.Is(err, ErrBookmarkNotFound) {
+		log.Infof("%s Bookmark [%s] not found, starting the streaming from the genesis", c.ID, FormatBookmark(bookmark))
+		_, err = c.startFromGenesis(ctx)
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, c.ExecCommandStartBookmarkContext(ctx, bookmark)
+}
+
+// startFromGenesis starts the streaming from the first data entry of the server (its base entry)
+func (c *StreamClient) startFromGenesis(ctx context.Context) (uint64, error) {
+	header, err := c.ExecCommandGetHeaderContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return header.BaseEntry, c.ExecCommandStartContext(ctx, header.BaseEntry)
+}
@@ -0,0 +1,66 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStartFromBookmark(t *testing.T) {
+	server, port := newTestServer(t, "startfrom.bin")
+	require.NoError(t, server.SetLatestView([][]byte{{1}}))
+	require.NoError(t, server.Start())
+	require.NoError(t, server.StartAtomicOp())
+	for i := byte(0); i < 2; i++ {
+		_, err := server.AddStreamBookmark([]byte{1, i})
+		require.NoError(t, err)
+		_, err = server.AddStreamEntry(entryType1, testEntries[1].Encode())
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.CommitAtomicOp())
+
+	start := func(f func(c *datastreamer.StreamClient) error) uint64 {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		defer func() { _ = client.Close() }()
+		first := make(chan uint64, 10)
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+			_ *datastreamer.StreamServer) error {
+			first <- e.Number
+			return nil
+		})
+		require.NoError(t, client.Start())
+		require.NoError(t, f(client))
+		return <-first
+	}
+
+	// Case: Latest bookmark of a prefix -> Streaming from its entry number
+	require.Equal(t, uint64(2), start(func(c *datastreamer.StreamClient) error {
+		entryNum, err := c.StartFromLatestBookmark([]byte{1})
+		require.Equal(t, uint64(2), entryNum)
+		return err
+	}))
+
+	// Case: No latest bookmark of a prefix -> Streaming from the genesis
+	require.Equal(t, uint64(0), start(func(c *datastreamer.StreamClient) error {
+		entryNum, err := c.StartFromLatestBookmark([]byte{2})
+		require.Equal(t, uint64(0), entryNum)
+		return err
+	}))
+
+	// Case: Bookmark found -> Streaming from the bookmark
+	require.Equal(t, uint64(2), start(func(c *datastreamer.StreamClient) error {
+		found, err := c.StartFromBookmarkOrGenesis([]byte{1, 1})
+		require.True(t, found)
+		return err
+	}))
+
+	// Case: Bookmark not found -> Streaming from the genesis
+	require.Equal(t, uint64(0), start(func(c *datastreamer.StreamClient) error {
+		found, err := c.StartFromBookmarkOrGenesis([]byte{1, 9})
+		require.False(t, found)
+		return err
+	}))
+}
@@ -0,0 +1,564 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	zkevm "github.com/0xPolygonHermez/zkevm-data-streamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	maxReconnectEvents = 50               // Maximum number of reconnection events kept in the client statistics
+	statsRateWindow    = 10 * time.Second // Window of the throughput of the entries received
+)
+
+// Client statistics error kinds
+const (
+	StatErrConnect = "connect" // StatErrConnect for errors connecting to the server
+	StatErrRead    = "read"    // StatErrRead for errors reading from the server connection
+	StatErrCommand = "command" // StatErrCommand for commands failed or rejected by the server
+	StatErrProcess = "process" // StatErrProcess for errors of the process entry function
+	StatErrAuth    = "auth"    // StatErrAuth for connections rejected by the server authentication
+
+	StatErrHeartbeat = "heartbeat" // StatErrHeartbeat for connections closed by the heartbeat, not answering a ping
+
+	StatErrDeadLetter = "deadletter" // StatErrDeadLetter for entries quarantined to the dead-letter sink
+	StatErrVerify     = "verify"     // StatErrVerify for errors of the verifier verifying a segment
+	StatErrDivergence = "divergence" // StatErrDivergence for segments diverging from the verifier source
+)
+
+// Client statistics reasons of the data entries received not delivered to the process entry functions
+const (
+	StatDropMiddleware   = "middleware"   // StatDropMiddleware for entries dropped by a receive middleware (e.g. filter)
+	StatDropEntryType    = "entrytype"    // StatDropEntryType for entries of the entry types not set to process
+	StatDropStop         = "stop"         // StatDropStop for entries discarded on stop, or pending once stopped
+	StatDropSkipped      = "skipped"      // StatDropSkipped for entries failed skipped by the process error policy
+	StatDropDeadLetter   = "deadletter"   // StatDropDeadLetter for entries failed quarantined to the dead-letter sink
+	StatDropError        = "error"        // StatDropError for entries stopping the streaming or a subscription on error
+	StatDropSubscription = "subscription" // StatDropSubscription for entries of a subscription unknown or ended
+)
+
+// ClientStats type for the state of a client dumped to the statistics file
+type ClientStats struct {
+	ID            string            `json:"id"`
+	Server        string            `json:"server"`
+	Version       string            `json:"version"`
+	Time          time.Time         `json:"time"`
+	StartTime     time.Time         `json:"startTime"`
+	Connected     bool              `json:"connected"`
+	Streaming     bool              `json:"streaming"`
+	Subscriptions int               `json:"subscriptions"`
+	LastEntry     uint64            `json:"lastEntry"`     // Latest entry number received from streaming
+	LastEntryTime time.Time         `json:"lastEntryTime"` // Time the latest entry was received
+	TotalEntries  uint64            `json:"totalEntries"`  // Total entries from latest header command
+	Lag           uint64            `json:"lag"`           // Entries pending to receive up to the total entries
+	Queued        int               `json:"queued"`        // Entries received pending in the entries channel
+	QueueCapacity int               `json:"queueCapacity"` // Capacity of the entries channel (sized from the memory)
+	Prefetched    int               `json:"prefetched"`    // Entries prefetched ready to process
+	Spilled       int               `json:"spilled"`       // Entries spilled to disk pending to queue
+	Verified      uint64            `json:"verified"`      // Segments between bookmarks verified by the verifier
+	Reconnects    []ReconnectEvent  `json:"reconnects"`    // Latest reconnections
+	Errors        map[string]uint64 `json:"errors"`        // Error counts by kind
+	LastError     string            `json:"lastError,omitempty"`
+
+	ReconnectCount      uint64  `json:"reconnectCount"`      // Reconnections since start
+	EntriesReceived     uint64  `json:"entriesReceived"`     // Data entries received (streaming and subscriptions)
+	BytesReceived       uint64  `json:"bytesReceived"`       // Bytes of the data entries received
+	EntriesPerSec       float64 `json:"entriesPerSec"`       // Throughput of the entries received (latest 10s)
+	Processed           uint64  `json:"processed"`           // Entries processed by the process entry functions
+	ProcessLatencyMs    float64 `json:"processLatencyMs"`    // Average latency of the process entry functions
+	MaxProcessLatencyMs float64 `json:"maxProcessLatencyMs"` // Maximum latency of the process entry functions
+	ThrottledMs         float64 `json:"throttledMs"`         // Time the reads were paused by the rate limit
+
+	CompressedEntries uint64 `json:"compressedEntries"` // Data entries received compressed (included in the received)
+	CompressedBytes   uint64 `json:"compressedBytes"`   // Bytes of the data entries received compressed, as sent
+	BackfilledEntries uint64 `json:"backfilledEntries"` // Data entries received by the backfill (included in the received)
+
+	Delivered   uint64            `json:"delivered"`   // Entries processed without error by the process entry functions
+	Dropped     map[string]uint64 `json:"dropped"`     // Entries received not delivered by reason
+	Reprocessed uint64            `json:"reprocessed"` // Process retries of the entries failed (restart, dead-letter)
+}
+
+// ReconnectEvent type for a reconnection of the client to the server
+type ReconnectEvent struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"` // Latest error before the reconnection
+}
+
+// clientStats type to collect the client statistics
+type clientStats struct {
+	fileName string
+	interval time.Duration
+
+	mutex         sync.Mutex
+	startTime     time.Time
+	isConnected   bool
+	isStreaming   bool
+	connections   uint64
+	lastEntry     uint64
+	lastEntryTime time.Time
+	verified      uint64
+	reconnects    []ReconnectEvent
+	errors        map[string]uint64
+	lastError     string
+	connErr       error // Latest error since the connection was established
+
+	entriesReceived uint64
+	bytesReceived   uint64
+	rateStart       time.Time     // Start of the current window of the throughput
+	rateEntries     uint64        // Entries received in the current window of the throughput
+	rate            float64       // Throughput of the latest window completed
+	processed       uint64        // Entries processed by the process entry functions
+	processTime     time.Duration // Processing time of the entries processed
+	processMax      time.Duration // Maximum processing time of an entry
+	throttled       time.Duration // Time the reads were paused by the rate limit
+
+	compressedEntries uint64
+	compressedBytes   uint64
+	backfilledEntries uint64
+
+	delivered   uint64
+	dropped     map[string]uint64
+	reprocessed uint64
+}
+
+// ServerStats type for the state of a server returned by the Stats command
+type ServerStats struct {
+	Version      string             `json:"version"`
+	Time         time.Time          `json:"time"`
+	StreamType   StreamType         `json:"streamType"`
+	SystemID     uint64             `json:"systemID"`
+	TotalEntries uint64             `json:"totalEntries"`
+	TotalLength  uint64             `json:"totalLength"`
+	BaseEntry    uint64             `json:"baseEntry,omitempty"` // Number of the first entry (genesis offset)
+	AtomicOp     bool               `json:"atomicOp"`            // Flag an atomic operation is in progress
+	Clients      []ServerClientInfo `json:"clients"`
+	Logs         []log.Entry        `json:"logs,omitempty"`   // Recent log entries (if the log ring buffer is set)
+	Series       []StatsSample      `json:"series,omitempty"` // Statistics time series (if set, see SetStatsSeries)
+	AcceptErrors uint64             `json:"acceptErrors"`     // Errors accepting the connections, retried
+	Resources    ResourceStats      `json:"resources"`        // Resources usage of the process
+	Groups       []GroupInfo        `json:"groups,omitempty"` // Consumer groups with members (if enabled)
+
+	BookmarkDB *BookmarkDBStats `json:"bookmarkDB,omitempty"` // Size and compaction metrics of the bookmarks DB
+}
+
+// ServerClientInfo type for the state of a client connected to the server
+type ServerClientInfo struct {
+	ID            string    `json:"id"`
+	Status        string    `json:"status"`
+	LastActivity  time.Time `json:"lastActivity"`
+	Subscriptions int       `json:"subscriptions"`
+	MuxStream     bool      `json:"muxStream"`
+}
+
+// SetStatsFile sets the file to periodically dump the client statistics in JSON format (call before Start)
+func (c *StreamClient) SetStatsFile(fileName string, interval time.Duration) {
+	c.stats.fileName = fileName
+	c.stats.interval = interval
+}
+
+// GetStats returns the current client statistics
+func (c *StreamClient) GetStats() ClientStats {
+	c.mutexSubs.RLock()
+	subs := len(c.subs)
+	c.mutexSubs.RUnlock()
+
+	c.mutexCmd.Lock()
+	totalEntries := c.totalEntries
+	c.mutexCmd.Unlock()
+
+	c.stats.mutex.Lock()
+	defer c.stats.mutex.Unlock()
+
+	stats := ClientStats{
+		ID:            c.ID,
+		Server:        c.serverAddr(),
+		Version:       zkevm.Version,
+		Time:          time.Now(),
+		StartTime:     c.stats.startTime,
+		Connected:     c.stats.isConnected,
+		Streaming:     c.stats.isStreaming,
+		Subscriptions: subs,
+		LastEntry:     c.stats.lastEntry,
+		LastEntryTime: c.stats.lastEntryTime,
+		Verified:      c.stats.verified,
+		TotalEntries:  totalEntries,
+		Queued:        len(c.entries),
+		QueueCapacity: cap(c.entries),
+		Reconnects:    append([]ReconnectEvent{}, c.stats.reconnects...),
+		Errors:        make(map[string]uint64, len(c.stats.errors)),
+		LastError:     c.stats.lastError,
+
+		ReconnectCount:      c.stats.reconnectCount(),
+		EntriesReceived:     c.stats.entriesReceived,
+		BytesReceived:       c.stats.bytesReceived,
+		EntriesPerSec:       c.stats.updateRate(time.Now()),
+		Processed:           c.stats.processed,
+		MaxProcessLatencyMs: float64(c.stats.processMax) / float64(time.Millisecond),
+		ThrottledMs:         float64(c.stats.throttled) / float64(time.Millisecond),
+
+		CompressedEntries: c.stats.compressedEntries,
+		CompressedBytes:   c.stats.compressedBytes,
+		BackfilledEntries: c.stats.backfilledEntries,
+
+		Delivered:   c.stats.delivered,
+		Dropped:     make(map[string]uint64, len(c.stats.dropped)),
+		Reprocessed: c.stats.reprocessed,
+	}
+	if !c.stats.lastEntryTime.IsZero() && totalEntries > c.stats.lastEntry+1 {
+		stats.Lag = totalEntries - c.stats.lastEntry - 1
+	}
+	if c.stats.processed > 0 {
+		stats.ProcessLatencyMs = float64(c.stats.processTime) / float64(c.stats.processed) / float64(time.Millisecond)
+	}
+	if c.prefetch != nil {
+		stats.Prefetched = c.prefetch.len()
+	}
+	if c.spill != nil {
+		stats.Spilled = c.spill.len()
+	}
+	for kind, count := range c.stats.errors {
+		stats.Errors[kind] = count
+	}
+	for reason, count := range c.stats.dropped {
+		stats.Dropped[reason] = count
+	}
+	return stats
+}
+
+// dumpStats writes periodically the client statistics to the statistics file
+func (c *StreamClient) dumpStats() {
+	for {
+		// Refresh the total entries to compute the lag
+		if c.stats.connectedNow() {
+			_, _ = c.ExecCommandGetHeader()
+		}
+
+		err := writeJSONFile(c.stats.fileName, c.GetStats())
+		if err != nil {
+			log.Errorf("%s Error writing stats file %s: %v", c.ID, c.stats.fileName, err)
+		}
+		if !c.wait(c.stats.interval) {
+			return
+		}
+	}
+}
+
+// writeJSONFile writes a value in JSON format to a file, replacing it atomically
+func writeJSONFile(fileName string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Close()
+	} else {
+		tmpFile.Close()
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), fileName)
+}
+
+// start sets the start time of the statistics
+func (s *clientStats) start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.startTime = time.Now()
+	s.rateStart = s.startTime
+	s.errors = make(map[string]uint64)
+	s.dropped = make(map[string]uint64)
+}
+
+// connected records a connection to the server, a reconnection if it's not the first one
+func (s *clientStats) connected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.isConnected = true
+	s.connErr = nil
+	s.connections++
+	if s.connections == 1 {
+		return
+	}
+	s.reconnects = append(s.reconnects, ReconnectEvent{Time: time.Now(), Reason: s.lastError})
+	if len(s.reconnects) > maxReconnectEvents {
+		s.reconnects = s.reconnects[1:]
+	}
+}
+
+// disconnected records the connection to the server is closed
+func (s *clientStats) disconnected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.isConnected = false
+}
+
+// connectedNow returns if the client is connected to the server
+func (s *clientStats) connectedNow() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.isConnected
+}
+
+// setStreaming records if the client streaming is started
+func (s *clientStats) setStreaming(streaming bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.isStreaming = streaming
+}
+
+// addError records an error of a kind
+func (s *clientStats) addError(kind string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.errors == nil {
+		s.errors = make(map[string]uint64)
+	}
+	s.errors[kind]++
+	if err != nil {
+		s.lastError = kind + ": " + err.Error()
+	}
+	if err != nil && (kind == StatErrRead || kind == StatErrHeartbeat || kind == StatErrAuth) {
+		s.connErr = err
+	}
+}
+
+// connectionError returns the latest error of the connection (reading, heartbeat or authentication) since it was
+// established
+func (s *clientStats) connectionError() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.connErr
+}
+
+// entryReceived records the latest entry received from streaming
+func (s *clientStats) entryReceived(entryNum uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastEntry = entryNum
+	s.lastEntryTime = time.Now()
+}
+
+// dataReceived records a data entry received from the server, streaming or subscription
+func (s *clientStats) dataReceived(length uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entriesReceived++
+	s.bytesReceived += uint64(length)
+	s.updateRate(time.Now())
+	s.rateEntries++
+}
+
+// compressedReceived records a data entry received compressed from the server, with its length as sent
+func (s *clientStats) compressedReceived(length uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.compressedEntries++
+	s.compressedBytes += uint64(length)
+}
+
+// backfillReceived records a data entry received by the backfill
+func (s *clientStats) backfillReceived() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.backfilledEntries++
+}
+
+// updateRate completes the window of the throughput once elapsed and returns the throughput of the latest window
+// completed (decreasing to 0 for a stalled stream)
+func (s *clientStats) updateRate(now time.Time) float64 {
+	elapsed := now.Sub(s.rateStart)
+	if elapsed < statsRateWindow {
+		return s.rate
+	}
+	s.rate = float64(s.rateEntries) / elapsed.Seconds()
+	s.rateStart = now
+	s.rateEntries = 0
+	return s.rate
+}
+
+// entryProcessed records the processing time of an entry by a process entry function
+func (s *clientStats) entryProcessed(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.processed++
+	s.processTime += latency
+	s.processMax = max(s.processMax, latency)
+}
+
+// entryDelivered records an entry processed without error by a process entry function
+func (s *clientStats) entryDelivered() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.delivered++
+}
+
+// entryDropped records an entry received not delivered to the process entry functions
+func (s *clientStats) entryDropped(reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.dropped == nil {
+		s.dropped = make(map[string]uint64)
+	}
+	s.dropped[reason]++
+}
+
+// entryReprocessed records a retry of the processing of an entry failed
+func (s *clientStats) entryReprocessed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reprocessed++
+}
+
+// throttledFor records a pause of the reads by the rate limit
+func (s *clientStats) throttledFor(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.throttled += delay
+}
+
+// reconnectCount returns the number of reconnections since start
+func (s *clientStats) reconnectCount() uint64 {
+	if s.connections == 0 {
+		return 0
+	}
+	return s.connections - 1
+}
+
+// segmentVerified records a segment verified by the verifier
+func (s *clientStats) segmentVerified() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.verified++
+}
+
+// GetStats returns the current server statistics
+func (s *StreamServer) GetStats() ServerStats {
+	header := s.streamFile.getHeaderEntry()
+	stats := ServerStats{
+		Version:      zkevm.Version,
+		Time:         time.Now(),
+		StreamType:   s.streamType,
+		SystemID:     header.SystemID,
+		TotalEntries: header.TotalEntries,
+		TotalLength:  header.TotalLength,
+		BaseEntry:    header.BaseEntry,
+		AtomicOp:     s.atomicOp.status == aoStarted,
+		Logs:         log.RecentEntries(),
+		Series:       s.series.series(),
+		AcceptErrors: s.acceptErrors.Load(),
+		Resources:    s.GetResourceStats(),
+	}
+	if s.groups != nil {
+		stats.Groups = s.groups.info()
+	}
+	if dbStats, err := s.GetBookmarkDBStats(); err == nil {
+		stats.BookmarkDB = &dbStats
+	}
+
+	s.mutexClients.RLock()
+	defer s.mutexClients.RUnlock()
+
+	stats.Clients = make([]ServerClientInfo, 0, len(s.clients))
+	for _, cli := range s.clients {
+		cli.mutexSubs.RLock()
+		subs := len(cli.subs)
+		cli.mutexSubs.RUnlock()
+
+		cli.mutexInfo.Lock()
+		status := cli.status
+		if cli.live != nil && cli.live.isLagging() {
+			status = csSyncing
+		}
+		stats.Clients = append(stats.Clients, ServerClientInfo{
+			ID:            cli.clientID,
+			Status:        StrClientStatus[status],
+			LastActivity:  cli.lastActivity,
+			Subscriptions: subs,
+			MuxStream:     cli.muxStream,
+		})
+		cli.mutexInfo.Unlock()
+	}
+	return stats
+}
+
+// processCmdStats processes the TCP Stats command from the clients
+func (s *StreamServer) processCmdStats(client *client) error {
+	// Log
+	log.Debugf("Client %s command Stats", client.clientID)
+
+	data, err := json.Marshal(s.GetStats())
+	if err != nil {
+		log.Errorf("Error encoding stats for %s: %v", client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the stats as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteTagged(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending stats to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
+
+// ExecCommandGetStats executes client TCP command to get the server statistics
+func (c *StreamClient) ExecCommandGetStats() (ServerStats, error) {
+	return c.ExecCommandGetStatsContext(context.Background())
+}
+
+// ExecCommandGetStatsContext executes client TCP command to get the server statistics, canceled with the context
+func (c *StreamClient) ExecCommandGetStatsContext(ctx context.Context) (ServerStats, error) {
+	stats := ServerStats{}
+	_, entry, err := c.execCommand(ctx, CmdStats, false, 0, nil)
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(entry.Data, &stats)
+	return stats, err
+}
@@ -0,0 +1,138 @@
+package datastreamer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const ptStopBarrier = 0xfa // Packet type of the barrier queued after the entries received on stop (not on the wire)
+
+// StopDrainMode type of the handling on stop of the streaming entries received not yet processed
+type StopDrainMode int
+
+const (
+	// StopNoDrain returns once the server confirms the stop, the entries received are processed afterwards (default)
+	StopNoDrain StopDrainMode = iota
+	// StopDrain returns once the entries received are processed through the callback function
+	StopDrain
+	// StopDiscard returns once the entries received are discarded without processing them
+	StopDiscard
+)
+
+// StopAck type for the acknowledgement of a streaming stop
+type StopAck struct {
+	NextEntry uint64 // Next entry number to receive, the entries before it are processed or discarded once drained
+	Drained   uint64 // Entries processed after the server confirmed the stop
+	Discarded uint64 // Entries discarded after the server confirmed the stop
+}
+
+// stopDrain type for the drain of the streaming entries received on stop, through a barrier queued after them
+type stopDrain struct {
+	mode      StopDrainMode
+	mutex     sync.Mutex    // Mutex to drain the stops one by one
+	queued    atomic.Uint64 // Latest barrier queued
+	passed    atomic.Uint64 // Latest barrier reached by the consumer
+	discard   atomic.Uint64 // Barrier up to which the entries are discarded
+	drained   atomic.Uint64 // Entries processed while the latest barrier is pending
+	discarded atomic.Uint64 // Entries discarded while the latest barrier is pending
+	signal    chan struct{} // Signaled once a barrier is reached
+}
+
+// SetStopDrain sets the handling of the streaming entries received not yet processed on stop: ExecCommandStop waits
+// until the server confirms the stop and then, with StopDrain, until the entries received (in the entries channel,
+// the disk queue and the prefetch queue) are processed through the callback function, or with StopDiscard until they
+// are discarded. So the position reached is well-defined once it returns, e.g. to checkpoint it (see
+// ExecCommandStopAck). The default StopNoDrain returns once the server confirms (call before Start)
+func (c *StreamClient) SetStopDrain(mode StopDrainMode) {
+	c.stopDrain.mode = mode
+	if c.stopDrain.signal == nil {
+		c.stopDrain.signal = make(chan struct{}, 1)
+	}
+}
+
+// ExecCommandStopAck executes client TCP command to stop streaming, canceled with the context, draining the entries
+// received with the mode set by SetStopDrain. Returns the acknowledgement of the stop
+func (c *StreamClient) ExecCommandStopAck(ctx context.Context) (StopAck, error) {
+	// A backfill stopped before the live streaming started has nothing to stop on the server
+	if !c.stopBackfill() || c.streaming.Load() {
+		_, _, err := c.execCommand(ctx, CmdStop, false, 0, nil)
+		if err != nil {
+			return StopAck{}, err
+		}
+	}
+	if c.stopDrain.mode == StopNoDrain {
+		return StopAck{NextEntry: c.nextEntry.Load()}, nil
+	}
+	return c.drainStop(ctx)
+}
+
+// drainStop queues a barrier after the entries received and waits until the consumer reaches it
+func (c *StreamClient) drainStop(ctx context.Context) (StopAck, error) {
+	d := &c.stopDrain
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.drained.Store(0)
+	d.discarded.Store(0)
+	barrier := d.queued.Load() + 1
+	if d.mode == StopDiscard {
+		d.discard.Store(barrier)
+	}
+	d.queued.Store(barrier)
+	c.queueEntry(FileEntry{packetType: ptStopBarrier, Length: FixedSizeFileEntry, Number: barrier})
+
+	for d.passed.Load() < barrier {
+		select {
+		case <-d.signal:
+		case <-ctx.Done():
+			return StopAck{}, ctx.Err()
+		case <-c.done:
+			return StopAck{}, ErrClientStopped
+		}
+	}
+
+	ack := StopAck{
+		NextEntry: c.nextEntry.Load(),
+		Drained:   d.drained.Load(),
+		Discarded: d.discarded.Load(),
+	}
+	log.Infof("%s Streaming stopped at entry %d: %d entries drained, %d discarded", c.ID, ack.NextEntry, ack.Drained,
+		ack.Discarded)
+	return ack, nil
+}
+
+// passStopBarrier checks a streaming entry consumed against the pending stop barrier. Returns if the entry must be
+// skipped: it's a barrier (then reached), or it's discarded
+func (c *StreamClient) passStopBarrier(e *FileEntry) bool {
+	d := &c.stopDrain
+	if e.packetType == ptStopBarrier {
+		// The barrier is reached once the entries before it are processed by the workers
+		c.workers.drain(c)
+		d.passed.Store(e.Number)
+		select {
+		case d.signal <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
+	passed := d.passed.Load()
+	if d.queued.Load() <= passed {
+		return false
+	}
+	if d.discard.Load() > passed {
+		d.discarded.Add(1)
+		c.stats.entryDropped(StatDropStop)
+		return true
+	}
+	d.drained.Add(1)
+	return false
+}
+
+// resetStopBarrier flags the barriers queued as reached, once the entries are discarded
+func (c *StreamClient) resetStopBarrier() {
+	c.stopDrain.passed.Store(c.stopDrain.queued.Load())
+}
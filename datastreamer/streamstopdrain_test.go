@@ -0,0 +1,76 @@
+package datastreamer_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStopDrain(t *testing.T) {
+	const entries = 20
+	server, port := newTestServer(t, "stopdrain.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, entries)
+
+	stopBlocked := func(mode datastreamer.StopDrainMode) (datastreamer.StopAck, uint64) {
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		client.SetStopDrain(mode)
+		release := make(chan struct{})
+		var processed atomic.Uint64
+		client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+			s *datastreamer.StreamServer) error {
+			<-release
+			processed.Add(1)
+			return nil
+		})
+		require.NoError(t, client.Start())
+		defer func() { _ = client.Close() }()
+		require.NoError(t, client.ExecCommandStart(0))
+		require.Eventually(t, func() bool {
+			return client.GetStats().Queued == entries-1
+		}, 2*time.Second, 10*time.Millisecond)
+
+		var ack datastreamer.StopAck
+		result := make(chan error, 1)
+		go func() {
+			var err error
+			ack, err = client.ExecCommandStopAck(context.Background())
+			result <- err
+		}()
+		select {
+		case <-result:
+			t.Fatal("stop returned before draining the entries")
+		case <-time.After(100 * time.Millisecond):
+		}
+		close(release)
+		select {
+		case err = <-result:
+			require.NoError(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for the stop")
+		}
+		return ack, processed.Load()
+	}
+
+	// Case: Stop draining -> Entries received processed before returning
+	ack, processed := stopBlocked(datastreamer.StopDrain)
+	require.Equal(t, uint64(entries), ack.NextEntry)
+	require.Equal(t, uint64(entries), processed)
+	require.Equal(t, uint64(entries-1), ack.Drained)
+	require.Zero(t, ack.Discarded)
+
+	// Case: Stop discarding -> Entries received discarded before returning
+	ack, processed = stopBlocked(datastreamer.StopDiscard)
+	require.Equal(t, uint64(entries), ack.NextEntry)
+	require.Equal(t, uint64(1), processed)
+	require.Equal(t, uint64(entries-1), ack.Discarded)
+	require.Zero(t, ack.Drained)
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
@@ -0,0 +1,411 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// Subscription type to manage a tagged streaming subscription over the shared client connection
+type Subscription struct {
+	ID           uint64 // Subscription ID (tag of the frames)
+	client       *StreamClient
+	fromBookmark []byte // Start bookmark (only for subscriptions started from bookmark)
+	shardParam   []byte // Shard parameter (only for sharded subscriptions)
+	watchPrefix  []byte // Bookmarks prefix (only for bookmarks watches)
+	group        []byte // Consumer group name (only for consumer group subscriptions)
+	fromStream   uint64 // Start entry number of the subscription
+	nextEntry    uint64 // Next entry number to receive from streaming
+	received     bool   // Flag entries received
+	started      bool   // Flag subscription started by the server (guarded by client mutexSubs)
+	stopping     bool   // Flag subscription stop in progress (guarded by client mutexSubs)
+
+	entries      chan FileEntry   // Channel to read data entries from the streaming
+	processEntry ProcessEntryFunc // Callback function to process the entry
+
+	waiter         chan ResultEntry // Channel of the command waiting for a result (if any)
+	mutexWaiter    sync.Mutex       // Mutex for access to the waiter channel
+	pendingCommits atomic.Int32     // Commits sent waiting for their result
+
+	done     chan struct{} // Channel closed when the subscription ends
+	err      error         // Reason of the subscription end (nil if unsubscribed)
+	doneOnce sync.Once
+}
+
+// Subscribe starts a new streaming subscription from entry over the client connection
+func (c *StreamClient) Subscribe(fromEntry uint64, f ProcessEntryFunc) (*Subscription, error) {
+	return c.subscribe(CmdStart, fromEntry, nil, f)
+}
+
+// SubscribeBookmark starts a new streaming subscription from bookmark over the client connection
+func (c *StreamClient) SubscribeBookmark(fromBookmark []byte, f ProcessEntryFunc) (*Subscription, error) {
+	return c.subscribe(CmdStartBookmark, 0, fromBookmark, f)
+}
+
+// subscribe executes a tagged start command and launches the consumer of the new subscription
+func (c *StreamClient) subscribe(cmd Command, fromEntry uint64, fromBookmark []byte,
+	f ProcessEntryFunc) (*Subscription, error) {
+	// Check status of the client
+	if !c.started {
+		log.Errorf("Subscribe not allowed. Client is not started")
+		return nil, ErrExecCommandNotAllowed
+	}
+
+	// Detect the server protocol version on the command channel, the legacy protocol can't recover from a tagged command
+	if c.protocol.Load() == 0 {
+		_, _, err := c.getCommandConn(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := c.checkProtocol(cmd, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if f == nil {
+		f = PrintReceivedEntry
+	}
+
+	// Create the subscription
+	c.mutexSubs.Lock()
+	c.nextTag++
+	sub := &Subscription{
+		ID:           c.nextTag,
+		client:       c,
+		fromBookmark: fromBookmark,
+		fromStream:   fromEntry,
+		nextEntry:    fromEntry,
+		entries:      make(chan FileEntry, c.entriesBuffer),
+		processEntry: f,
+		done:         make(chan struct{}),
+	}
+	if cmd == CmdStartShard {
+		sub.fromBookmark, sub.shardParam = nil, fromBookmark
+	} else if cmd == CmdWatchBookmarks {
+		sub.fromBookmark, sub.watchPrefix = nil, append([]byte{}, fromBookmark...)
+	} else if cmd == CmdStartGroup {
+		sub.fromBookmark, sub.group = nil, fromBookmark
+	}
+	c.subs[sub.ID] = sub
+	c.mutexSubs.Unlock()
+
+	log.Debugf("%s Executing command %d[%s] for subscription %d...", c.ID, cmd, StrCommand[cmd], sub.ID)
+
+	// Send the tagged start command and wait for the result
+	result := sub.expectResult()
+	err = c.sendCommand(cmd, sub.ID, fromEntry, fromBookmark)
+	if err == nil {
+		var r ResultEntry
+		r, err = sub.waitResult(result)
+		if err == nil && r.errorNum == uint32(CmdErrMaxSubscriptions) {
+			err = ErrMaxSubscriptions
+		} else if err == nil && r.errorNum == uint32(CmdErrBadShard) {
+			err = ErrInvalidShard
+		} else if err == nil && r.errorNum == uint32(CmdErrBadGroup) {
+			err = ErrInvalidConsumerGroup
+		} else if err == nil && r.errorNum == uint32(CmdErrInvalidCommand) {
+			err = errNotSupported(cmd, c.protocol.Load())
+		} else if err == nil && r.errorNum != uint32(CmdErrOK) {
+			err = ErrResultCommandError
+		}
+	}
+	if err != nil {
+		c.removeSubscription(sub.ID)
+		sub.end(err)
+		return nil, err
+	}
+
+	// Goroutine to consume subscription streaming entries
+	go sub.getStreaming()
+
+	return sub, nil
+}
+
+// Unsubscribe stops the streaming of the subscription. It must not be called from its callback function
+func (s *Subscription) Unsubscribe() error {
+	c := s.client
+	log.Debugf("%s Executing command %d[%s] for subscription %d...", c.ID, CmdStop, StrCommand[CmdStop], s.ID)
+
+	// Only one stop for the subscription, and it's not restored on reconnection from now on
+	c.mutexSubs.Lock()
+	if c.subs[s.ID] != s || s.stopping {
+		c.mutexSubs.Unlock()
+		return ErrSubscriptionNotFound
+	}
+	s.stopping = true
+	c.mutexSubs.Unlock()
+
+	// Send the tagged stop command and wait for the result
+	var r ResultEntry
+	result := s.expectResult()
+	err := c.sendCommand(CmdStop, s.ID, 0, nil)
+	if err == nil {
+		r, err = s.waitResult(result)
+	}
+
+	// Server doesn't send more entries for the subscription after the result
+	c.removeSubscription(s.ID)
+	s.end(nil)
+
+	if err != nil {
+		return err
+	}
+	if r.errorNum != uint32(CmdErrOK) {
+		return ErrResultCommandError
+	}
+	return nil
+}
+
+// Done returns a channel that is closed when the subscription ends
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason of the subscription end: nil if still active or unsubscribed, otherwise the callback
+// function error or the server rejection after a reconnection
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// GetFromStream returns streaming start entry number of the subscription
+func (s *Subscription) GetFromStream() uint64 {
+	return s.fromStream
+}
+
+// expectResult registers the channel to receive the result of the next tagged command
+func (s *Subscription) expectResult() chan ResultEntry {
+	ch := make(chan ResultEntry, 1)
+	s.mutexWaiter.Lock()
+	s.waiter = ch
+	s.mutexWaiter.Unlock()
+	return ch
+}
+
+// waitResult waits for the result of the tagged command until the timeout
+func (s *Subscription) waitResult(result chan ResultEntry) (ResultEntry, error) {
+	select {
+	case r := <-result:
+		return r, nil
+	case <-time.After(defaultTimeout):
+		s.mutexWaiter.Lock()
+		if s.waiter == result {
+			s.waiter = nil
+		}
+		s.mutexWaiter.Unlock()
+
+		log.Errorf("%s Timeout waiting for result of subscription %d", s.client.ID, s.ID)
+		return ResultEntry{}, ErrResultTimeout
+	}
+}
+
+// putResult delivers a tagged result to the waiting command, if any
+func (s *Subscription) putResult(r ResultEntry) {
+	c := s.client
+
+	// Results of the commits are received in order before the result of a later command
+	if s.putCommitResult(r) {
+		return
+	}
+
+	// Started subscriptions are restored on reconnection
+	c.mutexSubs.Lock()
+	if r.errorNum == uint32(CmdErrOK) && !s.stopping {
+		s.started = true
+	}
+	c.mutexSubs.Unlock()
+
+	s.mutexWaiter.Lock()
+	ch := s.waiter
+	s.waiter = nil
+	s.mutexWaiter.Unlock()
+
+	if ch != nil {
+		ch <- r
+		return
+	}
+
+	// Result of a command restored after reconnection
+	if r.errorNum != uint32(CmdErrOK) {
+		log.Errorf("%s Result %d[%s] received for subscription %d. Subscription removed",
+			c.ID, r.errorNum, r.errorStr, s.ID)
+		c.removeSubscription(s.ID)
+		s.end(ErrResultCommandError)
+	}
+}
+
+// putEntry delivers a streaming entry to the subscription consumer, never blocks once the subscription ended
+func (s *Subscription) putEntry(e FileEntry) {
+	s.nextEntry = e.Number + 1
+	s.received = true
+	select {
+	case s.entries <- e:
+	case <-s.done:
+		s.client.stats.entryDropped(StatDropSubscription)
+	}
+}
+
+// getStreaming consumes streaming data entries of the subscription
+func (s *Subscription) getStreaming() {
+	for {
+		select {
+		case e := <-s.entries:
+			// Pass the data entry through the receive middlewares
+			passed, err := s.client.receiveChain.apply(&e)
+			if err == nil && passed {
+				err = s.client.verifyEntry(&e)
+			}
+
+			// Process the data entry verified of the entry types set
+			switch {
+			case err != nil:
+				s.client.stats.entryDropped(StatDropError)
+			case !passed:
+				s.client.stats.entryDropped(StatDropMiddleware)
+			case !s.client.entryTypes.contains(&e):
+				s.client.stats.entryDropped(StatDropEntryType)
+			default:
+				err = s.client.processWithPolicy(&e, s.processEntry, nil)
+			}
+			if err != nil {
+				log.Errorf("%s Processing entry %d of subscription %d: %s. Exiting getStream function",
+					s.client.ID, e.Number, s.ID, err.Error())
+				s.stop(err)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// stop ends the subscription and sends the tagged stop command without waiting for its result
+func (s *Subscription) stop(reason error) {
+	c := s.client
+
+	c.mutexSubs.Lock()
+	stopping := s.stopping
+	s.stopping = true
+	c.mutexSubs.Unlock()
+
+	s.end(reason)
+	if stopping {
+		return
+	}
+
+	c.removeSubscription(s.ID)
+	err := c.sendCommand(CmdStop, s.ID, 0, nil)
+	if err != nil {
+		log.Errorf("%s Error stopping subscription %d: %v", c.ID, s.ID, err)
+	}
+}
+
+// end closes the done channel of the subscription with the reason of the end
+func (s *Subscription) end(reason error) {
+	s.doneOnce.Do(func() {
+		s.err = reason
+		close(s.done)
+	})
+}
+
+// getSubscription returns the subscription for a tag
+func (c *StreamClient) getSubscription(tag uint64) *Subscription {
+	c.mutexSubs.RLock()
+	defer c.mutexSubs.RUnlock()
+	return c.subs[tag]
+}
+
+// removeSubscription removes the subscription for a tag
+func (c *StreamClient) removeSubscription(tag uint64) {
+	c.mutexSubs.Lock()
+	defer c.mutexSubs.Unlock()
+	delete(c.subs, tag)
+}
+
+// restoreSubscriptions sends the tagged start commands to restore the started subscriptions after a reconnection
+func (c *StreamClient) restoreSubscriptions() error {
+	c.mutexSubs.RLock()
+	defer c.mutexSubs.RUnlock()
+
+	for _, sub := range c.subs {
+		if !sub.started || sub.stopping {
+			continue
+		}
+
+		var err error
+		sub.pendingCommits.Store(0)
+		if sub.group != nil {
+			err = c.sendCommand(CmdStartGroup, sub.ID, sub.nextEntry, sub.group)
+		} else if sub.shardParam != nil {
+			err = c.sendCommand(CmdStartShard, sub.ID, sub.nextEntry, sub.shardParam)
+		} else if sub.watchPrefix != nil {
+			err = c.sendCommand(CmdWatchBookmarks, sub.ID, sub.nextEntry, sub.watchPrefix)
+		} else if sub.fromBookmark != nil && !sub.received {
+			err = c.sendCommand(CmdStartBookmark, sub.ID, 0, sub.fromBookmark)
+		} else {
+			err = c.sendCommand(CmdStart, sub.ID, sub.nextEntry, nil)
+		}
+		if err != nil {
+			log.Errorf("%s Error restoring subscription %d: %v", c.ID, sub.ID, err)
+			return err
+		}
+		log.Infof("%s Restored subscription %d from entry %d", c.ID, sub.ID, sub.nextEntry)
+	}
+	return nil
+}
+
+// readTaggedFrame reads a tagged frame from server connection and routes it to its subscription
+func (c *StreamClient) readTaggedFrame() error {
+	// Read the tag and the inner packet type
+	buffer := make([]byte, FixedSizeTaggedFrame)
+	err := c.readContent(c.conn, buffer)
+	if err != nil {
+		return err
+	}
+	tag := binary.BigEndian.Uint64(buffer[0:8])
+	sub := c.getSubscription(tag)
+
+	switch buffer[8] {
+	case PtResult:
+		r, err := c.readResultEntry(c.conn)
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			log.Debugf("%s Result received for unknown subscription %d", c.ID, tag)
+			return nil
+		}
+		sub.putResult(r)
+
+	case PtData, PtCompressed:
+		e, err := c.readStreamedEntry(c.conn, buffer[8])
+		if err != nil {
+			return err
+		}
+		if c.dropFrame(&e) {
+			return nil
+		}
+		c.stats.dataReceived(e.Length)
+		if sub == nil {
+			log.Debugf("%s Entry %d received for unknown subscription %d", c.ID, e.Number, tag)
+			c.stats.entryDropped(StatDropSubscription)
+			return nil
+		}
+		sub.putEntry(e)
+
+	default:
+		log.Errorf("%s Unknown tagged packet type %d for subscription %d", c.ID, buffer[8], tag)
+		return ErrInvalidTaggedFrame
+	}
+
+	return nil
+}
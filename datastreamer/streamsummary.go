@@ -0,0 +1,347 @@
+package datastreamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	summaryKeyConfig     = 'c'  // Key of the entry types derived in the summary index DB
+	summaryKeyNext       = 'n'  // Key of the next entry number of the primary stream to derive
+	summaryKeyPrefix     = 'e'  // Prefix of the keys of the primary entry number of each summary entry
+	summaryCommitEntries = 1000 // Maximum number of entries derived by an atomic operation on the catch-up
+)
+
+// summaryStream type of a secondary stream derived from the primary one, with only the entries of the selected types
+type summaryStream struct {
+	server *StreamServer
+	types  map[EntryType]struct{}
+	config []byte // Entry types derived, encoded
+	db     *leveldb.DB
+	next   uint64 // Next entry number of the primary stream to derive
+	count  uint64 // Number of summary entries indexed
+}
+
+// SetSummaryStream sets the server to maintain a summary stream derived from the primary one, with only the entries
+// of the selected types (e.g. the block starts and the bookmarks, EtBookmark) copied as the primary grows, so the
+// lightweight clients follow it at a fraction of the bandwidth. The summary stream has its own stream file
+// (<file>.summary.bin), bookmarks and entry numbers, with the primary entry number of each entry indexed
+// (<file>.summary.idx) to follow the truncations of the primary. It's served by the returned server, on its own port,
+// started and shut down with this server (don't add entries to it). The entries committed before are derived on
+// Start, also when the entry types change. No entry types disables it (call before Start)
+func (s *StreamServer) SetSummaryStream(port uint16, entryTypes []EntryType) (*StreamServer, error) {
+	if s.summary != nil {
+		err := s.summary.close()
+		s.summary = nil
+		if err != nil || len(entryTypes) == 0 {
+			return nil, err
+		}
+	}
+	if len(entryTypes) == 0 {
+		return nil, nil
+	}
+
+	name := s.fileName[0:strings.LastIndex(s.fileName, ".")] + ".summary"
+	server, err := NewServer(port, s.version, s.systemID, s.streamType, name+".bin", s.writeTimeout,
+		s.inactivityTimeout, s.inactivityCheckInterval, nil)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := newSummaryStream(server, name+".idx", entryTypes)
+	if err != nil {
+		_ = server.Close()
+		return nil, err
+	}
+	s.summary = summary
+	return server, nil
+}
+
+// SetSummaryStream sets the relay server side to maintain a summary stream on its own port (call before Start)
+func (r *StreamRelay) SetSummaryStream(port uint16, entryTypes []EntryType) (*StreamServer, error) {
+	return r.server.SetSummaryStream(port, entryTypes)
+}
+
+// newSummaryStream opens or creates the summary index database of the summary stream served, the summary stream
+// derived with different entry types is truncated to derive it again
+func newSummaryStream(server *StreamServer, fn string, entryTypes []EntryType) (*summaryStream, error) {
+	log.Infof("Opening/creating summary index DB for datastream: %s", fn)
+	db, err := leveldb.OpenFile(fn, dbOptions())
+	if err != nil {
+		log.Errorf("Error opening/creating summary index DB %s: %v", fn, err)
+		return nil, err
+	}
+	m := summaryStream{
+		server: server,
+		types:  make(map[EntryType]struct{}, len(entryTypes)),
+		db:     db,
+	}
+	types := slices.Clone(entryTypes)
+	slices.Sort(types)
+	for _, entryType := range slices.Compact(types) {
+		m.types[entryType] = struct{}{}
+		m.config = binary.BigEndian.AppendUint32(m.config, uint32(entryType))
+	}
+
+	err = m.load()
+	if err != nil {
+		log.Errorf("Error loading summary index DB %s: %v", fn, err)
+		_ = db.Close()
+		return nil, err
+	}
+	return &m, nil
+}
+
+// load loads the position of the summary stream from the index, the summary entries not indexed (derived but not
+// indexed before a crash) are truncated to derive them again
+func (m *summaryStream) load() error {
+	stored, err := m.db.Get([]byte{summaryKeyConfig}, nil)
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		return err
+	}
+	if !bytes.Equal(stored, m.config) {
+		log.Infof("Deriving the summary stream again with the entry types changed")
+		err = m.truncate(0, 0)
+		if err != nil {
+			return err
+		}
+		return m.db.Put([]byte{summaryKeyConfig}, m.config, nil)
+	}
+
+	next, err := m.db.Get([]byte{summaryKeyNext}, nil)
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		return err
+	}
+	if len(next) == 8 { //nolint:mnd
+		m.next = binary.BigEndian.Uint64(next)
+	}
+	iter := m.db.NewIterator(util.BytesPrefix([]byte{summaryKeyPrefix}), nil)
+	if iter.Last() {
+		m.count = binary.BigEndian.Uint64(iter.Key()[1:]) + 1
+	}
+	iter.Release()
+	err = iter.Error()
+	if err != nil {
+		return err
+	}
+
+	total := m.server.streamFile.getHeaderEntry().TotalEntries
+	switch {
+	case total > m.count:
+		return m.truncate(m.count, m.next)
+	case total < m.count:
+		source, err := m.source(total)
+		if err != nil {
+			return err
+		}
+		return m.truncate(total, source)
+	}
+	return nil
+}
+
+// summaryKey returns the key of the primary entry number of a summary entry in the summary index DB
+func summaryKey(entryNum uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{summaryKeyPrefix}, entryNum)
+}
+
+// source returns the primary entry number of a summary entry
+func (m *summaryStream) source(entryNum uint64) (uint64, error) {
+	value, err := m.db.Get(summaryKey(entryNum), nil)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// derive adds to the summary stream the entries of the selected types, in one atomic operation, and indexes them up
+// to the next entry number of the primary stream
+func (m *summaryStream) derive(entries []FileEntry, next uint64) error {
+	batch := new(leveldb.Batch)
+	started := false
+	for _, entry := range entries {
+		if _, ok := m.types[entry.Type]; !ok {
+			continue
+		}
+		if !started {
+			err := m.server.StartAtomicOp()
+			if err != nil {
+				return err
+			}
+			started = true
+		}
+
+		var entryNum uint64
+		var err error
+		if entry.Type == EtBookmark {
+			entryNum, err = m.server.AddStreamBookmark(entry.Data)
+		} else {
+			entryNum, err = m.server.AddStreamEntry(entry.Type, entry.Data)
+		}
+		if err != nil {
+			_ = m.server.RollbackAtomicOp()
+			return err
+		}
+		batch.Put(summaryKey(entryNum), binary.BigEndian.AppendUint64(nil, entry.Number))
+	}
+	if started {
+		err := m.server.CommitAtomicOp()
+		if err != nil {
+			return err
+		}
+	}
+
+	batch.Put([]byte{summaryKeyNext}, binary.BigEndian.AppendUint64(nil, next))
+	err := m.db.Write(batch, nil)
+	if err != nil {
+		return err
+	}
+	m.count = m.server.nextEntry
+	m.next = next
+	return nil
+}
+
+// truncate truncates the summary stream and its index from a summary entry onwards, to derive again from the next
+// entry number of the primary stream
+func (m *summaryStream) truncate(entryNum uint64, next uint64) error {
+	if entryNum < m.server.nextEntry {
+		err := m.server.TruncateFile(entryNum)
+		if err != nil {
+			return err
+		}
+	}
+
+	batch := new(leveldb.Batch)
+	iter := m.db.NewIterator(&util.Range{Start: summaryKey(entryNum), Limit: []byte{summaryKeyPrefix + 1}}, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	err := iter.Error()
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte{summaryKeyNext}, binary.BigEndian.AppendUint64(nil, next))
+	err = m.db.Write(batch, nil)
+	if err != nil {
+		return err
+	}
+	m.count = min(m.count, entryNum)
+	m.next = next
+	return nil
+}
+
+// close closes the summary index DB and the summary stream
+func (m *summaryStream) close() error {
+	return errors.Join(m.db.Close(), m.server.Close())
+}
+
+// startSummary starts the server of the summary stream (if enabled), and derives the entries committed before
+func (s *StreamServer) startSummary() error {
+	if s.summary == nil {
+		return nil
+	}
+	err := s.summary.server.Start()
+	if err != nil {
+		return err
+	}
+	return s.catchUpSummary()
+}
+
+// updateSummary derives the entries of the committed atomic operation to the summary stream (if enabled). The stream
+// is already updated, so an error is just logged (derived again on the next commit)
+func (s *StreamServer) updateSummary(entries []FileEntry) {
+	if s.summary == nil || !s.summary.server.started {
+		return
+	}
+
+	// The entries of the atomic operation follow the ones derived, otherwise catch up from the file
+	var err error
+	total := s.streamFile.getHeaderEntry().TotalEntries
+	if len(entries) > 0 && entries[0].Number == s.summary.next && entries[len(entries)-1].Number+1 == total {
+		err = s.summary.derive(entries, total)
+	} else {
+		err = s.catchUpSummary()
+	}
+	if err != nil {
+		log.Errorf("Error deriving the summary stream from entry %d: %v", s.summary.next, err)
+	}
+}
+
+// catchUpSummary derives to the summary stream the committed entries not derived yet, reading them from the file
+func (s *StreamServer) catchUpSummary() error {
+	header := s.streamFile.getHeaderEntry()
+	next := max(s.summary.next, header.BaseEntry)
+	if next >= header.TotalEntries {
+		return nil
+	}
+	log.Infof("Deriving the summary stream from entry %d", next)
+
+	iterator, err := s.streamFile.iteratorFrom(next, true)
+	if err != nil {
+		return err
+	}
+	defer s.streamFile.iteratorEnd(iterator)
+
+	entries := make([]FileEntry, 0, summaryCommitEntries)
+	for next < header.TotalEntries {
+		end, err := s.streamFile.iteratorNext(iterator)
+		if err != nil {
+			return err
+		}
+		if end {
+			break
+		}
+
+		// Resolve the payload of an entry stored content-addressed
+		entry := iterator.Entry
+		err = s.content.resolve(&entry)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.summary.types[entry.Type]; ok {
+			entries = append(entries, entry)
+		}
+		next = entry.Number + 1
+
+		if len(entries) == summaryCommitEntries {
+			err = s.summary.derive(entries, next)
+			if err != nil {
+				return err
+			}
+			entries = entries[:0]
+		}
+	}
+	return s.summary.derive(entries, next)
+}
+
+// truncateSummary truncates the summary entries derived from the entries truncated of the primary stream (if
+// enabled). The stream is already truncated, so an error is just logged
+func (s *StreamServer) truncateSummary(entryNum uint64) {
+	if s.summary == nil || entryNum >= s.summary.next {
+		return
+	}
+
+	// Locate the first summary entry derived from the truncated ones, the index is in primary entry number order
+	var err error
+	first := sort.Search(int(s.summary.count), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var source uint64
+		source, err = s.summary.source(uint64(i))
+		return source >= entryNum
+	})
+	if err == nil {
+		err = s.summary.truncate(uint64(first), entryNum)
+	}
+	if err != nil {
+		log.Errorf("Error truncating the summary stream from entry %d: %v", entryNum, err)
+	}
+}
@@ -0,0 +1,79 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummaryStream(t *testing.T) {
+	port, summaryPort := freePort(t), freePort(t)
+	fileName := t.TempDir() + "/summary.bin"
+	newServer := func() (*datastreamer.StreamServer, *datastreamer.StreamServer) {
+		server := openTestServer(t, port, fileName)
+		summary, err := server.SetSummaryStream(summaryPort, []datastreamer.EntryType{datastreamer.EtBookmark,
+			entryType2})
+		require.NoError(t, err)
+		return server, summary
+	}
+	commit := func(server *datastreamer.StreamServer, bookmark []byte, types ...datastreamer.EntryType) {
+		require.NoError(t, server.StartAtomicOp())
+		_, err := server.AddStreamBookmark(bookmark)
+		require.NoError(t, err)
+		for _, entryType := range types {
+			_, err = server.AddStreamEntry(entryType, testEntries[1].Encode())
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+	requireTypes := func(summary *datastreamer.StreamServer, types ...datastreamer.EntryType) {
+		require.Equal(t, uint64(len(types)), summary.GetHeader().TotalEntries)
+		for i, entryType := range types {
+			entry, err := summary.GetEntry(uint64(i))
+			require.NoError(t, err)
+			require.Equal(t, entryType, entry.Type)
+		}
+	}
+
+	// Case: Entries committed before enabling it -> Derived on start
+	server := openTestServer(t, port, fileName)
+	require.NoError(t, server.Start())
+	commit(server, testBookmark.Encode(), entryType1, entryType2, entryType1)
+	require.NoError(t, server.Shutdown(0))
+	require.NoError(t, server.Close())
+
+	server, summary := newServer()
+	require.NoError(t, server.Start())
+	requireTypes(summary, datastreamer.EtBookmark, entryType2)
+
+	// Case: Entries committed -> Only the selected types, bookmarks served by the summary stream
+	commit(server, testBookmark2.Encode(), entryType1, entryType1, entryType2)
+	requireTypes(summary, datastreamer.EtBookmark, entryType2, datastreamer.EtBookmark, entryType2)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", summaryPort), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+	entry, err := client.ExecCommandGetBookmark(testBookmark2.Encode())
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), entry.Number)
+	require.Equal(t, entryType2, entry.Type)
+
+	// Case: Primary stream truncated -> Summary entries derived from the truncated ones removed
+	primaryEntries := server.GetHeader().TotalEntries
+	require.NoError(t, server.TruncateFile(primaryEntries-2))
+	requireTypes(summary, datastreamer.EtBookmark, entryType2, datastreamer.EtBookmark)
+	commit(server, testBookmark.Encode(), entryType2)
+	requireTypes(summary, datastreamer.EtBookmark, entryType2, datastreamer.EtBookmark, datastreamer.EtBookmark,
+		entryType2)
+	require.NoError(t, server.Shutdown(0))
+	require.NoError(t, server.Close())
+
+	// Case: Server restarted -> Summary stream kept, without deriving again the entries
+	server, summary = newServer()
+	require.NoError(t, server.Start())
+	requireTypes(summary, datastreamer.EtBookmark, entryType2, datastreamer.EtBookmark, datastreamer.EtBookmark,
+		entryType2)
+}
@@ -0,0 +1,245 @@
+package datastreamer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// EntryRange type for the range of entries committed within a time window
+type EntryRange struct {
+	FromEntry uint64 `json:"fromEntry"` // First entry number of the range
+	ToEntry   uint64 `json:"toEntry"`   // Entry number after the last one of the range (FromEntry if empty)
+	Commits   uint64 `json:"commits"`   // Number of commits of the time window
+}
+
+// GetEntriesByTime returns the range of entries committed within a wall-clock time window [from, to), located with
+// a binary search over the times of the header changes meta-stream (see SetHeaderChanges), so the entries committed
+// before recording the header changes are not found. The entries truncated after their commit are excluded
+func (s *StreamServer) GetEntriesByTime(from time.Time, to time.Time) (EntryRange, error) {
+	window := EntryRange{}
+	if s.headerChanges == nil {
+		return window, ErrHeaderChangesNotRecorded
+	}
+	totalChanges := s.headerChanges.getHeaderEntry().TotalEntries
+	if !from.Before(to) || totalChanges == 0 {
+		return window, nil
+	}
+
+	// Locate the first change of the time window, the changes are recorded in time order
+	var err error
+	first := sort.Search(int(totalChanges), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var change HeaderChange
+		change, err = s.getHeaderChange(uint64(i))
+		return !change.Time.Before(from)
+	})
+	if err != nil || uint64(first) >= totalChanges {
+		return window, err
+	}
+
+	// Join the entries of the commits up to the end of the time window
+	iterator, err := s.headerChanges.iteratorFrom(uint64(first), true)
+	if err != nil {
+		return window, err
+	}
+	defer s.headerChanges.iteratorEnd(iterator)
+
+	for {
+		end, err := s.headerChanges.iteratorNext(iterator)
+		if err != nil {
+			return EntryRange{}, err
+		}
+		if end {
+			break
+		}
+		change, err := decodeHeaderChange(iterator.Entry)
+		if err != nil {
+			return EntryRange{}, err
+		}
+		if !change.Time.Before(to) {
+			break
+		}
+		if change.Kind != StrHeaderChange[HeaderChangeCommit] || change.TotalEntries <= change.PrevTotalEntries {
+			continue
+		}
+		if window.Commits == 0 {
+			window.FromEntry, window.ToEntry = change.PrevTotalEntries, change.TotalEntries
+		} else {
+			window.FromEntry = min(window.FromEntry, change.PrevTotalEntries)
+			window.ToEntry = max(window.ToEntry, change.TotalEntries)
+		}
+		window.Commits++
+	}
+
+	window.ToEntry = min(window.ToEntry, s.streamFile.getHeaderEntry().TotalEntries)
+	window.FromEntry = min(window.FromEntry, window.ToEntry)
+	return window, nil
+}
+
+// getHeaderChange returns a header change of the meta-stream by its number
+func (s *StreamServer) getHeaderChange(number uint64) (HeaderChange, error) {
+	iterator, err := s.headerChanges.iteratorFrom(number, true)
+	if err != nil {
+		return HeaderChange{}, err
+	}
+	defer s.headerChanges.iteratorEnd(iterator)
+
+	_, err = s.headerChanges.iteratorNext(iterator)
+	if err != nil {
+		return HeaderChange{}, err
+	}
+	return decodeHeaderChange(iterator.Entry)
+}
+
+// encodeTimeParam encodes a time as a command parameter (unix time in ns, 0 for the times before 1970)
+func encodeTimeParam(t time.Time) uint64 {
+	if t.Before(time.Unix(0, 0)) {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// decodeTimeParam decodes a time command parameter (unix time in ns)
+func decodeTimeParam(param uint64) time.Time {
+	return time.Unix(0, int64(min(param, math.MaxInt64)))
+}
+
+// handleEntriesByTimeCommand processes the CmdEntriesByTime command
+func (s *StreamServer) handleEntriesByTimeCommand(cli *client) error {
+	if cli.status != csStopped {
+		log.Error("EntriesByTime command not allowed, stream started!")
+		_ = s.sendResultEntry(uint32(CmdErrAlreadyStarted), StrCommandErrors[CmdErrAlreadyStarted], cli)
+		return ErrEntriesByTimeCommandNotAllowed
+	}
+
+	return s.processCmdEntriesByTime(cli)
+}
+
+// processCmdEntriesByTime processes the TCP EntriesByTime command from the clients
+func (s *StreamServer) processCmdEntriesByTime(client *client) error {
+	// Read from and to time parameters
+	fromTime, err := readFullUint64(client)
+	if err != nil {
+		return err
+	}
+	toTime, err := readFullUint64(client)
+	if err != nil {
+		return err
+	}
+	from, to := decodeTimeParam(fromTime), decodeTimeParam(toTime)
+
+	// Log
+	log.Debugf("Client %s command EntriesByTime from %v to %v", client.clientID, from, to)
+
+	window, err := s.GetEntriesByTime(from, to)
+	if errors.Is(err, ErrHeaderChangesNotRecorded) {
+		return s.sendResultEntry(uint32(CmdErrNoHeaderChanges), StrCommandErrors[CmdErrNoHeaderChanges], client)
+	}
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(window)
+	}
+	if err != nil {
+		log.Errorf("Error getting entries by time for %s: %v", client.clientID, err)
+		_ = s.sendResultEntry(uint32(CmdErrInvalidCommand), StrCommandErrors[CmdErrInvalidCommand], client)
+		return err
+	}
+
+	// Send a command result entry OK
+	err = s.sendResultEntry(0, "OK", client)
+	if err != nil {
+		return err
+	}
+
+	// Send the range of entries as data response
+	entry := FileEntry{
+		packetType: PtDataRsp,
+		Length:     FixedSizeFileEntry + uint32(len(data)),
+		Data:       data,
+	}
+	if client.conn != nil {
+		_, err = timeoutWriteBulk(client, client.cmdTag, encodeFileEntryToBinary(entry), s.writeTimeout)
+	} else {
+		err = ErrNilConnection
+	}
+	if err != nil {
+		log.Errorf("Error sending entries by time to %s: %v", client.clientID, err)
+		return err
+	}
+	return nil
+}
+
+// ExecCommandGetEntriesByTime executes client TCP command to get the range of entries committed by the server within
+// a wall-clock time window [from, to)
+func (c *StreamClient) ExecCommandGetEntriesByTime(from time.Time, to time.Time) (EntryRange, error) {
+	return c.ExecCommandGetEntriesByTimeContext(context.Background(), from, to)
+}
+
+// ExecCommandGetEntriesByTimeContext executes client TCP command to get the range of entries committed by the server
+// within a wall-clock time window [from, to), canceled with the context
+func (c *StreamClient) ExecCommandGetEntriesByTimeContext(ctx context.Context, from time.Time,
+	to time.Time) (EntryRange, error) {
+	window := EntryRange{}
+	toParam := binary.BigEndian.AppendUint64(nil, encodeTimeParam(to))
+	_, entry, err := c.execCommand(ctx, CmdEntriesByTime, false, encodeTimeParam(from), toParam)
+	if err != nil {
+		return window, err
+	}
+	err = json.Unmarshal(entry.Data, &window)
+	return window, err
+}
+
+// StreamEntriesByTime streams the entries committed by the server within a wall-clock time window [from, to) to the
+// process entry function, with a subscription from the first entry of the range ended after the last one. Blocks
+// until the entries are processed, returns the error of the subscription end
+func (c *StreamClient) StreamEntriesByTime(from time.Time, to time.Time, f ProcessEntryFunc) error {
+	window, err := c.ExecCommandGetEntriesByTime(from, to)
+	if err != nil {
+		return err
+	}
+	if window.ToEntry <= window.FromEntry {
+		return nil
+	}
+	if f == nil {
+		f = PrintReceivedEntry
+	}
+
+	// The entries after the range (the last one dropped by a receive middleware) also end the subscription
+	last := make(chan struct{})
+	var lastOnce sync.Once
+	sub, err := c.Subscribe(window.FromEntry, func(e *FileEntry, c *StreamClient, s *StreamServer) error {
+		if e.Number >= window.ToEntry {
+			lastOnce.Do(func() { close(last) })
+			return nil
+		}
+		err := f(e, c, s)
+		if err == nil && e.Number == window.ToEntry-1 {
+			lastOnce.Do(func() { close(last) })
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-last:
+	case <-sub.Done():
+		return sub.Err()
+	}
+	err = sub.Unsubscribe()
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return sub.Err()
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntriesByTime(t *testing.T) {
+	server, port := newTestServer(t, "bytime.bin")
+	require.NoError(t, server.SetHeaderChanges(true))
+	require.NoError(t, server.Start())
+
+	addEntries := func(count int) time.Time {
+		time.Sleep(10 * time.Millisecond)
+		before := time.Now()
+		addTestEntries(t, server, count)
+		return before
+	}
+	start := addEntries(3)
+	t1 := addEntries(2)
+	t2 := addEntries(4)
+	require.NoError(t, server.TruncateFile(8))
+
+	// Case: Entries committed in a time window -> OK
+	window, err := server.GetEntriesByTime(t1, t2)
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.EntryRange{FromEntry: 3, ToEntry: 5, Commits: 1}, window)
+
+	window, err = server.GetEntriesByTime(start, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.EntryRange{FromEntry: 0, ToEntry: 8, Commits: 3}, window)
+
+	// Case: Entries truncated after their commit excluded -> OK
+	window, err = server.GetEntriesByTime(t2, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.EntryRange{FromEntry: 5, ToEntry: 8, Commits: 1}, window)
+
+	// Case: No commits in the time window -> Empty
+	window, err = server.GetEntriesByTime(time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, window.FromEntry, window.ToEntry)
+
+	// Case: Query and stream the entries of a time window from a client -> OK
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+	window, err = client.ExecCommandGetEntriesByTime(t1, t2)
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.EntryRange{FromEntry: 3, ToEntry: 5, Commits: 1}, window)
+
+	received := []uint64{}
+	err = client.StreamEntriesByTime(t1, t2, func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		received = append(received, e.Number)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 4}, received)
+
+	// Case: Query entries by time from a server not recording the header changes -> FAIL
+	otherServer, otherPort := newTestServer(t, "other.bin")
+	require.NoError(t, otherServer.Start())
+	other, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", otherPort), streamType)
+	require.NoError(t, err)
+	require.NoError(t, other.Start())
+	_, err = other.ExecCommandGetEntriesByTime(t1, t2)
+	require.ErrorIs(t, err, datastreamer.ErrHeaderChangesNotRecorded)
+}
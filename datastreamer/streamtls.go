@@ -0,0 +1,98 @@
+package datastreamer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// NewClientWithTLS creates a new data stream client connecting to the server over TLS with the configuration (see
+// SetTLS)
+func NewClientWithTLS(server string, streamType StreamType, config *tls.Config) (*StreamClient, error) {
+	return NewClient(server, streamType, WithTLS(config))
+}
+
+// SetTLS sets the client to connect to the server over TLS with the configuration, e.g. behind a TLS terminating
+// proxy to consume the stream over untrusted networks: the streaming connection and the command channel. The server
+// name (SNI and certificate verification) is taken from the server address if not set in the configuration. A
+// session cache is added if not set, so the reconnections resume the TLS session skipping the full handshake. A nil
+// configuration disables it (call before Start)
+func (c *StreamClient) SetTLS(config *tls.Config) {
+	if config == nil {
+		c.tlsConfig = nil
+		return
+	}
+	c.tlsConfig = config.Clone()
+	if c.tlsConfig.ClientSessionCache == nil {
+		c.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+}
+
+// NewTLSConfig returns a TLS configuration for the client with the server name (SNI and certificate verification,
+// taken from the server address if empty) and the root CAs of a PEM file (the system roots if empty)
+func NewTLSConfig(serverName string, caFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		log.Errorf("No certificates found in the CA file %s", caFile)
+		return nil, ErrInvalidCACertificates
+	}
+	config.RootCAs = roots
+	return config, nil
+}
+
+// dial opens a connection to the server with the dialer set (the default one if none), over TLS if set, the context
+// (or the dial timeout) cancels the connection attempt
+func (c *StreamClient) dial(ctx context.Context) (net.Conn, error) {
+	if c.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialTimeout)
+		defer cancel()
+	}
+	if c.dialContext == nil {
+		if c.tlsConfig == nil {
+			dialer := net.Dialer{KeepAlive: c.keepAlive()}
+			return dialer.DialContext(ctx, "tcp", c.serverAddr())
+		}
+		dialer := tls.Dialer{NetDialer: &net.Dialer{KeepAlive: c.keepAlive()}, Config: c.tlsConfig}
+		return dialer.DialContext(ctx, "tcp", c.serverAddr())
+	}
+
+	addr := c.serverAddr()
+	conn, err := c.dialContext(ctx, "tcp", addr)
+	if err != nil || c.tlsConfig == nil {
+		return conn, err
+	}
+
+	// TLS over the connection opened, with the server name taken from the address if not set
+	config := c.tlsConfig
+	if config.ServerName == "" {
+		host, _, errSplit := net.SplitHostPort(addr)
+		if errSplit == nil {
+			config = config.Clone()
+			config.ServerName = host
+		}
+	}
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,131 @@
+package datastreamer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientTLS(t *testing.T) {
+	server, port := newTestServer(t, "tls.bin")
+	require.NoError(t, server.Start())
+	require.NoError(t, server.StartAtomicOp())
+	_, err := server.AddStreamEntry(entryType1, testEntries[1].Encode())
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+
+	// TLS terminating proxy in front of the server, with the test certificate of example.com
+	certServer := httptest.NewTLSServer(nil)
+	cert := certServer.TLS.Certificates[0]
+	certServer.Close()
+	var mutex sync.Mutex
+	serverNames := []string{}
+	resumed := []bool{}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				tlsConn, _ := conn.(*tls.Conn)
+				if tlsConn.Handshake() != nil {
+					return
+				}
+				mutex.Lock()
+				serverNames = append(serverNames, tlsConn.ConnectionState().ServerName)
+				resumed = append(resumed, tlsConn.ConnectionState().DidResume)
+				mutex.Unlock()
+				backend, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+				if err != nil {
+					return
+				}
+				defer backend.Close()
+				go func() { _, _ = io.Copy(backend, conn) }()
+				_, _ = io.Copy(conn, backend)
+			}()
+		}
+	}()
+	proxy := ln.Addr().String()
+
+	// Case: Server certificate not trusted -> Connection attempts fail
+	client, err := datastreamer.NewClientWithTLS(proxy, streamType, &tls.Config{MinVersion: tls.VersionTLS12})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, client.StartContext(ctx), context.DeadlineExceeded)
+	require.NotZero(t, client.GetStats().Errors[datastreamer.StatErrConnect])
+
+	// Case: CA file without certificates -> FAIL
+	caFile := t.TempDir() + "/ca.pem"
+	require.NoError(t, os.WriteFile(caFile, []byte("no certificates"), 0600))
+	_, err = datastreamer.NewTLSConfig("example.com", caFile)
+	require.ErrorIs(t, err, datastreamer.ErrInvalidCACertificates)
+
+	// Case: Custom root CAs and server name -> Streaming and commands over TLS, command channel session resumed
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+		Bytes: certServer.Certificate().Raw}), 0600))
+	tlsConfig, err := datastreamer.NewTLSConfig("example.com", caFile)
+	require.NoError(t, err)
+	client, err = datastreamer.NewClientWithTLS(proxy, streamType, tlsConfig)
+	require.NoError(t, err)
+	received := make(chan datastreamer.FileEntry, 1)
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, c *datastreamer.StreamClient,
+		s *datastreamer.StreamServer) error {
+		received <- *e
+		return nil
+	})
+	require.NoError(t, client.Start())
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.ExecCommandStart(0))
+	select {
+	case e := <-received:
+		require.Equal(t, testEntries[1].Encode(), e.Data)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the entry over TLS")
+	}
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), header.TotalEntries)
+	mutex.Lock()
+	require.Equal(t, []string{"example.com", "example.com"}, serverNames)
+	require.Equal(t, []bool{false, true}, resumed)
+	mutex.Unlock()
+
+	// Case: Custom dialer -> TLS over the connections opened by the dialer
+	var dials atomic.Int32
+	other, err := datastreamer.NewClient(proxy, streamType, datastreamer.WithTLS(tlsConfig),
+		datastreamer.WithDialer(func(ctx context.Context, network string, address string) (net.Conn, error) {
+			dials.Add(1)
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		}))
+	require.NoError(t, err)
+	require.NoError(t, other.Start())
+	defer func() { _ = other.Close() }()
+	header, err = other.ExecCommandGetHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), header.TotalEntries)
+	require.Equal(t, int32(2), dials.Load())
+	mutex.Lock()
+	require.Equal(t, []string{"example.com", "example.com", "example.com", "example.com"}, serverNames)
+	mutex.Unlock()
+}
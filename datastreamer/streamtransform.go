@@ -0,0 +1,192 @@
+package datastreamer
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/golang/snappy"
+)
+
+const transformMagic = 0xd7 // First byte of the payloads written with write transforms
+
+// TransformID type of the identifier of a payload transform, recorded in the entries it was applied to
+type TransformID uint8
+
+const (
+	// TransformSHA256 appends the SHA-256 hash of the payload, verified on reverse
+	TransformSHA256 TransformID = 1
+	// TransformSnappy compresses the payload with snappy (if reduced)
+	TransformSnappy TransformID = 2
+	// TransformRedact redacts the payload by rules, irreversible
+	TransformRedact TransformID = 3
+)
+
+// PayloadTransform type for a transform of the payload of the data entries applied by the producer on write
+type PayloadTransform struct {
+	ID      TransformID                                              // Identifier recorded (not 0)
+	Apply   func(etype EntryType, data []byte) ([]byte, bool, error) // Payload transformed and if applied
+	Reverse func(etype EntryType, data []byte) ([]byte, error)       // Payload reversed (nil if irreversible)
+}
+
+// SetWriteTransforms sets the transforms applied in order to the payload of the data entries added to the stream
+// (AddStreamEntry and UpdateEntryData), before storing them. The payload stored is `0xd7 | count(1) | ids | payload
+// transformed`, with the IDs of the transforms applied (a transform may skip an entry, still prefixed), so the
+// readers reverse them with the receive middleware of NewReverseTransformMiddleware. The bookmarks aren't
+// transformed. The transforms must be set from the first entry of the stream and stay set, the readers reject the
+// payloads without the prefix. An update of an entry must keep its size once transformed, so with the size changing
+// transforms (e.g. SnappyTransform) UpdateEntryData usually fails with ErrUpdateEntryDifferentSize (call before adding
+// entries)
+func (s *StreamServer) SetWriteTransforms(transforms ...PayloadTransform) error {
+	ids := make(map[TransformID]struct{}, len(transforms))
+	for _, t := range transforms {
+		_, found := ids[t.ID]
+		if t.ID == 0 || t.Apply == nil || found {
+			log.Errorf("Invalid write transform %d", t.ID)
+			return ErrInvalidTransform
+		}
+		ids[t.ID] = struct{}{}
+	}
+	s.writeTransforms = transforms
+	return nil
+}
+
+// transformPayload applies the write transforms to the payload of a data entry, prefixed with the transforms applied
+func (s *StreamServer) transformPayload(etype EntryType, data []byte) ([]byte, error) {
+	if len(s.writeTransforms) == 0 {
+		return data, nil
+	}
+
+	ids := make([]byte, 0, len(s.writeTransforms))
+	for _, t := range s.writeTransforms {
+		transformed, applied, err := t.Apply(etype, data)
+		if err != nil {
+			log.Errorf("Error applying write transform %d to entry type %d: %v", t.ID, etype, err)
+			return nil, err
+		}
+		if applied {
+			data = transformed
+			ids = append(ids, byte(t.ID))
+		}
+	}
+
+	payload := make([]byte, 0, 2+len(ids)+len(data)) //nolint:mnd
+	payload = append(payload, transformMagic, byte(len(ids)))
+	payload = append(payload, ids...)
+	return append(payload, data...), nil
+}
+
+// PayloadTransforms returns the IDs of the write transforms applied to a payload, in order, and the payload
+// transformed. Returns false if the payload wasn't written with write transforms
+func PayloadTransforms(data []byte) ([]TransformID, []byte, bool) {
+	if len(data) < 2 || data[0] != transformMagic || len(data) < 2+int(data[1]) {
+		return nil, data, false
+	}
+	ids := make([]TransformID, data[1])
+	for i := range ids {
+		ids[i] = TransformID(data[2+i])
+	}
+	return ids, data[2+len(ids):], true
+}
+
+// NewReverseTransformMiddleware creates a receive middleware reversing the write transforms applied to the payload
+// of the data entries, in the reverse order. The irreversible ones (e.g. redaction) are left as applied. Every data
+// entry must be written with the write transforms prefix, a payload without it fails with ErrReversingPayload
+func NewReverseTransformMiddleware(transforms ...PayloadTransform) (EntryMiddleware, error) {
+	byID := make(map[TransformID]PayloadTransform, len(transforms))
+	for _, t := range transforms {
+		if t.ID == 0 {
+			return nil, ErrInvalidTransform
+		}
+		byID[t.ID] = t
+	}
+
+	return func(next EntryHandler) EntryHandler {
+		return func(e *FileEntry) error {
+			if e.Type == EtBookmark {
+				return next(e)
+			}
+			ids, data, ok := PayloadTransforms(e.Data)
+			if !ok {
+				return ErrReversingPayload
+			}
+			for i := len(ids) - 1; i >= 0; i-- {
+				t, found := byID[ids[i]]
+				if !found {
+					return ErrReversingPayload
+				}
+				if t.Reverse == nil {
+					continue
+				}
+				var err error
+				data, err = t.Reverse(e.Type, data)
+				if err != nil {
+					return err
+				}
+			}
+			e.Data = data
+			return next(e)
+		}
+	}, nil
+}
+
+// SnappyTransform returns the write transform compressing the payloads with snappy, applied if reduced
+func SnappyTransform() PayloadTransform {
+	return PayloadTransform{
+		ID: TransformSnappy,
+		Apply: func(_ EntryType, data []byte) ([]byte, bool, error) {
+			if len(data) < minCompressedData {
+				return data, false, nil
+			}
+			compressed := snappy.Encode(nil, data)
+			return compressed, len(compressed) < len(data), nil
+		},
+		Reverse: func(_ EntryType, data []byte) ([]byte, error) {
+			decoded, err := snappy.Decode(nil, data)
+			if err != nil {
+				return nil, ErrReversingPayload
+			}
+			return decoded, nil
+		},
+	}
+}
+
+// SHA256Transform returns the write transform appending the SHA-256 hash of the payloads, verified on reverse
+func SHA256Transform() PayloadTransform {
+	return PayloadTransform{
+		ID: TransformSHA256,
+		Apply: func(_ EntryType, data []byte) ([]byte, bool, error) {
+			hash := sha256.Sum256(data)
+			return append(append(make([]byte, 0, len(data)+sha256.Size), data...), hash[:]...), true, nil
+		},
+		Reverse: func(_ EntryType, data []byte) ([]byte, error) {
+			if len(data) < sha256.Size {
+				return nil, ErrReversingPayload
+			}
+			payload, hash := data[:len(data)-sha256.Size], sha256.Sum256(data[:len(data)-sha256.Size])
+			if !bytes.Equal(hash[:], data[len(payload):]) {
+				return nil, ErrReversingPayload
+			}
+			return payload, nil
+		},
+	}
+}
+
+// NewRedactTransform creates the write transform redacting the payloads by rules (see NewRedactMiddleware) before
+// they are stored, so the sensitive fields never reach the stream file
+func NewRedactTransform(rules []RedactRule) (PayloadTransform, error) {
+	byType, err := redactRulesByType(rules)
+	if err != nil {
+		return PayloadTransform{}, err
+	}
+	return PayloadTransform{
+		ID: TransformRedact,
+		Apply: func(etype EntryType, data []byte) ([]byte, bool, error) {
+			rule, found := byType[etype.Base()]
+			if !found || len(data) <= rule.Keep {
+				return data, false, nil
+			}
+			return redactData(data, rule), true, nil
+		},
+	}, nil
+}
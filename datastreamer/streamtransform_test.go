@@ -0,0 +1,87 @@
+package datastreamer_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTransforms(t *testing.T) {
+	server, port := newTestServer(t, "transforms.bin")
+
+	// Case: Transform without ID or repeated -> Rejected
+	require.ErrorIs(t, server.SetWriteTransforms(datastreamer.PayloadTransform{}), datastreamer.ErrInvalidTransform)
+	require.ErrorIs(t, server.SetWriteTransforms(datastreamer.SnappyTransform(), datastreamer.SnappyTransform()),
+		datastreamer.ErrInvalidTransform)
+
+	redact, err := datastreamer.NewRedactTransform([]datastreamer.RedactRule{
+		{EntryType: entryType2, Action: datastreamer.RedactZero, Keep: 4}})
+	require.NoError(t, err)
+	transforms := []datastreamer.PayloadTransform{redact, datastreamer.SHA256Transform(),
+		datastreamer.SnappyTransform()}
+	require.NoError(t, server.SetWriteTransforms(transforms...))
+	require.NoError(t, server.Start())
+
+	large := bytes.Repeat([]byte("transform"), 100)
+	secret := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamBookmark([]byte{0, 1})
+	require.NoError(t, err)
+	_, err = server.AddStreamEntry(entryType1, large)
+	require.NoError(t, err)
+	_, err = server.AddStreamEntry(entryType2, secret)
+	require.NoError(t, err)
+	require.NoError(t, server.CommitAtomicOp())
+
+	// Case: Payloads stored -> Transforms applied recorded, skipped if not applicable
+	entry, err := server.GetEntry(1)
+	require.NoError(t, err)
+	ids, _, ok := datastreamer.PayloadTransforms(entry.Data)
+	require.True(t, ok)
+	require.Equal(t, []datastreamer.TransformID{datastreamer.TransformSHA256, datastreamer.TransformSnappy}, ids)
+	require.Less(t, len(entry.Data), len(large))
+	entry, err = server.GetEntry(2)
+	require.NoError(t, err)
+	ids, _, ok = datastreamer.PayloadTransforms(entry.Data)
+	require.True(t, ok)
+	require.Equal(t, []datastreamer.TransformID{datastreamer.TransformRedact, datastreamer.TransformSHA256}, ids)
+	entry, err = server.GetEntry(0)
+	require.NoError(t, err)
+	_, _, ok = datastreamer.PayloadTransforms(entry.Data)
+	require.False(t, ok)
+
+	// Case: Client reversing the transforms -> Original payloads, the redacted one as redacted
+	reverse, err := datastreamer.NewReverseTransformMiddleware(transforms...)
+	require.NoError(t, err)
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	client.UseReceiveMiddleware(reverse)
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.Start())
+	entry, err = client.ExecCommandGetEntry(1)
+	require.NoError(t, err)
+	require.Equal(t, large, entry.Data)
+	entry, err = client.ExecCommandGetEntry(2)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 4, 0, 0, 0, 0}, entry.Data)
+
+	// Case: Update of a compressed entry -> Size changed once transformed, rejected
+	require.ErrorIs(t, server.UpdateEntryData(1, entryType1, bytes.Repeat([]byte("updated"), 100)),
+		datastreamer.ErrUpdateEntryDifferentSize)
+
+	// Case: Payload tampered or transform unknown -> Not reversed
+	tampered := datastreamer.FileEntry{Type: entryType1, Data: []byte{0xd7, 1, byte(datastreamer.TransformSHA256), 1}}
+	pass := func(*datastreamer.FileEntry) error { return nil }
+	require.ErrorIs(t, reverse(pass)(&tampered), datastreamer.ErrReversingPayload)
+	unknown := datastreamer.FileEntry{Type: entryType1, Data: []byte{0xd7, 1, 200, 1}}
+	require.ErrorIs(t, reverse(pass)(&unknown), datastreamer.ErrReversingPayload)
+
+	// Case: Payload written without the transforms prefix -> Rejected, the bookmarks passed as they are
+	plain := datastreamer.FileEntry{Type: entryType1, Data: []byte{1, 2, 3}}
+	require.ErrorIs(t, reverse(pass)(&plain), datastreamer.ErrReversingPayload)
+	bookmark := datastreamer.FileEntry{Type: datastreamer.EtBookmark, Data: []byte{0, 1}}
+	require.NoError(t, reverse(pass)(&bookmark))
+}
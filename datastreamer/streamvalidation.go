@@ -0,0 +1,48 @@
+package datastreamer
+
+import (
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// SetBackgroundValidation sets the lazy open mode (call before Start): the server starts serving reads from the
+// last committed header while the deep validation of the stream file runs in background, and the writes are
+// allowed once the validation is completed successfully
+func (s *StreamServer) SetBackgroundValidation(enabled bool) {
+	s.backgroundValidation = enabled
+}
+
+// WaitValidation waits for the background validation of the stream file to complete, and returns its result
+func (s *StreamServer) WaitValidation() error {
+	if s.validationDone == nil {
+		return nil
+	}
+	<-s.validationDone
+	return s.validationErr
+}
+
+// validateFile performs the deep validation of the stream file in background
+func (s *StreamServer) validateFile() {
+	log.Infof("Validating stream file %s in background, writes not allowed until completed", s.fileName)
+	s.validationErr = s.streamFile.validateDataEntries()
+	if s.validationErr != nil {
+		log.Errorf("Stream file %s validation failed, writes not allowed: %v", s.fileName, s.validationErr)
+	}
+	close(s.validationDone)
+}
+
+// checkWritable checks the stream file can be written, the background validation (if enabled) completed successfully
+func (s *StreamServer) checkWritable() error {
+	if s.validationDone == nil {
+		return nil
+	}
+	select {
+	case <-s.validationDone:
+		if s.validationErr != nil {
+			log.Errorf("Write not allowed, stream file validation failed")
+		}
+		return s.validationErr
+	default:
+		log.Errorf("Write not allowed, stream file validation in progress")
+		return ErrValidationInProgress
+	}
+}
@@ -0,0 +1,132 @@
+package datastreamer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const maxVerifierEntries = 100000 // Maximum entries of a segment between bookmarks kept to verify it
+
+// Verifier interface for a verifier cross-checking the stream contents against an external source (e.g. the L1
+// contract state) at the bookmark boundaries, for verified follower deployments
+type Verifier interface {
+	// Verify verifies a segment of the stream: the bookmark opening it and the entries received after it, up to the
+	// next bookmark. Returns an error wrapping ErrStreamDivergence if the segment diverges from the external source,
+	// any other error if it can't be verified (e.g. external source unavailable)
+	Verify(bookmark FileEntry, entries []FileEntry) error
+}
+
+// VerifierFunc type of a function implementing the Verifier interface
+type VerifierFunc func(bookmark FileEntry, entries []FileEntry) error
+
+// Verify calls the verifier function
+func (f VerifierFunc) Verify(bookmark FileEntry, entries []FileEntry) error {
+	return f(bookmark, entries)
+}
+
+// Divergence type for a segment of the stream diverging from the external source of the verifier
+type Divergence struct {
+	Time      time.Time
+	Bookmark  []byte // Bookmark opening the segment
+	FromEntry uint64 // Entry number of the bookmark opening the segment
+	ToEntry   uint64 // Latest entry number of the segment
+	Err       error  // Divergence returned by the verifier
+}
+
+// DivergenceFunc type of the hook function called on a divergence found by the verifier
+type DivergenceFunc func(Divergence)
+
+// streamVerifier type for the verification of the streaming segments between bookmarks
+type streamVerifier struct {
+	verifier     Verifier
+	stop         bool // Flag to stop the streaming on a divergence
+	onDivergence DivergenceFunc
+
+	bookmark  *FileEntry  // Bookmark opening the segment in progress (nil until the first bookmark)
+	entries   []FileEntry // Entries of the segment in progress
+	truncated bool        // Flag the segment in progress exceeded the maximum entries, not verified
+}
+
+// SetVerifier sets the client to cross-check the streaming entries against an external source at the bookmark
+// boundaries: once a bookmark is received, the segment opened by the previous bookmark is passed to the verifier
+// before processing the bookmark (the entries before the first bookmark are not verified, nor the segments over
+// 100000 entries). A divergence is logged, counted in the statistics and passed to the hook function (if not nil),
+// and stops the streaming if stop is set (Run returns the divergence error). The segments verified are counted in
+// the statistics, the errors verifying them logged and counted. Not applied to the subscriptions. A nil verifier
+// disables it (call before Start)
+func (c *StreamClient) SetVerifier(verifier Verifier, stop bool, onDivergence DivergenceFunc) {
+	if verifier == nil {
+		c.verifier = nil
+		return
+	}
+	c.verifier = &streamVerifier{
+		verifier:     verifier,
+		stop:         stop,
+		onDivergence: onDivergence,
+	}
+}
+
+// verifySegment collects a streaming entry in the segment in progress, verifying the segment once the next bookmark
+// is received. Returns the divergence error stopping the streaming (nil to continue)
+func (c *StreamClient) verifySegment(e *FileEntry) error {
+	v := c.verifier
+	if v == nil {
+		return nil
+	}
+
+	if e.Type != EtBookmark {
+		if v.bookmark != nil && !v.truncated {
+			if len(v.entries) >= maxVerifierEntries {
+				log.Warnf("%s Segment of bookmark entry %d over %d entries, not verified", c.ID, v.bookmark.Number,
+					maxVerifierEntries)
+				v.entries, v.truncated = nil, true
+			} else {
+				v.entries = append(v.entries, *e)
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if v.bookmark != nil && !v.truncated {
+		err = c.verifyBookmarkSegment(*v.bookmark, v.entries, e.Number-1)
+	}
+	bookmark := *e
+	v.bookmark = &bookmark
+	v.entries, v.truncated = nil, false
+	return err
+}
+
+// verifyBookmarkSegment passes a complete segment to the verifier, flagging it on divergence
+func (c *StreamClient) verifyBookmarkSegment(bookmark FileEntry, entries []FileEntry, toEntry uint64) error {
+	v := c.verifier
+	err := v.verifier.Verify(bookmark, entries)
+	if err == nil {
+		c.stats.segmentVerified()
+		return nil
+	}
+	if !errors.Is(err, ErrStreamDivergence) {
+		log.Errorf("%s Error verifying entries %d-%d: %v", c.ID, bookmark.Number, toEntry, err)
+		c.stats.addError(StatErrVerify, err)
+		return nil
+	}
+
+	log.Errorf("%s Entries %d-%d of bookmark [%x] diverge from the verifier source: %v", c.ID, bookmark.Number,
+		toEntry, bookmark.Data, err)
+	c.stats.addError(StatErrDivergence, err)
+	if v.onDivergence != nil {
+		v.onDivergence(Divergence{
+			Time:      time.Now(),
+			Bookmark:  bookmark.Data,
+			FromEntry: bookmark.Number,
+			ToEntry:   toEntry,
+			Err:       err,
+		})
+	}
+	if v.stop {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package datastreamer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientVerifier(t *testing.T) {
+	port := freePort(t)
+	server, err := datastreamer.NewEphemeralServer(port, 1, 137, streamType, 3*time.Second, 120*time.Second,
+		5*time.Second, nil)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer func() { _ = server.Shutdown(0) }()
+
+	// Entries 0-6: entry, bookmark a, 2 entries, bookmark b, entry, bookmark c
+	require.NoError(t, server.StartAtomicOp())
+	_, err = server.AddStreamEntry(1, []byte{0x00})
+	require.NoError(t, err)
+	for _, bookmark := range []string{"a", "b", "c"} {
+		_, err = server.AddStreamBookmark([]byte(bookmark))
+		require.NoError(t, err)
+		if bookmark == "a" {
+			_, err = server.AddStreamEntry(1, []byte{0x01})
+			require.NoError(t, err)
+		}
+		if bookmark != "c" {
+			_, err = server.AddStreamEntry(1, []byte{0x02})
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, server.CommitAtomicOp())
+
+	// The segment of bookmark b diverges, the segment of bookmark a can't be verified the first time
+	startClient := func(stop bool, failVerify bool) (*datastreamer.StreamClient, func() ([]string,
+		[]datastreamer.Divergence)) {
+		var mutex sync.Mutex
+		segments := []string{}
+		divergences := []datastreamer.Divergence{}
+		client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+		require.NoError(t, err)
+		client.SetVerifier(datastreamer.VerifierFunc(func(bookmark datastreamer.FileEntry,
+			entries []datastreamer.FileEntry) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if failVerify {
+				failVerify = false
+				return errors.New("source unavailable")
+			}
+			segments = append(segments, fmt.Sprintf("%s:%d", bookmark.Data, len(entries)))
+			if string(bookmark.Data) == "b" {
+				return fmt.Errorf("%w: state root mismatch", datastreamer.ErrStreamDivergence)
+			}
+			return nil
+		}), stop, func(d datastreamer.Divergence) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			divergences = append(divergences, d)
+		})
+		client.SetProcessEntryFunc(func(*datastreamer.FileEntry, *datastreamer.StreamClient,
+			*datastreamer.StreamServer) error {
+			return nil
+		})
+		require.NoError(t, client.Start())
+		require.NoError(t, client.ExecCommandStart(0))
+		return client, func() ([]string, []datastreamer.Divergence) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]string{}, segments...), append([]datastreamer.Divergence{}, divergences...)
+		}
+	}
+
+	// Case: Bookmark segments verified -> Divergence flagged, streaming continues
+	client, verified := startClient(false, false)
+	require.Eventually(t, func() bool {
+		segments, _ := verified()
+		return len(segments) == 2
+	}, time.Second, 10*time.Millisecond)
+	segments, divergences := verified()
+	require.Equal(t, []string{"a:2", "b:1"}, segments)
+	require.Len(t, divergences, 1)
+	require.Equal(t, []byte("b"), divergences[0].Bookmark)
+	require.Equal(t, uint64(4), divergences[0].FromEntry)
+	require.Equal(t, uint64(5), divergences[0].ToEntry)
+	require.ErrorIs(t, divergences[0].Err, datastreamer.ErrStreamDivergence)
+	stats := client.GetStats()
+	require.Equal(t, uint64(1), stats.Verified)
+	require.Equal(t, uint64(1), stats.Errors[datastreamer.StatErrDivergence])
+
+	// Case: Verifier error -> Counted, segment not verified
+	client, verified = startClient(false, true)
+	require.Eventually(t, func() bool {
+		segments, _ := verified()
+		return len(segments) == 1
+	}, time.Second, 10*time.Millisecond)
+	segments, _ = verified()
+	require.Equal(t, []string{"b:1"}, segments)
+	require.Equal(t, uint64(1), client.GetStats().Errors[datastreamer.StatErrVerify])
+
+	// Case: Stop on divergence -> Streaming stopped with the divergence
+	client, _ = startClient(true, false)
+	require.ErrorIs(t, client.Run(context.Background()), datastreamer.ErrStreamDivergence)
+}
@@ -0,0 +1,59 @@
+package datastreamer
+
+import (
+	"bytes"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// bookmarkWatch type to route to a subscription only the bookmarks with a prefix
+type bookmarkWatch struct {
+	prefix []byte // Prefix of the bookmarks watched (empty for all the bookmarks)
+}
+
+// WatchBookmarks starts a new subscription over the client connection watching the bookmarks with a prefix from
+// entry: only the bookmark entries matching the prefix are received (the notifications of their commit), without
+// the rest of the entries, e.g. to monitor when a block lands. Use the total entries of the header as fromEntry to
+// watch only the new commits. Unsubscribe ends the watch
+func (c *StreamClient) WatchBookmarks(fromEntry uint64, prefix []byte, f ProcessEntryFunc) (*Subscription, error) {
+	if len(prefix) > maxBookmarkLength {
+		log.Errorf("Bookmarks prefix length %d exceeds the maximum length %d", len(prefix), maxBookmarkLength)
+		return nil, ErrBookmarkMaxLength
+	}
+	return c.subscribe(CmdWatchBookmarks, fromEntry, prefix, f)
+}
+
+// pass checks if an entry streamed is a bookmark with the prefix watched
+func (w *bookmarkWatch) pass(e *FileEntry) bool {
+	return e.Type == EtBookmark && bytes.HasPrefix(e.Data, w.prefix)
+}
+
+// handleSubWatchBookmarksCommand processes the tagged CmdWatchBookmarks command creating a new bookmarks watch
+func (s *StreamServer) handleSubWatchBookmarksCommand(cli *client, tag uint64) error {
+	// Read from entry number and bookmarks prefix parameters
+	fromEntry, err := readFullUint64(cli)
+	if err != nil {
+		return err
+	}
+	prefix, err := readBookmarkParam(cli)
+	if err != nil {
+		return err
+	}
+
+	// Log
+	log.Debugf("Client %s command WatchBookmarks from %d prefix [%v] for subscription %d",
+		cli.clientID, fromEntry, prefix, tag)
+
+	cli.cmdRoute = &bookmarkWatch{prefix: prefix}
+	defer func() { cli.cmdRoute = nil }()
+
+	sub, err := s.addSubscription(cli, tag)
+	if err != nil {
+		return err
+	}
+
+	nextEntry, err := s.startStreamingFromEntry(cli, fromEntry)
+	s.endSubscriptionSync(cli, sub, nextEntry, err)
+
+	return err
+}
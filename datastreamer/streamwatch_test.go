@@ -0,0 +1,78 @@
+package datastreamer_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchBookmarks(t *testing.T) {
+	server, port := newTestServer(t, "watch.bin")
+	require.NoError(t, server.Start())
+
+	// Bookmarks of blocks (0x01) and batches (0x02) followed by an entry
+	addBookmarks := func(bookmarks ...[]byte) {
+		require.NoError(t, server.StartAtomicOp())
+		for _, bookmark := range bookmarks {
+			_, err := server.AddStreamBookmark(bookmark)
+			require.NoError(t, err)
+			_, err = server.AddStreamEntry(entryType1, testEntries[1].Encode())
+			require.NoError(t, err)
+		}
+		require.NoError(t, server.CommitAtomicOp())
+	}
+	addBookmarks([]byte{1, 0, 1}, []byte{2, 0, 1}, []byte{1, 0, 2})
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	require.NoError(t, client.Start())
+
+	var mutex sync.Mutex
+	received := make(map[int][]string)
+	collect := func(key int) datastreamer.ProcessEntryFunc {
+		return func(e *datastreamer.FileEntry, c *datastreamer.StreamClient, s *datastreamer.StreamServer) error {
+			mutex.Lock()
+			received[key] = append(received[key], fmt.Sprintf("%d:%x", e.Number, e.Data))
+			mutex.Unlock()
+			return nil
+		}
+	}
+	check := func(key int, expected ...string) {
+		require.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return reflect.DeepEqual(expected, received[key])
+		}, 2*time.Second, 10*time.Millisecond, "watch %d", key)
+	}
+
+	// Case: Watch the bookmarks committed with a prefix -> Only the bookmarks matching received
+	_, err = client.WatchBookmarks(0, []byte{1}, collect(0))
+	require.NoError(t, err)
+	check(0, "0:010001", "4:010002")
+
+	// Case: Watch a bookmark from the end of the stream -> Notified when committed
+	header, err := client.ExecCommandGetHeader()
+	require.NoError(t, err)
+	watch, err := client.WatchBookmarks(header.TotalEntries, []byte{2, 0, 2}, collect(1))
+	require.NoError(t, err)
+	addBookmarks([]byte{1, 0, 3}, []byte{2, 0, 2})
+	check(0, "0:010001", "4:010002", "6:010003")
+	check(1, "8:020002")
+
+	// Case: Watch ended -> Not notified
+	require.NoError(t, watch.Unsubscribe())
+	addBookmarks([]byte{2, 0, 2})
+	check(0, "0:010001", "4:010002", "6:010003")
+	check(1, "8:020002")
+
+	// Case: Prefix longer than a bookmark -> FAIL
+	_, err = client.WatchBookmarks(0, make([]byte, 17), nil)
+	require.ErrorIs(t, err, datastreamer.ErrBookmarkMaxLength)
+
+	require.NoError(t, server.Shutdown(time.Second))
+}
@@ -0,0 +1,198 @@
+package datastreamer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const workersWindow = 4 // Entries in process or pending the in-order acknowledgement per worker
+
+// CompletedFunc type of the hook function called on the in-order completion of the streaming entries processed by
+// the workers, with the next entry number after the entries completed
+type CompletedFunc func(nextEntry uint64)
+
+// workerPool type for the worker goroutines processing the streaming entries, acknowledged in order
+type workerPool struct {
+	workers     int
+	onCompleted CompletedFunc
+
+	jobs   chan *workerJob // Entries dispatched to the workers
+	window chan struct{}   // Slots of the entries in process or pending the acknowledgement
+
+	mutex    sync.Mutex
+	inflight []*workerJob  // Entries dispatched not acknowledged yet, in order
+	err      error         // First error processing an entry, the dispatch is stopped
+	failed   chan struct{} // Closed on the first error processing an entry
+	idle     chan struct{} // Signaled once all the entries dispatched are acknowledged
+}
+
+// workerJob type for an entry dispatched to the workers
+type workerJob struct {
+	entry FileEntry
+	done  bool // Flag the entry is processed
+}
+
+// SetWorkers sets the client to process the streaming entries with a pool of worker goroutines calling the process
+// entry function concurrently (so it must be safe for concurrent use), for a slow but parallelizable processing,
+// e.g. database writes. Up to 4 entries per worker are in process or pending the acknowledgement. The entries are
+// still acknowledged in order: the processed position of the checkpoint advances, and the completion hook (if not
+// nil) is called, only once all the entries before are processed too. A stop barrier waits for the entries in
+// process, and the first error stopping the streaming stops the dispatch. Not for the relays, forwarding the entries
+// in order. Less than 2 workers disables it (call before Start)
+func (c *StreamClient) SetWorkers(workers int, onCompleted CompletedFunc) {
+	if workers < 2 { //nolint:mnd
+		c.workers = nil
+		return
+	}
+	c.workers = &workerPool{
+		workers:     workers,
+		onCompleted: onCompleted,
+		jobs:        make(chan *workerJob, workers*workersWindow),
+		window:      make(chan struct{}, workers*workersWindow),
+		failed:      make(chan struct{}),
+		idle:        make(chan struct{}, 1),
+	}
+}
+
+// startWorkers starts the worker goroutines processing the streaming entries (if set)
+func (c *StreamClient) startWorkers() {
+	if c.workers == nil {
+		return
+	}
+	for i := 0; i < c.workers.workers; i++ {
+		c.spawn(c.runWorker)
+	}
+}
+
+// runWorker processes the entries dispatched until the client is stopped
+func (c *StreamClient) runWorker() {
+	p := c.workers
+	for {
+		select {
+		case job := <-p.jobs:
+			c.processJob(job)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// processJob processes an entry dispatched, unless the streaming is stopped by an error
+func (c *StreamClient) processJob(job *workerJob) {
+	p := c.workers
+	if p.firstError() != nil {
+		return
+	}
+
+	start := time.Now()
+	err := c.processWithPolicy(&job.entry, c.processEntry, c.relayServer)
+	c.slow.processed(job.entry.Number, time.Since(start))
+	if err != nil {
+		log.Errorf("%s Processing entry %d: %s. Exiting getStream function", c.ID, job.entry.Number, err.Error())
+		p.fail(err)
+		return
+	}
+	p.complete(c, job)
+}
+
+// dispatch queues an entry to process to the workers, waiting for a slot of the window. Returns the error stopping
+// the streaming
+func (p *workerPool) dispatch(c *StreamClient, e *FileEntry) error {
+	select {
+	case p.window <- struct{}{}:
+	case <-p.failed:
+		return p.firstError()
+	case <-c.done:
+		return nil
+	}
+
+	job := &workerJob{entry: *e}
+	p.mutex.Lock()
+	if p.err != nil {
+		p.mutex.Unlock()
+		return p.err
+	}
+	p.inflight = append(p.inflight, job)
+	p.mutex.Unlock()
+
+	// The jobs channel has a slot for each slot of the window
+	p.jobs <- job
+	return nil
+}
+
+// complete records an entry processed, acknowledging in order the entries processed without a previous one pending
+func (p *workerPool) complete(c *StreamClient, job *workerJob) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	job.done = true
+	for len(p.inflight) > 0 && p.inflight[0].done {
+		entryNum := p.inflight[0].entry.Number
+		p.inflight[0] = nil
+		p.inflight = p.inflight[1:]
+		<-p.window
+
+		c.checkpoint.entryProcessed(entryNum)
+		if p.onCompleted != nil {
+			p.onCompleted(entryNum + 1)
+		}
+	}
+	if len(p.inflight) == 0 {
+		select {
+		case p.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// fail records the first error processing an entry, stopping the dispatch
+func (p *workerPool) fail(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.err == nil {
+		p.err = err
+		close(p.failed)
+	}
+}
+
+// firstError returns the first error processing an entry (nil if none)
+func (p *workerPool) firstError() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.err
+}
+
+// failure returns the channel closed on the first error processing an entry (nil, never closed, if no workers)
+func (p *workerPool) failure() <-chan struct{} {
+	if p == nil {
+		return nil
+	}
+	return p.failed
+}
+
+// drain waits until the entries dispatched are acknowledged, an entry fails or the client is stopped
+func (p *workerPool) drain(c *StreamClient) {
+	if p == nil {
+		return
+	}
+	for {
+		p.mutex.Lock()
+		pending := len(p.inflight)
+		p.mutex.Unlock()
+		if pending == 0 {
+			return
+		}
+
+		select {
+		case <-p.idle:
+		case <-p.failed:
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
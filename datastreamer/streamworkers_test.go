@@ -0,0 +1,96 @@
+package datastreamer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientWorkers(t *testing.T) {
+	server, port := newTestServer(t, "workers.bin")
+	require.NoError(t, server.Start())
+	addTestEntries(t, server, 40)
+
+	client, err := datastreamer.NewClient(fmt.Sprintf("localhost:%d", port), streamType)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	var mutex sync.Mutex
+	completed := []uint64{}
+	client.SetWorkers(4, func(nextEntry uint64) {
+		mutex.Lock()
+		completed = append(completed, nextEntry)
+		mutex.Unlock()
+	})
+	var processed atomic.Int32
+	release := make(chan struct{})
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		if e.Number == 0 {
+			<-release
+		}
+		processed.Add(1)
+		return nil
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+
+	// Case: First entry in process -> The next ones processed in parallel up to the window, none acknowledged
+	require.Eventually(t, func() bool {
+		return processed.Load() == 4*4-1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Never(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return processed.Load() > 4*4-1 || len(completed) > 0
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	// Case: First entry processed -> All the entries acknowledged in order
+	close(release)
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(completed) == 40
+	}, 2*time.Second, 10*time.Millisecond)
+	for i, next := range completed {
+		require.Equal(t, uint64(i+1), next)
+	}
+
+	// Case: Stop draining -> Stopped once the entries dispatched are acknowledged
+	client.SetStopDrain(datastreamer.StopDrain)
+	_, err = client.ExecCommandStopAck(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	// Case: Entry failed -> Streaming stopped with its error, the next entries not acknowledged
+	errProcess := errors.New("process error")
+	fatal := make(chan error, 1)
+	client.SetOnFatal(func(err error) {
+		fatal <- err
+	})
+	completed = completed[:0]
+	client.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		if e.Number == 5 {
+			return errProcess
+		}
+		return nil
+	})
+	require.NoError(t, client.Start())
+	require.NoError(t, client.ExecCommandStart(0))
+	select {
+	case err = <-fatal:
+		require.ErrorIs(t, err, errProcess)
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "streaming not stopped")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.LessOrEqual(t, len(completed), 5)
+}
@@ -0,0 +1,103 @@
+package datastreamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+// SetWriteVerification sets the server to read back every write to the stream file right after it (the data entries,
+// the pad entries and the header), verifying it matches the data intended and decoding it again, to catch the
+// serialization bugs and the disk anomalies in the QA environments at the cost of the write throughput. A mismatch
+// fails the write with ErrWriteVerification (call before Start)
+func (s *StreamServer) SetWriteVerification(enabled bool) {
+	s.streamFile.verifyWrites = enabled
+}
+
+// SetWriteVerification sets the relay server side to verify the writes to the stream file (call before Start)
+func (r *StreamRelay) SetWriteVerification(enabled bool) {
+	r.server.SetWriteVerification(enabled)
+}
+
+// verifyWrite reads back the data written at a position of a file and checks it matches the data intended
+func (f *StreamFile) verifyWrite(file *os.File, data []byte, pos int64) error {
+	written := make([]byte, len(data))
+	_, err := file.ReadAt(written, pos)
+	if err != nil {
+		log.Errorf("Error reading back %d bytes written at %d: %v", len(data), pos, err)
+		return err
+	}
+	if !bytes.Equal(written, data) {
+		offset := 0
+		for offset < len(data) && written[offset] == data[offset] {
+			offset++
+		}
+		log.Errorf("Write verification failed at %d: %d bytes written, first mismatch at byte %d", pos, len(data),
+			offset)
+		return ErrWriteVerification
+	}
+	return nil
+}
+
+// verifyEntriesWrite verifies the data entries (and pad entry) written at a position of the stream file, reading them
+// back and decoding them again: consistent lengths, packet types and consecutive entry numbers, re-encoded equal
+func (f *StreamFile) verifyEntriesWrite(data []byte, pos int64) error {
+	if !f.verifyWrites {
+		return nil
+	}
+	err := f.verifyWrite(f.file, data, pos)
+	if err != nil {
+		return err
+	}
+
+	var next uint64
+	for offset := 0; offset < len(data); {
+		// Pad entry, the rest of the page not written
+		if data[offset] == PtPadding && offset == len(data)-1 {
+			return nil
+		}
+		if data[offset] != PtData || len(data)-offset < FixedSizeFileEntry {
+			log.Errorf("Write verification failed at %d: invalid entry at byte %d", pos, offset)
+			return ErrWriteVerification
+		}
+		length := int(binary.BigEndian.Uint32(data[offset+1:]))
+		if length < FixedSizeFileEntry || length > len(data)-offset {
+			log.Errorf("Write verification failed at %d: invalid entry length %d at byte %d", pos, length, offset)
+			return ErrWriteVerification
+		}
+		e, err := DecodeBinaryToFileEntry(data[offset : offset+length])
+		if err != nil {
+			return err
+		}
+		if (offset > 0 && e.Number != next) || !bytes.Equal(encodeFileEntryToBinary(e), data[offset:offset+length]) {
+			log.Errorf("Write verification failed at %d: entry %d at byte %d not decoded as written", pos, e.Number,
+				offset)
+			return ErrWriteVerification
+		}
+		next = e.Number + 1
+		offset += length
+	}
+	return nil
+}
+
+// verifyHeaderWrite verifies the header written in the stream file, reading it back and decoding it again
+func (f *StreamFile) verifyHeaderWrite(binaryHeader []byte) error {
+	if !f.verifyWrites {
+		return nil
+	}
+	err := f.verifyWrite(f.fileHeader, binaryHeader, magicNumSize)
+	if err != nil {
+		return err
+	}
+	header, err := decodeBinaryToHeaderEntry(binaryHeader)
+	if err != nil {
+		return err
+	}
+	if header != f.header {
+		log.Errorf("Write verification failed: header %+v decoded as %+v", f.header, header)
+		return ErrWriteVerification
+	}
+	return nil
+}
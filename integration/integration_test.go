@@ -0,0 +1,301 @@
+//go:build integration
+
+// Package integration runs the end-to-end tests of the data streamer: a server, a relay and several clients run as
+// separate processes of the test binary, killed and restarted randomly meanwhile the server produces entries, and the
+// entries recorded by the clients are checked for losses and duplicates. Run them with
+// go test -tags integration ./integration
+package integration
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	serverPort  = 6926
+	relayPort   = 6927
+	stopTimeout = 10 * time.Second // Time to let a component exit on SIGTERM before killing it
+)
+
+var (
+	chaos   = flag.Duration("chaos", 30*time.Second, "duration of the random kills and restarts of the components")
+	settle  = flag.Duration("settle", 2*time.Minute, "timeout for the clients to catch up once the chaos ends")
+	clients = flag.Int("clients", 4, "number of clients, half of them connected to the relay")
+	seed    = flag.Int64("seed", 0, "seed of the random kills and restarts (0 random)")
+)
+
+// component type for a component process of the test: server, relay or client
+type component struct {
+	name    string
+	role    string
+	env     []string
+	logFile string
+
+	mutex    sync.Mutex
+	cmd      *exec.Cmd
+	stopping bool
+	exited   chan struct{}
+	kills    int
+	failures chan<- error
+}
+
+func TestMain(m *testing.M) {
+	// Run as a component process
+	if role := os.Getenv(envRole); role != "" {
+		err := runRole(role)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", role, os.Getenv(envName), err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestChaos(t *testing.T) {
+	// Working directory, kept if the test fails
+	dir, err := os.MkdirTemp("", "dse2e")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if !t.Failed() {
+			os.RemoveAll(dir)
+		}
+	})
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	t.Logf("Chaos %v with %d clients, seed %d, directory %s", *chaos, *clients, *seed, dir)
+
+	failures := make(chan error, 1)
+	serverAddr := fmt.Sprintf("127.0.0.1:%d", serverPort)
+	relayAddr := fmt.Sprintf("127.0.0.1:%d", relayPort)
+	components := []*component{
+		newComponent(dir, "server", roleServer, failures, envPort+"="+strconv.Itoa(serverPort)),
+		newComponent(dir, "relay", roleRelay, failures, envPort+"="+strconv.Itoa(relayPort), envServer+"="+serverAddr),
+	}
+	for i := 0; i < *clients; i++ {
+		addr := serverAddr
+		if i%2 == 1 {
+			addr = relayAddr
+		}
+		components = append(components, newComponent(dir, fmt.Sprintf("client%d", i), roleClient, failures,
+			envServer+"="+addr))
+	}
+	for _, c := range components {
+		require.NoError(t, c.start())
+	}
+	defer func() {
+		for _, c := range components {
+			c.stop(syscall.SIGKILL)
+		}
+	}()
+
+	// Kill and restart the components randomly
+	for deadline := time.Now().Add(*chaos); time.Now().Before(deadline); {
+		select {
+		case err := <-failures:
+			require.NoError(t, err)
+		case <-time.After(time.Duration(200+rng.Intn(1800)) * time.Millisecond):
+		}
+
+		c := components[rng.Intn(len(components))]
+		sig := syscall.SIGKILL
+		if rng.Intn(3) == 0 {
+			sig = syscall.SIGTERM
+		}
+		c.stop(sig)
+		time.Sleep(time.Duration(rng.Intn(1000)) * time.Millisecond)
+		require.NoError(t, c.start())
+	}
+	for _, c := range components {
+		t.Logf("Component %s stopped %d times", c.name, c.kills)
+	}
+
+	// Stop the producer and wait for the clients to catch up
+	require.NoError(t, os.WriteFile(filepath.Join(dir, stopFileName), nil, 0o600))
+	total := waitTotal(t, dir, failures)
+	t.Logf("Server stopped at %d entries", total)
+	for _, c := range components[2:] {
+		waitRecords(t, filepath.Join(dir, c.name+".rec"), total, failures)
+	}
+	for _, c := range components {
+		c.stop(syscall.SIGTERM)
+	}
+
+	// Check the entries recorded by the clients: all of them in order, once, with their payload
+	for _, c := range components[2:] {
+		records := readRecords(t, filepath.Join(dir, c.name+".rec"))
+		require.NoError(t, checkRecords(records, total), "%s (log %s)", c.name, c.logFile)
+	}
+}
+
+// newComponent creates a component process of a role
+func newComponent(dir string, name string, role string, failures chan<- error, env ...string) *component {
+	return &component{
+		name:     name,
+		role:     role,
+		env:      append([]string{envRole + "=" + role, envDir + "=" + dir, envName + "=" + name}, env...),
+		logFile:  filepath.Join(dir, name+".log"),
+		failures: failures,
+	}
+}
+
+// start starts the component process, an unexpected exit is reported to the failures channel
+func (c *component) start() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	logFile, err := os.OpenFile(c.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), c.env...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	err = cmd.Start()
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+
+	exited := make(chan struct{})
+	c.cmd, c.stopping, c.exited = cmd, false, exited
+	go func() {
+		err := cmd.Wait()
+		logFile.Close()
+
+		c.mutex.Lock()
+		stopping := c.stopping
+		c.mutex.Unlock()
+		close(exited)
+
+		if !stopping {
+			select {
+			case c.failures <- fmt.Errorf("%s exited unexpectedly: %v (log %s)", c.name, err, c.logFile):
+			default:
+			}
+		}
+	}()
+	return nil
+}
+
+// stop stops the component process with a signal, killing it if it doesn't exit in time
+func (c *component) stop(sig syscall.Signal) {
+	c.mutex.Lock()
+	cmd, exited := c.cmd, c.exited
+	if cmd == nil || c.stopping {
+		c.mutex.Unlock()
+		return
+	}
+	c.stopping = true
+	c.kills++
+	c.mutex.Unlock()
+
+	_ = cmd.Process.Signal(sig)
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// waitTotal waits for the server to write the total entries once its producer is stopped
+func waitTotal(t *testing.T, dir string, failures <-chan error) uint64 {
+	t.Helper()
+
+	for deadline := time.Now().Add(*settle); time.Now().Before(deadline); {
+		data, err := os.ReadFile(filepath.Join(dir, totalFileName))
+		if err == nil {
+			total, err := strconv.ParseUint(string(data), 10, 64)
+			require.NoError(t, err)
+			return total
+		}
+		require.True(t, errors.Is(err, os.ErrNotExist), err)
+		waitFailure(t, failures)
+	}
+	require.Fail(t, "timeout waiting for the server producer to stop")
+	return 0
+}
+
+// waitRecords waits for a client to record the entries up to the total
+func waitRecords(t *testing.T, fileName string, total uint64, failures <-chan error) {
+	t.Helper()
+
+	var size int64
+	for deadline := time.Now().Add(*settle); time.Now().Before(deadline); {
+		info, err := os.Stat(fileName)
+		if err == nil {
+			size = info.Size()
+			if uint64(size) >= total*recordSize {
+				return
+			}
+		}
+		waitFailure(t, failures)
+	}
+	require.Failf(t, "timeout waiting for the client entries", "%s recorded %d of %d entries", fileName,
+		size/recordSize, total)
+}
+
+// waitFailure waits a bit, failing the test if a component exited unexpectedly meanwhile
+func waitFailure(t *testing.T, failures <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-failures:
+		require.NoError(t, err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// checkRecords checks the entries recorded by a client are the entries up to the total, in order and once each, with
+// their payload. Returns the first mismatch found
+func checkRecords(records [][2]uint64, total uint64) error {
+	for i, r := range records {
+		switch {
+		case uint64(i) >= total:
+			return fmt.Errorf("entry %d recorded beyond the %d entries of the server", r[0], total)
+		case r[0] < uint64(i):
+			return fmt.Errorf("entry %d duplicated at record %d", r[0], i)
+		case r[0] > uint64(i):
+			return fmt.Errorf("entries %d-%d lost at record %d", i, r[0]-1, i)
+		case r[1] != r[0]:
+			return fmt.Errorf("entry %d with the payload of entry %d", r[0], r[1])
+		}
+	}
+	if uint64(len(records)) < total {
+		return fmt.Errorf("%d of %d entries recorded", len(records), total)
+	}
+	return nil
+}
+
+// readRecords reads the entry numbers and payload entry numbers recorded by a client
+func readRecords(t *testing.T, fileName string) [][2]uint64 {
+	t.Helper()
+
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	records := make([][2]uint64, 0, len(data)/recordSize)
+	for i := 0; i+recordSize <= len(data); i += recordSize {
+		records = append(records, [2]uint64{
+			binary.BigEndian.Uint64(data[i : i+8]),
+			binary.BigEndian.Uint64(data[i+8 : i+recordSize]),
+		})
+	}
+	return records
+}
@@ -0,0 +1,281 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+)
+
+const (
+	// Environment variables of the component processes
+	envRole   = "DS_E2E_ROLE"   // Role of the process: server, relay or client
+	envDir    = "DS_E2E_DIR"    // Working directory of the test
+	envName   = "DS_E2E_NAME"   // Name of the component, for its files
+	envPort   = "DS_E2E_PORT"   // Port exposed by the server and the relay
+	envServer = "DS_E2E_SERVER" // Server address the relay and the clients connect to
+
+	roleServer = "server"
+	roleRelay  = "relay"
+	roleClient = "client"
+
+	streamType        = datastreamer.StreamType(1)
+	entryType         = datastreamer.EntryType(1)
+	entriesPerOp      = 9                     // Data entries of each atomic operation, after its bookmark
+	rollbackEvery     = 7                     // Roll back one of every these atomic operations
+	opInterval        = 10 * time.Millisecond // Sleep between the atomic operations
+	drainTimeout      = 2 * time.Second       // Time to let the catch-ups finish on SIGTERM
+	inactivityTimeout = 120 * time.Second     // Timeout to kill an inactive client connection
+	payloadMarker     = 0xe2                  // First byte of the entries payload
+	payloadSize       = 9                     // Marker and entry number
+	recordSize        = 16                    // Entry number and payload entry number recorded by the clients
+	stopFileName      = "stop"                // File to stop the producer of the server
+	totalFileName     = "total"               // File with the total entries written by the server once stopped
+	unknownPayload    = ^uint64(0)            // Payload entry number recorded for a malformed payload
+)
+
+var logConfig = log.Config{
+	Environment: "production",
+	Level:       "info",
+	Outputs:     []string{"stdout"},
+}
+
+// runRole runs the component process of a role until it's killed or receives SIGTERM
+func runRole(role string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dir := os.Getenv(envDir)
+	name := os.Getenv(envName)
+	switch role {
+	case roleServer:
+		return runServer(ctx, dir, name)
+	case roleRelay:
+		return runRelay(ctx, dir, name)
+	case roleClient:
+		return runClient(ctx, dir, name)
+	default:
+		return fmt.Errorf("unknown role %s", role)
+	}
+}
+
+// payload returns the payload of an entry: the marker and the entry number
+func payload(entryNum uint64) []byte {
+	data := make([]byte, payloadSize)
+	data[0] = payloadMarker
+	binary.BigEndian.PutUint64(data[1:], entryNum)
+	return data
+}
+
+// payloadEntry returns the entry number of a payload (unknownPayload if malformed)
+func payloadEntry(data []byte) uint64 {
+	if len(data) != payloadSize || data[0] != payloadMarker {
+		return unknownPayload
+	}
+	return binary.BigEndian.Uint64(data[1:])
+}
+
+// port returns the port of the component process
+func port() (uint16, error) {
+	p, err := strconv.ParseUint(os.Getenv(envPort), 10, 16)
+	return uint16(p), err
+}
+
+// runServer runs the server, producing atomic operations of a bookmark and data entries (rolling back some of them)
+// until the stop file exists, then writes the total entries file and keeps serving
+func runServer(ctx context.Context, dir string, name string) error {
+	p, err := port()
+	if err != nil {
+		return err
+	}
+	s, err := datastreamer.NewServer(p, 1, 137, streamType, filepath.Join(dir, name+".bin"), 3*time.Second,
+		inactivityTimeout, 5*time.Second, &logConfig)
+	if err != nil {
+		return err
+	}
+	err = s.Start()
+	if err != nil {
+		return err
+	}
+
+	for op := 0; ctx.Err() == nil; op++ {
+		if _, err := os.Stat(filepath.Join(dir, stopFileName)); err == nil {
+			break
+		}
+		err = produce(s, op%rollbackEvery == rollbackEvery-1)
+		if err != nil {
+			return err
+		}
+		time.Sleep(opInterval)
+	}
+
+	if ctx.Err() == nil {
+		total := s.GetHeader().TotalEntries
+		err = writeFileAtomic(filepath.Join(dir, totalFileName), []byte(strconv.FormatUint(total, 10)))
+		if err != nil {
+			return err
+		}
+		log.Infof("Producer stopped at %d entries", total)
+		<-ctx.Done()
+	}
+	return s.Shutdown(drainTimeout)
+}
+
+// produce adds an atomic operation of a bookmark and data entries, with the entry number in their payloads
+func produce(s *datastreamer.StreamServer, rollback bool) error {
+	next := s.GetHeader().TotalEntries
+	err := s.StartAtomicOp()
+	if err != nil {
+		return err
+	}
+
+	entryNum, err := s.AddStreamBookmark(payload(next))
+	if err != nil {
+		return err
+	}
+	if entryNum != next {
+		return fmt.Errorf("bookmark added as entry %d, expected %d", entryNum, next)
+	}
+	for i := uint64(1); i <= entriesPerOp; i++ {
+		entryNum, err = s.AddStreamEntry(entryType, payload(next+i))
+		if err != nil {
+			return err
+		}
+		if entryNum != next+i {
+			return fmt.Errorf("entry added as %d, expected %d", entryNum, next+i)
+		}
+	}
+
+	if rollback {
+		return s.RollbackAtomicOp()
+	}
+	return s.CommitAtomicOp()
+}
+
+// runRelay runs the relay of the server
+func runRelay(ctx context.Context, dir string, name string) error {
+	p, err := port()
+	if err != nil {
+		return err
+	}
+	r, err := datastreamer.NewRelay(os.Getenv(envServer), p, 1, 137, streamType, filepath.Join(dir, name+".bin"),
+		3*time.Second, inactivityTimeout, 5*time.Second, &logConfig)
+	if err != nil {
+		return err
+	}
+	err = r.Start()
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	return r.Shutdown(drainTimeout)
+}
+
+// runClient runs a client streaming from the entry next to the latest one recorded, recording the entry number and
+// the payload entry number of each entry received
+func runClient(ctx context.Context, dir string, name string) error {
+	log.Init(logConfig)
+
+	file, from, err := openRecords(filepath.Join(dir, name+".rec"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c, err := datastreamer.NewClient(os.Getenv(envServer), streamType)
+	if err != nil {
+		return err
+	}
+	c.SetProcessEntryFunc(func(e *datastreamer.FileEntry, _ *datastreamer.StreamClient,
+		_ *datastreamer.StreamServer) error {
+		record := make([]byte, recordSize)
+		binary.BigEndian.PutUint64(record[:8], e.Number)
+		binary.BigEndian.PutUint64(record[8:], payloadEntry(e.Data))
+		_, err := file.Write(record)
+		return err
+	})
+	err = c.Start()
+	if err != nil {
+		return err
+	}
+
+	// Retry the start command, the reconnections restore the streaming once started
+	for {
+		err = c.ExecCommandStart(from)
+		if err == nil {
+			break
+		}
+		log.Warnf("Error starting the streaming from %d: %v", from, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+	log.Infof("Streaming from entry %d", from)
+
+	err = c.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// openRecords opens the records file of a client, dropping the partial record written if killed meanwhile, and
+// returns the entry to stream from: next to the latest one recorded
+func openRecords(fileName string) (*os.File, uint64, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	size := info.Size() - info.Size()%recordSize
+	err = file.Truncate(size)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	_, err = file.Seek(size, 0)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if size == 0 {
+		return file, 0, nil
+	}
+
+	record := make([]byte, recordSize)
+	_, err = file.ReadAt(record, size-recordSize)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, binary.BigEndian.Uint64(record[:8]) + 1, nil
+}
+
+// writeFileAtomic writes a file through a temporary one, so it's never read partially written
+func writeFileAtomic(fileName string, data []byte) error {
+	tmp := fileName + ".tmp"
+	err := os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, fileName)
+}
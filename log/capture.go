@@ -0,0 +1,161 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Entry is a log entry recorded by a capture or the ring buffer.
+type Entry struct {
+	Time    time.Time     `json:"time"`
+	Level   zapcore.Level `json:"level"`
+	Message string        `json:"message"`
+	Caller  string        `json:"caller,omitempty"`
+}
+
+// Capture records the log entries from its start until it's stopped, so
+// tests can assert on the logged paths.
+type Capture struct {
+	mutex   sync.Mutex
+	entries []Entry
+}
+
+// recorder keeps the active captures and the ring buffer of recent entries.
+type recorder struct {
+	mutex    sync.Mutex
+	captures map[*Capture]struct{}
+	ring     []Entry
+	next     int  // Position in the ring of the next entry
+	full     bool // Flag the ring has wrapped around
+}
+
+var rec = recorder{captures: make(map[*Capture]struct{})}
+
+// StartCapture starts recording the log entries of the root logger (and the
+// loggers derived from it) that pass its level.
+func StartCapture() *Capture {
+	c := &Capture{}
+	rec.mutex.Lock()
+	rec.captures[c] = struct{}{}
+	rec.mutex.Unlock()
+	return c
+}
+
+// Stop stops recording log entries. The entries recorded are kept.
+func (c *Capture) Stop() {
+	rec.mutex.Lock()
+	delete(rec.captures, c)
+	rec.mutex.Unlock()
+}
+
+// Entries returns the log entries recorded.
+func (c *Capture) Entries() []Entry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]Entry{}, c.entries...)
+}
+
+// Contains checks if a log entry of the level containing substr was recorded.
+func (c *Capture) Contains(level zapcore.Level, substr string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, e := range c.entries {
+		if e.Level == level && strings.Contains(e.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRingBuffer keeps the latest size log entries in a ring buffer, returned
+// by RecentEntries. A size of 0 disables it.
+func SetRingBuffer(size int) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.ring = make([]Entry, size)
+	rec.next = 0
+	rec.full = false
+}
+
+// RecentEntries returns the log entries in the ring buffer, oldest first.
+func RecentEntries() []Entry {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if !rec.full {
+		return append([]Entry{}, rec.ring[:rec.next]...)
+	}
+	entries := make([]Entry, 0, len(rec.ring))
+	entries = append(entries, rec.ring[rec.next:]...)
+	return append(entries, rec.ring[:rec.next]...)
+}
+
+// Handler returns an HTTP handler serving the log entries in the ring buffer
+// in JSON format. The optional query parameter "level" filters the entries
+// with a lower level (e.g. ?level=warn).
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minLevel := zapcore.DebugLevel
+		if level := r.URL.Query().Get("level"); level != "" {
+			err := minLevel.UnmarshalText([]byte(level))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries := []Entry{}
+		for _, e := range RecentEntries() {
+			if e.Level >= minLevel {
+				entries = append(entries, e)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(entries)
+	})
+}
+
+// record is the logger hook recording the log entries in the active captures
+// and the ring buffer.
+func record(ze zapcore.Entry) error {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if len(rec.captures) == 0 && len(rec.ring) == 0 {
+		return nil
+	}
+
+	e := Entry{
+		Time:    ze.Time,
+		Level:   ze.Level,
+		Message: ze.Message,
+	}
+	if ze.Caller.Defined {
+		e.Caller = ze.Caller.TrimmedPath()
+	}
+
+	for c := range rec.captures {
+		c.mutex.Lock()
+		c.entries = append(c.entries, e)
+		c.mutex.Unlock()
+	}
+
+	if len(rec.ring) > 0 {
+		rec.ring[rec.next] = e
+		rec.next++
+		if rec.next == len(rec.ring) {
+			rec.next = 0
+			rec.full = true
+		}
+	}
+	return nil
+}
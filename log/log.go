@@ -94,7 +94,8 @@ func NewLogger(cfg Config) (*zap.SugaredLogger, *zap.AtomicLevel, error) {
 	defer logger.Sync() //nolint:errcheck
 
 	// skip 2 callers: one for our wrapper methods and one for the package functions
-	withOptions := logger.WithOptions(zap.AddCallerSkip(2)) //nolint:mnd
+	// record the entries for the captures and the ring buffer
+	withOptions := logger.WithOptions(zap.AddCallerSkip(2), zap.Hooks(record)) //nolint:mnd
 	return withOptions.Sugar(), &level, nil
 }
 
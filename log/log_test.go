@@ -1,12 +1,15 @@
 package log
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/hermeznetwork/tracerr"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestLogNotInitialized(t *testing.T) {
@@ -124,3 +127,65 @@ func TestAppendStackTraceMaybeKV(t *testing.T) {
 	result = appendStackTraceMaybeKV(msg, kv)
 	assert.Equal(t, msg, result, "Expected message to be unchanged when error is at an odd index")
 }
+
+func TestCapture(t *testing.T) {
+	Init(Config{
+		Environment: EnvironmentDevelopment,
+		Level:       "info",
+		Outputs:     []string{"stderr"},
+	})
+
+	Warnf("Test before capture %d", 1)
+	capture := StartCapture()
+	Debugf("Test debug not logged %d", 2)
+	Infof("Test capture %d", 3)
+	WithFields("field", "value").Warnf("Test capture warning %d", 4)
+	capture.Stop()
+	Warnf("Test after capture %d", 5)
+
+	entries := capture.Entries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+	assert.Equal(t, "Test capture 3", entries[0].Message)
+	assert.Contains(t, entries[0].Caller, "log/log_test.go")
+	assert.True(t, capture.Contains(zapcore.WarnLevel, "capture warning 4"))
+	assert.False(t, capture.Contains(zapcore.InfoLevel, "capture warning 4"))
+	assert.False(t, capture.Contains(zapcore.WarnLevel, "after capture"))
+}
+
+func TestRingBuffer(t *testing.T) {
+	Init(Config{
+		Environment: EnvironmentDevelopment,
+		Level:       "info",
+		Outputs:     []string{"stderr"},
+	})
+	SetRingBuffer(3)
+	defer SetRingBuffer(0)
+
+	Infof("Test ring %d", 1)
+	assert.Len(t, RecentEntries(), 1)
+	for i := 2; i <= 5; i++ {
+		Infof("Test ring %d", i)
+	}
+	Warnf("Test ring %d", 6)
+
+	entries := RecentEntries()
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "Test ring 4", entries[0].Message)
+	assert.Equal(t, "Test ring 6", entries[2].Message)
+
+	// Case: HTTP handler filtered by level
+	rsp := httptest.NewRecorder()
+	Handler().ServeHTTP(rsp, httptest.NewRequest("GET", "/logs?level=warn", nil))
+	assert.Equal(t, 200, rsp.Code)
+	var served []Entry
+	assert.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &served))
+	assert.Len(t, served, 1)
+	assert.Equal(t, "Test ring 6", served[0].Message)
+	assert.Equal(t, zapcore.WarnLevel, served[0].Level)
+
+	// Case: HTTP handler invalid level
+	rsp = httptest.NewRecorder()
+	Handler().ServeHTTP(rsp, httptest.NewRequest("GET", "/logs?level=bad", nil))
+	assert.Equal(t, 400, rsp.Code)
+}
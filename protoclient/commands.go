@@ -0,0 +1,353 @@
+package protoclient
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+)
+
+// Command is a typed command of the stream protocol, encoded by its code and its parameters
+type Command interface {
+	Code() datastreamer.Command // Command code, with the flags (e.g. CmdFlagVersioned) but the tagged one
+	Params() []byte             // Encoded parameters sent after the stream type (and the tag)
+}
+
+// Encode encodes a command to binary bytes: the command code, the stream type, the tag (if not zero, with the
+// CmdFlagTagged flag) and the parameters
+func Encode(cmd Command, streamType datastreamer.StreamType, tag uint64) []byte {
+	code := cmd.Code()
+	if tag != 0 {
+		code |= datastreamer.CmdFlagTagged
+	}
+	params := cmd.Params()
+	b := make([]byte, 0, 8+8+8+len(params)) //nolint:mnd
+	b = binary.BigEndian.AppendUint64(b, uint64(code))
+	b = binary.BigEndian.AppendUint64(b, uint64(streamType))
+	if tag != 0 {
+		b = binary.BigEndian.AppendUint64(b, tag)
+	}
+	return append(b, params...)
+}
+
+// Start command to stream from an entry number
+type Start struct {
+	FromEntry uint64
+}
+
+// Stop command to stop the streaming
+type Stop struct{}
+
+// Header command to get the stream header, followed by the server protocol version if versioned
+type Header struct {
+	Versioned bool
+}
+
+// StartBookmark command to stream from a bookmark
+type StartBookmark struct {
+	Bookmark []byte
+}
+
+// Entry command to get a data entry by its number
+type Entry struct {
+	Number uint64
+}
+
+// Bookmark command to get the data entry of a bookmark
+type Bookmark struct {
+	Bookmark []byte
+}
+
+// Mux command to switch the connection to a multiplexed one
+type Mux struct{}
+
+// Stats command to get the server statistics
+type Stats struct{}
+
+// StartShard command to stream from an entry number the entries of a shard (tagged)
+type StartShard struct {
+	FromEntry uint64
+	Shard     uint32
+	Shards    uint32
+}
+
+// HeaderChanges command to get the header changes recorded from a change number
+type HeaderChanges struct {
+	FromChange uint64
+}
+
+// CheckpointProof command to get the checkpoint proof of a data entry
+type CheckpointProof struct {
+	Number uint64
+}
+
+// EntriesByTime command to get the entries range of a time window
+type EntriesByTime struct {
+	From time.Time
+	To   time.Time
+}
+
+// WatchBookmarks command to watch from an entry number the bookmarks of a prefix (tagged)
+type WatchBookmarks struct {
+	FromEntry uint64
+	Prefix    []byte
+}
+
+// Schemas command to get the payload schemas served
+type Schemas struct{}
+
+// Auth command to authenticate with credentials
+type Auth struct {
+	Credentials []byte
+}
+
+// StartGroup command to stream from an entry number joining a consumer group (tagged)
+type StartGroup struct {
+	FromEntry uint64
+	Group     string
+}
+
+// CommitGroup command to commit the next entry number to a consumer group (tagged)
+type CommitGroup struct {
+	NextEntry uint64
+}
+
+// CommitPosition command to store the next entry number of the client with a key
+type CommitPosition struct {
+	NextEntry uint64
+	Key       string
+}
+
+// GetPosition command to get the client position stored with a key
+type GetPosition struct {
+	Key string
+}
+
+// EntryRange command to get up to count consecutive entries from an entry number
+type EntryRange struct {
+	FromEntry uint64
+	Count     uint32
+}
+
+// EntryTypes command to set the entry types streamed (all if empty)
+type EntryTypes struct {
+	Types []datastreamer.EntryType
+}
+
+// LatestStates command to get the latest bookmarks of a prefix
+type LatestStates struct {
+	Prefix []byte
+}
+
+// Compression command to set the compression codec of the streamed entries
+type Compression struct {
+	Codec datastreamer.Compression
+}
+
+// Ping command answered with a Pong packet
+type Ping struct{}
+
+// Checksum command to set the checksum algorithm of the streamed entries
+type Checksum struct {
+	Algorithm datastreamer.Checksum
+}
+
+// Raw command with any code and parameters, e.g. unknown commands or malformed parameters
+type Raw struct {
+	Command datastreamer.Command
+	Data    []byte
+}
+
+// Code returns the command code
+func (Start) Code() datastreamer.Command { return datastreamer.CmdStart }
+
+// Params returns the encoded from entry number
+func (c Start) Params() []byte { return uint64Param(c.FromEntry) }
+
+// Code returns the command code
+func (Stop) Code() datastreamer.Command { return datastreamer.CmdStop }
+
+// Params returns no parameters
+func (Stop) Params() []byte { return nil }
+
+// Code returns the command code, with the CmdFlagVersioned flag if versioned
+func (c Header) Code() datastreamer.Command {
+	if c.Versioned {
+		return datastreamer.CmdHeader | datastreamer.CmdFlagVersioned
+	}
+	return datastreamer.CmdHeader
+}
+
+// Params returns no parameters
+func (Header) Params() []byte { return nil }
+
+// Code returns the command code
+func (StartBookmark) Code() datastreamer.Command { return datastreamer.CmdStartBookmark }
+
+// Params returns the encoded bookmark
+func (c StartBookmark) Params() []byte { return bytesParam(nil, c.Bookmark) }
+
+// Code returns the command code
+func (Entry) Code() datastreamer.Command { return datastreamer.CmdEntry }
+
+// Params returns the encoded entry number
+func (c Entry) Params() []byte { return uint64Param(c.Number) }
+
+// Code returns the command code
+func (Bookmark) Code() datastreamer.Command { return datastreamer.CmdBookmark }
+
+// Params returns the encoded bookmark
+func (c Bookmark) Params() []byte { return bytesParam(nil, c.Bookmark) }
+
+// Code returns the command code
+func (Mux) Code() datastreamer.Command { return datastreamer.CmdMux }
+
+// Params returns no parameters
+func (Mux) Params() []byte { return nil }
+
+// Code returns the command code
+func (Stats) Code() datastreamer.Command { return datastreamer.CmdStats }
+
+// Params returns no parameters
+func (Stats) Params() []byte { return nil }
+
+// Code returns the command code
+func (StartShard) Code() datastreamer.Command { return datastreamer.CmdStartShard }
+
+// Params returns the encoded from entry number and shard
+func (c StartShard) Params() []byte {
+	b := binary.BigEndian.AppendUint32(uint64Param(c.FromEntry), c.Shard)
+	return binary.BigEndian.AppendUint32(b, c.Shards)
+}
+
+// Code returns the command code
+func (HeaderChanges) Code() datastreamer.Command { return datastreamer.CmdHeaderChanges }
+
+// Params returns the encoded from change number
+func (c HeaderChanges) Params() []byte { return uint64Param(c.FromChange) }
+
+// Code returns the command code
+func (CheckpointProof) Code() datastreamer.Command { return datastreamer.CmdCheckpointProof }
+
+// Params returns the encoded entry number
+func (c CheckpointProof) Params() []byte { return uint64Param(c.Number) }
+
+// Code returns the command code
+func (EntriesByTime) Code() datastreamer.Command { return datastreamer.CmdEntriesByTime }
+
+// Params returns the encoded from and to times
+func (c EntriesByTime) Params() []byte {
+	return binary.BigEndian.AppendUint64(uint64Param(timeParam(c.From)), timeParam(c.To))
+}
+
+// Code returns the command code
+func (WatchBookmarks) Code() datastreamer.Command { return datastreamer.CmdWatchBookmarks }
+
+// Params returns the encoded from entry number and bookmarks prefix
+func (c WatchBookmarks) Params() []byte { return bytesParam(uint64Param(c.FromEntry), c.Prefix) }
+
+// Code returns the command code
+func (Schemas) Code() datastreamer.Command { return datastreamer.CmdSchemas }
+
+// Params returns no parameters
+func (Schemas) Params() []byte { return nil }
+
+// Code returns the command code
+func (Auth) Code() datastreamer.Command { return datastreamer.CmdAuth }
+
+// Params returns the encoded credentials
+func (c Auth) Params() []byte { return bytesParam(nil, c.Credentials) }
+
+// Code returns the command code
+func (StartGroup) Code() datastreamer.Command { return datastreamer.CmdStartGroup }
+
+// Params returns the encoded from entry number and group name
+func (c StartGroup) Params() []byte { return bytesParam(uint64Param(c.FromEntry), []byte(c.Group)) }
+
+// Code returns the command code
+func (CommitGroup) Code() datastreamer.Command { return datastreamer.CmdCommitGroup }
+
+// Params returns the encoded next entry number
+func (c CommitGroup) Params() []byte { return uint64Param(c.NextEntry) }
+
+// Code returns the command code
+func (CommitPosition) Code() datastreamer.Command { return datastreamer.CmdCommitPosition }
+
+// Params returns the encoded next entry number and key
+func (c CommitPosition) Params() []byte { return bytesParam(uint64Param(c.NextEntry), []byte(c.Key)) }
+
+// Code returns the command code
+func (GetPosition) Code() datastreamer.Command { return datastreamer.CmdGetPosition }
+
+// Params returns the encoded key
+func (c GetPosition) Params() []byte { return bytesParam(nil, []byte(c.Key)) }
+
+// Code returns the command code
+func (EntryRange) Code() datastreamer.Command { return datastreamer.CmdEntryRange }
+
+// Params returns the encoded from entry number and number of entries
+func (c EntryRange) Params() []byte {
+	return binary.BigEndian.AppendUint32(uint64Param(c.FromEntry), c.Count)
+}
+
+// Code returns the command code
+func (EntryTypes) Code() datastreamer.Command { return datastreamer.CmdEntryTypes }
+
+// Params returns the encoded number of entry types and entry types
+func (c EntryTypes) Params() []byte {
+	b := make([]byte, 0, 4+4*len(c.Types)) //nolint:mnd
+	b = binary.BigEndian.AppendUint32(b, uint32(len(c.Types)))
+	for _, entryType := range c.Types {
+		b = binary.BigEndian.AppendUint32(b, uint32(entryType))
+	}
+	return b
+}
+
+// Code returns the command code
+func (LatestStates) Code() datastreamer.Command { return datastreamer.CmdLatestStates }
+
+// Params returns the encoded bookmarks prefix
+func (c LatestStates) Params() []byte { return bytesParam(nil, c.Prefix) }
+
+// Code returns the command code
+func (Compression) Code() datastreamer.Command { return datastreamer.CmdCompression }
+
+// Params returns the encoded compression codec
+func (c Compression) Params() []byte { return binary.BigEndian.AppendUint32(nil, uint32(c.Codec)) }
+
+// Code returns the command code
+func (Ping) Code() datastreamer.Command { return datastreamer.CmdPing }
+
+// Params returns no parameters
+func (Ping) Params() []byte { return nil }
+
+// Code returns the command code
+func (Checksum) Code() datastreamer.Command { return datastreamer.CmdChecksum }
+
+// Params returns the encoded checksum algorithm
+func (c Checksum) Params() []byte { return binary.BigEndian.AppendUint32(nil, uint32(c.Algorithm)) }
+
+// Code returns the command code
+func (c Raw) Code() datastreamer.Command { return c.Command }
+
+// Params returns the raw parameters
+func (c Raw) Params() []byte { return c.Data }
+
+// uint64Param encodes a uint64 command parameter
+func uint64Param(value uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, value)
+}
+
+// bytesParam appends to the parameters a bytes parameter prefixed by its length
+func bytesParam(b []byte, value []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(value)))
+	return append(b, value...)
+}
+
+// timeParam encodes a time command parameter (unix time in ns, 0 for the times before 1970)
+func timeParam(t time.Time) uint64 {
+	if t.Before(time.Unix(0, 0)) {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
@@ -0,0 +1,267 @@
+// Package protoclient is a low-level client of the data stream protocol: it sends typed commands and reads the
+// frames of the server as received, without the negotiations, reconnections and middlewares of the StreamClient, so
+// the advanced users and the conformance tools can exercise the edge cases of the protocol
+package protoclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
+)
+
+const defaultTimeout = 5 * time.Second // Default timeout for the writes and the reads
+
+var (
+	// ErrUnexpectedFrame is returned when the frame received is not of the packet type expected
+	ErrUnexpectedFrame = errors.New("unexpected frame")
+	// ErrUnexpectedResult is returned when the command result received is not the error expected
+	ErrUnexpectedResult = errors.New("unexpected command result")
+	// ErrNotClosed is returned when the connection is not closed by the server
+	ErrNotClosed = errors.New("connection not closed by the server")
+)
+
+// Conn type for a raw protocol connection to a server
+type Conn struct {
+	net.Conn
+	StreamType datastreamer.StreamType // Stream type sent with the commands
+	Timeout    time.Duration           // Timeout for each write and read (0=no timeout)
+}
+
+// Frame type for a frame received from the server, decoded by its packet type
+type Frame struct {
+	PacketType uint8         // Packet type (of the inner packet of a tagged frame)
+	Tag        uint64        // Tag of a tagged frame (0 if not tagged)
+	Header     *codec.Header // Header entry (PtHeader)
+	Entry      *codec.Entry  // Data entry (PtData, PtDataRsp, PtCompressed with its data compressed)
+	Result     *codec.Result // Command result (PtResult)
+	Payload    []byte        // Payload of a custom frame (private packet types)
+}
+
+// Dial opens a new connection to the server, with the default timeout if 0
+func Dial(address string, streamType datastreamer.StreamType, timeout time.Duration) (*Conn, error) {
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	c, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(c, streamType, timeout), nil
+}
+
+// NewConn creates a raw protocol connection over an established connection (e.g. TLS or a multiplexed stream)
+func NewConn(c net.Conn, streamType datastreamer.StreamType, timeout time.Duration) *Conn {
+	return &Conn{
+		Conn:       c,
+		StreamType: streamType,
+		Timeout:    timeout,
+	}
+}
+
+// SendCommand sends a command with the stream type of the connection
+func (c *Conn) SendCommand(cmd Command) error {
+	return c.WriteRaw(Encode(cmd, c.StreamType, 0))
+}
+
+// SendTagged sends a command tagged with a subscription/request ID (not zero)
+func (c *Conn) SendTagged(tag uint64, cmd Command) error {
+	return c.WriteRaw(Encode(cmd, c.StreamType, tag))
+}
+
+// WriteRaw writes raw bytes to the connection, e.g. a truncated command
+func (c *Conn) WriteRaw(b []byte) error {
+	err := c.SetWriteDeadline(c.deadline())
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(b)
+	return err
+}
+
+// ReadRaw reads exactly len(b) bytes from the connection, e.g. the protocol version after a versioned header
+func (c *Conn) ReadRaw(b []byte) error {
+	err := c.SetReadDeadline(c.deadline())
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(c, b)
+	return err
+}
+
+// ReadFrame reads and decodes the next frame received, unwrapping it if it's a tagged frame
+func (c *Conn) ReadFrame() (Frame, error) {
+	f := Frame{}
+	b := make([]byte, 1)
+	err := c.ReadRaw(b)
+	if err != nil {
+		return f, err
+	}
+	if b[0] == datastreamer.PtTagged {
+		b = make([]byte, codec.FixedSizeTaggedFrame)
+		err = c.ReadRaw(b)
+		if err != nil {
+			return f, err
+		}
+		f.Tag = binary.BigEndian.Uint64(b[0:8])
+		switch b[8] {
+		case datastreamer.PtHeader, datastreamer.PtData, datastreamer.PtDataRsp, datastreamer.PtResult:
+		default:
+			return f, fmt.Errorf("%w: packet type %d", codec.ErrInvalidTaggedFrame, b[8])
+		}
+		b = b[8:]
+	}
+	f.PacketType = b[0]
+
+	switch {
+	case f.PacketType == datastreamer.PtShutdown || f.PacketType == datastreamer.PtReconnect ||
+		f.PacketType == datastreamer.PtPong:
+		return f, nil
+	case f.PacketType == datastreamer.PtHeader || f.PacketType == datastreamer.PtData ||
+		f.PacketType == datastreamer.PtDataRsp || f.PacketType == datastreamer.PtCompressed ||
+		f.PacketType == datastreamer.PtResult || codec.IsPrivatePacketType(f.PacketType):
+	default:
+		return f, fmt.Errorf("%w: packet type %d", codec.ErrUnknownPacketType, f.PacketType)
+	}
+
+	// Read the rest of the packet by its length
+	length := make([]byte, 4) //nolint:mnd
+	err = c.ReadRaw(length)
+	if err != nil {
+		return f, err
+	}
+	size := binary.BigEndian.Uint32(length)
+	if size < 1+4 {
+		return f, fmt.Errorf("%w: packet type %d length %d", codec.ErrIncompletePacket, f.PacketType, size)
+	}
+	packet := make([]byte, size)
+	packet[0] = f.PacketType
+	copy(packet[1:5], length)
+	err = c.ReadRaw(packet[5:])
+	if err != nil {
+		return f, err
+	}
+
+	switch f.PacketType {
+	case datastreamer.PtHeader:
+		var header codec.Header
+		header, err = codec.DecodeHeader(packet)
+		f.Header = &header
+	case datastreamer.PtData, datastreamer.PtDataRsp, datastreamer.PtCompressed:
+		var entry codec.Entry
+		entry, err = codec.DecodeEntry(packet)
+		f.Entry = &entry
+	case datastreamer.PtResult:
+		var result codec.Result
+		result, err = codec.DecodeResult(packet)
+		f.Result = &result
+	default:
+		f.Payload = packet[codec.FixedSizeCustomFrame:]
+	}
+	return f, err
+}
+
+// ReadResult reads the next command result, skipping the data entries streamed before it
+func (c *Conn) ReadResult() (codec.Result, error) {
+	for {
+		f, err := c.ReadFrame()
+		if err != nil {
+			return codec.Result{}, err
+		}
+		switch f.PacketType {
+		case datastreamer.PtData, datastreamer.PtCompressed:
+		case datastreamer.PtResult:
+			return *f.Result, nil
+		default:
+			return codec.Result{}, fmt.Errorf("%w: packet type %d, expected result", ErrUnexpectedFrame, f.PacketType)
+		}
+	}
+}
+
+// ExpectResult reads the next command result and checks its error number
+func (c *Conn) ExpectResult(expected datastreamer.CommandError) error {
+	r, err := c.ReadResult()
+	if err != nil {
+		return err
+	}
+	if r.ErrorNum != uint32(expected) {
+		return fmt.Errorf("%w: %d[%s], expected %d", ErrUnexpectedResult, r.ErrorNum, r.ErrorStr, expected)
+	}
+	return nil
+}
+
+// ReadHeader reads the next frame, it must be a header entry
+func (c *Conn) ReadHeader() (codec.Header, error) {
+	f, err := c.expectFrame(datastreamer.PtHeader)
+	if err != nil {
+		return codec.Header{}, err
+	}
+	return *f.Header, nil
+}
+
+// ReadProtocolVersion reads the server protocol version sent after the header of a versioned Header command
+func (c *Conn) ReadProtocolVersion() (uint32, error) {
+	b := make([]byte, 4) //nolint:mnd
+	err := c.ReadRaw(b)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// ReadEntry reads the next frame, it must be a data entry of the packet type expected
+func (c *Conn) ReadEntry(packetType uint8) (codec.Entry, error) {
+	f, err := c.expectFrame(packetType)
+	if err != nil {
+		return codec.Entry{}, err
+	}
+	if f.Entry == nil {
+		return codec.Entry{}, fmt.Errorf("%w: packet type %d is not a data entry", ErrUnexpectedFrame, packetType)
+	}
+	return *f.Entry, nil
+}
+
+// ExpectClosed reads until the server closes the connection, ErrNotClosed if a read times out
+func (c *Conn) ExpectClosed() error {
+	b := make([]byte, 1)
+	for {
+		err := c.ReadRaw(b)
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || isReset(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrNotClosed, err)
+		}
+	}
+}
+
+// expectFrame reads the next frame, it must be of the packet type expected
+func (c *Conn) expectFrame(packetType uint8) (Frame, error) {
+	f, err := c.ReadFrame()
+	if err != nil {
+		return f, err
+	}
+	if f.PacketType != packetType {
+		return f, fmt.Errorf("%w: packet type %d, expected %d", ErrUnexpectedFrame, f.PacketType, packetType)
+	}
+	return f, nil
+}
+
+// deadline returns the deadline of a write or a read (none without timeout)
+func (c *Conn) deadline() time.Time {
+	if c.Timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.Timeout)
+}
+
+// isReset checks if the error is a connection reset by the server
+func isReset(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && !opErr.Timeout()
+}
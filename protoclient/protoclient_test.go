@@ -0,0 +1,120 @@
+package protoclient_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/log"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/protoclient"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPort       = 6970
+	testStreamType = datastreamer.StreamType(1)
+)
+
+func TestConn(t *testing.T) {
+	logConfig := log.Config{
+		Environment: "development",
+		Level:       "error",
+		Outputs:     []string{"stdout"},
+	}
+	s, err := datastreamer.NewServer(testPort, 1, 137, testStreamType, filepath.Join(t.TempDir(), "protoclient.bin"),
+		3*time.Second, 0, 5*time.Second, &logConfig)
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	defer func() { _ = s.Shutdown(0) }()
+
+	require.NoError(t, s.StartAtomicOp())
+	_, err = s.AddStreamBookmark([]byte{0, 1})
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = s.AddStreamEntry(1, bytes.Repeat([]byte{byte(i)}, 256))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.CommitAtomicOp())
+
+	address := fmt.Sprintf("localhost:%d", testPort)
+	c, err := protoclient.Dial(address, testStreamType, 2*time.Second)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	// Case: Versioned header -> Header and protocol version
+	require.NoError(t, c.SendCommand(protoclient.Header{Versioned: true}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrOK))
+	h, err := c.ReadHeader()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), h.TotalEntries)
+	require.Equal(t, uint64(testStreamType), h.StreamType)
+	protocol, err := c.ReadProtocolVersion()
+	require.NoError(t, err)
+	require.Equal(t, datastreamer.ProtocolVersion, protocol)
+
+	// Case: Tagged entry query -> Frames tagged with the request ID
+	require.NoError(t, c.SendTagged(7, protoclient.Entry{Number: 2}))
+	f, err := c.ReadFrame()
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), f.Tag)
+	require.Equal(t, uint8(datastreamer.PtResult), f.PacketType)
+	require.Zero(t, f.Result.ErrorNum)
+	f, err = c.ReadFrame()
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), f.Tag)
+	require.Equal(t, uint8(datastreamer.PtDataRsp), f.PacketType)
+	require.Equal(t, uint64(2), f.Entry.Number)
+
+	// Case: Ping -> Pong packet
+	require.NoError(t, c.SendCommand(protoclient.Ping{}))
+	f, err = c.ReadFrame()
+	require.NoError(t, err)
+	require.Equal(t, uint8(datastreamer.PtPong), f.PacketType)
+
+	// Case: Unknown command -> Invalid command result, an unexpected result if expecting OK
+	require.NoError(t, c.SendCommand(protoclient.Raw{Command: datastreamer.Command(0xff)}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrInvalidCommand))
+	require.NoError(t, c.SendCommand(protoclient.Raw{Command: datastreamer.Command(0xff)}))
+	require.ErrorIs(t, c.ExpectResult(datastreamer.CmdErrOK), protoclient.ErrUnexpectedResult)
+
+	// Case: Compressed streaming from a bookmark -> Bookmark and entries with their data compressed, stop
+	require.NoError(t, c.SendCommand(protoclient.Compression{Codec: datastreamer.CompressionSnappy}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrOK))
+	require.NoError(t, c.SendCommand(protoclient.StartBookmark{Bookmark: []byte{0, 1}}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrOK))
+	e, err := c.ReadEntry(datastreamer.PtData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(datastreamer.EtBookmark), e.Type)
+	for i := uint64(1); i < 5; i++ {
+		e, err = c.ReadEntry(datastreamer.PtCompressed)
+		require.NoError(t, err)
+		require.Equal(t, i, e.Number)
+		require.Less(t, len(e.Data), 256)
+	}
+	require.NoError(t, c.SendCommand(protoclient.Stop{}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrOK))
+
+	// Case: Streaming with checksums -> Bookmark with the CRC-32 of its type, number and data appended
+	require.NoError(t, c.SendCommand(protoclient.Checksum{Algorithm: datastreamer.ChecksumCRC32}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrOK))
+	require.NoError(t, c.SendCommand(protoclient.StartBookmark{Bookmark: []byte{0, 1}}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrOK))
+	e, err = c.ReadEntry(datastreamer.PtData)
+	require.NoError(t, err)
+	require.Len(t, e.Data, 2+datastreamer.ChecksumSize)
+	table := crc32.MakeTable(crc32.Castagnoli)
+	checksum := crc32.Update(crc32.Checksum(binary.BigEndian.AppendUint64(
+		binary.BigEndian.AppendUint32(nil, e.Type), e.Number), table), table, e.Data[:2])
+	require.Equal(t, checksum, binary.BigEndian.Uint32(e.Data[2:]))
+	require.NoError(t, c.SendCommand(protoclient.Stop{}))
+	require.NoError(t, c.ExpectResult(datastreamer.CmdErrOK))
+
+	// Case: Command with a different stream type -> Connection closed by the server
+	require.NoError(t, c.WriteRaw(protoclient.Encode(protoclient.Header{}, testStreamType+1, 0)))
+	require.NoError(t, c.ExpectClosed())
+}
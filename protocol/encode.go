@@ -0,0 +1,149 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the encoded specification
+const (
+	FormatJSON     = "json"     // FormatJSON for the machine-readable description in JSON
+	FormatYAML     = "yaml"     // FormatYAML for the machine-readable description in YAML, same fields as JSON
+	FormatMarkdown = "markdown" // FormatMarkdown for the reference documentation in Markdown tables
+)
+
+// GeneratedFiles is the format of each file generated by go generate in the package directory
+var GeneratedFiles = map[string]string{
+	"spec.json": FormatJSON,
+	"spec.yaml": FormatYAML,
+	"SPEC.md":   FormatMarkdown,
+}
+
+// ErrUnknownFormat is returned when the format of the encoded specification is unknown
+var ErrUnknownFormat = errors.New("unknown specification format")
+
+// Encode returns the specification encoded in a format (FormatJSON, FormatYAML or FormatMarkdown)
+func (s Specification) Encode(format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatYAML:
+		return s.encodeYAML()
+	case FormatMarkdown:
+		return s.encodeMarkdown(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// encodeYAML encodes the specification in YAML from its JSON encoding, keeping the field names and their order
+func (s Specification) encodeYAML() ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	err = yaml.Unmarshal(data, &node)
+	if err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2) //nolint:mnd
+	err = encoder.Encode(&node)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// blockStyle resets the style of the nodes parsed from JSON (flow collections, quoted strings) to the default one
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// encodeMarkdown encodes the specification as Markdown tables
+func (s Specification) encodeMarkdown() []byte {
+	var b strings.Builder
+	b.WriteString("# DATA STREAM PROTOCOL SPECIFICATION\n")
+	b.WriteString("Generated from the Go definitions by `go generate ./protocol`, do not edit.\n\n")
+	fmt.Fprintf(&b, "Protocol version: %d\n", s.Version)
+
+	rows := [][]string{}
+	for _, v := range s.Versions {
+		rows = append(rows, []string{fmt.Sprint(v.Number), v.Name})
+	}
+	writeTable(&b, "Versions", []string{"Number", "Name"}, rows)
+	writeTable(&b, "Sizes (bytes)", []string{"Name", "Size"}, fieldRows(s.Sizes))
+	writeTable(&b, "Limits", []string{"Name", "Value"}, fieldRows(s.Limits))
+
+	rows = [][]string{}
+	for _, c := range s.Commands {
+		rows = append(rows, []string{fmt.Sprint(c.Code), c.Name, fmt.Sprint(c.Version), fmt.Sprint(c.Taggable),
+			fmt.Sprint(c.TaggedOnly)})
+	}
+	writeTable(&b, "Commands", []string{"Code", "Name", "Version", "Taggable", "Tagged only"}, rows)
+	writeTable(&b, "Command flags", []string{"Bit", "Name"}, valueRows(s.CommandFlags, "0x%016x"))
+	writeTable(&b, "Command errors", []string{"Code", "Name"}, valueRows(s.CommandErrors, "%d"))
+
+	rows = [][]string{}
+	for _, p := range s.PacketTypes {
+		rows = append(rows, []string{fmt.Sprintf("0x%02x", p.Code), p.Name, fmt.Sprint(p.Stored)})
+	}
+	rows = append(rows, []string{fmt.Sprintf("0x%02x..0x%02x", s.PrivateRange.First, s.PrivateRange.Last),
+		"Private (custom frames)", "false"})
+	writeTable(&b, "Packet types", []string{"Code", "Name", "Stored"}, rows)
+	writeTable(&b, "Reserved entry types", []string{"Code", "Name"}, valueRows(s.EntryTypes, "0x%x"))
+	writeTable(&b, "Compressions", []string{"Code", "Name"}, valueRows(s.Compressions, "%d"))
+	writeTable(&b, "Checksums", []string{"Code", "Name"}, valueRows(s.Checksums, "%d"))
+	return []byte(b.String())
+}
+
+// writeTable writes a Markdown section with a table
+func writeTable(b *strings.Builder, title string, header []string, rows [][]string) {
+	fmt.Fprintf(b, "\n## %s\n", title)
+	fmt.Fprintf(b, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(b, "|%s\n", strings.Repeat(" --- |", len(header)))
+	for _, row := range rows {
+		fmt.Fprintf(b, "| %s |\n", strings.Join(row, " | "))
+	}
+}
+
+// valueRows returns the rows of the values of an enumeration, with the codes formatted
+func valueRows(values []Value, codeFormat string) [][]string {
+	rows := make([][]string, 0, len(values))
+	for _, v := range values {
+		rows = append(rows, []string{fmt.Sprintf(codeFormat, v.Code), v.Name})
+	}
+	return rows
+}
+
+// fieldRows returns the rows of the fields of a struct, by their JSON name
+func fieldRows(v any) [][]string {
+	value := reflect.ValueOf(v)
+	rows := make([][]string, 0, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		rows = append(rows, []string{name, fmt.Sprint(value.Field(i).Interface())})
+	}
+	return rows
+}
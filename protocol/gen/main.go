@@ -0,0 +1,29 @@
+// Command gen writes the machine-readable description of the protocol (spec.json and spec.yaml) and its reference
+// documentation (SPEC.md) from the Go definitions, run by go generate in the protocol package directory
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/protocol"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the files generated")
+	flag.Parse()
+
+	spec := protocol.Spec()
+	for name, format := range protocol.GeneratedFiles {
+		data, err := spec.Encode(format)
+		if err != nil {
+			log.Fatalf("Error encoding %s: %v", name, err)
+		}
+		err = os.WriteFile(filepath.Join(*dir, name), data, 0644) //nolint:gosec,mnd
+		if err != nil {
+			log.Fatalf("Error writing %s: %v", name, err)
+		}
+	}
+}
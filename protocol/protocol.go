@@ -0,0 +1,162 @@
+// Package protocol describes the data stream protocol programmatically from the Go source of truth: the frame sizes,
+// the limits, the versions and the enumerations of the commands, the command errors and the packet types, so the code
+// generators, the validators and the alternative implementations stay in sync with the library
+package protocol
+
+//go:generate go run ./gen
+
+import (
+	"sort"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer/codec"
+)
+
+const commandSize = 8 // Size in bytes of the command word, the stream type and the tag of a command (u64)
+
+// Specification type for the description of the protocol returned by Spec
+type Specification struct {
+	Version       uint32              `json:"version"`       // Protocol version of this implementation
+	Versions      []Version           `json:"versions"`      // Protocol versions, in order
+	Sizes         Sizes               `json:"sizes"`         // Sizes of the frames and the stream file pages
+	Limits        datastreamer.Limits `json:"limits"`        // Limits enforced by the server
+	Commands      []Command           `json:"commands"`      // Commands of the clients, by code
+	CommandFlags  []Value             `json:"commandFlags"`  // Flag bits of the command word
+	CommandErrors []Value             `json:"commandErrors"` // Error codes of the command results, by code
+	PacketTypes   []PacketType        `json:"packetTypes"`   // Packet types of the frames and the file entries, by code
+	PrivateRange  Range               `json:"privateRange"`  // Packet types reserved for the custom frames
+	EntryTypes    []Value             `json:"entryTypes"`    // Entry types reserved by the protocol
+	Compressions  []Value             `json:"compressions"`  // Codecs of the Compression command, by code
+	Checksums     []Value             `json:"checksums"`     // Algorithms of the Checksum command, by code
+}
+
+// Version type for a protocol version
+type Version struct {
+	Number uint32 `json:"number"` // Version number
+	Name   string `json:"name"`   // Name of the version, after the feature introduced
+}
+
+// Sizes type for the fixed sizes in bytes of the protocol frames and the stream file pages
+type Sizes struct {
+	Command     int `json:"command"`     // Command word, stream type and tag (u64 each)
+	Header      int `json:"header"`      // Header entry
+	HeaderBase  int `json:"headerBase"`  // Header entry with a base entry
+	FileEntry   int `json:"fileEntry"`   // Fixed part of a data entry
+	ResultEntry int `json:"resultEntry"` // Fixed part of a result entry
+	TaggedFrame int `json:"taggedFrame"` // Prefix of a tagged frame
+	CustomFrame int `json:"customFrame"` // Prefix of a custom frame
+	Checksum    int `json:"checksum"`    // Checksum appended to the data of an entry streamed (if negotiated)
+	PageHeader  int `json:"pageHeader"`  // Header page of the stream file
+	PageData    int `json:"pageData"`    // Data page of the stream file
+}
+
+// Command type for a command of the clients
+type Command struct {
+	Code       uint64 `json:"code"`       // Command code
+	Name       string `json:"name"`       // Command name
+	Version    uint32 `json:"version"`    // Protocol version introducing the command
+	Taggable   bool   `json:"taggable"`   // Flag the command can be sent tagged with a subscription/request ID
+	TaggedOnly bool   `json:"taggedOnly"` // Flag the command can only be sent tagged
+}
+
+// Value type for a named value of an enumeration
+type Value struct {
+	Code uint64 `json:"code"` // Value
+	Name string `json:"name"` // Name or description of the value
+}
+
+// PacketType type for a packet type of the frames and the file entries
+type PacketType struct {
+	Code   uint8  `json:"code"`   // Packet type
+	Name   string `json:"name"`   // Name of the packet type
+	Stored bool   `json:"stored"` // Flag the packets are stored in the stream file (not just streamed)
+}
+
+// Range type for an inclusive range of packet types
+type Range struct {
+	First uint8 `json:"first"` // First packet type of the range
+	Last  uint8 `json:"last"`  // Last packet type of the range
+}
+
+// Spec returns the description of the protocol implemented by this library
+func Spec() Specification {
+	spec := Specification{
+		Version: datastreamer.ProtocolVersion,
+		Versions: []Version{
+			{Number: datastreamer.ProtocolLegacy, Name: "Legacy"},
+			{Number: datastreamer.ProtocolTagged, Name: "Tagged"},
+			{Number: datastreamer.ProtocolGroups, Name: "Groups"},
+			{Number: datastreamer.ProtocolPositions, Name: "Positions"},
+			{Number: datastreamer.ProtocolEntryRange, Name: "EntryRange"},
+			{Number: datastreamer.ProtocolEntryTypes, Name: "EntryTypes"},
+			{Number: datastreamer.ProtocolLatestStates, Name: "LatestStates"},
+			{Number: datastreamer.ProtocolCompression, Name: "Compression"},
+			{Number: datastreamer.ProtocolHeartbeat, Name: "Heartbeat"},
+			{Number: datastreamer.ProtocolChecksum, Name: "Checksum"},
+		},
+		Sizes: Sizes{
+			Command:     commandSize,
+			Header:      codec.HeaderSize,
+			HeaderBase:  codec.HeaderSizeBase,
+			FileEntry:   codec.FixedSizeFileEntry,
+			ResultEntry: codec.FixedSizeResultEntry,
+			TaggedFrame: codec.FixedSizeTaggedFrame,
+			CustomFrame: codec.FixedSizeCustomFrame,
+			Checksum:    datastreamer.ChecksumSize,
+			PageHeader:  datastreamer.PageHeaderSize,
+			PageData:    datastreamer.PageDataSize,
+		},
+		Limits: datastreamer.GetLimits(),
+		CommandFlags: []Value{
+			{Code: uint64(datastreamer.CmdFlagTagged), Name: "Tagged"},
+			{Code: uint64(datastreamer.CmdFlagVersioned), Name: "Versioned"},
+		},
+		PacketTypes: []PacketType{
+			{Code: codec.PtPadding, Name: "Padding", Stored: true},
+			{Code: codec.PtHeader, Name: "Header", Stored: true},
+			{Code: codec.PtData, Name: "Data", Stored: true},
+			{Code: codec.PtPong, Name: "Pong"},
+			{Code: codec.PtCompressed, Name: "Compressed"},
+			{Code: codec.PtReconnect, Name: "Reconnect"},
+			{Code: codec.PtShutdown, Name: "Shutdown"},
+			{Code: codec.PtTagged, Name: "Tagged"},
+			{Code: codec.PtDataRsp, Name: "DataRsp"},
+			{Code: codec.PtResult, Name: "Result"},
+		},
+		PrivateRange: Range{First: codec.PtPrivateFirst, Last: codec.PtPrivateLast},
+		EntryTypes: []Value{
+			{Code: codec.EtBookmark, Name: "Bookmark"},
+			{Code: datastreamer.EntryTypeNotFound, Name: "NotFound"},
+		},
+	}
+
+	for cmd := datastreamer.CmdStart; cmd.IsACommand(); cmd++ {
+		spec.Commands = append(spec.Commands, Command{
+			Code:       uint64(cmd),
+			Name:       datastreamer.StrCommand[cmd],
+			Version:    cmd.ProtocolVersion(),
+			Taggable:   cmd.IsTaggable(),
+			TaggedOnly: cmd.IsTaggedOnly(),
+		})
+	}
+	for code, name := range datastreamer.StrCommandErrors {
+		spec.CommandErrors = append(spec.CommandErrors, Value{Code: uint64(code), Name: name})
+	}
+	for code, name := range datastreamer.StrCompression {
+		spec.Compressions = append(spec.Compressions, Value{Code: uint64(code), Name: name})
+	}
+	for code, name := range datastreamer.StrChecksum {
+		spec.Checksums = append(spec.Checksums, Value{Code: uint64(code), Name: name})
+	}
+	sortValues(spec.CommandErrors)
+	sortValues(spec.Compressions)
+	sortValues(spec.Checksums)
+	return spec
+}
+
+// sortValues sorts the values of an enumeration by code
+func sortValues(values []Value) {
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Code < values[j].Code
+	})
+}
@@ -0,0 +1,89 @@
+package protocol_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/0xPolygonHermez/zkevm-data-streamer/protocol"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSpec(t *testing.T) {
+	spec := protocol.Spec()
+
+	// Case: Versions in order up to the protocol version -> Last one is this implementation
+	require.NotEmpty(t, spec.Versions)
+	for i, v := range spec.Versions {
+		require.Equal(t, uint32(i+1), v.Number, v.Name)
+	}
+	require.Equal(t, datastreamer.ProtocolVersion, spec.Versions[len(spec.Versions)-1].Number)
+	require.Equal(t, datastreamer.ProtocolVersion, spec.Version)
+
+	// Case: Commands -> All of them by code, with a name and a known version
+	require.Len(t, spec.Commands, len(datastreamer.StrCommand))
+	for i, cmd := range spec.Commands {
+		require.Equal(t, uint64(i+1), cmd.Code)
+		require.NotEmpty(t, cmd.Name)
+		require.LessOrEqual(t, cmd.Version, spec.Version, cmd.Name)
+		require.False(t, cmd.TaggedOnly && !cmd.Taggable, cmd.Name)
+	}
+	require.Equal(t, protocol.Command{Code: uint64(datastreamer.CmdStart), Name: "Start", Version: 1, Taggable: true},
+		spec.Commands[0])
+
+	// Case: Enumerations -> Sorted by code without duplicates
+	require.Len(t, spec.CommandErrors, len(datastreamer.StrCommandErrors))
+	for _, values := range [][]protocol.Value{spec.CommandErrors, spec.Compressions, spec.Checksums} {
+		for i := 1; i < len(values); i++ {
+			require.Less(t, values[i-1].Code, values[i].Code)
+		}
+	}
+	for i := 1; i < len(spec.PacketTypes); i++ {
+		require.Less(t, spec.PacketTypes[i-1].Code, spec.PacketTypes[i].Code)
+		require.False(t, spec.PacketTypes[i].Code >= spec.PrivateRange.First &&
+			spec.PacketTypes[i].Code <= spec.PrivateRange.Last, spec.PacketTypes[i].Name)
+	}
+
+	// Case: Sizes and limits -> Values of the library
+	require.Equal(t, datastreamer.FixedSizeFileEntry, spec.Sizes.FileEntry)
+	require.Equal(t, datastreamer.PageDataSize, spec.Sizes.PageData)
+	require.Equal(t, datastreamer.GetLimits(), spec.Limits)
+	require.Equal(t, 16, spec.Limits.MaxBookmarkLength)
+
+	// Case: JSON encoding -> Decoded back to the same specification
+	data, err := json.Marshal(spec)
+	require.NoError(t, err)
+	var decoded protocol.Specification
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, spec, decoded)
+}
+
+func TestGeneratedFiles(t *testing.T) {
+	spec := protocol.Spec()
+
+	// Case: Files generated -> Up to date with the Go definitions (run go generate ./protocol)
+	for name, format := range protocol.GeneratedFiles {
+		expected, err := spec.Encode(format)
+		require.NoError(t, err)
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(data), name)
+	}
+
+	// Case: YAML description -> Same fields and values as the JSON one
+	data, err := spec.Encode(protocol.FormatYAML)
+	require.NoError(t, err)
+	var fields map[string]any
+	require.NoError(t, yaml.Unmarshal(data, &fields))
+	data, err = json.Marshal(fields)
+	require.NoError(t, err)
+	var decoded protocol.Specification
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, spec, decoded)
+
+	// Case: Unknown format -> Rejected
+	_, err = spec.Encode("xml")
+	require.ErrorIs(t, err, protocol.ErrUnknownFormat)
+}
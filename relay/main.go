@@ -2,9 +2,12 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"syscall"
 	"time"
@@ -21,6 +24,11 @@ const (
 
 	streamerSystemID = 137
 	streamerVersion  = 1
+
+	defaultLogBuffer    = 1000 // Recent log entries kept by default when served over HTTP
+	defaultStatsSamples = 360  // Samples of the statistics time series kept by default
+
+	defaultLeaseTTL = 10 * time.Second // Duration of the lease of the active/standby pair by default
 )
 
 type config struct {
@@ -29,7 +37,34 @@ type config struct {
 	File              string
 	WriteTimeout      time.Duration
 	InactivityTimeout time.Duration
+	DrainTimeout      time.Duration
+	ReadinessFile     string
+	LazyOpen          bool
+	ReleaseDelay      time.Duration
+	ManualRelease     bool
+	StandbyLease      string
+	StandbyID         string
+	LeaseTTL          time.Duration
+	Dedup             bool
+	Ephemeral         bool
+	HeaderChanges     bool
+	LiveQueue         uint64
+	MaxSession        time.Duration
+	Filter            string
+	Redact            string
+	WriteCoalescing   time.Duration
+	DirectIO          bool
+	Memory            uint64
+	LogBuffer         uint64
+	LogsHTTP          string
+	StatsSeries       time.Duration
+	StatsSamples      uint64
 	Log               string
+
+	SLOInterval         time.Duration
+	SLOMaxClientLag     uint64
+	SLOMaxCommitLatency time.Duration
+	SLOMinThroughput    float64
 }
 
 func main() {
@@ -47,7 +82,7 @@ func main() {
 		&cli.StringFlag{
 			Name:     "cfg",
 			Aliases:  []string{"c"},
-			Usage:    "Configuration file",
+			Usage:    "Configuration file (*.toml|*.yaml)",
 			Required: false,
 		},
 		&cli.StringFlag{
@@ -74,6 +109,110 @@ func main() {
 			Name:  "inactivitytimeout",
 			Usage: "timeout to kill an inactive client connection in seconds (0=no timeout)",
 		},
+		&cli.Uint64Flag{
+			Name:  "draintimeout",
+			Usage: "on SIGTERM, time to let the clients catch-ups finish before closing them in seconds",
+		},
+		&cli.StringFlag{
+			Name:  "readiness-file",
+			Usage: "file written once the relay is ready to accept connections (removed on shutdown)",
+		},
+		&cli.BoolFlag{
+			Name:  "lazyopen",
+			Usage: "serve reads while the relay file is validated in background, sync from the server once validated",
+		},
+		&cli.Uint64Flag{
+			Name:  "releasedelay",
+			Usage: "time to hold the entries received before forwarding them to the relay clients in seconds",
+		},
+		&cli.BoolFlag{
+			Name:  "manualrelease",
+			Usage: "hold the entries received until released with a SIGUSR1 signal",
+		},
+		&cli.StringFlag{
+			Name:  "standbylease",
+			Usage: "lease file shared by an active/standby pair of relays, the relay serves only while holding it",
+		},
+		&cli.StringFlag{
+			Name:  "standbyid",
+			Usage: "holder name of the relay in the lease of the active/standby pair (default <hostname>:<port>)",
+		},
+		&cli.Uint64Flag{
+			Name:  "leasettl",
+			Usage: "duration of the lease of the active/standby pair in seconds (default 10, renewed every third of it)",
+		},
+		&cli.BoolFlag{
+			Name:  "dedup",
+			Usage: "store the entries payload content-addressed, identical payloads stored only once",
+		},
+		&cli.BoolFlag{
+			Name:  "ephemeral",
+			Usage: "store the relay stream in a temporary directory (memory-backed if available) deleted on exit",
+		},
+		&cli.BoolFlag{
+			Name:  "headerchanges",
+			Usage: "record the header changes (commits and truncations) in a meta-stream queryable by the clients",
+		},
+		&cli.Uint64Flag{
+			Name:  "livequeue",
+			Usage: "size of the per-client queues of the live entries, catch-ups served from the file (default 4096)",
+		},
+		&cli.Uint64Flag{
+			Name:  "maxsession",
+			Usage: "maximum duration of the client connections before asking them to reconnect in seconds (0 no limit)",
+		},
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: "filter expression of the entries forwarded to the relay clients (e.g. \"type in (1, 2)\")",
+		},
+		&cli.StringFlag{
+			Name:  "redact",
+			Usage: "payload redaction rules of the entries forwarded to the relay clients (e.g. \"2:zero,3:truncate=8\")",
+		},
+		&cli.Uint64Flag{
+			Name:  "writecoalescing",
+			Usage: "time window to group the writes of the entries to the stream file in ms (e.g. 0-10, 0 disabled)",
+		},
+		&cli.BoolFlag{
+			Name:  "directio",
+			Usage: "write the stream file with direct I/O (O_DIRECT) bypassing the page cache, buffered if not supported",
+		},
+		&cli.Uint64Flag{
+			Name:  "memory",
+			Usage: "memory in MB to size the internal buffers (default detected from the cgroup limits)",
+		},
+		&cli.Uint64Flag{
+			Name:  "logbuffer",
+			Usage: "number of recent log entries kept for the Stats command and the logs HTTP endpoint",
+		},
+		&cli.StringFlag{
+			Name:  "logshttp",
+			Usage: "address to serve the recent log entries and the stats over HTTP (e.g. :8080, at /logs?level=warn, /stats)",
+		},
+		&cli.Uint64Flag{
+			Name:  "statsseries",
+			Usage: "interval in seconds of the samples of the stats time series (e.g. 10, 0 disabled)",
+		},
+		&cli.Uint64Flag{
+			Name:  "statssamples",
+			Usage: "number of samples of the stats time series kept (default 360, the last hour every 10s)",
+		},
+		&cli.Uint64Flag{
+			Name:  "slointerval",
+			Usage: "evaluation window of the service level objectives in seconds (default 10s)",
+		},
+		&cli.Uint64Flag{
+			Name:  "slomaxlag",
+			Usage: "SLO of the maximum entries a relay client is behind the entries committed (0=disabled)",
+		},
+		&cli.Uint64Flag{
+			Name:  "slomaxcommitlatency",
+			Usage: "SLO of the maximum latency of the commits in ms (0=disabled)",
+		},
+		&cli.Float64Flag{
+			Name:  "slominthroughput",
+			Usage: "SLO of the minimum entries committed per second (0=disabled)",
+		},
 	}
 	app.Action = run
 
@@ -95,6 +234,7 @@ func defaultConfig() (*config, error) {
 		File:              "datarelay.bin",
 		WriteTimeout:      3 * time.Second,   //nolint:mnd
 		InactivityTimeout: 120 * time.Second, //nolint:mnd
+		DrainTimeout:      10 * time.Second,  //nolint:mnd
 		Log:               "info",
 	}, nil
 }
@@ -123,6 +263,15 @@ func loadConfig(ctx *cli.Context) (*config, error) {
 	viper.SetEnvKeyReplacer(replacer)
 	viper.SetEnvPrefix("ZKEVM_STREAM")
 
+	// Bind the environment variables of all the options, also the ones missing in the config file
+	cfgType := reflect.TypeOf(*cfg)
+	for i := 0; i < cfgType.NumField(); i++ {
+		err = viper.BindEnv(cfgType.Field(i).Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = viper.ReadInConfig()
 	if err != nil {
 		var configErr *viper.ConfigFileNotFoundError
@@ -136,8 +285,10 @@ func loadConfig(ctx *cli.Context) (*config, error) {
 
 	decodeHooks := []viper.DecoderConfigOption{
 		// this allows arrays to be decoded from env var separated by ",", example: MY_VAR="value1,value2,value3"
+		// and durations from strings, example: WriteTimeout = "3s"
 		viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
 			mapstructure.TextUnmarshallerHookFunc(),
+			mapstructure.StringToTimeDurationHookFunc(),
 			mapstructure.StringToSliceHookFunc(","))),
 	}
 
@@ -188,6 +339,136 @@ func run(ctx *cli.Context) error {
 		cfg.InactivityTimeout = time.Duration(inactivityTimeout * uint64(time.Second))
 	}
 
+	drainTimeout := ctx.Uint64("draintimeout")
+	if drainTimeout != 0 {
+		cfg.DrainTimeout = time.Duration(drainTimeout * uint64(time.Second))
+	}
+
+	readinessFile := ctx.String("readiness-file")
+	if readinessFile != "" {
+		cfg.ReadinessFile = readinessFile
+	}
+
+	if ctx.Bool("lazyopen") {
+		cfg.LazyOpen = true
+	}
+
+	releaseDelay := ctx.Uint64("releasedelay")
+	if releaseDelay != 0 {
+		cfg.ReleaseDelay = time.Duration(releaseDelay * uint64(time.Second))
+	}
+
+	if ctx.Bool("manualrelease") {
+		cfg.ManualRelease = true
+	}
+
+	standbyLease := ctx.String("standbylease")
+	if standbyLease != "" {
+		cfg.StandbyLease = standbyLease
+	}
+
+	standbyID := ctx.String("standbyid")
+	if standbyID != "" {
+		cfg.StandbyID = standbyID
+	}
+
+	leaseTTL := ctx.Uint64("leasettl")
+	if leaseTTL != 0 {
+		cfg.LeaseTTL = time.Duration(leaseTTL * uint64(time.Second))
+	}
+	if cfg.LeaseTTL == 0 {
+		cfg.LeaseTTL = defaultLeaseTTL
+	}
+
+	if ctx.Bool("dedup") {
+		cfg.Dedup = true
+	}
+
+	if ctx.Bool("ephemeral") {
+		cfg.Ephemeral = true
+	}
+
+	if ctx.Bool("headerchanges") {
+		cfg.HeaderChanges = true
+	}
+
+	liveQueue := ctx.Uint64("livequeue")
+	if liveQueue != 0 {
+		cfg.LiveQueue = liveQueue
+	}
+
+	maxSession := ctx.Uint64("maxsession")
+	if maxSession != 0 {
+		cfg.MaxSession = time.Duration(maxSession * uint64(time.Second))
+	}
+
+	filter := ctx.String("filter")
+	if filter != "" {
+		cfg.Filter = filter
+	}
+
+	redact := ctx.String("redact")
+	if redact != "" {
+		cfg.Redact = redact
+	}
+
+	writeCoalescing := ctx.Uint64("writecoalescing")
+	if writeCoalescing != 0 {
+		cfg.WriteCoalescing = time.Duration(writeCoalescing * uint64(time.Millisecond))
+	}
+
+	if ctx.Bool("directio") {
+		cfg.DirectIO = true
+	}
+
+	memory := ctx.Uint64("memory")
+	if memory != 0 {
+		cfg.Memory = memory
+	}
+
+	logBuffer := ctx.Uint64("logbuffer")
+	if logBuffer != 0 {
+		cfg.LogBuffer = logBuffer
+	}
+
+	logsHTTP := ctx.String("logshttp")
+	if logsHTTP != "" {
+		cfg.LogsHTTP = logsHTTP
+	}
+
+	statsSeries := ctx.Uint64("statsseries")
+	if statsSeries != 0 {
+		cfg.StatsSeries = time.Duration(statsSeries * uint64(time.Second))
+	}
+
+	statsSamples := ctx.Uint64("statssamples")
+	if statsSamples != 0 {
+		cfg.StatsSamples = statsSamples
+	}
+	if cfg.StatsSamples == 0 {
+		cfg.StatsSamples = defaultStatsSamples
+	}
+
+	sloInterval := ctx.Uint64("slointerval")
+	if sloInterval != 0 {
+		cfg.SLOInterval = time.Duration(sloInterval * uint64(time.Second))
+	}
+
+	sloMaxLag := ctx.Uint64("slomaxlag")
+	if sloMaxLag != 0 {
+		cfg.SLOMaxClientLag = sloMaxLag
+	}
+
+	sloMaxCommitLatency := ctx.Uint64("slomaxcommitlatency")
+	if sloMaxCommitLatency != 0 {
+		cfg.SLOMaxCommitLatency = time.Duration(sloMaxCommitLatency * uint64(time.Millisecond))
+	}
+
+	sloMinThroughput := ctx.Float64("slominthroughput")
+	if sloMinThroughput != 0 {
+		cfg.SLOMinThroughput = sloMinThroughput
+	}
+
 	// Set log level
 	log.Init(log.Config{
 		Environment: "development",
@@ -195,15 +476,87 @@ func run(ctx *cli.Context) error {
 		Outputs:     []string{"stdout"},
 	})
 
+	// Keep the recent log entries and serve them over HTTP
+	logsMux := startLogs(cfg.LogBuffer, cfg.LogsHTTP)
+
 	log.Infof(">> Relay server started: port[%d] file[%s] server[%s] log[%s]", cfg.Port, cfg.File, cfg.Server, cfg.Log)
 
+	// Size the internal buffers from the memory
+	datastreamer.SetBufferMemory(cfg.Memory << 20) //nolint:mnd
+
 	// Create relay server
-	r, err := datastreamer.NewRelay(cfg.Server, uint16(cfg.Port), streamerVersion, streamerSystemID,
-		StSequencer, cfg.File, cfg.WriteTimeout, cfg.InactivityTimeout, 5*time.Second, nil) //nolint:mnd
+	var r *datastreamer.StreamRelay
+	if cfg.Ephemeral {
+		r, err = datastreamer.NewEphemeralRelay(cfg.Server, uint16(cfg.Port), streamerVersion, streamerSystemID,
+			StSequencer, cfg.WriteTimeout, cfg.InactivityTimeout, 5*time.Second, nil) //nolint:mnd
+	} else {
+		r, err = datastreamer.NewRelay(cfg.Server, uint16(cfg.Port), streamerVersion, streamerSystemID,
+			StSequencer, cfg.File, cfg.WriteTimeout, cfg.InactivityTimeout, 5*time.Second, nil) //nolint:mnd
+	}
 	if err != nil {
 		log.Errorf(">> Relay server: NewRelay error! (%v)", err)
 		return err
 	}
+	r.SetReadinessFile(cfg.ReadinessFile)
+	r.SetBackgroundValidation(cfg.LazyOpen)
+	r.SetReleaseDelay(cfg.ReleaseDelay)
+	r.SetManualRelease(cfg.ManualRelease)
+	if cfg.StandbyLease != "" {
+		if cfg.StandbyID == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return err
+			}
+			cfg.StandbyID = fmt.Sprintf("%s:%d", hostname, cfg.Port)
+		}
+		r.SetStandby(datastreamer.NewFileLease(cfg.StandbyLease), cfg.StandbyID, cfg.LeaseTTL)
+	}
+	if cfg.LiveQueue != 0 {
+		r.SetLiveQueues(int(cfg.LiveQueue))
+	}
+	r.SetMaxSessionDuration(cfg.MaxSession)
+	r.SetWriteCoalescing(cfg.WriteCoalescing)
+	r.SetStatsSeries(cfg.StatsSeries, int(cfg.StatsSamples))
+	r.SetSLO(datastreamer.SLOConfig{
+		Interval:         cfg.SLOInterval,
+		MaxClientLag:     cfg.SLOMaxClientLag,
+		MaxCommitLatency: cfg.SLOMaxCommitLatency,
+		MinThroughput:    cfg.SLOMinThroughput,
+	})
+	if logsMux != nil {
+		logsMux.Handle("/stats", r.StatsHandler())
+	}
+	r.SetDirectIO(cfg.DirectIO)
+	err = r.SetContentAddressing(cfg.Dedup)
+	if err != nil {
+		log.Errorf(">> Relay server: SetContentAddressing error! (%v)", err)
+		return err
+	}
+	err = r.SetHeaderChanges(cfg.HeaderChanges)
+	if err != nil {
+		log.Errorf(">> Relay server: SetHeaderChanges error! (%v)", err)
+		return err
+	}
+	if cfg.Filter != "" {
+		filter, err := datastreamer.NewFilterMiddleware(cfg.Filter)
+		if err != nil {
+			log.Errorf(">> Relay server: NewFilterMiddleware error! (%v)", err)
+			return err
+		}
+		r.UseSendMiddleware(filter)
+	}
+	if cfg.Redact != "" {
+		rules, err := datastreamer.ParseRedactRules(cfg.Redact)
+		if err != nil {
+			log.Errorf(">> Relay server: ParseRedactRules error! (%v)", err)
+			return err
+		}
+		err = r.SetRedaction(rules)
+		if err != nil {
+			log.Errorf(">> Relay server: SetRedaction error! (%v)", err)
+			return err
+		}
+	}
 
 	// Start relay server
 	err = r.Start()
@@ -212,11 +565,83 @@ func run(ctx *cli.Context) error {
 		return err
 	}
 
+	// Release the received entries on SIGUSR1
+	releaseSignal := make(chan os.Signal, 1)
+	notifyRelease(releaseSignal)
+	go func() {
+		for range releaseSignal {
+			log.Infof(">> Relay server: releasing %d entries", r.PendingRelease())
+			r.ReleaseReceived()
+		}
+	}()
+
+	// Reload the config on SIGHUP, moving the listener to a new port
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	go func() {
+		port := cfg.Port
+		for range reloadSignal {
+			port = reloadConfig(ctx, r.Rebind, port)
+		}
+	}()
+
 	// Wait for interrupt signal
 	interruptSignal := make(chan os.Signal, 1)
 	signal.Notify(interruptSignal, os.Interrupt, syscall.SIGTERM)
 	<-interruptSignal
 
+	// Drain the relay clients
+	err = r.Shutdown(cfg.DrainTimeout)
+	if err != nil {
+		log.Errorf(">> Relay server: Shutdown error! (%v)", err)
+	}
+
 	log.Info(">> Relay server finished")
 	return nil
 }
+
+// reloadConfig reloads the config and rebinds the listener of the relay if its port changed, returning the port
+// listening. The rest of the options are applied on the next restart
+func reloadConfig(ctx *cli.Context, rebind func(address string) error, port uint64) uint64 {
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		log.Errorf(">> Relay server: reload config error! (%v)", err)
+		return port
+	}
+	if cfg.Port == port {
+		log.Infof(">> Relay server: config reloaded, port[%d] unchanged", port)
+		return port
+	}
+
+	err = rebind(fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		log.Errorf(">> Relay server: Rebind error! (%v)", err)
+		return port
+	}
+	log.Infof(">> Relay server: config reloaded, port[%d] rebound from port[%d]", cfg.Port, port)
+	return cfg.Port
+}
+
+// startLogs keeps the recent log entries in the ring buffer and serves them over HTTP (if the address is set),
+// returning the HTTP handlers mux to add the statistics (nil if not served)
+func startLogs(buffer uint64, addr string) *http.ServeMux {
+	if buffer == 0 && addr != "" {
+		buffer = defaultLogBuffer
+	}
+	log.SetRingBuffer(int(buffer))
+	if addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/logs", log.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second} //nolint:mnd
+	go func() {
+		log.Infof(">> Relay server: serving recent logs on %s/logs", addr)
+		err := server.ListenAndServe()
+		if err != nil {
+			log.Errorf(">> Relay server: logs HTTP error! (%v)", err)
+		}
+	}()
+	return mux
+}
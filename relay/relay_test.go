@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -20,6 +21,7 @@ func TestDefaultConfig(t *testing.T) {
 		File:              "datarelay.bin",
 		WriteTimeout:      3 * time.Second,
 		InactivityTimeout: 120 * time.Second,
+		DrainTimeout:      10 * time.Second,
 		Log:               "info",
 	}
 
@@ -68,3 +70,74 @@ Log = "debug"
 	assert.NoError(t, err)
 	assert.Equal(t, "127.0.0.1:9090", cfg.Server)
 }
+
+func TestLoadConfigYAML(t *testing.T) {
+	viper.Reset()
+
+	tempDir := t.TempDir()
+	configFile := filepath.Join(tempDir, "test_config.yaml")
+	configContent := `
+Server: "127.0.0.1:8080"
+WriteTimeout: "5s"
+DrainTimeout: "30s"
+`
+
+	err := os.WriteFile(configFile, []byte(configContent), 0600)
+	assert.NoError(t, err)
+
+	app := cli.NewApp()
+	set := flag.NewFlagSet("test", 0)
+	set.String("cfg", configFile, "doc")
+	ctx := cli.NewContext(app, set, nil)
+
+	// Environment variable of an option missing in the config file
+	os.Setenv("ZKEVM_STREAM_PORT", "8100")
+	defer os.Unsetenv("ZKEVM_STREAM_PORT")
+
+	cfg, err := loadConfig(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", cfg.Server)
+	assert.Equal(t, uint64(8100), cfg.Port)
+	assert.Equal(t, "datarelay.bin", cfg.File)
+	assert.Equal(t, 5*time.Second, cfg.WriteTimeout)
+	assert.Equal(t, 30*time.Second, cfg.DrainTimeout)
+}
+
+func TestReloadConfig(t *testing.T) {
+	viper.Reset()
+
+	configFile := filepath.Join(t.TempDir(), "test_config.toml")
+	assert.NoError(t, os.WriteFile(configFile, []byte("Port = 7900\n"), 0600))
+
+	app := cli.NewApp()
+	set := flag.NewFlagSet("test", 0)
+	set.String("cfg", configFile, "doc")
+	ctx := cli.NewContext(app, set, nil)
+
+	addresses := []string{}
+	rebind := func(address string) error {
+		addresses = append(addresses, address)
+		if address == ":7902" {
+			return errors.New("address in use")
+		}
+		return nil
+	}
+
+	// Port unchanged -> Not rebound
+	assert.Equal(t, uint64(7900), reloadConfig(ctx, rebind, 7900))
+	assert.Empty(t, addresses)
+
+	// Port changed -> Rebound to the new port
+	assert.NoError(t, os.WriteFile(configFile, []byte("Port = 7901\n"), 0600))
+	assert.Equal(t, uint64(7901), reloadConfig(ctx, rebind, 7900))
+	assert.Equal(t, []string{":7901"}, addresses)
+
+	// Rebind failed -> Listening on the previous port
+	assert.NoError(t, os.WriteFile(configFile, []byte("Port = 7902\n"), 0600))
+	assert.Equal(t, uint64(7901), reloadConfig(ctx, rebind, 7901))
+
+	// Config not valid -> Listening on the previous port
+	assert.NoError(t, os.WriteFile(configFile, []byte("Port = \n"), 0600))
+	assert.Equal(t, uint64(7901), reloadConfig(ctx, rebind, 7901))
+	assert.Equal(t, []string{":7901", ":7902"}, addresses)
+}
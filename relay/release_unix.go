@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyRelease relays the SIGUSR1 signals releasing the received entries to the channel
+func notifyRelease(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}